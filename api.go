@@ -0,0 +1,180 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The URL suffix of the REST API appended to the HTTP handle URL.
+	httpURLAPISuffix = "api/"
+
+	// The maximum size of a request body.
+	apiMaxBodySize = 1 << 20
+)
+
+//###############//
+//### Private ###//
+//###############//
+
+// isAPIRequest returns true if the request targets the REST API and the API is enabled.
+func (s *Server) isAPIRequest(r *http.Request) bool {
+	return len(s.options.APIToken) > 0 &&
+		strings.HasPrefix(r.URL.Path, s.options.HTTPHandleURL+httpURLAPISuffix)
+}
+
+// serveAPI handles the REST API requests:
+//
+//	POST api/sockets/{id}/send     writes the body to the socket.
+//	POST api/users/{id}/send       writes the body to all sockets of the user.
+//	POST api/broadcast             writes the body to all sockets.
+//	POST api/rooms/{id}/broadcast  publishes the body to the topic.
+//
+// The optional channel query parameter selects the channel. The reserved
+// channel names starting with an underscore are rejected. Requests have
+// to pass the API token as bearer token.
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	statusCode, result, err := func() (int, interface{}, error) {
+		// Check the token.
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.options.APIToken)) != 1 {
+			return http.StatusUnauthorized, nil, fmt.Errorf("invalid API token")
+		}
+
+		if r.Method != "POST" {
+			return http.StatusMethodNotAllowed, nil, fmt.Errorf("invalid request method: %s", r.Method)
+		}
+
+		// Read the message data.
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, apiMaxBodySize))
+		if err != nil {
+			return http.StatusBadRequest, nil, fmt.Errorf("read body: %v", err)
+		}
+		data := string(body)
+
+		// Don't write to the reserved channels of glue.
+		channel := r.URL.Query().Get("channel")
+		if strings.HasPrefix(channel, "_") {
+			return http.StatusBadRequest, nil, fmt.Errorf("reserved channel name: %s", channel)
+		}
+
+		// Route the request. The path values are unescaped after splitting,
+		// so the IDs and topic names may contain slashes.
+		path := strings.TrimPrefix(r.URL.EscapedPath(), s.options.HTTPHandleURL+httpURLAPISuffix)
+		parts := strings.Split(strings.Trim(path, "/"), "/")
+		for i, part := range parts {
+			if parts[i], err = url.PathUnescape(part); err != nil {
+				return http.StatusBadRequest, nil, fmt.Errorf("invalid path: %v", err)
+			}
+		}
+
+		switch {
+		case len(parts) == 3 && parts[0] == "sockets" && parts[2] == "send":
+			socket := s.GetSocket(parts[1])
+			if socket == nil || socket.IsClosed() {
+				return http.StatusNotFound, nil, fmt.Errorf("socket not found: %s", parts[1])
+			}
+
+			writeToSocket(socket, channel, data)
+			return http.StatusOK, map[string]int{"sent": 1}, nil
+
+		case len(parts) == 3 && parts[0] == "users" && parts[2] == "send":
+			if len(channel) == 0 {
+				return http.StatusOK, map[string]bool{"live": s.WriteToUser(parts[1], data)}, nil
+			}
+
+			sent := 0
+			for _, socket := range s.SocketsByUserID(parts[1]) {
+				if !socket.IsClosed() {
+					writeToSocket(socket, channel, data)
+					sent++
+				}
+			}
+			return http.StatusOK, map[string]bool{"live": sent > 0}, nil
+
+		case len(parts) == 1 && parts[0] == "broadcast":
+			sent := 0
+			for _, socket := range s.Sockets() {
+				if socket.IsInitialized() && !socket.IsClosed() {
+					writeToSocket(socket, channel, data)
+					sent++
+				}
+			}
+			return http.StatusOK, map[string]int{"sent": sent}, nil
+
+		case len(parts) == 3 && parts[0] == "rooms" && parts[2] == "broadcast":
+			// Don't create topics by API requests.
+			t := s.getTopic(parts[1])
+			if t == nil {
+				return http.StatusNotFound, nil, fmt.Errorf("topic not found: %s", parts[1])
+			}
+
+			t.Publish(data)
+			return http.StatusOK, map[string]bool{"published": true}, nil
+
+		default:
+			return http.StatusNotFound, nil, fmt.Errorf("invalid API request")
+		}
+	}()
+
+	// Handle the error.
+	if err != nil {
+		http.Error(w, err.Error(), statusCode)
+
+		// Get the remote address.
+		remoteAddr, _ := utils.RemoteAddress(r)
+
+		// Log the invalid request.
+		log.L.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"url":           r.URL.Path,
+		}).Warningf("glue: handle API request: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeToSocket writes the data to the channel of the socket.
+// The main channel is used if the channel name is empty.
+func writeToSocket(socket *Socket, channel, data string) {
+	if len(channel) == 0 {
+		socket.Write(data)
+		return
+	}
+
+	socket.Channel(channel).Write(data)
+}
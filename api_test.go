@@ -0,0 +1,123 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testAPIToken = "secret"
+
+// apiRequest passes the API request to the server and
+// returns the response status code and body.
+func apiRequest(server *Server, method, token, path, body string) (int, string) {
+	r := httptest.NewRequest(method, "/glue/api/"+path, strings.NewReader(body))
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+func TestAPIRequests(t *testing.T) {
+	server := newTestServer(t, Options{APIToken: testAPIToken})
+	server.Topic("news/de")
+
+	_, s := connectTestSocket(t, server)
+	s.SetUserID("user")
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		path   string
+		status int
+		result string
+	}{
+		{"no token", "POST", "", "broadcast", http.StatusUnauthorized, ""},
+		{"invalid token", "POST", "invalid", "broadcast", http.StatusUnauthorized, ""},
+		{"invalid method", "GET", testAPIToken, "broadcast", http.StatusMethodNotAllowed, ""},
+		{"unknown path", "POST", testAPIToken, "unknown", http.StatusNotFound, ""},
+		{"unknown socket", "POST", testAPIToken, "sockets/unknown/send", http.StatusNotFound, ""},
+		{"unknown topic", "POST", testAPIToken, "rooms/unknown/broadcast", http.StatusNotFound, ""},
+		{"reserved channel", "POST", testAPIToken, "broadcast?channel=_capacity", http.StatusBadRequest, ""},
+		{"reserved socket channel", "POST", testAPIToken, "sockets/" + s.ID() + "/send?channel=_rel", http.StatusBadRequest, ""},
+		{"socket", "POST", testAPIToken, "sockets/" + s.ID() + "/send", http.StatusOK, `{"sent":1}`},
+		{"user", "POST", testAPIToken, "users/user/send?channel=news", http.StatusOK, `{"live":true}`},
+		{"offline user", "POST", testAPIToken, "users/offline/send?channel=news", http.StatusOK, `{"live":false}`},
+		{"broadcast", "POST", testAPIToken, "broadcast", http.StatusOK, `{"sent":1}`},
+		{"topic", "POST", testAPIToken, "rooms/" + url.PathEscape("news/de") + "/broadcast", http.StatusOK, `{"published":true}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, result := apiRequest(server, test.method, test.token, test.path, "data")
+			if status != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, status, result)
+			}
+			if len(test.result) > 0 && result != test.result {
+				t.Fatalf("expected result %s, got %s", test.result, result)
+			}
+		})
+	}
+}
+
+func TestAPIWrite(t *testing.T) {
+	server := newTestServer(t, Options{APIToken: testAPIToken})
+	topic := server.Topic("news")
+
+	conn, s := connectTestSocket(t, server)
+	topic.Subscribe(s)
+
+	tests := []struct {
+		path    string
+		channel string
+	}{
+		{"sockets/" + s.ID() + "/send", mainChannelName},
+		{"sockets/" + s.ID() + "/send?channel=chat", "chat"},
+		{"broadcast?channel=chat", "chat"},
+		{"rooms/news/broadcast", "news"},
+		{"rooms/news/broadcast?channel=chat", "news"},
+	}
+
+	for _, test := range tests {
+		if status, result := apiRequest(server, "POST", testAPIToken, test.path, "hello"); status != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d: %s", test.path, status, result)
+		}
+
+		if name, data := receiveChannelData(t, conn); name != test.channel || data != "hello" {
+			t.Fatalf("%s: unexpected data: %s:%s", test.path, name, data)
+		}
+	}
+}
+
+func TestAPIDisabled(t *testing.T) {
+	server := newTestServer(t)
+
+	if status, _ := apiRequest(server, "POST", "", "broadcast", "data"); status == http.StatusOK {
+		t.Fatal("the API is enabled without token")
+	}
+}
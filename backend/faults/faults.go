@@ -0,0 +1,292 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package faults injects network failures into backend sockets for testing.
+// Frames are delayed, dropped or reordered and sockets are closed randomly,
+// so the reconnect and resume logic of applications can be verified
+// against realistic failure modes.
+package faults
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/desertbit/glue/backend"
+	"github.com/desertbit/glue/backend/global"
+)
+
+//####################//
+//### Options type ###//
+//####################//
+
+// Options define the failures injected into the frames of both directions.
+// The zero value injects no failures.
+type Options struct {
+	// Latency delays each frame. A random jitter up to LatencyJitter is added.
+	// The order of the frames is preserved.
+	Latency       time.Duration
+	LatencyJitter time.Duration
+
+	// DropRate is the probability between 0 and 1 that a frame is dropped.
+	DropRate float64
+
+	// ReorderRate is the probability between 0 and 1 that a frame
+	// is held back and passed after the following frame.
+	ReorderRate float64
+
+	// DisconnectAfter closes each socket after a random duration with
+	// DisconnectAfter as mean value. Zero disables the random disconnects.
+	DisconnectAfter time.Duration
+
+	// Seed initializes the random source of each socket for reproducible
+	// runs. Zero uses a random seed for each socket.
+	Seed int64
+}
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// A frame held back to be reordered is passed after this
+	// duration if no following frame is passed before.
+	maxHoldDuration = 100 * time.Millisecond
+)
+
+//###############//
+//### Helpers ###//
+//###############//
+
+// Wrap returns a backend socket injecting the failures of the options
+// into the frames of the socket. The native keepalive and the request
+// headers of the socket are preserved if supported.
+func Wrap(bs backend.BackendSocket, o Options) backend.BackendSocket {
+	seed := o.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	f := &Socket{
+		BackendSocket: bs,
+		o:             o,
+		writeChan:     make(chan string, global.WriteChanSize),
+		readChan:      make(chan string, global.ReadChanSize),
+		writeRand:     rand.New(rand.NewSource(r.Int63())),
+		readRand:      rand.New(rand.NewSource(r.Int63())),
+	}
+
+	// Pass the frames of both directions through the injected failures.
+	go f.forward(f.writeChan, bs.WriteChan(), f.writeRand)
+	go f.forward(bs.ReadChan(), f.readChan, f.readRand)
+
+	// Close the socket randomly.
+	if o.DisconnectAfter > 0 {
+		d := time.Duration(r.ExpFloat64() * float64(o.DisconnectAfter))
+		timer := time.AfterFunc(d, bs.Close)
+
+		go func() {
+			<-bs.ClosedChan()
+			timer.Stop()
+		}()
+	}
+
+	if p, ok := bs.(backend.Pinger); ok {
+		return &pingerSocket{
+			Socket: f,
+			Pinger: p,
+		}
+	}
+
+	return f
+}
+
+//###################//
+//### Socket type ###//
+//###################//
+
+// A Socket wraps a backend socket and injects failures into its frames.
+type Socket struct {
+	backend.BackendSocket
+
+	o         Options
+	writeChan chan string
+	readChan  chan string
+
+	// The random sources are only accessed by the forward loop of their direction.
+	writeRand *rand.Rand
+	readRand  *rand.Rand
+}
+
+// WriteChan returns the write channel passing the frames to the wrapped socket.
+func (f *Socket) WriteChan() chan string {
+	return f.writeChan
+}
+
+// ReadChan returns the read channel with the frames of the wrapped socket.
+func (f *Socket) ReadChan() chan string {
+	return f.readChan
+}
+
+// Header returns the HTTP request headers of the wrapped socket.
+// Nil is returned if the wrapped socket doesn't provide them.
+func (f *Socket) Header() http.Header {
+	if h, ok := f.BackendSocket.(backend.HeaderSocket); ok {
+		return h.Header()
+	}
+	return nil
+}
+
+// A pingerSocket preserves the native keepalive of the wrapped socket.
+type pingerSocket struct {
+	*Socket
+	backend.Pinger
+}
+
+//################################//
+//### Socket - Private methods ###//
+//################################//
+
+// A delayedFrame is passed at the due time.
+type delayedFrame struct {
+	data string
+	due  time.Time
+}
+
+// forward passes the frames from the in to the out channel
+// with the injected failures until the socket closes.
+func (f *Socket) forward(in <-chan string, out chan<- string, r *rand.Rand) {
+	closedChan := f.ClosedChan()
+	delayed := make(chan delayedFrame, global.WriteChanSize)
+
+	// Pass the delayed frames at their due time.
+	go func() {
+		for {
+			select {
+			case d := <-delayed:
+				if wait := d.due.Sub(time.Now()); wait > 0 {
+					timer := time.NewTimer(wait)
+					select {
+					case <-timer.C:
+					case <-closedChan:
+						timer.Stop()
+						return
+					}
+				}
+
+				select {
+				case out <- d.data:
+				case <-closedChan:
+					return
+				}
+			case <-closedChan:
+				return
+			}
+		}
+	}()
+
+	var (
+		held      []string    // The frames held back to be reordered.
+		holdTimer *time.Timer // Releases the held frames.
+		lastDue   time.Time   // Preserves the order of the delayed frames.
+	)
+
+	pass := func(data string) bool {
+		due := time.Now().Add(f.o.Latency)
+		if f.o.LatencyJitter > 0 {
+			due = due.Add(time.Duration(r.Int63n(int64(f.o.LatencyJitter))))
+		}
+		if due.Before(lastDue) {
+			due = lastDue
+		}
+		lastDue = due
+
+		select {
+		case delayed <- delayedFrame{data: data, due: due}:
+			return true
+		case <-closedChan:
+			return false
+		}
+	}
+
+	release := func() bool {
+		if holdTimer != nil {
+			holdTimer.Stop()
+			holdTimer = nil
+		}
+
+		for _, h := range held {
+			if !pass(h) {
+				return false
+			}
+		}
+		held = held[:0]
+
+		return true
+	}
+
+	for {
+		var (
+			data     string
+			holdChan <-chan time.Time
+		)
+
+		if holdTimer != nil {
+			holdChan = holdTimer.C
+		}
+
+		select {
+		case data = <-in:
+		case <-holdChan:
+			holdTimer = nil
+			if !release() {
+				return
+			}
+			continue
+		case <-closedChan:
+			return
+		}
+
+		// Flush frames are never dropped or reordered.
+		// The held frames are passed before.
+		if strings.HasPrefix(data, global.FlushFrameMarker) {
+			if !release() || !pass(data) {
+				return
+			}
+			continue
+		}
+
+		// Drop the frame.
+		if f.o.DropRate > 0 && r.Float64() < f.o.DropRate {
+			continue
+		}
+
+		// Hold back the frame until the next frame is passed.
+		if f.o.ReorderRate > 0 && len(held) == 0 && r.Float64() < f.o.ReorderRate {
+			held = append(held, data)
+			holdTimer = time.NewTimer(maxHoldDuration)
+			continue
+		}
+
+		if !pass(data) || !release() {
+			return
+		}
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package faults
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/desertbit/glue/backend"
+	"github.com/desertbit/glue/backend/global"
+)
+
+// testSocket is a backend socket with request headers.
+type testSocket struct {
+	header     http.Header
+	writeChan  chan string
+	readChan   chan string
+	closedChan chan struct{}
+	closeOnce  sync.Once
+}
+
+func newTestSocket() *testSocket {
+	return &testSocket{
+		header:     http.Header{"X-Test": []string{"value"}},
+		writeChan:  make(chan string, global.WriteChanSize),
+		readChan:   make(chan string, global.ReadChanSize),
+		closedChan: make(chan struct{}),
+	}
+}
+
+func (s *testSocket) Type() global.SocketType     { return global.TypeWebSocket }
+func (s *testSocket) RemoteAddr() string          { return "127.0.0.1" }
+func (s *testSocket) UserAgent() string           { return "test" }
+func (s *testSocket) Close()                      { s.closeOnce.Do(func() { close(s.closedChan) }) }
+func (s *testSocket) ClosedChan() <-chan struct{} { return s.closedChan }
+func (s *testSocket) WriteChan() chan string      { return s.writeChan }
+func (s *testSocket) ReadChan() chan string       { return s.readChan }
+func (s *testSocket) OnExpired(f func(string))    {}
+func (s *testSocket) OnFlushed(f func(string))    {}
+func (s *testSocket) Header() http.Header         { return s.header }
+
+func (s *testSocket) IsClosed() bool {
+	select {
+	case <-s.closedChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// testPingerSocket additionally supports the native keepalive.
+type testPingerSocket struct {
+	*testSocket
+}
+
+func (s *testPingerSocket) Ping() error     { return nil }
+func (s *testPingerSocket) OnPong(f func()) {}
+
+// testPlainSocket hides the request headers.
+type testPlainSocket struct {
+	backend.BackendSocket
+}
+
+func TestWrapInterfaces(t *testing.T) {
+	tests := map[string]struct {
+		bs     backend.BackendSocket
+		pinger bool
+		header bool
+	}{
+		"header":        {newTestSocket(), false, true},
+		"header pinger": {&testPingerSocket{newTestSocket()}, true, true},
+		"plain":         {testPlainSocket{newTestSocket()}, false, false},
+	}
+
+	for name, test := range tests {
+		w := Wrap(test.bs, Options{})
+
+		if _, ok := w.(backend.Pinger); ok != test.pinger {
+			t.Errorf("%s: pinger preserved: %v", name, ok)
+		}
+
+		h, ok := w.(backend.HeaderSocket)
+		if !ok {
+			t.Fatalf("%s: no header socket", name)
+		}
+		if got := h.Header().Get("X-Test") == "value"; got != test.header {
+			t.Errorf("%s: header preserved: %v", name, got)
+		}
+
+		test.bs.Close()
+	}
+}
+
+func TestWrapForward(t *testing.T) {
+	bs := newTestSocket()
+	defer bs.Close()
+
+	w := Wrap(bs, Options{})
+
+	w.WriteChan() <- "out"
+	if data := <-bs.WriteChan(); data != "out" {
+		t.Fatalf("unexpected written frame: %q", data)
+	}
+
+	bs.ReadChan() <- "in"
+	if data := <-w.ReadChan(); data != "in" {
+		t.Fatalf("unexpected read frame: %q", data)
+	}
+}
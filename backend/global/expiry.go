@@ -0,0 +1,100 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package global
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// ExpiryFrameMarker is prepended together with a deadline to data
+	// passed to the write channel. Socket types drop the frame if it is
+	// still buffered after the deadline. The header is removed before sending.
+	ExpiryFrameMarker = "\x01"
+)
+
+//###############//
+//### Helpers ###//
+//###############//
+
+// ExpiryFrame prepends the expiry header with the deadline to the data.
+func ExpiryFrame(deadline time.Time, data string) string {
+	return ExpiryFrameMarker + strconv.FormatInt(deadline.UnixNano(), 10) + ExpiryFrameMarker + data
+}
+
+//###################//
+//### Expiry type ###//
+//###################//
+
+// Expiry handles expiry frames for socket types.
+// Embed it into the socket type to implement the OnExpired method.
+type Expiry struct {
+	onExpired func(data string)
+	mutex     sync.Mutex
+}
+
+// OnExpired sets the function which is called with the frame data
+// of frames dropped due to an exceeded deadline.
+func (e *Expiry) OnExpired(f func(data string)) {
+	// Lock the mutex.
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.onExpired = f
+}
+
+// Filter removes the expiry header from the frame.
+// False is returned if the frame expired and must not be sent.
+// The expired callback is called in this case.
+func (e *Expiry) Filter(data string) (string, bool) {
+	if !strings.HasPrefix(data, ExpiryFrameMarker) {
+		return data, true
+	}
+
+	// Split the deadline from the data.
+	data = data[len(ExpiryFrameMarker):]
+	pos := strings.Index(data, ExpiryFrameMarker)
+	if pos < 0 {
+		return data, true
+	}
+
+	deadline, err := strconv.ParseInt(data[:pos], 10, 64)
+	data = data[pos+len(ExpiryFrameMarker):]
+	if err != nil || time.Now().UnixNano() < deadline {
+		return data, true
+	}
+
+	// Get the callback.
+	e.mutex.Lock()
+	f := e.onExpired
+	e.mutex.Unlock()
+
+	if f != nil {
+		f(data)
+	}
+
+	return "", false
+}
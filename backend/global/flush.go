@@ -0,0 +1,85 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package global
+
+import (
+	"strings"
+	"sync"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// FlushFrameMarker is prepended to the ID of flush frames passed
+	// to the write channel. Socket types don't send flush frames, but
+	// call the flushed callback as soon as all previous frames are
+	// passed to the transport.
+	FlushFrameMarker = "\x02"
+)
+
+//###############//
+//### Helpers ###//
+//###############//
+
+// FlushFrame creates a flush frame with the ID.
+func FlushFrame(id string) string {
+	return FlushFrameMarker + id
+}
+
+//##################//
+//### Flush type ###//
+//##################//
+
+// Flush handles flush frames for socket types.
+// Embed it into the socket type to implement the OnFlushed method.
+type Flush struct {
+	onFlushed func(id string)
+	mutex     sync.Mutex
+}
+
+// OnFlushed sets the function which is called with the ID of
+// each flush frame taken from the write channel.
+func (f *Flush) OnFlushed(fn func(id string)) {
+	// Lock the mutex.
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.onFlushed = fn
+}
+
+// HandleFlush returns true if the data is a flush frame, which must not be sent.
+// The flushed callback is called with the frame ID in this case.
+func (f *Flush) HandleFlush(data string) bool {
+	if !strings.HasPrefix(data, FlushFrameMarker) {
+		return false
+	}
+
+	// Get the callback.
+	f.mutex.Lock()
+	fn := f.onFlushed
+	f.mutex.Unlock()
+
+	if fn != nil {
+		fn(data[len(FlushFrameMarker):])
+	}
+
+	return true
+}
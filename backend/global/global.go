@@ -23,6 +23,11 @@ const (
 	// Channel buffer sizes:
 	ReadChanSize  = 5
 	WriteChanSize = 10
+
+	// BinaryFrameMarker is prepended to data passed to the write channel
+	// which should be send as binary frame by socket types supporting
+	// binary data. The marker is removed before sending.
+	BinaryFrameMarker = "\x00"
 )
 
 //############################//
@@ -33,6 +38,11 @@ type SocketType int
 
 const (
 	// The available socket types.
-	TypeAjaxSocket SocketType = 1 << iota
-	TypeWebSocket  SocketType = 1 << iota
+	TypeAjaxSocket     SocketType = 1 << iota
+	TypeWebSocket      SocketType = 1 << iota
+	TypeMuxSocket      SocketType = 1 << iota
+	TypeMemSocket      SocketType = 1 << iota
+	TypeSockJSSocket   SocketType = 1 << iota
+	TypeEngineIOSocket SocketType = 1 << iota
+	TypeSocketIOSocket SocketType = 1 << iota
 )
@@ -22,9 +22,13 @@ package backend
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 	"github.com/desertbit/glue/backend/sockets/ajaxsocket"
+	"github.com/desertbit/glue/backend/sockets/engineiosocket"
+	"github.com/desertbit/glue/backend/sockets/socketiosocket"
+	"github.com/desertbit/glue/backend/sockets/sockjssocket"
 	"github.com/desertbit/glue/backend/sockets/websocket"
 	"github.com/desertbit/glue/log"
 	"github.com/desertbit/glue/utils"
@@ -37,6 +41,9 @@ import (
 const (
 	httpURLAjaxSocketSuffix = "ajax"
 	httpURLWebSocketSuffix  = "ws"
+	httpURLSockJSSuffix     = "sockjs"
+	httpURLEngineIOSuffix   = "engine.io"
+	httpURLSocketIOSuffix   = "socket.io"
 )
 
 //######################//
@@ -45,6 +52,8 @@ const (
 
 type Server struct {
 	onNewSocketConnection func(BackendSocket)
+	onHandshakeRequest    func(remoteAddr string, r *http.Request) bool
+	onHandshakeResponse   func(http.ResponseWriter, *http.Request)
 
 	// An Integer holding the length of characters which should be stripped
 	// from the ServerHTTP URL path.
@@ -59,15 +68,20 @@ type Server struct {
 	// Socket Servers
 	webSocketServer  *websocket.Server
 	ajaxSocketServer *ajaxsocket.Server
+	sockJSServer     *sockjssocket.Server   // Set if the SockJS endpoint is enabled.
+	engineIOServer   *engineiosocket.Server // Set if the engine.io endpoint is enabled.
+	socketIOServer   *engineiosocket.Server // Set if the socket.io endpoint is enabled.
 }
 
-func NewServer(httpURLStripLength int, enableCORS bool, checkOrigin func(r *http.Request) bool) *Server {
+func NewServer(httpURLStripLength int, enableCORS bool, checkOrigin func(r *http.Request) bool, ajaxOptions ajaxsocket.Options) *Server {
 	// Create a new backend server.
 	s := &Server{
 		// Set a dummy function.
 		// This prevents panics, if new sockets are created,
 		// but no function was set.
 		onNewSocketConnection: func(BackendSocket) {},
+		onHandshakeRequest:    func(string, *http.Request) bool { return true },
+		onHandshakeResponse:   func(http.ResponseWriter, *http.Request) {},
 
 		httpURLStripLength: httpURLStripLength,
 		enableCORS:         enableCORS,
@@ -77,22 +91,62 @@ func NewServer(httpURLStripLength int, enableCORS bool, checkOrigin func(r *http
 	// Create the websocket server and pass the function which handles new incoming socket connections.
 	s.webSocketServer = websocket.NewServer(func(ws *websocket.Socket) {
 		s.triggerOnNewSocketConnection(ws)
-	})
+	}, s.triggerOnHandshakeRequest, s.triggerOnHandshakeResponse)
 
 	// Create the ajax server and pass the function which handles new incoming socket connections.
 	s.ajaxSocketServer = ajaxsocket.NewServer(func(as *ajaxsocket.Socket) {
 		s.triggerOnNewSocketConnection(as)
-	})
+	}, s.triggerOnHandshakeRequest, s.triggerOnHandshakeResponse, ajaxOptions)
 
 	return s
 }
 
+// EnableSockJS serves the SockJS endpoint below the sockjs URL path.
+// Call this before the server handles requests.
+func (s *Server) EnableSockJS(o sockjssocket.Options) {
+	s.sockJSServer = sockjssocket.NewServer(func(ss *sockjssocket.Socket) {
+		s.triggerOnNewSocketConnection(ss)
+	}, s.triggerOnHandshakeRequest, s.triggerOnHandshakeResponse, o)
+}
+
+// EnableEngineIO serves the engine.io endpoint below the engine.io URL path.
+// Call this before the server handles requests.
+func (s *Server) EnableEngineIO(o engineiosocket.Options) {
+	s.engineIOServer = engineiosocket.NewServer(func(es *engineiosocket.Socket) {
+		s.triggerOnNewSocketConnection(es)
+	}, s.triggerOnHandshakeRequest, s.triggerOnHandshakeResponse, o)
+}
+
+// EnableSocketIO serves the socket.io endpoint below the socket.io URL path.
+// The socket.io packets are carried by engine.io sessions. The version is
+// the glue protocol version passed with the init requests of the clients.
+// Call this before the server handles requests.
+func (s *Server) EnableSocketIO(o engineiosocket.Options, version string) {
+	s.socketIOServer = engineiosocket.NewServer(func(es *engineiosocket.Socket) {
+		s.triggerOnNewSocketConnection(socketiosocket.NewSocket(es, version))
+	}, s.triggerOnHandshakeRequest, s.triggerOnHandshakeResponse, o)
+}
+
 // OnNewSocketConnection sets the event function which is
 // triggered if a new socket connection was made.
 func (s *Server) OnNewSocketConnection(f func(BackendSocket)) {
 	s.onNewSocketConnection = f
 }
 
+// OnHandshakeRequest sets the function which is called for each websocket
+// upgrade and ajax init request before the socket is created. Requests are
+// rejected with the status 429 Too Many Requests if false is returned.
+func (s *Server) OnHandshakeRequest(f func(remoteAddr string, r *http.Request) bool) {
+	s.onHandshakeRequest = f
+}
+
+// OnHandshakeResponse sets the function which is called before the
+// websocket upgrade and ajax init responses are written. Headers and
+// cookies set on the response writer are passed to the client.
+func (s *Server) OnHandshakeResponse(f func(http.ResponseWriter, *http.Request)) {
+	s.onHandshakeResponse = f
+}
+
 // ServeHTTP implements the HTTP Handler interface of the http package.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Get the URL path.
@@ -130,6 +184,15 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		} else if path == httpURLAjaxSocketSuffix {
 			// Handle the ajax request.
 			s.ajaxSocketServer.HandleRequest(w, r)
+		} else if s.sockJSServer != nil && (path == httpURLSockJSSuffix || strings.HasPrefix(path, httpURLSockJSSuffix+"/")) {
+			// Handle the SockJS request with the path below the SockJS URL.
+			s.sockJSServer.HandleRequest(w, r, path[len(httpURLSockJSSuffix):])
+		} else if s.engineIOServer != nil && (path == httpURLEngineIOSuffix || path == httpURLEngineIOSuffix+"/") {
+			// Handle the engine.io request.
+			s.engineIOServer.HandleRequest(w, r)
+		} else if s.socketIOServer != nil && (path == httpURLSocketIOSuffix || path == httpURLSocketIOSuffix+"/") {
+			// Handle the socket.io request.
+			s.socketIOServer.HandleRequest(w, r)
 		} else {
 			return http.StatusBadRequest, fmt.Errorf("invalid request")
 		}
@@ -147,7 +210,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		userAgent := r.Header.Get("User-Agent")
 
 		// Log the invalid request.
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 			"url":           r.URL.Path,
@@ -164,3 +227,11 @@ func (s *Server) triggerOnNewSocketConnection(bs BackendSocket) {
 	// to not block any socket functions. Otherwise this might block HTTP handlers.
 	go s.onNewSocketConnection(bs)
 }
+
+func (s *Server) triggerOnHandshakeRequest(remoteAddr string, r *http.Request) bool {
+	return s.onHandshakeRequest(remoteAddr, r)
+}
+
+func (s *Server) triggerOnHandshakeResponse(w http.ResponseWriter, r *http.Request) {
+	s.onHandshakeResponse(w, r)
+}
@@ -18,7 +18,11 @@
 
 package backend
 
-import "github.com/desertbit/glue/backend/global"
+import (
+	"net/http"
+
+	"github.com/desertbit/glue/backend/global"
+)
 
 //################################//
 //### Backend Socket Interface ###//
@@ -35,4 +39,38 @@ type BackendSocket interface {
 
 	WriteChan() chan string
 	ReadChan() chan string
+
+	// OnExpired sets the function which is called with the frame
+	// data of expiry frames dropped from the write channel.
+	OnExpired(f func(data string))
+
+	// OnFlushed sets the function which is called with the ID of
+	// flush frames as soon as all previous frames are passed to the transport.
+	OnFlushed(f func(id string))
+}
+
+//##################################//
+//### Native Keepalive Interface ###//
+//##################################//
+
+// A Pinger is implemented by backend sockets with native keepalive
+// control frames, for example websockets.
+type Pinger interface {
+	// Ping sends a native ping control frame.
+	Ping() error
+
+	// OnPong sets the function which is called as soon as
+	// a pong control frame is received.
+	OnPong(f func())
+}
+
+//################################//
+//### Request Header Interface ###//
+//################################//
+
+// A HeaderSocket is implemented by backend sockets which are
+// created by an HTTP request, for example websockets and ajax sockets.
+type HeaderSocket interface {
+	// Header returns the headers of the HTTP request which created the socket.
+	Header() http.Header
 }
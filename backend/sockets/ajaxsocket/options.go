@@ -0,0 +1,153 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ajaxsocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultPollTimeout    = 35 * time.Second
+	defaultPushRetryDelay = time.Second
+	defaultMaxBodySize    = 10 << 20
+	defaultReadTimeout    = 30 * time.Second
+)
+
+// defaultHeaders are set on all ajax responses. Intermediary caches and
+// proxy buffering (nginx) break or delay the long polling otherwise.
+var defaultHeaders = map[string]string{
+	"Cache-Control":     "no-store, no-cache, must-revalidate",
+	"Pragma":            "no-cache",
+	"Expires":           "0",
+	"X-Accel-Buffering": "no",
+}
+
+//####################//
+//### Options type ###//
+//####################//
+
+// Options holds the ajax socket server options.
+type Options struct {
+	// PollTimeout is the maximum duration a poll request is held open.
+	// Some proxies kill requests which are held open longer than 30 seconds.
+	// Default: 35 seconds
+	PollTimeout time.Duration
+
+	// PollDelay is the delay of the client before the next poll request
+	// is sent after a poll response with data. This limits the request
+	// rate of the client. Messages are buffered in between.
+	// Default: 0
+	PollDelay time.Duration
+
+	// PushRetries is the number of times the client retries a failed push
+	// request before the connection is treated as lost. The server drops retried
+	// pushes with a known sequence number, so messages are not delivered twice.
+	// Default: 0
+	PushRetries int
+
+	// PushRetryDelay is the delay of the client before a push is retried.
+	// Default: 1 second
+	PushRetryDelay time.Duration
+
+	// MaxBodySize is the maximum size of the request body in bytes.
+	// Larger requests are rejected with the status 413 Request Entity Too Large.
+	// Default: 10 MB
+	MaxBodySize int64
+
+	// ReadTimeout is the maximum duration to read the request body.
+	// Slow requests are aborted, so they don't hold a handler goroutine.
+	// Default: 30 seconds
+	ReadTimeout time.Duration
+
+	// Headers are set on all ajax responses. They are merged with the
+	// default headers, which prevent caching and proxy buffering.
+	// An empty value removes a default header.
+	Headers map[string]string
+}
+
+// setDefaults sets unset option values to its default value.
+func (o *Options) setDefaults() {
+	if o.PollTimeout <= 0 {
+		o.PollTimeout = defaultPollTimeout
+	}
+	if o.PollDelay < 0 {
+		o.PollDelay = 0
+	}
+	if o.PushRetries < 0 {
+		o.PushRetries = 0
+	}
+	if o.PushRetryDelay <= 0 {
+		o.PushRetryDelay = defaultPushRetryDelay
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = defaultMaxBodySize
+	}
+	if o.ReadTimeout <= 0 {
+		o.ReadTimeout = defaultReadTimeout
+	}
+
+	// Merge the headers with the default headers.
+	// Don't modify the passed map.
+	headers := make(map[string]string, len(defaultHeaders)+len(o.Headers))
+	for key, value := range defaultHeaders {
+		headers[key] = value
+	}
+	for key, value := range o.Headers {
+		key = http.CanonicalHeaderKey(key)
+		if len(value) == 0 {
+			delete(headers, key)
+		} else {
+			headers[key] = value
+		}
+	}
+	o.Headers = headers
+}
+
+// clientOptions returns the options passed to the client with the ajax
+// init response. Durations are in milliseconds. The batch flag tells the
+// client that several messages can be sent with one push request and the
+// seq flag that the push requests are protected with sequence numbers.
+func (o *Options) clientOptions() string {
+	data, err := json.Marshal(struct {
+		PollTimeout    int64 `json:"pollTimeout"`
+		PollDelay      int64 `json:"pollDelay"`
+		PushRetries    int   `json:"pushRetries"`
+		PushRetryDelay int64 `json:"pushRetryDelay"`
+		Batch          bool  `json:"batch"`
+		Seq            bool  `json:"seq"`
+	}{
+		PollTimeout:    int64(o.PollTimeout / time.Millisecond),
+		PollDelay:      int64(o.PollDelay / time.Millisecond),
+		PushRetries:    o.PushRetries,
+		PushRetryDelay: int64(o.PushRetryDelay / time.Millisecond),
+		Batch:          true,
+		Seq:            true,
+	})
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
+}
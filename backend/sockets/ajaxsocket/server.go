@@ -20,9 +20,16 @@
 package ajaxsocket
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -37,19 +44,27 @@ import (
 //#################//
 
 const (
-	ajaxPollTimeout     = 35 * time.Second
 	ajaxUIDLength       = 10
 	ajaxPollTokenLength = 7
+	ajaxSecretLength    = 32
+
+	// The delimiter between the UID and the signature of the session token.
+	ajaxSessionTokenDelimiter = "."
 
 	// Ajax poll data commands:
 	ajaxPollCmdTimeout = "t"
 	ajaxPollCmdClosed  = "c"
 
+	// The ajax transport protocol version passed with the init request.
+	// Version 2 added the signed session tokens, the client options
+	// and the batched and sequenced pushes.
+	ajaxProtocolVersion = "2"
+
 	// Ajax protocol commands:
 	ajaxSocketDataDelimiter = "&"
 	ajaxSocketDataKeyLength = 1
 	ajaxSocketDataKeyInit   = "i"
-	ajaxSocketDataKeyPush   = "u"
+	ajaxSocketDataKeySeq    = "s"
 	ajaxSocketDataKeyPoll   = "o"
 )
 
@@ -62,12 +77,33 @@ type Server struct {
 	socketsMutex sync.Mutex
 
 	onNewSocketConnection func(*Socket)
+	onHandshakeRequest    func(string, *http.Request) bool
+	onHandshakeResponse   func(http.ResponseWriter, *http.Request)
+
+	options       Options
+	clientOptions string // Passed to the client with the init response.
+
+	secret []byte // Signs the session tokens.
 }
 
-func NewServer(onNewSocketConnectionFunc func(*Socket)) *Server {
+func NewServer(onNewSocketConnectionFunc func(*Socket), onHandshakeRequestFunc func(string, *http.Request) bool, onHandshakeResponseFunc func(http.ResponseWriter, *http.Request), o Options) *Server {
+	// Set the default option values for unset values.
+	o.setDefaults()
+
+	// Create a random secret to sign the session tokens.
+	secret := make([]byte, ajaxSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Errorf("ajax: failed to create the session token secret: %v", err))
+	}
+
 	return &Server{
 		sockets:               make(map[string]*Socket),
 		onNewSocketConnection: onNewSocketConnectionFunc,
+		onHandshakeRequest:    onHandshakeRequestFunc,
+		onHandshakeResponse:   onHandshakeResponseFunc,
+		options:               o,
+		clientOptions:         o.clientOptions(),
+		secret:                secret,
 	}
 }
 
@@ -76,21 +112,31 @@ func (s *Server) HandleRequest(w http.ResponseWriter, req *http.Request) {
 	remoteAddr, _ := utils.RemoteAddress(req)
 	userAgent := req.Header.Get("User-Agent")
 
+	// Prevent caching and proxy buffering of the responses.
+	for key, value := range s.options.Headers {
+		w.Header().Set(key, value)
+	}
+
 	// Get the request body data.
-	body, err := ioutil.ReadAll(req.Body)
+	body, err := s.readBody(w, req)
 	if err != nil {
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 		}).Warningf("failed to read ajax request body: %v", err)
 
-		http.Error(w, "Internal Server Error", 500)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Bad Request", 400)
+		}
 		return
 	}
 
 	// Check for bad requests.
 	if req.Method != "POST" {
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 		}).Warningf("client accessed the ajax interface with an invalid http method: %s", req.Method)
@@ -117,7 +163,7 @@ func (s *Server) HandleRequest(w http.ResponseWriter, req *http.Request) {
 
 	// Validate the head length.
 	if len(head) < ajaxSocketDataKeyLength {
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 		}).Warningf("ajax: head data is too short: '%s'", head)
@@ -133,13 +179,28 @@ func (s *Server) HandleRequest(w http.ResponseWriter, req *http.Request) {
 	// Handle the specific request.
 	switch key {
 	case ajaxSocketDataKeyInit:
-		s.initAjaxRequest(remoteAddr, userAgent, w)
+		// Reject clients with another transport protocol version.
+		// Older clients can't handle the init response.
+		if value != ajaxProtocolVersion {
+			log.Backend.WithFields(logrus.Fields{
+				"remoteAddress": remoteAddr,
+				"userAgent":     userAgent,
+				"version":       value,
+			}).Warningf("ajax: unsupported client protocol version")
+
+			http.Error(w, "Unsupported Protocol Version", http.StatusBadRequest)
+			return
+		}
+
+		s.initAjaxRequest(remoteAddr, userAgent, w, req)
 	case ajaxSocketDataKeyPoll:
-		s.pollAjaxRequest(value, remoteAddr, userAgent, data, w)
-	case ajaxSocketDataKeyPush:
+		s.pollAjaxRequest(value, remoteAddr, userAgent, data, w, req)
+	case ajaxSocketDataKeySeq:
 		s.pushAjaxRequest(value, remoteAddr, userAgent, data, w)
 	default:
-		log.L.WithFields(logrus.Fields{
+		// Pushes without a sequence number are rejected as well. The seq
+		// flag of the init response tells the client to always send them.
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 			"key":           key,
@@ -151,13 +212,44 @@ func (s *Server) HandleRequest(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func (s *Server) initAjaxRequest(remoteAddr, userAgent string, w http.ResponseWriter) {
+// readBody reads the request body limited by the maximum body size
+// and the read timeout.
+func (s *Server) readBody(w http.ResponseWriter, req *http.Request) ([]byte, error) {
+	// Set the read deadline of the connection. Not all response
+	// writers support deadlines. The error is ignored in this case.
+	rc := http.NewResponseController(w)
+	deadlineSet := rc.SetReadDeadline(time.Now().Add(s.options.ReadTimeout)) == nil
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, s.options.MaxBodySize))
+	if err != nil {
+		// Keep the deadline. The connection is closed after the error
+		// response and must not block while discarding the remaining body.
+		return nil, err
+	}
+
+	// Remove the deadline again. Poll requests are held open longer
+	// and the connection might be reused for the next request.
+	if deadlineSet {
+		rc.SetReadDeadline(time.Time{})
+	}
+
+	return body, nil
+}
+
+func (s *Server) initAjaxRequest(remoteAddr, userAgent string, w http.ResponseWriter, req *http.Request) {
 	var uid string
 
+	// Check if the handshake is allowed, for example by the rate limit.
+	if !s.onHandshakeRequest(remoteAddr, req) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
 	// Create a new ajax socket value.
 	a := newSocket(s)
 	a.remoteAddr = remoteAddr
 	a.userAgent = userAgent
+	a.header = req.Header.Clone()
 
 	func() {
 		// Lock the mutex
@@ -188,107 +280,185 @@ func (s *Server) initAjaxRequest(remoteAddr, userAgent string, w http.ResponseWr
 	// Create a new poll token.
 	a.pollToken = utils.RandomString(ajaxPollTokenLength)
 
-	// Tell the client the UID and poll token.
-	io.WriteString(w, uid+ajaxSocketDataDelimiter+a.pollToken)
+	// Set the custom headers and cookies of the init response.
+	s.onHandshakeResponse(w, req)
+
+	// Tell the client the signed session token, poll token and the client options.
+	// The client passes the session token with each poll and push request.
+	io.WriteString(w, s.sessionToken(uid)+ajaxSocketDataDelimiter+a.pollToken+ajaxSocketDataDelimiter+s.clientOptions)
 
 	// Trigger the event that a new socket connection was made.
 	s.onNewSocketConnection(a)
 }
 
-func (s *Server) pushAjaxRequest(uid, remoteAddr, userAgent, data string, w http.ResponseWriter) {
+// sessionToken returns the session token of the UID, which is
+// signed to authenticate the poll and push requests of the client.
+func (s *Server) sessionToken(uid string) string {
+	return uid + ajaxSessionTokenDelimiter + s.sign(uid)
+}
+
+// sign returns the HMAC-SHA256 signature of the UID.
+func (s *Server) sign(uid string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(uid))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// getSocket returns the ajax socket of the signed session token.
+// The signature is checked in constant time.
+func (s *Server) getSocket(token string) (*Socket, error) {
+	// Split the UID from the signature.
+	i := strings.LastIndex(token, ajaxSessionTokenDelimiter)
+	if i < 0 {
+		return nil, fmt.Errorf("invalid session token")
+	}
+	uid, signature := token[:i], token[i+1:]
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(uid))) {
+		return nil, fmt.Errorf("invalid session token signature")
+	}
+
+	// Lock the mutex.
+	s.socketsMutex.Lock()
+	defer s.socketsMutex.Unlock()
+
 	// Obtain the ajax socket with the uid.
-	a := func() *Socket {
-		// Lock the mutex.
-		s.socketsMutex.Lock()
-		defer s.socketsMutex.Unlock()
+	a, ok := s.sockets[uid]
+	if !ok {
+		return nil, fmt.Errorf("invalid ajax socket uid: socket is closed or does not exist")
+	}
 
-		// Obtain the ajax socket with the uid-
-		a, ok := s.sockets[uid]
-		if !ok {
-			return nil
-		}
-		return a
-	}()
+	return a, nil
+}
 
-	if a == nil {
-		log.L.WithFields(logrus.Fields{
+// pushAjaxRequest handles the data pushed by the client. A push is prefixed
+// with the sequence number and contains several length-prefixed messages,
+// which are passed in order. Replayed or retried pushes are not passed again.
+func (s *Server) pushAjaxRequest(token, remoteAddr, userAgent, data string, w http.ResponseWriter) {
+	// Obtain the ajax socket with the signed session token.
+	a, err := s.getSocket(token)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
-			"uid":           uid,
-		}).Warningf("ajax: client requested an invalid ajax socket: uid is invalid!")
+		}).Warningf("ajax: client push request: %v", err)
 
 		http.Error(w, "Bad Request", 400)
 		return
 	}
 
-	// The user agents have to match.
-	if a.userAgent != userAgent {
-		log.L.WithFields(logrus.Fields{
-			"remoteAddress":   remoteAddr,
-			"userAgent":       userAgent,
-			"uid":             uid,
-			"clientUserAgent": userAgent,
-			"socketUserAgent": a.userAgent,
-		}).Warningf("ajax: client push request: user agents do not match!")
+	// Check if the push request was called with no data.
+	if len(data) == 0 {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+			"uid":           a.uid,
+		}).Warningf("ajax: client push request with no data!")
 
 		http.Error(w, "Bad Request", 400)
 		return
 	}
 
-	// Check if the push request was called with no data.
-	if len(data) == 0 {
-		log.L.WithFields(logrus.Fields{
+	// Split the sequence number from the data.
+	seq, data, err := splitSequence(data)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
-			"uid":           uid,
-		}).Warningf("ajax: client push request with no data!")
+			"uid":           a.uid,
+		}).Warningf("ajax: client push request: %v", err)
 
 		http.Error(w, "Bad Request", 400)
 		return
 	}
 
+	// Split the batched messages. Validate all before passing any.
+	msgs, err := splitBatch(data)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+			"uid":           a.uid,
+		}).Warningf("ajax: client batch push request: %v", err)
+
+		http.Error(w, "Bad Request", 400)
+		return
+	}
+
+	// Check the sequence number after the request was validated.
+	// Duplicates are acknowledged, but not passed again.
+	accepted, err := a.acceptSequence(seq)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+			"uid":           a.uid,
+			"seq":           seq,
+		}).Warningf("ajax: client push request: %v", err)
+
+		http.Error(w, "Bad Request", 400)
+		return
+	} else if !accepted {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+			"uid":           a.uid,
+			"seq":           seq,
+		}).Debugf("ajax: client push request: dropped duplicate sequence number")
+		return
+	}
+
 	// Update the remote address. The client might be behind a proxy.
 	a.remoteAddr = remoteAddr
 
 	// Write the received data to the read channel.
-	a.readChan <- data
+	for _, msg := range msgs {
+		a.readChan <- msg
+	}
 }
 
-func (s *Server) pollAjaxRequest(uid, remoteAddr, userAgent, data string, w http.ResponseWriter) {
-	// Obtain the ajax socket with the uid.
-	a := func() *Socket {
-		// Lock the mutex.
-		s.socketsMutex.Lock()
-		defer s.socketsMutex.Unlock()
+// splitBatch splits the length-prefixed messages of a batch push.
+func splitBatch(data string) ([]string, error) {
+	var msgs []string
 
-		// Obtain the ajax socket with the uid-
-		a, ok := s.sockets[uid]
-		if !ok {
-			return nil
+	for len(data) > 0 {
+		msg, rest, err := utils.UnmarshalValues(data)
+		if err != nil {
+			return nil, err
+		} else if len(msg) == 0 {
+			return nil, fmt.Errorf("empty message")
 		}
-		return a
-	}()
 
-	if a == nil {
-		log.L.WithFields(logrus.Fields{
-			"remoteAddress": remoteAddr,
-			"userAgent":     userAgent,
-			"uid":           uid,
-		}).Warningf("ajax: client requested an invalid ajax socket: uid is invalid!")
+		msgs = append(msgs, msg)
+		data = rest
+	}
 
-		http.Error(w, "Bad Request", 400)
-		return
+	return msgs, nil
+}
+
+// splitSequence splits the sequence number from the data of a sequenced push.
+func splitSequence(data string) (uint64, string, error) {
+	i := strings.Index(data, ajaxSocketDataDelimiter)
+	if i < 0 {
+		return 0, "", fmt.Errorf("missing sequence number")
 	}
 
-	// The user agents have to match.
-	if a.userAgent != userAgent {
-		log.L.WithFields(logrus.Fields{
-			"remoteAddress":   remoteAddr,
-			"userAgent":       userAgent,
-			"uid":             uid,
-			"clientUserAgent": userAgent,
-			"socketUserAgent": a.userAgent,
-		}).Warningf("ajax: client poll request: user agents do not match!")
+	seq, err := strconv.ParseUint(data[:i], 10, 64)
+	if err != nil || seq == 0 {
+		return 0, "", fmt.Errorf("invalid sequence number: '%s'", data[:i])
+	}
+
+	return seq, data[i+1:], nil
+}
+
+func (s *Server) pollAjaxRequest(token, remoteAddr, userAgent, data string, w http.ResponseWriter, req *http.Request) {
+	// Obtain the ajax socket with the signed session token.
+	a, err := s.getSocket(token)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+		}).Warningf("ajax: client poll request: %v", err)
 
 		http.Error(w, "Bad Request", 400)
 		return
@@ -297,10 +467,10 @@ func (s *Server) pollAjaxRequest(uid, remoteAddr, userAgent, data string, w http
 	// Check if the poll tokens matches.
 	// The poll token is the data value.
 	if a.pollToken != data {
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress":   remoteAddr,
 			"userAgent":       userAgent,
-			"uid":             uid,
+			"uid":             a.uid,
 			"clientPollToken": data,
 			"socketPollToken": a.pollToken,
 		}).Warningf("ajax: client poll request: poll tokens do not match!")
@@ -309,11 +479,8 @@ func (s *Server) pollAjaxRequest(uid, remoteAddr, userAgent, data string, w http
 		return
 	}
 
-	// Create a new poll token.
-	a.pollToken = utils.RandomString(ajaxPollTokenLength)
-
 	// Create a timeout timer for the poll.
-	timeout := time.NewTimer(ajaxPollTimeout)
+	timeout := time.NewTimer(s.options.PollTimeout)
 
 	defer func() {
 		// Stop the timeout timer.
@@ -321,15 +488,41 @@ func (s *Server) pollAjaxRequest(uid, remoteAddr, userAgent, data string, w http
 	}()
 
 	// Send messages as soon as there are some available.
-	select {
-	case data := <-a.writeChan:
-		// Send the new poll token and message data to the client.
-		io.WriteString(w, a.pollToken+ajaxSocketDataDelimiter+data)
-	case <-timeout.C:
-		// Tell the client that this ajax connection has reached the timeout.
-		io.WriteString(w, ajaxPollCmdTimeout)
-	case <-a.closer.IsClosedChan:
-		// Tell the client that this ajax connection is closed.
-		io.WriteString(w, ajaxPollCmdClosed)
+	for {
+		select {
+		case data := <-a.writeChan:
+			// Previous messages were sent with previous poll requests.
+			if a.HandleFlush(data) {
+				continue
+			}
+
+			// Drop expired frames and wait for the next message.
+			data, ok := a.Filter(data)
+			if !ok {
+				continue
+			}
+
+			// Create a new poll token. The timeout and closed responses
+			// don't pass a token and the client keeps the current one.
+			a.pollToken = utils.RandomString(ajaxPollTokenLength)
+
+			// Send the new poll token and message data to the client.
+			// Flush the response to pass it through buffering proxies and
+			// HTTP/2 streams right away. Not all response writers support it.
+			io.WriteString(w, a.pollToken+ajaxSocketDataDelimiter+data)
+			http.NewResponseController(w).Flush()
+		case <-req.Context().Done():
+			// The client aborted the poll request. This is detected right
+			// away for HTTP/2 streams, which share one connection. Don't
+			// take any messages. They are passed with the next poll request.
+		case <-timeout.C:
+			// Tell the client that this ajax connection has reached the timeout.
+			io.WriteString(w, ajaxPollCmdTimeout)
+		case <-a.closer.IsClosedChan:
+			// Tell the client that this ajax connection is closed.
+			io.WriteString(w, ajaxPollCmdClosed)
+		}
+
+		return
 	}
 }
@@ -0,0 +1,162 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package ajaxsocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTestServer() (*Server, chan *Socket) {
+	sockets := make(chan *Socket, 10)
+	s := NewServer(func(a *Socket) {
+		sockets <- a
+	}, func(string, *http.Request) bool {
+		return true
+	}, func(http.ResponseWriter, *http.Request) {}, Options{})
+
+	return s, sockets
+}
+
+func request(s *Server, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.HandleRequest(w, httptest.NewRequest("POST", "/ajax", strings.NewReader(body)))
+	return w
+}
+
+// push sends the messages with the sequence number.
+func push(s *Server, token string, seq uint64, msgs ...string) *httptest.ResponseRecorder {
+	body := ajaxSocketDataKeySeq + token + ajaxSocketDataDelimiter + strconv.FormatUint(seq, 10) + ajaxSocketDataDelimiter
+	for _, msg := range msgs {
+		body += strconv.Itoa(len(msg)) + ajaxSocketDataDelimiter + msg
+	}
+
+	return request(s, body)
+}
+
+// initSocket initializes a new ajax socket and returns its session token.
+func initSocket(t *testing.T, s *Server, sockets chan *Socket) (*Socket, string) {
+	w := request(s, ajaxSocketDataKeyInit+ajaxProtocolVersion)
+	if w.Code != http.StatusOK {
+		t.Fatalf("init failed: %v", w.Code)
+	}
+
+	parts := strings.SplitN(w.Body.String(), ajaxSocketDataDelimiter, 3)
+	if len(parts) != 3 {
+		t.Fatalf("invalid init response: %q", w.Body.String())
+	}
+
+	return <-sockets, parts[0]
+}
+
+func TestInitProtocolVersion(t *testing.T) {
+	s, sockets := newTestServer()
+
+	for _, body := range []string{"i", "i1", "i3"} {
+		if w := request(s, body); w.Code != http.StatusBadRequest {
+			t.Errorf("init %q: expected status 400, got %v", body, w.Code)
+		}
+	}
+	if len(sockets) != 0 {
+		t.Fatal("socket created for an unsupported client version")
+	}
+
+	a, token := initSocket(t, s, sockets)
+	if !strings.HasPrefix(token, a.uid+ajaxSessionTokenDelimiter) {
+		t.Fatalf("invalid session token: %q", token)
+	}
+}
+
+func TestSessionTokenSignature(t *testing.T) {
+	s, sockets := newTestServer()
+	a, token := initSocket(t, s, sockets)
+
+	// The unsigned UID and a forged signature are rejected.
+	for _, forged := range []string{a.uid, a.uid + ajaxSessionTokenDelimiter + "forged"} {
+		if w := push(s, forged, 1, "data"); w.Code != http.StatusBadRequest {
+			t.Errorf("forged token %q accepted", forged)
+		}
+	}
+
+	if w := push(s, token, 1, "data"); w.Code != http.StatusOK {
+		t.Fatalf("push failed: %v", w.Code)
+	}
+	if data := <-a.readChan; data != "data" {
+		t.Fatalf("invalid data: %q", data)
+	}
+}
+
+func TestPushRequiresSequence(t *testing.T) {
+	s, sockets := newTestServer()
+	a, token := initSocket(t, s, sockets)
+
+	// Pushes without a sequence number are rejected, even before the first sequenced push.
+	for _, body := range []string{
+		"u" + token + ajaxSocketDataDelimiter + "data",
+		"b" + token + ajaxSocketDataDelimiter + "4&data",
+		ajaxSocketDataKeySeq + token + ajaxSocketDataDelimiter + "4&data",
+		ajaxSocketDataKeySeq + token + ajaxSocketDataDelimiter + "0&4&data",
+	} {
+		if w := request(s, body); w.Code != http.StatusBadRequest {
+			t.Errorf("push %q: expected status 400, got %v", body, w.Code)
+		}
+	}
+	if len(a.readChan) != 0 {
+		t.Fatal("data of an invalid push was passed")
+	}
+}
+
+func TestPushSequence(t *testing.T) {
+	s, sockets := newTestServer()
+	a, token := initSocket(t, s, sockets)
+
+	// A batch is passed in order.
+	if w := push(s, token, 2, "a", "b"); w.Code != http.StatusOK {
+		t.Fatalf("push failed: %v", w.Code)
+	}
+	// Pushes might arrive out of order.
+	if w := push(s, token, 1, "c"); w.Code != http.StatusOK {
+		t.Fatalf("push failed: %v", w.Code)
+	}
+	// Retries are acknowledged, but not passed again.
+	if w := push(s, token, 2, "a", "b"); w.Code != http.StatusOK {
+		t.Fatalf("retry failed: %v", w.Code)
+	}
+
+	for _, expected := range []string{"a", "b", "c"} {
+		if data := <-a.readChan; data != expected {
+			t.Fatalf("expected %q, got %q", expected, data)
+		}
+	}
+	if len(a.readChan) != 0 {
+		t.Fatal("a retried push was passed again")
+	}
+
+	// Sequence numbers before the window are rejected.
+	if w := push(s, token, ajaxSequenceWindowSize+10, "d"); w.Code != http.StatusOK {
+		t.Fatalf("push failed: %v", w.Code)
+	}
+	<-a.readChan
+	if w := push(s, token, 3, "e"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an outdated sequence number, got %v", w.Code)
+	}
+}
@@ -19,10 +19,24 @@
 package ajaxsocket
 
 import (
+	"fmt"
+	"net/http"
+	"sync"
+
 	"github.com/desertbit/glue/backend/closer"
 	"github.com/desertbit/glue/backend/global"
 )
 
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The number of sequence numbers below the highest received one,
+	// which are still accepted once. Older pushes are rejected.
+	ajaxSequenceWindowSize = 64
+)
+
 //########################//
 //### Ajax Socket type ###//
 //########################//
@@ -32,11 +46,19 @@ type Socket struct {
 	pollToken  string
 	userAgent  string
 	remoteAddr string
+	header     http.Header
 
 	closer *closer.Closer
+	global.Expiry
+	global.Flush
 
 	writeChan chan string
 	readChan  chan string
+
+	// The sequence window of the push requests.
+	seqMax    uint64 // The highest received sequence number. Zero if none.
+	seqWindow uint64 // Bit i is set if the sequence number seqMax-i was received.
+	seqMutex  sync.Mutex
 }
 
 // Create a new ajax socket.
@@ -78,6 +100,10 @@ func (s *Socket) UserAgent() string {
 	return s.userAgent
 }
 
+func (s *Socket) Header() http.Header {
+	return s.header
+}
+
 func (s *Socket) Close() {
 	s.closer.Close()
 }
@@ -97,3 +123,41 @@ func (s *Socket) WriteChan() chan string {
 func (s *Socket) ReadChan() chan string {
 	return s.readChan
 }
+
+//################################//
+//### Ajax Socket - Sequencing ###//
+//################################//
+
+// acceptSequence marks the sequence number as received. False is returned
+// for duplicates and an error for sequence numbers outside the window.
+func (s *Socket) acceptSequence(seq uint64) (bool, error) {
+	// Lock the mutex.
+	s.seqMutex.Lock()
+	defer s.seqMutex.Unlock()
+
+	// Move the window forward.
+	if seq > s.seqMax {
+		if shift := seq - s.seqMax; shift >= ajaxSequenceWindowSize {
+			s.seqWindow = 0
+		} else {
+			s.seqWindow <<= shift
+		}
+
+		s.seqWindow |= 1
+		s.seqMax = seq
+		return true, nil
+	}
+
+	diff := s.seqMax - seq
+	if diff >= ajaxSequenceWindowSize {
+		return false, fmt.Errorf("sequence number %d is outside the window", seq)
+	}
+
+	bit := uint64(1) << diff
+	if s.seqWindow&bit != 0 {
+		return false, nil
+	}
+	s.seqWindow |= bit
+
+	return true, nil
+}
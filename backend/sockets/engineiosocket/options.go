@@ -0,0 +1,76 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package engineiosocket
+
+import (
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultPingInterval   = 25 * time.Second
+	defaultPingTimeout    = 20 * time.Second
+	defaultUpgradeTimeout = 10 * time.Second
+	defaultMaxPayload     = 1000000
+)
+
+//####################//
+//### Options type ###//
+//####################//
+
+// Options holds the engine.io server options.
+type Options struct {
+	// PingInterval is the interval of the ping packets sent by the server.
+	// Default: 25 seconds
+	PingInterval time.Duration
+
+	// PingTimeout closes the session if the client doesn't answer
+	// a ping packet with a pong packet within the timeout.
+	// Default: 20 seconds
+	PingTimeout time.Duration
+
+	// UpgradeTimeout cancels an upgrade from polling to websocket
+	// if it is not completed by the client within the timeout.
+	// Default: 10 seconds
+	UpgradeTimeout time.Duration
+
+	// MaxPayload is the maximum size of a request body and of a websocket
+	// message in bytes. It is passed to the client with the handshake.
+	// Default: 1 MB
+	MaxPayload int64
+}
+
+// setDefaults sets unset option values to its default value.
+func (o *Options) setDefaults() {
+	if o.PingInterval <= 0 {
+		o.PingInterval = defaultPingInterval
+	}
+	if o.PingTimeout <= 0 {
+		o.PingTimeout = defaultPingTimeout
+	}
+	if o.UpgradeTimeout <= 0 {
+		o.UpgradeTimeout = defaultUpgradeTimeout
+	}
+	if o.MaxPayload <= 0 {
+		o.MaxPayload = defaultMaxPayload
+	}
+}
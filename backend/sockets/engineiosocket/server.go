@@ -0,0 +1,551 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package engineiosocket provides a backend socket implementing the
+// engine.io protocol version 4. The engine.io client with its polling and
+// websocket transports carries the glue protocol.
+package engineiosocket
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/closer"
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The supported engine.io protocol version.
+	protocolVersion = "4"
+
+	// The length of the session IDs.
+	sessionIDLength = 20
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// The engine.io request errors.
+	errTransportUnknown           = &requestError{0, "Transport unknown"}
+	errSessionIDUnknown           = &requestError{1, "Session ID unknown"}
+	errBadHandshakeMethod         = &requestError{2, "Bad handshake method"}
+	errBadRequest                 = &requestError{3, "Bad request"}
+	errUnsupportedProtocolVersion = &requestError{5, "Unsupported protocol version"}
+)
+
+//##########################//
+//### Request Error type ###//
+//##########################//
+
+// A requestError is passed to the client with the status 400 Bad Request.
+type requestError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *requestError) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(e)
+}
+
+//#############################//
+//### engine.io Server type ###//
+//#############################//
+
+type Server struct {
+	sessions      map[string]*Socket
+	sessionsMutex sync.Mutex
+
+	upgrader websocket.Upgrader
+
+	onNewSocketConnection func(*Socket)
+	onHandshakeRequest    func(string, *http.Request) bool
+	onHandshakeResponse   func(http.ResponseWriter, *http.Request)
+
+	options Options
+}
+
+func NewServer(onNewSocketConnectionFunc func(*Socket), onHandshakeRequestFunc func(string, *http.Request) bool, onHandshakeResponseFunc func(http.ResponseWriter, *http.Request), o Options) *Server {
+	// Set the default option values for unset values.
+	o.setDefaults()
+
+	return &Server{
+		sessions: make(map[string]*Socket),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Don't check the origin. This is done by the backend server package.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		onNewSocketConnection: onNewSocketConnectionFunc,
+		onHandshakeRequest:    onHandshakeRequestFunc,
+		onHandshakeResponse:   onHandshakeResponseFunc,
+		options:               o,
+	}
+}
+
+// HandleRequest handles the engine.io request.
+func (s *Server) HandleRequest(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	if query.Get("EIO") != protocolVersion {
+		errUnsupportedProtocolVersion.write(w)
+		return
+	}
+
+	sid := query.Get("sid")
+
+	switch query.Get("transport") {
+	case "websocket":
+		s.handleWebSocket(w, req, sid)
+
+	case "polling":
+		// The JSONP polling is not supported.
+		if _, ok := query["j"]; ok {
+			errTransportUnknown.write(w)
+			return
+		}
+
+		if len(sid) == 0 {
+			s.handleHandshake(w, req)
+			return
+		}
+
+		s.sessionsMutex.Lock()
+		sock, ok := s.sessions[sid]
+		s.sessionsMutex.Unlock()
+
+		if !ok {
+			errSessionIDUnknown.write(w)
+			return
+		}
+
+		switch req.Method {
+		case http.MethodGet:
+			s.handlePoll(w, req, sock)
+		case http.MethodPost:
+			s.handlePost(w, req, sock)
+		default:
+			errBadRequest.write(w)
+		}
+
+	default:
+		errTransportUnknown.write(w)
+	}
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// setNoCache prevents caching of the response.
+func setNoCache(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store, no-cache, no-transform, must-revalidate, max-age=0")
+}
+
+// newSocket creates a new socket of the request and starts the heartbeat.
+func (s *Server) newSocket(req *http.Request, remoteAddr string) *Socket {
+	sock := newSocket()
+	sock.id = utils.RandomString(sessionIDLength)
+	sock.remoteAddr = remoteAddr
+	sock.userAgent = req.Header.Get("User-Agent")
+	sock.header = req.Header.Clone()
+
+	// Set the closer function.
+	sock.closer = closer.New(func() {
+		// Remove the session.
+		func() {
+			s.sessionsMutex.Lock()
+			defer s.sessionsMutex.Unlock()
+
+			if s.sessions[sock.id] == sock {
+				delete(s.sessions, sock.id)
+			}
+		}()
+
+		// The pending polling request passes the close packet.
+		ws := sock.webSocket()
+		if ws == nil {
+			return
+		}
+
+		// Send the close packet and close the websocket. Ignore errors.
+		sock.writeWebSocket(ws, packetClose)
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+		ws.Close()
+	})
+
+	go s.heartbeatLoop(sock)
+
+	return sock
+}
+
+// openPacket returns the open packet of the handshake.
+func (s *Server) openPacket(sock *Socket, upgrades []string) string {
+	data, _ := json.Marshal(struct {
+		SID          string   `json:"sid"`
+		Upgrades     []string `json:"upgrades"`
+		PingInterval int64    `json:"pingInterval"`
+		PingTimeout  int64    `json:"pingTimeout"`
+		MaxPayload   int64    `json:"maxPayload"`
+	}{
+		SID:          sock.id,
+		Upgrades:     upgrades,
+		PingInterval: s.options.PingInterval.Milliseconds(),
+		PingTimeout:  s.options.PingTimeout.Milliseconds(),
+		MaxPayload:   s.options.MaxPayload,
+	})
+
+	return packetOpen + string(data)
+}
+
+// handleHandshake creates a new session with the polling transport.
+func (s *Server) handleHandshake(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		errBadHandshakeMethod.write(w)
+		return
+	}
+
+	// Check if the handshake is allowed, for example by the rate limit.
+	remoteAddr, _ := utils.RemoteAddress(req)
+	if !s.onHandshakeRequest(remoteAddr, req) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	sock := s.newSocket(req, remoteAddr)
+
+	// Add the session.
+	s.sessionsMutex.Lock()
+	s.sessions[sock.id] = sock
+	s.sessionsMutex.Unlock()
+
+	// Set the custom headers and cookies of the handshake response.
+	s.onHandshakeResponse(w, req)
+
+	setNoCache(w)
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	io.WriteString(w, s.openPacket(sock, []string{"websocket"}))
+
+	// Trigger the event that a new socket connection was made.
+	s.onNewSocketConnection(sock)
+}
+
+// handlePoll passes the next packets of the session.
+// Only one polling request is allowed at a time.
+func (s *Server) handlePoll(w http.ResponseWriter, req *http.Request, sock *Socket) {
+	// Overlapping polling requests close the session.
+	if !sock.pollMutex.TryLock() {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": sock.RemoteAddr(),
+			"userAgent":     sock.UserAgent(),
+		}).Warningf("engine.io: overlapping polling request")
+
+		errBadRequest.write(w)
+		sock.Close()
+		return
+	}
+	defer sock.pollMutex.Unlock()
+
+	// The session was upgraded to the websocket transport.
+	if sock.webSocket() != nil {
+		errBadRequest.write(w)
+		return
+	}
+
+	setNoCache(w)
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+
+	sock.nextPackets(sock.paused(), req.Context().Done(), func(packets []string) error {
+		_, err := io.WriteString(w, strings.Join(packets, payloadSeparator))
+		return err
+	})
+}
+
+// handlePost passes the packets of the polling request to the session.
+func (s *Server) handlePost(w http.ResponseWriter, req *http.Request, sock *Socket) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, s.options.MaxPayload))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		} else {
+			errBadRequest.write(w)
+		}
+		return
+	}
+
+	if err = sock.pushPackets(strings.Split(string(body), payloadSeparator)); err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": sock.RemoteAddr(),
+			"userAgent":     sock.UserAgent(),
+		}).Warningf("engine.io: polling request: %v", err)
+
+		errBadRequest.write(w)
+		sock.Close()
+		return
+	}
+
+	setNoCache(w)
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	io.WriteString(w, "ok")
+}
+
+// handleWebSocket handles the websocket transport. Sessions are created
+// with the websocket transport or upgraded from the polling transport.
+func (s *Server) handleWebSocket(w http.ResponseWriter, req *http.Request, sid string) {
+	remoteAddr, _ := utils.RemoteAddress(req)
+	userAgent := req.Header.Get("User-Agent")
+
+	if req.Method != http.MethodGet {
+		errBadRequest.write(w)
+		return
+	}
+
+	var sock *Socket
+
+	if len(sid) > 0 {
+		// Upgrade the polling session.
+		s.sessionsMutex.Lock()
+		sock = s.sessions[sid]
+		s.sessionsMutex.Unlock()
+
+		if sock == nil {
+			errSessionIDUnknown.write(w)
+			return
+		} else if !sock.startUpgrade() {
+			errBadRequest.write(w)
+			return
+		}
+	} else {
+		// Check if the handshake is allowed, for example by the rate limit.
+		if !s.onHandshakeRequest(remoteAddr, req) {
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		// Set the custom headers and cookies of the upgrade response.
+		s.onHandshakeResponse(w, req)
+	}
+
+	// Pass the headers and cookies set by the glue server.
+	// The upgrader ignores the response writer headers.
+	var header http.Header
+	if len(w.Header()) > 0 {
+		header = w.Header()
+	}
+
+	// The upgrader responds with an error if the upgrade fails.
+	ws, err := s.upgrader.Upgrade(w, req, header)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+		}).Warningf("engine.io: failed to upgrade to websocket layer: %v", err)
+
+		if sock != nil {
+			sock.cancelUpgrade()
+		}
+		return
+	}
+
+	ws.SetReadLimit(s.options.MaxPayload)
+
+	if sock != nil {
+		go s.upgrade(sock, ws)
+		return
+	}
+
+	sock = s.newSocket(req, remoteAddr)
+	sock.setWebSocket(ws)
+
+	if err = sock.writeWebSocket(ws, s.openPacket(sock, []string{})); err != nil {
+		sock.Close()
+		return
+	}
+
+	// Start the handlers in new goroutines.
+	go s.webSocketWriteLoop(sock, ws)
+	go s.webSocketReadLoop(sock, ws)
+
+	// Trigger the event that a new socket connection was made.
+	s.onNewSocketConnection(sock)
+}
+
+// upgrade upgrades the polling session to the websocket. The client probes
+// the websocket first. The polling is paused and the pending polling request
+// returns. The session switches to the websocket with the upgrade packet.
+func (s *Server) upgrade(sock *Socket, ws *websocket.Conn) {
+	cancel := func(reason string) {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": sock.RemoteAddr(),
+			"userAgent":     sock.UserAgent(),
+		}).Warningf("engine.io: websocket upgrade failed: %s", reason)
+
+		sock.cancelUpgrade()
+		ws.Close()
+	}
+
+	// Cancel the upgrade if not completed in time.
+	ws.SetReadDeadline(time.Now().Add(s.options.UpgradeTimeout))
+
+	// Answer the probe.
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		cancel(err.Error())
+		return
+	} else if string(data) != packetPing+probe {
+		cancel("invalid probe")
+		return
+	}
+
+	if err = sock.writeWebSocket(ws, packetPong+probe); err != nil {
+		cancel(err.Error())
+		return
+	}
+
+	// Pause the polling and wait for the upgrade packet.
+	sock.pause()
+
+	_, data, err = ws.ReadMessage()
+	if err != nil {
+		cancel(err.Error())
+		return
+	} else if string(data) != packetUpgrade {
+		cancel("invalid upgrade packet")
+		return
+	}
+
+	ws.SetReadDeadline(time.Time{})
+
+	// Wait for the pending polling request and switch the transport.
+	sock.pollMutex.Lock()
+	sock.setWebSocket(ws)
+	sock.pollMutex.Unlock()
+
+	// The closer might have missed the websocket.
+	if sock.IsClosed() {
+		ws.Close()
+		return
+	}
+
+	go s.webSocketWriteLoop(sock, ws)
+	s.webSocketReadLoop(sock, ws)
+}
+
+// heartbeatLoop sends the ping packets and closes
+// the session if the client doesn't answer in time.
+func (s *Server) heartbeatLoop(sock *Socket) {
+	timer := time.NewTimer(s.options.PingInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-sock.closer.IsClosedChan:
+			return
+		}
+
+		sock.ping()
+
+		select {
+		case <-sock.pongChan:
+		case <-time.After(s.options.PingTimeout):
+			log.Backend.WithFields(logrus.Fields{
+				"remoteAddress": sock.RemoteAddr(),
+				"userAgent":     sock.UserAgent(),
+			}).Debugf("engine.io: ping timeout")
+
+			sock.Close()
+			return
+		case <-sock.closer.IsClosedChan:
+			return
+		}
+
+		timer.Reset(s.options.PingInterval)
+	}
+}
+
+func (s *Server) webSocketReadLoop(sock *Socket, ws *websocket.Conn) {
+	defer sock.Close()
+
+	for {
+		msgType, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Binary messages carry the message data without a packet type.
+		if msgType == websocket.BinaryMessage {
+			data = append([]byte(packetMessage), data...)
+		}
+
+		if err = sock.pushPackets([]string{string(data)}); err != nil {
+			log.Backend.WithFields(logrus.Fields{
+				"remoteAddress": sock.RemoteAddr(),
+				"userAgent":     sock.UserAgent(),
+			}).Warningf("engine.io: invalid websocket message: %v", err)
+			return
+		}
+	}
+}
+
+func (s *Server) webSocketWriteLoop(sock *Socket, ws *websocket.Conn) {
+	// The closer passes the close packet.
+	write := func(packets []string) error {
+		if sock.IsClosed() {
+			return nil
+		}
+
+		// Each packet is passed with its own websocket message.
+		for _, p := range packets {
+			if err := sock.writeWebSocket(ws, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for !sock.IsClosed() {
+		if err := sock.nextPackets(nil, nil, write); err != nil {
+			log.Backend.WithFields(logrus.Fields{
+				"remoteAddress": sock.RemoteAddr(),
+				"userAgent":     sock.UserAgent(),
+			}).Warningf("engine.io: failed to write to websocket: %v", err)
+
+			sock.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,352 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package engineiosocket
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves an engine.io server and returns the channel of the new sockets.
+func newTestServer(t *testing.T, o Options) (*httptest.Server, chan *Socket) {
+	sockets := make(chan *Socket, 10)
+
+	s := NewServer(func(sock *Socket) {
+		sockets <- sock
+	}, func(string, *http.Request) bool {
+		return true
+	}, func(http.ResponseWriter, *http.Request) {}, o)
+
+	ts := httptest.NewServer(http.HandlerFunc(s.HandleRequest))
+	t.Cleanup(ts.Close)
+
+	return ts, sockets
+}
+
+// request sends the request and returns the status code and the body.
+func request(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(data)
+}
+
+// handshake opens a polling session and returns the
+// polling URL and the socket.
+func handshake(t *testing.T, ts *httptest.Server, sockets chan *Socket) (string, *Socket) {
+	t.Helper()
+
+	status, body := request(t, "GET", ts.URL+"/?EIO=4&transport=polling", "")
+	if status != http.StatusOK || !strings.HasPrefix(body, packetOpen) {
+		t.Fatalf("unexpected handshake response: %d %q", status, body)
+	}
+
+	var open struct {
+		SID          string   `json:"sid"`
+		Upgrades     []string `json:"upgrades"`
+		PingInterval int64    `json:"pingInterval"`
+		MaxPayload   int64    `json:"maxPayload"`
+	}
+	if err := json.Unmarshal([]byte(body[1:]), &open); err != nil {
+		t.Fatal(err)
+	}
+	if len(open.SID) == 0 || len(open.Upgrades) != 1 || open.Upgrades[0] != "websocket" || open.MaxPayload != defaultMaxPayload {
+		t.Fatalf("unexpected open packet: %q", body)
+	}
+
+	select {
+	case sock := <-sockets:
+		return ts.URL + "/?EIO=4&transport=polling&sid=" + open.SID, sock
+	case <-time.After(time.Second):
+		t.Fatal("no new socket")
+		return "", nil
+	}
+}
+
+// receive returns the next message of the read channel.
+func receive(t *testing.T, sock *Socket) string {
+	t.Helper()
+
+	select {
+	case msg := <-sock.ReadChan():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+// expectClosed fails if the socket doesn't close.
+func expectClosed(t *testing.T, sock *Socket) {
+	t.Helper()
+
+	select {
+	case <-sock.ClosedChan():
+	case <-time.After(time.Second):
+		t.Fatal("socket not closed")
+	}
+}
+
+func TestPolling(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+	url, sock := handshake(t, ts, sockets)
+
+	if status, body := request(t, "POST", url, "4hello\x1e4world\x1ebYmluYXJ5"); status != http.StatusOK || body != "ok" {
+		t.Fatalf("unexpected post response: %d %q", status, body)
+	}
+	for _, want := range []string{"hello", "world", "binary"} {
+		if msg := receive(t, sock); msg != want {
+			t.Fatalf("unexpected message: %q", msg)
+		}
+	}
+
+	sock.WriteChan() <- "a"
+	sock.WriteChan() <- "b"
+	if _, body := request(t, "GET", url, ""); body != "4a\x1e4b" {
+		t.Fatalf("unexpected payload: %q", body)
+	}
+
+	// The close packet closes the session.
+	request(t, "POST", url, "1")
+	expectClosed(t, sock)
+
+	if status, body := request(t, "GET", url, ""); status != http.StatusBadRequest || !strings.Contains(body, "Session ID unknown") {
+		t.Fatalf("unexpected response: %d %q", status, body)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	ts, _ := newTestServer(t, Options{})
+
+	for _, c := range []struct {
+		method, query string
+		code          int
+	}{
+		{"GET", "EIO=3&transport=polling", 5},
+		{"GET", "EIO=4&transport=flash", 0},
+		{"GET", "EIO=4&transport=polling&j=0", 0},
+		{"GET", "EIO=4&transport=polling&sid=unknown", 1},
+		{"POST", "EIO=4&transport=polling", 2},
+	} {
+		status, body := request(t, c.method, ts.URL+"/?"+c.query, "")
+
+		var e requestError
+		if err := json.Unmarshal([]byte(body), &e); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		if status != http.StatusBadRequest || e.Code != c.code {
+			t.Fatalf("%s: unexpected response: %d %q", c.query, status, body)
+		}
+	}
+}
+
+func TestOverlappingPoll(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+	url, sock := handshake(t, ts, sockets)
+
+	done := make(chan string)
+	go func() {
+		_, body := request(t, "GET", url, "")
+		done <- body
+	}()
+
+	// Wait for the first polling request.
+	for i := 0; sock.pollMutex.TryLock(); i++ {
+		sock.pollMutex.Unlock()
+		if i > 100 {
+			t.Fatal("polling request not pending")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status, _ := request(t, "GET", url, ""); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", status)
+	}
+	expectClosed(t, sock)
+
+	// The pending polling request passes the close packet.
+	if body := <-done; body != packetClose {
+		t.Fatalf("unexpected payload: %q", body)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{
+		PingInterval: 20 * time.Millisecond,
+		PingTimeout:  100 * time.Millisecond,
+	})
+	url, sock := handshake(t, ts, sockets)
+
+	for i := 0; i < 3; i++ {
+		if _, body := request(t, "GET", url, ""); body != packetPing {
+			t.Fatalf("unexpected payload: %q", body)
+		}
+		request(t, "POST", url, packetPong)
+	}
+
+	if sock.IsClosed() {
+		t.Fatal("socket closed")
+	}
+
+	// The session closes without pong packets.
+	request(t, "GET", url, "")
+	expectClosed(t, sock)
+}
+
+func TestUpgrade(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+	url, sock := handshake(t, ts, sockets)
+
+	done := make(chan string)
+	go func() {
+		_, body := request(t, "GET", url, "")
+		done <- body
+	}()
+
+	wsURL := "ws" + strings.TrimPrefix(strings.Replace(url, "transport=polling", "transport=websocket", 1), "http")
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// Probe the websocket.
+	ws.WriteMessage(websocket.TextMessage, []byte("2probe"))
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "3probe" {
+		t.Fatalf("unexpected probe response: %q %v", data, err)
+	}
+
+	// The pending polling request returns.
+	select {
+	case body := <-done:
+		if body != packetNoop {
+			t.Fatalf("unexpected payload: %q", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("polling request not paused")
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte(packetUpgrade))
+
+	sock.WriteChan() <- "a"
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "4a" {
+		t.Fatalf("unexpected message: %q %v", data, err)
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte("4b"))
+	if msg := receive(t, sock); msg != "b" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+
+	// The polling transport is not available anymore.
+	if status, _ := request(t, "GET", url, ""); status != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	// The close packet is sent with the websocket.
+	sock.Close()
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != packetClose {
+		t.Fatalf("unexpected message: %q %v", data, err)
+	}
+}
+
+func TestUpgradeCanceled(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{UpgradeTimeout: 50 * time.Millisecond})
+	url, sock := handshake(t, ts, sockets)
+
+	wsURL := "ws" + strings.TrimPrefix(strings.Replace(url, "transport=polling", "transport=websocket", 1), "http")
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ws.WriteMessage(websocket.TextMessage, []byte("2probe"))
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "3probe" {
+		t.Fatalf("unexpected probe response: %q %v", data, err)
+	}
+
+	// Without upgrade packet the websocket is closed and the polling resumes.
+	if _, _, err := ws.ReadMessage(); err == nil {
+		t.Fatal("websocket not closed")
+	}
+
+	sock.WriteChan() <- "a"
+	if _, body := request(t, "GET", url, ""); body != "4a" {
+		t.Fatalf("unexpected payload: %q", body)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/?EIO=4&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	_, data, err := ws.ReadMessage()
+	if err != nil || !strings.HasPrefix(string(data), packetOpen) || !strings.Contains(string(data), `"upgrades":[]`) {
+		t.Fatalf("unexpected open packet: %q %v", data, err)
+	}
+
+	var sock *Socket
+	select {
+	case sock = <-sockets:
+	case <-time.After(time.Second):
+		t.Fatal("no new socket")
+	}
+
+	ws.WriteMessage(websocket.TextMessage, []byte("4hello"))
+	if msg := receive(t, sock); msg != "hello" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+
+	sock.WriteChan() <- "world"
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "4world" {
+		t.Fatalf("unexpected message: %q %v", data, err)
+	}
+
+	// The close packet closes the session.
+	ws.WriteMessage(websocket.TextMessage, []byte(packetClose))
+	expectClosed(t, sock)
+}
@@ -0,0 +1,358 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package engineiosocket
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/closer"
+	"github.com/desertbit/glue/backend/global"
+	"github.com/gorilla/websocket"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// engine.io packet types:
+	packetOpen    = "0"
+	packetClose   = "1"
+	packetPing    = "2"
+	packetPong    = "3"
+	packetMessage = "4"
+	packetUpgrade = "5"
+	packetNoop    = "6"
+
+	// Base64 encoded binary messages of polling payloads start with this prefix.
+	packetBinary = "b"
+
+	// The data of the ping and pong packets of the upgrade probe.
+	probe = "probe"
+
+	// Separates the packets of a polling payload.
+	payloadSeparator = "\x1e"
+
+	// Time allowed to write a websocket message to the peer.
+	writeWait = 10 * time.Second
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	errInvalidPacket = errors.New("invalid packet")
+)
+
+//#############################//
+//### engine.io Socket type ###//
+//#############################//
+
+// A Socket is an engine.io session. The sessions start with the polling
+// transport or with the websocket transport. Polling sessions are kept
+// by their ID and upgraded to the websocket transport if possible.
+type Socket struct {
+	id         string
+	userAgent  string
+	remoteAddr string
+	header     http.Header
+
+	closer *closer.Closer
+	global.Expiry
+	global.Flush
+
+	writeChan chan string
+	readChan  chan string
+
+	pingChan chan struct{} // Triggers a ping packet.
+	pongChan chan struct{} // Signals a received pong packet.
+
+	// The websocket is set as soon as the session uses the websocket transport.
+	ws         *websocket.Conn
+	writeMutex sync.Mutex
+
+	// The state of the polling transport.
+	pollMutex sync.Mutex    // Held by the polling request.
+	pauseChan chan struct{} // Closed to pause the polling during an upgrade.
+	upgrading bool
+	mutex     sync.Mutex
+}
+
+// Create a new engine.io socket.
+func newSocket() *Socket {
+	return &Socket{
+		writeChan: make(chan string, global.WriteChanSize),
+		readChan:  make(chan string, global.ReadChanSize),
+		pingChan:  make(chan struct{}, 1),
+		pongChan:  make(chan struct{}, 1),
+		pauseChan: make(chan struct{}),
+	}
+}
+
+//###################################################//
+//### engine.io Socket - Interface implementation ###//
+//###################################################//
+
+func (s *Socket) Type() global.SocketType {
+	return global.TypeEngineIOSocket
+}
+
+func (s *Socket) RemoteAddr() string {
+	return s.remoteAddr
+}
+
+func (s *Socket) UserAgent() string {
+	return s.userAgent
+}
+
+func (s *Socket) Header() http.Header {
+	return s.header
+}
+
+func (s *Socket) Close() {
+	s.closer.Close()
+}
+
+func (s *Socket) IsClosed() bool {
+	return s.closer.IsClosed()
+}
+
+func (s *Socket) ClosedChan() <-chan struct{} {
+	return s.closer.IsClosedChan
+}
+
+func (s *Socket) WriteChan() chan string {
+	return s.writeChan
+}
+
+func (s *Socket) ReadChan() chan string {
+	return s.readChan
+}
+
+//###################################//
+//### engine.io Socket - Private ###//
+//###################################//
+
+// webSocket returns the websocket or nil if the session uses the polling transport.
+func (s *Socket) webSocket() *websocket.Conn {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.ws
+}
+
+// setWebSocket switches the session to the websocket transport.
+func (s *Socket) setWebSocket(ws *websocket.Conn) {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.ws = ws
+}
+
+// startUpgrade marks the session as upgrading. False is
+// returned if the session is upgrading or upgraded already.
+func (s *Socket) startUpgrade() bool {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.upgrading || s.ws != nil {
+		return false
+	}
+	s.upgrading = true
+
+	return true
+}
+
+// cancelUpgrade resumes the polling after a failed upgrade.
+func (s *Socket) cancelUpgrade() {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.upgrading = false
+
+	select {
+	case <-s.pauseChan:
+		s.pauseChan = make(chan struct{})
+	default:
+	}
+}
+
+// pause pauses the polling. The pending polling
+// request returns with a noop packet.
+func (s *Socket) pause() {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-s.pauseChan:
+	default:
+		close(s.pauseChan)
+	}
+}
+
+// paused returns the channel which is closed if the polling is paused.
+func (s *Socket) paused() <-chan struct{} {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.pauseChan
+}
+
+// ping triggers a ping packet.
+func (s *Socket) ping() {
+	select {
+	case s.pingChan <- struct{}{}:
+	default:
+	}
+}
+
+// pong signals a received pong packet.
+func (s *Socket) pong() {
+	select {
+	case s.pongChan <- struct{}{}:
+	default:
+	}
+}
+
+// nextPackets waits for the next packets and writes them with one call.
+// The message packets available right away are passed with the same call.
+// Flush frames are handled after the previous packets were written. The
+// close packet is written if the socket closed and the noop packet if the
+// polling is paused. Nothing is written if the done channel closed.
+func (s *Socket) nextPackets(pause, done <-chan struct{}, write func(packets []string) error) error {
+	var packets []string
+
+	// Wait for the first packet.
+	for len(packets) == 0 {
+		select {
+		case data := <-s.writeChan:
+			if s.HandleFlush(data) {
+				continue
+			}
+
+			// Drop expired frames.
+			if data, ok := s.Filter(data); ok {
+				packets = append(packets, packetMessage+data)
+			}
+
+		case <-s.pingChan:
+			packets = append(packets, packetPing)
+
+		case <-s.closer.IsClosedChan:
+			return write([]string{packetClose})
+
+		case <-pause:
+			return write([]string{packetNoop})
+
+		case <-done:
+			return nil
+		}
+	}
+
+	// Take the packets available right away.
+	for {
+		select {
+		case data := <-s.writeChan:
+			if strings.HasPrefix(data, global.FlushFrameMarker) {
+				// Pass the previous packets first.
+				if err := write(packets); err != nil {
+					return err
+				}
+				s.HandleFlush(data)
+				return nil
+			}
+
+			if data, ok := s.Filter(data); ok {
+				packets = append(packets, packetMessage+data)
+			}
+
+		case <-s.pingChan:
+			packets = append(packets, packetPing)
+
+		default:
+			return write(packets)
+		}
+	}
+}
+
+// pushPackets handles the packets of the client. The messages
+// are passed to the read channel. Empty messages are skipped.
+func (s *Socket) pushPackets(packets []string) error {
+	for _, p := range packets {
+		if len(p) == 0 {
+			return errInvalidPacket
+		}
+
+		msg := p[1:]
+
+		switch p[:1] {
+		case packetMessage:
+		case packetBinary:
+			data, err := base64.StdEncoding.DecodeString(msg)
+			if err != nil {
+				return err
+			}
+			msg = string(data)
+		case packetPong:
+			s.pong()
+			continue
+		case packetClose:
+			s.Close()
+			return nil
+		case packetNoop:
+			continue
+		default:
+			return errInvalidPacket
+		}
+
+		if len(msg) == 0 {
+			continue
+		}
+
+		select {
+		case s.readChan <- msg:
+		case <-s.closer.IsClosedChan:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// writeWebSocket writes the text message to the websocket.
+// This method is thread-safe.
+func (s *Socket) writeWebSocket(ws *websocket.Conn, data string) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return ws.WriteMessage(websocket.TextMessage, []byte(data))
+}
@@ -0,0 +1,181 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package memsocket
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// Network3G simulates a slow mobile connection.
+	Network3G = Network{
+		Bandwidth:        96 * 1024,
+		Latency:          150 * time.Millisecond,
+		LatencyDeviation: 50 * time.Millisecond,
+		LossRate:         0.01,
+	}
+
+	// NetworkDSL simulates a home broadband connection.
+	NetworkDSL = Network{
+		Bandwidth:        1024 * 1024,
+		Latency:          30 * time.Millisecond,
+		LatencyDeviation: 5 * time.Millisecond,
+	}
+)
+
+//####################//
+//### Network type ###//
+//####################//
+
+// A Network defines the simulated conditions of both directions
+// of a memory socket. The zero value passes frames without delay.
+type Network struct {
+	// Bandwidth limits each direction in bytes per second.
+	// Frames are queued until the link is free. Zero is unlimited.
+	Bandwidth int
+
+	// Latency delays each frame. The delay is normally distributed with
+	// the LatencyDeviation as standard deviation. The frame order is preserved.
+	Latency          time.Duration
+	LatencyDeviation time.Duration
+
+	// LossRate is the probability between 0 and 1 that a frame is lost.
+	// The protocol has no retransmission, so lost frames are not received.
+	LossRate float64
+
+	// Seed initializes the random source for deterministic runs.
+	// Zero uses a random seed.
+	Seed int64
+}
+
+func (n *Network) isZero() bool {
+	return n.Bandwidth <= 0 && n.Latency <= 0 && n.LatencyDeviation <= 0 && n.LossRate <= 0
+}
+
+//#################//
+//### Link type ###//
+//#################//
+
+// A delayedFrame is passed at the due time.
+type delayedFrame struct {
+	data string
+	due  time.Time
+}
+
+// A link passes the frames of one direction with the simulated network conditions.
+type link struct {
+	n          Network
+	r          *rand.Rand
+	out        chan<- string
+	closedChan <-chan struct{}
+	queue      chan delayedFrame
+
+	busyUntil time.Time // The link transfers the previous frames until then.
+	lastDue   time.Time // Preserves the order of the frames.
+	mutex     sync.Mutex
+}
+
+func newLink(n Network, r *rand.Rand, out chan<- string, closedChan <-chan struct{}) *link {
+	l := &link{
+		n:          n,
+		r:          r,
+		out:        out,
+		closedChan: closedChan,
+		queue:      make(chan delayedFrame, cap(out)),
+	}
+
+	// Start the delivery loop.
+	go l.deliverLoop()
+
+	return l
+}
+
+// pass queues the frame for delivery. Returns false if the link closed.
+func (l *link) pass(data string) bool {
+	// Lock the mutex. The queue order has to match the due times.
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// Lose the frame.
+	if l.n.LossRate > 0 && l.r.Float64() < l.n.LossRate {
+		return true
+	}
+
+	// The frame is transferred after the previous frames.
+	now := time.Now()
+	if l.busyUntil.Before(now) {
+		l.busyUntil = now
+	}
+	if l.n.Bandwidth > 0 {
+		l.busyUntil = l.busyUntil.Add(time.Duration(len(data)) * time.Second / time.Duration(l.n.Bandwidth))
+	}
+
+	latency := l.n.Latency
+	if l.n.LatencyDeviation > 0 {
+		latency += time.Duration(l.r.NormFloat64() * float64(l.n.LatencyDeviation))
+	}
+	if latency < 0 {
+		latency = 0
+	}
+
+	due := l.busyUntil.Add(latency)
+	if due.Before(l.lastDue) {
+		due = l.lastDue
+	}
+	l.lastDue = due
+
+	select {
+	case l.queue <- delayedFrame{data: data, due: due}:
+		return true
+	case <-l.closedChan:
+		return false
+	}
+}
+
+func (l *link) deliverLoop() {
+	for {
+		select {
+		case f := <-l.queue:
+			if wait := f.due.Sub(time.Now()); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-l.closedChan:
+					timer.Stop()
+					return
+				}
+			}
+
+			select {
+			case l.out <- f.data:
+			case <-l.closedChan:
+				return
+			}
+		case <-l.closedChan:
+			// Just exit the loop.
+			return
+		}
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package memsocket provides in-memory backend sockets for testing.
+// The client side of the connection is accessed with the socket methods.
+package memsocket
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/desertbit/glue/backend/closer"
+	"github.com/desertbit/glue/backend/global"
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	ErrClosed  = errors.New("memory socket is closed")
+	ErrTimeout = errors.New("memory socket receive timeout")
+)
+
+//##########################//
+//### Memory Socket type ###//
+//##########################//
+
+// A Socket is an in-memory backend socket. Binary data is
+// base64 encoded like with the ajax transport.
+type Socket struct {
+	userAgent  string
+	remoteAddr string
+
+	closer *closer.Closer
+	global.Expiry
+	global.Flush
+
+	writeChan chan string
+	readChan  chan string
+	outChan   chan string // The frames received by the client side.
+
+	// The simulated network links. Nil if no network is simulated.
+	sendLink    *link
+	receiveLink *link
+}
+
+// NewSocket creates a new in-memory socket. The optional network
+// defines the simulated conditions of the connection.
+func NewSocket(remoteAddr, userAgent string, network ...Network) *Socket {
+	m := &Socket{
+		remoteAddr: remoteAddr,
+		userAgent:  userAgent,
+		writeChan:  make(chan string, global.WriteChanSize),
+		readChan:   make(chan string, global.ReadChanSize),
+		outChan:    make(chan string, global.WriteChanSize),
+	}
+
+	// Set the closer function.
+	m.closer = closer.New(func() {})
+
+	// Simulate the network conditions if defined.
+	if len(network) > 0 && !network[0].isZero() {
+		n := network[0]
+
+		seed := n.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		r := rand.New(rand.NewSource(seed))
+
+		m.sendLink = newLink(n, rand.New(rand.NewSource(r.Int63())), m.readChan, m.closer.IsClosedChan)
+		m.receiveLink = newLink(n, rand.New(rand.NewSource(r.Int63())), m.outChan, m.closer.IsClosedChan)
+	}
+
+	// Start the write loop.
+	go m.writeLoop()
+
+	return m
+}
+
+// Send passes a frame of the client side to the server.
+// This method blocks until the frame is read or the socket is closed.
+// With a simulated network, it blocks until the frame is queued.
+func (m *Socket) Send(frame string) error {
+	if m.sendLink != nil {
+		if !m.sendLink.pass(frame) {
+			return ErrClosed
+		}
+		return nil
+	}
+
+	select {
+	case m.readChan <- frame:
+		return nil
+	case <-m.closer.IsClosedChan:
+		return ErrClosed
+	}
+}
+
+// Receive returns the next frame sent by the server. ErrClosed is returned
+// if the socket is closed and ErrTimeout if no frame is received in time.
+// Frames sent before the socket closed are returned first.
+func (m *Socket) Receive(timeout time.Duration) (string, error) {
+	select {
+	case frame := <-m.outChan:
+		return frame, nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case frame := <-m.outChan:
+		return frame, nil
+	case <-m.closer.IsClosedChan:
+		select {
+		case frame := <-m.outChan:
+			return frame, nil
+		default:
+			return "", ErrClosed
+		}
+	case <-timer.C:
+		return "", ErrTimeout
+	}
+}
+
+//################################################//
+//### Memory Socket - Interface implementation ###//
+//################################################//
+
+func (m *Socket) Type() global.SocketType {
+	return global.TypeMemSocket
+}
+
+func (m *Socket) RemoteAddr() string {
+	return m.remoteAddr
+}
+
+func (m *Socket) UserAgent() string {
+	return m.userAgent
+}
+
+func (m *Socket) Close() {
+	m.closer.Close()
+}
+
+func (m *Socket) IsClosed() bool {
+	return m.closer.IsClosed()
+}
+
+func (m *Socket) ClosedChan() <-chan struct{} {
+	return m.closer.IsClosedChan
+}
+
+func (m *Socket) WriteChan() chan string {
+	return m.writeChan
+}
+
+func (m *Socket) ReadChan() chan string {
+	return m.readChan
+}
+
+//###############################//
+//### Memory Socket - Private ###//
+//###############################//
+
+func (m *Socket) writeLoop() {
+	for {
+		select {
+		case data := <-m.writeChan:
+			// Previous frames are passed to the client side.
+			if m.HandleFlush(data) {
+				continue
+			}
+
+			// Drop expired frames.
+			data, ok := m.Filter(data)
+			if !ok {
+				continue
+			}
+
+			// Pass the data through the simulated network if present.
+			if m.receiveLink != nil {
+				if !m.receiveLink.pass(data) {
+					return
+				}
+				continue
+			}
+
+			select {
+			case m.outChan <- data:
+			case <-m.closer.IsClosedChan:
+				return
+			}
+		case <-m.closer.IsClosedChan:
+			// Just exit the loop.
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package muxsocket provides logical backend sockets which share
+// one physical connection with other logical sockets.
+package muxsocket
+
+import (
+	"net/http"
+
+	"github.com/desertbit/glue/backend/closer"
+	"github.com/desertbit/glue/backend/global"
+)
+
+//#######################//
+//### Mux Socket type ###//
+//#######################//
+
+// A Socket is a logical backend socket. The data is transmitted
+// by the write function over the physical connection and received
+// data is passed with the Push method.
+type Socket struct {
+	id         string
+	userAgent  string
+	remoteAddr string
+	header     http.Header
+
+	closer *closer.Closer
+	global.Expiry
+	global.Flush
+
+	writeChan chan string
+	readChan  chan string
+}
+
+// NewSocket creates a new logical socket with the ID and the
+// request headers of the physical connection. The write function is called for each frame written to the socket.
+// The onClose function is called as soon as the socket closes.
+func NewSocket(id, remoteAddr, userAgent string, header http.Header, write func(data string), onClose func()) *Socket {
+	m := &Socket{
+		id:         id,
+		remoteAddr: remoteAddr,
+		userAgent:  userAgent,
+		header:     header,
+		writeChan:  make(chan string, global.WriteChanSize),
+		readChan:   make(chan string, global.ReadChanSize),
+	}
+
+	// Set the closer function.
+	m.closer = closer.New(onClose)
+
+	// Start the write loop.
+	go m.writeLoop(write)
+
+	return m
+}
+
+// ID returns the logical socket ID.
+func (m *Socket) ID() string {
+	return m.id
+}
+
+// Push passes received data to the read channel without blocking.
+// The socket is closed if the read channel is full, so a slow logical
+// socket never blocks the physical connection. Returns false if the
+// data was dropped.
+func (m *Socket) Push(data string) bool {
+	select {
+	case m.readChan <- data:
+		return true
+	case <-m.closer.IsClosedChan:
+		return false
+	default:
+		m.Close()
+		return false
+	}
+}
+
+//#############################################//
+//### Mux Socket - Interface implementation ###//
+//#############################################//
+
+func (m *Socket) Type() global.SocketType {
+	return global.TypeMuxSocket
+}
+
+func (m *Socket) RemoteAddr() string {
+	return m.remoteAddr
+}
+
+func (m *Socket) UserAgent() string {
+	return m.userAgent
+}
+
+func (m *Socket) Header() http.Header {
+	return m.header
+}
+
+func (m *Socket) Close() {
+	m.closer.Close()
+}
+
+func (m *Socket) IsClosed() bool {
+	return m.closer.IsClosed()
+}
+
+func (m *Socket) ClosedChan() <-chan struct{} {
+	return m.closer.IsClosedChan
+}
+
+func (m *Socket) WriteChan() chan string {
+	return m.writeChan
+}
+
+func (m *Socket) ReadChan() chan string {
+	return m.readChan
+}
+
+//############################//
+//### Mux Socket - Private ###//
+//############################//
+
+func (m *Socket) writeLoop(write func(data string)) {
+	for {
+		select {
+		case data := <-m.writeChan:
+			// Previous frames are passed to the carrier socket.
+			if m.HandleFlush(data) {
+				continue
+			}
+
+			// Drop expired frames.
+			data, ok := m.Filter(data)
+			if !ok {
+				continue
+			}
+
+			write(data)
+		case <-m.closer.IsClosedChan:
+			// Just exit the loop.
+			return
+		}
+	}
+}
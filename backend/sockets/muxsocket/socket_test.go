@@ -0,0 +1,85 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package muxsocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+)
+
+func TestSocketWrite(t *testing.T) {
+	written := make(chan string, 1)
+	closed := make(chan struct{})
+
+	m := NewSocket("a", "127.0.0.1", "test", nil, func(data string) {
+		written <- data
+	}, func() {
+		close(closed)
+	})
+
+	m.WriteChan() <- "data"
+
+	select {
+	case data := <-written:
+		if data != "data" {
+			t.Fatalf("unexpected written data: %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("data not written")
+	}
+
+	m.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("close function not called")
+	}
+}
+
+func TestSocketPush(t *testing.T) {
+	m := NewSocket("a", "127.0.0.1", "test", nil, func(string) {}, func() {})
+
+	if !m.Push("data") {
+		t.Fatal("data dropped")
+	}
+	if data := <-m.ReadChan(); data != "data" {
+		t.Fatalf("unexpected read data: %q", data)
+	}
+
+	// Push never blocks. The socket is closed if the read channel is full.
+	for i := 0; i < global.ReadChanSize; i++ {
+		if !m.Push("data") {
+			t.Fatalf("data dropped at %d", i)
+		}
+	}
+	if m.Push("data") {
+		t.Fatal("data pushed to a full read channel")
+	}
+	if !m.IsClosed() {
+		t.Fatal("socket not closed")
+	}
+
+	// Data of closed sockets is dropped.
+	if m.Push("data") {
+		t.Fatal("data pushed to a closed socket")
+	}
+}
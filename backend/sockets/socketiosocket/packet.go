@@ -0,0 +1,181 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package socketiosocket
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// socket.io packet types:
+	packetConnect      = '0'
+	packetDisconnect   = '1'
+	packetEvent        = '2'
+	packetAck          = '3'
+	packetConnectError = '4'
+	packetBinaryEvent  = '5'
+	packetBinaryAck    = '6'
+
+	// The default namespace of socket.io.
+	defaultNamespace = "/"
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	errInvalidPacket  = errors.New("invalid packet")
+	errBinaryPacket   = errors.New("binary packets are not supported")
+	errInvalidEvent   = errors.New("invalid event")
+	errNotConnected   = errors.New("namespace not connected")
+	errTooManyPending = errors.New("too many pending acknowledgements")
+)
+
+//###################//
+//### Packet type ###//
+//###################//
+
+// A packet is a socket.io packet of the protocol version 5.
+type packet struct {
+	Type      byte
+	Namespace string
+	ID        int64 // The acknowledgement ID or -1 if not set.
+	Data      string
+}
+
+// parsePacket parses the socket.io packet of an engine.io message.
+func parsePacket(msg string) (p packet, err error) {
+	if len(msg) == 0 {
+		return p, errInvalidPacket
+	}
+
+	p.Type = msg[0]
+	p.Namespace = defaultNamespace
+	p.ID = -1
+	msg = msg[1:]
+
+	switch p.Type {
+	case packetConnect, packetDisconnect, packetEvent, packetAck, packetConnectError:
+	case packetBinaryEvent, packetBinaryAck:
+		return p, errBinaryPacket
+	default:
+		return p, errInvalidPacket
+	}
+
+	// Split the namespace.
+	if strings.HasPrefix(msg, "/") {
+		pos := strings.IndexByte(msg, ',')
+		if pos < 0 {
+			p.Namespace, msg = msg, ""
+		} else {
+			p.Namespace, msg = msg[:pos], msg[pos+1:]
+		}
+	}
+
+	// Split the acknowledgement ID.
+	i := 0
+	for i < len(msg) && msg[i] >= '0' && msg[i] <= '9' {
+		i++
+	}
+	if i > 0 {
+		if p.ID, err = strconv.ParseInt(msg[:i], 10, 64); err != nil {
+			return p, errInvalidPacket
+		}
+		msg = msg[i:]
+	}
+
+	if len(msg) > 0 && !json.Valid([]byte(msg)) {
+		return p, errInvalidPacket
+	}
+	p.Data = msg
+
+	return p, nil
+}
+
+// String encodes the packet.
+func (p packet) String() string {
+	var b strings.Builder
+	b.WriteByte(p.Type)
+
+	if len(p.Namespace) > 0 && p.Namespace != defaultNamespace {
+		b.WriteString(p.Namespace)
+		b.WriteByte(',')
+	}
+
+	if p.ID >= 0 {
+		b.WriteString(strconv.FormatInt(p.ID, 10))
+	}
+
+	b.WriteString(p.Data)
+
+	return b.String()
+}
+
+//###############//
+//### Helpers ###//
+//###############//
+
+// parseEvent returns the event name and the channel data of the event packet
+// data. A single string argument is passed as it is. A single other argument
+// is passed JSON encoded and multiple arguments as JSON array.
+func parseEvent(data string) (name, value string, err error) {
+	var args []json.RawMessage
+	if err = json.Unmarshal([]byte(data), &args); err != nil || len(args) == 0 {
+		return "", "", errInvalidEvent
+	}
+
+	if err = json.Unmarshal(args[0], &name); err != nil || len(name) == 0 {
+		return "", "", errInvalidEvent
+	}
+
+	args = args[1:]
+
+	switch len(args) {
+	case 0:
+		return name, "", nil
+
+	case 1:
+		var s string
+		if json.Unmarshal(args[0], &s) == nil {
+			return name, s, nil
+		}
+		return name, string(args[0]), nil
+
+	default:
+		b, err := json.Marshal(args)
+		if err != nil {
+			return "", "", errInvalidEvent
+		}
+		return name, string(b), nil
+	}
+}
+
+// marshalArgs returns the JSON array of the arguments.
+func marshalArgs(args ...interface{}) string {
+	b, _ := json.Marshal(args)
+	return string(b)
+}
@@ -0,0 +1,102 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package socketiosocket
+
+import (
+	"testing"
+)
+
+func TestParsePacket(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want packet
+		err  error
+	}{
+		{"0", packet{Type: packetConnect, Namespace: "/", ID: -1}, nil},
+		{`0{"token":"abc"}`, packet{Type: packetConnect, Namespace: "/", ID: -1, Data: `{"token":"abc"}`}, nil},
+		{"0/admin,", packet{Type: packetConnect, Namespace: "/admin", ID: -1}, nil},
+		{"1/admin", packet{Type: packetDisconnect, Namespace: "/admin", ID: -1}, nil},
+		{`2["chat","hello"]`, packet{Type: packetEvent, Namespace: "/", ID: -1, Data: `["chat","hello"]`}, nil},
+		{`2/admin,12["chat",1]`, packet{Type: packetEvent, Namespace: "/admin", ID: 12, Data: `["chat",1]`}, nil},
+		{`37["ok"]`, packet{Type: packetAck, Namespace: "/", ID: 7, Data: `["ok"]`}, nil},
+		{"", packet{}, errInvalidPacket},
+		{"9", packet{}, errInvalidPacket},
+		{`2["chat"`, packet{}, errInvalidPacket},
+		{"99999999999999999999[]", packet{}, errInvalidPacket},
+		{`51-["chat",{"_placeholder":true,"num":0}]`, packet{}, errBinaryPacket},
+		{`61-0[{"_placeholder":true,"num":0}]`, packet{}, errBinaryPacket},
+	}
+
+	for _, test := range tests {
+		p, err := parsePacket(test.msg)
+		if err != test.err {
+			t.Errorf("%q: unexpected error: %v", test.msg, err)
+		} else if err == nil && p != test.want {
+			t.Errorf("%q: unexpected packet: %+v", test.msg, p)
+		}
+	}
+}
+
+func TestPacketString(t *testing.T) {
+	tests := []struct {
+		p    packet
+		want string
+	}{
+		{packet{Type: packetConnect, Namespace: "/", ID: -1, Data: `{"sid":"a"}`}, `0{"sid":"a"}`},
+		{packet{Type: packetConnect, Namespace: "/admin", ID: -1, Data: `{"sid":"a"}`}, `0/admin,{"sid":"a"}`},
+		{packet{Type: packetDisconnect, Namespace: "/", ID: -1}, "1"},
+		{packet{Type: packetAck, Namespace: "/admin", ID: 3, Data: `["ok"]`}, `3/admin,3["ok"]`},
+	}
+
+	for _, test := range tests {
+		if s := test.p.String(); s != test.want {
+			t.Errorf("unexpected packet string: %q != %q", s, test.want)
+		}
+
+		// The packets have to be parsed again.
+		if p, err := parsePacket(test.want); err != nil || p != test.p {
+			t.Errorf("%q: unexpected parsed packet: %+v %v", test.want, p, err)
+		}
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		data  string
+		name  string
+		value string
+		err   error
+	}{
+		{`["chat"]`, "chat", "", nil},
+		{`["chat","hello"]`, "chat", "hello", nil},
+		{`["chat",{"a":1}]`, "chat", `{"a":1}`, nil},
+		{`["chat",1,"two"]`, "chat", `[1,"two"]`, nil},
+		{`[]`, "", "", errInvalidEvent},
+		{`[1,"hello"]`, "", "", errInvalidEvent},
+		{`[""]`, "", "", errInvalidEvent},
+		{`{"chat":1}`, "", "", errInvalidEvent},
+	}
+
+	for _, test := range tests {
+		name, value, err := parseEvent(test.data)
+		if err != test.err || name != test.name || value != test.value {
+			t.Errorf("%q: unexpected event: %q %q %v", test.data, name, value, err)
+		}
+	}
+}
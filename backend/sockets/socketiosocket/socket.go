@@ -0,0 +1,472 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package socketiosocket provides backend sockets implementing the socket.io
+// protocol version 5 on top of engine.io sessions. The socket.io events are
+// mapped to the glue channels with the same name, so existing socket.io
+// clients connect to a glue server.
+package socketiosocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The glue protocol commands translated by the socket.
+	cmdLen               = 2
+	cmdInit              = "in"
+	cmdPing              = "pi"
+	cmdPong              = "po"
+	cmdChannelData       = "cd"
+	cmdReject            = "rj"
+	cmdDontAutoReconnect = "dr"
+
+	// The maximum number of events waiting for an acknowledgement.
+	// The socket is closed if exceeded.
+	maxPendingAcks = 256
+)
+
+//####################//
+//### Carrier type ###//
+//####################//
+
+// A Carrier is the engine.io session transmitting the socket.io packets.
+type Carrier interface {
+	RemoteAddr() string
+	UserAgent() string
+	Header() http.Header
+
+	Close()
+	IsClosed() bool
+	ClosedChan() <-chan struct{}
+
+	WriteChan() chan string
+	ReadChan() chan string
+
+	// OnFlushed sets the function which is called as soon as
+	// the flush frames are passed to the transport.
+	OnFlushed(f func(id string))
+}
+
+//###########################//
+//### socket.io Socket type ###//
+//###########################//
+
+// A Socket translates the socket.io packets of one namespace to glue frames.
+// The connect packet is passed as glue init request, so the glue server
+// authenticates the socket with the namespace authentication hooks.
+type Socket struct {
+	carrier Carrier
+	version string // The glue protocol version of the init request.
+
+	global.Expiry
+	global.Flush
+
+	writeChan chan string
+	readChan  chan string
+	pongChan  chan struct{} // Triggers a pong frame for the glue server.
+
+	namespace string // Set as soon as the client connected.
+
+	// The acknowledgement IDs of the client events waiting for a reply by
+	// channel. The next message of the channel replies the oldest event.
+	pending      map[string][]int64
+	pendingCount int
+	mutex        sync.Mutex
+}
+
+// NewSocket creates a new socket.io socket on top of the engine.io session.
+// The version is the glue protocol version passed with the init request.
+func NewSocket(carrier Carrier, version string) *Socket {
+	s := &Socket{
+		carrier:   carrier,
+		version:   version,
+		writeChan: make(chan string, global.WriteChanSize),
+		readChan:  make(chan string, global.ReadChanSize),
+		pongChan:  make(chan struct{}, 1),
+		pending:   make(map[string][]int64),
+	}
+
+	// The flush frames are passed to the engine.io session, so the
+	// previous packets are sent before the flush is reported.
+	carrier.OnFlushed(func(id string) {
+		s.HandleFlush(global.FlushFrame(id))
+	})
+
+	// Start the loops.
+	go s.readLoop()
+	go s.writeLoop()
+
+	return s
+}
+
+//###################################################//
+//### socket.io Socket - Interface implementation ###//
+//###################################################//
+
+func (s *Socket) Type() global.SocketType {
+	return global.TypeSocketIOSocket
+}
+
+func (s *Socket) RemoteAddr() string {
+	return s.carrier.RemoteAddr()
+}
+
+func (s *Socket) UserAgent() string {
+	return s.carrier.UserAgent()
+}
+
+func (s *Socket) Header() http.Header {
+	return s.carrier.Header()
+}
+
+func (s *Socket) Close() {
+	s.carrier.Close()
+}
+
+func (s *Socket) IsClosed() bool {
+	return s.carrier.IsClosed()
+}
+
+func (s *Socket) ClosedChan() <-chan struct{} {
+	return s.carrier.ClosedChan()
+}
+
+func (s *Socket) WriteChan() chan string {
+	return s.writeChan
+}
+
+func (s *Socket) ReadChan() chan string {
+	return s.readChan
+}
+
+//###################################//
+//### socket.io Socket - Private ###//
+//###################################//
+
+// getNamespace returns the connected namespace or an empty string.
+func (s *Socket) getNamespace() string {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.namespace
+}
+
+// setNamespace sets the connected namespace. False
+// is returned if the client connected already.
+func (s *Socket) setNamespace(ns string) bool {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.namespace) > 0 {
+		return false
+	}
+	s.namespace = ns
+
+	return true
+}
+
+// addPending adds the acknowledgement ID of the event.
+func (s *Socket) addPending(name string, id int64) error {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pendingCount >= maxPendingAcks {
+		return errTooManyPending
+	}
+
+	s.pending[name] = append(s.pending[name], id)
+	s.pendingCount++
+
+	return nil
+}
+
+// nextPending removes and returns the oldest acknowledgement
+// ID of the channel. Returns -1 if no event is pending.
+func (s *Socket) nextPending(name string) int64 {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := s.pending[name]
+	if len(ids) == 0 {
+		return -1
+	}
+
+	if len(ids) == 1 {
+		delete(s.pending, name)
+	} else {
+		s.pending[name] = ids[1:]
+	}
+	s.pendingCount--
+
+	return ids[0]
+}
+
+// pong triggers a pong frame for the glue server. The engine.io
+// session checks the connection with its own heartbeat.
+func (s *Socket) pong() {
+	select {
+	case s.pongChan <- struct{}{}:
+	default:
+	}
+}
+
+// readLoop translates the packets of the client to glue frames.
+func (s *Socket) readLoop() {
+	closedChan := s.carrier.ClosedChan()
+
+	for {
+		var frame string
+
+		select {
+		case msg := <-s.carrier.ReadChan():
+			var err error
+			frame, err = s.translateRead(msg)
+			if err != nil {
+				log.Backend.WithFields(logrus.Fields{
+					"remoteAddress": s.RemoteAddr(),
+					"userAgent":     s.UserAgent(),
+				}).Warningf("socket.io: %v", err)
+
+				s.Close()
+				return
+			}
+
+		case <-s.pongChan:
+			frame = cmdPong
+
+		case <-closedChan:
+			return
+		}
+
+		if len(frame) == 0 {
+			continue
+		}
+
+		select {
+		case s.readChan <- frame:
+		case <-closedChan:
+			return
+		}
+	}
+}
+
+// translateRead returns the glue frame of the socket.io packet.
+// An empty frame is returned if nothing has to be passed.
+func (s *Socket) translateRead(msg string) (string, error) {
+	p, err := parsePacket(msg)
+	if err != nil {
+		return "", err
+	}
+
+	ns := s.getNamespace()
+
+	// The client has to connect first.
+	if p.Type == packetConnect {
+		// Only one namespace is supported per connection.
+		if !s.setNamespace(p.Namespace) {
+			s.write(packet{
+				Type:      packetConnectError,
+				Namespace: p.Namespace,
+				ID:        -1,
+				Data:      `{"message":"only one namespace per connection is supported"}`,
+			}.String())
+			return "", nil
+		}
+
+		return s.initFrame(p)
+	} else if len(ns) == 0 {
+		return "", errNotConnected
+	} else if p.Namespace != ns {
+		// Ignore the packets of other namespaces.
+		return "", nil
+	}
+
+	switch p.Type {
+	case packetDisconnect:
+		s.Close()
+		return "", nil
+
+	case packetEvent:
+		name, data, err := parseEvent(p.Data)
+		if err != nil {
+			return "", err
+		}
+
+		if p.ID >= 0 {
+			if err = s.addPending(name, p.ID); err != nil {
+				return "", err
+			}
+		}
+
+		return cmdChannelData + utils.MarshalValues(name, data), nil
+
+	default:
+		// The server doesn't request acknowledgements.
+		return "", nil
+	}
+}
+
+// initFrame returns the glue init request of the connect packet.
+// The authentication payload is passed JSON encoded.
+func (s *Socket) initFrame(p packet) (string, error) {
+	namespace := p.Namespace
+	if namespace == defaultNamespace {
+		namespace = ""
+	}
+
+	data, err := json.Marshal(struct {
+		Version   string `json:"version"`
+		Namespace string `json:"namespace"`
+		Auth      string `json:"auth"`
+		Reject    bool   `json:"reject"`
+	}{
+		Version:   s.version,
+		Namespace: namespace,
+		Auth:      p.Data,
+		Reject:    true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return cmdInit + string(data), nil
+}
+
+// write passes the packet to the engine.io session.
+func (s *Socket) write(data string) {
+	select {
+	case s.carrier.WriteChan() <- data:
+	case <-s.carrier.ClosedChan():
+	}
+}
+
+// writeLoop translates the glue frames of the server to socket.io packets.
+func (s *Socket) writeLoop() {
+	closedChan := s.carrier.ClosedChan()
+
+	for {
+		select {
+		case data := <-s.writeChan:
+			// Pass the flush frames to the engine.io session.
+			if strings.HasPrefix(data, global.FlushFrameMarker) {
+				s.write(data)
+				continue
+			}
+
+			// Drop expired frames.
+			data, ok := s.Filter(data)
+			if !ok {
+				continue
+			}
+
+			if data = s.translateWrite(data); len(data) > 0 {
+				s.write(data)
+			}
+
+		case <-closedChan:
+			return
+		}
+	}
+}
+
+// translateWrite returns the socket.io packet of the glue frame.
+// An empty packet is returned if the frame is not passed to the client.
+func (s *Socket) translateWrite(frame string) string {
+	// Binary frames are not supported.
+	if len(frame) < cmdLen || strings.HasPrefix(frame, global.BinaryFrameMarker) {
+		return ""
+	}
+
+	ns := s.getNamespace()
+	data := frame[cmdLen:]
+
+	switch frame[:cmdLen] {
+	case cmdInit:
+		var init struct {
+			SocketID string `json:"socketID"`
+		}
+		json.Unmarshal([]byte(data), &init)
+
+		b, _ := json.Marshal(struct {
+			SID string `json:"sid"`
+		}{init.SocketID})
+
+		return packet{Type: packetConnect, Namespace: ns, ID: -1, Data: string(b)}.String()
+
+	case cmdReject:
+		var r struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+			Retry   bool   `json:"retry"`
+		}
+		json.Unmarshal([]byte(data), &r)
+
+		b, _ := json.Marshal(struct {
+			Message string      `json:"message"`
+			Data    interface{} `json:"data"`
+		}{r.Message, r})
+
+		return packet{Type: packetConnectError, Namespace: ns, ID: -1, Data: string(b)}.String()
+
+	case cmdDontAutoReconnect:
+		// The client doesn't reconnect after a disconnect by the server.
+		return packet{Type: packetDisconnect, Namespace: ns, ID: -1}.String()
+
+	case cmdPing:
+		s.pong()
+		return ""
+
+	case cmdChannelData:
+		name, value, err := utils.UnmarshalValues(data)
+		if err != nil {
+			return ""
+		}
+
+		// Reply the oldest event waiting for an acknowledgement.
+		if id := s.nextPending(name); id >= 0 {
+			return packet{Type: packetAck, Namespace: ns, ID: id, Data: marshalArgs(value)}.String()
+		}
+
+		// The reserved glue channels are not passed.
+		if strings.HasPrefix(name, "_") {
+			return ""
+		}
+
+		return packet{Type: packetEvent, Namespace: ns, ID: -1, Data: marshalArgs(name, value)}.String()
+
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package socketiosocket
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/utils"
+)
+
+// fakeCarrier is an engine.io session passing the packets with channels.
+type fakeCarrier struct {
+	writeChan  chan string
+	readChan   chan string
+	closedChan chan struct{}
+	closeOnce  sync.Once
+	global.Flush
+}
+
+func newFakeCarrier() *fakeCarrier {
+	return &fakeCarrier{
+		writeChan:  make(chan string, 10),
+		readChan:   make(chan string, 10),
+		closedChan: make(chan struct{}),
+	}
+}
+
+func (c *fakeCarrier) RemoteAddr() string          { return "127.0.0.1" }
+func (c *fakeCarrier) UserAgent() string           { return "test" }
+func (c *fakeCarrier) Header() http.Header         { return http.Header{} }
+func (c *fakeCarrier) Close()                      { c.closeOnce.Do(func() { close(c.closedChan) }) }
+func (c *fakeCarrier) ClosedChan() <-chan struct{} { return c.closedChan }
+func (c *fakeCarrier) WriteChan() chan string      { return c.writeChan }
+func (c *fakeCarrier) ReadChan() chan string       { return c.readChan }
+
+func (c *fakeCarrier) IsClosed() bool {
+	select {
+	case <-c.closedChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// receive returns the next value of the channel.
+func receive(t *testing.T, c chan string) string {
+	t.Helper()
+
+	select {
+	case data := <-c:
+		return data
+	case <-time.After(time.Second):
+		t.Fatal("nothing received")
+		return ""
+	}
+}
+
+// expectClosed fails if the carrier doesn't close.
+func expectClosed(t *testing.T, c *fakeCarrier) {
+	t.Helper()
+
+	select {
+	case <-c.ClosedChan():
+	case <-time.After(time.Second):
+		t.Fatal("carrier not closed")
+	}
+}
+
+// connect connects the namespace and returns the passed init request.
+func connect(t *testing.T, c *fakeCarrier, s *Socket, msg string) string {
+	t.Helper()
+
+	c.readChan <- msg
+	init := receive(t, s.ReadChan())
+
+	s.WriteChan() <- `in{"socketID":"abc"}`
+	if p := receive(t, c.writeChan); !strings.HasSuffix(p, `{"sid":"abc"}`) {
+		t.Fatalf("unexpected connect packet: %q", p)
+	}
+
+	return init
+}
+
+func TestConnect(t *testing.T) {
+	c := newFakeCarrier()
+	defer c.Close()
+	s := NewSocket(c, "2.0.0")
+
+	init := connect(t, c, s, `0/admin,{"token":"abc"}`)
+	if init != `in{"version":"2.0.0","namespace":"/admin","auth":"{\"token\":\"abc\"}","reject":true}` {
+		t.Fatalf("unexpected init request: %q", init)
+	}
+
+	// Only one namespace is supported.
+	c.readChan <- "0/other,"
+	if p := receive(t, c.writeChan); !strings.HasPrefix(p, "4/other,") {
+		t.Fatalf("unexpected connect error packet: %q", p)
+	}
+
+	// Packets of other namespaces are ignored.
+	c.readChan <- `2/other,["chat","hello"]`
+	c.readChan <- `2/admin,["chat","hello"]`
+	if f := receive(t, s.ReadChan()); f != "cd"+utils.MarshalValues("chat", "hello") {
+		t.Fatalf("unexpected frame: %q", f)
+	}
+}
+
+func TestConnectDefaultNamespace(t *testing.T) {
+	c := newFakeCarrier()
+	defer c.Close()
+	s := NewSocket(c, "2.0.0")
+
+	init := connect(t, c, s, "0")
+	if init != `in{"version":"2.0.0","namespace":"","auth":"","reject":true}` {
+		t.Fatalf("unexpected init request: %q", init)
+	}
+}
+
+func TestReject(t *testing.T) {
+	c := newFakeCarrier()
+	defer c.Close()
+	s := NewSocket(c, "2.0.0")
+
+	c.readChan <- "0/admin,"
+	receive(t, s.ReadChan())
+
+	s.WriteChan() <- `rj{"code":"auth_failed","message":"denied","retry":false}`
+	if p := receive(t, c.writeChan); p != `4/admin,{"message":"denied","data":{"code":"auth_failed","message":"denied","retry":false}}` {
+		t.Fatalf("unexpected connect error packet: %q", p)
+	}
+}
+
+func TestNotConnected(t *testing.T) {
+	c := newFakeCarrier()
+	s := NewSocket(c, "2.0.0")
+
+	c.readChan <- `2["chat","hello"]`
+	expectClosed(t, c)
+
+	select {
+	case f := <-s.ReadChan():
+		t.Fatalf("unexpected frame: %q", f)
+	default:
+	}
+}
+
+func TestBinaryPacket(t *testing.T) {
+	c := newFakeCarrier()
+	s := NewSocket(c, "2.0.0")
+	connect(t, c, s, "0")
+
+	c.readChan <- `51-["chat",{"_placeholder":true,"num":0}]`
+	expectClosed(t, c)
+}
+
+func TestDisconnect(t *testing.T) {
+	c := newFakeCarrier()
+	s := NewSocket(c, "2.0.0")
+	connect(t, c, s, "0")
+
+	c.readChan <- "1"
+	expectClosed(t, c)
+}
+
+func TestEvents(t *testing.T) {
+	c := newFakeCarrier()
+	defer c.Close()
+	s := NewSocket(c, "2.0.0")
+	connect(t, c, s, "0/admin,")
+
+	// The events with acknowledgement IDs are replied in order.
+	c.readChan <- `2/admin,1["chat","a"]`
+	c.readChan <- `2/admin,2["chat","b"]`
+	receive(t, s.ReadChan())
+	receive(t, s.ReadChan())
+
+	for _, test := range []struct{ data, want string }{
+		{"x", `3/admin,1["x"]`},
+		{"y", `3/admin,2["y"]`},
+		{"z", `2/admin,["chat","z"]`},
+	} {
+		s.WriteChan() <- "cd" + utils.MarshalValues("chat", test.data)
+		if p := receive(t, c.writeChan); p != test.want {
+			t.Fatalf("unexpected packet: %q != %q", p, test.want)
+		}
+	}
+
+	// The reserved channels, binary frames and the
+	// other glue commands are not passed to the client.
+	s.WriteChan() <- "cd" + utils.MarshalValues("_clock", "1")
+	s.WriteChan() <- global.BinaryFrameMarker + "binary"
+	s.WriteChan() <- "cl"
+	s.WriteChan() <- "dr"
+	if p := receive(t, c.writeChan); p != "1/admin," {
+		t.Fatalf("unexpected packet: %q", p)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	c := newFakeCarrier()
+	defer c.Close()
+	s := NewSocket(c, "2.0.0")
+	connect(t, c, s, "0")
+
+	flushed := make(chan string, 1)
+	s.OnFlushed(func(id string) {
+		flushed <- id
+	})
+
+	// The flush frame is passed after the previous packets.
+	s.WriteChan() <- "cd" + utils.MarshalValues("chat", "hello")
+	s.WriteChan() <- global.FlushFrame("1")
+	receive(t, c.writeChan)
+
+	data := receive(t, c.writeChan)
+	if !c.HandleFlush(data) {
+		t.Fatalf("unexpected packet: %q", data)
+	}
+	if id := receive(t, flushed); id != "1" {
+		t.Fatalf("unexpected flush ID: %q", id)
+	}
+}
+
+func TestPing(t *testing.T) {
+	c := newFakeCarrier()
+	defer c.Close()
+	s := NewSocket(c, "2.0.0")
+	connect(t, c, s, "0")
+
+	// The glue pings are answered by the socket.
+	s.WriteChan() <- "pi"
+	if f := receive(t, s.ReadChan()); f != "po" {
+		t.Fatalf("unexpected frame: %q", f)
+	}
+}
+
+func TestTooManyPending(t *testing.T) {
+	c := newFakeCarrier()
+	s := NewSocket(c, "2.0.0")
+	connect(t, c, s, "0")
+
+	go func() {
+		for i := 0; i <= maxPendingAcks; i++ {
+			select {
+			case c.readChan <- `21["chat"]`:
+			case <-c.ClosedChan():
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < maxPendingAcks; i++ {
+		receive(t, s.ReadChan())
+	}
+	expectClosed(t, c)
+}
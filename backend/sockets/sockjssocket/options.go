@@ -0,0 +1,86 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package sockjssocket
+
+import (
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultHeartbeatDelay  = 25 * time.Second
+	defaultDisconnectDelay = 5 * time.Second
+	defaultStreamingLimit  = 128 * 1024
+	defaultMaxBodySize     = 10 << 20
+
+	// DefaultClientURL is the SockJS client library loaded by the iframe transports.
+	DefaultClientURL = "https://cdn.jsdelivr.net/npm/sockjs-client@1/dist/sockjs.min.js"
+)
+
+//####################//
+//### Options type ###//
+//####################//
+
+// Options holds the SockJS server options.
+type Options struct {
+	// HeartbeatDelay is the interval of the heartbeat frames, which
+	// prevent proxies from closing idle connections.
+	// Default: 25 seconds
+	HeartbeatDelay time.Duration
+
+	// DisconnectDelay closes sessions without a receiving request after the delay.
+	// Default: 5 seconds
+	DisconnectDelay time.Duration
+
+	// StreamingLimit ends the streaming responses after the number of bytes,
+	// so the client opens a new request and the browser releases the memory.
+	// Default: 128 KB
+	StreamingLimit int
+
+	// MaxBodySize is the maximum size of the request body in bytes.
+	// Default: 10 MB
+	MaxBodySize int64
+
+	// ClientURL is the URL of the SockJS client library loaded by the iframe
+	// transports. Its version must match the version of the client.
+	// Default: DefaultClientURL
+	ClientURL string
+}
+
+// setDefaults sets unset option values to its default value.
+func (o *Options) setDefaults() {
+	if o.HeartbeatDelay <= 0 {
+		o.HeartbeatDelay = defaultHeartbeatDelay
+	}
+	if o.DisconnectDelay <= 0 {
+		o.DisconnectDelay = defaultDisconnectDelay
+	}
+	if o.StreamingLimit <= 0 {
+		o.StreamingLimit = defaultStreamingLimit
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = defaultMaxBodySize
+	}
+	if len(o.ClientURL) == 0 {
+		o.ClientURL = DefaultClientURL
+	}
+}
@@ -0,0 +1,697 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package sockjssocket provides a backend socket implementing the SockJS
+// protocol. The SockJS client library with its fallback transports
+// (xhr-streaming, eventsource, iframe, jsonp, ...) carries the glue protocol.
+package sockjssocket
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/closer"
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The page loaded by the iframe transports.
+	iframeTemplate = `<!DOCTYPE html>
+<html>
+<head>
+  <meta http-equiv="X-UA-Compatible" content="IE=edge" />
+  <meta http-equiv="Content-Type" content="text/html; charset=UTF-8" />
+  <script>
+    document.domain = document.domain;
+    _sockjs_onload = function(){SockJS.bootstrap_iframe();};
+  </script>
+  <script src="%s"></script>
+</head>
+<body>
+  <h2>Don't panic!</h2>
+  <p>This is a SockJS hidden iframe. It's used for cross domain magic.</p>
+</body>
+</html>`
+
+	// The prelude of the htmlfile transport.
+	htmlfileTemplate = `<!doctype html>
+<html><head>
+  <meta http-equiv="X-UA-Compatible" content="IE=edge" />
+  <meta http-equiv="Content-Type" content="text/html; charset=UTF-8" />
+</head><body><h2>Don't panic!</h2>
+  <script>
+    document.domain = document.domain;
+    var c = parent.%s;
+    c.start();
+    function p(d) {c.message(d);};
+    window.onload = function() {c.stop();};
+  </script>
+`
+
+	// Browsers render the htmlfile transport after the first KB only.
+	htmlfileMinPrelude = 1024
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// Some browsers pass the xhr streaming response
+	// to the client after the first 2 KB only.
+	xhrStreamingPrelude = strings.Repeat("h", 2048) + "\n"
+
+	callbackRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.]+$`)
+	iframeRegexp   = regexp.MustCompile(`^/iframe[0-9a-zA-Z.\-_]*\.html$`)
+
+	// The receiving HTTP transports by their name.
+	transports = map[string]*transport{
+		"xhr": {
+			method:      http.MethodPost,
+			contentType: "application/javascript; charset=UTF-8",
+			format:      formatXHR,
+		},
+		"xhr_streaming": {
+			method:      http.MethodPost,
+			contentType: "application/javascript; charset=UTF-8",
+			streaming:   true,
+			prelude:     func(string) string { return xhrStreamingPrelude },
+			format:      formatXHR,
+		},
+		"eventsource": {
+			method:      http.MethodGet,
+			contentType: "text/event-stream; charset=UTF-8",
+			streaming:   true,
+			prelude:     func(string) string { return "\r\n" },
+			format:      formatEventSource,
+		},
+		"htmlfile": {
+			method:      http.MethodGet,
+			contentType: "text/html; charset=UTF-8",
+			streaming:   true,
+			callback:    true,
+			prelude:     htmlfilePrelude,
+			format:      formatHTMLFile,
+		},
+		"jsonp": {
+			method:      http.MethodGet,
+			contentType: "application/javascript; charset=UTF-8",
+			callback:    true,
+			format:      formatJSONP,
+		},
+	}
+)
+
+//######################//
+//### Transport type ###//
+//######################//
+
+// A transport defines a receiving HTTP transport.
+type transport struct {
+	method      string
+	contentType string
+	streaming   bool // Set if several frames are passed with one response.
+	callback    bool // Set if the callback parameter is required.
+
+	prelude func(callback string) string
+	format  func(callback, frame string) string
+}
+
+func formatXHR(_, frame string) string {
+	return frame + "\n"
+}
+
+func formatEventSource(_, frame string) string {
+	return "data: " + frame + "\r\n\r\n"
+}
+
+func formatHTMLFile(_, frame string) string {
+	return "<script>\np(" + quote(frame) + ");\n</script>\r\n"
+}
+
+func formatJSONP(callback, frame string) string {
+	return "/**/" + callback + "(" + quote(frame) + ");\r\n"
+}
+
+func htmlfilePrelude(callback string) string {
+	p := fmt.Sprintf(htmlfileTemplate, callback)
+	if n := htmlfileMinPrelude - len(p); n > 0 {
+		p += strings.Repeat(" ", n)
+	}
+	return p + "\r\n\r\n"
+}
+
+// quote returns the frame as JSON string.
+func quote(frame string) string {
+	data, _ := json.Marshal(frame)
+	return string(data)
+}
+
+//##########################//
+//### SockJS Server type ###//
+//##########################//
+
+type Server struct {
+	sessions      map[string]*Socket
+	sessionsMutex sync.Mutex
+
+	upgrader websocket.Upgrader
+
+	onNewSocketConnection func(*Socket)
+	onHandshakeRequest    func(string, *http.Request) bool
+	onHandshakeResponse   func(http.ResponseWriter, *http.Request)
+
+	options Options
+
+	iframe     string // The page of the iframe transports.
+	iframeETag string
+}
+
+func NewServer(onNewSocketConnectionFunc func(*Socket), onHandshakeRequestFunc func(string, *http.Request) bool, onHandshakeResponseFunc func(http.ResponseWriter, *http.Request), o Options) *Server {
+	// Set the default option values for unset values.
+	o.setDefaults()
+
+	iframe := fmt.Sprintf(iframeTemplate, html.EscapeString(o.ClientURL))
+	sum := md5.Sum([]byte(iframe))
+
+	return &Server{
+		sessions: make(map[string]*Socket),
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Don't check the origin. This is done by the backend server package.
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		onNewSocketConnection: onNewSocketConnectionFunc,
+		onHandshakeRequest:    onHandshakeRequestFunc,
+		onHandshakeResponse:   onHandshakeResponseFunc,
+		options:               o,
+		iframe:                iframe,
+		iframeETag:            `"` + hex.EncodeToString(sum[:]) + `"`,
+	}
+}
+
+// HandleRequest handles the SockJS request. The path
+// is the URL path below the SockJS base URL.
+func (s *Server) HandleRequest(w http.ResponseWriter, req *http.Request, path string) {
+	switch {
+	case path == "" || path == "/":
+		s.handleGreeting(w, req)
+	case path == "/info":
+		s.handleInfo(w, req)
+	case iframeRegexp.MatchString(path):
+		s.handleIframe(w, req)
+	default:
+		// Session URLs are /<server>/<session>/<transport>.
+		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		if len(parts) != 3 || !validID(parts[0]) || !validID(parts[1]) {
+			http.NotFound(w, req)
+			return
+		}
+
+		switch parts[2] {
+		case "websocket":
+			s.handleWebSocket(w, req)
+		case "xhr_send", "jsonp_send":
+			s.handleSend(w, req, parts[1], parts[2])
+		default:
+			t, ok := transports[parts[2]]
+			if !ok {
+				http.NotFound(w, req)
+				return
+			}
+			s.handleReceive(w, req, parts[1], t)
+		}
+	}
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// validID returns true if the server or session ID is not empty and has no dots.
+func validID(id string) bool {
+	return len(id) > 0 && !strings.Contains(id, ".")
+}
+
+// setNoCache prevents caching of the response.
+func setNoCache(w http.ResponseWriter) {
+	w.Header().Set("Cache-Control", "no-store, no-cache, no-transform, must-revalidate, max-age=0")
+}
+
+// allowCredentials allows the cookies of cross origin requests. The SockJS
+// client sends them. The origin is allowed by the backend server if CORS is enabled.
+func allowCredentials(w http.ResponseWriter) {
+	if len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight answers the CORS preflight request with the allowed methods.
+func preflight(w http.ResponseWriter, req *http.Request, methods string) {
+	allowCredentials(w)
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	if h := req.Header.Get("Access-Control-Request-Headers"); len(h) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", h)
+	}
+	w.Header().Set("Access-Control-Max-Age", "31536000")
+	w.Header().Set("Cache-Control", "public, max-age=31536000")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGreeting(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	io.WriteString(w, "Welcome to SockJS!\n")
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodOptions {
+		preflight(w, req, "OPTIONS, GET")
+		return
+	} else if req.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The entropy seeds the random number generator of the client.
+	var entropy [4]byte
+	rand.Read(entropy[:])
+
+	info := struct {
+		WebSocket    bool     `json:"websocket"`
+		CookieNeeded bool     `json:"cookie_needed"`
+		Origins      []string `json:"origins"`
+		Entropy      uint32   `json:"entropy"`
+	}{
+		WebSocket: true,
+		Origins:   []string{"*:*"},
+		Entropy:   binary.BigEndian.Uint32(entropy[:]),
+	}
+
+	setNoCache(w)
+	allowCredentials(w)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(&info)
+}
+
+func (s *Server) handleIframe(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.Header.Get("If-None-Match") == s.iframeETag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	w.Header().Set("Cache-Control", "public, max-age=31536000")
+	w.Header().Set("ETag", s.iframeETag)
+	io.WriteString(w, s.iframe)
+}
+
+// newSocket creates a new socket of the request.
+func (s *Server) newSocket(req *http.Request, remoteAddr string) *Socket {
+	sock := newSocket()
+	sock.remoteAddr = remoteAddr
+	sock.userAgent = req.Header.Get("User-Agent")
+	sock.header = req.Header.Clone()
+
+	// Set the closer function.
+	sock.closer = closer.New(func() {
+		if sock.ws != nil {
+			// Send the close frame and close the websocket. Ignore errors.
+			sock.writeWebSocket(frameGoAway)
+			sock.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(3000, "Go away!"), time.Now().Add(writeWait))
+			sock.ws.Close()
+			return
+		}
+
+		// Keep the closed session for the disconnect delay,
+		// so the next receiving request gets the close frame.
+		time.AfterFunc(s.options.DisconnectDelay, func() {
+			s.sessionsMutex.Lock()
+			defer s.sessionsMutex.Unlock()
+
+			if s.sessions[sock.id] == sock {
+				delete(s.sessions, sock.id)
+			}
+		})
+	})
+
+	return sock
+}
+
+// session returns the session of the ID and creates it if not present.
+// The handshake hooks are called for new sessions. False is returned
+// if the request was rejected.
+func (s *Server) session(w http.ResponseWriter, req *http.Request, id string) (*Socket, bool) {
+	s.sessionsMutex.Lock()
+	sock, ok := s.sessions[id]
+	s.sessionsMutex.Unlock()
+
+	if ok {
+		return sock, true
+	}
+
+	// Check if the handshake is allowed, for example by the rate limit.
+	remoteAddr, _ := utils.RemoteAddress(req)
+	if !s.onHandshakeRequest(remoteAddr, req) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return nil, false
+	}
+
+	sock = s.newSocket(req, remoteAddr)
+	sock.id = id
+
+	added := func() bool {
+		// Lock the mutex.
+		s.sessionsMutex.Lock()
+		defer s.sessionsMutex.Unlock()
+
+		// Another request might have created the session in between.
+		if existing, ok := s.sessions[id]; ok {
+			sock = existing
+			return false
+		}
+
+		s.sessions[id] = sock
+		return true
+	}()
+
+	if added {
+		// Set the custom headers and cookies of the first response.
+		s.onHandshakeResponse(w, req)
+
+		// Trigger the event that a new socket connection was made.
+		s.onNewSocketConnection(sock)
+	}
+
+	return sock, true
+}
+
+// handleReceive passes the frames of the session with the transport.
+// Polling transports pass one frame per request. The session is
+// created with the first request and the open frame is passed.
+func (s *Server) handleReceive(w http.ResponseWriter, req *http.Request, id string, t *transport) {
+	if req.Method == http.MethodOptions && t.method == http.MethodPost {
+		preflight(w, req, "OPTIONS, POST")
+		return
+	} else if req.Method != t.method {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get the callback name of the JSONP and htmlfile transports.
+	var callback string
+	if t.callback {
+		callback = req.URL.Query().Get("c")
+		if len(callback) == 0 {
+			http.Error(w, `"callback" parameter required`, http.StatusInternalServerError)
+			return
+		} else if !callbackRegexp.MatchString(callback) {
+			http.Error(w, `invalid "callback" parameter`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Obtain the session or create a new one.
+	sock, ok := s.session(w, req, id)
+	if !ok {
+		return
+	}
+
+	setNoCache(w)
+	allowCredentials(w)
+	w.Header().Set("Content-Type", t.contentType)
+
+	// Pass the frames right away. Not all response writers support flushing.
+	rc := http.NewResponseController(w)
+	written := 0
+
+	write := func(frame string) error {
+		n, err := io.WriteString(w, t.format(callback, frame))
+		if err != nil {
+			return err
+		}
+		written += n
+
+		rc.Flush()
+		return nil
+	}
+
+	if t.prelude != nil {
+		io.WriteString(w, t.prelude(callback))
+	}
+
+	// Closed sessions pass the close frame.
+	if sock.IsClosed() {
+		write(frameGoAway)
+		return
+	}
+
+	// Only one receiving request is allowed per session.
+	if !sock.attach() {
+		write(frameAnotherConnection)
+		return
+	}
+	defer sock.detach(s.options.DisconnectDelay)
+
+	if sock.open() {
+		if err := write(frameOpen); err != nil || !t.streaming {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(s.options.HeartbeatDelay)
+	defer heartbeat.Stop()
+
+	for {
+		err := sock.nextFrame(heartbeat.C, req.Context().Done(), write)
+		if err != nil || !t.streaming || sock.IsClosed() || req.Context().Err() != nil {
+			return
+		}
+
+		// End the stream after the limit. The client opens a new request.
+		if written >= s.options.StreamingLimit {
+			return
+		}
+	}
+}
+
+// handleSend passes the messages of the xhr_send and jsonp_send transports
+// to the session. The messages are a JSON encoded array of strings.
+func (s *Server) handleSend(w http.ResponseWriter, req *http.Request, id, transport string) {
+	remoteAddr, _ := utils.RemoteAddress(req)
+	userAgent := req.Header.Get("User-Agent")
+
+	if req.Method == http.MethodOptions && transport == "xhr_send" {
+		preflight(w, req, "OPTIONS, POST")
+		return
+	} else if req.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.sessionsMutex.Lock()
+	sock, ok := s.sessions[id]
+	s.sessionsMutex.Unlock()
+
+	if !ok || sock.IsClosed() {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+		}).Warningf("sockjs: send request: session is closed or does not exist")
+
+		http.NotFound(w, req)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, s.options.MaxBodySize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+		}
+		return
+	}
+
+	// The jsonp_send transport passes the messages form encoded.
+	if transport == "jsonp_send" && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "Payload expected.", http.StatusInternalServerError)
+			return
+		}
+		body = []byte(values.Get("d"))
+	}
+
+	if len(body) == 0 {
+		http.Error(w, "Payload expected.", http.StatusInternalServerError)
+		return
+	}
+
+	if err = sock.pushMessages(body, false); err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+		}).Warningf("sockjs: send request: %v", err)
+
+		http.Error(w, "Broken JSON encoding.", http.StatusInternalServerError)
+		return
+	}
+
+	setNoCache(w)
+	allowCredentials(w)
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+
+	if transport == "xhr_send" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+// handleWebSocket handles the websocket transport. The session is
+// bound to the websocket and closed with the websocket.
+func (s *Server) handleWebSocket(w http.ResponseWriter, req *http.Request) {
+	remoteAddr, _ := utils.RemoteAddress(req)
+	userAgent := req.Header.Get("User-Agent")
+
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check if the handshake is allowed, for example by the rate limit.
+	if !s.onHandshakeRequest(remoteAddr, req) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	// Set the custom headers and cookies of the upgrade response.
+	s.onHandshakeResponse(w, req)
+
+	// Pass the headers and cookies set by the glue server.
+	// The upgrader ignores the response writer headers.
+	var header http.Header
+	if len(w.Header()) > 0 {
+		header = w.Header()
+	}
+
+	// The upgrader responds with an error if the upgrade fails.
+	ws, err := s.upgrader.Upgrade(w, req, header)
+	if err != nil {
+		log.Backend.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+		}).Warningf("sockjs: failed to upgrade to websocket layer: %v", err)
+		return
+	}
+
+	sock := s.newSocket(req, remoteAddr)
+	sock.ws = ws
+
+	if err = sock.writeWebSocket(frameOpen); err != nil {
+		sock.Close()
+		return
+	}
+
+	// Start the handlers in new goroutines.
+	go s.webSocketWriteLoop(sock)
+	go s.webSocketReadLoop(sock)
+
+	// Trigger the event that a new socket connection was made.
+	s.onNewSocketConnection(sock)
+}
+
+func (s *Server) webSocketReadLoop(sock *Socket) {
+	defer sock.Close()
+
+	for {
+		_, data, err := sock.ws.ReadMessage()
+		if err != nil {
+			return
+		} else if len(data) == 0 {
+			continue
+		}
+
+		// The messages are a JSON encoded array or a single string.
+		if err = sock.pushMessages(data, true); err != nil {
+			log.Backend.WithFields(logrus.Fields{
+				"remoteAddress": sock.RemoteAddr(),
+				"userAgent":     sock.UserAgent(),
+			}).Warningf("sockjs: invalid websocket message: %v", err)
+			return
+		}
+	}
+}
+
+func (s *Server) webSocketWriteLoop(sock *Socket) {
+	heartbeat := time.NewTicker(s.options.HeartbeatDelay)
+	defer heartbeat.Stop()
+
+	// The closer passes the close frame.
+	write := func(frame string) error {
+		if sock.IsClosed() {
+			return nil
+		}
+		return sock.writeWebSocket(frame)
+	}
+
+	for !sock.IsClosed() {
+		if err := sock.nextFrame(heartbeat.C, nil, write); err != nil {
+			log.Backend.WithFields(logrus.Fields{
+				"remoteAddress": sock.RemoteAddr(),
+				"userAgent":     sock.UserAgent(),
+			}).Warningf("sockjs: failed to write to websocket: %v", err)
+
+			sock.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,349 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package sockjssocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves a SockJS server below /sockjs and
+// returns the channel of the new sockets.
+func newTestServer(t *testing.T, o Options) (*httptest.Server, chan *Socket) {
+	sockets := make(chan *Socket, 10)
+
+	s := NewServer(func(sock *Socket) {
+		sockets <- sock
+	}, func(string, *http.Request) bool {
+		return true
+	}, func(http.ResponseWriter, *http.Request) {}, o)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.HandleRequest(w, r, strings.TrimPrefix(r.URL.Path, "/sockjs"))
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, sockets
+}
+
+// request sends the request and returns the status code and the body.
+func request(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(data)
+}
+
+// openSession opens the session with the first xhr poll and returns the socket.
+func openSession(t *testing.T, ts *httptest.Server, sockets chan *Socket, session string) *Socket {
+	t.Helper()
+
+	if _, body := request(t, "POST", ts.URL+"/sockjs/000/"+session+"/xhr", ""); body != "o\n" {
+		t.Fatalf("unexpected open frame: %q", body)
+	}
+
+	select {
+	case sock := <-sockets:
+		return sock
+	case <-time.After(time.Second):
+		t.Fatal("no new socket")
+		return nil
+	}
+}
+
+// receive returns the next message of the read channel.
+func receive(t *testing.T, sock *Socket) string {
+	t.Helper()
+
+	select {
+	case msg := <-sock.ReadChan():
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestInfo(t *testing.T) {
+	ts, _ := newTestServer(t, Options{})
+
+	status, body := request(t, "GET", ts.URL+"/sockjs/info", "")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status: %d", status)
+	}
+
+	var info struct {
+		WebSocket    bool     `json:"websocket"`
+		CookieNeeded bool     `json:"cookie_needed"`
+		Origins      []string `json:"origins"`
+	}
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.WebSocket || info.CookieNeeded || len(info.Origins) != 1 {
+		t.Fatalf("unexpected info: %s", body)
+	}
+
+	if status, _ = request(t, "OPTIONS", ts.URL+"/sockjs/info", ""); status != http.StatusNoContent {
+		t.Fatalf("unexpected preflight status: %d", status)
+	}
+
+	if _, body = request(t, "GET", ts.URL+"/sockjs", ""); body != "Welcome to SockJS!\n" {
+		t.Fatalf("unexpected greeting: %q", body)
+	}
+	if _, body = request(t, "GET", ts.URL+"/sockjs/iframe.html", ""); !strings.Contains(body, DefaultClientURL) {
+		t.Fatalf("iframe without client URL: %s", body)
+	}
+}
+
+func TestXHR(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+	sock := openSession(t, ts, sockets, "s1")
+
+	// The messages available right away are passed with one frame.
+	sock.WriteChan() <- "hello"
+	sock.WriteChan() <- `"wörld"`
+
+	if _, body := request(t, "POST", ts.URL+"/sockjs/000/s1/xhr", ""); body != `a["hello","\"wörld\""]`+"\n" {
+		t.Fatalf("unexpected frame: %q", body)
+	}
+
+	status, _ := request(t, "POST", ts.URL+"/sockjs/000/s1/xhr_send", `["a","b"]`)
+	if status != http.StatusNoContent {
+		t.Fatalf("unexpected send status: %d", status)
+	}
+	if msg := receive(t, sock); msg != "a" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+	if msg := receive(t, sock); msg != "b" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+
+	// Invalid send requests.
+	if status, _ = request(t, "POST", ts.URL+"/sockjs/000/s1/xhr_send", `["a"`); status != http.StatusInternalServerError {
+		t.Fatalf("broken JSON accepted: %d", status)
+	}
+	if status, _ = request(t, "POST", ts.URL+"/sockjs/000/s1/xhr_send", ""); status != http.StatusInternalServerError {
+		t.Fatalf("empty payload accepted: %d", status)
+	}
+	if status, _ = request(t, "POST", ts.URL+"/sockjs/000/unknown/xhr_send", `["a"]`); status != http.StatusNotFound {
+		t.Fatalf("send to unknown session: %d", status)
+	}
+	if status, _ = request(t, "POST", ts.URL+"/sockjs/000/s.1/xhr", ""); status != http.StatusNotFound {
+		t.Fatalf("session ID with dot accepted: %d", status)
+	}
+}
+
+func TestAnotherConnection(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+	sock := openSession(t, ts, sockets, "s1")
+
+	// Attach the first poll.
+	done := make(chan string)
+	go func() {
+		_, body := request(t, "POST", ts.URL+"/sockjs/000/s1/xhr", "")
+		done <- body
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		sock.mutex.Lock()
+		attached := sock.attached
+		sock.mutex.Unlock()
+
+		if attached {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("poll not attached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, body := request(t, "POST", ts.URL+"/sockjs/000/s1/xhr", ""); body != frameAnotherConnection+"\n" {
+		t.Fatalf("unexpected frame: %q", body)
+	}
+
+	// The session is still open.
+	sock.WriteChan() <- "data"
+	if body := <-done; body != `a["data"]`+"\n" {
+		t.Fatalf("unexpected frame: %q", body)
+	}
+}
+
+func TestHeartbeatAndClose(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{HeartbeatDelay: 20 * time.Millisecond})
+	sock := openSession(t, ts, sockets, "s1")
+
+	if _, body := request(t, "POST", ts.URL+"/sockjs/000/s1/xhr", ""); body != "h\n" {
+		t.Fatalf("unexpected heartbeat frame: %q", body)
+	}
+
+	// Closed sessions pass the close frame.
+	sock.Close()
+	for i := 0; i < 2; i++ {
+		if _, body := request(t, "POST", ts.URL+"/sockjs/000/s1/xhr", ""); body != frameGoAway+"\n" {
+			t.Fatalf("unexpected close frame: %q", body)
+		}
+	}
+}
+
+func TestDisconnectDelay(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{DisconnectDelay: 20 * time.Millisecond})
+	sock := openSession(t, ts, sockets, "s1")
+
+	select {
+	case <-sock.ClosedChan():
+	case <-time.After(time.Second):
+		t.Fatal("session without receiving request not closed")
+	}
+
+	// The session is removed after the delay and a new one is created.
+	time.Sleep(50 * time.Millisecond)
+	openSession(t, ts, sockets, "s1")
+}
+
+func TestXHRStreaming(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{StreamingLimit: 10})
+
+	resp, err := http.Post(ts.URL+"/sockjs/000/s1/xhr_streaming", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	r := bufio.NewReader(resp.Body)
+	lines := func(n int) []string {
+		var l []string
+		for i := 0; i < n; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			l = append(l, strings.TrimSuffix(line, "\n"))
+		}
+		return l
+	}
+
+	if l := lines(2); l[0] != strings.Repeat("h", 2048) || l[1] != "o" {
+		t.Fatalf("unexpected prelude and open frame: %q", l[1])
+	}
+
+	sock := <-sockets
+	sock.WriteChan() <- "first message"
+
+	if l := lines(1); l[0] != `a["first message"]` {
+		t.Fatalf("unexpected frame: %q", l[0])
+	}
+
+	// The stream ends after the limit.
+	if _, err = r.ReadString('\n'); err == nil {
+		t.Fatal("stream not ended after the limit")
+	}
+}
+
+func TestCallbackTransports(t *testing.T) {
+	ts, _ := newTestServer(t, Options{})
+
+	if status, _ := request(t, "GET", ts.URL+"/sockjs/000/s1/jsonp", ""); status != http.StatusInternalServerError {
+		t.Fatalf("jsonp without callback: %d", status)
+	}
+
+	if _, body := request(t, "GET", ts.URL+"/sockjs/000/s1/jsonp?c=cb", ""); body != `/**/cb("o");`+"\r\n" {
+		t.Fatalf("unexpected jsonp frame: %q", body)
+	}
+
+	// The messages are passed form encoded.
+	resp, err := http.PostForm(ts.URL+"/sockjs/000/s1/jsonp_send", url.Values{"d": {`["x"]`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Fatalf("unexpected jsonp send response: %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ts, sockets := newTestServer(t, Options{})
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/sockjs/000/s1/websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	read := func() string {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if frame := read(); frame != "o" {
+		t.Fatalf("unexpected open frame: %q", frame)
+	}
+	sock := <-sockets
+
+	// Arrays and single strings are accepted.
+	ws.WriteMessage(websocket.TextMessage, []byte(`["a","b"]`))
+	ws.WriteMessage(websocket.TextMessage, []byte(`"c"`))
+	for _, expected := range []string{"a", "b", "c"} {
+		if msg := receive(t, sock); msg != expected {
+			t.Fatalf("unexpected message: %q", msg)
+		}
+	}
+
+	sock.WriteChan() <- "data"
+	if frame := read(); frame != `a["data"]` {
+		t.Fatalf("unexpected frame: %q", frame)
+	}
+
+	sock.Close()
+	if frame := read(); frame != frameGoAway {
+		t.Fatalf("unexpected close frame: %q", frame)
+	}
+}
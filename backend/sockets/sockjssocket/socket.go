@@ -0,0 +1,295 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package sockjssocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/closer"
+	"github.com/desertbit/glue/backend/global"
+	"github.com/gorilla/websocket"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// SockJS frames:
+	frameOpen      = "o"
+	frameHeartbeat = "h"
+	frameMessages  = "a"
+
+	// The close frames.
+	frameGoAway            = `c[3000,"Go away!"]`
+	frameAnotherConnection = `c[2010,"Another connection still open"]`
+
+	// Time allowed to write a websocket message to the peer.
+	writeWait = 10 * time.Second
+)
+
+//##########################//
+//### SockJS Socket type ###//
+//##########################//
+
+// A Socket is a SockJS session. The sessions of the HTTP transports are
+// kept by their ID and the frames are passed to one receiving request at a
+// time. The sessions of the websocket transport are bound to the websocket.
+type Socket struct {
+	id         string
+	userAgent  string
+	remoteAddr string
+	header     http.Header
+
+	closer *closer.Closer
+	global.Expiry
+	global.Flush
+
+	writeChan chan string
+	readChan  chan string
+
+	// The websocket of the websocket transport.
+	ws         *websocket.Conn
+	writeMutex sync.Mutex
+
+	// The state of the HTTP transports.
+	opened      bool        // Set as soon as the open frame was sent.
+	attached    bool        // Set while a receiving request is attached.
+	detachTimer *time.Timer // Closes the session without receiving request.
+	mutex       sync.Mutex
+}
+
+// Create a new SockJS socket.
+func newSocket() *Socket {
+	return &Socket{
+		writeChan: make(chan string, global.WriteChanSize),
+		readChan:  make(chan string, global.ReadChanSize),
+	}
+}
+
+//################################################//
+//### SockJS Socket - Interface implementation ###//
+//################################################//
+
+func (s *Socket) Type() global.SocketType {
+	return global.TypeSockJSSocket
+}
+
+func (s *Socket) RemoteAddr() string {
+	return s.remoteAddr
+}
+
+func (s *Socket) UserAgent() string {
+	return s.userAgent
+}
+
+func (s *Socket) Header() http.Header {
+	return s.header
+}
+
+func (s *Socket) Close() {
+	s.closer.Close()
+}
+
+func (s *Socket) IsClosed() bool {
+	return s.closer.IsClosed()
+}
+
+func (s *Socket) ClosedChan() <-chan struct{} {
+	return s.closer.IsClosedChan
+}
+
+func (s *Socket) WriteChan() chan string {
+	return s.writeChan
+}
+
+func (s *Socket) ReadChan() chan string {
+	return s.readChan
+}
+
+//################################//
+//### SockJS Socket - Private ###//
+//################################//
+
+// attach attaches a receiving request. False is
+// returned if another request is attached already.
+func (s *Socket) attach() bool {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.attached {
+		return false
+	}
+	s.attached = true
+
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
+
+	return true
+}
+
+// detach detaches the receiving request. The session is closed
+// if no request is attached again within the disconnect delay.
+func (s *Socket) detach(delay time.Duration) {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.attached = false
+
+	s.detachTimer = time.AfterFunc(delay, func() {
+		s.mutex.Lock()
+		attached := s.attached
+		s.mutex.Unlock()
+
+		if !attached {
+			s.Close()
+		}
+	})
+}
+
+// open returns true once for the first receiving request,
+// which has to pass the open frame.
+func (s *Socket) open() bool {
+	// Lock the mutex.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.opened {
+		return false
+	}
+	s.opened = true
+
+	return true
+}
+
+// nextFrame waits for the next messages of the write channel and writes
+// them with one frame. The messages available right away are passed with the
+// same frame. Flush frames are handled after the previous messages were
+// written. The heartbeat frame is written if no message is available before
+// the heartbeat channel fires and the close frame if the socket closed.
+// Nothing is written if the done channel closed.
+func (s *Socket) nextFrame(heartbeat <-chan time.Time, done <-chan struct{}, write func(frame string) error) error {
+	var msgs []string
+
+	writeMessages := func() error {
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		data, err := json.Marshal(msgs)
+		if err != nil {
+			return err
+		}
+		msgs = nil
+
+		return write(frameMessages + string(data))
+	}
+
+	// Wait for the first message.
+	for len(msgs) == 0 {
+		select {
+		case data := <-s.writeChan:
+			if s.HandleFlush(data) {
+				continue
+			}
+
+			// Drop expired frames.
+			if data, ok := s.Filter(data); ok {
+				msgs = append(msgs, data)
+			}
+
+		case <-heartbeat:
+			return write(frameHeartbeat)
+
+		case <-s.closer.IsClosedChan:
+			return write(frameGoAway)
+
+		case <-done:
+			return nil
+		}
+	}
+
+	// Take the messages available right away.
+	for {
+		select {
+		case data := <-s.writeChan:
+			if strings.HasPrefix(data, global.FlushFrameMarker) {
+				// Pass the previous messages first.
+				if err := writeMessages(); err != nil {
+					return err
+				}
+				s.HandleFlush(data)
+				return nil
+			}
+
+			if data, ok := s.Filter(data); ok {
+				msgs = append(msgs, data)
+			}
+
+		default:
+			return writeMessages()
+		}
+	}
+}
+
+// pushMessages decodes the JSON encoded messages of the client
+// and passes them to the read channel. A single string is accepted
+// by the websocket transport. Empty messages are skipped.
+func (s *Socket) pushMessages(data []byte, single bool) error {
+	var msgs []string
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		var msg string
+		if !single || json.Unmarshal(data, &msg) != nil {
+			return err
+		}
+		msgs = []string{msg}
+	}
+
+	for _, msg := range msgs {
+		if len(msg) == 0 {
+			continue
+		}
+
+		select {
+		case s.readChan <- msg:
+		case <-s.closer.IsClosedChan:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// writeWebSocket writes the text message to the websocket.
+// This method is thread-safe.
+func (s *Socket) writeWebSocket(data string) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.ws.WriteMessage(websocket.TextMessage, []byte(data))
+}
@@ -36,9 +36,11 @@ type Server struct {
 	upgrader websocket.Upgrader
 
 	onNewSocketConnection func(*Socket)
+	onHandshakeRequest    func(string, *http.Request) bool
+	onHandshakeResponse   func(http.ResponseWriter, *http.Request)
 }
 
-func NewServer(onNewSocketConnectionFunc func(*Socket)) *Server {
+func NewServer(onNewSocketConnectionFunc func(*Socket), onHandshakeRequestFunc func(string, *http.Request) bool, onHandshakeResponseFunc func(http.ResponseWriter, *http.Request)) *Server {
 	return &Server{
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
@@ -48,6 +50,8 @@ func NewServer(onNewSocketConnectionFunc func(*Socket)) *Server {
 		},
 
 		onNewSocketConnection: onNewSocketConnectionFunc,
+		onHandshakeRequest:    onHandshakeRequestFunc,
+		onHandshakeResponse:   onHandshakeResponseFunc,
 	}
 }
 
@@ -58,7 +62,7 @@ func (s *Server) HandleRequest(rw http.ResponseWriter, req *http.Request) {
 
 	// This has to be a GET request.
 	if req.Method != "GET" {
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 			"method":        req.Method,
@@ -68,10 +72,26 @@ func (s *Server) HandleRequest(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Check if the handshake is allowed, for example by the rate limit.
+	if !s.onHandshakeRequest(remoteAddr, req) {
+		http.Error(rw, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	// Set the custom headers and cookies of the upgrade response.
+	s.onHandshakeResponse(rw, req)
+
+	// Pass the headers and cookies set by the glue server, e.g. the routing
+	// cookie. The upgrader ignores the response writer headers.
+	var header http.Header
+	if len(rw.Header()) > 0 {
+		header = rw.Header()
+	}
+
 	// Upgrade to a websocket.
-	ws, err := s.upgrader.Upgrade(rw, req, nil)
+	ws, err := s.upgrader.Upgrade(rw, req, header)
 	if err != nil {
-		log.L.WithFields(logrus.Fields{
+		log.Backend.WithFields(logrus.Fields{
 			"remoteAddress": remoteAddr,
 			"userAgent":     userAgent,
 		}).Warningf("failed to upgrade to websocket layer: %v", err)
@@ -83,8 +103,9 @@ func (s *Server) HandleRequest(rw http.ResponseWriter, req *http.Request) {
 	// Create a new websocket value.
 	w := newSocket(ws)
 
-	// Set the user agent.
+	// Set the user agent and the request headers.
 	w.userAgent = userAgent
+	w.header = req.Header.Clone()
 
 	// Set the remote address get function.
 	if requestRemoteAddrMethodUsed {
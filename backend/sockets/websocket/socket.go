@@ -20,6 +20,8 @@ package websocket
 
 import (
 	"io"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -55,12 +57,18 @@ type Socket struct {
 	writeMutex sync.Mutex
 
 	closer *closer.Closer
+	global.Expiry
+	global.Flush
 
 	writeChan chan string
 	readChan  chan string
 
 	userAgent      string
+	header         http.Header
 	remoteAddrFunc func() string
+
+	onPong      func()
+	onPongMutex sync.Mutex
 }
 
 // Create a new websocket value.
@@ -69,6 +77,7 @@ func newSocket(ws *websocket.Conn) *Socket {
 		ws:        ws,
 		writeChan: make(chan string, global.WriteChanSize),
 		readChan:  make(chan string, global.ReadChanSize),
+		onPong:    func() {},
 	}
 
 	// Set the closer function.
@@ -100,6 +109,10 @@ func (w *Socket) UserAgent() string {
 	return w.userAgent
 }
 
+func (w *Socket) Header() http.Header {
+	return w.header
+}
+
 func (w *Socket) Close() {
 	w.closer.Close()
 }
@@ -120,6 +133,21 @@ func (w *Socket) ReadChan() chan string {
 	return w.readChan
 }
 
+// Ping sends a websocket ping control frame.
+// Control frames are not queued behind the buffered messages.
+func (w *Socket) Ping() error {
+	return w.ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeWait))
+}
+
+// OnPong sets the function which is called as soon as a pong control frame is received.
+func (w *Socket) OnPong(f func()) {
+	// Lock the mutex.
+	w.onPongMutex.Lock()
+	defer w.onPongMutex.Unlock()
+
+	w.onPong = f
+}
+
 //###########################//
 //### WebSocket - Private ###//
 //###########################//
@@ -138,6 +166,13 @@ func (w *Socket) readLoop() {
 	w.ws.SetPongHandler(func(string) error {
 		// Reset the read deadline.
 		w.ws.SetReadDeadline(time.Now().Add(readWait))
+
+		// Call the pong function.
+		w.onPongMutex.Lock()
+		onPong := w.onPong
+		w.onPongMutex.Unlock()
+		onPong()
+
 		return nil
 	})
 
@@ -165,7 +200,7 @@ func (w *Socket) readLoop() {
 				wsCode != websocket.CloseGoingAway &&
 				wsCode != websocket.CloseNoStatusReceived {
 				// Log
-				log.L.WithFields(logrus.Fields{
+				log.Backend.WithFields(logrus.Fields{
 					"remoteAddress": w.RemoteAddr(),
 					"userAgent":     w.UserAgent(),
 				}).Warningf("failed to read data from websocket: %v", err)
@@ -195,10 +230,28 @@ func (w *Socket) writeLoop() {
 	for {
 		select {
 		case data := <-w.writeChan:
+			// Previous frames are written to the websocket.
+			if w.HandleFlush(data) {
+				continue
+			}
+
+			// Drop expired frames.
+			data, ok := w.Filter(data)
+			if !ok {
+				continue
+			}
+
+			// Send data marked as binary within a binary frame.
+			mt := websocket.TextMessage
+			if strings.HasPrefix(data, global.BinaryFrameMarker) {
+				mt = websocket.BinaryMessage
+				data = data[len(global.BinaryFrameMarker):]
+			}
+
 			// Write the data to the websocket.
-			err := w.write(websocket.TextMessage, []byte(data))
+			err := w.write(mt, []byte(data))
 			if err != nil {
-				log.L.WithFields(logrus.Fields{
+				log.Backend.WithFields(logrus.Fields{
 					"remoteAddress": w.RemoteAddr(),
 					"userAgent":     w.UserAgent(),
 				}).Warningf("failed to write to websocket: %v", err)
@@ -0,0 +1,367 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The bytes served per socket and round of the egress queue.
+	egressQuantum = 16 * 1024
+)
+
+//###################//
+//### Bucket Type ###//
+//###################//
+
+// A bucket is a token bucket limiting the bytes per second.
+// Reservations are served in their order. A deficit of a
+// large reservation delays the following reservations.
+type bucket struct {
+	rate   int64 // Bytes per second. Zero is unlimited.
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func newBucket(rate int64) *bucket {
+	return &bucket{
+		rate:   rate,
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// setRate changes the bytes per second. Zero is unlimited.
+func (b *bucket) setRate(rate int64) {
+	// Lock the mutex.
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.rate = rate
+	b.tokens = float64(rate)
+	b.last = time.Now()
+}
+
+// reserve takes n bytes from the bucket and returns
+// the duration to wait before sending them.
+func (b *bucket) reserve(n int) time.Duration {
+	// Lock the mutex.
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+
+	// Refill the tokens. The burst is limited to one second.
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * float64(b.rate)
+	if b.tokens > float64(b.rate) {
+		b.tokens = float64(b.rate)
+	}
+	b.last = now
+
+	// Take the tokens. A deficit delays the following reservations.
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / float64(b.rate) * float64(time.Second))
+}
+
+// limit returns the bytes per second.
+func (b *bucket) limit() int64 {
+	// Lock the mutex.
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.rate
+}
+
+//#########################//
+//### Egress Queue Type ###//
+//#########################//
+
+// An egressQueue shares the server bandwidth limit fairly across the sockets.
+// The reservations are served with deficit round-robin: each socket with
+// waiting reservations may send a quantum of bytes per round. Large
+// reservations are paid in quantum sized parts over multiple rounds,
+// so a large frame of one socket doesn't hold back the other sockets.
+type egressQueue struct {
+	bucket *bucket
+
+	queues  map[*Socket][]*egressReservation
+	order   []*Socket // The sockets with waiting reservations in round-robin order.
+	running bool      // Set as long as the run goroutine serves the reservations.
+	mutex   sync.Mutex
+}
+
+type egressReservation struct {
+	remaining int           // The bytes not paid yet.
+	ready     chan struct{} // Closed as soon as the bytes are paid.
+	canceled  bool          // Set if the socket closed while waiting.
+}
+
+func newEgressQueue(rate int64) *egressQueue {
+	return &egressQueue{
+		bucket: newBucket(rate),
+		queues: make(map[*Socket][]*egressReservation),
+	}
+}
+
+// reserve blocks until the n bytes of the socket are paid.
+// Returns false if the socket closed in between.
+func (eq *egressQueue) reserve(s *Socket, n int) bool {
+	if eq.bucket.limit() <= 0 {
+		return true
+	}
+
+	r := &egressReservation{
+		remaining: n,
+		ready:     make(chan struct{}),
+	}
+
+	func() {
+		// Lock the mutex.
+		eq.mutex.Lock()
+		defer eq.mutex.Unlock()
+
+		// Sockets stay part of the order until rotated without reservations.
+		if _, ok := eq.queues[s]; !ok {
+			eq.order = append(eq.order, s)
+		}
+		eq.queues[s] = append(eq.queues[s], r)
+
+		// Start the run goroutine if not running.
+		if !eq.running {
+			eq.running = true
+			go eq.run()
+		}
+	}()
+
+	select {
+	case <-r.ready:
+		return true
+	case <-s.isClosedChan:
+		// Lock the mutex.
+		eq.mutex.Lock()
+		defer eq.mutex.Unlock()
+
+		r.canceled = true
+		return false
+	}
+}
+
+// run serves the waiting reservations round-robin until none are left.
+func (eq *egressQueue) run() {
+	for {
+		s, ok := eq.next()
+		if !ok {
+			return
+		}
+
+		// Pay the reservations of the socket up to the quantum.
+		budget := egressQuantum
+		for budget > 0 {
+			r := eq.head(s)
+			if r == nil {
+				break
+			}
+
+			pay := r.remaining
+			if pay > budget {
+				pay = budget
+			}
+			budget -= pay
+
+			time.Sleep(eq.bucket.reserve(pay))
+			eq.paid(s, r, pay)
+		}
+
+		eq.rotate(s)
+	}
+}
+
+// next returns the next socket with waiting reservations. Returns
+// false and stops the run goroutine if no reservations are left.
+func (eq *egressQueue) next() (*Socket, bool) {
+	// Lock the mutex.
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	if len(eq.order) == 0 {
+		eq.running = false
+		return nil, false
+	}
+
+	return eq.order[0], true
+}
+
+// head returns the first reservation of the socket which is not canceled.
+// Canceled reservations are removed. Returns nil if none is left.
+func (eq *egressQueue) head(s *Socket) *egressReservation {
+	// Lock the mutex.
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	q := eq.queues[s]
+	for len(q) > 0 && q[0].canceled {
+		q = q[1:]
+	}
+	eq.queues[s] = q
+
+	if len(q) == 0 {
+		return nil
+	}
+
+	return q[0]
+}
+
+// paid removes the paid bytes from the reservation
+// and releases it as soon as all bytes are paid.
+func (eq *egressQueue) paid(s *Socket, r *egressReservation, n int) {
+	// Lock the mutex.
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	r.remaining -= n
+	if r.remaining > 0 {
+		return
+	}
+
+	close(r.ready)
+	eq.queues[s] = eq.queues[s][1:]
+}
+
+// rotate moves the socket to the end of the round-robin order.
+// Sockets without waiting reservations are removed.
+func (eq *egressQueue) rotate(s *Socket) {
+	// Lock the mutex.
+	eq.mutex.Lock()
+	defer eq.mutex.Unlock()
+
+	eq.order = eq.order[1:]
+
+	if len(eq.queues[s]) == 0 {
+		delete(eq.queues, s)
+		return
+	}
+
+	eq.order = append(eq.order, s)
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// SetBandwidthLimit limits the outgoing bytes per second of the socket,
+// so a single client requesting a huge amount of data can't starve the
+// writes of other sockets. Writes block until the limit allows to send
+// the data. Control frames like the keepalive are not limited. Zero
+// removes the limit. The default is set by the SocketBandwidthLimit option.
+func (s *Socket) SetBandwidthLimit(bytesPerSecond int64) {
+	s.bandwidth.setRate(bytesPerSecond)
+}
+
+// BandwidthLimit returns the outgoing bytes per second limit of the socket.
+// Zero is returned if unlimited.
+func (s *Socket) BandwidthLimit() int64 {
+	return s.bandwidth.limit()
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// throttle blocks until the socket and the server bandwidth limits
+// allow to write the raw data. Control frames are not throttled.
+// Returns false if the socket closed in between. Never call this
+// with the write mutex locked, because the wait blocks all writers.
+func (s *Socket) throttle(rawData ...string) bool {
+	n := 0
+	for _, data := range rawData {
+		if !isControlFrame(data) {
+			n += len(data)
+		}
+	}
+	if n == 0 {
+		return true
+	}
+
+	// Wait for the socket limit first, so the server
+	// bandwidth is not reserved for throttled sockets.
+	return s.wait(s.bandwidth.reserve(n)) &&
+		s.server.egress.reserve(s, n)
+}
+
+// isControlFrame returns true if the raw data is a protocol control frame
+// or a notice or acknowledgement of a reserved channel. Control frames
+// bypass the bandwidth limits, so the keepalive, the init reply and the
+// acknowledgements get through a saturated limit. The logical sockets
+// of carriers throttle their own data.
+func isControlFrame(rawData string) bool {
+	rawData = strings.TrimPrefix(rawData, global.BinaryFrameMarker)
+	if !isChannelData(rawData) {
+		return true
+	}
+
+	name, data, err := utils.UnmarshalValues(rawData[cmdLen:])
+	if err != nil {
+		return false
+	}
+
+	switch name {
+	case receiptChannelName, clockChannelName, capacityChannelName,
+		maintenanceChannelName, muxChannelName:
+		return true
+	case reliableChannelName:
+		return strings.HasPrefix(data, reliableAck)
+	}
+
+	return false
+}
+
+// wait blocks for the duration. Returns false if the socket closed in between.
+func (s *Socket) wait(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-s.isClosedChan:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+// testControlFramesUnthrottled saturates the bandwidth limit of the socket
+// and checks that the keepalive still gets through without delay.
+func testControlFramesUnthrottled(t *testing.T, conn *MemoryConn, s *Socket) {
+	t.Helper()
+
+	// The large write waits multiple seconds for the limit.
+	writeDone := make(chan struct{})
+	go func() {
+		defer close(writeDone)
+		s.Write(strings.Repeat("a", 5000))
+	}()
+	t.Cleanup(func() {
+		s.Close()
+		<-writeDone
+	})
+
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if err := conn.Send(cmdPing); err != nil {
+		t.Fatal(err)
+	}
+	receiveFrame(t, conn, cmdPong)
+
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("the pong waited for the bandwidth limit: %v", d)
+	}
+
+	select {
+	case <-writeDone:
+		t.Fatal("the large write was not throttled")
+	default:
+	}
+}
+
+func TestBucket(t *testing.T) {
+	b := newBucket(1000)
+
+	// The burst is limited to one second.
+	if d := b.reserve(1000); d != 0 {
+		t.Fatalf("expected no wait within the burst, got %v", d)
+	}
+	if d := b.reserve(500); d < 400*time.Millisecond || d > 500*time.Millisecond {
+		t.Fatalf("expected a wait of about 500ms, got %v", d)
+	}
+
+	b.setRate(0)
+	if d := b.reserve(1 << 30); d != 0 {
+		t.Fatalf("expected no wait without a limit, got %v", d)
+	}
+}
+
+func TestEgressQueueFairness(t *testing.T) {
+	server := newTestServer(t)
+	_, large := connectTestSocket(t, server)
+	_, small := connectTestSocket(t, server)
+
+	eq := newEgressQueue(100 * 1000)
+
+	// The large reservation exceeds the burst by one second.
+	largeDone := make(chan time.Duration, 1)
+	start := time.Now()
+	go func() {
+		eq.reserve(large, 200*1000)
+		largeDone <- time.Since(start)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if !eq.reserve(small, 1000) {
+		t.Fatal("reservation failed")
+	}
+	smallTook := time.Since(start)
+
+	largeTook := <-largeDone
+	if smallTook > 500*time.Millisecond || smallTook >= largeTook {
+		t.Fatalf("the small reservation waited for the large one: small %v, large %v", smallTook, largeTook)
+	}
+	if largeTook < 900*time.Millisecond {
+		t.Fatalf("expected the rate to be limited, got %v", largeTook)
+	}
+}
+
+func TestEgressQueueClosedSocket(t *testing.T) {
+	server := newTestServer(t)
+	_, large := connectTestSocket(t, server)
+	_, small := connectTestSocket(t, server)
+
+	eq := newEgressQueue(10 * 1000)
+	eq.reserve(large, 10*1000) // Drain the burst.
+
+	result := make(chan bool, 1)
+	go func() {
+		result <- eq.reserve(large, 1000*1000)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	large.Close()
+
+	select {
+	case ok := <-result:
+		if ok {
+			t.Fatal("expected the reservation of the closed socket to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the reservation of the closed socket did not return")
+	}
+
+	// The canceled reservation doesn't hold back other sockets.
+	start := time.Now()
+	eq.reserve(small, 100)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("the canceled reservation held back other sockets: %v", d)
+	}
+}
+
+func TestSocketBandwidthControlFrames(t *testing.T) {
+	server := newTestServer(t, Options{SocketBandwidthLimit: 1000})
+	conn, s := connectTestSocket(t, server)
+
+	testControlFramesUnthrottled(t, conn, s)
+}
+
+func TestIsControlFrame(t *testing.T) {
+	tests := map[string]bool{
+		cmdPing:        true,
+		cmdPong:        true,
+		cmdInit + "{}": true,
+		cmdClose:       true,
+		cmdChannelData + utils.MarshalValues(receiptChannelName, "id"):                 true,
+		cmdChannelData + utils.MarshalValues(reliableChannelName, reliableAck+"1"):     true,
+		cmdChannelData + utils.MarshalValues(reliableChannelName, reliableMessage+"1"): false,
+		cmdChannelData + utils.MarshalValues(mainChannelName, "data"):                  false,
+		cmdChannelData + utils.MarshalValues(topicChannelName, "data"):                 false,
+	}
+
+	for frame, control := range tests {
+		if isControlFrame(frame) != control {
+			t.Errorf("%q: expected control frame: %v", frame, control)
+		}
+	}
+}
+
+func TestEgressBandwidthControlFrames(t *testing.T) {
+	server := newTestServer(t, Options{MaxEgressBandwidth: 1000})
+	conn, s := connectTestSocket(t, server)
+	other, _ := connectTestSocket(t, server)
+
+	testControlFramesUnthrottled(t, conn, s)
+
+	// The keepalive of the other sockets isn't held back either.
+	start := time.Now()
+	if err := other.Send(cmdPing); err != nil {
+		t.Fatal(err)
+	}
+	receiveFrame(t, other, cmdPong)
+
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("the pong waited for the server bandwidth limit: %v", d)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"runtime/debug"
+
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used to notify the clients
+	// if the server is near its capacity.
+	capacityChannelName = "_capacity"
+)
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// NearCapacity returns true if the number of connected sockets reached the
+// ConnectionsHighWatermark option and did not fall to the low watermark since.
+func (s *Server) NearCapacity() bool {
+	// Lock the mutex.
+	s.capacityMutex.Lock()
+	defer s.capacityMutex.Unlock()
+
+	return s.nearCapacity
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// checkWatermarks compares the number of connected sockets with the
+// watermarks and triggers the callbacks and client notifications if
+// the high watermark is reached or the count fell to the low watermark.
+func (s *Server) checkWatermarks() {
+	high := s.options.ConnectionsHighWatermark
+	if high <= 0 {
+		return
+	}
+
+	// Obtain the number of connected sockets.
+	count := func() int {
+		// Lock the mutex.
+		s.socketsMutex.Lock()
+		defer s.socketsMutex.Unlock()
+
+		return len(s.sockets)
+	}()
+
+	// Update the state.
+	changed := func() bool {
+		// Lock the mutex.
+		s.capacityMutex.Lock()
+		defer s.capacityMutex.Unlock()
+
+		if !s.nearCapacity && count >= high {
+			s.nearCapacity = true
+			return true
+		} else if s.nearCapacity && count <= s.options.ConnectionsLowWatermark {
+			s.nearCapacity = false
+			return true
+		}
+
+		return false
+	}()
+
+	if !changed {
+		return
+	}
+
+	// Call the callback in a new goroutine to not block the socket handling.
+	near := s.NearCapacity()
+	f := s.options.OnConnectionsLow
+	if near {
+		f = s.options.OnConnectionsHigh
+	}
+
+	if f != nil {
+		go func() {
+			// Recover panics and log the error.
+			defer func() {
+				if e := recover(); e != nil {
+					log.L.Errorf("glue: panic while calling the connections watermark function: %v\n%s", e, debug.Stack())
+				}
+			}()
+
+			f(count)
+		}()
+	}
+
+	if !s.options.NotifyCapacity {
+		return
+	}
+
+	// Notify all connected clients. This is called by the socket handling,
+	// so don't block on full buffers. The notification is dropped instead.
+	data := cmdChannelData + utils.MarshalValues(capacityChannelName, capacityValue(near))
+	for _, socket := range s.Sockets() {
+		if socket.IsClosed() {
+			continue
+		}
+
+		if !socket.tryWrite(data) {
+			log.L.WithFields(logrus.Fields{
+				"remoteAddress": socket.RemoteAddr(),
+				"userAgent":     socket.UserAgent(),
+			}).Debugf("glue: write buffer is full: capacity notification dropped")
+		}
+	}
+}
+
+// capacityValue returns the value of the capacity notification.
+func capacityValue(near bool) string {
+	if near {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,84 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapacityNotification(t *testing.T) {
+	var high, low = make(chan int, 1), make(chan int, 1)
+
+	server := newTestServer(t, Options{
+		ConnectionsHighWatermark: 3,
+		ConnectionsLowWatermark:  2,
+		NotifyCapacity:           true,
+		OnConnectionsHigh:        func(count int) { high <- count },
+		OnConnectionsLow:         func(count int) { low <- count },
+	})
+
+	conn, _ := connectTestSocket(t, server)
+
+	// The slow socket never reads and its write buffers are full.
+	_, slow := connectTestSocket(t, server)
+	go func() {
+		for i := 0; i < 100; i++ {
+			slow.Write("data")
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Reaching the high watermark doesn't block on the slow socket.
+	done := make(chan *Socket)
+	go func() {
+		_, s := connectTestSocket(t, server)
+		done <- s
+	}()
+
+	var s *Socket
+	select {
+	case s = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the capacity notification blocked the new socket")
+	}
+
+	if name, data := receiveChannelData(t, conn); name != capacityChannelName || data != "1" {
+		t.Fatalf("unexpected notification: %s:%s", name, data)
+	}
+	if count := <-high; count != 3 {
+		t.Fatalf("unexpected high count: %d", count)
+	}
+	if !server.NearCapacity() {
+		t.Fatal("expected the server to be near its capacity")
+	}
+
+	// Falling to the low watermark clears the state.
+	s.Close()
+
+	if name, data := receiveChannelData(t, conn); name != capacityChannelName || data != "0" {
+		t.Fatalf("unexpected notification: %s:%s", name, data)
+	}
+	if count := <-low; count != 2 {
+		t.Fatalf("unexpected low count: %d", count)
+	}
+	if server.NearCapacity() {
+		t.Fatal("expected the server not to be near its capacity")
+	}
+}
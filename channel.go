@@ -19,6 +19,8 @@
 package glue
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"runtime/debug"
 	"sync"
@@ -47,7 +49,18 @@ type Channel struct {
 	readHandler *handler
 
 	name     string
-	readChan chan string
+	readChan chan Message
+
+	writeTTL       time.Duration
+	onWriteExpired WriteExpiredFunc
+	ttlMutex       sync.Mutex
+
+	readTimeout      time.Duration
+	readTimeoutMutex sync.Mutex
+
+	stream        string // The store stream if the channel is reliable.
+	ackStream     string // The store stream of the device acknowledgements.
+	reliableMutex sync.Mutex
 }
 
 func newChannel(s *Socket, name string) *Channel {
@@ -55,7 +68,7 @@ func newChannel(s *Socket, name string) *Channel {
 		s:           s,
 		readHandler: newHandler(),
 		name:        name,
-		readChan:    make(chan string, readChanBuffer),
+		readChan:    make(chan Message, readChanBuffer),
 	}
 }
 
@@ -65,22 +78,83 @@ func (c *Channel) Socket() *Socket {
 }
 
 // Write data to the channel.
+// The channel write TTL is applied if set.
+// Reliable channels persist the data until the client acknowledges it.
 func (c *Channel) Write(data string) {
-	// Prepend the socket command and send the channel name and data.
-	c.s.write(cmdChannelData + utils.MarshalValues(c.name, data))
+	if c.writeReliable(data) {
+		return
+	}
+
+	c.WriteTTL(data, c.getWriteTTL())
+}
+
+// WriteMany writes the messages to the channel in a row. The messages
+// are not interleaved with concurrent writes to the socket, so multi-part
+// updates are received as a whole. The channel write TTL is not applied.
+// Reliable channels persist the messages until the client acknowledges them.
+func (c *Channel) WriteMany(msgs ...string) {
+	if c.writeManyReliable(msgs) {
+		return
+	}
+
+	c.s.touch()
+
+	rawData := make([]string, len(msgs))
+	for i, data := range msgs {
+		rawData[i] = channelFrame(c.name, data)
+	}
+
+	c.s.writeMany(rawData)
+}
+
+// WriteBinary writes binary data to the channel.
+// The client receives the data as ArrayBuffer or Blob.
+// The channel write TTL is applied if set.
+func (c *Channel) WriteBinary(data []byte) {
+	c.s.writeBinary(c.name, data, c.getWriteTTL())
+}
+
+// WriteJSON writes the JSON encoding of v to the channel.
+func (c *Channel) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.Write(string(data))
+	return nil
+}
+
+// SetDefaultTimeout sets the default read timeout of the channel.
+// It is used by all Read and ReadJSON calls without a timeout argument.
+// Pass zero to block forever (default).
+func (c *Channel) SetDefaultTimeout(timeout time.Duration) {
+	// Lock the mutex.
+	c.readTimeoutMutex.Lock()
+	defer c.readTimeoutMutex.Unlock()
+
+	c.readTimeout = timeout
 }
 
 // Read the next message from the channel. This method is blocking.
 // One variadic argument sets a timeout duration.
-// If no timeout is specified, this method will block forever.
+// If no timeout is specified, the default timeout of the channel is used.
+// If no default timeout is set, this method will block forever.
 // ErrSocketClosed is returned, if the socket connection is closed.
 // ErrReadTimeout is returned, if the timeout is reached.
+// Binary data send by the client is returned as raw byte string.
 func (c *Channel) Read(timeout ...time.Duration) (string, error) {
 	timeoutChan := make(chan (struct{}))
 
-	// Create a timeout timer if a timeout is specified.
-	if len(timeout) > 0 && timeout[0] > 0 {
-		timer := time.AfterFunc(timeout[0], func() {
+	// Use the default timeout if no timeout is specified.
+	d := c.defaultTimeout()
+	if len(timeout) > 0 {
+		d = timeout[0]
+	}
+
+	// Create a timeout timer if a timeout is set.
+	if d > 0 {
+		timer := time.AfterFunc(d, func() {
 			// Trigger the timeout by closing the channel.
 			close(timeoutChan)
 		})
@@ -90,8 +164,8 @@ func (c *Channel) Read(timeout ...time.Duration) (string, error) {
 	}
 
 	select {
-	case data := <-c.readChan:
-		return data, nil
+	case msg := <-c.readChan:
+		return msg.Data, nil
 	case <-c.s.isClosedChan:
 		// The connection was closed.
 		// Return an error.
@@ -103,11 +177,52 @@ func (c *Channel) Read(timeout ...time.Duration) (string, error) {
 	}
 }
 
+// ReadContext reads the next message from the channel. This method is blocking
+// until a message is received or the context is done. The default timeout of
+// the channel is not applied. ErrSocketClosed is returned, if the socket
+// connection is closed and the context error, if the context is done.
+func (c *Channel) ReadContext(ctx context.Context) (string, error) {
+	select {
+	case msg := <-c.readChan:
+		return msg.Data, nil
+	case <-c.s.isClosedChan:
+		// The connection was closed.
+		// Return an error.
+		return "", ErrSocketClosed
+	case <-ctx.Done():
+		// The context was canceled or the deadline was reached.
+		return "", ctx.Err()
+	}
+}
+
+// ReadJSON reads the next message from the channel and stores
+// the decoded JSON value in the value pointed to by v.
+// This method is blocking. The timeout and errors equal the Read method.
+func (c *Channel) ReadJSON(v interface{}, timeout ...time.Duration) error {
+	data, err := c.Read(timeout...)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal([]byte(data), v)
+}
+
 // OnRead sets the function which is triggered if new data is received on the channel.
 // If this event function based method of reading data from the socket is used,
 // then don't use the socket Read method.
 // Either use the OnRead or the Read approach.
+// Binary data send by the client is passed as raw byte string.
 func (c *Channel) OnRead(f OnReadFunc) {
+	c.OnReadMsg(func(msg Message) {
+		f(msg.Data)
+	})
+}
+
+// OnReadMsg sets the function which is triggered if a new message is received
+// on the channel. In contrast to OnRead, the function is called with the
+// message ID and the send time of the client. It replaces the OnRead function.
+// Either use the OnReadMsg or the Read approach.
+func (c *Channel) OnReadMsg(f OnReadMsgFunc) {
 	// Create a new read handler for this channel.
 	// Previous handlers are stopped first.
 	handlerStopped := c.readHandler.New()
@@ -116,19 +231,23 @@ func (c *Channel) OnRead(f OnReadFunc) {
 	go func() {
 		for {
 			select {
-			case data := <-c.readChan:
+			case msg := <-c.readChan:
+				// Call the callback within the worker pool if enabled.
+				// This blocks until the callback returns to preserve the order.
+				if workers := c.s.server.readWorkers; workers != nil {
+					select {
+					case workers <- struct{}{}:
+					case <-c.s.isClosedChan:
+						return
+					}
+
+					callOnRead(f, msg)
+					<-workers
+					continue
+				}
+
 				// Call the callback in a new goroutine.
-				go func() {
-					// Recover panics and log the error.
-					defer func() {
-						if e := recover(); e != nil {
-							log.L.Errorf("glue: panic while calling onRead function: %v\n%s", e, debug.Stack())
-						}
-					}()
-
-					// Trigger the on read event function.
-					f(data)
-				}()
+				go callOnRead(f, msg)
 			case <-c.s.isClosedChan:
 				// Release this goroutine if the socket is closed.
 				return
@@ -168,9 +287,57 @@ func (c *Channel) DiscardRead() {
 	}()
 }
 
+func (c *Channel) defaultTimeout() time.Duration {
+	// Lock the mutex.
+	c.readTimeoutMutex.Lock()
+	defer c.readTimeoutMutex.Unlock()
+
+	return c.readTimeout
+}
+
+// callOnRead triggers the on read event function and recovers panics.
+func callOnRead(f OnReadMsgFunc, msg Message) {
+	// Recover panics and log the error.
+	defer func() {
+		if e := recover(); e != nil {
+			log.L.Errorf("glue: panic while calling onRead function: %v\n%s", e, debug.Stack())
+		}
+	}()
+
+	// Trigger the on read event function.
+	f(msg)
+}
+
 func (c *Channel) triggerRead(data string) {
-	// Send the data to the read channel.
-	c.readChan <- data
+	c.triggerReadMsg(Message{
+		Channel: c.name,
+		Data:    data,
+		Time:    time.Now(),
+	})
+}
+
+func (c *Channel) triggerReadMsg(msg Message) {
+	// Send the message to the read channel.
+	c.readChan <- msg
+}
+
+// writeFrame writes the prebuilt raw frame of the data to the channel.
+// Broadcasts build the frame once with channelFrame and pass it to
+// all target sockets. Reliable channels build their own frames.
+// The channel write TTL is applied if set.
+func (c *Channel) writeFrame(data, rawData string) {
+	if c.writeReliable(data) {
+		return
+	}
+
+	c.s.touch()
+	c.s.writeTTL(rawData, c.getWriteTTL())
+}
+
+// channelFrame returns the raw frame of the data for the channel.
+func channelFrame(name, data string) string {
+	// Prepend the socket command and send the channel name and data.
+	return cmdChannelData + utils.MarshalValues(name, data)
 }
 
 //#####################//
@@ -209,6 +376,21 @@ func (cs *channels) triggerReadForChannel(name, data string) error {
 	return nil
 }
 
+// pending returns the number of received values
+// not yet taken by the read handlers of the channels.
+func (cs *channels) pending() int {
+	// Lock the mutex.
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	n := 0
+	for _, c := range cs.m {
+		n += len(c.readChan)
+	}
+
+	return n
+}
+
 //#################################//
 //### Additional Socket Methods ###//
 //#################################//
@@ -216,7 +398,8 @@ func (cs *channels) triggerReadForChannel(name, data string) error {
 // Channel returns the corresponding channel value specified by the name.
 // If no channel value exists for the given name, a new channel is created.
 // Multiple calls to Channel with the same name, will always return the same
-// channel value pointer.
+// channel value pointer. The channel names "_clock", "_mux", "_topic", "_ack",
+// "_rel", "_maintenance" and "_capacity" are reserved.
 func (s *Socket) Channel(name string) *Channel {
 	// Get the socket channel pointer.
 	cs := s.channels
@@ -0,0 +1,231 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The URL path of the javascript client appended to the HTTP handle URL.
+	httpURLClientName = "glue.js"
+
+	// The versioned client URL path is the prefix, the version, optionally
+	// the content hash and the suffix, for example glue-2.0.0-0123456789abcdef.js.
+	httpURLClientPrefix = "glue-"
+	httpURLClientSuffix = ".js"
+
+	// The source map URL path is the client URL path with the suffix.
+	httpURLSourceMapSuffix = ".map"
+
+	// The length of the content hash in hexadecimal characters.
+	clientHashLength = 16
+
+	// The cache header of the client URL paths with the content hash.
+	clientImmutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+// clientFiles holds the javascript client matching the server protocol
+// version and its source map, if the client was built with one.
+//
+//go:embed client/dist/glue.js*
+var clientFiles embed.FS
+
+var (
+	clientScript    []byte
+	clientSourceMap []byte // Nil if not available.
+	clientHash      string // The content hash of the client script.
+	clientMapHash   string // The content hash of the source map.
+)
+
+func init() {
+	var err error
+	clientScript, err = clientFiles.ReadFile("client/dist/glue.js")
+	if err != nil {
+		panic("glue: failed to read the embedded javascript client: " + err.Error())
+	}
+	clientHash = contentHash(clientScript)
+
+	// The source map is optional.
+	clientSourceMap, err = clientFiles.ReadFile("client/dist/glue.js" + httpURLSourceMapSuffix)
+	if err != nil {
+		clientSourceMap = nil
+	} else {
+		clientMapHash = contentHash(clientSourceMap)
+	}
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// ClientURL returns the URL path of the embedded javascript client with the
+// server protocol version and the content hash, for example
+// /glue/glue-2.0.0-0123456789abcdef.js. The client is served with immutable
+// cache headers from this URL. The client is only served if the ServeClient
+// option is set.
+func (s *Server) ClientURL() string {
+	return s.options.HTTPHandleURL + httpURLClientPrefix + Version + "-" + clientHash + httpURLClientSuffix
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// contentHash returns the shortened hexadecimal sha256 hash of the data.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:clientHashLength]
+}
+
+// isHex returns true if the string only contains lower hexadecimal characters.
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// A clientRequest is a parsed request for the javascript client or its source map.
+type clientRequest struct {
+	version   string // The requested version if set.
+	hash      string // The requested content hash if set.
+	sourceMap bool   // The source map is requested.
+}
+
+// parseClientRequest parses the URL path of the request. Returns false
+// if the request does not target the javascript client or its source map.
+func (s *Server) parseClientRequest(r *http.Request) (c clientRequest, ok bool) {
+	name := strings.TrimPrefix(r.URL.Path, s.options.HTTPHandleURL)
+	if len(name) == len(r.URL.Path) {
+		return c, false
+	}
+
+	if strings.HasSuffix(name, httpURLSourceMapSuffix) {
+		name = strings.TrimSuffix(name, httpURLSourceMapSuffix)
+		c.sourceMap = true
+	}
+
+	if name == httpURLClientName {
+		c.version = r.URL.Query().Get("v")
+		return c, true
+	}
+
+	if !strings.HasPrefix(name, httpURLClientPrefix) || !strings.HasSuffix(name, httpURLClientSuffix) {
+		return c, false
+	}
+
+	// Split the version and the optional content hash.
+	// The version itself might contain dashes.
+	c.version = strings.TrimSuffix(strings.TrimPrefix(name, httpURLClientPrefix), httpURLClientSuffix)
+	if i := len(c.version) - clientHashLength - 1; i > 0 && c.version[i] == '-' && isHex(c.version[i+1:]) {
+		c.hash = c.version[i+1:]
+		c.version = c.version[:i]
+	}
+
+	return c, true
+}
+
+// isClientRequest returns true if the request targets the javascript client.
+func (s *Server) isClientRequest(r *http.Request) bool {
+	if !s.options.ServeClient {
+		return false
+	}
+
+	_, ok := s.parseClientRequest(r)
+	return ok
+}
+
+// serveClient responds with the embedded javascript client or its source map.
+// The protocol version of the client is passed with the X-Glue-Version header.
+// Requests for another client version are rejected with the status code 404
+// if the StrictClientVersion option is set. Responses to URL paths with the
+// current content hash are cached forever. All other responses are revalidated
+// with the ETag header.
+func (s *Server) serveClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c, _ := s.parseClientRequest(r)
+
+	// Check if the requested version matches the server version.
+	if len(c.version) > 0 && c.version != Version {
+		remoteAddr, _ := utils.RemoteAddress(r)
+
+		log.L.WithFields(logrus.Fields{
+			"remoteAddress":    remoteAddr,
+			"requestedVersion": c.version,
+			"serverVersion":    Version,
+		}).Warningf("glue: client requested a mismatched javascript client version")
+
+		if s.options.StrictClientVersion {
+			http.Error(w, "client version "+c.version+" is not available: the server version is "+Version, http.StatusNotFound)
+			return
+		}
+	}
+
+	// Select the content.
+	data, hash, contentType := clientScript, clientHash, "application/javascript; charset=utf-8"
+	if c.sourceMap {
+		if clientSourceMap == nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		data, hash, contentType = clientSourceMap, clientMapHash, "application/json; charset=utf-8"
+	} else if clientSourceMap != nil {
+		w.Header().Set("SourceMap", r.URL.Path+httpURLSourceMapSuffix)
+	}
+
+	// Only cache the content forever, if the URL matches the current content.
+	// Outdated hashes are served the current content, which must be revalidated.
+	if len(c.hash) > 0 && c.hash == clientHash {
+		w.Header().Set("Cache-Control", clientImmutableCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set("X-Glue-Version", Version)
+
+	// Handle the conditional and HEAD requests.
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
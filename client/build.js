@@ -0,0 +1,304 @@
+/*
+ *  Builds the dist files from the sources without any dependencies.
+ *  This is the only build of the client. The @@include('./file.js')
+ *  directives are replaced with the included files like gulp-file-include
+ *  did before.
+ *
+ *  The browser builds are minified. The minifier removes the comments,
+ *  the indentation and the empty lines and collapses the whitespace.
+ *  The line breaks are kept, so the automatic semicolon insertion is not
+ *  affected. Identifiers are not mangled, because this requires a full
+ *  javascript parser and thereby a dependency. The ES module and the
+ *  Node.js builds are not minified, because bundlers minify them anyway.
+ *
+ *  Minified files start with a header containing the sha256 hash of the
+ *  bundled sources. A source map with the file name and the .map suffix is
+ *  written for each minified file. It maps each line to the source line.
+ *  The Go server embeds dist/glue.js with its source map and its tests fail
+ *  if the dist files do not match the sources, so run this after each change.
+ *
+ *  Usage: node build.js
+ */
+
+'use strict';
+
+var fs     = require('fs'),
+    path   = require('path'),
+    crypto = require('crypto');
+
+// The built files. The keys are the dist files and the values the sources.
+// The optional add-ons are not part of the glue bundle and built as they are.
+var targets = {
+    'glue.js':              { src: 'glue.js',              minify: true },
+    'glue.umd.js':          { src: 'glue.umd.js',          minify: true },
+    'glue.esm.js':          { src: 'glue.esm.js',          minify: false },
+    'glue.node.js':         { src: 'glue.node.js',         minify: false },
+    'glue-sharedworker.js': { src: 'glue-sharedworker.js', minify: true },
+    'glue-rx.js':           { src: 'glue-rx.js',           minify: true },
+    'glue-vue.js':          { src: 'glue-vue.js',          minify: false },
+    'glue-fake.js':         { src: 'glue-fake.js',         minify: false }
+};
+
+// The header of minified files. The Go tests compare the hash with the sources.
+var headerPrefix = '/* Built from the client sources with sha256 ';
+
+var includeDirective = /@@include\('([^']+)'\)/;
+
+// include returns the lines of the file with the included files. Each line
+// holds its source file, the line number and the column of its first token.
+// The included files replace the directive like gulp-file-include did, so
+// the indentation of the directive is prepended to their first line.
+var include = function(file) {
+    var dir = path.dirname(file),
+        lines = [];
+
+    fs.readFileSync(file, 'utf8').split('\n').forEach(function(text, i) {
+        var m = includeDirective.exec(text);
+        if (!m) {
+            lines.push({ text: text, file: file, line: i, column: Math.max(text.search(/\S/), 0) });
+            return;
+        }
+
+        var included = include(path.join(dir, m[1])),
+            last = included[included.length - 1];
+
+        if (includeDirective.test(text.slice(m.index + m[0].length))) {
+            throw new Error(file + ':' + (i + 1) + ': multiple include directives in one line');
+        }
+
+        included[0].text = text.slice(0, m.index) + included[0].text;
+        last.text += text.slice(m.index + m[0].length);
+
+        lines = lines.concat(included);
+    });
+
+    return lines;
+};
+
+
+/*
+ *  Minifier
+ */
+
+var isWordChar = function(c) {
+    return /[A-Za-z0-9_$]/.test(c) || c > '\x7f';
+};
+
+// A slash starts a regular expression after these characters and keywords.
+var regexpPrefixChars    = '(,=:[!&|?{};+-*%<>~^',
+    regexpPrefixKeywords = ['return', 'typeof', 'case', 'do', 'else', 'in', 'of', 'new', 'delete', 'void', 'throw', 'instanceof'];
+
+// needsSpace returns true if the whitespace between the characters
+// is required to not merge two tokens into one.
+var needsSpace = function(prev, next) {
+    return (isWordChar(prev) && isWordChar(next)) ||
+        ('+-/'.indexOf(prev) >= 0 && prev === next) ||
+        (prev === '+' && next === '-') || (prev === '-' && next === '+');
+};
+
+// minify removes the comments and the needless whitespace of the code.
+// Returns the lines and the line numbers of the code they start at.
+var minify = function(code) {
+    var lines = [],
+        origins = [],
+        line = '',
+        origin = 0,
+        codeLine = 0,
+        space = false,
+        word = '',
+        i = 0;
+
+    // lastChar returns the last written significant character.
+    var lastChar = function() {
+        if (line.length > 0) {
+            return line[line.length - 1];
+        }
+        if (lines.length > 0) {
+            var l = lines[lines.length - 1];
+            return l[l.length - 1];
+        }
+        return '';
+    };
+
+    var newLine = function() {
+        if (line.length > 0) {
+            lines.push(line);
+            origins.push(origin);
+        }
+        line = '';
+        space = false;
+    };
+
+    var emit = function(s) {
+        if (line.length === 0) {
+            origin = codeLine;
+        } else if (space && needsSpace(line[line.length - 1], s[0])) {
+            line += ' ';
+        }
+        space = false;
+        line += s;
+    };
+
+    // copyLiteral copies the string or regular expression literal
+    // starting at the current position and returns its end.
+    var copyLiteral = function(quote) {
+        var start = i,
+            inClass = false;
+
+        for (i++; i < code.length; i++) {
+            var c = code[i];
+            if (c === '\\') {
+                i++;
+            } else if (c === '\n' && quote !== '`') {
+                throw new Error('unterminated literal: ' + code.slice(start, i));
+            } else if (quote === '/' && c === '[') {
+                inClass = true;
+            } else if (quote === '/' && c === ']') {
+                inClass = false;
+            } else if (c === quote && !inClass) {
+                break;
+            }
+        }
+
+        emit(code.slice(start, i + 1));
+        codeLine += code.slice(start, i + 1).split('\n').length - 1;
+        i++;
+    };
+
+    while (i < code.length) {
+        var c = code[i],
+            n = code[i + 1];
+
+        if (c === '\n') {
+            newLine();
+            codeLine++;
+            i++;
+        } else if (c === ' ' || c === '\t' || c === '\r') {
+            space = true;
+            i++;
+        } else if (c === '/' && n === '/') {
+            i = code.indexOf('\n', i);
+            if (i < 0) {
+                i = code.length;
+            }
+        } else if (c === '/' && n === '*') {
+            var end = code.indexOf('*/', i + 2);
+            if (end < 0) {
+                throw new Error('unterminated comment');
+            }
+
+            // A comment with line breaks is a line break itself.
+            var breaks = code.slice(i, end).split('\n').length - 1;
+            if (breaks > 0) {
+                newLine();
+                codeLine += breaks;
+            } else {
+                space = true;
+            }
+            i = end + 2;
+        } else if (c === '"' || c === '\'' || c === '`') {
+            copyLiteral(c);
+            word = '';
+        } else if (c === '/' && (regexpPrefixChars.indexOf(lastChar()) >= 0 ||
+                lastChar() === '' || regexpPrefixKeywords.indexOf(word) >= 0)) {
+            copyLiteral(c);
+            word = '';
+        } else {
+            word = isWordChar(c) ? (isWordChar(lastChar()) && !space ? word + c : c) : '';
+            emit(c);
+            i++;
+        }
+    }
+    newLine();
+
+    return { lines: lines, origins: origins };
+};
+
+
+/*
+ *  Source Maps
+ */
+
+var base64 = 'ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/';
+
+// vlq encodes the number as base64 VLQ value of the source map mappings.
+var vlq = function(n) {
+    var v = n < 0 ? ((-n) << 1) | 1 : n << 1,
+        s = '';
+
+    do {
+        var digit = v & 31;
+        v >>>= 5;
+        if (v > 0) {
+            digit |= 32;
+        }
+        s += base64[digit];
+    } while (v > 0);
+
+    return s;
+};
+
+// sourceMap returns the source map of the minified file. The mapped lines are
+// preceded by the skipped lines, like the header. Each mapped line starts with
+// the token at the first column of its source line.
+var sourceMap = function(name, skip, lines) {
+    var sources = [],
+        mappings = [],
+        prev = { source: 0, line: 0, column: 0 };
+
+    for (var i = 0; i < skip; i++) {
+        mappings.push('');
+    }
+
+    lines.forEach(function(l) {
+        var source = sources.indexOf(l.file);
+        if (source < 0) {
+            source = sources.push(l.file) - 1;
+        }
+
+        mappings.push('A' + vlq(source - prev.source) + vlq(l.line - prev.line) + vlq(l.column - prev.column));
+        prev = { source: source, line: l.line, column: l.column };
+    });
+
+    return JSON.stringify({
+        version:        3,
+        file:           name,
+        sources:        sources.map(function(file) {
+            return path.relative(path.join(__dirname, 'dist'), file).split(path.sep).join('/');
+        }),
+        sourcesContent: sources.map(function(file) {
+            return fs.readFileSync(file, 'utf8');
+        }),
+        names:          [],
+        mappings:       mappings.join(';')
+    }) + '\n';
+};
+
+
+/*
+ *  Build
+ */
+
+Object.keys(targets).forEach(function(name) {
+    var target = targets[name],
+        src = path.join(__dirname, 'src', target.src),
+        dst = path.join(__dirname, 'dist', name),
+        lines = include(src),
+        code = lines.map(function(l) { return l.text; }).join('\n');
+
+    if (target.minify) {
+        var hash = crypto.createHash('sha256').update(code).digest('hex'),
+            min = minify(code);
+
+        fs.writeFileSync(dst + '.map', sourceMap(name, 1, min.origins.map(function(origin) {
+            return lines[origin];
+        })));
+        console.log('built dist/' + name + '.map');
+
+        code = headerPrefix + hash + ' */\n' + min.lines.join('\n') + '\n' +
+            '//# sourceMappingURL=' + name + '.map\n';
+    }
+
+    fs.writeFileSync(dst, code);
+    console.log('built dist/' + name);
+});
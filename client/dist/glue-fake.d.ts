@@ -0,0 +1,85 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+
+// Type definitions for the optional glue fake transports.
+
+/// <reference path="glue.d.ts" />
+
+declare namespace glueFake {
+    interface Options {
+        // Initialize new connections with a fake socket ID. Default: true
+        autoInit?: boolean;
+
+        // Answer the pings of the client. Default: true
+        autoPong?: boolean;
+
+        // The delay of all frames and connection events in milliseconds. Default: 0
+        delay?: number;
+    }
+
+    interface ScriptStep {
+        // expect matches the next frame sent by the client.
+        expect: RegExp;
+
+        // reply is sent to the client if the frame matches.
+        reply?: string;
+
+        // close closes the connection after the reply.
+        close?: boolean;
+    }
+
+    interface FakeServer {
+        // env is passed to glue.env to use the transport doubles.
+        env: glue.Env;
+
+        // failConnects lets the next n connection attempts fail.
+        failConnects(n: number): FakeServer;
+
+        // failWebSocket lets all websocket connections fail if set.
+        // This forces the client to fall back to the ajax transport.
+        failWebSocket(fails?: boolean): FakeServer;
+
+        // script adds replies to the next frames sent by the client.
+        script(steps: ScriptStep[]): FakeServer;
+
+        // onReceive sets a function which is called with each frame sent by the client.
+        onReceive(f: (frame: string) => void): FakeServer;
+
+        // send sends a raw frame to the client.
+        send(frame: string): FakeServer;
+
+        // sendChannel sends the data to the named channel of the client.
+        sendChannel(name: string, data: string): FakeServer;
+
+        // disconnect closes the active connection.
+        disconnect(): FakeServer;
+
+        // received returns all frames sent by the client.
+        received(): string[];
+
+        // connections returns the number of connection attempts.
+        connections(): number;
+
+        // transport returns the type of the active connection.
+        transport(): "websocket" | "ajax" | "";
+    }
+}
+
+// glueFake creates a scriptable fake server with websocket and ajax transport doubles.
+declare function glueFake(options?: glueFake.Options): glueFake.FakeServer;
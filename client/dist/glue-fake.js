@@ -0,0 +1,458 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  Fake transports for frontend unit tests.
+ *  This file is not part of the glue library bundle.
+ */
+
+// glueFake creates a scriptable fake server with websocket and ajax transport
+// doubles. Pass its environment to glue before creating the socket:
+//
+//     var fake = glueFake();
+//     glue.env = fake.env;
+//     var socket = glue("http://fake");
+//
+// The fake server initializes new connections and answers pings automatically.
+// Frames are delivered asynchronously like with real transports.
+var glueFake = function(fakeOptions) {
+    // Turn on strict mode.
+    'use strict';
+
+    /*
+     * Constants
+     */
+
+    var DefaultOptions = {
+        // Initialize new connections with a fake socket ID.
+        autoInit: true,
+
+        // Answer the pings of the client.
+        autoPong: true,
+
+        // The delay of all frames and connection events in milliseconds.
+        delay: 0
+    };
+
+    var Commands = {
+        Init:               "in",
+        Ping:               "pi",
+        Pong:               "po",
+        ChannelData:        "cd"
+    };
+
+    var AjaxCommands = {
+        Delimiter:  "&",
+        Init:       "i",
+        Sequenced:  "s",
+        Poll:       "o",
+        Timeout:    "t",
+        Closed:     "c"
+    };
+
+
+
+    /*
+     * Variables
+     */
+
+    var fake = {},
+        options,
+        conn = false,           // The active connection.
+        connCount = 0,          // The number of connection attempts.
+        failCount = 0,          // The number of connection attempts to fail.
+        webSocketFails = false, // Fail all websocket connections.
+        script = [],            // The scripted replies.
+        listeners = [],
+        received = [];
+
+
+
+    /*
+     * Methods
+     */
+
+    var later = function(f) {
+        setTimeout(f, options.delay);
+    };
+
+    // marshalValues joins the channel name and the data like the glue client.
+    var marshalValues = function(name, data) {
+        return String(name.length) + "&" + name + data;
+    };
+
+    // failConnect returns true if the connection attempt has to fail.
+    var failConnect = function() {
+        connCount++;
+
+        if (failCount > 0) {
+            failCount--;
+            return true;
+        }
+
+        return false;
+    };
+
+    // newConn registers a new active connection.
+    // The previous connection is closed.
+    var newConn = function(type, send, close) {
+        if (conn) {
+            conn.close();
+        }
+
+        conn = {
+            id:     "fake" + connCount,
+            type:   type,
+            closed: false,
+            send:   send,
+            close:  function() {
+                if (conn.closed) {
+                    return;
+                }
+                conn.closed = true;
+                close();
+            }
+        };
+
+        return conn;
+    };
+
+    // splitPush splits the length-prefixed messages of an ajax push.
+    // The length prefix is the UTF-8 byte length of the message.
+    var splitPush = function(data) {
+        var msgs = [], i, n,
+            b = unescape(encodeURIComponent(data));
+
+        while (b.length > 0) {
+            i = b.indexOf(AjaxCommands.Delimiter);
+            n = parseInt(b.substring(0, i), 10);
+            msgs.push(decodeURIComponent(escape(b.substr(i + 1, n))));
+            b = b.substr(i + 1 + n);
+        }
+
+        return msgs;
+    };
+
+    // receive handles a frame sent by the client.
+    var receive = function(c, frame) {
+        if (c.closed) {
+            return;
+        }
+
+        received.push(frame);
+
+        for (var i = 0; i < listeners.length; i++) {
+            listeners[i](frame);
+        }
+
+        // Handle the scripted replies first.
+        if (script.length > 0 && script[0].expect.test(frame)) {
+            var step = script.shift();
+
+            if (step.reply !== undefined) {
+                c.send(step.reply);
+            }
+            if (step.close) {
+                later(c.close);
+            }
+            return;
+        }
+
+        var cmd = frame.substr(0, 2);
+        if (cmd === Commands.Init && options.autoInit) {
+            c.send(Commands.Init + JSON.stringify({ socketID: c.id }));
+        }
+        else if (cmd === Commands.Ping && options.autoPong) {
+            c.send(Commands.Pong);
+        }
+    };
+
+
+
+    /*
+     * WebSocket double
+     */
+
+    var FakeWebSocket = function(url) {
+        var ws = this,
+            c;
+
+        ws.url = url;
+        ws.readyState = 0;
+
+        var close = function() {
+            ws.readyState = 3;
+            later(function() {
+                if (ws.onclose) {
+                    ws.onclose({ code: 1000 });
+                }
+            });
+        };
+
+        later(function() {
+            if (failConnect() || webSocketFails) {
+                ws.readyState = 3;
+                if (ws.onerror) {
+                    ws.onerror({});
+                }
+                if (ws.onclose) {
+                    ws.onclose({ code: 1006 });
+                }
+                return;
+            }
+
+            c = newConn("websocket", function(frame) {
+                later(function() {
+                    if (!c.closed && ws.onmessage) {
+                        ws.onmessage({ data: frame });
+                    }
+                });
+            }, close);
+
+            ws.readyState = 1;
+            if (ws.onopen) {
+                ws.onopen();
+            }
+        });
+
+        ws.send = function(data) {
+            if (c) {
+                later(function() {
+                    receive(c, data);
+                });
+            }
+        };
+
+        ws.close = function() {
+            if (c) {
+                c.close();
+            }
+            else {
+                ws.readyState = 3;
+            }
+        };
+    };
+
+
+
+    /*
+     * XMLHttpRequest double implementing the ajax protocol
+     */
+
+    var ajaxConns = {};
+
+    var FakeXMLHttpRequest = function() {
+        var xhr = this,
+            aborted = false;
+
+        var respond = function(data) {
+            later(function() {
+                if (aborted) {
+                    return;
+                }
+                xhr.status = 200;
+                xhr.response = xhr.responseText = data;
+                if (xhr.onload) {
+                    xhr.onload();
+                }
+            });
+        };
+
+        var fail = function() {
+            later(function() {
+                if (!aborted && xhr.onerror) {
+                    xhr.onerror();
+                }
+            });
+        };
+
+        xhr.open = function() {};
+        xhr.setRequestHeader = function() {};
+
+        xhr.abort = function() {
+            aborted = true;
+        };
+
+        xhr.send = function(data) {
+            var a, i,
+                cmd = data.substr(0, 1);
+            data = data.substr(1);
+
+            // Create a new ajax session.
+            if (cmd === AjaxCommands.Init) {
+                if (failConnect()) {
+                    fail();
+                    return;
+                }
+
+                a = { queue: [], poll: false, token: 0 };
+
+                a.conn = newConn("ajax", function(frame) {
+                    a.queue.push(frame);
+                    a.flush();
+                }, function() {
+                    a.flush();
+                });
+
+                a.flush = function() {
+                    if (!a.poll) {
+                        return;
+                    }
+                    if (a.conn.closed) {
+                        a.poll(AjaxCommands.Closed);
+                    }
+                    else if (a.queue.length > 0) {
+                        a.token++;
+                        a.poll(String(a.token) + AjaxCommands.Delimiter + a.queue.shift());
+                    }
+                    else {
+                        return;
+                    }
+                    a.poll = false;
+                };
+
+                ajaxConns[a.conn.id] = a;
+                respond(a.conn.id + AjaxCommands.Delimiter + String(a.token));
+                return;
+            }
+
+            i = data.indexOf(AjaxCommands.Delimiter);
+            a = ajaxConns[data.substring(0, i)];
+            if (i < 0 || !a) {
+                respond(AjaxCommands.Closed);
+                return;
+            }
+            data = data.substr(i + 1);
+
+            if (cmd === AjaxCommands.Sequenced) {
+                // Skip the sequence number. The fake transport never retries pushes.
+                var msgs = splitPush(data.substr(data.indexOf(AjaxCommands.Delimiter) + 1));
+
+                respond("");
+                later(function() {
+                    for (var j = 0; j < msgs.length; j++) {
+                        receive(a.conn, msgs[j]);
+                    }
+                });
+            }
+            else if (cmd === AjaxCommands.Poll) {
+                a.poll = respond;
+                a.flush();
+            }
+            else {
+                fail();
+            }
+        };
+    };
+
+
+
+    /*
+     * Fake server methods
+     */
+
+    // env is passed to glue.env to use the transport doubles.
+    fake.env = {
+        WebSocket:      FakeWebSocket,
+        XMLHttpRequest: FakeXMLHttpRequest,
+        location:       { protocol: "http:", host: "fake" }
+    };
+
+    // failConnects lets the next n connection attempts fail.
+    fake.failConnects = function(n) {
+        failCount = n;
+        return fake;
+    };
+
+    // failWebSocket lets all websocket connections fail if set.
+    // This forces the client to fall back to the ajax transport.
+    fake.failWebSocket = function(fails) {
+        webSocketFails = fails !== false;
+        return fake;
+    };
+
+    // script adds replies to the next frames sent by the client.
+    // Each step has a regular expression to match the frame, an optional
+    // reply frame and an optional close flag to close the connection.
+    // Frames not matching the next step are handled as usual.
+    fake.script = function(steps) {
+        script = script.concat(steps);
+        return fake;
+    };
+
+    // onReceive sets a function which is called with each frame sent by the client.
+    fake.onReceive = function(f) {
+        listeners.push(f);
+        return fake;
+    };
+
+    // send sends a raw frame to the client.
+    fake.send = function(frame) {
+        if (conn && !conn.closed) {
+            conn.send(frame);
+        }
+        return fake;
+    };
+
+    // sendChannel sends the data to the named channel of the client.
+    fake.sendChannel = function(name, data) {
+        return fake.send(Commands.ChannelData + marshalValues(name, data));
+    };
+
+    // disconnect closes the active connection.
+    fake.disconnect = function() {
+        if (conn) {
+            conn.close();
+        }
+        return fake;
+    };
+
+    // received returns all frames sent by the client.
+    fake.received = function() {
+        return received.slice();
+    };
+
+    // connections returns the number of connection attempts.
+    fake.connections = function() {
+        return connCount;
+    };
+
+    // transport returns the type of the active connection:
+    // "websocket", "ajax" or an empty string if not connected.
+    fake.transport = function() {
+        return conn && !conn.closed ? conn.type : "";
+    };
+
+
+
+    /*
+     * Initialize section
+     */
+
+    options = {};
+    for (var key in DefaultOptions) {
+        options[key] = DefaultOptions[key];
+    }
+    for (key in fakeOptions) {
+        if (fakeOptions.hasOwnProperty(key)) {
+            options[key] = fakeOptions[key];
+        }
+    }
+
+    return fake;
+};
@@ -0,0 +1,43 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Type definitions for the optional glue RxJS bindings.
+
+/// <reference path="glue.d.ts" />
+
+declare namespace glueRx {
+    type Observable<T> = import("rxjs").Observable<T>;
+
+    interface GlueRx {
+        // state$ emits the current socket state and all state changes.
+        state$: Observable<glue.State>;
+
+        // messages$ emits all messages received on the main channel.
+        messages$: Observable<glue.MessageData>;
+
+        // channel returns an observable emitting all messages of the named channel.
+        channel(name: string): Observable<glue.MessageData>;
+
+        // event returns an observable emitting the socket event.
+        event(name: keyof glue.EventMap): Observable<any>;
+    }
+}
+
+// glueRx wraps a glue socket and exposes the connection state and
+// the received messages as RxJS observables.
+declare function glueRx(socket: glue.Socket, observable?: typeof import("rxjs").Observable): glueRx.GlueRx;
@@ -0,0 +1,51 @@
+/* Built from the client sources with sha256 bfc074eabfa037371f546d5bd2dc2aa10f5fa706656205cd30468fe445e1f340 */
+var glueRx=function(socket,Observable){
+'use strict';
+var StateEvents=["connecting","connected","reconnecting","waiting","disconnected"];
+if(!Observable){
+if(typeof rxjs==="undefined"||!rxjs.Observable){
+throw new Error("glue: rx: no RxJS Observable constructor available");
+}
+Observable=rxjs.Observable;
+}
+var fromChannel=function(c){
+return new Observable(function(subscriber){
+return c.subscribe(function(data){
+subscriber.next(data);
+});
+});
+};
+var fromEvent=function(event){
+return new Observable(function(subscriber){
+var f=function(){
+subscriber.next(arguments.length>1?Array.prototype.slice.call(arguments):arguments[0]);
+};
+socket.on(event,f);
+return function(){
+socket.off(event,f);
+};
+});
+};
+return{
+state$:new Observable(function(subscriber){
+var f=function(){
+subscriber.next(socket.state());
+};
+f();
+for(var i=0;i<StateEvents.length;i++){
+socket.on(StateEvents[i],f);
+}
+return function(){
+for(var i=0;i<StateEvents.length;i++){
+socket.off(StateEvents[i],f);
+}
+};
+}),
+messages$:fromChannel(socket),
+channel:function(name){
+return fromChannel(socket.channel(name));
+},
+event:fromEvent
+};
+};
+//# sourceMappingURL=glue-rx.js.map
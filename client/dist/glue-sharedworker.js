@@ -0,0 +1,2391 @@
+/* Built from the client sources with sha256 0808267522426196aba84de752dc3a706913ed3797e88c1743fc2357bb1890fc */
+var glue=function(host,options){
+'use strict';
+function Emitter(obj){
+if(obj)return mixin(obj);
+}
+function mixin(obj){
+for(var key in Emitter.prototype){
+obj[key]=Emitter.prototype[key];
+}
+return obj;
+}
+Emitter.prototype.on=
+Emitter.prototype.addEventListener=function(event,fn){
+this._callbacks=this._callbacks||{};
+(this._callbacks['$'+event]=this._callbacks['$'+event]||[])
+.push(fn);
+return this;
+};
+Emitter.prototype.once=function(event,fn){
+function on(){
+this.off(event,on);
+fn.apply(this,arguments);
+}
+on.fn=fn;
+this.on(event,on);
+return this;
+};
+Emitter.prototype.off=
+Emitter.prototype.removeListener=
+Emitter.prototype.removeAllListeners=
+Emitter.prototype.removeEventListener=function(event,fn){
+this._callbacks=this._callbacks||{};
+if(0===arguments.length){
+this._callbacks={};
+return this;
+}
+var callbacks=this._callbacks['$'+event];
+if(!callbacks)return this;
+if(1==arguments.length){
+delete this._callbacks['$'+event];
+return this;
+}
+var cb;
+for(var i=0;i<callbacks.length;i++){
+cb=callbacks[i];
+if(cb===fn||cb.fn===fn){
+callbacks.splice(i,1);
+break;
+}
+}
+return this;
+};
+Emitter.prototype.emit=function(event){
+this._callbacks=this._callbacks||{};
+var args=[].slice.call(arguments,1),callbacks=this._callbacks['$'+event];
+if(callbacks){
+callbacks=callbacks.slice(0);
+for(var i=0,len=callbacks.length;i<len;++i){
+callbacks[i].apply(this,args);
+}
+}
+return this;
+};
+Emitter.prototype.listeners=function(event){
+this._callbacks=this._callbacks||{};
+return this._callbacks['$'+event]||[];
+};
+Emitter.prototype.hasListeners=function(event){
+return!!this.listeners(event).length;
+};
+var newWebSocket=function(){
+var s={},
+ws;
+s.binary=true;
+s.open=function(){
+try{
+var url;
+if(host.match("^https://")){
+url="wss"+host.substr(5);
+}else{
+url="ws"+host.substr(4);
+}
+url+=options.baseURL+"ws"+routingQuery();
+ws=new env.WebSocket(url);
+ws.binaryType="arraybuffer";
+ws.onmessage=function(event){
+if(typeof event.data!=="string"){
+s.onMessage(event.data);
+return;
+}
+s.onMessage(event.data.toString());
+};
+ws.onerror=function(event){
+var msg="the websocket closed the connection with ";
+if(event.code){
+msg+="the error code: "+event.code;
+}
+else{
+msg+="an error.";
+}
+s.onError(msg);
+};
+ws.onclose=function(){
+s.onClose();
+};
+ws.onopen=function(){
+s.onOpen();
+};
+}catch(e){
+s.onError();
+}
+};
+s.send=function(data){
+ws.send(data);
+};
+s.reset=function(){
+if(ws){
+ws.close();
+}
+ws=undefined;
+};
+return s;
+};
+var newAjaxSocket=function(){
+var ajaxHost=host+options.baseURL+"ajax"+routingQuery(),
+sendTimeout=8000,
+pollTimeoutMargin=10000,
+ajaxProtocolVersion="2";
+var PollCommands={
+Timeout:"t",
+Closed:"c"
+};
+var Commands={
+Delimiter:"&",
+Init:"i",
+Sequenced:"s",
+Poll:"o"
+};
+var s={},
+uid,pollToken,
+pollXhr=false,
+sendXhr=false,
+stopped=false,
+pushing=false,
+pushQueue=[],
+pushSeq=0,
+poll;
+var ajaxOptions={
+pollTimeout:35000,
+pollDelay:0,
+pushRetries:0,
+pushRetryDelay:1000
+};
+s.binary=false;
+var stopRequests=function(){
+poll=function(){};
+stopped=true;
+if(pollXhr){
+pollXhr.abort();
+}
+if(sendXhr){
+sendXhr.abort();
+}
+};
+var postAjax=function(url,timeout,data,success,error){
+var xhr=new env.XMLHttpRequest();
+xhr.onload=function(){
+success(xhr.response);
+};
+xhr.onerror=function(){
+error();
+};
+xhr.ontimeout=function(){
+error("timeout");
+};
+xhr.open('POST',url,true);
+xhr.responseType="text";
+xhr.timeout=timeout;
+xhr.send(data);
+return xhr;
+};
+var triggerClosed=function(){
+stopRequests();
+s.onClose();
+};
+var triggerError=function(msg){
+stopRequests();
+if(msg){
+msg="the ajax socket closed the connection with the error: "+msg;
+}
+else{
+msg="the ajax socket closed the connection with an error.";
+}
+s.onError(msg);
+};
+var send=function(data,callback,retries){
+if(retries===undefined){
+retries=ajaxOptions.pushRetries;
+}
+sendXhr=postAjax(ajaxHost,sendTimeout,data,function(data){
+sendXhr=false;
+if(callback){
+callback(data);
+}
+},function(msg){
+sendXhr=false;
+if(retries>0){
+setTimeout(function(){
+if(!stopped){
+send(data,callback,retries-1);
+}
+},ajaxOptions.pushRetryDelay);
+return;
+}
+triggerError(msg);
+});
+};
+var push=function(){
+if(pushQueue.length===0){
+pushing=false;
+return;
+}
+pushSeq++;
+var data=Commands.Sequenced+uid+Commands.Delimiter+String(pushSeq)+Commands.Delimiter;
+for(var i=0;i<pushQueue.length;i++){
+data+=String(utils.encodeUTF8(pushQueue[i]).length)+Commands.Delimiter+pushQueue[i];
+}
+pushQueue=[];
+pushing=true;
+send(data,push);
+};
+var setOptions=function(data){
+if(!data){
+return;
+}
+try{
+var o=JSON.parse(data);
+for(var key in ajaxOptions){
+if(typeof o[key]===typeof ajaxOptions[key]&&!(o[key]<0)){
+ajaxOptions[key]=o[key];
+}
+}
+}
+catch(err){
+console.log("glue: failed to parse the ajax options: "+err.message);
+}
+};
+poll=function(){
+var data=Commands.Poll+uid+Commands.Delimiter+pollToken;
+var timeout=ajaxOptions.pollTimeout+pollTimeoutMargin;
+pollXhr=postAjax(ajaxHost,timeout,data,function(data){
+pollXhr=false;
+if(data==PollCommands.Timeout){
+poll();
+return;
+}
+if(data==PollCommands.Closed){
+triggerClosed();
+return;
+}
+var i=data.indexOf(Commands.Delimiter);
+if(i<0){
+triggerError("ajax socket: failed to split poll token from data!");
+return;
+}
+pollToken=data.substring(0,i);
+data=data.substr(i+1);
+if(ajaxOptions.pollDelay>0){
+setTimeout(function(){
+poll();
+},ajaxOptions.pollDelay);
+}
+else{
+poll();
+}
+s.onMessage(data);
+},function(msg){
+pollXhr=false;
+triggerError(msg);
+});
+};
+s.open=function(){
+send(Commands.Init+ajaxProtocolVersion,function(data){
+var i=data.indexOf(Commands.Delimiter);
+if(i<0){
+triggerError("ajax socket: failed to split uid and poll token from data!");
+return;
+}
+uid=data.substring(0,i);
+pollToken=data.substr(i+1);
+i=pollToken.indexOf(Commands.Delimiter);
+if(i>=0){
+setOptions(pollToken.substr(i+1));
+pollToken=pollToken.substring(0,i);
+}
+poll();
+s.onOpen();
+});
+};
+s.send=function(data){
+pushQueue.push(data);
+if(!pushing){
+push();
+}
+};
+s.reset=function(){
+stopRequests();
+};
+return s;
+};
+var newMuxSocket=function(){
+var s={},
+transport=options.muxTransport,
+id=false;
+s.binary=false;
+s.open=function(){
+id=transport.open(s);
+};
+s.send=function(data){
+transport.send(id,data);
+};
+s.reset=function(){
+if(id!==false){
+transport.close(id);
+}
+id=false;
+};
+return s;
+};
+var newSockJSSocket=function(){
+var s={},
+sock;
+s.binary=false;
+s.open=function(){
+try{
+var url=host+options.baseURL+"sockjs"+routingQuery();
+sock=new env.SockJS(url,null,options.sockJSOptions||{});
+sock.onmessage=function(event){
+s.onMessage(String(event.data));
+};
+sock.onclose=function(){
+s.onClose();
+};
+sock.onopen=function(){
+s.onOpen();
+};
+}catch(e){
+s.onError();
+}
+};
+s.send=function(data){
+sock.send(data);
+};
+s.reset=function(){
+if(sock){
+sock.close();
+}
+sock=undefined;
+};
+return s;
+};
+var newEngineIOSocket=function(){
+var s={},
+sock;
+s.binary=false;
+s.open=function(){
+try{
+var o=utils.extend({},options.engineIOOptions||{});
+o.path=options.baseURL+"engine.io/";
+sock=new env.EngineIO(host+routingQuery(),o);
+sock.on("message",function(data){
+s.onMessage(String(data));
+});
+sock.on("close",function(){
+s.onClose();
+});
+sock.on("open",function(){
+s.onOpen();
+});
+}catch(e){
+s.onError();
+}
+};
+s.send=function(data){
+sock.send(data);
+};
+s.reset=function(){
+if(sock){
+sock.close();
+}
+sock=undefined;
+};
+return s;
+};
+var Version="2.0.0",
+MainChannelName="m",
+ClockChannelName="_clock",
+TopicChannelName="_topic",
+ReceiptChannelName="_ack",
+ReliableChannelName="_rel",
+MaintenanceChannelName="_maintenance",
+CapacityChannelName="_capacity";
+var ReliableRequests={
+Message:"m",
+Ack:"a"
+};
+var TopicRequests={
+Subscribe:"s",
+Unsubscribe:"u"
+};
+var ClockMessages={
+Sample:"s",
+Offset:"o"
+};
+var SocketTypes={
+WebSocket:"WebSocket",
+AjaxSocket:"AjaxSocket",
+MuxSocket:"MuxSocket",
+SockJSSocket:"SockJSSocket",
+EngineIOSocket:"EngineIOSocket"
+};
+var Commands={
+Len:2,
+Init:'in',
+Ping:'pi',
+Pong:'po',
+Close:'cl',
+Invalid:'iv',
+DontAutoReconnect:'dr',
+ChannelData:'cd',
+ChannelBinaryData:'cb',
+Reject:'rj',
+GoingAway:'ga',
+IdleWarning:'iw',
+Reconnect:'rc'
+};
+var States={
+Disconnected:"disconnected",
+Connecting:"connecting",
+Reconnecting:"reconnecting",
+Waiting:"waiting",
+Connected:"connected"
+};
+var DisconnectReasons={
+Closed:"closed",
+ReconnectDisabled:"reconnect_disabled",
+MaxAttempts:"max_attempts",
+ServerRequest:"server_request",
+Rejected:"rejected"
+};
+var DefaultOptions={
+baseURL:"/glue/",
+forceSocketType:false,
+sockJSOptions:false,
+engineIOOptions:false,
+namespace:"",
+auth:"",
+handshake:"",
+ticket:"",
+clientID:"",
+connectTimeout:10000,
+pingInterval:35000,
+pingReconnectTimeout:5000,
+reconnect:true,
+reconnectDelay:1000,
+reconnectDelayMax:5000,
+reconnectDelayMultiplier:0,
+reconnectJitter:true,
+reconnectAttempts:10,
+resetSendBufferTimeout:10000,
+offlineQueue:false,
+appState:false,
+binaryType:"arraybuffer",
+json:false,
+clockSyncSamples:5,
+dedupWindow:256
+};
+var DefaultOfflineQueueOptions={
+maxCount:100,
+maxBytes:1048576,
+ttl:60000,
+onDrop:false
+};
+var DropReasons={
+MaxCount:"max_count",
+MaxBytes:"max_bytes",
+Expired:"expired"
+};
+var env={
+WebSocket:typeof WebSocket!=="undefined"?WebSocket:undefined,
+XMLHttpRequest:typeof XMLHttpRequest!=="undefined"?XMLHttpRequest:undefined,
+SockJS:typeof SockJS!=="undefined"?SockJS:undefined,
+EngineIO:typeof eio!=="undefined"?eio:undefined,
+location:typeof window!=="undefined"?window.location:undefined
+};
+var emitter=new Emitter,
+bs=false,
+mainChannel,
+initialConnectedOnce=false,
+bsNewFunc,
+currentSocketType,
+currentState=States.Disconnected,
+currentStateInfo={state:States.Disconnected},
+reconnectTimeout=false,
+reconnectCount=0,
+autoReconnectDisabled=false,
+connectTimeout=false,
+pingTimeout=false,
+pingReconnectTimeout=false,
+sendBuffer=[],
+sendBufferBytes=0,
+resetSendBufferTimeout=false,
+resetSendBufferTimedOut=false,
+isReady=false,
+beforeReadySendBuffer=[],
+clockSamples=[],
+clockOffset=0,
+topics={},
+routing=false,
+rejection=false,
+nativeKeepalive=false,
+nearCapacity=false,
+ticket="",
+clientID="",
+reliablePending=[],
+reliableCount=0,
+reliablePrefix=Math.random().toString(36).slice(2,10)+Date.now().toString(36),
+socketID="";
+var closeSocket,send,sendBuffered,sendBufferedBinary,sendReliable;
+var utils=(function(){
+var Delimiter="&",
+Base64Chars="ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+var instance={};
+instance.extend=function(){
+for(var i=1;i<arguments.length;i++)
+for(var key in arguments[i])
+if(arguments[i].hasOwnProperty(key))
+arguments[0][key]=arguments[i][key];
+return arguments[0];
+};
+instance.isFunction=function(v){
+var getType={};
+return v&&getType.toString.call(v)==='[object Function]';
+};
+instance.unmarshalValues=function(data){
+if(!data){
+return false;
+}
+var pos=data.indexOf(Delimiter);
+var len=parseInt(data.substring(0,pos),10);
+data=data.substring(pos+1);
+if(len<0||len>data.length){
+return false;
+}
+var firstV=data.substr(0,len);
+var secondV=data.substr(len);
+return{
+first:firstV,
+second:secondV
+};
+};
+instance.marshalValues=function(first,second){
+return String(first.length)+Delimiter+first+second;
+};
+instance.isBinary=function(v){
+if(!v||typeof v!=="object"){
+return false;
+}
+return(typeof ArrayBuffer!=="undefined"&&(v instanceof ArrayBuffer||ArrayBuffer.isView(v)))||
+(typeof Blob!=="undefined"&&v instanceof Blob);
+};
+instance.isBlob=function(v){
+return typeof Blob!=="undefined"&&v instanceof Blob;
+};
+instance.readBlob=function(blob,callback){
+if(blob.arrayBuffer){
+blob.arrayBuffer().then(callback,function(err){
+console.log("glue: failed to read blob: "+err);
+});
+return;
+}
+var reader=new FileReader();
+reader.onload=function(){
+callback(reader.result);
+};
+reader.onerror=function(){
+console.log("glue: failed to read blob: "+reader.error);
+};
+reader.readAsArrayBuffer(blob);
+};
+instance.toUint8Array=function(v){
+if(v instanceof Uint8Array){
+return v;
+}
+if(ArrayBuffer.isView(v)){
+return new Uint8Array(v.buffer,v.byteOffset,v.byteLength);
+}
+return new Uint8Array(v);
+};
+instance.encodeUTF8=function(str){
+if(typeof TextEncoder!=="undefined"){
+return new TextEncoder().encode(str);
+}
+var s=unescape(encodeURIComponent(str)),
+b=new Uint8Array(s.length);
+for(var i=0;i<s.length;i++){
+b[i]=s.charCodeAt(i);
+}
+return b;
+};
+instance.decodeUTF8=function(b){
+if(typeof TextDecoder!=="undefined"){
+return new TextDecoder().decode(b);
+}
+var s="";
+for(var i=0;i<b.length;i++){
+s+=String.fromCharCode(b[i]);
+}
+return decodeURIComponent(escape(s));
+};
+instance.marshalBinary=function(cmd,first,second){
+var firstB=instance.encodeUTF8(first),
+secondB=instance.toUint8Array(second),
+head=cmd+String(firstB.length)+Delimiter,
+b=new Uint8Array(head.length+firstB.length+secondB.length);
+for(var i=0;i<head.length;i++){
+b[i]=head.charCodeAt(i);
+}
+b.set(firstB,head.length);
+b.set(secondB,head.length+firstB.length);
+return b;
+};
+instance.unmarshalBinary=function(data,cmdLen){
+var b=new Uint8Array(data),
+pos=-1,
+i;
+for(i=cmdLen;i<b.length;i++){
+if(b[i]===Delimiter.charCodeAt(0)){
+pos=i;
+break;
+}
+}
+if(pos<0){
+return false;
+}
+var head="";
+for(i=0;i<pos;i++){
+head+=String.fromCharCode(b[i]);
+}
+var len=parseInt(head.substr(cmdLen),10);
+if(isNaN(len)||len<0||pos+1+len>b.length){
+return false;
+}
+return{
+cmd:head.substr(0,cmdLen),
+first:instance.decodeUTF8(b.subarray(pos+1,pos+1+len)),
+second:data.slice(pos+1+len)
+};
+};
+instance.newError=function(name,msg){
+var err=new Error(msg);
+err.name=name;
+return err;
+};
+instance.watchCancel=function(opts,what,cancel){
+var timer=false,
+signal=opts?opts.signal:undefined,
+onAbort;
+var stop=function(){
+if(timer!==false){
+clearTimeout(timer);
+timer=false;
+}
+if(signal&&onAbort){
+signal.removeEventListener("abort",onAbort);
+}
+};
+if(!opts){
+return stop;
+}
+if(signal){
+if(signal.aborted){
+cancel(instance.newError("AbortError","glue: "+what+" aborted"));
+return stop;
+}
+onAbort=function(){
+stop();
+cancel(instance.newError("AbortError","glue: "+what+" aborted"));
+};
+signal.addEventListener("abort",onAbort);
+}
+if(opts.timeout>0){
+timer=setTimeout(function(){
+timer=false;
+stop();
+cancel(instance.newError("TimeoutError","glue: "+what+" timed out"));
+},opts.timeout);
+}
+return stop;
+};
+var btoaFunc=function(s){
+if(typeof btoa!=="undefined"){
+return btoa(s);
+}
+var out="",c1,c2,c3;
+for(var i=0;i<s.length;i+=3){
+c1=s.charCodeAt(i);
+c2=s.charCodeAt(i+1);
+c3=s.charCodeAt(i+2);
+out+=Base64Chars.charAt(c1>>2);
+out+=Base64Chars.charAt(((c1&3)<<4)|(c2>>4));
+out+=(i+1<s.length)?Base64Chars.charAt(((c2&15)<<2)|(c3>>6)):"=";
+out+=(i+2<s.length)?Base64Chars.charAt(c3&63):"=";
+}
+return out;
+};
+var atobFunc=function(s){
+if(typeof atob!=="undefined"){
+return atob(s);
+}
+var out="",bits=0,n=0,v;
+for(var i=0;i<s.length;i++){
+v=Base64Chars.indexOf(s.charAt(i));
+if(v<0){
+continue;
+}
+bits=(bits<<6)|v;
+n+=6;
+if(n>=8){
+n-=8;
+out+=String.fromCharCode((bits>>n)&255);
+}
+}
+return out;
+};
+instance.base64Encode=function(v){
+var b=instance.toUint8Array(v),
+s="";
+for(var i=0;i<b.length;i++){
+s+=String.fromCharCode(b[i]);
+}
+return btoaFunc(s);
+};
+instance.base64Decode=function(str){
+var s=atobFunc(str),
+b=new Uint8Array(s.length);
+for(var i=0;i<s.length;i++){
+b[i]=s.charCodeAt(i);
+}
+return b.buffer;
+};
+instance.clientID=function(key){
+var id=Math.random().toString(36).slice(2,12)+Math.random().toString(36).slice(2,12);
+try{
+var stored=sessionStorage.getItem(key);
+if(stored){
+return stored;
+}
+sessionStorage.setItem(key,id);
+}catch(e){
+}
+return id;
+};
+return instance;
+})();
+var channel=(function(){
+var instance={},
+channels={};
+var newChannel=function(name){
+var channel={
+onMessageFunc:function(){},
+requests:[],
+iterators:[],
+listeners:[],
+json:options.json===true,
+ttl:0,
+reliable:false,
+seen:{},
+seenOrder:[]
+};
+channel.instance={
+onMessage:function(f){
+channel.onMessageFunc=f;
+},
+subscribe:function(f){
+channel.listeners.push(f);
+return function(){
+var i=channel.listeners.indexOf(f);
+if(i>=0){
+channel.listeners.splice(i,1);
+}
+};
+},
+send:function(data,discardCallback,opts){
+var ttl=(opts&&opts.ttl!==undefined)?opts.ttl:channel.ttl;
+if(channel.json&&!utils.isBinary(data)){
+var value=data;
+data=JSON.stringify(value);
+if(discardCallback&&utils.isFunction(discardCallback)){
+var f=discardCallback;
+discardCallback=function(){
+f(value);
+};
+}
+}
+if(!data){
+return-1;
+}
+if(utils.isBlob(data)){
+utils.readBlob(data,function(buf){
+sendBufferedBinary(name,buf,discardCallback,ttl);
+});
+return 0;
+}
+if(utils.isBinary(data)){
+return sendBufferedBinary(name,data,discardCallback,ttl);
+}
+if(channel.reliable){
+return sendReliable(name,data,opts&&opts.id);
+}
+return sendBuffered(Commands.ChannelData,utils.marshalValues(name,data),discardCallback,ttl);
+},
+request:function(data,opts){
+return new Promise(function(resolve,reject){
+var stopWatch;
+var r={
+resolve:function(v){
+stopWatch();
+resolve(v);
+},
+reject:reject
+};
+var discard=function(){
+stopWatch();
+removeRequest(channel,r);
+reject(new Error("glue: channel '"+name+"': request data discarded"));
+};
+var canceled=false;
+stopWatch=utils.watchCancel(opts,"channel '"+name+"': request",function(err){
+canceled=true;
+r.resolve=function(){};
+reject(err);
+});
+if(canceled){
+return;
+}
+channel.requests.push(r);
+if(channel.instance.send(data,discard)<0){
+discard();
+}
+});
+}
+};
+if(typeof Symbol!=="undefined"&&Symbol.asyncIterator){
+channel.instance[Symbol.asyncIterator]=function(){
+return newIterator(channel);
+};
+}
+return channel;
+};
+var removeRequest=function(channel,r){
+var i=channel.requests.indexOf(r);
+if(i>=0){
+channel.requests.splice(i,1);
+}
+};
+var newIterator=function(channel){
+var it={
+queue:[],
+waiting:[]
+};
+it.push=function(data){
+if(it.waiting.length>0){
+it.waiting.shift()({value:data,done:false});
+return;
+}
+it.queue.push(data);
+};
+channel.iterators.push(it);
+return{
+next:function(){
+if(it.queue.length>0){
+return Promise.resolve({value:it.queue.shift(),done:false});
+}
+if(it.done){
+return Promise.resolve({value:undefined,done:true});
+}
+return new Promise(function(resolve){
+it.waiting.push(resolve);
+});
+},
+return:function(){
+it.done=true;
+it.queue=[];
+var i=channel.iterators.indexOf(it);
+if(i>=0){
+channel.iterators.splice(i,1);
+}
+while(it.waiting.length>0){
+it.waiting.shift()({value:undefined,done:true});
+}
+return Promise.resolve({value:undefined,done:true});
+}
+};
+};
+instance.get=function(name,opts){
+if(!name){
+return false;
+}
+var c=channels[name];
+if(!c){
+c=newChannel(name);
+channels[name]=c;
+}
+if(opts&&opts.json!==undefined){
+c.json=opts.json===true;
+}
+if(opts&&opts.ttl!==undefined){
+c.ttl=opts.ttl;
+}
+if(opts&&opts.reliable!==undefined){
+c.reliable=opts.reliable===true;
+}
+return c.instance;
+};
+instance.emitOnMessage=function(name,data,id){
+if(!name||!data){
+return false;
+}
+var c=channels[name];
+if(!c){
+console.log("glue: channel '"+name+"': emit onMessage event: channel does not exists");
+return false;
+}
+if(id!==undefined){
+if(c.seen.hasOwnProperty(id)){
+return true;
+}
+c.seen[id]=true;
+c.seenOrder.push(id);
+while(c.seenOrder.length>options.dedupWindow){
+delete c.seen[c.seenOrder.shift()];
+}
+}
+if(c.json&&typeof data==="string"){
+try{
+data=JSON.parse(data);
+}
+catch(err){
+console.log("glue: channel '"+name+"': failed to decode JSON message: "+err.message);
+return true;
+}
+}
+if(c.requests.length>0){
+c.requests.shift().resolve(data);
+return true;
+}
+var i;
+for(i=0;i<c.iterators.length;i++){
+c.iterators[i].push(data);
+}
+var listeners=c.listeners.slice(0);
+for(i=0;i<listeners.length;i++){
+try{
+listeners[i](data,id);
+}
+catch(err){
+console.log("glue: channel '"+name+"': subscribed listener call failed: "+err.message);
+}
+}
+try{
+c.onMessageFunc(data,id);
+}
+catch(err){
+console.log("glue: channel '"+name+"': onMessage event call failed: "+err.message);
+}
+return true;
+};
+return instance;
+})();
+var reconnect,triggerEvent;
+var setState=function(state,info){
+currentState=state;
+currentStateInfo=utils.extend({state:state},info);
+triggerEvent(state,utils.extend({},currentStateInfo));
+triggerEvent("statechange",utils.extend({},currentStateInfo));
+};
+send=function(data){
+if(!bs){
+return;
+}
+if(!isReady){
+beforeReadySendBuffer.push(data);
+return;
+}
+bs.send(data);
+};
+var sendCmd=function(cmd,data){
+if(cmd!==Commands.ChannelBinaryData){
+send(cmd+data);
+return;
+}
+if(bs&&bs.binary){
+send(utils.marshalBinary(cmd,data.name,data.data));
+}else{
+send(cmd+utils.marshalValues(data.name,utils.base64Encode(data.data)));
+}
+};
+var discardData=function(cmd,data){
+if(cmd===Commands.ChannelBinaryData){
+return data.data;
+}
+if(cmd===Commands.ChannelData){
+var v=utils.unmarshalValues(data);
+if(v){
+return v.second;
+}
+}
+return data;
+};
+var routingQuery=function(){
+if(!routing){
+return"";
+}
+return"?"+encodeURIComponent(routing.name)+"="+encodeURIComponent(routing.key);
+};
+var binaryData=function(buf){
+if(options.binaryType==="blob"){
+return new Blob([buf]);
+}
+return buf;
+};
+var handleReceiptData=function(data){
+var v=utils.unmarshalValues(data),
+m=v?utils.unmarshalValues(v.second):false;
+if(!m){
+console.log("glue: server requested an invalid receipt request: "+data);
+return;
+}
+channel.emitOnMessage(m.first,m.second);
+send(Commands.ChannelData+utils.marshalValues(ReceiptChannelName,v.first));
+};
+var sendReliableRequest=function(t,data){
+send(Commands.ChannelData+utils.marshalValues(ReliableChannelName,t+data));
+};
+var sendReliableMessage=function(m){
+sendReliableRequest(ReliableRequests.Message,utils.marshalValues(m.id,
+utils.marshalValues(String(m.time),utils.marshalValues(m.name,m.data))));
+};
+sendReliable=function(name,data,id){
+reliableCount++;
+var m={
+id:id?String(id):reliablePrefix+"-"+reliableCount,
+time:Date.now(),
+name:name,
+data:data
+};
+reliablePending.push(m);
+if(!bs||currentState!==States.Connected){
+return 0;
+}
+sendReliableMessage(m);
+return 1;
+};
+var resendReliable=function(){
+for(var i=0;i<reliablePending.length;i++){
+sendReliableMessage(reliablePending[i]);
+}
+};
+var handleReliableData=function(data){
+var t=data.charAt(0),
+v=utils.unmarshalValues(data.substr(1)),
+m=v?utils.unmarshalValues(v.second):false;
+if(t===ReliableRequests.Ack&&v){
+for(var i=0;i<reliablePending.length;i++){
+if(reliablePending[i].id===v.second){
+reliablePending.splice(i,1);
+break;
+}
+}
+return;
+}
+if(t!==ReliableRequests.Message||!m){
+console.log("glue: server send an invalid reliable channel request: "+data);
+return;
+}
+if(!channel.emitOnMessage(m.first,m.second,v.first)){
+return;
+}
+sendReliableRequest(ReliableRequests.Ack,utils.marshalValues(m.first,v.first));
+};
+var sendClockData=function(data){
+send(Commands.ChannelData+utils.marshalValues(ClockChannelName,data));
+};
+var startClockSync=function(){
+if(!(options.clockSyncSamples>0)){
+return;
+}
+clockSamples=[];
+sendClockData(ClockMessages.Sample+String(Date.now()));
+};
+var handleClockData=function(data){
+if(data.charAt(0)!==ClockMessages.Sample){
+console.log("glue: received invalid clock data: "+data);
+return;
+}
+var v=utils.unmarshalValues(data.substr(1)),
+now=Date.now();
+if(!v){
+console.log("glue: received invalid clock data: "+data);
+return;
+}
+var sent=parseInt(v.first,10),
+serverTime=parseInt(v.second,10);
+if(isNaN(sent)||isNaN(serverTime)){
+console.log("glue: received invalid clock data: "+data);
+return;
+}
+clockSamples.push({
+rtt:now-sent,
+offset:serverTime+(now-sent)/2-now
+});
+if(clockSamples.length<options.clockSyncSamples){
+sendClockData(ClockMessages.Sample+String(Date.now()));
+return;
+}
+var best=clockSamples[0];
+for(var i=1;i<clockSamples.length;i++){
+if(clockSamples[i].rtt<best.rtt){
+best=clockSamples[i];
+}
+}
+clockSamples=[];
+clockOffset=Math.round(best.offset);
+sendClockData(ClockMessages.Offset+String(clockOffset));
+triggerEvent("clock_sync",clockOffset);
+};
+var sendTopicRequest=function(type,name){
+if(currentState!==States.Connected){
+return;
+}
+send(Commands.ChannelData+utils.marshalValues(TopicChannelName,type+name));
+};
+var resubscribeTopics=function(){
+for(var name in topics){
+if(topics.hasOwnProperty(name)){
+sendTopicRequest(TopicRequests.Subscribe,name);
+}
+}
+};
+var sendBeforeReadyBufferedData=function(){
+if(beforeReadySendBuffer.length===0){
+return;
+}
+for(var i=0;i<beforeReadySendBuffer.length;i++){
+send(beforeReadySendBuffer[i]);
+}
+beforeReadySendBuffer=[];
+};
+var stopResetSendBufferTimeout=function(){
+resetSendBufferTimedOut=false;
+if(resetSendBufferTimeout!==false){
+clearTimeout(resetSendBufferTimeout);
+resetSendBufferTimeout=false;
+}
+};
+var startResetSendBufferTimeout=function(){
+if(resetSendBufferTimeout!==false||resetSendBufferTimedOut){
+return;
+}
+resetSendBufferTimeout=setTimeout(function(){
+resetSendBufferTimeout=false;
+resetSendBufferTimedOut=true;
+if(sendBuffer.length===0){
+return;
+}
+var buf;
+for(var i=0;i<sendBuffer.length;i++){
+buf=sendBuffer[i];
+if(buf.discardCallback&&utils.isFunction(buf.discardCallback)){
+try{
+buf.discardCallback(discardData(buf.cmd,buf.data));
+}
+catch(err){
+console.log("glue: failed to call discard callback: "+err.message);
+}
+}
+}
+triggerEvent("discard_send_buffer");
+sendBuffer=[];
+},options.resetSendBufferTimeout);
+};
+var dataSize=function(cmd,data){
+if(cmd===Commands.ChannelBinaryData){
+return data.data.byteLength;
+}
+return utils.encodeUTF8(data).length;
+};
+var dropFromOfflineQueue=function(reason,index){
+var buf=sendBuffer.splice(index||0,1)[0];
+sendBufferBytes-=buf.size;
+var data=discardData(buf.cmd,buf.data);
+if(buf.discardCallback&&utils.isFunction(buf.discardCallback)){
+try{
+buf.discardCallback(data);
+}
+catch(err){
+console.log("glue: failed to call discard callback: "+err.message);
+}
+}
+if(utils.isFunction(options.offlineQueue.onDrop)){
+try{
+options.offlineQueue.onDrop(data,reason);
+}
+catch(err){
+console.log("glue: failed to call offline queue drop callback: "+err.message);
+}
+}
+};
+var expireOfflineQueue=function(){
+if(resetSendBufferTimeout!==false){
+clearTimeout(resetSendBufferTimeout);
+resetSendBufferTimeout=false;
+}
+var now=Date.now(),
+next=0,
+expires;
+for(var i=0;i<sendBuffer.length;){
+expires=sendBuffer[i].expires;
+if(expires>0&&expires<=now){
+dropFromOfflineQueue(DropReasons.Expired,i);
+continue;
+}
+if(expires>0&&(next===0||expires<next)){
+next=expires;
+}
+i++;
+}
+if(next===0){
+return;
+}
+if(resetSendBufferTimeout!==false){
+clearTimeout(resetSendBufferTimeout);
+}
+resetSendBufferTimeout=setTimeout(expireOfflineQueue,next-now);
+};
+var expiryTime=function(ttl){
+return(ttl>0)?Date.now()+ttl:0;
+};
+var addToOfflineQueue=function(cmd,data,discardCallback,ttl){
+var size=dataSize(cmd,data),
+o=options.offlineQueue;
+if((o.maxBytes>0&&size>o.maxBytes)||!(o.maxCount>0)){
+if(discardCallback&&utils.isFunction(discardCallback)){
+discardCallback(discardData(cmd,data));
+}
+if(utils.isFunction(o.onDrop)){
+o.onDrop(discardData(cmd,data),o.maxCount>0?DropReasons.MaxBytes:DropReasons.MaxCount);
+}
+return-1;
+}
+if(o.ttl>0&&!(ttl>0&&ttl<o.ttl)){
+ttl=o.ttl;
+}
+var expires=expiryTime(ttl);
+sendBuffer.push({
+cmd:cmd,
+data:data,
+discardCallback:discardCallback,
+size:size,
+expires:expires
+});
+sendBufferBytes+=size;
+while(sendBuffer.length>o.maxCount){
+dropFromOfflineQueue(DropReasons.MaxCount);
+}
+while(o.maxBytes>0&&sendBufferBytes>o.maxBytes){
+dropFromOfflineQueue(DropReasons.MaxBytes);
+}
+if(expires>0){
+expireOfflineQueue();
+}
+return 0;
+};
+var sendDataFromSendBuffer=function(){
+stopResetSendBufferTimeout();
+if(options.offlineQueue){
+expireOfflineQueue();
+stopResetSendBufferTimeout();
+}
+if(sendBuffer.length===0){
+return;
+}
+var buffer=sendBuffer,
+now=Date.now(),
+buf;
+sendBuffer=[];
+sendBufferBytes=0;
+for(var i=0;i<buffer.length;i++){
+buf=buffer[i];
+if(buf.expires>0&&buf.expires<=now){
+if(buf.discardCallback&&utils.isFunction(buf.discardCallback)){
+try{
+buf.discardCallback(discardData(buf.cmd,buf.data));
+}
+catch(err){
+console.log("glue: failed to call discard callback: "+err.message);
+}
+}
+continue;
+}
+sendCmd(buf.cmd,buf.data);
+}
+};
+sendBuffered=function(cmd,data,discardCallback,ttl){
+if(!data){
+data="";
+}
+if(!bs||currentState!==States.Connected){
+if(options.offlineQueue){
+return addToOfflineQueue(cmd,data,discardCallback,ttl);
+}
+if(resetSendBufferTimedOut){
+if(discardCallback&&utils.isFunction(discardCallback)){
+discardCallback(discardData(cmd,data));
+}
+return-1;
+}
+startResetSendBufferTimeout();
+sendBuffer.push({
+cmd:cmd,
+data:data,
+discardCallback:discardCallback,
+expires:expiryTime(ttl)
+});
+return 0;
+}
+sendCmd(cmd,data);
+return 1;
+};
+sendBufferedBinary=function(name,data,discardCallback,ttl){
+return sendBuffered(Commands.ChannelBinaryData,{
+name:name,
+data:data
+},discardCallback,ttl);
+};
+var stopConnectTimeout=function(){
+if(connectTimeout!==false){
+clearTimeout(connectTimeout);
+connectTimeout=false;
+}
+};
+var resetConnectTimeout=function(){
+stopConnectTimeout();
+connectTimeout=setTimeout(function(){
+connectTimeout=false;
+triggerEvent("connect_timeout");
+reconnect();
+},options.connectTimeout);
+};
+var stopPingTimeout=function(){
+if(pingTimeout!==false){
+clearTimeout(pingTimeout);
+pingTimeout=false;
+}
+if(pingReconnectTimeout!==false){
+clearTimeout(pingReconnectTimeout);
+pingReconnectTimeout=false;
+}
+};
+var checkConnection=function(){
+stopPingTimeout();
+send(Commands.Ping);
+pingReconnectTimeout=setTimeout(function(){
+pingReconnectTimeout=false;
+triggerEvent("timeout");
+reconnect();
+},options.pingReconnectTimeout);
+};
+var resetPingTimeout=function(){
+stopPingTimeout();
+if(nativeKeepalive){
+return;
+}
+pingTimeout=setTimeout(function(){
+pingTimeout=false;
+checkConnection();
+},options.pingInterval);
+};
+var onAppStateChange=function(state){
+if(state==="background"){
+stopPingTimeout();
+}
+else if(state==="active"){
+if(currentState===States.Connected){
+checkConnection();
+}
+else if(currentState===States.Disconnected&&options.reconnect!==false&&!autoReconnectDisabled){
+reconnectCount=0;
+reconnect();
+}
+}
+};
+var newBackendSocket=function(){
+if(options.muxTransport){
+bsNewFunc=newMuxSocket;
+bs=bsNewFunc();
+currentSocketType=SocketTypes.MuxSocket;
+return;
+}
+if(initialConnectedOnce){
+bs=bsNewFunc();
+return;
+}
+if(options.forceSocketType===SocketTypes.SockJSSocket){
+bsNewFunc=newSockJSSocket;
+bs=bsNewFunc();
+currentSocketType=SocketTypes.SockJSSocket;
+return;
+}
+if(options.forceSocketType===SocketTypes.EngineIOSocket){
+bsNewFunc=newEngineIOSocket;
+bs=bsNewFunc();
+currentSocketType=SocketTypes.EngineIOSocket;
+return;
+}
+if(reconnectCount>1){
+bsNewFunc=newAjaxSocket;
+bs=bsNewFunc();
+currentSocketType=SocketTypes.AjaxSocket;
+return;
+}
+if((!options.forceSocketType&&env.WebSocket)||
+options.forceSocketType===SocketTypes.WebSocket)
+{
+bsNewFunc=newWebSocket;
+currentSocketType=SocketTypes.WebSocket;
+}
+else
+{
+bsNewFunc=newAjaxSocket;
+currentSocketType=SocketTypes.AjaxSocket;
+}
+bs=bsNewFunc();
+};
+var handleReject=function(data){
+var r={};
+try{
+r=JSON.parse(data);
+}
+catch(err){}
+rejection={
+code:r.code||"",
+message:r.message||"",
+retry:!!r.retry
+};
+if(!rejection.retry){
+autoReconnectDisabled=true;
+}
+console.log("glue: server rejected the connection: "+rejection.code+": "+rejection.message);
+if(rejection.code==="server_full"){
+setNearCapacity(true);
+}
+triggerEvent("rejected",utils.extend({},rejection));
+};
+var setNearCapacity=function(near){
+if(nearCapacity===near){
+return;
+}
+nearCapacity=near;
+triggerEvent("capacity",near);
+};
+var initSocket=function(data){
+data=JSON.parse(data);
+if(!data.socketID){
+closeSocket();
+console.log("glue: socket initialization failed: invalid initialization data received");
+return;
+}
+socketID=data.socketID;
+rejection=false;
+if(data.nativeKeepalive){
+nativeKeepalive=true;
+stopPingTimeout();
+}
+setNearCapacity(!!data.nearCapacity);
+if(data.ticket){
+ticket=data.ticket;
+}
+if(data.routingName&&data.routingKey){
+routing={
+name:data.routingName,
+key:data.routingKey
+};
+}
+isReady=true;
+sendBeforeReadyBufferedData();
+setState(States.Connected);
+startClockSync();
+resubscribeTopics();
+resendReliable();
+setTimeout(sendDataFromSendBuffer,0);
+};
+var connectSocket=function(){
+newBackendSocket();
+bs.onOpen=function(){
+stopConnectTimeout();
+reconnectCount=0;
+initialConnectedOnce=true;
+nativeKeepalive=false;
+resetPingTimeout();
+var data={
+version:Version,
+reject:true
+};
+if(options.muxCarrier){
+data.mux=true;
+}
+if(options.namespace){
+data.namespace=options.namespace;
+}
+if(options.auth){
+data.auth=options.auth;
+}
+if(options.handshake){
+data.payload=options.handshake;
+}
+if(ticket){
+data.ticket=ticket;
+ticket="";
+}
+data.client=clientID;
+data=JSON.stringify(data);
+bs.send(Commands.Init+data);
+};
+bs.onClose=function(){
+reconnect();
+};
+bs.onError=function(msg){
+triggerEvent("error",[msg]);
+reconnect();
+};
+bs.onMessage=function(data){
+resetPingTimeout();
+if(typeof data!=="string"){
+var b=utils.unmarshalBinary(data,Commands.Len);
+if(!b||b.cmd!==Commands.ChannelBinaryData){
+console.log("glue: received invalid binary data from server.");
+return;
+}
+channel.emitOnMessage(b.first,binaryData(b.second));
+return;
+}
+if(data.length<Commands.Len){
+console.log("glue: received invalid data from server: data is too short.");
+return;
+}
+var cmd=data.substr(0,Commands.Len);
+data=data.substr(Commands.Len);
+if(cmd===Commands.Ping){
+send(Commands.Pong);
+}
+else if(cmd===Commands.Pong){
+}
+else if(cmd===Commands.Invalid){
+console.log("glue: server replied with an invalid request notification!");
+}
+else if(cmd===Commands.DontAutoReconnect){
+autoReconnectDisabled=true;
+console.log("glue: server replied with an don't automatically reconnect request. This might be due to an incompatible protocol version.");
+}
+else if(cmd===Commands.Reject){
+handleReject(data);
+}
+else if(cmd===Commands.Close){
+send(Commands.Close);
+reconnect();
+}
+else if(cmd===Commands.Reconnect){
+send(Commands.Close);
+resetSocket();
+reconnectCount=1;
+connectSocket();
+}
+else if(cmd===Commands.GoingAway){
+triggerEvent("going_away",parseInt(data,10)||0);
+}
+else if(cmd===Commands.IdleWarning){
+triggerEvent("idle_warning",parseInt(data,10)||0);
+}
+else if(cmd===Commands.Init){
+initSocket(data);
+}
+else if(cmd===Commands.ChannelData){
+var v=utils.unmarshalValues(data);
+if(!v){
+console.log("glue: server requested an invalid channel data request: "+data);
+return;
+}
+if(v.first===ClockChannelName){
+handleClockData(v.second);
+return;
+}
+if(v.first===ReceiptChannelName){
+handleReceiptData(v.second);
+return;
+}
+if(v.first===ReliableChannelName){
+handleReliableData(v.second);
+return;
+}
+if(v.first===MaintenanceChannelName){
+triggerEvent("maintenance",v.second);
+return;
+}
+if(v.first===CapacityChannelName){
+setNearCapacity(v.second==="1");
+return;
+}
+channel.emitOnMessage(v.first,v.second);
+}
+else if(cmd===Commands.ChannelBinaryData){
+var bv=utils.unmarshalValues(data);
+if(!bv){
+console.log("glue: server requested an invalid channel data request: "+data);
+return;
+}
+channel.emitOnMessage(bv.first,binaryData(utils.base64Decode(bv.second)));
+}
+else{
+console.log("glue: received invalid data from server with command '"+cmd+"' and data '"+data+"'!");
+}
+};
+setTimeout(function(){
+if(reconnectCount>0){
+setState(States.Reconnecting,{attempt:reconnectCount});
+}
+else{
+setState(States.Connecting);
+}
+resetConnectTimeout();
+bs.open();
+},0);
+};
+var resetSocket=function(){
+stopConnectTimeout();
+stopPingTimeout();
+isReady=false;
+socketID="";
+beforeReadySendBuffer=[];
+if(bs){
+bs.onOpen=bs.onClose=bs.onMessage=bs.onError=function(){};
+bs.reset();
+bs=false;
+}
+};
+reconnect=function(){
+resetSocket();
+if((options.reconnectAttempts>0&&reconnectCount>=options.reconnectAttempts)||
+options.reconnect===false||autoReconnectDisabled)
+{
+var reason=DisconnectReasons.MaxAttempts,
+info={};
+if(autoReconnectDisabled&&rejection){
+reason=DisconnectReasons.Rejected;
+}else if(autoReconnectDisabled){
+reason=DisconnectReasons.ServerRequest;
+}else if(options.reconnect===false){
+reason=DisconnectReasons.ReconnectDisabled;
+}
+info.reason=reason;
+if(rejection){
+info.rejection=utils.extend({},rejection);
+}
+setState(States.Disconnected,info);
+return;
+}
+reconnectCount+=1;
+var reconnectDelay;
+if(options.reconnectDelayMultiplier>0){
+reconnectDelay=options.reconnectDelay*Math.pow(options.reconnectDelayMultiplier,reconnectCount-1);
+}else{
+reconnectDelay=options.reconnectDelay*reconnectCount;
+}
+if(reconnectDelay>options.reconnectDelayMax){
+reconnectDelay=options.reconnectDelayMax;
+}
+if(nearCapacity){
+reconnectDelay=options.reconnectDelayMax;
+}
+if(options.reconnectJitter){
+reconnectDelay=Math.floor(Math.random()*reconnectDelay);
+}
+setState(States.Waiting,{
+attempt:reconnectCount,
+retryIn:reconnectDelay
+});
+reconnectTimeout=setTimeout(function(){
+reconnectTimeout=false;
+connectSocket();
+},reconnectDelay);
+};
+var stopReconnectTimeout=function(){
+if(reconnectTimeout!==false){
+clearTimeout(reconnectTimeout);
+reconnectTimeout=false;
+}
+};
+closeSocket=function(){
+if(!bs&&reconnectTimeout===false){
+return;
+}
+stopReconnectTimeout();
+send(Commands.Close);
+resetSocket();
+setState(States.Disconnected,{reason:DisconnectReasons.Closed});
+};
+env=utils.extend(env,glue.env);
+if(!host){
+if(!env.location){
+console.log("glue: invalid host: no host passed and no location available!");
+return;
+}
+host=env.location.protocol+"//"+env.location.host;
+}
+if(!host.match("^http://")&&!host.match("^https://")){
+console.log("glue: invalid host: missing 'http://' or 'https://'!");
+return;
+}
+options=utils.extend({},DefaultOptions,options);
+if(options.reconnectDelayMax<options.reconnectDelay){
+options.reconnectDelayMax=options.reconnectDelay;
+}
+if(options.offlineQueue){
+options.offlineQueue=utils.extend({},DefaultOfflineQueueOptions,
+options.offlineQueue===true?{}:options.offlineQueue);
+}
+ticket=options.ticket;
+clientID=options.clientID||utils.clientID("glue.clientID:"+host+"/"+options.namespace);
+mainChannel=channel.get(MainChannelName);
+if(options.baseURL.indexOf("/")!==0){
+options.baseURL="/"+options.baseURL;
+}
+if(options.baseURL.slice(-1)!=="/"){
+options.baseURL=options.baseURL+"/";
+}
+if(options.appState&&options.appState.addEventListener){
+options.appState.addEventListener("change",onAppStateChange);
+}
+connectSocket();
+var socket={
+version:function(){
+return Version;
+},
+type:function(){
+return currentSocketType;
+},
+state:function(){
+return currentState;
+},
+stateInfo:function(){
+return utils.extend({},currentStateInfo);
+},
+clockOffset:function(){
+return clockOffset;
+},
+socketID:function(){
+return socketID;
+},
+send:function(data,discardCallback,opts){
+return mainChannel.send(data,discardCallback,opts);
+},
+onMessage:function(f){
+mainChannel.onMessage(f);
+},
+subscribe:function(f){
+return mainChannel.subscribe(f);
+},
+request:function(data,opts){
+return mainChannel.request(data,opts);
+},
+on:function(){
+emitter.on.apply(emitter,arguments);
+},
+once:function(){
+emitter.once.apply(emitter,arguments);
+},
+off:function(){
+emitter.off.apply(emitter,arguments);
+},
+reconnect:function(){
+if(currentState!==States.Disconnected){
+return;
+}
+reconnectCount=0;
+autoReconnectDisabled=false;
+rejection=false;
+reconnect();
+},
+close:function(){
+closeSocket();
+},
+topic:function(name,opts){
+if(!topics[name]){
+topics[name]=true;
+sendTopicRequest(TopicRequests.Subscribe,name);
+}
+return channel.get(name,opts);
+},
+unsubscribeTopic:function(name){
+if(!topics[name]){
+return;
+}
+delete topics[name];
+sendTopicRequest(TopicRequests.Unsubscribe,name);
+},
+channel:function(name,opts){
+return channel.get(name,opts);
+}
+};
+triggerEvent=function(){
+emitter.emit.apply(emitter,arguments);
+};
+return socket;
+};
+glue.connect=function(host,options){
+'use strict';
+return new Promise(function(resolve,reject){
+var signal=options?options.signal:undefined,
+timeout=false,
+onConnected,onDisconnected,onAbort;
+var newError=function(name,msg){
+var err=new Error(msg);
+err.name=name;
+return err;
+};
+if(signal&&signal.aborted){
+reject(newError("AbortError","glue: connect aborted"));
+return;
+}
+var socket=glue(host,options);
+if(!socket){
+reject(new Error("glue: invalid host"));
+return;
+}
+var stop=function(){
+if(timeout!==false){
+clearTimeout(timeout);
+timeout=false;
+}
+if(signal){
+signal.removeEventListener("abort",onAbort);
+}
+};
+var cancel=function(err){
+stop();
+socket.off("connected",onConnected);
+socket.off("disconnected",onDisconnected);
+socket.close();
+reject(err);
+};
+onAbort=function(){
+cancel(newError("AbortError","glue: connect aborted"));
+};
+if(signal){
+signal.addEventListener("abort",onAbort);
+}
+if(options&&options.timeout>0){
+timeout=setTimeout(function(){
+timeout=false;
+cancel(newError("TimeoutError","glue: connect timed out"));
+},options.timeout);
+}
+onConnected=function(){
+stop();
+socket.off("disconnected",onDisconnected);
+resolve(socket);
+};
+onDisconnected=function(info){
+stop();
+socket.off("connected",onConnected);
+if(info&&info.rejection){
+var err=newError("RejectedError","glue: server rejected the connection: "+info.rejection.message);
+err.code=info.rejection.code;
+reject(err);
+return;
+}
+reject(new Error("glue: failed to connect to the server"));
+};
+socket.once("connected",onConnected);
+socket.once("disconnected",onDisconnected);
+});
+};
+glue.shared=function(workerURL,host,options){
+'use strict';
+function Emitter(obj){
+if(obj)return mixin(obj);
+}
+function mixin(obj){
+for(var key in Emitter.prototype){
+obj[key]=Emitter.prototype[key];
+}
+return obj;
+}
+Emitter.prototype.on=
+Emitter.prototype.addEventListener=function(event,fn){
+this._callbacks=this._callbacks||{};
+(this._callbacks['$'+event]=this._callbacks['$'+event]||[])
+.push(fn);
+return this;
+};
+Emitter.prototype.once=function(event,fn){
+function on(){
+this.off(event,on);
+fn.apply(this,arguments);
+}
+on.fn=fn;
+this.on(event,on);
+return this;
+};
+Emitter.prototype.off=
+Emitter.prototype.removeListener=
+Emitter.prototype.removeAllListeners=
+Emitter.prototype.removeEventListener=function(event,fn){
+this._callbacks=this._callbacks||{};
+if(0===arguments.length){
+this._callbacks={};
+return this;
+}
+var callbacks=this._callbacks['$'+event];
+if(!callbacks)return this;
+if(1==arguments.length){
+delete this._callbacks['$'+event];
+return this;
+}
+var cb;
+for(var i=0;i<callbacks.length;i++){
+cb=callbacks[i];
+if(cb===fn||cb.fn===fn){
+callbacks.splice(i,1);
+break;
+}
+}
+return this;
+};
+Emitter.prototype.emit=function(event){
+this._callbacks=this._callbacks||{};
+var args=[].slice.call(arguments,1),callbacks=this._callbacks['$'+event];
+if(callbacks){
+callbacks=callbacks.slice(0);
+for(var i=0,len=callbacks.length;i<len;++i){
+callbacks[i].apply(this,args);
+}
+}
+return this;
+};
+Emitter.prototype.listeners=function(event){
+this._callbacks=this._callbacks||{};
+return this._callbacks['$'+event]||[];
+};
+Emitter.prototype.hasListeners=function(event){
+return!!this.listeners(event).length;
+};
+if(typeof SharedWorker==="undefined"){
+return glue(host,options);
+}
+if(!host){
+host=window.location.protocol+"//"+window.location.host;
+}
+var emitter=new Emitter,
+worker=new SharedWorker(workerURL),
+port=worker.port,
+state={
+state:"disconnected",
+type:"",
+socketID:"",
+version:"",
+info:{state:"disconnected"},
+clockOffset:0
+},
+channels={},
+discardCallbacks={},
+discardID=0;
+var post=function(msg){
+port.postMessage(msg);
+};
+var getChannel=function(name){
+var c=channels[name];
+if(c){
+return c;
+}
+c={
+onMessageFunc:function(){},
+listeners:[]
+};
+c.instance={
+onMessage:function(f){
+c.onMessageFunc=f;
+},
+subscribe:function(f){
+c.listeners.push(f);
+return function(){
+var i=c.listeners.indexOf(f);
+if(i>=0){
+c.listeners.splice(i,1);
+}
+};
+},
+send:function(data,discardCallback,opts){
+if(!data){
+return-1;
+}
+var id=0;
+if(discardCallback){
+id=++discardID;
+discardCallbacks[id]=discardCallback;
+}
+post({type:"send",channel:name,data:data,id:id,ttl:opts&&opts.ttl});
+return(state.state==="connected")?1:0;
+}
+};
+channels[name]=c;
+post({type:"channel",channel:name});
+return c;
+};
+var onMessage=function(msg){
+var i,c;
+switch(msg.type){
+case"state":
+state=msg.state;
+break;
+case"event":
+emitter.emit.apply(emitter,[msg.name].concat(msg.args||[]));
+break;
+case"message":
+c=channels[msg.channel];
+if(!c){
+return;
+}
+for(i=0;i<c.listeners.length;i++){
+c.listeners[i](msg.data);
+}
+try{
+c.onMessageFunc(msg.data);
+}
+catch(err){
+console.log("glue: channel '"+msg.channel+"': onMessage event call failed: "+err.message);
+}
+break;
+case"discard":
+if(discardCallbacks[msg.id]){
+discardCallbacks[msg.id](msg.data);
+}
+break;
+case"sent":
+delete discardCallbacks[msg.id];
+break;
+}
+};
+port.onmessage=function(e){
+onMessage(e.data);
+};
+port.start();
+post({type:"attach",host:host,options:options});
+window.addEventListener("pagehide",function(){
+post({type:"detach"});
+});
+var mainChannel=getChannel("m").instance;
+return{
+version:function(){
+return state.version;
+},
+type:function(){
+return state.type;
+},
+state:function(){
+return state.state;
+},
+stateInfo:function(){
+return state.info;
+},
+clockOffset:function(){
+return state.clockOffset;
+},
+socketID:function(){
+return state.socketID;
+},
+send:function(data,discardCallback,opts){
+return mainChannel.send(data,discardCallback,opts);
+},
+onMessage:function(f){
+mainChannel.onMessage(f);
+},
+subscribe:function(f){
+return mainChannel.subscribe(f);
+},
+on:function(){
+emitter.on.apply(emitter,arguments);
+},
+once:function(){
+emitter.once.apply(emitter,arguments);
+},
+off:function(){
+emitter.off.apply(emitter,arguments);
+},
+reconnect:function(){
+post({type:"reconnect"});
+},
+close:function(){
+post({type:"detach"});
+},
+channel:function(name){
+if(!name){
+return false;
+}
+return getChannel(name).instance;
+},
+topic:function(name){
+if(!name){
+return false;
+}
+var c=getChannel(name).instance;
+post({type:"topic",channel:name});
+return c;
+},
+unsubscribeTopic:function(){}
+};
+};
+glue.mux=function(host,options){
+'use strict';
+var MuxChannelName="_mux",
+Delimiter="&";
+var FrameTypes={
+Data:"d",
+Close:"c"
+};
+var sockets={},
+pending=[],
+idCount=0,
+logical=[],
+carrier,
+muxChannel;
+var extend=function(dst){
+for(var i=1;i<arguments.length;i++){
+for(var key in arguments[i]){
+if(arguments[i]&&arguments[i].hasOwnProperty(key)){
+dst[key]=arguments[i][key];
+}
+}
+}
+return dst;
+};
+var sendFrame=function(type,id,data){
+muxChannel.send(type+String(id.length)+Delimiter+id+data);
+};
+var openSocket=function(bs,id){
+sockets[id]=bs;
+setTimeout(function(){
+if(sockets[id]===bs){
+bs.onOpen();
+}
+},0);
+};
+var transport={
+open:function(bs){
+idCount+=1;
+var id=String(idCount);
+if(carrier.state()==="connected"){
+openSocket(bs,id);
+}else{
+pending.push({bs:bs,id:id});
+}
+return id;
+},
+send:function(id,data){
+if(sockets[id]){
+sendFrame(FrameTypes.Data,id,data);
+}
+},
+close:function(id){
+for(var i=0;i<pending.length;i++){
+if(pending[i].id===id){
+pending.splice(i,1);
+return;
+}
+}
+if(!sockets[id]){
+return;
+}
+delete sockets[id];
+sendFrame(FrameTypes.Close,id,"");
+}
+};
+var onFrame=function(frame){
+var type=frame.charAt(0),
+data=frame.substr(1),
+pos=data.indexOf(Delimiter),
+len=parseInt(data.substring(0,pos),10);
+if(pos<0||isNaN(len)){
+console.log("glue: mux: received invalid frame");
+return;
+}
+var id=data.substr(pos+1,len),
+bs=sockets[id];
+data=data.substr(pos+1+len);
+if(!bs){
+return;
+}
+if(type===FrameTypes.Data){
+bs.onMessage(data);
+}else if(type===FrameTypes.Close){
+delete sockets[id];
+bs.onClose();
+}
+};
+var onCarrierState=function(info){
+var id;
+if(info.state==="connected"){
+var p=pending;
+pending=[];
+for(var i=0;i<p.length;i++){
+openSocket(p[i].bs,p[i].id);
+}
+return;
+}
+var s=sockets;
+sockets={};
+for(id in s){
+if(s.hasOwnProperty(id)){
+s[id].onClose();
+}
+}
+};
+carrier=glue(host,extend({},options,{
+muxCarrier:true,
+clockSyncSamples:0,
+offlineQueue:false
+}));
+if(!carrier){
+return;
+}
+muxChannel=carrier.channel(MuxChannelName,{json:false});
+muxChannel.onMessage(onFrame);
+carrier.on("statechange",onCarrierState);
+return{
+carrier:function(){
+return carrier;
+},
+socket:function(opts){
+var socket=glue(host,extend({},options,opts,{
+muxTransport:transport
+}));
+if(socket){
+logical.push(socket);
+}
+return socket;
+},
+close:function(){
+for(var i=0;i<logical.length;i++){
+logical[i].close();
+}
+logical=[];
+carrier.close();
+}
+};
+};
+(function(){
+'use strict';
+var Events=[
+"connected","connecting","disconnected","reconnecting","waiting","statechange",
+"error","connect_timeout","timeout","discard_send_buffer","clock_sync",
+"rejected","maintenance","going_away",
+"idle_warning","capacity"
+];
+var shared={};
+var broadcast=function(s,msg){
+for(var i=0;i<s.ports.length;i++){
+s.ports[i].postMessage(msg);
+}
+};
+var stateOf=function(s){
+return{
+type:"state",
+state:{
+state:s.socket.state(),
+type:s.socket.type()||"",
+socketID:s.socket.socketID(),
+version:s.socket.version(),
+info:s.socket.stateInfo(),
+clockOffset:s.socket.clockOffset()
+}
+};
+};
+var newShared=function(key,host,options){
+var socket=glue(host,options);
+if(!socket){
+return false;
+}
+var s={
+key:key,
+socket:socket,
+ports:[],
+channels:{}
+};
+Events.forEach(function(name){
+socket.on(name,function(){
+broadcast(s,stateOf(s));
+broadcast(s,{
+type:"event",
+name:name,
+args:Array.prototype.slice.call(arguments)
+});
+});
+});
+shared[key]=s;
+return s;
+};
+var forwardChannel=function(s,name){
+if(s.channels[name]){
+return;
+}
+s.channels[name]=s.socket.channel(name).subscribe(function(data){
+broadcast(s,{type:"message",channel:name,data:data});
+});
+};
+var detach=function(s,port){
+var i=s.ports.indexOf(port);
+if(i<0){
+return;
+}
+s.ports.splice(i,1);
+if(s.ports.length===0){
+s.socket.close();
+delete shared[s.key];
+}
+};
+var onConnect=function(port){
+var s=false;
+port.onmessage=function(e){
+var msg=e.data;
+if(msg.type==="attach"){
+var key=msg.host+"|"+JSON.stringify(msg.options||{});
+s=shared[key]||newShared(key,msg.host,msg.options);
+if(!s){
+return;
+}
+s.ports.push(port);
+port.postMessage(stateOf(s));
+if(s.socket.state()==="connected"){
+port.postMessage({type:"event",name:"connected",args:[]});
+}
+return;
+}
+if(!s){
+return;
+}
+switch(msg.type){
+case"detach":
+detach(s,port);
+s=false;
+break;
+case"reconnect":
+s.socket.reconnect();
+break;
+case"channel":
+forwardChannel(s,msg.channel);
+break;
+case"topic":
+s.socket.topic(msg.channel);
+forwardChannel(s,msg.channel);
+break;
+case"send":
+var r=s.socket.channel(msg.channel).send(msg.data,function(data){
+if(msg.id){
+port.postMessage({type:"discard",id:msg.id,data:data});
+}
+},{ttl:msg.ttl});
+if(r===1&&msg.id){
+port.postMessage({type:"sent",id:msg.id});
+}
+break;
+}
+};
+port.start();
+};
+self.onconnect=function(e){
+onConnect(e.ports[0]);
+};
+})();
+//# sourceMappingURL=glue-sharedworker.js.map
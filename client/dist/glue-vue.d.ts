@@ -0,0 +1,43 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Type definitions for the optional glue Vue 3 plugin.
+
+/// <reference path="glue.d.ts" />
+
+import { App, Ref } from "vue";
+
+export interface GlueContext {
+    socket: glue.Socket;
+    state: Readonly<Ref<glue.State>>;
+}
+
+export interface ChannelContext {
+    channel: glue.Channel;
+    message: Readonly<Ref<glue.MessageData | null>>;
+    send: glue.Channel["send"];
+}
+
+// createGlue creates the Vue plugin.
+export declare function createGlue(host?: string, options?: glue.Options): { install(app: App): void };
+
+// useGlue returns the provided socket and the connection state.
+export declare function useGlue(): GlueContext;
+
+// useChannel returns the channel and a ref holding the last received message.
+export declare function useChannel(name: string): ChannelContext;
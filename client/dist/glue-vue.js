@@ -0,0 +1,105 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  Optional Vue 3 plugin for the glue socket.
+ *  This ES module is not part of the glue library bundle.
+ */
+
+import { inject, onUnmounted, readonly, ref, shallowRef } from "vue";
+import glue from "./glue.esm.js";
+
+
+
+/*
+ * Constants
+ */
+
+var GlueKey = typeof Symbol !== "undefined" ? Symbol("glue") : "glue";
+
+var StateEvents = ["connecting", "connected", "reconnecting", "waiting", "disconnected"];
+
+
+
+/*
+ * Public Methods
+ */
+
+// createGlue creates the Vue plugin. The socket is created and connected
+// as soon as the plugin is installed. It is provided to all components.
+// Usage: app.use(createGlue(host, options));
+export var createGlue = function(host, options) {
+    return {
+        install: function(app) {
+            var socket = glue(host, options);
+            if (!socket) {
+                throw new Error("glue: vue: failed to create socket");
+            }
+
+            // Keep the connection state in sync.
+            var state = ref(socket.state());
+            var updateState = function() {
+                state.value = socket.state();
+            };
+            for (var i = 0; i < StateEvents.length; i++) {
+                socket.on(StateEvents[i], updateState);
+            }
+
+            app.provide(GlueKey, {
+                socket: socket,
+                state:  readonly(state)
+            });
+
+            // Access the socket with this.$glue in the options API.
+            app.config.globalProperties.$glue = socket;
+        }
+    };
+};
+
+// useGlue returns an object with the provided socket and the
+// readonly connection state ref: { socket, state }.
+export var useGlue = function() {
+    var ctx = inject(GlueKey, null);
+    if (!ctx) {
+        throw new Error("glue: vue: plugin not installed: call app.use(createGlue(...)) first");
+    }
+
+    return ctx;
+};
+
+// useChannel returns the channel specified by name and a readonly ref
+// holding the last received message. The message listener is removed
+// as soon as the component is unmounted.
+// Returns: { channel, message, send }
+export var useChannel = function(name) {
+    var ctx = useGlue(),
+        c = ctx.socket.channel(name),
+        message = shallowRef(null);
+
+    var unsubscribe = c.subscribe(function(data) {
+        message.value = data;
+    });
+
+    onUnmounted(unsubscribe);
+
+    return {
+        channel: c,
+        message: readonly(message),
+        send:    c.send
+    };
+};
@@ -0,0 +1,357 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Type definitions for the glue javascript client library.
+
+declare namespace glue {
+    // The available socket types.
+    type SocketType = "WebSocket" | "AjaxSocket" | "MuxSocket" | "SockJSSocket" | "EngineIOSocket";
+
+    // The socket states.
+    type State = "disconnected" | "connecting" | "reconnecting" | "waiting" | "connected";
+
+    // The reasons passed with the disconnected state.
+    type DisconnectReason = "closed" | "reconnect_disabled" | "max_attempts" | "server_request" | "rejected";
+
+    // Rejection holds the structured rejection of the server.
+    interface Rejection {
+        // The machine-readable rejection code (e.g. "unsupported_version", "auth_failed", "maintenance").
+        code: string;
+        // The human-readable rejection message.
+        message: string;
+        // True if the socket keeps reconnecting.
+        retry: boolean;
+    }
+
+    // StateInfo holds the current state and additional state specific values.
+    interface StateInfo {
+        state: State;
+
+        // The reconnect attempt (reconnecting and waiting).
+        attempt?: number;
+
+        // Milliseconds until the next reconnect attempt (waiting).
+        retryIn?: number;
+
+        // The reason for the disconnected state.
+        reason?: DisconnectReason;
+
+        // The last rejection of the server (disconnected).
+        rejection?: Rejection;
+    }
+
+    // Values which are JSON encoded and decoded in JSON mode.
+    type JSONValue = null | boolean | number | string | JSONValue[] | { [key: string]: JSONValue };
+
+    // Data which can be send to the server.
+    // Any JSON value can be send in JSON mode.
+    type SendData = string | ArrayBuffer | ArrayBufferView | Blob | JSONValue;
+
+    // Data passed to the onMessage functions.
+    // Binary data is passed depending on the binaryType option.
+    // Decoded JSON values are passed in JSON mode.
+    type MessageData = string | ArrayBuffer | Blob | JSONValue;
+
+    // Send return values:
+    //  1 if immediately send,
+    //  0 if added to the send queue and
+    //  -1 if discarded.
+    type SendResult = 1 | 0 | -1;
+
+    type DiscardCallback = (data: SendData) => void;
+
+    // The reasons passed to the offline queue drop callback.
+    type DropReason = "max_count" | "max_bytes" | "expired";
+
+    interface OfflineQueueOptions {
+        // The maximum number of queued messages.
+        maxCount?: number;
+
+        // The maximum size of all queued messages in bytes.
+        maxBytes?: number;
+
+        // Discard queued messages after the time to live in milliseconds.
+        // To disable set to 0.
+        ttl?: number;
+
+        // Called with the data and the drop reason as soon as a queued message is dropped.
+        onDrop?: false | ((data: SendData, reason: DropReason) => void);
+    }
+
+    // Called with the received data. Messages of reliable channels pass
+    // the message ID, which is the idempotency key of redeliveries.
+    type MessageCallback = (data: MessageData, id?: string) => void;
+
+    interface Options {
+        // The base URL is appended to the host string. This value has to match with the server value.
+        baseURL?: string;
+
+        // Force a socket type.
+        // The SockJSSocket type requires the SockJS client library and the
+        // EngineIOSocket type the engine.io client library.
+        forceSocketType?: false | SocketType;
+
+        // The options passed to the SockJS client of the SockJSSocket type.
+        sockJSOptions?: false | { [key: string]: any };
+
+        // The options passed to the engine.io client of the EngineIOSocket type.
+        engineIOOptions?: false | { [key: string]: any };
+
+        // The server namespace to connect to (e.g. "/chat").
+        namespace?: string;
+
+        // The authentication value passed to the namespace authentication hook.
+        auth?: string;
+
+        // The handshake payload passed to the server OnHandshake hook.
+        handshake?: string;
+
+        // The single-use connect ticket issued by the server NewConnectTicket method.
+        // The server passes a renewed ticket for the next reconnect.
+        ticket?: string;
+
+        // The stable client ID passed with each reconnect.
+        // Default: a random ID kept in the session storage of the browser tab.
+        clientID?: string;
+
+        // Kill the connect attempt after the timeout.
+        connectTimeout?: number;
+
+        // If the connection is idle, ping the server to check if the connection is stil alive.
+        pingInterval?: number;
+        // Reconnect if the server did not response with a pong within the timeout.
+        pingReconnectTimeout?: number;
+
+        // Whenever to automatically reconnect if the connection was lost.
+        reconnect?: boolean;
+        // The initial reconnect delay.
+        reconnectDelay?: number;
+        reconnectDelayMax?: number;
+        // The delay is multiplied by this factor after each attempt (exponential backoff).
+        // To increase the delay linearly instead set to 0.
+        reconnectDelayMultiplier?: number;
+        // Use a random delay between zero and the calculated delay (full jitter).
+        reconnectJitter?: boolean;
+        // To disable set to 0 (endless).
+        reconnectAttempts?: number;
+
+        // Reset the send buffer after the timeout.
+        resetSendBufferTimeout?: number;
+
+        // Queue send calls while disconnected and flush them in order once reconnected.
+        // If enabled, the resetSendBufferTimeout option is ignored.
+        offlineQueue?: boolean | OfflineQueueOptions;
+
+        // The type of received binary data passed to the onMessage functions.
+        binaryType?: "arraybuffer" | "blob";
+
+        // JSON encode send values and JSON decode received messages.
+        // This is the default for all channels and can be changed per channel.
+        json?: boolean;
+
+        // The number of ping-pong samples used to estimate the server clock offset
+        // after each connection. To disable the clock synchronization set to 0.
+        clockSyncSamples?: number;
+
+        // The number of message IDs remembered per reliable channel
+        // to discard messages redelivered by the server.
+        dedupWindow?: number;
+
+        // React Native AppState module or any object emitting "change"
+        // events with the "active" and "background" states.
+        appState?: false | { addEventListener(type: "change", f: (state: string) => void): any };
+    }
+
+    interface EventMap {
+        "connected": (info: StateInfo) => void;
+        "connecting": (info: StateInfo) => void;
+        "disconnected": (info: StateInfo) => void;
+        "reconnecting": (info: StateInfo) => void;
+        "waiting": (info: StateInfo) => void;
+        "statechange": (info: StateInfo) => void;
+        "error": (msg: string) => void;
+        "connect_timeout": () => void;
+        "timeout": () => void;
+        "discard_send_buffer": () => void;
+        "clock_sync": (offset: number) => void;
+        "rejected": (rejection: Rejection) => void;
+        // The message is empty if the maintenance mode ended.
+        "maintenance": (msg: string) => void;
+        // Called with the milliseconds until the server closes the connection.
+        "going_away": (ms: number) => void;
+        // Called with the milliseconds until the server closes the idle socket.
+        "idle_warning": (ms: number) => void;
+        // Called with true if the server is near its capacity and with false afterwards.
+        "capacity": (near: boolean) => void;
+    }
+
+    // Options to cancel an operation.
+    // The promise is rejected with a TimeoutError or an AbortError.
+    interface CancelOptions {
+        // Cancel the operation after the timeout in milliseconds.
+        timeout?: number;
+
+        // Cancel the operation as soon as the signal is aborted.
+        signal?: AbortSignal;
+    }
+
+    // The reply of a canceled request is still consumed to keep the order.
+    type RequestOptions = CancelOptions;
+
+    // The options of the connect function.
+    type ConnectOptions = Options & CancelOptions;
+
+    interface SendOptions {
+        // Discard the data if it could not be send within the time to live in milliseconds.
+        ttl?: number;
+
+        // The message ID of reliable channels passed to the server handlers.
+        // A unique ID is generated if not set.
+        id?: string;
+    }
+
+    interface ChannelOptions {
+        // Enable or disable the JSON mode for this channel.
+        json?: boolean;
+
+        // The default time to live in milliseconds for send data.
+        ttl?: number;
+
+        // Resend string messages until the server acknowledges them.
+        // The discard callback and the time to live are not applied.
+        reliable?: boolean;
+    }
+
+    interface Channel {
+        // onMessage sets the function which is triggered as soon as a message is received.
+        onMessage(f: MessageCallback): void;
+
+        // subscribe adds a message listener. The returned function removes it again.
+        subscribe(f: MessageCallback): () => void;
+
+        // send a data string or binary data to the channel.
+        send(data: SendData, discardCallback?: DiscardCallback, options?: SendOptions): SendResult;
+
+        // request sends the data to the channel and resolves with the next received message.
+        request(data: SendData, options?: RequestOptions): Promise<MessageData>;
+
+        // Iterate over all received messages.
+        [Symbol.asyncIterator](): AsyncIterator<MessageData>;
+    }
+
+    interface Socket {
+        // version returns the glue socket protocol version.
+        version(): string;
+
+        // type returns the current used socket type.
+        type(): SocketType;
+
+        // state returns the current socket state.
+        state(): State;
+
+        // stateInfo returns the current state with additional state specific values.
+        stateInfo(): StateInfo;
+
+        // clockOffset returns the estimated offset of the server clock
+        // relative to the local clock in milliseconds.
+        clockOffset(): number;
+
+        // socketID returns the socket's ID.
+        socketID(): string;
+
+        // send a data string or binary data to the server.
+        send(data: SendData, discardCallback?: DiscardCallback, options?: SendOptions): SendResult;
+
+        // onMessage sets the function which is triggered as soon as a message is received.
+        onMessage(f: MessageCallback): void;
+
+        // subscribe adds a message listener. The returned function removes it again.
+        subscribe(f: MessageCallback): () => void;
+
+        // request sends the data to the server and resolves with the next received message.
+        request(data: SendData, options?: RequestOptions): Promise<MessageData>;
+
+        // on binds event functions to events.
+        on<K extends keyof EventMap>(event: K, f: EventMap[K]): void;
+
+        // once binds an event function which is triggered only once.
+        once<K extends keyof EventMap>(event: K, f: EventMap[K]): void;
+
+        // off removes event functions.
+        off<K extends keyof EventMap>(event: K, f?: EventMap[K]): void;
+
+        // Reconnect to the server.
+        // This is ignored if the socket is not disconnected.
+        reconnect(): void;
+
+        // close the socket connection.
+        close(): void;
+
+        // channel returns the given channel object specified by name.
+        channel(name: string, options?: ChannelOptions): Channel;
+
+        // topic subscribes to the server topic and returns its channel.
+        // The server replays the topic history first.
+        topic(name: string, options?: ChannelOptions): Channel;
+
+        // unsubscribeTopic unsubscribes from the server topic.
+        unsubscribeTopic(name: string): void;
+    }
+
+    // connect creates a new socket and resolves as soon as the connection is established.
+    // The promise is rejected with a RejectedError carrying the rejection code
+    // if the server rejects the connection.
+    function connect(host?: string, options?: ConnectOptions): Promise<Socket>;
+
+    // shared creates a socket which shares a single connection with all other
+    // browser tabs. The connection lives in the SharedWorker script at the worker URL.
+    // The request method and async iteration are not supported by shared sockets.
+    function shared(workerURL: string, host?: string, options?: Options): Socket;
+
+    interface Mux {
+        // carrier returns the socket of the physical connection.
+        carrier(): Socket;
+
+        // socket creates a new logical socket with optional socket options.
+        socket(options?: Options): Socket;
+
+        // close the carrier connection and all logical sockets.
+        close(): void;
+    }
+
+    // mux creates a carrier connection which transports multiple logical sockets.
+    // Each logical socket has its own socket ID, channels and lifecycle.
+    function mux(host?: string, options?: Options): Mux;
+
+    // Env provides the platform specific implementations.
+    interface Env {
+        WebSocket?: any;
+        XMLHttpRequest?: any;
+        SockJS?: any;
+        EngineIO?: any;
+        location?: { protocol: string; host: string };
+    }
+
+    // env overrides the platform specific implementations.
+    // Defaults to the browser globals.
+    let env: Env | undefined;
+}
+
+// glue creates a new socket and connects to the server.
+// The current location is used if the host is not set.
+declare function glue(host?: string, options?: glue.Options): glue.Socket;
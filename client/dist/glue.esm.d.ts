@@ -0,0 +1,34 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Type definitions for the ES module build of the glue javascript client library.
+
+/// <reference path="glue.d.ts" />
+
+export type Options = glue.Options;
+export type Socket = glue.Socket;
+export type Channel = glue.Channel;
+
+// createClient creates a new socket and connects to the server.
+export declare const createClient: typeof glue;
+
+// connect creates a new socket and resolves as soon as the connection is established.
+export declare const connect: typeof glue.connect;
+
+declare const _default: typeof glue;
+export default _default;
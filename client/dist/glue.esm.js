@@ -0,0 +1,4114 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  ES module build of the glue library.
+ *  The glue function is scoped to this module.
+ */
+
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+var glue = function(host, options) {
+    // Turn on strict mode.
+    'use strict';
+
+    // Include the dependencies.
+    /*
+ *  This code lives inside the glue function.
+ */
+
+// Source: https://github.com/component/emitter
+
+
+/**
+ * Initialize a new `Emitter`.
+ *
+ * @api public
+ */
+
+function Emitter(obj) {
+  if (obj) return mixin(obj);
+}
+
+/**
+ * Mixin the emitter properties.
+ *
+ * @param {Object} obj
+ * @return {Object}
+ * @api private
+ */
+
+function mixin(obj) {
+  for (var key in Emitter.prototype) {
+    obj[key] = Emitter.prototype[key];
+  }
+  return obj;
+}
+
+/**
+ * Listen on the given `event` with `fn`.
+ *
+ * @param {String} event
+ * @param {Function} fn
+ * @return {Emitter}
+ * @api public
+ */
+
+Emitter.prototype.on =
+Emitter.prototype.addEventListener = function(event, fn){
+  this._callbacks = this._callbacks || {};
+  (this._callbacks['$' + event] = this._callbacks['$' + event] || [])
+    .push(fn);
+  return this;
+};
+
+/**
+ * Adds an `event` listener that will be invoked a single
+ * time then automatically removed.
+ *
+ * @param {String} event
+ * @param {Function} fn
+ * @return {Emitter}
+ * @api public
+ */
+
+Emitter.prototype.once = function(event, fn){
+  function on() {
+    this.off(event, on);
+    fn.apply(this, arguments);
+  }
+
+  on.fn = fn;
+  this.on(event, on);
+  return this;
+};
+
+/**
+ * Remove the given callback for `event` or all
+ * registered callbacks.
+ *
+ * @param {String} event
+ * @param {Function} fn
+ * @return {Emitter}
+ * @api public
+ */
+
+Emitter.prototype.off =
+Emitter.prototype.removeListener =
+Emitter.prototype.removeAllListeners =
+Emitter.prototype.removeEventListener = function(event, fn){
+  this._callbacks = this._callbacks || {};
+
+  // all
+  if (0 === arguments.length) {
+    this._callbacks = {};
+    return this;
+  }
+
+  // specific event
+  var callbacks = this._callbacks['$' + event];
+  if (!callbacks) return this;
+
+  // remove all handlers
+  if (1 == arguments.length) {
+    delete this._callbacks['$' + event];
+    return this;
+  }
+
+  // remove specific handler
+  var cb;
+  for (var i = 0; i < callbacks.length; i++) {
+    cb = callbacks[i];
+    if (cb === fn || cb.fn === fn) {
+      callbacks.splice(i, 1);
+      break;
+    }
+  }
+  return this;
+};
+
+/**
+ * Emit `event` with the given args.
+ *
+ * @param {String} event
+ * @param {Mixed} ...
+ * @return {Emitter}
+ */
+
+Emitter.prototype.emit = function(event){
+  this._callbacks = this._callbacks || {};
+  var args = [].slice.call(arguments, 1), callbacks = this._callbacks['$' + event];
+
+  if (callbacks) {
+    callbacks = callbacks.slice(0);
+    for (var i = 0, len = callbacks.length; i < len; ++i) {
+      callbacks[i].apply(this, args);
+    }
+  }
+
+  return this;
+};
+
+/**
+ * Return array of callbacks for `event`.
+ *
+ * @param {String} event
+ * @return {Array}
+ * @api public
+ */
+
+Emitter.prototype.listeners = function(event){
+  this._callbacks = this._callbacks || {};
+  return this._callbacks['$' + event] || [];
+};
+
+/**
+ * Check if this emitter has `event` handlers.
+ *
+ * @param {String} event
+ * @return {Boolean}
+ * @api public
+ */
+
+Emitter.prototype.hasListeners = function(event){
+  return !! this.listeners(event).length;
+};
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+var newWebSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        ws;
+
+    // Websockets are able to transmit binary frames.
+    s.binary = true;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        try {
+            // Generate the websocket url.
+            var url;
+            if (host.match("^https://")) {
+                url = "wss" + host.substr(5);
+            } else {
+                url = "ws" + host.substr(4);
+            }
+            url += options.baseURL + "ws" + routingQuery();
+
+            // Open the websocket connection
+            ws = new env.WebSocket(url);
+
+            // Receive binary frames as ArrayBuffer.
+            ws.binaryType = "arraybuffer";
+
+            // Set the callback handlers
+            ws.onmessage = function(event) {
+                // Pass binary data as ArrayBuffer.
+                if (typeof event.data !== "string") {
+                    s.onMessage(event.data);
+                    return;
+                }
+
+                s.onMessage(event.data.toString());
+            };
+
+            ws.onerror = function(event) {
+                var msg = "the websocket closed the connection with ";
+                if (event.code) {
+                    msg += "the error code: " + event.code;
+                }
+                else {
+                    msg += "an error.";
+                }
+
+                s.onError(msg);
+            };
+
+            ws.onclose = function() {
+                s.onClose();
+            };
+
+            ws.onopen = function() {
+                s.onOpen();
+            };
+        } catch (e) {
+            s.onError();
+        }
+    };
+
+    s.send = function (data) {
+        // Send the data to the server
+        ws.send(data);
+    };
+
+	s.reset = function() {
+        // Close the websocket if defined.
+        if (ws) {
+            ws.close();
+        }
+
+        ws = undefined;
+    };
+
+	return s;
+};
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+var newAjaxSocket = function () {
+    /*
+     * Constants
+     */
+
+    var ajaxHost = host + options.baseURL + "ajax" + routingQuery(),
+        sendTimeout = 8000,
+        pollTimeoutMargin = 10000,
+
+        // The ajax transport protocol version passed with the init request.
+        ajaxProtocolVersion = "2";
+
+    var PollCommands = {
+        Timeout:    "t",
+        Closed:     "c"
+    };
+
+    var Commands = {
+        Delimiter:  "&",
+        Init:       "i",
+        Sequenced:  "s",
+        Poll:       "o"
+    };
+
+
+
+    /*
+     * Variables
+     */
+
+    var s = {},
+        uid, pollToken,
+        pollXhr = false,
+        sendXhr = false,
+        stopped = false,
+        pushing = false,  // Set while a push request is in flight.
+        pushQueue = [],   // Messages queued during a push request.
+        pushSeq = 0,      // The sequence number of the last push request.
+        poll;
+
+    // The ajax options are passed by the server with the init response.
+    var ajaxOptions = {
+        pollTimeout:    35000,
+        pollDelay:      0,
+        pushRetries:    0,
+        pushRetryDelay: 1000
+    };
+
+    // Ajax requests are text based. Binary data has to be encoded.
+    s.binary = false;
+
+
+
+    /*
+     * Methods
+     */
+
+    var stopRequests = function() {
+        // Set the poll function to a dummy function.
+        // This will prevent further poll calls.
+        poll = function() {};
+
+        // Prevent further push retries.
+        stopped = true;
+
+        // Kill the ajax requests.
+        if (pollXhr) {
+            pollXhr.abort();
+        }
+        if (sendXhr) {
+            sendXhr.abort();
+        }
+    };
+
+    var postAjax = function(url, timeout, data, success, error) {
+        var xhr = new env.XMLHttpRequest();
+
+        xhr.onload = function() {
+          success(xhr.response);
+        };
+
+        xhr.onerror = function() {
+          error();
+        };
+
+        xhr.ontimeout = function() {
+          error("timeout");
+        };
+
+        xhr.open('POST', url, true);
+        xhr.responseType = "text";
+        xhr.timeout = timeout;
+        xhr.send(data);
+
+        return xhr;
+    };
+
+    var triggerClosed = function() {
+        // Stop the ajax requests.
+        stopRequests();
+
+        // Trigger the event.
+        s.onClose();
+    };
+
+    var triggerError = function(msg) {
+        // Stop the ajax requests.
+        stopRequests();
+
+        // Create the error message.
+        if (msg) {
+            msg = "the ajax socket closed the connection with the error: " + msg;
+        }
+        else {
+            msg = "the ajax socket closed the connection with an error.";
+        }
+
+        // Trigger the event.
+        s.onError(msg);
+    };
+
+    var send = function (data, callback, retries) {
+        if (retries === undefined) {
+            retries = ajaxOptions.pushRetries;
+        }
+
+        sendXhr = postAjax(ajaxHost, sendTimeout, data, function (data) {
+            sendXhr = false;
+
+            if (callback) {
+                callback(data);
+            }
+        }, function (msg) {
+            sendXhr = false;
+
+            // Retry the push after the delay if retries are left.
+            if (retries > 0) {
+                setTimeout(function() {
+                    if (!stopped) {
+                        send(data, callback, retries - 1);
+                    }
+                }, ajaxOptions.pushRetryDelay);
+                return;
+            }
+
+            triggerError(msg);
+        });
+    };
+
+    // push sends the queued messages. Several messages are
+    // sent with one push request in a length-prefixed encoding.
+    // The length prefix is the UTF-8 byte length of the message.
+    // Each push carries a sequence number and the server drops
+    // replayed or retried requests with a known sequence number.
+    var push = function() {
+        if (pushQueue.length === 0) {
+            pushing = false;
+            return;
+        }
+
+        pushSeq++;
+        var data = Commands.Sequenced + uid + Commands.Delimiter + String(pushSeq) + Commands.Delimiter;
+        for (var i = 0; i < pushQueue.length; i++) {
+            data += String(utils.encodeUTF8(pushQueue[i]).length) + Commands.Delimiter + pushQueue[i];
+        }
+
+        pushQueue = [];
+        pushing = true;
+
+        // Send the messages queued in between afterwards.
+        send(data, push);
+    };
+
+    // setOptions applies the ajax options passed by the server.
+    var setOptions = function(data) {
+        if (!data) {
+            return;
+        }
+
+        try {
+            var o = JSON.parse(data);
+            for (var key in ajaxOptions) {
+                if (typeof o[key] === typeof ajaxOptions[key] && !(o[key] < 0)) {
+                    ajaxOptions[key] = o[key];
+                }
+            }
+        }
+        catch(err) {
+            console.log("glue: failed to parse the ajax options: " + err.message);
+        }
+    };
+
+    poll = function () {
+        var data = Commands.Poll + uid + Commands.Delimiter + pollToken;
+
+        // The request timeout is longer than the server's poll timeout.
+        var timeout = ajaxOptions.pollTimeout + pollTimeoutMargin;
+
+        pollXhr = postAjax(ajaxHost, timeout, data, function (data) {
+          pollXhr = false;
+
+          // Check if this jax request has reached the server's timeout.
+          if (data == PollCommands.Timeout) {
+              // Just start the next poll request.
+              poll();
+              return;
+          }
+
+          // Check if this ajax connection was closed.
+          if (data == PollCommands.Closed) {
+              // Trigger the closed event.
+              triggerClosed();
+              return;
+          }
+
+          // Split the new token from the rest of the data.
+          var i = data.indexOf(Commands.Delimiter);
+          if (i < 0) {
+              triggerError("ajax socket: failed to split poll token from data!");
+              return;
+          }
+
+          // Set the new token and the data variable.
+          pollToken = data.substring(0, i);
+          data = data.substr(i + 1);
+
+          // Start the next poll request.
+          // Messages are collected on the server during the poll delay.
+          if (ajaxOptions.pollDelay > 0) {
+              setTimeout(function() {
+                  poll();
+              }, ajaxOptions.pollDelay);
+          }
+          else {
+              poll();
+          }
+
+          // Call the event.
+          s.onMessage(data);
+        }, function (msg) {
+            pollXhr = false;
+            triggerError(msg);
+        });
+    };
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        // Initialize the ajax socket session
+        send(Commands.Init + ajaxProtocolVersion, function (data) {
+            // Get the uid and token string
+            var i = data.indexOf(Commands.Delimiter);
+            if (i < 0) {
+                triggerError("ajax socket: failed to split uid and poll token from data!");
+                return;
+            }
+
+            // Set the uid and token.
+            uid = data.substring(0, i);
+            pollToken = data.substr(i + 1);
+
+            // The ajax options follow the token.
+            i = pollToken.indexOf(Commands.Delimiter);
+            if (i >= 0) {
+                setOptions(pollToken.substr(i + 1));
+                pollToken = pollToken.substring(0, i);
+            }
+
+            // Start the long polling process.
+            poll();
+
+            // Trigger the event.
+            s.onOpen();
+        });
+    };
+
+    s.send = function (data) {
+        // Queue the message while a push request is in flight.
+        pushQueue.push(data);
+        if (!pushing) {
+            push();
+        }
+    };
+
+	s.reset = function() {
+        // Stop the ajax requests.
+        stopRequests();
+    };
+
+	return s;
+};
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+// A logical socket layer which shares the connection of a carrier socket.
+// The carrier transport is passed with the muxTransport option (see glue.mux).
+var newMuxSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        transport = options.muxTransport,
+        id = false;
+
+    // The carrier channel is text based. Binary data has to be encoded.
+    s.binary = false;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        id = transport.open(s);
+    };
+
+    s.send = function (data) {
+        transport.send(id, data);
+    };
+
+    s.reset = function() {
+        // Close the logical socket if opened.
+        if (id !== false) {
+            transport.close(id);
+        }
+
+        id = false;
+    };
+
+    return s;
+};
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+// The SockJS socket layer carries the glue protocol with the SockJS client
+// library and its fallback transports. The server has to enable the SockJS
+// endpoint. Pass the SockJS constructor with glue.env if it is not global.
+var newSockJSSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        sock;
+
+    // SockJS only transmits strings. Binary data has to be encoded.
+    s.binary = false;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        try {
+            // The SockJS client uses the http and https URLs.
+            var url = host + options.baseURL + "sockjs" + routingQuery();
+            sock = new env.SockJS(url, null, options.sockJSOptions || {});
+
+            // Set the callback handlers
+            sock.onmessage = function(event) {
+                s.onMessage(String(event.data));
+            };
+
+            sock.onclose = function() {
+                s.onClose();
+            };
+
+            sock.onopen = function() {
+                s.onOpen();
+            };
+        } catch (e) {
+            s.onError();
+        }
+    };
+
+    s.send = function (data) {
+        // Send the data to the server
+        sock.send(data);
+    };
+
+    s.reset = function() {
+        // Close the SockJS socket if defined.
+        if (sock) {
+            sock.close();
+        }
+
+        sock = undefined;
+    };
+
+    return s;
+};
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+// The engine.io socket layer carries the glue protocol with the engine.io
+// client and its polling and websocket transports. The server has to enable
+// the engine.io endpoint. Pass the engine.io client socket constructor with
+// glue.env if it is not global.
+var newEngineIOSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        sock;
+
+    // The glue messages are passed as strings.
+    s.binary = false;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        try {
+            // The engine.io client takes the path with the options.
+            var o = utils.extend({}, options.engineIOOptions || {});
+            o.path = options.baseURL + "engine.io/";
+
+            sock = new env.EngineIO(host + routingQuery(), o);
+
+            // Set the callback handlers
+            sock.on("message", function(data) {
+                s.onMessage(String(data));
+            });
+
+            sock.on("close", function() {
+                s.onClose();
+            });
+
+            sock.on("open", function() {
+                s.onOpen();
+            });
+        } catch (e) {
+            s.onError();
+        }
+    };
+
+    s.send = function (data) {
+        // Send the data to the server
+        sock.send(data);
+    };
+
+    s.reset = function() {
+        // Close the engine.io socket if defined.
+        if (sock) {
+            sock.close();
+        }
+
+        sock = undefined;
+    };
+
+    return s;
+};
+
+
+
+
+    /*
+     * Constants
+     */
+
+    var Version         = "2.0.0",
+        MainChannelName = "m",
+
+        // The reserved channel name used for the clock synchronization.
+        ClockChannelName = "_clock",
+
+        // The reserved channel name used to subscribe to server topics.
+        TopicChannelName = "_topic",
+
+        // The reserved channel name used for messages requesting
+        // a receipt and the acknowledgements.
+        ReceiptChannelName = "_ack",
+
+        // The reserved channel name used for the messages of reliable
+        // channels and the acknowledgements.
+        ReliableChannelName = "_rel",
+
+        // The reserved channel name used to notify about maintenance mode changes.
+        MaintenanceChannelName = "_maintenance",
+
+        // The reserved channel name used to notify if the server is near its capacity.
+        CapacityChannelName = "_capacity";
+
+    // Reliable channel request types.
+    var ReliableRequests = {
+        Message:    "m",
+        Ack:        "a"
+    };
+
+    // Topic request types.
+    var TopicRequests = {
+        Subscribe:      "s",
+        Unsubscribe:    "u"
+    };
+
+    // Clock synchronization message types.
+    var ClockMessages = {
+        Sample: "s",
+        Offset: "o"
+    };
+
+    var SocketTypes = {
+        WebSocket:  "WebSocket",
+        AjaxSocket:     "AjaxSocket",
+        MuxSocket:      "MuxSocket",
+        SockJSSocket:   "SockJSSocket",
+        EngineIOSocket: "EngineIOSocket"
+    };
+
+    var Commands = {
+        Len: 	            2,
+        Init:               'in',
+        Ping:               'pi',
+        Pong:               'po',
+        Close: 	            'cl',
+        Invalid:            'iv',
+        DontAutoReconnect:  'dr',
+        ChannelData:        'cd',
+        ChannelBinaryData:  'cb',
+        Reject:             'rj',
+        GoingAway:          'ga',
+        IdleWarning:        'iw',
+        Reconnect:          'rc'
+    };
+
+    var States = {
+        Disconnected:   "disconnected",
+        Connecting:     "connecting",
+        Reconnecting:   "reconnecting",
+        Waiting:        "waiting",
+        Connected:      "connected"
+    };
+
+    // The reasons passed with the disconnected state.
+    var DisconnectReasons = {
+        Closed:             "closed",               // Closed by the client.
+        ReconnectDisabled:  "reconnect_disabled",   // Automatic reconnections are disabled by the options.
+        MaxAttempts:        "max_attempts",         // The maximum reconnect attempts were reached.
+        ServerRequest:      "server_request",       // The server requested to not reconnect.
+        Rejected:           "rejected"              // The server rejected the connection.
+    };
+
+    var DefaultOptions = {
+        // The base URL is appended to the host string. This value has to match with the server value.
+        baseURL: "/glue/",
+
+        // Force a socket type.
+        // Values: false, "WebSocket", "AjaxSocket", "SockJSSocket", "EngineIOSocket"
+        // The SockJSSocket type requires the SockJS client library and the
+        // EngineIOSocket type the engine.io client library.
+        forceSocketType: false,
+
+        // The options passed to the SockJS client of the SockJSSocket type,
+        // for example the allowed transports.
+        sockJSOptions: false,
+
+        // The options passed to the engine.io client of the EngineIOSocket
+        // type, for example the transports. The path is set by glue.
+        engineIOOptions: false,
+
+        // The server namespace to connect to (e.g. "/chat").
+        // The default namespace is used if empty.
+        namespace: "",
+
+        // The authentication value passed to the namespace authentication hook.
+        auth: "",
+
+        // The handshake payload passed to the server OnHandshake hook.
+        handshake: "",
+
+        // The single-use connect ticket issued by the server NewConnectTicket method.
+        // The server passes a renewed ticket for the next reconnect.
+        ticket: "",
+
+        // The stable client ID passed with each reconnect. The server tracks the
+        // reliable channel acknowledgements and redeliveries per client ID.
+        // Only letters, digits, '-', '.' and '_' are allowed, up to 64 characters.
+        // Default: a random ID kept in the session storage of the browser tab.
+        clientID: "",
+
+        // Kill the connect attempt after the timeout.
+        connectTimeout:  10000,
+
+        // If the connection is idle, ping the server to check if the connection is stil alive.
+        pingInterval:           35000,
+        // Reconnect if the server did not response with a pong within the timeout.
+        pingReconnectTimeout:   5000,
+
+        // Whenever to automatically reconnect if the connection was lost.
+        reconnect:          true,
+        // The initial reconnect delay.
+        reconnectDelay:     1000,
+        reconnectDelayMax:  5000,
+        // The delay is multiplied by this factor after each attempt (exponential backoff).
+        // To increase the delay linearly instead set to 0.
+        reconnectDelayMultiplier: 0,
+        // Use a random delay between zero and the calculated delay (full jitter).
+        // This prevents synchronized reconnect storms after a server restart.
+        reconnectJitter:    true,
+        // To disable set to 0 (endless).
+        reconnectAttempts:  10,
+
+        // Reset the send buffer after the timeout.
+        resetSendBufferTimeout: 10000,
+
+        // Queue send calls while disconnected and flush them in order once reconnected.
+        // Set to true or to an object with the offline queue options to enable it.
+        // If enabled, the resetSendBufferTimeout option is ignored.
+        offlineQueue: false,
+
+        // React Native AppState module or any object emitting "change"
+        // events with the "active" and "background" states.
+        // Used to pause the keepalive mechanism in the background.
+        appState: false,
+
+        // The type of received binary data passed to the onMessage functions.
+        // Values: "arraybuffer", "blob"
+        binaryType: "arraybuffer",
+
+        // JSON encode send values and JSON decode received messages.
+        // This is the default for all channels and can be changed per channel.
+        json: false,
+
+        // The number of ping-pong samples used to estimate the server clock offset
+        // after each connection. To disable the clock synchronization set to 0.
+        clockSyncSamples: 5,
+
+        // The number of message IDs remembered per reliable channel
+        // to discard messages redelivered by the server.
+        dedupWindow: 256
+    };
+
+
+
+    var DefaultOfflineQueueOptions = {
+        // The maximum number of queued messages.
+        maxCount:   100,
+        // The maximum size of all queued messages in bytes.
+        maxBytes:   1048576,
+        // Discard queued messages after the time to live in milliseconds.
+        // To disable set to 0.
+        ttl:        60000,
+        // Called with the data and the drop reason as soon as a queued message is dropped.
+        onDrop:     false
+    };
+
+    // The reasons passed to the offline queue drop callback.
+    var DropReasons = {
+        MaxCount:   "max_count",    // The maximum number of queued messages was reached.
+        MaxBytes:   "max_bytes",    // The maximum size of the queue was reached.
+        Expired:    "expired"       // The time to live of the message expired.
+    };
+
+
+
+    /*
+     * Variables
+     */
+
+    // The environment provides the platform specific implementations.
+    // Defaults to the browser globals. Set glue.env to override them.
+    var env = {
+        WebSocket:      typeof WebSocket !== "undefined" ? WebSocket : undefined,
+        XMLHttpRequest: typeof XMLHttpRequest !== "undefined" ? XMLHttpRequest : undefined,
+        SockJS:         typeof SockJS !== "undefined" ? SockJS : undefined,
+        EngineIO:       typeof eio !== "undefined" ? eio : undefined,
+        location:       typeof window !== "undefined" ? window.location : undefined
+    };
+
+    var emitter                 = new Emitter,
+        bs                      = false,
+        mainChannel,
+        initialConnectedOnce    = false,    // If at least one successful connection was made.
+        bsNewFunc,                          // Function to create a new backend socket.
+        currentSocketType,
+        currentState            = States.Disconnected,
+        currentStateInfo        = { state: States.Disconnected },
+        reconnectTimeout        = false,
+        reconnectCount          = 0,
+        autoReconnectDisabled   = false,
+        connectTimeout          = false,
+        pingTimeout             = false,
+        pingReconnectTimeout    = false,
+        sendBuffer              = [],
+        sendBufferBytes         = 0,        // The size of the offline queue in bytes.
+        resetSendBufferTimeout  = false,
+        resetSendBufferTimedOut = false,
+        isReady                 = false,    // If true, the socket is initialized and ready.
+        beforeReadySendBuffer   = [],       // Buffer to hold requests for the server while the socket is not ready yet.
+        clockSamples            = [],       // The clock synchronization samples of the current run.
+        clockOffset             = 0,        // The estimated offset of the server clock in milliseconds.
+        topics                  = {},       // The subscribed server topics.
+        routing                 = false,    // The sticky session routing name and key of the server node.
+        rejection               = false,    // The last rejection of the server.
+        nativeKeepalive         = false,    // Set if the server sends native ping control frames.
+        nearCapacity            = false,    // Set if the server is near its capacity.
+        ticket                  = "",       // The connect ticket passed with the next connect.
+        clientID                = "",       // The stable client ID passed with each connect.
+        reliablePending         = [],       // The reliable messages not acknowledged by the server.
+        reliableCount           = 0,        // The number of send reliable messages.
+        reliablePrefix          = Math.random().toString(36).slice(2, 10) + Date.now().toString(36),
+        socketID               = "";
+
+
+    /*
+     * Include the dependencies
+     */
+
+    // Exported helper methods for the dependencies.
+    var closeSocket, send, sendBuffered, sendBufferedBinary, sendReliable;
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+var utils = (function() {
+    /*
+     * Constants
+     */
+
+    var Delimiter = "&",
+        Base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
+
+
+
+    /*
+     * Variables
+     */
+
+     var instance = {}; // Our public instance object returned by this function.
+
+
+
+    /*
+     * Public Methods
+     */
+
+    // Mimics jQuery's extend method.
+    // Source: http://stackoverflow.com/questions/11197247/javascript-equivalent-of-jquerys-extend-method
+    instance.extend = function() {
+      for(var i=1; i<arguments.length; i++)
+          for(var key in arguments[i])
+              if(arguments[i].hasOwnProperty(key))
+                  arguments[0][key] = arguments[i][key];
+      return arguments[0];
+    };
+
+    // Source: http://stackoverflow.com/questions/5999998/how-can-i-check-if-a-javascript-variable-is-function-type.
+    instance.isFunction = function(v) {
+        var getType = {};
+        return v && getType.toString.call(v) === '[object Function]';
+    };
+
+    // unmarshalValues splits two values from a single string.
+    // This function is chainable to extract multiple values.
+    // An object with two strings (first, second) is returned.
+    instance.unmarshalValues = function(data) {
+        if (!data) {
+            return false;
+        }
+
+        // Find the delimiter position.
+        var pos = data.indexOf(Delimiter);
+
+        // Extract the value length integer of the first value.
+        var len = parseInt(data.substring(0, pos), 10);
+        data = data.substring(pos + 1);
+
+        // Validate the length.
+        if (len < 0 || len > data.length) {
+            return false;
+        }
+
+        // Now split the first value from the second.
+        var firstV = data.substr(0, len);
+        var secondV = data.substr(len);
+
+        // Return an object with both values.
+        return {
+            first:  firstV,
+            second: secondV
+        };
+    };
+
+    // marshalValues joins two values into a single string.
+    // They can be decoded by the unmarshalValues function.
+    instance.marshalValues = function(first, second) {
+        return String(first.length) + Delimiter + first + second;
+    };
+
+    // isBinary returns true if the value is an ArrayBuffer, a TypedArray,
+    // a DataView or a Blob.
+    instance.isBinary = function(v) {
+        if (!v || typeof v !== "object") {
+            return false;
+        }
+
+        return (typeof ArrayBuffer !== "undefined" && (v instanceof ArrayBuffer || ArrayBuffer.isView(v))) ||
+            (typeof Blob !== "undefined" && v instanceof Blob);
+    };
+
+    // isBlob returns true if the value is a Blob.
+    instance.isBlob = function(v) {
+        return typeof Blob !== "undefined" && v instanceof Blob;
+    };
+
+    // readBlob reads the content of the Blob and passes it as ArrayBuffer to the callback.
+    instance.readBlob = function(blob, callback) {
+        if (blob.arrayBuffer) {
+            blob.arrayBuffer().then(callback, function(err) {
+                console.log("glue: failed to read blob: " + err);
+            });
+            return;
+        }
+
+        var reader = new FileReader();
+        reader.onload = function() {
+            callback(reader.result);
+        };
+        reader.onerror = function() {
+            console.log("glue: failed to read blob: " + reader.error);
+        };
+        reader.readAsArrayBuffer(blob);
+    };
+
+    // toUint8Array returns an Uint8Array view of the ArrayBuffer,
+    // TypedArray or DataView value.
+    instance.toUint8Array = function(v) {
+        if (v instanceof Uint8Array) {
+            return v;
+        }
+        if (ArrayBuffer.isView(v)) {
+            return new Uint8Array(v.buffer, v.byteOffset, v.byteLength);
+        }
+
+        return new Uint8Array(v);
+    };
+
+    // encodeUTF8 returns the UTF-8 encoded bytes of the string.
+    instance.encodeUTF8 = function(str) {
+        if (typeof TextEncoder !== "undefined") {
+            return new TextEncoder().encode(str);
+        }
+
+        var s = unescape(encodeURIComponent(str)),
+            b = new Uint8Array(s.length);
+        for (var i = 0; i < s.length; i++) {
+            b[i] = s.charCodeAt(i);
+        }
+        return b;
+    };
+
+    // decodeUTF8 returns the string of the UTF-8 encoded bytes.
+    instance.decodeUTF8 = function(b) {
+        if (typeof TextDecoder !== "undefined") {
+            return new TextDecoder().decode(b);
+        }
+
+        var s = "";
+        for (var i = 0; i < b.length; i++) {
+            s += String.fromCharCode(b[i]);
+        }
+        return decodeURIComponent(escape(s));
+    };
+
+    // marshalBinary joins the command, the first string value and the
+    // binary second value into a single Uint8Array.
+    // They can be decoded by the unmarshalBinary function.
+    // In contrast to marshalValues, the length prefix is the UTF-8 byte
+    // length of the first value.
+    instance.marshalBinary = function(cmd, first, second) {
+        var firstB  = instance.encodeUTF8(first),
+            secondB = instance.toUint8Array(second),
+            head    = cmd + String(firstB.length) + Delimiter,
+            b       = new Uint8Array(head.length + firstB.length + secondB.length);
+
+        for (var i = 0; i < head.length; i++) {
+            b[i] = head.charCodeAt(i);
+        }
+        b.set(firstB, head.length);
+        b.set(secondB, head.length + firstB.length);
+
+        return b;
+    };
+
+    // unmarshalBinary splits a binary frame created by marshalBinary.
+    // An object with the command, the first string value and the
+    // second value as ArrayBuffer is returned.
+    instance.unmarshalBinary = function(data, cmdLen) {
+        var b = new Uint8Array(data),
+            pos = -1,
+            i;
+
+        // Find the delimiter position.
+        for (i = cmdLen; i < b.length; i++) {
+            if (b[i] === Delimiter.charCodeAt(0)) {
+                pos = i;
+                break;
+            }
+        }
+        if (pos < 0) {
+            return false;
+        }
+
+        // Extract the command and the value length integer of the first value.
+        var head = "";
+        for (i = 0; i < pos; i++) {
+            head += String.fromCharCode(b[i]);
+        }
+        var len = parseInt(head.substr(cmdLen), 10);
+
+        // Validate the length.
+        if (isNaN(len) || len < 0 || pos + 1 + len > b.length) {
+            return false;
+        }
+
+        return {
+            cmd:    head.substr(0, cmdLen),
+            first:  instance.decodeUTF8(b.subarray(pos + 1, pos + 1 + len)),
+            second: data.slice(pos + 1 + len)
+        };
+    };
+
+    // newError creates an error with the given name and message.
+    instance.newError = function(name, msg) {
+        var err = new Error(msg);
+        err.name = name;
+        return err;
+    };
+
+    // watchCancel calls the cancel function with an error as soon as the
+    // timeout in milliseconds is reached or if the AbortSignal is aborted.
+    // Both the timeout and the signal are optional values of the opts object.
+    // A function is returned which stops watching.
+    instance.watchCancel = function(opts, what, cancel) {
+        var timer = false,
+            signal = opts ? opts.signal : undefined,
+            onAbort;
+
+        var stop = function() {
+            if (timer !== false) {
+                clearTimeout(timer);
+                timer = false;
+            }
+            if (signal && onAbort) {
+                signal.removeEventListener("abort", onAbort);
+            }
+        };
+
+        if (!opts) {
+            return stop;
+        }
+
+        if (signal) {
+            if (signal.aborted) {
+                cancel(instance.newError("AbortError", "glue: " + what + " aborted"));
+                return stop;
+            }
+
+            onAbort = function() {
+                stop();
+                cancel(instance.newError("AbortError", "glue: " + what + " aborted"));
+            };
+            signal.addEventListener("abort", onAbort);
+        }
+
+        if (opts.timeout > 0) {
+            timer = setTimeout(function() {
+                timer = false;
+                stop();
+                cancel(instance.newError("TimeoutError", "glue: " + what + " timed out"));
+            }, opts.timeout);
+        }
+
+        return stop;
+    };
+
+    // btoa encodes the binary string to base64.
+    // Not all environments (React Native) provide the global btoa function.
+    var btoaFunc = function(s) {
+        if (typeof btoa !== "undefined") {
+            return btoa(s);
+        }
+
+        var out = "", c1, c2, c3;
+        for (var i = 0; i < s.length; i += 3) {
+            c1 = s.charCodeAt(i);
+            c2 = s.charCodeAt(i + 1);
+            c3 = s.charCodeAt(i + 2);
+
+            out += Base64Chars.charAt(c1 >> 2);
+            out += Base64Chars.charAt(((c1 & 3) << 4) | (c2 >> 4));
+            out += (i + 1 < s.length) ? Base64Chars.charAt(((c2 & 15) << 2) | (c3 >> 6)) : "=";
+            out += (i + 2 < s.length) ? Base64Chars.charAt(c3 & 63) : "=";
+        }
+        return out;
+    };
+
+    // atob decodes the base64 string to a binary string.
+    // Not all environments (React Native) provide the global atob function.
+    var atobFunc = function(s) {
+        if (typeof atob !== "undefined") {
+            return atob(s);
+        }
+
+        var out = "", bits = 0, n = 0, v;
+        for (var i = 0; i < s.length; i++) {
+            v = Base64Chars.indexOf(s.charAt(i));
+            if (v < 0) {
+                continue; // Skip padding.
+            }
+
+            bits = (bits << 6) | v;
+            n += 6;
+            if (n >= 8) {
+                n -= 8;
+                out += String.fromCharCode((bits >> n) & 255);
+            }
+        }
+        return out;
+    };
+
+    // base64Encode encodes the binary value to a base64 string.
+    instance.base64Encode = function(v) {
+        var b = instance.toUint8Array(v),
+            s = "";
+        for (var i = 0; i < b.length; i++) {
+            s += String.fromCharCode(b[i]);
+        }
+        return btoaFunc(s);
+    };
+
+    // base64Decode decodes the base64 string to an ArrayBuffer.
+    instance.base64Decode = function(str) {
+        var s = atobFunc(str),
+            b = new Uint8Array(s.length);
+        for (var i = 0; i < s.length; i++) {
+            b[i] = s.charCodeAt(i);
+        }
+        return b.buffer;
+    };
+
+    // clientID returns the client ID stored with the key in the session
+    // storage. A new random ID is stored if none exists. Without a session
+    // storage, the ID is only kept for the lifetime of the socket object.
+    instance.clientID = function(key) {
+        var id = Math.random().toString(36).slice(2, 12) + Math.random().toString(36).slice(2, 12);
+
+        try {
+            var stored = sessionStorage.getItem(key);
+            if (stored) {
+                return stored;
+            }
+            sessionStorage.setItem(key, id);
+        } catch (e) {
+            // The session storage is not available.
+        }
+
+        return id;
+    };
+
+
+    return instance;
+})();
+
+    /*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+var channel = (function() {
+    /*
+     * Variables
+     */
+
+     var instance = {}, // Our public instance object returned by this function.
+         channels = {}; // Object as key value map.
+
+
+
+     /*
+      * Private Methods
+      */
+
+     var newChannel = function(name) {
+         // Create the channel object.
+         var channel = {
+             // Set to a dummy function.
+             onMessageFunc: function() {},
+
+             // Pending request promises waiting for a reply message.
+             requests: [],
+
+             // Active async iterators receiving all messages.
+             iterators: [],
+
+             // Additional message listeners added with subscribe.
+             listeners: [],
+
+             // If true, values are JSON encoded and received messages are JSON decoded.
+             json: options.json === true,
+
+             // The default time to live in milliseconds for send data.
+             // Zero disables the time to live.
+             ttl: 0,
+
+             // If true, send messages are resent until the server acknowledges them.
+             reliable: false,
+
+             // The IDs of the last received reliable messages.
+             seen:       {},
+             seenOrder:  []
+         };
+
+         // Set the channel public instance object.
+         // This is the value which is returned by the public glue.channel(...) function.
+         channel.instance = {
+             // onMessage sets the function which is triggered as soon as a message is received.
+             onMessage: function(f) {
+                 channel.onMessageFunc = f;
+             },
+
+             // subscribe adds a function which is triggered as soon as a message
+             // is received. In contrast to onMessage, multiple functions can be added.
+             // A function is returned which removes the listener again.
+             subscribe: function(f) {
+                 channel.listeners.push(f);
+
+                 return function() {
+                     var i = channel.listeners.indexOf(f);
+                     if (i >= 0) {
+                         channel.listeners.splice(i, 1);
+                     }
+                 };
+             },
+
+             // send a data string or binary data to the channel.
+             // Binary data can be an ArrayBuffer, a TypedArray, a DataView or a Blob.
+             // In JSON mode any other value is JSON encoded.
+             // One optional discard callback can be passed.
+             // It is called if the data could not be send to the server.
+             // The data is passed as first argument to the discard callback.
+             // Optional send options can be passed:
+             //  - ttl: discard the data if it could not be send within the
+             //         time to live in milliseconds. Overrides the channel ttl.
+             //  - id:  the message ID of reliable channels passed to the server
+             //         handlers. Use it as idempotency key or correlation value.
+             //         A unique ID is generated if not set.
+             // returns:
+             //  1 if immediately send,
+             //  0 if added to the send queue and
+             //  -1 if discarded.
+             send: function(data, discardCallback, opts) {
+                 var ttl = (opts && opts.ttl !== undefined) ? opts.ttl : channel.ttl;
+
+                 // Encode the value in JSON mode.
+                 // The discard callback is called with the original value.
+                 if (channel.json && !utils.isBinary(data)) {
+                     var value = data;
+                     data = JSON.stringify(value);
+
+                     if (discardCallback && utils.isFunction(discardCallback)) {
+                         var f = discardCallback;
+                         discardCallback = function() {
+                             f(value);
+                         };
+                     }
+                 }
+
+                 // Discard empty data.
+                 if (!data) {
+                     return -1;
+                 }
+
+                 // Blobs are read asynchronously.
+                 // Send the data as soon as the content is available.
+                 if (utils.isBlob(data)) {
+                     utils.readBlob(data, function(buf) {
+                         sendBufferedBinary(name, buf, discardCallback, ttl);
+                     });
+                     return 0;
+                 }
+
+                 // Send binary data.
+                 if (utils.isBinary(data)) {
+                     return sendBufferedBinary(name, data, discardCallback, ttl);
+                 }
+
+                 // Send the data until acknowledged in reliable mode.
+                 if (channel.reliable) {
+                     return sendReliable(name, data, opts && opts.id);
+                 }
+
+                 // Call the helper method and send the data to the channel.
+                 return sendBuffered(Commands.ChannelData, utils.marshalValues(name, data), discardCallback, ttl);
+             },
+
+             // request sends the data to the channel and returns a promise
+             // which is resolved with the next message received on this channel.
+             // Requests are resolved in the order they were send.
+             // The promise is rejected if the data could not be send to the server.
+             // Messages resolving a request are not passed to the onMessage function.
+             // Optional options can be passed:
+             //  - timeout: reject the promise after the timeout in milliseconds.
+             //  - signal:  an AbortSignal to cancel the request.
+             // The reply of a canceled request is still consumed to keep the order.
+             request: function(data, opts) {
+                 return new Promise(function(resolve, reject) {
+                     var stopWatch;
+
+                     var r = {
+                         resolve: function(v) {
+                             stopWatch();
+                             resolve(v);
+                         },
+                         reject:  reject
+                     };
+
+                     var discard = function() {
+                         stopWatch();
+                         removeRequest(channel, r);
+                         reject(new Error("glue: channel '" + name + "': request data discarded"));
+                     };
+
+                     // Cancel the request on timeout or abort.
+                     // Replace the resolve function to discard the reply.
+                     var canceled = false;
+                     stopWatch = utils.watchCancel(opts, "channel '" + name + "': request", function(err) {
+                         canceled = true;
+                         r.resolve = function() {};
+                         reject(err);
+                     });
+
+                     // Don't send the data if already aborted.
+                     if (canceled) {
+                         return;
+                     }
+
+                     channel.requests.push(r);
+
+                     if (channel.instance.send(data, discard) < 0) {
+                         discard();
+                     }
+                 });
+             }
+         };
+
+         // Add async iteration support if available.
+         // Usage: for await (const data of channel) { ... }
+         if (typeof Symbol !== "undefined" && Symbol.asyncIterator) {
+             channel.instance[Symbol.asyncIterator] = function() {
+                 return newIterator(channel);
+             };
+         }
+
+         // Return the channel object.
+         return channel;
+     };
+
+
+
+     var removeRequest = function(channel, r) {
+         var i = channel.requests.indexOf(r);
+         if (i >= 0) {
+             channel.requests.splice(i, 1);
+         }
+     };
+
+     // newIterator creates an async iterator which receives
+     // all messages of the channel.
+     var newIterator = function(channel) {
+         var it = {
+             queue:   [], // Received messages which were not consumed yet.
+             waiting: []  // Resolve functions of pending next calls.
+         };
+
+         it.push = function(data) {
+             if (it.waiting.length > 0) {
+                 it.waiting.shift()({ value: data, done: false });
+                 return;
+             }
+             it.queue.push(data);
+         };
+
+         channel.iterators.push(it);
+
+         return {
+             next: function() {
+                 if (it.queue.length > 0) {
+                     return Promise.resolve({ value: it.queue.shift(), done: false });
+                 }
+                 if (it.done) {
+                     return Promise.resolve({ value: undefined, done: true });
+                 }
+
+                 return new Promise(function(resolve) {
+                     it.waiting.push(resolve);
+                 });
+             },
+
+             // return is called if the for await loop is left.
+             return: function() {
+                 it.done = true;
+                 it.queue = [];
+
+                 var i = channel.iterators.indexOf(it);
+                 if (i >= 0) {
+                     channel.iterators.splice(i, 1);
+                 }
+
+                 // Release pending next calls.
+                 while (it.waiting.length > 0) {
+                     it.waiting.shift()({ value: undefined, done: true });
+                 }
+
+                 return Promise.resolve({ value: undefined, done: true });
+             }
+         };
+     };
+
+
+
+     /*
+      * Public Methods
+      */
+
+     // Get or create a channel if it does not exists.
+     // Optional channel options can be passed:
+     //  - json:     enable or disable the JSON mode for this channel.
+     //  - ttl:      the default time to live in milliseconds for send data.
+     //  - reliable: resend string messages until the server acknowledges them.
+     //              The discard callback and the time to live are not applied.
+     instance.get = function(name, opts) {
+         if (!name) {
+             return false;
+         }
+
+         // Get the channel.
+         var c = channels[name];
+         if (!c) {
+             // Create a new one, if it does not exists and add it to the map.
+             c = newChannel(name);
+             channels[name] = c;
+         }
+
+         // Apply the channel options.
+         if (opts && opts.json !== undefined) {
+             c.json = opts.json === true;
+         }
+         if (opts && opts.ttl !== undefined) {
+             c.ttl = opts.ttl;
+         }
+         if (opts && opts.reliable !== undefined) {
+             c.reliable = opts.reliable === true;
+         }
+
+         return c.instance;
+     };
+
+     // emitOnMessage passes the received data to the channel. The optional
+     // message ID of reliable channels is passed as second argument to the
+     // subscribed listeners and the onMessage function.
+     // Returns false if the channel does not exist.
+     instance.emitOnMessage = function(name, data, id) {
+         if (!name || !data) {
+             return false;
+         }
+
+         // Get the channel.
+         var c = channels[name];
+         if (!c) {
+             console.log("glue: channel '" + name + "': emit onMessage event: channel does not exists");
+             return false;
+         }
+
+         // Discard redelivered messages of reliable channels.
+         if (id !== undefined) {
+             if (c.seen.hasOwnProperty(id)) {
+                 return true;
+             }
+
+             c.seen[id] = true;
+             c.seenOrder.push(id);
+             while (c.seenOrder.length > options.dedupWindow) {
+                 delete c.seen[c.seenOrder.shift()];
+             }
+         }
+
+         // Decode the message in JSON mode.
+         // Binary data is passed as it is.
+         if (c.json && typeof data === "string") {
+             try {
+                 data = JSON.parse(data);
+             }
+             catch(err) {
+                 console.log("glue: channel '" + name + "': failed to decode JSON message: " + err.message);
+                 return true;
+             }
+         }
+
+         // Resolve the oldest pending request.
+         if (c.requests.length > 0) {
+             c.requests.shift().resolve(data);
+             return true;
+         }
+
+         // Pass the data to all async iterators.
+         var i;
+         for (i = 0; i < c.iterators.length; i++) {
+             c.iterators[i].push(data);
+         }
+
+         // Call the subscribed listeners.
+         var listeners = c.listeners.slice(0);
+         for (i = 0; i < listeners.length; i++) {
+             try {
+                 listeners[i](data, id);
+             }
+             catch(err) {
+                 console.log("glue: channel '" + name + "': subscribed listener call failed: " + err.message);
+             }
+         }
+
+         // Call the channel's on message event.
+         try {
+             c.onMessageFunc(data, id);
+         }
+         catch(err) {
+             console.log("glue: channel '" + name + "': onMessage event call failed: " + err.message);
+         }
+
+         return true;
+     };
+
+     return instance;
+})();
+
+
+
+
+    /*
+     * Methods
+     */
+
+    // Function variables.
+    var reconnect, triggerEvent;
+
+    // Sets the current state and triggers the state event and the statechange event.
+    // The info object holds additional state specific values:
+    //  - reconnecting: attempt
+    //  - waiting:      attempt, retryIn
+    //  - disconnected: reason
+    var setState = function(state, info) {
+        currentState = state;
+        currentStateInfo = utils.extend({ state: state }, info);
+
+        triggerEvent(state, utils.extend({}, currentStateInfo));
+        triggerEvent("statechange", utils.extend({}, currentStateInfo));
+    };
+
+    // Sends the data to the server if a socket connection exists, otherwise it is discarded.
+    // If the socket is not ready yet, the data is buffered until the socket is ready.
+    send = function(data) {
+        if (!bs) {
+            return;
+        }
+
+        // If the socket is not ready yet, buffer the data.
+        if (!isReady) {
+            beforeReadySendBuffer.push(data);
+            return;
+        }
+
+        // Send the data.
+        bs.send(data);
+    };
+
+    // Sends the command with the data to the server.
+    // Binary channel data is send as binary frame if supported by the
+    // backend socket. Otherwise it is base64 encoded.
+    var sendCmd = function(cmd, data) {
+        if (cmd !== Commands.ChannelBinaryData) {
+            send(cmd + data);
+            return;
+        }
+
+        if (bs && bs.binary) {
+            send(utils.marshalBinary(cmd, data.name, data.data));
+        } else {
+            send(cmd + utils.marshalValues(data.name, utils.base64Encode(data.data)));
+        }
+    };
+
+    // Returns the data passed to the discard callbacks.
+    var discardData = function(cmd, data) {
+        if (cmd === Commands.ChannelBinaryData) {
+            return data.data;
+        }
+        if (cmd === Commands.ChannelData) {
+            // Remove the channel name.
+            var v = utils.unmarshalValues(data);
+            if (v) {
+                return v.second;
+            }
+        }
+        return data;
+    };
+
+    // Returns the query string echoing the sticky session routing key
+    // of the last connected server node or an empty string if not set.
+    var routingQuery = function() {
+        if (!routing) {
+            return "";
+        }
+        return "?" + encodeURIComponent(routing.name) + "=" + encodeURIComponent(routing.key);
+    };
+
+    // Returns the received binary data in the format specified by the binaryType option.
+    var binaryData = function(buf) {
+        if (options.binaryType === "blob") {
+            return new Blob([buf]);
+        }
+        return buf;
+    };
+
+    // Handles a message requesting a receipt. The message is passed to
+    // the channel and the receipt is acknowledged to the server afterwards.
+    var handleReceiptData = function(data) {
+        // Obtain the receipt ID and the channel message.
+        var v = utils.unmarshalValues(data),
+            m = v ? utils.unmarshalValues(v.second) : false;
+        if (!m) {
+            console.log("glue: server requested an invalid receipt request: " + data);
+            return;
+        }
+
+        // Trigger the event.
+        channel.emitOnMessage(m.first, m.second);
+
+        // Acknowledge the receipt.
+        send(Commands.ChannelData + utils.marshalValues(ReceiptChannelName, v.first));
+    };
+
+    // Sends the reliable channel request to the server.
+    var sendReliableRequest = function(t, data) {
+        send(Commands.ChannelData + utils.marshalValues(ReliableChannelName, t + data));
+    };
+
+    // Sends the pending reliable message with its ID and send time to the server.
+    var sendReliableMessage = function(m) {
+        sendReliableRequest(ReliableRequests.Message, utils.marshalValues(m.id,
+            utils.marshalValues(String(m.time), utils.marshalValues(m.name, m.data))));
+    };
+
+    // Send the data to the reliable channel specified by name. The message
+    // is kept until the server acknowledges it and is resent after reconnects.
+    // The optional ID is passed to the server handlers. A unique ID is
+    // generated if not set.
+    // returns:
+    //  1 if immediately send and
+    //  0 if send as soon as connected.
+    sendReliable = function(name, data, id) {
+        reliableCount++;
+
+        var m = {
+            id:     id ? String(id) : reliablePrefix + "-" + reliableCount,
+            time:   Date.now(),
+            name:   name,
+            data:   data
+        };
+        reliablePending.push(m);
+
+        if (!bs || currentState !== States.Connected) {
+            return 0;
+        }
+
+        sendReliableMessage(m);
+        return 1;
+    };
+
+    // Resends all reliable messages which were not acknowledged yet.
+    var resendReliable = function() {
+        for (var i = 0; i < reliablePending.length; i++) {
+            sendReliableMessage(reliablePending[i]);
+        }
+    };
+
+    // Handles the reliable channel requests of the server. Messages are
+    // passed with their ID to the channel and acknowledged afterwards.
+    // Messages of unknown channels are not acknowledged and redelivered
+    // as soon as the channel is reliable on the server side again.
+    // Acknowledgements remove the pending reliable messages.
+    var handleReliableData = function(data) {
+        var t = data.charAt(0),
+            v = utils.unmarshalValues(data.substr(1)),
+            m = v ? utils.unmarshalValues(v.second) : false;
+
+        if (t === ReliableRequests.Ack && v) {
+            for (var i = 0; i < reliablePending.length; i++) {
+                if (reliablePending[i].id === v.second) {
+                    reliablePending.splice(i, 1);
+                    break;
+                }
+            }
+            return;
+        }
+
+        if (t !== ReliableRequests.Message || !m) {
+            console.log("glue: server send an invalid reliable channel request: " + data);
+            return;
+        }
+
+        // Trigger the event.
+        if (!channel.emitOnMessage(m.first, m.second, v.first)) {
+            return;
+        }
+
+        // Acknowledge the message.
+        sendReliableRequest(ReliableRequests.Ack, utils.marshalValues(m.first, v.first));
+    };
+
+    // Sends the data to the reserved clock channel.
+    var sendClockData = function(data) {
+        send(Commands.ChannelData + utils.marshalValues(ClockChannelName, data));
+    };
+
+    // Starts the clock synchronization with the server.
+    // Each sample sends the current timestamp. The server replies
+    // with the sample timestamp and the server timestamp.
+    var startClockSync = function() {
+        if (!(options.clockSyncSamples > 0)) {
+            return;
+        }
+
+        clockSamples = [];
+        sendClockData(ClockMessages.Sample + String(Date.now()));
+    };
+
+    // Handles the clock synchronization replies of the server.
+    var handleClockData = function(data) {
+        if (data.charAt(0) !== ClockMessages.Sample) {
+            console.log("glue: received invalid clock data: " + data);
+            return;
+        }
+
+        var v = utils.unmarshalValues(data.substr(1)),
+            now = Date.now();
+        if (!v) {
+            console.log("glue: received invalid clock data: " + data);
+            return;
+        }
+
+        var sent = parseInt(v.first, 10),
+            serverTime = parseInt(v.second, 10);
+        if (isNaN(sent) || isNaN(serverTime)) {
+            console.log("glue: received invalid clock data: " + data);
+            return;
+        }
+
+        // Assume the reply took half of the round trip time.
+        clockSamples.push({
+            rtt:    now - sent,
+            offset: serverTime + (now - sent) / 2 - now
+        });
+
+        // Send the next sample.
+        if (clockSamples.length < options.clockSyncSamples) {
+            sendClockData(ClockMessages.Sample + String(Date.now()));
+            return;
+        }
+
+        // Use the sample with the lowest round trip time.
+        var best = clockSamples[0];
+        for (var i = 1; i < clockSamples.length; i++) {
+            if (clockSamples[i].rtt < best.rtt) {
+                best = clockSamples[i];
+            }
+        }
+        clockSamples = [];
+        clockOffset = Math.round(best.offset);
+
+        // Inform the server about the estimated offset.
+        sendClockData(ClockMessages.Offset + String(clockOffset));
+
+        triggerEvent("clock_sync", clockOffset);
+    };
+
+    // Sends the topic request to the server if connected.
+    // Topics are subscribed again after each connection.
+    var sendTopicRequest = function(type, name) {
+        if (currentState !== States.Connected) {
+            return;
+        }
+
+        send(Commands.ChannelData + utils.marshalValues(TopicChannelName, type + name));
+    };
+
+    // Subscribes all topics again.
+    var resubscribeTopics = function() {
+        for (var name in topics) {
+            if (topics.hasOwnProperty(name)) {
+                sendTopicRequest(TopicRequests.Subscribe, name);
+            }
+        }
+    };
+
+    // Hint: the isReady flag has to be true before calling this function!
+    var sendBeforeReadyBufferedData = function() {
+        // Skip if empty.
+        if (beforeReadySendBuffer.length === 0) {
+            return;
+        }
+
+        // Send the buffered data.
+        for (var i = 0; i < beforeReadySendBuffer.length; i++) {
+            send(beforeReadySendBuffer[i]);
+        }
+
+        // Clear the buffer.
+        beforeReadySendBuffer = [];
+    };
+
+    var stopResetSendBufferTimeout = function() {
+        // Reset the flag.
+        resetSendBufferTimedOut = false;
+
+        // Stop the timeout timer if present.
+        if (resetSendBufferTimeout !== false) {
+            clearTimeout(resetSendBufferTimeout);
+            resetSendBufferTimeout = false;
+        }
+    };
+
+    var startResetSendBufferTimeout = function() {
+        // Skip if already running or if already timed out.
+        if (resetSendBufferTimeout !== false || resetSendBufferTimedOut) {
+            return;
+        }
+
+        // Start the timeout.
+        resetSendBufferTimeout = setTimeout(function() {
+            // Update the flags.
+            resetSendBufferTimeout = false;
+            resetSendBufferTimedOut = true;
+
+            // Return if already empty.
+            if (sendBuffer.length === 0) {
+                return;
+            }
+
+            // Call the discard callbacks if defined.
+            var buf;
+            for (var i = 0; i < sendBuffer.length; i++) {
+                buf = sendBuffer[i];
+                if (buf.discardCallback && utils.isFunction(buf.discardCallback)) {
+                    try {
+                        buf.discardCallback(discardData(buf.cmd, buf.data));
+                    }
+                    catch (err) {
+                       console.log("glue: failed to call discard callback: " + err.message);
+                    }
+                }
+            }
+
+            // Trigger the event if any buffered send data is discarded.
+            triggerEvent("discard_send_buffer");
+
+            // Reset the buffer.
+            sendBuffer = [];
+        }, options.resetSendBufferTimeout);
+    };
+
+    // Returns the size of the buffered data in bytes.
+    var dataSize = function(cmd, data) {
+        if (cmd === Commands.ChannelBinaryData) {
+            return data.data.byteLength;
+        }
+        return utils.encodeUTF8(data).length;
+    };
+
+    // Removes the message at the index (default the first one) from the
+    // offline queue and calls the discard callbacks with the drop reason.
+    var dropFromOfflineQueue = function(reason, index) {
+        var buf = sendBuffer.splice(index || 0, 1)[0];
+        sendBufferBytes -= buf.size;
+
+        var data = discardData(buf.cmd, buf.data);
+
+        if (buf.discardCallback && utils.isFunction(buf.discardCallback)) {
+            try {
+                buf.discardCallback(data);
+            }
+            catch (err) {
+               console.log("glue: failed to call discard callback: " + err.message);
+            }
+        }
+
+        if (utils.isFunction(options.offlineQueue.onDrop)) {
+            try {
+                options.offlineQueue.onDrop(data, reason);
+            }
+            catch (err) {
+               console.log("glue: failed to call offline queue drop callback: " + err.message);
+            }
+        }
+    };
+
+    // Drops all expired messages from the offline queue and
+    // starts the timer for the next expiring message.
+    var expireOfflineQueue = function() {
+        // Stop the timeout timer if present.
+        if (resetSendBufferTimeout !== false) {
+            clearTimeout(resetSendBufferTimeout);
+            resetSendBufferTimeout = false;
+        }
+
+        // Drop the expired messages and find the next expiry time.
+        // Messages without an expiry time are zero.
+        var now = Date.now(),
+            next = 0,
+            expires;
+
+        for (var i = 0; i < sendBuffer.length;) {
+            expires = sendBuffer[i].expires;
+            if (expires > 0 && expires <= now) {
+                dropFromOfflineQueue(DropReasons.Expired, i);
+                continue;
+            }
+            if (expires > 0 && (next === 0 || expires < next)) {
+                next = expires;
+            }
+            i++;
+        }
+
+        if (next === 0) {
+            return;
+        }
+
+        // The drop callbacks might have started the timer already.
+        if (resetSendBufferTimeout !== false) {
+            clearTimeout(resetSendBufferTimeout);
+        }
+
+        // Start the timer for the next expiring message.
+        resetSendBufferTimeout = setTimeout(expireOfflineQueue, next - now);
+    };
+
+    // Returns the expiry time of a message with the time to live
+    // in milliseconds or zero if the message does not expire.
+    var expiryTime = function(ttl) {
+        return (ttl > 0) ? Date.now() + ttl : 0;
+    };
+
+    // Adds the data to the offline queue.
+    // The oldest messages are dropped if the queue limits are exceeded.
+    // The message expires after the queue or the message time to live,
+    // whichever is shorter.
+    // returns:
+    //  0 if added to the queue and
+    //  -1 if discarded.
+    var addToOfflineQueue = function(cmd, data, discardCallback, ttl) {
+        var size = dataSize(cmd, data),
+            o = options.offlineQueue;
+
+        // Discard the data if it does not fit into the queue at all.
+        if ((o.maxBytes > 0 && size > o.maxBytes) || !(o.maxCount > 0)) {
+            if (discardCallback && utils.isFunction(discardCallback)) {
+                discardCallback(discardData(cmd, data));
+            }
+            if (utils.isFunction(o.onDrop)) {
+                o.onDrop(discardData(cmd, data), o.maxCount > 0 ? DropReasons.MaxBytes : DropReasons.MaxCount);
+            }
+
+            return -1;
+        }
+
+        // Use the shorter time to live.
+        if (o.ttl > 0 && !(ttl > 0 && ttl < o.ttl)) {
+            ttl = o.ttl;
+        }
+
+        // Append to the queue.
+        var expires = expiryTime(ttl);
+        sendBuffer.push({
+            cmd:                cmd,
+            data:               data,
+            discardCallback:    discardCallback,
+            size:               size,
+            expires:            expires
+        });
+        sendBufferBytes += size;
+
+        // Drop the oldest messages if the limits are exceeded.
+        while (sendBuffer.length > o.maxCount) {
+            dropFromOfflineQueue(DropReasons.MaxCount);
+        }
+        while (o.maxBytes > 0 && sendBufferBytes > o.maxBytes) {
+            dropFromOfflineQueue(DropReasons.MaxBytes);
+        }
+
+        // Restart the expiry timer. The message might expire first.
+        if (expires > 0) {
+            expireOfflineQueue();
+        }
+
+        return 0;
+    };
+
+    var sendDataFromSendBuffer = function() {
+        // Stop the reset send buffer tiemout.
+        stopResetSendBufferTimeout();
+
+        // Drop expired messages from the offline queue.
+        if (options.offlineQueue) {
+            expireOfflineQueue();
+            stopResetSendBufferTimeout();
+        }
+
+        // Skip if empty.
+        if (sendBuffer.length === 0) {
+            return;
+        }
+
+        // Clear the buffer.
+        var buffer = sendBuffer,
+            now = Date.now(),
+            buf;
+
+        sendBuffer = [];
+        sendBufferBytes = 0;
+
+        // Send data, which could not be send...
+        // Messages exceeding their time to live are discarded instead.
+        for (var i = 0; i < buffer.length; i++) {
+            buf = buffer[i];
+            if (buf.expires > 0 && buf.expires <= now) {
+                if (buf.discardCallback && utils.isFunction(buf.discardCallback)) {
+                    try {
+                        buf.discardCallback(discardData(buf.cmd, buf.data));
+                    }
+                    catch (err) {
+                       console.log("glue: failed to call discard callback: " + err.message);
+                    }
+                }
+                continue;
+            }
+
+            sendCmd(buf.cmd, buf.data);
+        }
+    };
+
+    // Send data to the server.
+    // This is a helper method which handles buffering,
+    // if the socket is currently not connected.
+    // One optional discard callback can be passed.
+    // It is called if the data could not be send to the server.
+    // The data is passed as first argument to the discard callback.
+    // An optional time to live in milliseconds discards buffered
+    // data, which could not be send in time.
+    // returns:
+    //  1 if immediately send,
+    //  0 if added to the send queue and
+    //  -1 if discarded.
+    sendBuffered = function(cmd, data, discardCallback, ttl) {
+        // Be sure, that the data value is an empty
+        // string if not passed to this method.
+        if (!data) {
+            data = "";
+        }
+
+        // Add the data to the send buffer if disconnected.
+        // They will be buffered for a short timeout to bridge short connection errors.
+        if (!bs || currentState !== States.Connected) {
+            // Use the offline queue if enabled.
+            if (options.offlineQueue) {
+                return addToOfflineQueue(cmd, data, discardCallback, ttl);
+            }
+
+            // If already timed out, then call the discard callback and return.
+            if (resetSendBufferTimedOut) {
+                if (discardCallback && utils.isFunction(discardCallback)) {
+                    discardCallback(discardData(cmd, data));
+                }
+
+                return -1;
+            }
+
+            // Reset the send buffer after a specific timeout.
+            startResetSendBufferTimeout();
+
+            // Append to the buffer.
+            sendBuffer.push({
+                cmd:                cmd,
+                data:               data,
+                discardCallback:    discardCallback,
+                expires:            expiryTime(ttl)
+            });
+
+            return 0;
+        }
+
+        // Send the data with the command to the server.
+        sendCmd(cmd, data);
+
+        return 1;
+    };
+
+    // Send binary data to the channel specified by name.
+    // This is a helper method equal to sendBuffered.
+    // The data has to be an ArrayBuffer, a TypedArray or a DataView.
+    sendBufferedBinary = function(name, data, discardCallback, ttl) {
+        return sendBuffered(Commands.ChannelBinaryData, {
+            name: name,
+            data: data
+        }, discardCallback, ttl);
+    };
+
+    var stopConnectTimeout = function() {
+        // Stop the timeout timer if present.
+        if (connectTimeout !== false) {
+            clearTimeout(connectTimeout);
+            connectTimeout = false;
+        }
+    };
+
+    var resetConnectTimeout = function() {
+        // Stop the timeout.
+        stopConnectTimeout();
+
+        // Start the timeout.
+        connectTimeout = setTimeout(function() {
+            // Update the flag.
+            connectTimeout = false;
+
+            // Trigger the event.
+            triggerEvent("connect_timeout");
+
+            // Reconnect to the server.
+            reconnect();
+        }, options.connectTimeout);
+    };
+
+    var stopPingTimeout = function() {
+        // Stop the timeout timer if present.
+        if (pingTimeout !== false) {
+            clearTimeout(pingTimeout);
+            pingTimeout = false;
+        }
+
+        // Stop the reconnect timeout.
+        if (pingReconnectTimeout !== false) {
+            clearTimeout(pingReconnectTimeout);
+            pingReconnectTimeout = false;
+        }
+    };
+
+    // Request a Pong response to check if the connection is still alive.
+    // Reconnect if no response is received within the timeout.
+    var checkConnection = function() {
+        // Stop the timeout.
+        stopPingTimeout();
+
+        // Request a Pong response.
+        send(Commands.Ping);
+
+        // Start the reconnect timeout.
+        pingReconnectTimeout = setTimeout(function() {
+            // Update the flag.
+            pingReconnectTimeout = false;
+
+            // Trigger the event.
+            triggerEvent("timeout");
+
+            // Reconnect to the server.
+            reconnect();
+        }, options.pingReconnectTimeout);
+    };
+
+    var resetPingTimeout = function() {
+        // Stop the timeout.
+        stopPingTimeout();
+
+        // The server checks the connection with native
+        // ping control frames, which are handled by the browser.
+        if (nativeKeepalive) {
+            return;
+        }
+
+        // Start the timeout.
+        pingTimeout = setTimeout(function() {
+            // Update the flag.
+            pingTimeout = false;
+
+            // Check if the connection is still alive.
+            checkConnection();
+        }, options.pingInterval);
+    };
+
+    // Handle application state changes (React Native AppState).
+    // Timers are suspended or delayed in the background. Stop the keepalive
+    // timeouts to prevent false timeouts and check the connection as soon as
+    // the application is in the foreground again.
+    var onAppStateChange = function(state) {
+        if (state === "background") {
+            stopPingTimeout();
+        }
+        else if (state === "active") {
+            if (currentState === States.Connected) {
+                checkConnection();
+            }
+            else if (currentState === States.Disconnected && options.reconnect !== false && !autoReconnectDisabled) {
+                reconnectCount = 0;
+                reconnect();
+            }
+        }
+    };
+
+    var newBackendSocket = function() {
+        // Logical sockets always use the connection of the carrier socket.
+        if (options.muxTransport) {
+            bsNewFunc = newMuxSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.MuxSocket;
+            return;
+        }
+
+        // If at least one successfull connection was made,
+        // then create a new socket using the last create socket function.
+        // Otherwise determind which socket layer to use.
+        if (initialConnectedOnce) {
+            bs = bsNewFunc();
+            return;
+        }
+
+        // The SockJS client falls back to other transports itself.
+        if (options.forceSocketType === SocketTypes.SockJSSocket) {
+            bsNewFunc = newSockJSSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.SockJSSocket;
+            return;
+        }
+
+        // The engine.io client upgrades the transport itself.
+        if (options.forceSocketType === SocketTypes.EngineIOSocket) {
+            bsNewFunc = newEngineIOSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.EngineIOSocket;
+            return;
+        }
+
+        // Fallback to the ajax socket layer if there was no successful initial
+        // connection and more than one reconnection attempt was made.
+        if (reconnectCount > 1) {
+            bsNewFunc = newAjaxSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.AjaxSocket;
+            return;
+        }
+
+        // Choose the socket layer depending on the browser support.
+        if ((!options.forceSocketType && env.WebSocket) ||
+            options.forceSocketType === SocketTypes.WebSocket)
+        {
+            bsNewFunc = newWebSocket;
+            currentSocketType = SocketTypes.WebSocket;
+        }
+        else
+        {
+            bsNewFunc = newAjaxSocket;
+            currentSocketType = SocketTypes.AjaxSocket;
+        }
+
+        // Create the new socket.
+        bs = bsNewFunc();
+    };
+
+    // handleReject handles a rejection of the server during the initialization.
+    var handleReject = function(data) {
+        var r = {};
+        try {
+            r = JSON.parse(data);
+        }
+        catch(err) {}
+
+        rejection = {
+            code:    r.code || "",
+            message: r.message || "",
+            retry:   !!r.retry
+        };
+
+        // Disable auto reconnections if the rejection is final.
+        if (!rejection.retry) {
+            autoReconnectDisabled = true;
+        }
+
+        // Log the rejection.
+        console.log("glue: server rejected the connection: " + rejection.code + ": " + rejection.message);
+
+        // A full server is at its capacity.
+        if (rejection.code === "server_full") {
+            setNearCapacity(true);
+        }
+
+        // Trigger the rejected event.
+        triggerEvent("rejected", utils.extend({}, rejection));
+    };
+
+    // setNearCapacity sets the capacity state of the server
+    // and triggers the capacity event if changed.
+    var setNearCapacity = function(near) {
+        if (nearCapacity === near) {
+            return;
+        }
+
+        nearCapacity = near;
+        triggerEvent("capacity", near);
+    };
+
+    var initSocket = function(data) {
+        // Parse the data JSON string to an object.
+        data = JSON.parse(data);
+
+        // Validate.
+        // Close the socket and log the error on invalid data.
+        if (!data.socketID) {
+            closeSocket();
+            console.log("glue: socket initialization failed: invalid initialization data received");
+            return;
+        }
+
+        // Set the socket ID.
+        socketID = data.socketID;
+
+        // Reset a previous rejection.
+        rejection = false;
+
+        // Stop the application-level keepalive if the server
+        // uses the native keepalive of the transport.
+        if (data.nativeKeepalive) {
+            nativeKeepalive = true;
+            stopPingTimeout();
+        }
+
+        // Update the capacity state of the server.
+        setNearCapacity(!!data.nearCapacity);
+
+        // Remember the renewed connect ticket for the next reconnect.
+        if (data.ticket) {
+            ticket = data.ticket;
+        }
+
+        // Remember the routing key of the server node.
+        // It is echoed on reconnect to keep the session pinned to the node.
+        if (data.routingName && data.routingKey) {
+            routing = {
+                name: data.routingName,
+                key:  data.routingKey
+            };
+        }
+
+        // The socket initialization is done.
+        // ##################################
+
+        // Set the ready flag.
+        isReady = true;
+
+        // First send all data messages which were
+        // buffered because the socket was not ready.
+        sendBeforeReadyBufferedData();
+
+        // Now set the state and trigger the event.
+        setState(States.Connected);
+
+        // Synchronize the clock with the server.
+        startClockSync();
+
+        // Subscribe to the server topics.
+        resubscribeTopics();
+
+        // Resend the reliable messages which were not acknowledged.
+        resendReliable();
+
+        // Send the queued data from the send buffer if present.
+        // Do this after the next tick to be sure, that
+        // the connected event gets fired first.
+        setTimeout(sendDataFromSendBuffer, 0);
+    };
+
+    var connectSocket = function() {
+        // Set a new backend socket.
+        newBackendSocket();
+
+        // Set the backend socket events.
+        bs.onOpen = function() {
+            // Stop the connect timeout.
+            stopConnectTimeout();
+
+            // Reset the reconnect count.
+            reconnectCount = 0;
+
+            // Set the flag.
+            initialConnectedOnce = true;
+
+            // The server tells the keepalive mode with the init data.
+            nativeKeepalive = false;
+
+            // Reset or start the ping timeout.
+            resetPingTimeout();
+
+            // Prepare the init data to be send to the server.
+            var data = {
+                version: Version,
+                reject:  true
+            };
+
+            // Carrier sockets of logical sockets are hidden by the server.
+            if (options.muxCarrier) {
+                data.mux = true;
+            }
+
+            // Pass the namespace and the authentication value.
+            if (options.namespace) {
+                data.namespace = options.namespace;
+            }
+            if (options.auth) {
+                data.auth = options.auth;
+            }
+
+            // Pass the handshake payload.
+            if (options.handshake) {
+                data.payload = options.handshake;
+            }
+
+            // Pass the connect ticket. It is only valid once.
+            if (ticket) {
+                data.ticket = ticket;
+                ticket = "";
+            }
+
+            // Pass the stable client ID.
+            data.client = clientID;
+
+            // Marshal the data object to a JSON string.
+            data = JSON.stringify(data);
+
+            // Send the init data to the server with the init command.
+            // Hint: the backend socket is used directly instead of the send function,
+            // because the socket is not ready yet and this part belongs to the
+            // initialization process.
+            bs.send(Commands.Init + data);
+        };
+
+        bs.onClose = function() {
+            // Reconnect the socket.
+            reconnect();
+        };
+
+        bs.onError = function(msg) {
+            // Trigger the error event.
+            triggerEvent("error", [msg]);
+
+            // Reconnect the socket.
+            reconnect();
+        };
+
+        bs.onMessage = function(data) {
+            // Reset the ping timeout.
+            resetPingTimeout();
+
+            // Handle binary frames.
+            if (typeof data !== "string") {
+                var b = utils.unmarshalBinary(data, Commands.Len);
+                if (!b || b.cmd !== Commands.ChannelBinaryData) {
+                    console.log("glue: received invalid binary data from server.");
+                    return;
+                }
+
+                // Trigger the event.
+                channel.emitOnMessage(b.first, binaryData(b.second));
+                return;
+            }
+
+            // Log if the received data is too short.
+            if (data.length < Commands.Len) {
+                console.log("glue: received invalid data from server: data is too short.");
+                return;
+            }
+
+            // Extract the command from the received data string.
+            var cmd = data.substr(0, Commands.Len);
+            data = data.substr(Commands.Len);
+
+            if (cmd === Commands.Ping) {
+                // Response with a pong message.
+                send(Commands.Pong);
+            }
+            else if (cmd === Commands.Pong) {
+                // Don't do anything.
+                // The ping timeout was already reset.
+            }
+            else if (cmd === Commands.Invalid) {
+                // Log.
+                console.log("glue: server replied with an invalid request notification!");
+            }
+            else if (cmd === Commands.DontAutoReconnect) {
+                // Disable auto reconnections.
+                autoReconnectDisabled = true;
+
+                // Log.
+                console.log("glue: server replied with an don't automatically reconnect request. This might be due to an incompatible protocol version.");
+            }
+            else if (cmd === Commands.Reject) {
+                handleReject(data);
+            }
+            else if (cmd === Commands.Close) {
+                // The server closes the connection after all previous
+                // messages were handled. Acknowledge it, so the server
+                // doesn't wait for the connection loss, and reconnect as usual.
+                send(Commands.Close);
+                reconnect();
+            }
+            else if (cmd === Commands.Reconnect) {
+                // The server session expired. Acknowledge it and
+                // reconnect immediately to start a new session.
+                send(Commands.Close);
+                resetSocket();
+                reconnectCount = 1;
+                connectSocket();
+            }
+            else if (cmd === Commands.GoingAway) {
+                // The server is shutting down. Pass the milliseconds
+                // until the connection is closed.
+                triggerEvent("going_away", parseInt(data, 10) || 0);
+            }
+            else if (cmd === Commands.IdleWarning) {
+                // The server closes the idle socket. Pass the milliseconds
+                // until the socket is closed. Send data to keep it open.
+                triggerEvent("idle_warning", parseInt(data, 10) || 0);
+            }
+            else if (cmd === Commands.Init) {
+                initSocket(data);
+            }
+            else if (cmd === Commands.ChannelData) {
+                // Obtain the two values from the data string.
+                var v = utils.unmarshalValues(data);
+                if (!v) {
+                    console.log("glue: server requested an invalid channel data request: " + data);
+                    return;
+                }
+
+                // Handle the reserved clock synchronization channel.
+                if (v.first === ClockChannelName) {
+                    handleClockData(v.second);
+                    return;
+                }
+
+                // Handle messages requesting a receipt.
+                if (v.first === ReceiptChannelName) {
+                    handleReceiptData(v.second);
+                    return;
+                }
+
+                // Handle the messages of reliable channels.
+                if (v.first === ReliableChannelName) {
+                    handleReliableData(v.second);
+                    return;
+                }
+
+                // Trigger the maintenance event with the maintenance message.
+                // The message is empty if the maintenance mode ended.
+                if (v.first === MaintenanceChannelName) {
+                    triggerEvent("maintenance", v.second);
+                    return;
+                }
+
+                // Update the capacity state of the server.
+                if (v.first === CapacityChannelName) {
+                    setNearCapacity(v.second === "1");
+                    return;
+                }
+
+                // Trigger the event.
+                channel.emitOnMessage(v.first, v.second);
+            }
+            else if (cmd === Commands.ChannelBinaryData) {
+                // Obtain the channel name and the base64 encoded data.
+                var bv = utils.unmarshalValues(data);
+                if (!bv) {
+                    console.log("glue: server requested an invalid channel data request: " + data);
+                    return;
+                }
+
+                // Trigger the event.
+                channel.emitOnMessage(bv.first, binaryData(utils.base64Decode(bv.second)));
+            }
+            else {
+                console.log("glue: received invalid data from server with command '" + cmd + "' and data '" + data + "'!");
+            }
+        };
+
+        // Connect during the next tick.
+        // The user should be able to connect the event functions first.
+        setTimeout(function() {
+            // Set the state and trigger the event.
+            if (reconnectCount > 0) {
+                setState(States.Reconnecting, { attempt: reconnectCount });
+            }
+            else {
+                setState(States.Connecting);
+            }
+
+            // Reset or start the connect timeout.
+            resetConnectTimeout();
+
+            // Connect to the server
+            bs.open();
+        }, 0);
+    };
+
+    var resetSocket = function() {
+        // Stop the timeouts.
+        stopConnectTimeout();
+        stopPingTimeout();
+
+        // Reset flags and variables.
+        isReady = false;
+        socketID = "";
+
+        // Clear the buffer.
+        // This buffer is attached to each single socket.
+        beforeReadySendBuffer = [];
+
+        // Reset previous backend sockets if defined.
+        if (bs) {
+            // Set dummy functions.
+            // This will ensure, that previous old sockets don't
+            // call our valid methods. This would mix things up.
+            bs.onOpen = bs.onClose = bs.onMessage = bs.onError = function() {};
+
+            // Reset everything and close the socket.
+            bs.reset();
+            bs = false;
+        }
+    };
+
+    reconnect = function() {
+        // Reset the socket.
+        resetSocket();
+
+        // If no reconnections should be made or more than max
+        // reconnect attempts where made, trigger the disconnected event.
+        if ((options.reconnectAttempts > 0 && reconnectCount >= options.reconnectAttempts) ||
+            options.reconnect === false || autoReconnectDisabled)
+        {
+            // Determind the reason.
+            var reason = DisconnectReasons.MaxAttempts,
+                info = {};
+            if (autoReconnectDisabled && rejection) {
+                reason = DisconnectReasons.Rejected;
+            } else if (autoReconnectDisabled) {
+                reason = DisconnectReasons.ServerRequest;
+            } else if (options.reconnect === false) {
+                reason = DisconnectReasons.ReconnectDisabled;
+            }
+            info.reason = reason;
+
+            // Pass the last rejection of the server.
+            if (rejection) {
+                info.rejection = utils.extend({}, rejection);
+            }
+
+            // Set the state and trigger the event.
+            setState(States.Disconnected, info);
+
+            return;
+        }
+
+        // Increment the count.
+        reconnectCount += 1;
+
+        // Calculate the reconnect delay.
+        var reconnectDelay;
+        if (options.reconnectDelayMultiplier > 0) {
+            reconnectDelay = options.reconnectDelay * Math.pow(options.reconnectDelayMultiplier, reconnectCount - 1);
+        } else {
+            reconnectDelay = options.reconnectDelay * reconnectCount;
+        }
+        if (reconnectDelay > options.reconnectDelayMax) {
+            reconnectDelay = options.reconnectDelayMax;
+        }
+
+        // Spread the reconnects over the maximum delay
+        // if the server is near its capacity.
+        if (nearCapacity) {
+            reconnectDelay = options.reconnectDelayMax;
+        }
+
+        // Apply the full jitter.
+        if (options.reconnectJitter) {
+            reconnectDelay = Math.floor(Math.random() * reconnectDelay);
+        }
+
+        // Wait for the delay.
+        setState(States.Waiting, {
+            attempt: reconnectCount,
+            retryIn: reconnectDelay
+        });
+
+        // Try to reconnect.
+        reconnectTimeout = setTimeout(function() {
+            reconnectTimeout = false;
+            connectSocket();
+        }, reconnectDelay);
+    };
+
+    var stopReconnectTimeout = function() {
+        if (reconnectTimeout !== false) {
+            clearTimeout(reconnectTimeout);
+            reconnectTimeout = false;
+        }
+    };
+
+    closeSocket = function() {
+        // Check if the socket exists or if a reconnect is pending.
+        if (!bs && reconnectTimeout === false) {
+            return;
+        }
+
+        // Stop a pending reconnect.
+        stopReconnectTimeout();
+
+        // Notify the server.
+        send(Commands.Close);
+
+        // Reset the socket.
+        resetSocket();
+
+        // Set the state and trigger the event.
+        setState(States.Disconnected, { reason: DisconnectReasons.Closed });
+    };
+
+
+
+    /*
+     * Initialize section
+     */
+
+    // Merge the environment with the custom environment.
+    env = utils.extend(env, glue.env);
+
+    // Prepare the host string.
+    // Use the current location if the host string is not set.
+    if (!host) {
+        if (!env.location) {
+            console.log("glue: invalid host: no host passed and no location available!");
+            return;
+        }
+        host = env.location.protocol + "//" + env.location.host;
+    }
+    // The host string has to start with http:// or https://
+    if (!host.match("^http://") && !host.match("^https://")) {
+        console.log("glue: invalid host: missing 'http://' or 'https://'!");
+        return;
+    }
+
+    // Merge the options with the default options.
+    options = utils.extend({}, DefaultOptions, options);
+
+    // The max value can't be smaller than the delay.
+    if (options.reconnectDelayMax < options.reconnectDelay) {
+        options.reconnectDelayMax = options.reconnectDelay;
+    }
+
+    // Merge the offline queue options with the default options.
+    if (options.offlineQueue) {
+        options.offlineQueue = utils.extend({}, DefaultOfflineQueueOptions,
+            options.offlineQueue === true ? {} : options.offlineQueue);
+    }
+
+    // Set the initial connect ticket.
+    ticket = options.ticket;
+
+    // Load the stable client ID. Sockets to different hosts
+    // and namespaces use different IDs.
+    clientID = options.clientID || utils.clientID("glue.clientID:" + host + "/" + options.namespace);
+
+    // Create the main channel.
+    // This requires the merged options.
+    mainChannel = channel.get(MainChannelName);
+
+    // Prepare the base URL.
+    // The base URL has to start and end with a slash.
+    if (options.baseURL.indexOf("/") !== 0) {
+        options.baseURL = "/" + options.baseURL;
+    }
+    if (options.baseURL.slice(-1) !== "/") {
+        options.baseURL = options.baseURL + "/";
+    }
+
+    // Listen for application state changes if set.
+    if (options.appState && options.appState.addEventListener) {
+        options.appState.addEventListener("change", onAppStateChange);
+    }
+
+    // Create the initial backend socket and establish a connection to the server.
+    connectSocket();
+
+
+
+    /*
+     * Socket object
+     */
+
+    var socket = {
+        // version returns the glue socket protocol version.
+        version: function() {
+            return Version;
+        },
+
+        // type returns the current used socket type as string.
+        // Either "WebSocket" or "AjaxSocket".
+        type: function() {
+            return currentSocketType;
+        },
+
+        // state returns the current socket state as string.
+        // Following states are available:
+        //  - "disconnected"
+        //  - "connecting"
+        //  - "reconnecting"
+        //  - "waiting"
+        //  - "connected"
+        state: function() {
+            return currentState;
+        },
+
+        // stateInfo returns an object with the current state and additional
+        // state specific values:
+        //  - reconnecting: attempt
+        //  - waiting:      attempt, retryIn (milliseconds)
+        //  - disconnected: reason ("closed", "reconnect_disabled", "max_attempts", "server_request", "rejected"),
+        //                  rejection (code, message, retry) if rejected
+        stateInfo: function() {
+            return utils.extend({}, currentStateInfo);
+        },
+
+        // clockOffset returns the estimated offset of the server clock
+        // relative to the local clock in milliseconds.
+        // Add it to Date.now() to obtain the server time.
+        clockOffset: function() {
+            return clockOffset;
+        },
+
+        // socketID returns the socket's ID.
+        // This is a cryptographically secure pseudorandom number.
+        socketID: function() {
+            return socketID;
+        },
+
+        // send a data string or binary data to the server.
+        // Binary data can be an ArrayBuffer, a TypedArray, a DataView or a Blob.
+        // One optional discard callback can be passed.
+        // It is called if the data could not be send to the server.
+        // The data is passed as first argument to the discard callback.
+        // Optional send options can be passed:
+        //  - ttl: discard the data if it could not be send within the
+        //         time to live in milliseconds.
+        // returns:
+        //  1 if immediately send,
+        //  0 if added to the send queue and
+        //  -1 if discarded.
+        send: function(data, discardCallback, opts) {
+            return mainChannel.send(data, discardCallback, opts);
+        },
+
+        // onMessage sets the function which is triggered as soon as a message is received.
+        onMessage: function(f) {
+            mainChannel.onMessage(f);
+        },
+
+        // subscribe adds a function which is triggered as soon as a message
+        // is received. Returns a function which removes the listener again.
+        subscribe: function(f) {
+            return mainChannel.subscribe(f);
+        },
+
+        // request sends the data to the server and returns a promise
+        // which is resolved with the next received message.
+        request: function(data, opts) {
+            return mainChannel.request(data, opts);
+        },
+
+        // on binds event functions to events.
+        // This function is equivalent to jQuery's on method syntax.
+        // Following events are available:
+        //  - "connected"
+        //  - "connecting"
+        //  - "disconnected"
+        //  - "reconnecting"
+        //  - "waiting"
+        //  - "statechange"
+        //  - "error"
+        //  - "connect_timeout"
+        //  - "timeout"
+        //  - "discard_send_buffer"
+        //  - "clock_sync"
+        on: function() {
+            emitter.on.apply(emitter, arguments);
+        },
+
+        // once binds an event function which is triggered only once.
+        once: function() {
+            emitter.once.apply(emitter, arguments);
+        },
+
+        // off removes event functions.
+        // If no function is passed, all functions of the event are removed.
+        off: function() {
+            emitter.off.apply(emitter, arguments);
+        },
+
+        // Reconnect to the server.
+        // This is ignored if the socket is not disconnected.
+        // It will reconnect automatically if required.
+        reconnect: function() {
+            if (currentState !== States.Disconnected) {
+                return;
+            }
+
+            // Reset the reconnect count, the auto reconnect disabled flag
+            // and the last rejection.
+            reconnectCount = 0;
+            autoReconnectDisabled = false;
+            rejection = false;
+
+            // Reconnect the socket.
+            reconnect();
+        },
+
+        // close the socket connection.
+        close: function() {
+            closeSocket();
+        },
+
+        // topic subscribes to the server topic specified by name and returns
+        // its channel object. The server replays the topic history first.
+        // The subscription is renewed after each reconnection.
+        // Optional channel options can be passed.
+        topic: function(name, opts) {
+            if (!topics[name]) {
+                topics[name] = true;
+                sendTopicRequest(TopicRequests.Subscribe, name);
+            }
+
+            return channel.get(name, opts);
+        },
+
+        // unsubscribe from the server topic specified by name.
+        unsubscribeTopic: function(name) {
+            if (!topics[name]) {
+                return;
+            }
+
+            delete topics[name];
+            sendTopicRequest(TopicRequests.Unsubscribe, name);
+        },
+
+        // channel returns the given channel object specified by name
+        // to communicate in a separate channel than the default one.
+        // Optional channel options can be passed:
+        //  - json: enable or disable the JSON mode for this channel.
+        //  - ttl:  the default time to live in milliseconds for send data.
+        channel: function(name, opts) {
+            return channel.get(name, opts);
+        }
+    };
+
+    // Define the function body of the triggerEvent function.
+    triggerEvent = function() {
+        emitter.emit.apply(emitter, arguments);
+    };
+
+    // Return the newly created socket.
+    return socket;
+};
+
+// connect creates a new socket and returns a promise which is resolved
+// with the socket as soon as the connection is established.
+// The promise is rejected if the socket is disconnected before.
+// Usage: var socket = await glue.connect(host, options);
+// Additionally to the socket options, following options are available:
+//  - timeout: close the socket and reject the promise after the timeout in milliseconds.
+//  - signal:  an AbortSignal to cancel the connect attempt.
+glue.connect = function(host, options) {
+    'use strict';
+
+    return new Promise(function(resolve, reject) {
+        var signal = options ? options.signal : undefined,
+            timeout = false,
+            onConnected, onDisconnected, onAbort;
+
+        var newError = function(name, msg) {
+            var err = new Error(msg);
+            err.name = name;
+            return err;
+        };
+
+        if (signal && signal.aborted) {
+            reject(newError("AbortError", "glue: connect aborted"));
+            return;
+        }
+
+        var socket = glue(host, options);
+        if (!socket) {
+            reject(new Error("glue: invalid host"));
+            return;
+        }
+
+        var stop = function() {
+            if (timeout !== false) {
+                clearTimeout(timeout);
+                timeout = false;
+            }
+            if (signal) {
+                signal.removeEventListener("abort", onAbort);
+            }
+        };
+
+        var cancel = function(err) {
+            stop();
+            socket.off("connected", onConnected);
+            socket.off("disconnected", onDisconnected);
+            socket.close();
+            reject(err);
+        };
+
+        onAbort = function() {
+            cancel(newError("AbortError", "glue: connect aborted"));
+        };
+
+        if (signal) {
+            signal.addEventListener("abort", onAbort);
+        }
+
+        if (options && options.timeout > 0) {
+            timeout = setTimeout(function() {
+                timeout = false;
+                cancel(newError("TimeoutError", "glue: connect timed out"));
+            }, options.timeout);
+        }
+
+        onConnected = function() {
+            stop();
+            socket.off("disconnected", onDisconnected);
+            resolve(socket);
+        };
+
+        onDisconnected = function(info) {
+            stop();
+            socket.off("connected", onConnected);
+
+            // Pass the rejection code of the server.
+            if (info && info.rejection) {
+                var err = newError("RejectedError", "glue: server rejected the connection: " + info.rejection.message);
+                err.code = info.rejection.code;
+                reject(err);
+                return;
+            }
+
+            reject(new Error("glue: failed to connect to the server"));
+        };
+
+        socket.once("connected", onConnected);
+        socket.once("disconnected", onDisconnected);
+    });
+};
+
+// Include the shared socket mode.
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives outside of the glue function.
+ *  The client side of the shared socket mode.
+ */
+
+// shared creates a socket which shares a single connection with all other
+// browser tabs of the same origin. The connection lives in a SharedWorker
+// running the glue-sharedworker.js script located at the worker URL.
+// A normal socket is created if SharedWorkers are not supported.
+// The returned object provides the same methods as a normal socket.
+glue.shared = function(workerURL, host, options) {
+    // Turn on strict mode.
+    'use strict';
+
+    // Include the dependencies.
+    /*
+ *  This code lives inside the glue function.
+ */
+
+// Source: https://github.com/component/emitter
+
+
+/**
+ * Initialize a new `Emitter`.
+ *
+ * @api public
+ */
+
+function Emitter(obj) {
+  if (obj) return mixin(obj);
+}
+
+/**
+ * Mixin the emitter properties.
+ *
+ * @param {Object} obj
+ * @return {Object}
+ * @api private
+ */
+
+function mixin(obj) {
+  for (var key in Emitter.prototype) {
+    obj[key] = Emitter.prototype[key];
+  }
+  return obj;
+}
+
+/**
+ * Listen on the given `event` with `fn`.
+ *
+ * @param {String} event
+ * @param {Function} fn
+ * @return {Emitter}
+ * @api public
+ */
+
+Emitter.prototype.on =
+Emitter.prototype.addEventListener = function(event, fn){
+  this._callbacks = this._callbacks || {};
+  (this._callbacks['$' + event] = this._callbacks['$' + event] || [])
+    .push(fn);
+  return this;
+};
+
+/**
+ * Adds an `event` listener that will be invoked a single
+ * time then automatically removed.
+ *
+ * @param {String} event
+ * @param {Function} fn
+ * @return {Emitter}
+ * @api public
+ */
+
+Emitter.prototype.once = function(event, fn){
+  function on() {
+    this.off(event, on);
+    fn.apply(this, arguments);
+  }
+
+  on.fn = fn;
+  this.on(event, on);
+  return this;
+};
+
+/**
+ * Remove the given callback for `event` or all
+ * registered callbacks.
+ *
+ * @param {String} event
+ * @param {Function} fn
+ * @return {Emitter}
+ * @api public
+ */
+
+Emitter.prototype.off =
+Emitter.prototype.removeListener =
+Emitter.prototype.removeAllListeners =
+Emitter.prototype.removeEventListener = function(event, fn){
+  this._callbacks = this._callbacks || {};
+
+  // all
+  if (0 === arguments.length) {
+    this._callbacks = {};
+    return this;
+  }
+
+  // specific event
+  var callbacks = this._callbacks['$' + event];
+  if (!callbacks) return this;
+
+  // remove all handlers
+  if (1 == arguments.length) {
+    delete this._callbacks['$' + event];
+    return this;
+  }
+
+  // remove specific handler
+  var cb;
+  for (var i = 0; i < callbacks.length; i++) {
+    cb = callbacks[i];
+    if (cb === fn || cb.fn === fn) {
+      callbacks.splice(i, 1);
+      break;
+    }
+  }
+  return this;
+};
+
+/**
+ * Emit `event` with the given args.
+ *
+ * @param {String} event
+ * @param {Mixed} ...
+ * @return {Emitter}
+ */
+
+Emitter.prototype.emit = function(event){
+  this._callbacks = this._callbacks || {};
+  var args = [].slice.call(arguments, 1), callbacks = this._callbacks['$' + event];
+
+  if (callbacks) {
+    callbacks = callbacks.slice(0);
+    for (var i = 0, len = callbacks.length; i < len; ++i) {
+      callbacks[i].apply(this, args);
+    }
+  }
+
+  return this;
+};
+
+/**
+ * Return array of callbacks for `event`.
+ *
+ * @param {String} event
+ * @return {Array}
+ * @api public
+ */
+
+Emitter.prototype.listeners = function(event){
+  this._callbacks = this._callbacks || {};
+  return this._callbacks['$' + event] || [];
+};
+
+/**
+ * Check if this emitter has `event` handlers.
+ *
+ * @param {String} event
+ * @return {Boolean}
+ * @api public
+ */
+
+Emitter.prototype.hasListeners = function(event){
+  return !! this.listeners(event).length;
+};
+
+
+
+
+    /*
+     * Initialize section
+     */
+
+    // Fallback to a normal socket.
+    if (typeof SharedWorker === "undefined") {
+        return glue(host, options);
+    }
+
+    // Workers have no current location. Resolve the host string here.
+    if (!host) {
+        host = window.location.protocol + "//" + window.location.host;
+    }
+
+
+
+    /*
+     * Variables
+     */
+
+    var emitter         = new Emitter,
+        worker          = new SharedWorker(workerURL),
+        port            = worker.port,
+        state           = {
+            state:    "disconnected",
+            type:     "",
+            socketID: "",
+            version:  "",
+            info:     { state: "disconnected" },
+            clockOffset: 0
+        },
+        channels        = {},
+        discardCallbacks = {},
+        discardID       = 0;
+
+
+
+    /*
+     * Methods
+     */
+
+    var post = function(msg) {
+        port.postMessage(msg);
+    };
+
+    var getChannel = function(name) {
+        var c = channels[name];
+        if (c) {
+            return c;
+        }
+
+        c = {
+            onMessageFunc: function() {},
+            listeners:     []
+        };
+
+        c.instance = {
+            onMessage: function(f) {
+                c.onMessageFunc = f;
+            },
+
+            subscribe: function(f) {
+                c.listeners.push(f);
+
+                return function() {
+                    var i = c.listeners.indexOf(f);
+                    if (i >= 0) {
+                        c.listeners.splice(i, 1);
+                    }
+                };
+            },
+
+            // Returns 1 if the shared socket is connected and 0 otherwise.
+            // The data is discarded later if the socket fails to send it.
+            send: function(data, discardCallback, opts) {
+                if (!data) {
+                    return -1;
+                }
+
+                var id = 0;
+                if (discardCallback) {
+                    id = ++discardID;
+                    discardCallbacks[id] = discardCallback;
+                }
+
+                post({ type: "send", channel: name, data: data, id: id, ttl: opts && opts.ttl });
+
+                return (state.state === "connected") ? 1 : 0;
+            }
+        };
+
+        channels[name] = c;
+
+        // Tell the worker to forward the channel messages.
+        post({ type: "channel", channel: name });
+
+        return c;
+    };
+
+    var onMessage = function(msg) {
+        var i, c;
+
+        switch (msg.type) {
+        case "state":
+            state = msg.state;
+            break;
+
+        case "event":
+            emitter.emit.apply(emitter, [msg.name].concat(msg.args || []));
+            break;
+
+        case "message":
+            c = channels[msg.channel];
+            if (!c) {
+                return;
+            }
+
+            for (i = 0; i < c.listeners.length; i++) {
+                c.listeners[i](msg.data);
+            }
+
+            try {
+                c.onMessageFunc(msg.data);
+            }
+            catch(err) {
+                console.log("glue: channel '" + msg.channel + "': onMessage event call failed: " + err.message);
+            }
+            break;
+
+        case "discard":
+            if (discardCallbacks[msg.id]) {
+                discardCallbacks[msg.id](msg.data);
+            }
+            break;
+
+        case "sent":
+            delete discardCallbacks[msg.id];
+            break;
+        }
+    };
+
+    port.onmessage = function(e) {
+        onMessage(e.data);
+    };
+    port.start();
+
+    // Attach to the shared socket.
+    post({ type: "attach", host: host, options: options });
+
+    // Detach from the shared socket if the page is left.
+    window.addEventListener("pagehide", function() {
+        post({ type: "detach" });
+    });
+
+    var mainChannel = getChannel("m").instance;
+
+
+
+    /*
+     * Socket object
+     */
+
+    return {
+        version: function() {
+            return state.version;
+        },
+
+        type: function() {
+            return state.type;
+        },
+
+        state: function() {
+            return state.state;
+        },
+
+        stateInfo: function() {
+            return state.info;
+        },
+
+        clockOffset: function() {
+            return state.clockOffset;
+        },
+
+        socketID: function() {
+            return state.socketID;
+        },
+
+        send: function(data, discardCallback, opts) {
+            return mainChannel.send(data, discardCallback, opts);
+        },
+
+        onMessage: function(f) {
+            mainChannel.onMessage(f);
+        },
+
+        subscribe: function(f) {
+            return mainChannel.subscribe(f);
+        },
+
+        on: function() {
+            emitter.on.apply(emitter, arguments);
+        },
+
+        once: function() {
+            emitter.once.apply(emitter, arguments);
+        },
+
+        off: function() {
+            emitter.off.apply(emitter, arguments);
+        },
+
+        reconnect: function() {
+            post({ type: "reconnect" });
+        },
+
+        // close detaches this tab from the shared socket.
+        // The connection is closed as soon as no tab is attached anymore.
+        close: function() {
+            post({ type: "detach" });
+        },
+
+        channel: function(name) {
+            if (!name) {
+                return false;
+            }
+            return getChannel(name).instance;
+        },
+
+        // topic subscribes the shared connection to the server topic.
+        // The subscription is kept until the connection is closed.
+        topic: function(name) {
+            if (!name) {
+                return false;
+            }
+            var c = getChannel(name).instance;
+            post({ type: "topic", channel: name });
+            return c;
+        },
+
+        unsubscribeTopic: function() {}
+    };
+};
+
+
+// Include the logical socket multiplexing.
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives outside of the glue function.
+ *  Multiplexes logical sockets over one connection.
+ */
+
+// mux creates a carrier connection which transports multiple logical sockets.
+// Each logical socket created with the socket method is a complete glue socket
+// with its own socket ID, channels and lifecycle. All logical sockets share
+// the physical connection of the carrier.
+glue.mux = function(host, options) {
+    // Turn on strict mode.
+    'use strict';
+
+    /*
+     * Constants
+     */
+
+    var MuxChannelName = "_mux",
+        Delimiter = "&";
+
+    var FrameTypes = {
+        Data:   "d",
+        Close:  "c"
+    };
+
+
+
+    /*
+     * Variables
+     */
+
+    var sockets     = {},   // The opened logical backend sockets by ID.
+        pending     = [],   // Logical backend sockets waiting for the carrier connection.
+        idCount     = 0,
+        logical     = [],   // The created logical glue sockets.
+        carrier,
+        muxChannel;
+
+
+
+    /*
+     * Private Methods
+     */
+
+    var extend = function(dst) {
+        for (var i = 1; i < arguments.length; i++) {
+            for (var key in arguments[i]) {
+                if (arguments[i] && arguments[i].hasOwnProperty(key)) {
+                    dst[key] = arguments[i][key];
+                }
+            }
+        }
+        return dst;
+    };
+
+    var sendFrame = function(type, id, data) {
+        muxChannel.send(type + String(id.length) + Delimiter + id + data);
+    };
+
+    var openSocket = function(bs, id) {
+        sockets[id] = bs;
+
+        // Trigger the open event during the next tick.
+        setTimeout(function() {
+            if (sockets[id] === bs) {
+                bs.onOpen();
+            }
+        }, 0);
+    };
+
+    // The transport passed to the logical backend sockets.
+    var transport = {
+        open: function(bs) {
+            idCount += 1;
+            var id = String(idCount);
+
+            if (carrier.state() === "connected") {
+                openSocket(bs, id);
+            } else {
+                pending.push({ bs: bs, id: id });
+            }
+
+            return id;
+        },
+
+        send: function(id, data) {
+            if (sockets[id]) {
+                sendFrame(FrameTypes.Data, id, data);
+            }
+        },
+
+        close: function(id) {
+            // Remove a pending socket.
+            for (var i = 0; i < pending.length; i++) {
+                if (pending[i].id === id) {
+                    pending.splice(i, 1);
+                    return;
+                }
+            }
+
+            if (!sockets[id]) {
+                return;
+            }
+
+            delete sockets[id];
+            sendFrame(FrameTypes.Close, id, "");
+        }
+    };
+
+    var onFrame = function(frame) {
+        var type = frame.charAt(0),
+            data = frame.substr(1),
+            pos = data.indexOf(Delimiter),
+            len = parseInt(data.substring(0, pos), 10);
+
+        if (pos < 0 || isNaN(len)) {
+            console.log("glue: mux: received invalid frame");
+            return;
+        }
+
+        var id = data.substr(pos + 1, len),
+            bs = sockets[id];
+        data = data.substr(pos + 1 + len);
+
+        // Ignore frames of closed logical sockets.
+        if (!bs) {
+            return;
+        }
+
+        if (type === FrameTypes.Data) {
+            bs.onMessage(data);
+        } else if (type === FrameTypes.Close) {
+            delete sockets[id];
+            bs.onClose();
+        }
+    };
+
+    var onCarrierState = function(info) {
+        var id;
+
+        // Open all pending logical sockets.
+        if (info.state === "connected") {
+            var p = pending;
+            pending = [];
+            for (var i = 0; i < p.length; i++) {
+                openSocket(p[i].bs, p[i].id);
+            }
+            return;
+        }
+
+        // The carrier connection was lost. Close all logical sockets.
+        // They reconnect as soon as the carrier is connected again.
+        var s = sockets;
+        sockets = {};
+        for (id in s) {
+            if (s.hasOwnProperty(id)) {
+                s[id].onClose();
+            }
+        }
+    };
+
+
+
+    /*
+     * Initialize section
+     */
+
+    // Create the carrier socket.
+    carrier = glue(host, extend({}, options, {
+        muxCarrier:         true,
+        clockSyncSamples:   0,
+        offlineQueue:       false
+    }));
+    if (!carrier) {
+        return;
+    }
+
+    muxChannel = carrier.channel(MuxChannelName, { json: false });
+    muxChannel.onMessage(onFrame);
+    carrier.on("statechange", onCarrierState);
+
+
+
+    /*
+     * Public Instance
+     */
+
+    return {
+        // carrier returns the glue socket of the physical connection.
+        carrier: function() {
+            return carrier;
+        },
+
+        // socket creates a new logical socket with optional socket options.
+        socket: function(opts) {
+            var socket = glue(host, extend({}, options, opts, {
+                muxTransport: transport
+            }));
+            if (socket) {
+                logical.push(socket);
+            }
+            return socket;
+        },
+
+        // close the carrier connection and all logical sockets.
+        close: function() {
+            for (var i = 0; i < logical.length; i++) {
+                logical[i].close();
+            }
+            logical = [];
+
+            carrier.close();
+        }
+    };
+};
+
+
+
+// createClient creates a new socket and connects to the server.
+// This is equal to the glue function.
+export var createClient = glue;
+
+// connect creates a new socket and returns a promise which is resolved
+// with the socket as soon as the connection is established.
+export var connect = glue.connect;
+
+export default glue;
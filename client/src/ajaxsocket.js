@@ -26,9 +26,12 @@ var newAjaxSocket = function () {
      * Constants
      */
 
-    var ajaxHost = host + options.baseURL + "ajax",
+    var ajaxHost = host + options.baseURL + "ajax" + routingQuery(),
         sendTimeout = 8000,
-        pollTimeout = 45000;
+        pollTimeoutMargin = 10000,
+
+        // The ajax transport protocol version passed with the init request.
+        ajaxProtocolVersion = "2";
 
     var PollCommands = {
         Timeout:    "t",
@@ -38,7 +41,7 @@ var newAjaxSocket = function () {
     var Commands = {
         Delimiter:  "&",
         Init:       "i",
-        Push:       "u",
+        Sequenced:  "s",
         Poll:       "o"
     };
 
@@ -52,8 +55,23 @@ var newAjaxSocket = function () {
         uid, pollToken,
         pollXhr = false,
         sendXhr = false,
+        stopped = false,
+        pushing = false,  // Set while a push request is in flight.
+        pushQueue = [],   // Messages queued during a push request.
+        pushSeq = 0,      // The sequence number of the last push request.
         poll;
 
+    // The ajax options are passed by the server with the init response.
+    var ajaxOptions = {
+        pollTimeout:    35000,
+        pollDelay:      0,
+        pushRetries:    0,
+        pushRetryDelay: 1000
+    };
+
+    // Ajax requests are text based. Binary data has to be encoded.
+    s.binary = false;
+
 
 
     /*
@@ -65,6 +83,9 @@ var newAjaxSocket = function () {
         // This will prevent further poll calls.
         poll = function() {};
 
+        // Prevent further push retries.
+        stopped = true;
+
         // Kill the ajax requests.
         if (pollXhr) {
             pollXhr.abort();
@@ -75,7 +96,7 @@ var newAjaxSocket = function () {
     };
 
     var postAjax = function(url, timeout, data, success, error) {
-        var xhr = window.XMLHttpRequest ? new XMLHttpRequest() : new ActiveXObject("Microsoft.XMLHTTP");
+        var xhr = new env.XMLHttpRequest();
 
         xhr.onload = function() {
           success(xhr.response);
@@ -121,7 +142,11 @@ var newAjaxSocket = function () {
         s.onError(msg);
     };
 
-    var send = function (data, callback) {
+    var send = function (data, callback, retries) {
+        if (retries === undefined) {
+            retries = ajaxOptions.pushRetries;
+        }
+
         sendXhr = postAjax(ajaxHost, sendTimeout, data, function (data) {
             sendXhr = false;
 
@@ -130,14 +155,71 @@ var newAjaxSocket = function () {
             }
         }, function (msg) {
             sendXhr = false;
+
+            // Retry the push after the delay if retries are left.
+            if (retries > 0) {
+                setTimeout(function() {
+                    if (!stopped) {
+                        send(data, callback, retries - 1);
+                    }
+                }, ajaxOptions.pushRetryDelay);
+                return;
+            }
+
             triggerError(msg);
         });
     };
 
+    // push sends the queued messages. Several messages are
+    // sent with one push request in a length-prefixed encoding.
+    // The length prefix is the UTF-8 byte length of the message.
+    // Each push carries a sequence number and the server drops
+    // replayed or retried requests with a known sequence number.
+    var push = function() {
+        if (pushQueue.length === 0) {
+            pushing = false;
+            return;
+        }
+
+        pushSeq++;
+        var data = Commands.Sequenced + uid + Commands.Delimiter + String(pushSeq) + Commands.Delimiter;
+        for (var i = 0; i < pushQueue.length; i++) {
+            data += String(utils.encodeUTF8(pushQueue[i]).length) + Commands.Delimiter + pushQueue[i];
+        }
+
+        pushQueue = [];
+        pushing = true;
+
+        // Send the messages queued in between afterwards.
+        send(data, push);
+    };
+
+    // setOptions applies the ajax options passed by the server.
+    var setOptions = function(data) {
+        if (!data) {
+            return;
+        }
+
+        try {
+            var o = JSON.parse(data);
+            for (var key in ajaxOptions) {
+                if (typeof o[key] === typeof ajaxOptions[key] && !(o[key] < 0)) {
+                    ajaxOptions[key] = o[key];
+                }
+            }
+        }
+        catch(err) {
+            console.log("glue: failed to parse the ajax options: " + err.message);
+        }
+    };
+
     poll = function () {
         var data = Commands.Poll + uid + Commands.Delimiter + pollToken;
 
-        pollXhr = postAjax(ajaxHost, pollTimeout, data, function (data) {
+        // The request timeout is longer than the server's poll timeout.
+        var timeout = ajaxOptions.pollTimeout + pollTimeoutMargin;
+
+        pollXhr = postAjax(ajaxHost, timeout, data, function (data) {
           pollXhr = false;
 
           // Check if this jax request has reached the server's timeout.
@@ -166,7 +248,15 @@ var newAjaxSocket = function () {
           data = data.substr(i + 1);
 
           // Start the next poll request.
-          poll();
+          // Messages are collected on the server during the poll delay.
+          if (ajaxOptions.pollDelay > 0) {
+              setTimeout(function() {
+                  poll();
+              }, ajaxOptions.pollDelay);
+          }
+          else {
+              poll();
+          }
 
           // Call the event.
           s.onMessage(data);
@@ -184,7 +274,7 @@ var newAjaxSocket = function () {
 
     s.open = function () {
         // Initialize the ajax socket session
-        send(Commands.Init, function (data) {
+        send(Commands.Init + ajaxProtocolVersion, function (data) {
             // Get the uid and token string
             var i = data.indexOf(Commands.Delimiter);
             if (i < 0) {
@@ -196,6 +286,13 @@ var newAjaxSocket = function () {
             uid = data.substring(0, i);
             pollToken = data.substr(i + 1);
 
+            // The ajax options follow the token.
+            i = pollToken.indexOf(Commands.Delimiter);
+            if (i >= 0) {
+                setOptions(pollToken.substr(i + 1));
+                pollToken = pollToken.substring(0, i);
+            }
+
             // Start the long polling process.
             poll();
 
@@ -205,8 +302,11 @@ var newAjaxSocket = function () {
     };
 
     s.send = function (data) {
-        // Always prepend the command with the uid to the data.
-        send(Commands.Push + uid + Commands.Delimiter + data);
+        // Queue the message while a push request is in flight.
+        pushQueue.push(data);
+        if (!pushing) {
+            push();
+        }
     };
 
 	s.reset = function() {
@@ -38,7 +38,30 @@ var channel = (function() {
          // Create the channel object.
          var channel = {
              // Set to a dummy function.
-             onMessageFunc: function() {}
+             onMessageFunc: function() {},
+
+             // Pending request promises waiting for a reply message.
+             requests: [],
+
+             // Active async iterators receiving all messages.
+             iterators: [],
+
+             // Additional message listeners added with subscribe.
+             listeners: [],
+
+             // If true, values are JSON encoded and received messages are JSON decoded.
+             json: options.json === true,
+
+             // The default time to live in milliseconds for send data.
+             // Zero disables the time to live.
+             ttl: 0,
+
+             // If true, send messages are resent until the server acknowledges them.
+             reliable: false,
+
+             // The IDs of the last received reliable messages.
+             seen:       {},
+             seenOrder:  []
          };
 
          // Set the channel public instance object.
@@ -49,74 +72,316 @@ var channel = (function() {
                  channel.onMessageFunc = f;
              },
 
-             // send a data string to the channel.
+             // subscribe adds a function which is triggered as soon as a message
+             // is received. In contrast to onMessage, multiple functions can be added.
+             // A function is returned which removes the listener again.
+             subscribe: function(f) {
+                 channel.listeners.push(f);
+
+                 return function() {
+                     var i = channel.listeners.indexOf(f);
+                     if (i >= 0) {
+                         channel.listeners.splice(i, 1);
+                     }
+                 };
+             },
+
+             // send a data string or binary data to the channel.
+             // Binary data can be an ArrayBuffer, a TypedArray, a DataView or a Blob.
+             // In JSON mode any other value is JSON encoded.
              // One optional discard callback can be passed.
              // It is called if the data could not be send to the server.
              // The data is passed as first argument to the discard callback.
+             // Optional send options can be passed:
+             //  - ttl: discard the data if it could not be send within the
+             //         time to live in milliseconds. Overrides the channel ttl.
+             //  - id:  the message ID of reliable channels passed to the server
+             //         handlers. Use it as idempotency key or correlation value.
+             //         A unique ID is generated if not set.
              // returns:
              //  1 if immediately send,
              //  0 if added to the send queue and
              //  -1 if discarded.
-             send: function(data, discardCallback) {
+             send: function(data, discardCallback, opts) {
+                 var ttl = (opts && opts.ttl !== undefined) ? opts.ttl : channel.ttl;
+
+                 // Encode the value in JSON mode.
+                 // The discard callback is called with the original value.
+                 if (channel.json && !utils.isBinary(data)) {
+                     var value = data;
+                     data = JSON.stringify(value);
+
+                     if (discardCallback && utils.isFunction(discardCallback)) {
+                         var f = discardCallback;
+                         discardCallback = function() {
+                             f(value);
+                         };
+                     }
+                 }
+
                  // Discard empty data.
                  if (!data) {
                      return -1;
                  }
 
+                 // Blobs are read asynchronously.
+                 // Send the data as soon as the content is available.
+                 if (utils.isBlob(data)) {
+                     utils.readBlob(data, function(buf) {
+                         sendBufferedBinary(name, buf, discardCallback, ttl);
+                     });
+                     return 0;
+                 }
+
+                 // Send binary data.
+                 if (utils.isBinary(data)) {
+                     return sendBufferedBinary(name, data, discardCallback, ttl);
+                 }
+
+                 // Send the data until acknowledged in reliable mode.
+                 if (channel.reliable) {
+                     return sendReliable(name, data, opts && opts.id);
+                 }
+
                  // Call the helper method and send the data to the channel.
-                 return sendBuffered(Commands.ChannelData, utils.marshalValues(name, data), discardCallback);
+                 return sendBuffered(Commands.ChannelData, utils.marshalValues(name, data), discardCallback, ttl);
+             },
+
+             // request sends the data to the channel and returns a promise
+             // which is resolved with the next message received on this channel.
+             // Requests are resolved in the order they were send.
+             // The promise is rejected if the data could not be send to the server.
+             // Messages resolving a request are not passed to the onMessage function.
+             // Optional options can be passed:
+             //  - timeout: reject the promise after the timeout in milliseconds.
+             //  - signal:  an AbortSignal to cancel the request.
+             // The reply of a canceled request is still consumed to keep the order.
+             request: function(data, opts) {
+                 return new Promise(function(resolve, reject) {
+                     var stopWatch;
+
+                     var r = {
+                         resolve: function(v) {
+                             stopWatch();
+                             resolve(v);
+                         },
+                         reject:  reject
+                     };
+
+                     var discard = function() {
+                         stopWatch();
+                         removeRequest(channel, r);
+                         reject(new Error("glue: channel '" + name + "': request data discarded"));
+                     };
+
+                     // Cancel the request on timeout or abort.
+                     // Replace the resolve function to discard the reply.
+                     var canceled = false;
+                     stopWatch = utils.watchCancel(opts, "channel '" + name + "': request", function(err) {
+                         canceled = true;
+                         r.resolve = function() {};
+                         reject(err);
+                     });
+
+                     // Don't send the data if already aborted.
+                     if (canceled) {
+                         return;
+                     }
+
+                     channel.requests.push(r);
+
+                     if (channel.instance.send(data, discard) < 0) {
+                         discard();
+                     }
+                 });
              }
          };
 
+         // Add async iteration support if available.
+         // Usage: for await (const data of channel) { ... }
+         if (typeof Symbol !== "undefined" && Symbol.asyncIterator) {
+             channel.instance[Symbol.asyncIterator] = function() {
+                 return newIterator(channel);
+             };
+         }
+
          // Return the channel object.
          return channel;
      };
 
 
 
+     var removeRequest = function(channel, r) {
+         var i = channel.requests.indexOf(r);
+         if (i >= 0) {
+             channel.requests.splice(i, 1);
+         }
+     };
+
+     // newIterator creates an async iterator which receives
+     // all messages of the channel.
+     var newIterator = function(channel) {
+         var it = {
+             queue:   [], // Received messages which were not consumed yet.
+             waiting: []  // Resolve functions of pending next calls.
+         };
+
+         it.push = function(data) {
+             if (it.waiting.length > 0) {
+                 it.waiting.shift()({ value: data, done: false });
+                 return;
+             }
+             it.queue.push(data);
+         };
+
+         channel.iterators.push(it);
+
+         return {
+             next: function() {
+                 if (it.queue.length > 0) {
+                     return Promise.resolve({ value: it.queue.shift(), done: false });
+                 }
+                 if (it.done) {
+                     return Promise.resolve({ value: undefined, done: true });
+                 }
+
+                 return new Promise(function(resolve) {
+                     it.waiting.push(resolve);
+                 });
+             },
+
+             // return is called if the for await loop is left.
+             return: function() {
+                 it.done = true;
+                 it.queue = [];
+
+                 var i = channel.iterators.indexOf(it);
+                 if (i >= 0) {
+                     channel.iterators.splice(i, 1);
+                 }
+
+                 // Release pending next calls.
+                 while (it.waiting.length > 0) {
+                     it.waiting.shift()({ value: undefined, done: true });
+                 }
+
+                 return Promise.resolve({ value: undefined, done: true });
+             }
+         };
+     };
+
+
+
      /*
       * Public Methods
       */
 
      // Get or create a channel if it does not exists.
-     instance.get = function(name) {
+     // Optional channel options can be passed:
+     //  - json:     enable or disable the JSON mode for this channel.
+     //  - ttl:      the default time to live in milliseconds for send data.
+     //  - reliable: resend string messages until the server acknowledges them.
+     //              The discard callback and the time to live are not applied.
+     instance.get = function(name, opts) {
          if (!name) {
              return false;
          }
 
          // Get the channel.
          var c = channels[name];
-         if (c) {
-             return c.instance;
+         if (!c) {
+             // Create a new one, if it does not exists and add it to the map.
+             c = newChannel(name);
+             channels[name] = c;
          }
 
-         // Create a new one, if it does not exists and add it to the map.
-         c = newChannel(name);
-         channels[name] = c;
+         // Apply the channel options.
+         if (opts && opts.json !== undefined) {
+             c.json = opts.json === true;
+         }
+         if (opts && opts.ttl !== undefined) {
+             c.ttl = opts.ttl;
+         }
+         if (opts && opts.reliable !== undefined) {
+             c.reliable = opts.reliable === true;
+         }
 
          return c.instance;
      };
 
-     instance.emitOnMessage = function(name, data) {
+     // emitOnMessage passes the received data to the channel. The optional
+     // message ID of reliable channels is passed as second argument to the
+     // subscribed listeners and the onMessage function.
+     // Returns false if the channel does not exist.
+     instance.emitOnMessage = function(name, data, id) {
          if (!name || !data) {
-             return;
+             return false;
          }
 
          // Get the channel.
          var c = channels[name];
          if (!c) {
              console.log("glue: channel '" + name + "': emit onMessage event: channel does not exists");
-             return;
+             return false;
+         }
+
+         // Discard redelivered messages of reliable channels.
+         if (id !== undefined) {
+             if (c.seen.hasOwnProperty(id)) {
+                 return true;
+             }
+
+             c.seen[id] = true;
+             c.seenOrder.push(id);
+             while (c.seenOrder.length > options.dedupWindow) {
+                 delete c.seen[c.seenOrder.shift()];
+             }
+         }
+
+         // Decode the message in JSON mode.
+         // Binary data is passed as it is.
+         if (c.json && typeof data === "string") {
+             try {
+                 data = JSON.parse(data);
+             }
+             catch(err) {
+                 console.log("glue: channel '" + name + "': failed to decode JSON message: " + err.message);
+                 return true;
+             }
+         }
+
+         // Resolve the oldest pending request.
+         if (c.requests.length > 0) {
+             c.requests.shift().resolve(data);
+             return true;
+         }
+
+         // Pass the data to all async iterators.
+         var i;
+         for (i = 0; i < c.iterators.length; i++) {
+             c.iterators[i].push(data);
+         }
+
+         // Call the subscribed listeners.
+         var listeners = c.listeners.slice(0);
+         for (i = 0; i < listeners.length; i++) {
+             try {
+                 listeners[i](data, id);
+             }
+             catch(err) {
+                 console.log("glue: channel '" + name + "': subscribed listener call failed: " + err.message);
+             }
          }
 
          // Call the channel's on message event.
          try {
-             c.onMessageFunc(data);
+             c.onMessageFunc(data, id);
          }
          catch(err) {
              console.log("glue: channel '" + name + "': onMessage event call failed: " + err.message);
-             return;
          }
+
+         return true;
      };
 
      return instance;
@@ -5,14 +5,6 @@
 // Source: https://github.com/component/emitter
 
 
-/**
- * Expose `Emitter`.
- */
-
-if (typeof module !== 'undefined') {
-  module.exports = Emitter;
-}
-
 /**
  * Initialize a new `Emitter`.
  *
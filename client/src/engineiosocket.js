@@ -0,0 +1,85 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+// The engine.io socket layer carries the glue protocol with the engine.io
+// client and its polling and websocket transports. The server has to enable
+// the engine.io endpoint. Pass the engine.io client socket constructor with
+// glue.env if it is not global.
+var newEngineIOSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        sock;
+
+    // The glue messages are passed as strings.
+    s.binary = false;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        try {
+            // The engine.io client takes the path with the options.
+            var o = utils.extend({}, options.engineIOOptions || {});
+            o.path = options.baseURL + "engine.io/";
+
+            sock = new env.EngineIO(host + routingQuery(), o);
+
+            // Set the callback handlers
+            sock.on("message", function(data) {
+                s.onMessage(String(data));
+            });
+
+            sock.on("close", function() {
+                s.onClose();
+            });
+
+            sock.on("open", function() {
+                s.onOpen();
+            });
+        } catch (e) {
+            s.onError();
+        }
+    };
+
+    s.send = function (data) {
+        // Send the data to the server
+        sock.send(data);
+    };
+
+    s.reset = function() {
+        // Close the engine.io socket if defined.
+        if (sock) {
+            sock.close();
+        }
+
+        sock = undefined;
+    };
+
+    return s;
+};
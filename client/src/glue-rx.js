@@ -0,0 +1,121 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  Optional RxJS bindings for the glue socket.
+ *  This file is not part of the glue library bundle.
+ */
+
+// glueRx wraps a glue socket and exposes the connection state and
+// the received messages as RxJS observables.
+// The RxJS Observable constructor can be passed optionally. This prevents
+// a dependency on a specific RxJS version. The global rxjs.Observable
+// is used if not set.
+var glueRx = function(socket, Observable) {
+    // Turn on strict mode.
+    'use strict';
+
+    /*
+     * Constants
+     */
+
+    var StateEvents = ["connecting", "connected", "reconnecting", "waiting", "disconnected"];
+
+
+
+    /*
+     * Initialize section
+     */
+
+    if (!Observable) {
+        if (typeof rxjs === "undefined" || !rxjs.Observable) {
+            throw new Error("glue: rx: no RxJS Observable constructor available");
+        }
+        Observable = rxjs.Observable;
+    }
+
+
+
+    /*
+     * Methods
+     */
+
+    // fromChannel creates an observable emitting all messages of the glue channel.
+    var fromChannel = function(c) {
+        return new Observable(function(subscriber) {
+            return c.subscribe(function(data) {
+                subscriber.next(data);
+            });
+        });
+    };
+
+    // fromEvent creates an observable emitting the arguments of the socket event.
+    // The value is an array if the event has multiple arguments.
+    var fromEvent = function(event) {
+        return new Observable(function(subscriber) {
+            var f = function() {
+                subscriber.next(arguments.length > 1 ? Array.prototype.slice.call(arguments) : arguments[0]);
+            };
+
+            socket.on(event, f);
+
+            return function() {
+                socket.off(event, f);
+            };
+        });
+    };
+
+
+
+    /*
+     * Rx object
+     */
+
+    return {
+        // state$ emits the current socket state and all state changes.
+        state$: new Observable(function(subscriber) {
+            var f = function() {
+                subscriber.next(socket.state());
+            };
+
+            // Emit the current state first.
+            f();
+
+            for (var i = 0; i < StateEvents.length; i++) {
+                socket.on(StateEvents[i], f);
+            }
+
+            return function() {
+                for (var i = 0; i < StateEvents.length; i++) {
+                    socket.off(StateEvents[i], f);
+                }
+            };
+        }),
+
+        // messages$ emits all messages received on the main channel.
+        messages$: fromChannel(socket),
+
+        // channel returns an observable emitting all messages of the named channel.
+        channel: function(name) {
+            return fromChannel(socket.channel(name));
+        },
+
+        // event returns an observable emitting the socket event.
+        event: fromEvent
+    };
+};
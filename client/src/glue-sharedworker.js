@@ -0,0 +1,196 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  SharedWorker script of the shared socket mode.
+ *  Holds one glue socket per host and options combination and
+ *  shares it with all attached browser tabs.
+ *  Create the client side with glue.shared(workerURL, host, options).
+ */
+
+@@include('./glue.js')
+
+(function() {
+    // Turn on strict mode.
+    'use strict';
+
+    /*
+     * Constants
+     */
+
+    var Events = [
+        "connected", "connecting", "disconnected", "reconnecting", "waiting", "statechange",
+        "error", "connect_timeout", "timeout", "discard_send_buffer", "clock_sync",
+        "rejected", "maintenance", "going_away",
+        "idle_warning", "capacity"
+    ];
+
+
+
+    /*
+     * Variables
+     */
+
+    var shared = {}; // Shared sockets by key.
+
+
+
+    /*
+     * Methods
+     */
+
+    var broadcast = function(s, msg) {
+        for (var i = 0; i < s.ports.length; i++) {
+            s.ports[i].postMessage(msg);
+        }
+    };
+
+    var stateOf = function(s) {
+        return {
+            type:  "state",
+            state: {
+                state:    s.socket.state(),
+                type:     s.socket.type() || "",
+                socketID: s.socket.socketID(),
+                version:  s.socket.version(),
+                info:     s.socket.stateInfo(),
+                clockOffset: s.socket.clockOffset()
+            }
+        };
+    };
+
+    var newShared = function(key, host, options) {
+        var socket = glue(host, options);
+        if (!socket) {
+            return false;
+        }
+
+        var s = {
+            key:      key,
+            socket:   socket,
+            ports:    [],
+            channels: {}
+        };
+
+        // Forward the socket events to all tabs.
+        Events.forEach(function(name) {
+            socket.on(name, function() {
+                broadcast(s, stateOf(s));
+                broadcast(s, {
+                    type: "event",
+                    name: name,
+                    args: Array.prototype.slice.call(arguments)
+                });
+            });
+        });
+
+        shared[key] = s;
+        return s;
+    };
+
+    var forwardChannel = function(s, name) {
+        if (s.channels[name]) {
+            return;
+        }
+
+        s.channels[name] = s.socket.channel(name).subscribe(function(data) {
+            broadcast(s, { type: "message", channel: name, data: data });
+        });
+    };
+
+    var detach = function(s, port) {
+        var i = s.ports.indexOf(port);
+        if (i < 0) {
+            return;
+        }
+        s.ports.splice(i, 1);
+
+        // Close the connection if no tab is attached anymore.
+        if (s.ports.length === 0) {
+            s.socket.close();
+            delete shared[s.key];
+        }
+    };
+
+    var onConnect = function(port) {
+        var s = false;
+
+        port.onmessage = function(e) {
+            var msg = e.data;
+
+            if (msg.type === "attach") {
+                var key = msg.host + "|" + JSON.stringify(msg.options || {});
+
+                s = shared[key] || newShared(key, msg.host, msg.options);
+                if (!s) {
+                    return;
+                }
+
+                s.ports.push(port);
+                port.postMessage(stateOf(s));
+
+                // Tell the new tab if the socket is already connected.
+                if (s.socket.state() === "connected") {
+                    port.postMessage({ type: "event", name: "connected", args: [] });
+                }
+                return;
+            }
+
+            if (!s) {
+                return;
+            }
+
+            switch (msg.type) {
+            case "detach":
+                detach(s, port);
+                s = false;
+                break;
+
+            case "reconnect":
+                s.socket.reconnect();
+                break;
+
+            case "channel":
+                forwardChannel(s, msg.channel);
+                break;
+
+            case "topic":
+                s.socket.topic(msg.channel);
+                forwardChannel(s, msg.channel);
+                break;
+
+            case "send":
+                var r = s.socket.channel(msg.channel).send(msg.data, function(data) {
+                    if (msg.id) {
+                        port.postMessage({ type: "discard", id: msg.id, data: data });
+                    }
+                }, { ttl: msg.ttl });
+                if (r === 1 && msg.id) {
+                    port.postMessage({ type: "sent", id: msg.id });
+                }
+                break;
+            }
+        };
+
+        port.start();
+    };
+
+    self.onconnect = function(e) {
+        onConnect(e.ports[0]);
+    };
+})();
@@ -0,0 +1,34 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  ES module build of the glue library.
+ *  The glue function is scoped to this module.
+ */
+
+@@include('./glue.js')
+
+// createClient creates a new socket and connects to the server.
+// This is equal to the glue function.
+export var createClient = glue;
+
+// connect creates a new socket and returns a promise which is resolved
+// with the socket as soon as the connection is established.
+export var connect = glue.connect;
+
+export default glue;
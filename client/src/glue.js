@@ -24,6 +24,9 @@ var glue = function(host, options) {
     @@include('./emitter.js')
     @@include('./websocket.js')
     @@include('./ajaxsocket.js')
+    @@include('./muxsocket.js')
+    @@include('./sockjssocket.js')
+    @@include('./engineiosocket.js')
 
 
 
@@ -31,12 +34,53 @@ var glue = function(host, options) {
      * Constants
      */
 
-    var Version         = "1.9.1",
-        MainChannelName = "m";
+    var Version         = "2.0.0",
+        MainChannelName = "m",
+
+        // The reserved channel name used for the clock synchronization.
+        ClockChannelName = "_clock",
+
+        // The reserved channel name used to subscribe to server topics.
+        TopicChannelName = "_topic",
+
+        // The reserved channel name used for messages requesting
+        // a receipt and the acknowledgements.
+        ReceiptChannelName = "_ack",
+
+        // The reserved channel name used for the messages of reliable
+        // channels and the acknowledgements.
+        ReliableChannelName = "_rel",
+
+        // The reserved channel name used to notify about maintenance mode changes.
+        MaintenanceChannelName = "_maintenance",
+
+        // The reserved channel name used to notify if the server is near its capacity.
+        CapacityChannelName = "_capacity";
+
+    // Reliable channel request types.
+    var ReliableRequests = {
+        Message:    "m",
+        Ack:        "a"
+    };
+
+    // Topic request types.
+    var TopicRequests = {
+        Subscribe:      "s",
+        Unsubscribe:    "u"
+    };
+
+    // Clock synchronization message types.
+    var ClockMessages = {
+        Sample: "s",
+        Offset: "o"
+    };
 
     var SocketTypes = {
         WebSocket:  "WebSocket",
-        AjaxSocket: "AjaxSocket"
+        AjaxSocket:     "AjaxSocket",
+        MuxSocket:      "MuxSocket",
+        SockJSSocket:   "SockJSSocket",
+        EngineIOSocket: "EngineIOSocket"
     };
 
     var Commands = {
@@ -47,24 +91,69 @@ var glue = function(host, options) {
         Close: 	            'cl',
         Invalid:            'iv',
         DontAutoReconnect:  'dr',
-        ChannelData:        'cd'
+        ChannelData:        'cd',
+        ChannelBinaryData:  'cb',
+        Reject:             'rj',
+        GoingAway:          'ga',
+        IdleWarning:        'iw',
+        Reconnect:          'rc'
     };
 
     var States = {
         Disconnected:   "disconnected",
         Connecting:     "connecting",
         Reconnecting:   "reconnecting",
+        Waiting:        "waiting",
         Connected:      "connected"
     };
 
+    // The reasons passed with the disconnected state.
+    var DisconnectReasons = {
+        Closed:             "closed",               // Closed by the client.
+        ReconnectDisabled:  "reconnect_disabled",   // Automatic reconnections are disabled by the options.
+        MaxAttempts:        "max_attempts",         // The maximum reconnect attempts were reached.
+        ServerRequest:      "server_request",       // The server requested to not reconnect.
+        Rejected:           "rejected"              // The server rejected the connection.
+    };
+
     var DefaultOptions = {
         // The base URL is appended to the host string. This value has to match with the server value.
         baseURL: "/glue/",
 
         // Force a socket type.
-        // Values: false, "WebSocket", "AjaxSocket"
+        // Values: false, "WebSocket", "AjaxSocket", "SockJSSocket", "EngineIOSocket"
+        // The SockJSSocket type requires the SockJS client library and the
+        // EngineIOSocket type the engine.io client library.
         forceSocketType: false,
 
+        // The options passed to the SockJS client of the SockJSSocket type,
+        // for example the allowed transports.
+        sockJSOptions: false,
+
+        // The options passed to the engine.io client of the EngineIOSocket
+        // type, for example the transports. The path is set by glue.
+        engineIOOptions: false,
+
+        // The server namespace to connect to (e.g. "/chat").
+        // The default namespace is used if empty.
+        namespace: "",
+
+        // The authentication value passed to the namespace authentication hook.
+        auth: "",
+
+        // The handshake payload passed to the server OnHandshake hook.
+        handshake: "",
+
+        // The single-use connect ticket issued by the server NewConnectTicket method.
+        // The server passes a renewed ticket for the next reconnect.
+        ticket: "",
+
+        // The stable client ID passed with each reconnect. The server tracks the
+        // reliable channel acknowledgements and redeliveries per client ID.
+        // Only letters, digits, '-', '.' and '_' are allowed, up to 64 characters.
+        // Default: a random ID kept in the session storage of the browser tab.
+        clientID: "",
+
         // Kill the connect attempt after the timeout.
         connectTimeout:  10000,
 
@@ -75,13 +164,67 @@ var glue = function(host, options) {
 
         // Whenever to automatically reconnect if the connection was lost.
         reconnect:          true,
+        // The initial reconnect delay.
         reconnectDelay:     1000,
         reconnectDelayMax:  5000,
+        // The delay is multiplied by this factor after each attempt (exponential backoff).
+        // To increase the delay linearly instead set to 0.
+        reconnectDelayMultiplier: 0,
+        // Use a random delay between zero and the calculated delay (full jitter).
+        // This prevents synchronized reconnect storms after a server restart.
+        reconnectJitter:    true,
         // To disable set to 0 (endless).
         reconnectAttempts:  10,
 
         // Reset the send buffer after the timeout.
-        resetSendBufferTimeout: 10000
+        resetSendBufferTimeout: 10000,
+
+        // Queue send calls while disconnected and flush them in order once reconnected.
+        // Set to true or to an object with the offline queue options to enable it.
+        // If enabled, the resetSendBufferTimeout option is ignored.
+        offlineQueue: false,
+
+        // React Native AppState module or any object emitting "change"
+        // events with the "active" and "background" states.
+        // Used to pause the keepalive mechanism in the background.
+        appState: false,
+
+        // The type of received binary data passed to the onMessage functions.
+        // Values: "arraybuffer", "blob"
+        binaryType: "arraybuffer",
+
+        // JSON encode send values and JSON decode received messages.
+        // This is the default for all channels and can be changed per channel.
+        json: false,
+
+        // The number of ping-pong samples used to estimate the server clock offset
+        // after each connection. To disable the clock synchronization set to 0.
+        clockSyncSamples: 5,
+
+        // The number of message IDs remembered per reliable channel
+        // to discard messages redelivered by the server.
+        dedupWindow: 256
+    };
+
+
+
+    var DefaultOfflineQueueOptions = {
+        // The maximum number of queued messages.
+        maxCount:   100,
+        // The maximum size of all queued messages in bytes.
+        maxBytes:   1048576,
+        // Discard queued messages after the time to live in milliseconds.
+        // To disable set to 0.
+        ttl:        60000,
+        // Called with the data and the drop reason as soon as a queued message is dropped.
+        onDrop:     false
+    };
+
+    // The reasons passed to the offline queue drop callback.
+    var DropReasons = {
+        MaxCount:   "max_count",    // The maximum number of queued messages was reached.
+        MaxBytes:   "max_bytes",    // The maximum size of the queue was reached.
+        Expired:    "expired"       // The time to live of the message expired.
     };
 
 
@@ -90,6 +233,16 @@ var glue = function(host, options) {
      * Variables
      */
 
+    // The environment provides the platform specific implementations.
+    // Defaults to the browser globals. Set glue.env to override them.
+    var env = {
+        WebSocket:      typeof WebSocket !== "undefined" ? WebSocket : undefined,
+        XMLHttpRequest: typeof XMLHttpRequest !== "undefined" ? XMLHttpRequest : undefined,
+        SockJS:         typeof SockJS !== "undefined" ? SockJS : undefined,
+        EngineIO:       typeof eio !== "undefined" ? eio : undefined,
+        location:       typeof window !== "undefined" ? window.location : undefined
+    };
+
     var emitter                 = new Emitter,
         bs                      = false,
         mainChannel,
@@ -97,16 +250,31 @@ var glue = function(host, options) {
         bsNewFunc,                          // Function to create a new backend socket.
         currentSocketType,
         currentState            = States.Disconnected,
+        currentStateInfo        = { state: States.Disconnected },
+        reconnectTimeout        = false,
         reconnectCount          = 0,
         autoReconnectDisabled   = false,
         connectTimeout          = false,
         pingTimeout             = false,
         pingReconnectTimeout    = false,
         sendBuffer              = [],
+        sendBufferBytes         = 0,        // The size of the offline queue in bytes.
         resetSendBufferTimeout  = false,
         resetSendBufferTimedOut = false,
         isReady                 = false,    // If true, the socket is initialized and ready.
         beforeReadySendBuffer   = [],       // Buffer to hold requests for the server while the socket is not ready yet.
+        clockSamples            = [],       // The clock synchronization samples of the current run.
+        clockOffset             = 0,        // The estimated offset of the server clock in milliseconds.
+        topics                  = {},       // The subscribed server topics.
+        routing                 = false,    // The sticky session routing name and key of the server node.
+        rejection               = false,    // The last rejection of the server.
+        nativeKeepalive         = false,    // Set if the server sends native ping control frames.
+        nearCapacity            = false,    // Set if the server is near its capacity.
+        ticket                  = "",       // The connect ticket passed with the next connect.
+        clientID                = "",       // The stable client ID passed with each connect.
+        reliablePending         = [],       // The reliable messages not acknowledged by the server.
+        reliableCount           = 0,        // The number of send reliable messages.
+        reliablePrefix          = Math.random().toString(36).slice(2, 10) + Date.now().toString(36),
         socketID               = "";
 
 
@@ -115,7 +283,7 @@ var glue = function(host, options) {
      */
 
     // Exported helper methods for the dependencies.
-    var closeSocket, send, sendBuffered;
+    var closeSocket, send, sendBuffered, sendBufferedBinary, sendReliable;
 
     @@include('./utils.js')
     @@include('./channel.js')
@@ -129,6 +297,19 @@ var glue = function(host, options) {
     // Function variables.
     var reconnect, triggerEvent;
 
+    // Sets the current state and triggers the state event and the statechange event.
+    // The info object holds additional state specific values:
+    //  - reconnecting: attempt
+    //  - waiting:      attempt, retryIn
+    //  - disconnected: reason
+    var setState = function(state, info) {
+        currentState = state;
+        currentStateInfo = utils.extend({ state: state }, info);
+
+        triggerEvent(state, utils.extend({}, currentStateInfo));
+        triggerEvent("statechange", utils.extend({}, currentStateInfo));
+    };
+
     // Sends the data to the server if a socket connection exists, otherwise it is discarded.
     // If the socket is not ready yet, the data is buffered until the socket is ready.
     send = function(data) {
@@ -146,6 +327,235 @@ var glue = function(host, options) {
         bs.send(data);
     };
 
+    // Sends the command with the data to the server.
+    // Binary channel data is send as binary frame if supported by the
+    // backend socket. Otherwise it is base64 encoded.
+    var sendCmd = function(cmd, data) {
+        if (cmd !== Commands.ChannelBinaryData) {
+            send(cmd + data);
+            return;
+        }
+
+        if (bs && bs.binary) {
+            send(utils.marshalBinary(cmd, data.name, data.data));
+        } else {
+            send(cmd + utils.marshalValues(data.name, utils.base64Encode(data.data)));
+        }
+    };
+
+    // Returns the data passed to the discard callbacks.
+    var discardData = function(cmd, data) {
+        if (cmd === Commands.ChannelBinaryData) {
+            return data.data;
+        }
+        if (cmd === Commands.ChannelData) {
+            // Remove the channel name.
+            var v = utils.unmarshalValues(data);
+            if (v) {
+                return v.second;
+            }
+        }
+        return data;
+    };
+
+    // Returns the query string echoing the sticky session routing key
+    // of the last connected server node or an empty string if not set.
+    var routingQuery = function() {
+        if (!routing) {
+            return "";
+        }
+        return "?" + encodeURIComponent(routing.name) + "=" + encodeURIComponent(routing.key);
+    };
+
+    // Returns the received binary data in the format specified by the binaryType option.
+    var binaryData = function(buf) {
+        if (options.binaryType === "blob") {
+            return new Blob([buf]);
+        }
+        return buf;
+    };
+
+    // Handles a message requesting a receipt. The message is passed to
+    // the channel and the receipt is acknowledged to the server afterwards.
+    var handleReceiptData = function(data) {
+        // Obtain the receipt ID and the channel message.
+        var v = utils.unmarshalValues(data),
+            m = v ? utils.unmarshalValues(v.second) : false;
+        if (!m) {
+            console.log("glue: server requested an invalid receipt request: " + data);
+            return;
+        }
+
+        // Trigger the event.
+        channel.emitOnMessage(m.first, m.second);
+
+        // Acknowledge the receipt.
+        send(Commands.ChannelData + utils.marshalValues(ReceiptChannelName, v.first));
+    };
+
+    // Sends the reliable channel request to the server.
+    var sendReliableRequest = function(t, data) {
+        send(Commands.ChannelData + utils.marshalValues(ReliableChannelName, t + data));
+    };
+
+    // Sends the pending reliable message with its ID and send time to the server.
+    var sendReliableMessage = function(m) {
+        sendReliableRequest(ReliableRequests.Message, utils.marshalValues(m.id,
+            utils.marshalValues(String(m.time), utils.marshalValues(m.name, m.data))));
+    };
+
+    // Send the data to the reliable channel specified by name. The message
+    // is kept until the server acknowledges it and is resent after reconnects.
+    // The optional ID is passed to the server handlers. A unique ID is
+    // generated if not set.
+    // returns:
+    //  1 if immediately send and
+    //  0 if send as soon as connected.
+    sendReliable = function(name, data, id) {
+        reliableCount++;
+
+        var m = {
+            id:     id ? String(id) : reliablePrefix + "-" + reliableCount,
+            time:   Date.now(),
+            name:   name,
+            data:   data
+        };
+        reliablePending.push(m);
+
+        if (!bs || currentState !== States.Connected) {
+            return 0;
+        }
+
+        sendReliableMessage(m);
+        return 1;
+    };
+
+    // Resends all reliable messages which were not acknowledged yet.
+    var resendReliable = function() {
+        for (var i = 0; i < reliablePending.length; i++) {
+            sendReliableMessage(reliablePending[i]);
+        }
+    };
+
+    // Handles the reliable channel requests of the server. Messages are
+    // passed with their ID to the channel and acknowledged afterwards.
+    // Messages of unknown channels are not acknowledged and redelivered
+    // as soon as the channel is reliable on the server side again.
+    // Acknowledgements remove the pending reliable messages.
+    var handleReliableData = function(data) {
+        var t = data.charAt(0),
+            v = utils.unmarshalValues(data.substr(1)),
+            m = v ? utils.unmarshalValues(v.second) : false;
+
+        if (t === ReliableRequests.Ack && v) {
+            for (var i = 0; i < reliablePending.length; i++) {
+                if (reliablePending[i].id === v.second) {
+                    reliablePending.splice(i, 1);
+                    break;
+                }
+            }
+            return;
+        }
+
+        if (t !== ReliableRequests.Message || !m) {
+            console.log("glue: server send an invalid reliable channel request: " + data);
+            return;
+        }
+
+        // Trigger the event.
+        if (!channel.emitOnMessage(m.first, m.second, v.first)) {
+            return;
+        }
+
+        // Acknowledge the message.
+        sendReliableRequest(ReliableRequests.Ack, utils.marshalValues(m.first, v.first));
+    };
+
+    // Sends the data to the reserved clock channel.
+    var sendClockData = function(data) {
+        send(Commands.ChannelData + utils.marshalValues(ClockChannelName, data));
+    };
+
+    // Starts the clock synchronization with the server.
+    // Each sample sends the current timestamp. The server replies
+    // with the sample timestamp and the server timestamp.
+    var startClockSync = function() {
+        if (!(options.clockSyncSamples > 0)) {
+            return;
+        }
+
+        clockSamples = [];
+        sendClockData(ClockMessages.Sample + String(Date.now()));
+    };
+
+    // Handles the clock synchronization replies of the server.
+    var handleClockData = function(data) {
+        if (data.charAt(0) !== ClockMessages.Sample) {
+            console.log("glue: received invalid clock data: " + data);
+            return;
+        }
+
+        var v = utils.unmarshalValues(data.substr(1)),
+            now = Date.now();
+        if (!v) {
+            console.log("glue: received invalid clock data: " + data);
+            return;
+        }
+
+        var sent = parseInt(v.first, 10),
+            serverTime = parseInt(v.second, 10);
+        if (isNaN(sent) || isNaN(serverTime)) {
+            console.log("glue: received invalid clock data: " + data);
+            return;
+        }
+
+        // Assume the reply took half of the round trip time.
+        clockSamples.push({
+            rtt:    now - sent,
+            offset: serverTime + (now - sent) / 2 - now
+        });
+
+        // Send the next sample.
+        if (clockSamples.length < options.clockSyncSamples) {
+            sendClockData(ClockMessages.Sample + String(Date.now()));
+            return;
+        }
+
+        // Use the sample with the lowest round trip time.
+        var best = clockSamples[0];
+        for (var i = 1; i < clockSamples.length; i++) {
+            if (clockSamples[i].rtt < best.rtt) {
+                best = clockSamples[i];
+            }
+        }
+        clockSamples = [];
+        clockOffset = Math.round(best.offset);
+
+        // Inform the server about the estimated offset.
+        sendClockData(ClockMessages.Offset + String(clockOffset));
+
+        triggerEvent("clock_sync", clockOffset);
+    };
+
+    // Sends the topic request to the server if connected.
+    // Topics are subscribed again after each connection.
+    var sendTopicRequest = function(type, name) {
+        if (currentState !== States.Connected) {
+            return;
+        }
+
+        send(Commands.ChannelData + utils.marshalValues(TopicChannelName, type + name));
+    };
+
+    // Subscribes all topics again.
+    var resubscribeTopics = function() {
+        for (var name in topics) {
+            if (topics.hasOwnProperty(name)) {
+                sendTopicRequest(TopicRequests.Subscribe, name);
+            }
+        }
+    };
+
     // Hint: the isReady flag has to be true before calling this function!
     var sendBeforeReadyBufferedData = function() {
         // Skip if empty.
@@ -196,7 +606,7 @@ var glue = function(host, options) {
                 buf = sendBuffer[i];
                 if (buf.discardCallback && utils.isFunction(buf.discardCallback)) {
                     try {
-                        buf.discardCallback(buf.data);
+                        buf.discardCallback(discardData(buf.cmd, buf.data));
                     }
                     catch (err) {
                        console.log("glue: failed to call discard callback: " + err.message);
@@ -212,24 +622,183 @@ var glue = function(host, options) {
         }, options.resetSendBufferTimeout);
     };
 
+    // Returns the size of the buffered data in bytes.
+    var dataSize = function(cmd, data) {
+        if (cmd === Commands.ChannelBinaryData) {
+            return data.data.byteLength;
+        }
+        return utils.encodeUTF8(data).length;
+    };
+
+    // Removes the message at the index (default the first one) from the
+    // offline queue and calls the discard callbacks with the drop reason.
+    var dropFromOfflineQueue = function(reason, index) {
+        var buf = sendBuffer.splice(index || 0, 1)[0];
+        sendBufferBytes -= buf.size;
+
+        var data = discardData(buf.cmd, buf.data);
+
+        if (buf.discardCallback && utils.isFunction(buf.discardCallback)) {
+            try {
+                buf.discardCallback(data);
+            }
+            catch (err) {
+               console.log("glue: failed to call discard callback: " + err.message);
+            }
+        }
+
+        if (utils.isFunction(options.offlineQueue.onDrop)) {
+            try {
+                options.offlineQueue.onDrop(data, reason);
+            }
+            catch (err) {
+               console.log("glue: failed to call offline queue drop callback: " + err.message);
+            }
+        }
+    };
+
+    // Drops all expired messages from the offline queue and
+    // starts the timer for the next expiring message.
+    var expireOfflineQueue = function() {
+        // Stop the timeout timer if present.
+        if (resetSendBufferTimeout !== false) {
+            clearTimeout(resetSendBufferTimeout);
+            resetSendBufferTimeout = false;
+        }
+
+        // Drop the expired messages and find the next expiry time.
+        // Messages without an expiry time are zero.
+        var now = Date.now(),
+            next = 0,
+            expires;
+
+        for (var i = 0; i < sendBuffer.length;) {
+            expires = sendBuffer[i].expires;
+            if (expires > 0 && expires <= now) {
+                dropFromOfflineQueue(DropReasons.Expired, i);
+                continue;
+            }
+            if (expires > 0 && (next === 0 || expires < next)) {
+                next = expires;
+            }
+            i++;
+        }
+
+        if (next === 0) {
+            return;
+        }
+
+        // The drop callbacks might have started the timer already.
+        if (resetSendBufferTimeout !== false) {
+            clearTimeout(resetSendBufferTimeout);
+        }
+
+        // Start the timer for the next expiring message.
+        resetSendBufferTimeout = setTimeout(expireOfflineQueue, next - now);
+    };
+
+    // Returns the expiry time of a message with the time to live
+    // in milliseconds or zero if the message does not expire.
+    var expiryTime = function(ttl) {
+        return (ttl > 0) ? Date.now() + ttl : 0;
+    };
+
+    // Adds the data to the offline queue.
+    // The oldest messages are dropped if the queue limits are exceeded.
+    // The message expires after the queue or the message time to live,
+    // whichever is shorter.
+    // returns:
+    //  0 if added to the queue and
+    //  -1 if discarded.
+    var addToOfflineQueue = function(cmd, data, discardCallback, ttl) {
+        var size = dataSize(cmd, data),
+            o = options.offlineQueue;
+
+        // Discard the data if it does not fit into the queue at all.
+        if ((o.maxBytes > 0 && size > o.maxBytes) || !(o.maxCount > 0)) {
+            if (discardCallback && utils.isFunction(discardCallback)) {
+                discardCallback(discardData(cmd, data));
+            }
+            if (utils.isFunction(o.onDrop)) {
+                o.onDrop(discardData(cmd, data), o.maxCount > 0 ? DropReasons.MaxBytes : DropReasons.MaxCount);
+            }
+
+            return -1;
+        }
+
+        // Use the shorter time to live.
+        if (o.ttl > 0 && !(ttl > 0 && ttl < o.ttl)) {
+            ttl = o.ttl;
+        }
+
+        // Append to the queue.
+        var expires = expiryTime(ttl);
+        sendBuffer.push({
+            cmd:                cmd,
+            data:               data,
+            discardCallback:    discardCallback,
+            size:               size,
+            expires:            expires
+        });
+        sendBufferBytes += size;
+
+        // Drop the oldest messages if the limits are exceeded.
+        while (sendBuffer.length > o.maxCount) {
+            dropFromOfflineQueue(DropReasons.MaxCount);
+        }
+        while (o.maxBytes > 0 && sendBufferBytes > o.maxBytes) {
+            dropFromOfflineQueue(DropReasons.MaxBytes);
+        }
+
+        // Restart the expiry timer. The message might expire first.
+        if (expires > 0) {
+            expireOfflineQueue();
+        }
+
+        return 0;
+    };
+
     var sendDataFromSendBuffer = function() {
         // Stop the reset send buffer tiemout.
         stopResetSendBufferTimeout();
 
+        // Drop expired messages from the offline queue.
+        if (options.offlineQueue) {
+            expireOfflineQueue();
+            stopResetSendBufferTimeout();
+        }
+
         // Skip if empty.
         if (sendBuffer.length === 0) {
             return;
         }
 
-        // Send data, which could not be send...
-        var buf;
-        for (var i = 0; i < sendBuffer.length; i++) {
-            buf = sendBuffer[i];
-            send(buf.cmd + buf.data);
-        }
+        // Clear the buffer.
+        var buffer = sendBuffer,
+            now = Date.now(),
+            buf;
 
-        // Clear the buffer again.
         sendBuffer = [];
+        sendBufferBytes = 0;
+
+        // Send data, which could not be send...
+        // Messages exceeding their time to live are discarded instead.
+        for (var i = 0; i < buffer.length; i++) {
+            buf = buffer[i];
+            if (buf.expires > 0 && buf.expires <= now) {
+                if (buf.discardCallback && utils.isFunction(buf.discardCallback)) {
+                    try {
+                        buf.discardCallback(discardData(buf.cmd, buf.data));
+                    }
+                    catch (err) {
+                       console.log("glue: failed to call discard callback: " + err.message);
+                    }
+                }
+                continue;
+            }
+
+            sendCmd(buf.cmd, buf.data);
+        }
     };
 
     // Send data to the server.
@@ -238,11 +807,13 @@ var glue = function(host, options) {
     // One optional discard callback can be passed.
     // It is called if the data could not be send to the server.
     // The data is passed as first argument to the discard callback.
+    // An optional time to live in milliseconds discards buffered
+    // data, which could not be send in time.
     // returns:
     //  1 if immediately send,
     //  0 if added to the send queue and
     //  -1 if discarded.
-    sendBuffered = function(cmd, data, discardCallback) {
+    sendBuffered = function(cmd, data, discardCallback, ttl) {
         // Be sure, that the data value is an empty
         // string if not passed to this method.
         if (!data) {
@@ -252,10 +823,15 @@ var glue = function(host, options) {
         // Add the data to the send buffer if disconnected.
         // They will be buffered for a short timeout to bridge short connection errors.
         if (!bs || currentState !== States.Connected) {
+            // Use the offline queue if enabled.
+            if (options.offlineQueue) {
+                return addToOfflineQueue(cmd, data, discardCallback, ttl);
+            }
+
             // If already timed out, then call the discard callback and return.
             if (resetSendBufferTimedOut) {
                 if (discardCallback && utils.isFunction(discardCallback)) {
-                    discardCallback(data);
+                    discardCallback(discardData(cmd, data));
                 }
 
                 return -1;
@@ -268,18 +844,29 @@ var glue = function(host, options) {
             sendBuffer.push({
                 cmd:                cmd,
                 data:               data,
-                discardCallback:    discardCallback
+                discardCallback:    discardCallback,
+                expires:            expiryTime(ttl)
             });
 
             return 0;
         }
 
         // Send the data with the command to the server.
-        send(cmd + data);
+        sendCmd(cmd, data);
 
         return 1;
     };
 
+    // Send binary data to the channel specified by name.
+    // This is a helper method equal to sendBuffered.
+    // The data has to be an ArrayBuffer, a TypedArray or a DataView.
+    sendBufferedBinary = function(name, data, discardCallback, ttl) {
+        return sendBuffered(Commands.ChannelBinaryData, {
+            name: name,
+            data: data
+        }, discardCallback, ttl);
+    };
+
     var stopConnectTimeout = function() {
         // Stop the timeout timer if present.
         if (connectTimeout !== false) {
@@ -319,33 +906,76 @@ var glue = function(host, options) {
         }
     };
 
+    // Request a Pong response to check if the connection is still alive.
+    // Reconnect if no response is received within the timeout.
+    var checkConnection = function() {
+        // Stop the timeout.
+        stopPingTimeout();
+
+        // Request a Pong response.
+        send(Commands.Ping);
+
+        // Start the reconnect timeout.
+        pingReconnectTimeout = setTimeout(function() {
+            // Update the flag.
+            pingReconnectTimeout = false;
+
+            // Trigger the event.
+            triggerEvent("timeout");
+
+            // Reconnect to the server.
+            reconnect();
+        }, options.pingReconnectTimeout);
+    };
+
     var resetPingTimeout = function() {
         // Stop the timeout.
         stopPingTimeout();
 
+        // The server checks the connection with native
+        // ping control frames, which are handled by the browser.
+        if (nativeKeepalive) {
+            return;
+        }
+
         // Start the timeout.
         pingTimeout = setTimeout(function() {
             // Update the flag.
             pingTimeout = false;
 
-            // Request a Pong response to check if the connection is still alive.
-            send(Commands.Ping);
-
-            // Start the reconnect timeout.
-            pingReconnectTimeout = setTimeout(function() {
-                // Update the flag.
-                pingReconnectTimeout = false;
-
-                // Trigger the event.
-                triggerEvent("timeout");
+            // Check if the connection is still alive.
+            checkConnection();
+        }, options.pingInterval);
+    };
 
-                // Reconnect to the server.
+    // Handle application state changes (React Native AppState).
+    // Timers are suspended or delayed in the background. Stop the keepalive
+    // timeouts to prevent false timeouts and check the connection as soon as
+    // the application is in the foreground again.
+    var onAppStateChange = function(state) {
+        if (state === "background") {
+            stopPingTimeout();
+        }
+        else if (state === "active") {
+            if (currentState === States.Connected) {
+                checkConnection();
+            }
+            else if (currentState === States.Disconnected && options.reconnect !== false && !autoReconnectDisabled) {
+                reconnectCount = 0;
                 reconnect();
-            }, options.pingReconnectTimeout);
-        }, options.pingInterval);
+            }
+        }
     };
 
     var newBackendSocket = function() {
+        // Logical sockets always use the connection of the carrier socket.
+        if (options.muxTransport) {
+            bsNewFunc = newMuxSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.MuxSocket;
+            return;
+        }
+
         // If at least one successfull connection was made,
         // then create a new socket using the last create socket function.
         // Otherwise determind which socket layer to use.
@@ -354,6 +984,22 @@ var glue = function(host, options) {
             return;
         }
 
+        // The SockJS client falls back to other transports itself.
+        if (options.forceSocketType === SocketTypes.SockJSSocket) {
+            bsNewFunc = newSockJSSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.SockJSSocket;
+            return;
+        }
+
+        // The engine.io client upgrades the transport itself.
+        if (options.forceSocketType === SocketTypes.EngineIOSocket) {
+            bsNewFunc = newEngineIOSocket;
+            bs = bsNewFunc();
+            currentSocketType = SocketTypes.EngineIOSocket;
+            return;
+        }
+
         // Fallback to the ajax socket layer if there was no successful initial
         // connection and more than one reconnection attempt was made.
         if (reconnectCount > 1) {
@@ -364,7 +1010,7 @@ var glue = function(host, options) {
         }
 
         // Choose the socket layer depending on the browser support.
-        if ((!options.forceSocketType && window.WebSocket) ||
+        if ((!options.forceSocketType && env.WebSocket) ||
             options.forceSocketType === SocketTypes.WebSocket)
         {
             bsNewFunc = newWebSocket;
@@ -380,6 +1026,48 @@ var glue = function(host, options) {
         bs = bsNewFunc();
     };
 
+    // handleReject handles a rejection of the server during the initialization.
+    var handleReject = function(data) {
+        var r = {};
+        try {
+            r = JSON.parse(data);
+        }
+        catch(err) {}
+
+        rejection = {
+            code:    r.code || "",
+            message: r.message || "",
+            retry:   !!r.retry
+        };
+
+        // Disable auto reconnections if the rejection is final.
+        if (!rejection.retry) {
+            autoReconnectDisabled = true;
+        }
+
+        // Log the rejection.
+        console.log("glue: server rejected the connection: " + rejection.code + ": " + rejection.message);
+
+        // A full server is at its capacity.
+        if (rejection.code === "server_full") {
+            setNearCapacity(true);
+        }
+
+        // Trigger the rejected event.
+        triggerEvent("rejected", utils.extend({}, rejection));
+    };
+
+    // setNearCapacity sets the capacity state of the server
+    // and triggers the capacity event if changed.
+    var setNearCapacity = function(near) {
+        if (nearCapacity === near) {
+            return;
+        }
+
+        nearCapacity = near;
+        triggerEvent("capacity", near);
+    };
+
     var initSocket = function(data) {
         // Parse the data JSON string to an object.
         data = JSON.parse(data);
@@ -395,6 +1083,33 @@ var glue = function(host, options) {
         // Set the socket ID.
         socketID = data.socketID;
 
+        // Reset a previous rejection.
+        rejection = false;
+
+        // Stop the application-level keepalive if the server
+        // uses the native keepalive of the transport.
+        if (data.nativeKeepalive) {
+            nativeKeepalive = true;
+            stopPingTimeout();
+        }
+
+        // Update the capacity state of the server.
+        setNearCapacity(!!data.nearCapacity);
+
+        // Remember the renewed connect ticket for the next reconnect.
+        if (data.ticket) {
+            ticket = data.ticket;
+        }
+
+        // Remember the routing key of the server node.
+        // It is echoed on reconnect to keep the session pinned to the node.
+        if (data.routingName && data.routingKey) {
+            routing = {
+                name: data.routingName,
+                key:  data.routingKey
+            };
+        }
+
         // The socket initialization is done.
         // ##################################
 
@@ -406,8 +1121,16 @@ var glue = function(host, options) {
         sendBeforeReadyBufferedData();
 
         // Now set the state and trigger the event.
-        currentState = States.Connected;
-        triggerEvent("connected");
+        setState(States.Connected);
+
+        // Synchronize the clock with the server.
+        startClockSync();
+
+        // Subscribe to the server topics.
+        resubscribeTopics();
+
+        // Resend the reliable messages which were not acknowledged.
+        resendReliable();
 
         // Send the queued data from the send buffer if present.
         // Do this after the next tick to be sure, that
@@ -430,14 +1153,45 @@ var glue = function(host, options) {
             // Set the flag.
             initialConnectedOnce = true;
 
+            // The server tells the keepalive mode with the init data.
+            nativeKeepalive = false;
+
             // Reset or start the ping timeout.
             resetPingTimeout();
 
             // Prepare the init data to be send to the server.
             var data = {
-                version: Version
+                version: Version,
+                reject:  true
             };
 
+            // Carrier sockets of logical sockets are hidden by the server.
+            if (options.muxCarrier) {
+                data.mux = true;
+            }
+
+            // Pass the namespace and the authentication value.
+            if (options.namespace) {
+                data.namespace = options.namespace;
+            }
+            if (options.auth) {
+                data.auth = options.auth;
+            }
+
+            // Pass the handshake payload.
+            if (options.handshake) {
+                data.payload = options.handshake;
+            }
+
+            // Pass the connect ticket. It is only valid once.
+            if (ticket) {
+                data.ticket = ticket;
+                ticket = "";
+            }
+
+            // Pass the stable client ID.
+            data.client = clientID;
+
             // Marshal the data object to a JSON string.
             data = JSON.stringify(data);
 
@@ -465,6 +1219,19 @@ var glue = function(host, options) {
             // Reset the ping timeout.
             resetPingTimeout();
 
+            // Handle binary frames.
+            if (typeof data !== "string") {
+                var b = utils.unmarshalBinary(data, Commands.Len);
+                if (!b || b.cmd !== Commands.ChannelBinaryData) {
+                    console.log("glue: received invalid binary data from server.");
+                    return;
+                }
+
+                // Trigger the event.
+                channel.emitOnMessage(b.first, binaryData(b.second));
+                return;
+            }
+
             // Log if the received data is too short.
             if (data.length < Commands.Len) {
                 console.log("glue: received invalid data from server: data is too short.");
@@ -494,6 +1261,34 @@ var glue = function(host, options) {
                 // Log.
                 console.log("glue: server replied with an don't automatically reconnect request. This might be due to an incompatible protocol version.");
             }
+            else if (cmd === Commands.Reject) {
+                handleReject(data);
+            }
+            else if (cmd === Commands.Close) {
+                // The server closes the connection after all previous
+                // messages were handled. Acknowledge it, so the server
+                // doesn't wait for the connection loss, and reconnect as usual.
+                send(Commands.Close);
+                reconnect();
+            }
+            else if (cmd === Commands.Reconnect) {
+                // The server session expired. Acknowledge it and
+                // reconnect immediately to start a new session.
+                send(Commands.Close);
+                resetSocket();
+                reconnectCount = 1;
+                connectSocket();
+            }
+            else if (cmd === Commands.GoingAway) {
+                // The server is shutting down. Pass the milliseconds
+                // until the connection is closed.
+                triggerEvent("going_away", parseInt(data, 10) || 0);
+            }
+            else if (cmd === Commands.IdleWarning) {
+                // The server closes the idle socket. Pass the milliseconds
+                // until the socket is closed. Send data to keep it open.
+                triggerEvent("idle_warning", parseInt(data, 10) || 0);
+            }
             else if (cmd === Commands.Init) {
                 initSocket(data);
             }
@@ -505,9 +1300,51 @@ var glue = function(host, options) {
                     return;
                 }
 
+                // Handle the reserved clock synchronization channel.
+                if (v.first === ClockChannelName) {
+                    handleClockData(v.second);
+                    return;
+                }
+
+                // Handle messages requesting a receipt.
+                if (v.first === ReceiptChannelName) {
+                    handleReceiptData(v.second);
+                    return;
+                }
+
+                // Handle the messages of reliable channels.
+                if (v.first === ReliableChannelName) {
+                    handleReliableData(v.second);
+                    return;
+                }
+
+                // Trigger the maintenance event with the maintenance message.
+                // The message is empty if the maintenance mode ended.
+                if (v.first === MaintenanceChannelName) {
+                    triggerEvent("maintenance", v.second);
+                    return;
+                }
+
+                // Update the capacity state of the server.
+                if (v.first === CapacityChannelName) {
+                    setNearCapacity(v.second === "1");
+                    return;
+                }
+
                 // Trigger the event.
                 channel.emitOnMessage(v.first, v.second);
             }
+            else if (cmd === Commands.ChannelBinaryData) {
+                // Obtain the channel name and the base64 encoded data.
+                var bv = utils.unmarshalValues(data);
+                if (!bv) {
+                    console.log("glue: server requested an invalid channel data request: " + data);
+                    return;
+                }
+
+                // Trigger the event.
+                channel.emitOnMessage(bv.first, binaryData(utils.base64Decode(bv.second)));
+            }
             else {
                 console.log("glue: received invalid data from server with command '" + cmd + "' and data '" + data + "'!");
             }
@@ -518,12 +1355,10 @@ var glue = function(host, options) {
         setTimeout(function() {
             // Set the state and trigger the event.
             if (reconnectCount > 0) {
-                currentState = States.Reconnecting;
-                triggerEvent("reconnecting");
+                setState(States.Reconnecting, { attempt: reconnectCount });
             }
             else {
-                currentState = States.Connecting;
-                triggerEvent("connecting");
+                setState(States.Connecting);
             }
 
             // Reset or start the connect timeout.
@@ -566,12 +1401,28 @@ var glue = function(host, options) {
 
         // If no reconnections should be made or more than max
         // reconnect attempts where made, trigger the disconnected event.
-        if ((options.reconnectAttempts > 0 && reconnectCount > options.reconnectAttempts) ||
+        if ((options.reconnectAttempts > 0 && reconnectCount >= options.reconnectAttempts) ||
             options.reconnect === false || autoReconnectDisabled)
         {
+            // Determind the reason.
+            var reason = DisconnectReasons.MaxAttempts,
+                info = {};
+            if (autoReconnectDisabled && rejection) {
+                reason = DisconnectReasons.Rejected;
+            } else if (autoReconnectDisabled) {
+                reason = DisconnectReasons.ServerRequest;
+            } else if (options.reconnect === false) {
+                reason = DisconnectReasons.ReconnectDisabled;
+            }
+            info.reason = reason;
+
+            // Pass the last rejection of the server.
+            if (rejection) {
+                info.rejection = utils.extend({}, rejection);
+            }
+
             // Set the state and trigger the event.
-            currentState = States.Disconnected;
-            triggerEvent("disconnected");
+            setState(States.Disconnected, info);
 
             return;
         }
@@ -580,23 +1431,56 @@ var glue = function(host, options) {
         reconnectCount += 1;
 
         // Calculate the reconnect delay.
-        var reconnectDelay = options.reconnectDelay * reconnectCount;
+        var reconnectDelay;
+        if (options.reconnectDelayMultiplier > 0) {
+            reconnectDelay = options.reconnectDelay * Math.pow(options.reconnectDelayMultiplier, reconnectCount - 1);
+        } else {
+            reconnectDelay = options.reconnectDelay * reconnectCount;
+        }
         if (reconnectDelay > options.reconnectDelayMax) {
             reconnectDelay = options.reconnectDelayMax;
         }
 
+        // Spread the reconnects over the maximum delay
+        // if the server is near its capacity.
+        if (nearCapacity) {
+            reconnectDelay = options.reconnectDelayMax;
+        }
+
+        // Apply the full jitter.
+        if (options.reconnectJitter) {
+            reconnectDelay = Math.floor(Math.random() * reconnectDelay);
+        }
+
+        // Wait for the delay.
+        setState(States.Waiting, {
+            attempt: reconnectCount,
+            retryIn: reconnectDelay
+        });
+
         // Try to reconnect.
-        setTimeout(function() {
+        reconnectTimeout = setTimeout(function() {
+            reconnectTimeout = false;
             connectSocket();
         }, reconnectDelay);
     };
 
+    var stopReconnectTimeout = function() {
+        if (reconnectTimeout !== false) {
+            clearTimeout(reconnectTimeout);
+            reconnectTimeout = false;
+        }
+    };
+
     closeSocket = function() {
-        // Check if the socket exists.
-        if (!bs) {
+        // Check if the socket exists or if a reconnect is pending.
+        if (!bs && reconnectTimeout === false) {
             return;
         }
 
+        // Stop a pending reconnect.
+        stopReconnectTimeout();
+
         // Notify the server.
         send(Commands.Close);
 
@@ -604,8 +1488,7 @@ var glue = function(host, options) {
         resetSocket();
 
         // Set the state and trigger the event.
-        currentState = States.Disconnected;
-        triggerEvent("disconnected");
+        setState(States.Disconnected, { reason: DisconnectReasons.Closed });
     };
 
 
@@ -614,13 +1497,17 @@ var glue = function(host, options) {
      * Initialize section
      */
 
-    // Create the main channel.
-    mainChannel = channel.get(MainChannelName);
+    // Merge the environment with the custom environment.
+    env = utils.extend(env, glue.env);
 
     // Prepare the host string.
     // Use the current location if the host string is not set.
     if (!host) {
-        host = window.location.protocol + "//" + window.location.host;
+        if (!env.location) {
+            console.log("glue: invalid host: no host passed and no location available!");
+            return;
+        }
+        host = env.location.protocol + "//" + env.location.host;
     }
     // The host string has to start with http:// or https://
     if (!host.match("^http://") && !host.match("^https://")) {
@@ -636,6 +1523,23 @@ var glue = function(host, options) {
         options.reconnectDelayMax = options.reconnectDelay;
     }
 
+    // Merge the offline queue options with the default options.
+    if (options.offlineQueue) {
+        options.offlineQueue = utils.extend({}, DefaultOfflineQueueOptions,
+            options.offlineQueue === true ? {} : options.offlineQueue);
+    }
+
+    // Set the initial connect ticket.
+    ticket = options.ticket;
+
+    // Load the stable client ID. Sockets to different hosts
+    // and namespaces use different IDs.
+    clientID = options.clientID || utils.clientID("glue.clientID:" + host + "/" + options.namespace);
+
+    // Create the main channel.
+    // This requires the merged options.
+    mainChannel = channel.get(MainChannelName);
+
     // Prepare the base URL.
     // The base URL has to start and end with a slash.
     if (options.baseURL.indexOf("/") !== 0) {
@@ -645,6 +1549,11 @@ var glue = function(host, options) {
         options.baseURL = options.baseURL + "/";
     }
 
+    // Listen for application state changes if set.
+    if (options.appState && options.appState.addEventListener) {
+        options.appState.addEventListener("change", onAppStateChange);
+    }
+
     // Create the initial backend socket and establish a connection to the server.
     connectSocket();
 
@@ -671,27 +1580,49 @@ var glue = function(host, options) {
         //  - "disconnected"
         //  - "connecting"
         //  - "reconnecting"
+        //  - "waiting"
         //  - "connected"
         state: function() {
             return currentState;
         },
 
+        // stateInfo returns an object with the current state and additional
+        // state specific values:
+        //  - reconnecting: attempt
+        //  - waiting:      attempt, retryIn (milliseconds)
+        //  - disconnected: reason ("closed", "reconnect_disabled", "max_attempts", "server_request", "rejected"),
+        //                  rejection (code, message, retry) if rejected
+        stateInfo: function() {
+            return utils.extend({}, currentStateInfo);
+        },
+
+        // clockOffset returns the estimated offset of the server clock
+        // relative to the local clock in milliseconds.
+        // Add it to Date.now() to obtain the server time.
+        clockOffset: function() {
+            return clockOffset;
+        },
+
         // socketID returns the socket's ID.
         // This is a cryptographically secure pseudorandom number.
         socketID: function() {
             return socketID;
         },
 
-        // send a data string to the server.
+        // send a data string or binary data to the server.
+        // Binary data can be an ArrayBuffer, a TypedArray, a DataView or a Blob.
         // One optional discard callback can be passed.
         // It is called if the data could not be send to the server.
         // The data is passed as first argument to the discard callback.
+        // Optional send options can be passed:
+        //  - ttl: discard the data if it could not be send within the
+        //         time to live in milliseconds.
         // returns:
         //  1 if immediately send,
         //  0 if added to the send queue and
         //  -1 if discarded.
-        send: function(data, discardCallback) {
-            mainChannel.send(data, discardCallback);
+        send: function(data, discardCallback, opts) {
+            return mainChannel.send(data, discardCallback, opts);
         },
 
         // onMessage sets the function which is triggered as soon as a message is received.
@@ -699,6 +1630,18 @@ var glue = function(host, options) {
             mainChannel.onMessage(f);
         },
 
+        // subscribe adds a function which is triggered as soon as a message
+        // is received. Returns a function which removes the listener again.
+        subscribe: function(f) {
+            return mainChannel.subscribe(f);
+        },
+
+        // request sends the data to the server and returns a promise
+        // which is resolved with the next received message.
+        request: function(data, opts) {
+            return mainChannel.request(data, opts);
+        },
+
         // on binds event functions to events.
         // This function is equivalent to jQuery's on method syntax.
         // Following events are available:
@@ -706,14 +1649,28 @@ var glue = function(host, options) {
         //  - "connecting"
         //  - "disconnected"
         //  - "reconnecting"
+        //  - "waiting"
+        //  - "statechange"
         //  - "error"
         //  - "connect_timeout"
         //  - "timeout"
         //  - "discard_send_buffer"
+        //  - "clock_sync"
         on: function() {
             emitter.on.apply(emitter, arguments);
         },
 
+        // once binds an event function which is triggered only once.
+        once: function() {
+            emitter.once.apply(emitter, arguments);
+        },
+
+        // off removes event functions.
+        // If no function is passed, all functions of the event are removed.
+        off: function() {
+            emitter.off.apply(emitter, arguments);
+        },
+
         // Reconnect to the server.
         // This is ignored if the socket is not disconnected.
         // It will reconnect automatically if required.
@@ -722,9 +1679,11 @@ var glue = function(host, options) {
                 return;
             }
 
-            // Reset the reconnect count and the auto reconnect disabled flag.
+            // Reset the reconnect count, the auto reconnect disabled flag
+            // and the last rejection.
             reconnectCount = 0;
             autoReconnectDisabled = false;
+            rejection = false;
 
             // Reconnect the socket.
             reconnect();
@@ -735,10 +1694,36 @@ var glue = function(host, options) {
             closeSocket();
         },
 
+        // topic subscribes to the server topic specified by name and returns
+        // its channel object. The server replays the topic history first.
+        // The subscription is renewed after each reconnection.
+        // Optional channel options can be passed.
+        topic: function(name, opts) {
+            if (!topics[name]) {
+                topics[name] = true;
+                sendTopicRequest(TopicRequests.Subscribe, name);
+            }
+
+            return channel.get(name, opts);
+        },
+
+        // unsubscribe from the server topic specified by name.
+        unsubscribeTopic: function(name) {
+            if (!topics[name]) {
+                return;
+            }
+
+            delete topics[name];
+            sendTopicRequest(TopicRequests.Unsubscribe, name);
+        },
+
         // channel returns the given channel object specified by name
         // to communicate in a separate channel than the default one.
-        channel: function(name) {
-            return channel.get(name);
+        // Optional channel options can be passed:
+        //  - json: enable or disable the JSON mode for this channel.
+        //  - ttl:  the default time to live in milliseconds for send data.
+        channel: function(name, opts) {
+            return channel.get(name, opts);
         }
     };
 
@@ -750,3 +1735,100 @@ var glue = function(host, options) {
     // Return the newly created socket.
     return socket;
 };
+
+// connect creates a new socket and returns a promise which is resolved
+// with the socket as soon as the connection is established.
+// The promise is rejected if the socket is disconnected before.
+// Usage: var socket = await glue.connect(host, options);
+// Additionally to the socket options, following options are available:
+//  - timeout: close the socket and reject the promise after the timeout in milliseconds.
+//  - signal:  an AbortSignal to cancel the connect attempt.
+glue.connect = function(host, options) {
+    'use strict';
+
+    return new Promise(function(resolve, reject) {
+        var signal = options ? options.signal : undefined,
+            timeout = false,
+            onConnected, onDisconnected, onAbort;
+
+        var newError = function(name, msg) {
+            var err = new Error(msg);
+            err.name = name;
+            return err;
+        };
+
+        if (signal && signal.aborted) {
+            reject(newError("AbortError", "glue: connect aborted"));
+            return;
+        }
+
+        var socket = glue(host, options);
+        if (!socket) {
+            reject(new Error("glue: invalid host"));
+            return;
+        }
+
+        var stop = function() {
+            if (timeout !== false) {
+                clearTimeout(timeout);
+                timeout = false;
+            }
+            if (signal) {
+                signal.removeEventListener("abort", onAbort);
+            }
+        };
+
+        var cancel = function(err) {
+            stop();
+            socket.off("connected", onConnected);
+            socket.off("disconnected", onDisconnected);
+            socket.close();
+            reject(err);
+        };
+
+        onAbort = function() {
+            cancel(newError("AbortError", "glue: connect aborted"));
+        };
+
+        if (signal) {
+            signal.addEventListener("abort", onAbort);
+        }
+
+        if (options && options.timeout > 0) {
+            timeout = setTimeout(function() {
+                timeout = false;
+                cancel(newError("TimeoutError", "glue: connect timed out"));
+            }, options.timeout);
+        }
+
+        onConnected = function() {
+            stop();
+            socket.off("disconnected", onDisconnected);
+            resolve(socket);
+        };
+
+        onDisconnected = function(info) {
+            stop();
+            socket.off("connected", onConnected);
+
+            // Pass the rejection code of the server.
+            if (info && info.rejection) {
+                var err = newError("RejectedError", "glue: server rejected the connection: " + info.rejection.message);
+                err.code = info.rejection.code;
+                reject(err);
+                return;
+            }
+
+            reject(new Error("glue: failed to connect to the server"));
+        };
+
+        socket.once("connected", onConnected);
+        socket.once("disconnected", onDisconnected);
+    });
+};
+
+// Include the shared socket mode.
+@@include('./shared.js')
+
+// Include the logical socket multiplexing.
+@@include('./mux.js')
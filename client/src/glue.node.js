@@ -0,0 +1,45 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  Node.js build of the glue library.
+ *  The websocket transport uses the ws module and
+ *  the ajax transport the http and https modules.
+ *  The host has to be passed to the glue function.
+ */
+
+'use strict';
+
+@@include('./node-xhr.js')
+
+@@include('./glue.js')
+
+// Set the Node.js environment.
+// The ws module is loaded lazily. The ajax socket works without it.
+glue.env = {
+    XMLHttpRequest: NodeXMLHttpRequest
+};
+
+try {
+    glue.env.WebSocket = require("ws");
+} catch (e) {
+    // Fallback to the ajax socket if the ws module is not installed.
+    glue.env.WebSocket = undefined;
+}
+
+module.exports = glue;
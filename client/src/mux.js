@@ -0,0 +1,233 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives outside of the glue function.
+ *  Multiplexes logical sockets over one connection.
+ */
+
+// mux creates a carrier connection which transports multiple logical sockets.
+// Each logical socket created with the socket method is a complete glue socket
+// with its own socket ID, channels and lifecycle. All logical sockets share
+// the physical connection of the carrier.
+glue.mux = function(host, options) {
+    // Turn on strict mode.
+    'use strict';
+
+    /*
+     * Constants
+     */
+
+    var MuxChannelName = "_mux",
+        Delimiter = "&";
+
+    var FrameTypes = {
+        Data:   "d",
+        Close:  "c"
+    };
+
+
+
+    /*
+     * Variables
+     */
+
+    var sockets     = {},   // The opened logical backend sockets by ID.
+        pending     = [],   // Logical backend sockets waiting for the carrier connection.
+        idCount     = 0,
+        logical     = [],   // The created logical glue sockets.
+        carrier,
+        muxChannel;
+
+
+
+    /*
+     * Private Methods
+     */
+
+    var extend = function(dst) {
+        for (var i = 1; i < arguments.length; i++) {
+            for (var key in arguments[i]) {
+                if (arguments[i] && arguments[i].hasOwnProperty(key)) {
+                    dst[key] = arguments[i][key];
+                }
+            }
+        }
+        return dst;
+    };
+
+    var sendFrame = function(type, id, data) {
+        muxChannel.send(type + String(id.length) + Delimiter + id + data);
+    };
+
+    var openSocket = function(bs, id) {
+        sockets[id] = bs;
+
+        // Trigger the open event during the next tick.
+        setTimeout(function() {
+            if (sockets[id] === bs) {
+                bs.onOpen();
+            }
+        }, 0);
+    };
+
+    // The transport passed to the logical backend sockets.
+    var transport = {
+        open: function(bs) {
+            idCount += 1;
+            var id = String(idCount);
+
+            if (carrier.state() === "connected") {
+                openSocket(bs, id);
+            } else {
+                pending.push({ bs: bs, id: id });
+            }
+
+            return id;
+        },
+
+        send: function(id, data) {
+            if (sockets[id]) {
+                sendFrame(FrameTypes.Data, id, data);
+            }
+        },
+
+        close: function(id) {
+            // Remove a pending socket.
+            for (var i = 0; i < pending.length; i++) {
+                if (pending[i].id === id) {
+                    pending.splice(i, 1);
+                    return;
+                }
+            }
+
+            if (!sockets[id]) {
+                return;
+            }
+
+            delete sockets[id];
+            sendFrame(FrameTypes.Close, id, "");
+        }
+    };
+
+    var onFrame = function(frame) {
+        var type = frame.charAt(0),
+            data = frame.substr(1),
+            pos = data.indexOf(Delimiter),
+            len = parseInt(data.substring(0, pos), 10);
+
+        if (pos < 0 || isNaN(len)) {
+            console.log("glue: mux: received invalid frame");
+            return;
+        }
+
+        var id = data.substr(pos + 1, len),
+            bs = sockets[id];
+        data = data.substr(pos + 1 + len);
+
+        // Ignore frames of closed logical sockets.
+        if (!bs) {
+            return;
+        }
+
+        if (type === FrameTypes.Data) {
+            bs.onMessage(data);
+        } else if (type === FrameTypes.Close) {
+            delete sockets[id];
+            bs.onClose();
+        }
+    };
+
+    var onCarrierState = function(info) {
+        var id;
+
+        // Open all pending logical sockets.
+        if (info.state === "connected") {
+            var p = pending;
+            pending = [];
+            for (var i = 0; i < p.length; i++) {
+                openSocket(p[i].bs, p[i].id);
+            }
+            return;
+        }
+
+        // The carrier connection was lost. Close all logical sockets.
+        // They reconnect as soon as the carrier is connected again.
+        var s = sockets;
+        sockets = {};
+        for (id in s) {
+            if (s.hasOwnProperty(id)) {
+                s[id].onClose();
+            }
+        }
+    };
+
+
+
+    /*
+     * Initialize section
+     */
+
+    // Create the carrier socket.
+    carrier = glue(host, extend({}, options, {
+        muxCarrier:         true,
+        clockSyncSamples:   0,
+        offlineQueue:       false
+    }));
+    if (!carrier) {
+        return;
+    }
+
+    muxChannel = carrier.channel(MuxChannelName, { json: false });
+    muxChannel.onMessage(onFrame);
+    carrier.on("statechange", onCarrierState);
+
+
+
+    /*
+     * Public Instance
+     */
+
+    return {
+        // carrier returns the glue socket of the physical connection.
+        carrier: function() {
+            return carrier;
+        },
+
+        // socket creates a new logical socket with optional socket options.
+        socket: function(opts) {
+            var socket = glue(host, extend({}, options, opts, {
+                muxTransport: transport
+            }));
+            if (socket) {
+                logical.push(socket);
+            }
+            return socket;
+        },
+
+        // close the carrier connection and all logical sockets.
+        close: function() {
+            for (var i = 0; i < logical.length; i++) {
+                logical[i].close();
+            }
+            logical = [];
+
+            carrier.close();
+        }
+    };
+};
@@ -0,0 +1,62 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+// A logical socket layer which shares the connection of a carrier socket.
+// The carrier transport is passed with the muxTransport option (see glue.mux).
+var newMuxSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        transport = options.muxTransport,
+        id = false;
+
+    // The carrier channel is text based. Binary data has to be encoded.
+    s.binary = false;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        id = transport.open(s);
+    };
+
+    s.send = function (data) {
+        transport.send(id, data);
+    };
+
+    s.reset = function() {
+        // Close the logical socket if opened.
+        if (id !== false) {
+            transport.close(id);
+        }
+
+        id = false;
+    };
+
+    return s;
+};
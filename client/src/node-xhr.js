@@ -0,0 +1,98 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the Node.js build.
+ */
+
+// NodeXMLHttpRequest implements the subset of the XMLHttpRequest interface
+// required by the ajax socket with the Node.js http and https modules.
+var NodeXMLHttpRequest = function() {
+    var xhr = this,
+        method, url, req,
+        aborted = false;
+
+    xhr.response     = null;
+    xhr.responseType = "text";
+    xhr.status       = 0;
+    xhr.timeout      = 0;
+
+    xhr.open = function(m, u) {
+        method = m;
+        url = u;
+    };
+
+    xhr.send = function(data) {
+        var u = new URL(url),
+            transport = (u.protocol === "https:") ? require("https") : require("http");
+
+        req = transport.request(u, {
+            method:  method,
+            headers: {
+                "Content-Type": "text/plain;charset=UTF-8",
+                "User-Agent":   "glue-node"
+            }
+        }, function(res) {
+            var chunks = [];
+
+            res.setEncoding("utf8");
+            res.on("data", function(chunk) {
+                chunks.push(chunk);
+            });
+            res.on("end", function() {
+                if (aborted) {
+                    return;
+                }
+
+                xhr.status = res.statusCode;
+                xhr.response = chunks.join("");
+
+                if (xhr.onload) {
+                    xhr.onload();
+                }
+            });
+        });
+
+        req.on("error", function() {
+            if (!aborted && xhr.onerror) {
+                xhr.onerror();
+            }
+        });
+
+        if (xhr.timeout > 0) {
+            req.setTimeout(xhr.timeout, function() {
+                aborted = true;
+                req.destroy();
+
+                if (xhr.ontimeout) {
+                    xhr.ontimeout();
+                }
+            });
+        }
+
+        req.end(data);
+    };
+
+    xhr.abort = function() {
+        aborted = true;
+
+        if (req) {
+            req.destroy();
+        }
+    };
+};
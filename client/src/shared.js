@@ -0,0 +1,279 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives outside of the glue function.
+ *  The client side of the shared socket mode.
+ */
+
+// shared creates a socket which shares a single connection with all other
+// browser tabs of the same origin. The connection lives in a SharedWorker
+// running the glue-sharedworker.js script located at the worker URL.
+// A normal socket is created if SharedWorkers are not supported.
+// The returned object provides the same methods as a normal socket.
+glue.shared = function(workerURL, host, options) {
+    // Turn on strict mode.
+    'use strict';
+
+    // Include the dependencies.
+    @@include('./emitter.js')
+
+
+
+    /*
+     * Initialize section
+     */
+
+    // Fallback to a normal socket.
+    if (typeof SharedWorker === "undefined") {
+        return glue(host, options);
+    }
+
+    // Workers have no current location. Resolve the host string here.
+    if (!host) {
+        host = window.location.protocol + "//" + window.location.host;
+    }
+
+
+
+    /*
+     * Variables
+     */
+
+    var emitter         = new Emitter,
+        worker          = new SharedWorker(workerURL),
+        port            = worker.port,
+        state           = {
+            state:    "disconnected",
+            type:     "",
+            socketID: "",
+            version:  "",
+            info:     { state: "disconnected" },
+            clockOffset: 0
+        },
+        channels        = {},
+        discardCallbacks = {},
+        discardID       = 0;
+
+
+
+    /*
+     * Methods
+     */
+
+    var post = function(msg) {
+        port.postMessage(msg);
+    };
+
+    var getChannel = function(name) {
+        var c = channels[name];
+        if (c) {
+            return c;
+        }
+
+        c = {
+            onMessageFunc: function() {},
+            listeners:     []
+        };
+
+        c.instance = {
+            onMessage: function(f) {
+                c.onMessageFunc = f;
+            },
+
+            subscribe: function(f) {
+                c.listeners.push(f);
+
+                return function() {
+                    var i = c.listeners.indexOf(f);
+                    if (i >= 0) {
+                        c.listeners.splice(i, 1);
+                    }
+                };
+            },
+
+            // Returns 1 if the shared socket is connected and 0 otherwise.
+            // The data is discarded later if the socket fails to send it.
+            send: function(data, discardCallback, opts) {
+                if (!data) {
+                    return -1;
+                }
+
+                var id = 0;
+                if (discardCallback) {
+                    id = ++discardID;
+                    discardCallbacks[id] = discardCallback;
+                }
+
+                post({ type: "send", channel: name, data: data, id: id, ttl: opts && opts.ttl });
+
+                return (state.state === "connected") ? 1 : 0;
+            }
+        };
+
+        channels[name] = c;
+
+        // Tell the worker to forward the channel messages.
+        post({ type: "channel", channel: name });
+
+        return c;
+    };
+
+    var onMessage = function(msg) {
+        var i, c;
+
+        switch (msg.type) {
+        case "state":
+            state = msg.state;
+            break;
+
+        case "event":
+            emitter.emit.apply(emitter, [msg.name].concat(msg.args || []));
+            break;
+
+        case "message":
+            c = channels[msg.channel];
+            if (!c) {
+                return;
+            }
+
+            for (i = 0; i < c.listeners.length; i++) {
+                c.listeners[i](msg.data);
+            }
+
+            try {
+                c.onMessageFunc(msg.data);
+            }
+            catch(err) {
+                console.log("glue: channel '" + msg.channel + "': onMessage event call failed: " + err.message);
+            }
+            break;
+
+        case "discard":
+            if (discardCallbacks[msg.id]) {
+                discardCallbacks[msg.id](msg.data);
+            }
+            break;
+
+        case "sent":
+            delete discardCallbacks[msg.id];
+            break;
+        }
+    };
+
+    port.onmessage = function(e) {
+        onMessage(e.data);
+    };
+    port.start();
+
+    // Attach to the shared socket.
+    post({ type: "attach", host: host, options: options });
+
+    // Detach from the shared socket if the page is left.
+    window.addEventListener("pagehide", function() {
+        post({ type: "detach" });
+    });
+
+    var mainChannel = getChannel("m").instance;
+
+
+
+    /*
+     * Socket object
+     */
+
+    return {
+        version: function() {
+            return state.version;
+        },
+
+        type: function() {
+            return state.type;
+        },
+
+        state: function() {
+            return state.state;
+        },
+
+        stateInfo: function() {
+            return state.info;
+        },
+
+        clockOffset: function() {
+            return state.clockOffset;
+        },
+
+        socketID: function() {
+            return state.socketID;
+        },
+
+        send: function(data, discardCallback, opts) {
+            return mainChannel.send(data, discardCallback, opts);
+        },
+
+        onMessage: function(f) {
+            mainChannel.onMessage(f);
+        },
+
+        subscribe: function(f) {
+            return mainChannel.subscribe(f);
+        },
+
+        on: function() {
+            emitter.on.apply(emitter, arguments);
+        },
+
+        once: function() {
+            emitter.once.apply(emitter, arguments);
+        },
+
+        off: function() {
+            emitter.off.apply(emitter, arguments);
+        },
+
+        reconnect: function() {
+            post({ type: "reconnect" });
+        },
+
+        // close detaches this tab from the shared socket.
+        // The connection is closed as soon as no tab is attached anymore.
+        close: function() {
+            post({ type: "detach" });
+        },
+
+        channel: function(name) {
+            if (!name) {
+                return false;
+            }
+            return getChannel(name).instance;
+        },
+
+        // topic subscribes the shared connection to the server topic.
+        // The subscription is kept until the connection is closed.
+        topic: function(name) {
+            if (!name) {
+                return false;
+            }
+            var c = getChannel(name).instance;
+            post({ type: "topic", channel: name });
+            return c;
+        },
+
+        unsubscribeTopic: function() {}
+    };
+};
@@ -0,0 +1,82 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+/*
+ *  This code lives inside the glue function.
+ */
+
+
+// The SockJS socket layer carries the glue protocol with the SockJS client
+// library and its fallback transports. The server has to enable the SockJS
+// endpoint. Pass the SockJS constructor with glue.env if it is not global.
+var newSockJSSocket = function () {
+    /*
+     * Variables
+     */
+
+    var s = {},
+        sock;
+
+    // SockJS only transmits strings. Binary data has to be encoded.
+    s.binary = false;
+
+
+
+    /*
+     * Socket layer implementation.
+     */
+
+    s.open = function () {
+        try {
+            // The SockJS client uses the http and https URLs.
+            var url = host + options.baseURL + "sockjs" + routingQuery();
+            sock = new env.SockJS(url, null, options.sockJSOptions || {});
+
+            // Set the callback handlers
+            sock.onmessage = function(event) {
+                s.onMessage(String(event.data));
+            };
+
+            sock.onclose = function() {
+                s.onClose();
+            };
+
+            sock.onopen = function() {
+                s.onOpen();
+            };
+        } catch (e) {
+            s.onError();
+        }
+    };
+
+    s.send = function (data) {
+        // Send the data to the server
+        sock.send(data);
+    };
+
+    s.reset = function() {
+        // Close the SockJS socket if defined.
+        if (sock) {
+            sock.close();
+        }
+
+        sock = undefined;
+    };
+
+    return s;
+};
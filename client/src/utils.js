@@ -25,7 +25,8 @@ var utils = (function() {
      * Constants
      */
 
-    var Delimiter = "&";
+    var Delimiter = "&",
+        Base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/";
 
 
 
@@ -94,6 +95,277 @@ var utils = (function() {
         return String(first.length) + Delimiter + first + second;
     };
 
+    // isBinary returns true if the value is an ArrayBuffer, a TypedArray,
+    // a DataView or a Blob.
+    instance.isBinary = function(v) {
+        if (!v || typeof v !== "object") {
+            return false;
+        }
+
+        return (typeof ArrayBuffer !== "undefined" && (v instanceof ArrayBuffer || ArrayBuffer.isView(v))) ||
+            (typeof Blob !== "undefined" && v instanceof Blob);
+    };
+
+    // isBlob returns true if the value is a Blob.
+    instance.isBlob = function(v) {
+        return typeof Blob !== "undefined" && v instanceof Blob;
+    };
+
+    // readBlob reads the content of the Blob and passes it as ArrayBuffer to the callback.
+    instance.readBlob = function(blob, callback) {
+        if (blob.arrayBuffer) {
+            blob.arrayBuffer().then(callback, function(err) {
+                console.log("glue: failed to read blob: " + err);
+            });
+            return;
+        }
+
+        var reader = new FileReader();
+        reader.onload = function() {
+            callback(reader.result);
+        };
+        reader.onerror = function() {
+            console.log("glue: failed to read blob: " + reader.error);
+        };
+        reader.readAsArrayBuffer(blob);
+    };
+
+    // toUint8Array returns an Uint8Array view of the ArrayBuffer,
+    // TypedArray or DataView value.
+    instance.toUint8Array = function(v) {
+        if (v instanceof Uint8Array) {
+            return v;
+        }
+        if (ArrayBuffer.isView(v)) {
+            return new Uint8Array(v.buffer, v.byteOffset, v.byteLength);
+        }
+
+        return new Uint8Array(v);
+    };
+
+    // encodeUTF8 returns the UTF-8 encoded bytes of the string.
+    instance.encodeUTF8 = function(str) {
+        if (typeof TextEncoder !== "undefined") {
+            return new TextEncoder().encode(str);
+        }
+
+        var s = unescape(encodeURIComponent(str)),
+            b = new Uint8Array(s.length);
+        for (var i = 0; i < s.length; i++) {
+            b[i] = s.charCodeAt(i);
+        }
+        return b;
+    };
+
+    // decodeUTF8 returns the string of the UTF-8 encoded bytes.
+    instance.decodeUTF8 = function(b) {
+        if (typeof TextDecoder !== "undefined") {
+            return new TextDecoder().decode(b);
+        }
+
+        var s = "";
+        for (var i = 0; i < b.length; i++) {
+            s += String.fromCharCode(b[i]);
+        }
+        return decodeURIComponent(escape(s));
+    };
+
+    // marshalBinary joins the command, the first string value and the
+    // binary second value into a single Uint8Array.
+    // They can be decoded by the unmarshalBinary function.
+    // In contrast to marshalValues, the length prefix is the UTF-8 byte
+    // length of the first value.
+    instance.marshalBinary = function(cmd, first, second) {
+        var firstB  = instance.encodeUTF8(first),
+            secondB = instance.toUint8Array(second),
+            head    = cmd + String(firstB.length) + Delimiter,
+            b       = new Uint8Array(head.length + firstB.length + secondB.length);
+
+        for (var i = 0; i < head.length; i++) {
+            b[i] = head.charCodeAt(i);
+        }
+        b.set(firstB, head.length);
+        b.set(secondB, head.length + firstB.length);
+
+        return b;
+    };
+
+    // unmarshalBinary splits a binary frame created by marshalBinary.
+    // An object with the command, the first string value and the
+    // second value as ArrayBuffer is returned.
+    instance.unmarshalBinary = function(data, cmdLen) {
+        var b = new Uint8Array(data),
+            pos = -1,
+            i;
+
+        // Find the delimiter position.
+        for (i = cmdLen; i < b.length; i++) {
+            if (b[i] === Delimiter.charCodeAt(0)) {
+                pos = i;
+                break;
+            }
+        }
+        if (pos < 0) {
+            return false;
+        }
+
+        // Extract the command and the value length integer of the first value.
+        var head = "";
+        for (i = 0; i < pos; i++) {
+            head += String.fromCharCode(b[i]);
+        }
+        var len = parseInt(head.substr(cmdLen), 10);
+
+        // Validate the length.
+        if (isNaN(len) || len < 0 || pos + 1 + len > b.length) {
+            return false;
+        }
+
+        return {
+            cmd:    head.substr(0, cmdLen),
+            first:  instance.decodeUTF8(b.subarray(pos + 1, pos + 1 + len)),
+            second: data.slice(pos + 1 + len)
+        };
+    };
+
+    // newError creates an error with the given name and message.
+    instance.newError = function(name, msg) {
+        var err = new Error(msg);
+        err.name = name;
+        return err;
+    };
+
+    // watchCancel calls the cancel function with an error as soon as the
+    // timeout in milliseconds is reached or if the AbortSignal is aborted.
+    // Both the timeout and the signal are optional values of the opts object.
+    // A function is returned which stops watching.
+    instance.watchCancel = function(opts, what, cancel) {
+        var timer = false,
+            signal = opts ? opts.signal : undefined,
+            onAbort;
+
+        var stop = function() {
+            if (timer !== false) {
+                clearTimeout(timer);
+                timer = false;
+            }
+            if (signal && onAbort) {
+                signal.removeEventListener("abort", onAbort);
+            }
+        };
+
+        if (!opts) {
+            return stop;
+        }
+
+        if (signal) {
+            if (signal.aborted) {
+                cancel(instance.newError("AbortError", "glue: " + what + " aborted"));
+                return stop;
+            }
+
+            onAbort = function() {
+                stop();
+                cancel(instance.newError("AbortError", "glue: " + what + " aborted"));
+            };
+            signal.addEventListener("abort", onAbort);
+        }
+
+        if (opts.timeout > 0) {
+            timer = setTimeout(function() {
+                timer = false;
+                stop();
+                cancel(instance.newError("TimeoutError", "glue: " + what + " timed out"));
+            }, opts.timeout);
+        }
+
+        return stop;
+    };
+
+    // btoa encodes the binary string to base64.
+    // Not all environments (React Native) provide the global btoa function.
+    var btoaFunc = function(s) {
+        if (typeof btoa !== "undefined") {
+            return btoa(s);
+        }
+
+        var out = "", c1, c2, c3;
+        for (var i = 0; i < s.length; i += 3) {
+            c1 = s.charCodeAt(i);
+            c2 = s.charCodeAt(i + 1);
+            c3 = s.charCodeAt(i + 2);
+
+            out += Base64Chars.charAt(c1 >> 2);
+            out += Base64Chars.charAt(((c1 & 3) << 4) | (c2 >> 4));
+            out += (i + 1 < s.length) ? Base64Chars.charAt(((c2 & 15) << 2) | (c3 >> 6)) : "=";
+            out += (i + 2 < s.length) ? Base64Chars.charAt(c3 & 63) : "=";
+        }
+        return out;
+    };
+
+    // atob decodes the base64 string to a binary string.
+    // Not all environments (React Native) provide the global atob function.
+    var atobFunc = function(s) {
+        if (typeof atob !== "undefined") {
+            return atob(s);
+        }
+
+        var out = "", bits = 0, n = 0, v;
+        for (var i = 0; i < s.length; i++) {
+            v = Base64Chars.indexOf(s.charAt(i));
+            if (v < 0) {
+                continue; // Skip padding.
+            }
+
+            bits = (bits << 6) | v;
+            n += 6;
+            if (n >= 8) {
+                n -= 8;
+                out += String.fromCharCode((bits >> n) & 255);
+            }
+        }
+        return out;
+    };
+
+    // base64Encode encodes the binary value to a base64 string.
+    instance.base64Encode = function(v) {
+        var b = instance.toUint8Array(v),
+            s = "";
+        for (var i = 0; i < b.length; i++) {
+            s += String.fromCharCode(b[i]);
+        }
+        return btoaFunc(s);
+    };
+
+    // base64Decode decodes the base64 string to an ArrayBuffer.
+    instance.base64Decode = function(str) {
+        var s = atobFunc(str),
+            b = new Uint8Array(s.length);
+        for (var i = 0; i < s.length; i++) {
+            b[i] = s.charCodeAt(i);
+        }
+        return b.buffer;
+    };
+
+    // clientID returns the client ID stored with the key in the session
+    // storage. A new random ID is stored if none exists. Without a session
+    // storage, the ID is only kept for the lifetime of the socket object.
+    instance.clientID = function(key) {
+        var id = Math.random().toString(36).slice(2, 12) + Math.random().toString(36).slice(2, 12);
+
+        try {
+            var stored = sessionStorage.getItem(key);
+            if (stored) {
+                return stored;
+            }
+            sessionStorage.setItem(key, id);
+        } catch (e) {
+            // The session storage is not available.
+        }
+
+        return id;
+    };
+
 
     return instance;
 })();
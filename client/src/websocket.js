@@ -29,6 +29,9 @@ var newWebSocket = function () {
     var s = {},
         ws;
 
+    // Websockets are able to transmit binary frames.
+    s.binary = true;
+
 
 
     /*
@@ -44,13 +47,22 @@ var newWebSocket = function () {
             } else {
                 url = "ws" + host.substr(4);
             }
-            url += options.baseURL + "ws";
+            url += options.baseURL + "ws" + routingQuery();
 
             // Open the websocket connection
-            ws = new WebSocket(url);
+            ws = new env.WebSocket(url);
+
+            // Receive binary frames as ArrayBuffer.
+            ws.binaryType = "arraybuffer";
 
             // Set the callback handlers
             ws.onmessage = function(event) {
+                // Pass binary data as ArrayBuffer.
+                if (typeof event.data !== "string") {
+                    s.onMessage(event.data);
+                    return;
+                }
+
                 s.onMessage(event.data.toString());
             };
 
@@ -0,0 +1,100 @@
+/*
+ *  Helpers of the client tests. The tests run the minified dist builds
+ *  in isolated contexts with the fake transports of glue-fake.js.
+ *
+ *  Usage: npm test
+ */
+
+'use strict';
+
+var fs   = require('fs'),
+    path = require('path'),
+    vm   = require('vm');
+
+var dist = path.join(__dirname, '..', 'dist');
+
+// load runs the dist files in a new context with the globals
+// and returns the context.
+var load = function(files, globals) {
+    var context = {
+        setTimeout:     setTimeout,
+        clearTimeout:   clearTimeout,
+        setInterval:    setInterval,
+        clearInterval:  clearInterval,
+        console:        { log: function() {} }
+    };
+    for (var key in globals) {
+        context[key] = globals[key];
+    }
+    vm.createContext(context);
+
+    files.forEach(function(name) {
+        var file = path.join(dist, name);
+        vm.runInContext(fs.readFileSync(file, 'utf8'), context, { filename: file });
+    });
+
+    return context;
+};
+
+// newClient creates a socket connected to a new fake server.
+// The reconnect delays are short and not randomized.
+var newClient = function(t, options, fakeOptions) {
+    var context = load(['glue.umd.js', 'glue-fake.js']),
+        fake = context.glueFake(fakeOptions),
+        o = {
+            reconnectDelay:     10,
+            reconnectDelayMax:  50,
+            reconnectJitter:    false,
+            clockSyncSamples:   0
+        };
+
+    for (var key in options) {
+        o[key] = options[key];
+    }
+
+    context.glue.env = fake.env;
+    var socket = context.glue('http://fake', o);
+    t.after(function() {
+        socket.close();
+    });
+
+    return { context: context, fake: fake, socket: socket };
+};
+
+// waitFor resolves as soon as the condition is true.
+// It is rejected after the timeout.
+var waitFor = function(cond, timeout) {
+    var deadline = Date.now() + (timeout || 2000);
+
+    return new Promise(function(resolve, reject) {
+        var check = function() {
+            if (cond()) {
+                resolve();
+            } else if (Date.now() > deadline) {
+                reject(new Error('timeout: ' + cond.toString()));
+            } else {
+                setTimeout(check, 5);
+            }
+        };
+        check();
+    });
+};
+
+// channelFrames returns the data sent by the client to the channel.
+// The array belongs to the test context to compare it with deepStrictEqual.
+var channelFrames = function(fake, name) {
+    var prefix = 'cd' + name.length + '&' + name;
+
+    return Array.from(fake.received()).filter(function(frame) {
+        return frame.indexOf(prefix) === 0;
+    }).map(function(frame) {
+        return frame.substr(prefix.length);
+    });
+};
+
+module.exports = {
+    load:          load,
+    newClient:     newClient,
+    waitFor:       waitFor,
+    channelFrames: channelFrames
+};
@@ -0,0 +1,112 @@
+'use strict';
+
+var test   = require('node:test'),
+    assert = require('node:assert'),
+    h      = require('./helpers');
+
+test('sends and receives channel messages', async function(t) {
+    var c = h.newClient(t, {}),
+        received = [];
+
+    c.socket.onMessage(function(data) {
+        received.push(data);
+    });
+    c.socket.channel('chat').onMessage(function(data) {
+        received.push('chat:' + data);
+    });
+
+    c.fake.script([{ expect: /^cd1&mhello$/, reply: 'cd1&mworld' }]);
+    c.socket.send('hello');
+    c.socket.channel('chat').send('hi');
+
+    await h.waitFor(function() { return received.length === 1; });
+    c.fake.sendChannel('chat', 'there');
+
+    await h.waitFor(function() { return received.length === 2; });
+    assert.deepStrictEqual(received, ['world', 'chat:there']);
+    assert.deepStrictEqual(h.channelFrames(c.fake, 'chat'), ['hi']);
+});
+
+test('buffers messages until connected', async function(t) {
+    var c = h.newClient(t, {});
+
+    c.fake.failConnects(1);
+    assert.strictEqual(c.socket.send('a'), 0);
+    assert.strictEqual(c.socket.send('b'), 0);
+
+    await h.waitFor(function() { return h.channelFrames(c.fake, 'm').length === 2; });
+    assert.deepStrictEqual(h.channelFrames(c.fake, 'm'), ['a', 'b']);
+    assert.strictEqual(c.socket.send('c'), 1);
+});
+
+test('discards the send buffer after the timeout', async function(t) {
+    var c = h.newClient(t, { resetSendBufferTimeout: 20, reconnectDelay: 100, reconnectDelayMax: 100 }),
+        discarded = [];
+
+    c.fake.failConnects(1);
+    c.socket.send('a', function(data) {
+        discarded.push(data);
+    });
+
+    await h.waitFor(function() { return discarded.length === 1; });
+    assert.deepStrictEqual(discarded, ['a']);
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+    assert.deepStrictEqual(h.channelFrames(c.fake, 'm'), []);
+});
+
+test('flushes the offline queue in order', async function(t) {
+    var dropped = [],
+        c = h.newClient(t, {
+            offlineQueue: {
+                maxCount: 2,
+                onDrop: function(data, reason) {
+                    dropped.push(data + ':' + reason);
+                }
+            },
+            reconnectDelay:     50,
+            reconnectDelayMax:  50
+        });
+
+    c.fake.failConnects(1);
+    c.socket.send('a');
+    c.socket.send('b');
+    c.socket.send('c');
+
+    assert.deepStrictEqual(dropped, ['a:max_count']);
+
+    await h.waitFor(function() { return h.channelFrames(c.fake, 'm').length === 2; });
+    assert.deepStrictEqual(h.channelFrames(c.fake, 'm'), ['b', 'c']);
+});
+
+test('expires the offline queue messages', async function(t) {
+    var dropped = [],
+        c = h.newClient(t, {
+            offlineQueue: {
+                ttl: 20,
+                onDrop: function(data, reason) {
+                    dropped.push(data + ':' + reason);
+                }
+            },
+            reconnectDelay:     100,
+            reconnectDelayMax:  100
+        });
+
+    c.fake.failConnects(1);
+    c.socket.send('a');
+
+    await h.waitFor(function() { return dropped.length === 1; });
+    assert.deepStrictEqual(dropped, ['a:expired']);
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+    assert.deepStrictEqual(h.channelFrames(c.fake, 'm'), []);
+});
+
+test('answers the server pings', async function(t) {
+    var c = h.newClient(t, {});
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+    c.fake.send('pi');
+
+    await h.waitFor(function() { return c.fake.received().indexOf('po') >= 0; });
+});
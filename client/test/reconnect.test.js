@@ -0,0 +1,112 @@
+'use strict';
+
+var test   = require('node:test'),
+    assert = require('node:assert'),
+    h      = require('./helpers');
+
+test('reconnects after failed connection attempts', async function(t) {
+    var c = h.newClient(t, {}),
+        waiting = [];
+
+    c.fake.failConnects(2);
+    c.socket.on('waiting', function(info) {
+        waiting.push(info.attempt);
+    });
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+
+    assert.strictEqual(c.fake.connections(), 3);
+    assert.deepStrictEqual(waiting, [1, 2]);
+});
+
+test('backs off exponentially up to the maximum delay', async function(t) {
+    var c = h.newClient(t, {
+            reconnectDelay:           10,
+            reconnectDelayMultiplier: 2,
+            reconnectDelayMax:        50
+        }),
+        delays = [];
+
+    c.fake.failConnects(4);
+    c.socket.on('waiting', function(info) {
+        delays.push(info.retryIn);
+    });
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+
+    assert.deepStrictEqual(delays, [10, 20, 40, 50]);
+});
+
+test('backs off linearly without multiplier', async function(t) {
+    var c = h.newClient(t, { reconnectDelay: 10, reconnectDelayMax: 25 }),
+        delays = [];
+
+    c.fake.failConnects(3);
+    c.socket.on('waiting', function(info) {
+        delays.push(info.retryIn);
+    });
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+
+    assert.deepStrictEqual(delays, [10, 20, 25]);
+});
+
+test('applies the full jitter', async function(t) {
+    var c = h.newClient(t, { reconnectDelay: 40, reconnectDelayMax: 40, reconnectJitter: true }),
+        delays = [];
+
+    c.fake.failConnects(5);
+    c.socket.on('waiting', function(info) {
+        delays.push(info.retryIn);
+    });
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+
+    assert.strictEqual(delays.length, 5);
+    delays.forEach(function(d) {
+        assert.ok(d >= 0 && d < 40, 'delay out of range: ' + d);
+    });
+});
+
+test('stops after the maximum reconnect attempts', async function(t) {
+    var c = h.newClient(t, { reconnectAttempts: 2 });
+
+    c.fake.failConnects(100);
+
+    await h.waitFor(function() { return c.socket.stateInfo().reason === 'max_attempts'; });
+
+    assert.strictEqual(c.socket.state(), 'disconnected');
+    assert.strictEqual(c.fake.connections(), 3);
+});
+
+test('reconnects after the connection was lost', async function(t) {
+    var c = h.newClient(t, {});
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+    c.fake.disconnect();
+
+    await h.waitFor(function() { return c.fake.connections() === 2 && c.socket.state() === 'connected'; });
+});
+
+test('does not reconnect if disabled', async function(t) {
+    var c = h.newClient(t, { reconnect: false });
+
+    await h.waitFor(function() { return c.socket.state() === 'connected'; });
+    c.fake.disconnect();
+
+    await h.waitFor(function() { return c.socket.stateInfo().reason === 'reconnect_disabled'; });
+    assert.strictEqual(c.fake.connections(), 1);
+});
+
+test('falls back to the ajax transport', async function(t) {
+    var c = h.newClient(t, {});
+
+    c.fake.failWebSocket();
+    c.socket.send('hello');
+
+    await h.waitFor(function() { return h.channelFrames(c.fake, 'm').length === 1; });
+
+    assert.strictEqual(c.socket.type(), 'AjaxSocket');
+    assert.strictEqual(c.fake.transport(), 'ajax');
+    assert.deepStrictEqual(h.channelFrames(c.fake, 'm'), ['hello']);
+});
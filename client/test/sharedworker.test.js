@@ -0,0 +1,117 @@
+'use strict';
+
+var test   = require('node:test'),
+    assert = require('node:assert'),
+    h      = require('./helpers');
+
+// newWorker runs the shared worker script with a fake server and
+// returns a function creating the tabs attached to the worker.
+var newWorker = function(t) {
+    var worker = h.load(['glue-sharedworker.js', 'glue-fake.js'], { self: {} }),
+        fake = worker.glueFake(),
+        ports = [],
+        tabs = [];
+
+    worker.glue.env = fake.env;
+
+    // Detach all tabs, so the worker closes the connection.
+    t.after(async function() {
+        tabs.forEach(function(tab) {
+            tab.close();
+        });
+
+        await h.waitFor(function() { return fake.transport() === ''; });
+
+        ports.forEach(function(port) {
+            port.close();
+        });
+    });
+
+    var SharedWorker = function() {
+        var channel = new MessageChannel();
+        ports.push(channel.port1, channel.port2);
+
+        worker.self.onconnect({ ports: [channel.port2] });
+        this.port = channel.port1;
+    };
+
+    var newTab = function() {
+        var tab = h.load(['glue.umd.js'], {
+            SharedWorker: SharedWorker,
+            window: {
+                location:         { protocol: 'http:', host: 'fake' },
+                addEventListener: function() {}
+            }
+        });
+
+        var socket = tab.glue.shared('glue-sharedworker.js', 'http://fake', {
+            reconnectDelay:   10,
+            reconnectJitter:  false,
+            clockSyncSamples: 0
+        });
+        tabs.push(socket);
+
+        return socket;
+    };
+
+    return { fake: fake, newTab: newTab };
+};
+
+test('shares one connection with all tabs', async function(t) {
+    var w = newWorker(t),
+        a = w.newTab(),
+        b = w.newTab(),
+        received = [];
+
+    a.onMessage(function(data) {
+        received.push('a:' + data);
+    });
+    b.onMessage(function(data) {
+        received.push('b:' + data);
+    });
+
+    await h.waitFor(function() { return a.state() === 'connected' && b.state() === 'connected'; });
+    assert.strictEqual(w.fake.connections(), 1);
+
+    // The messages of the server reach all tabs.
+    w.fake.sendChannel('m', 'hello');
+    await h.waitFor(function() { return received.length === 2; });
+    assert.deepStrictEqual(received.sort(), ['a:hello', 'b:hello']);
+
+    // The messages of all tabs are sent over the shared connection.
+    a.send('from a');
+    b.send('from b');
+    await h.waitFor(function() { return h.channelFrames(w.fake, 'm').length === 2; });
+    assert.deepStrictEqual(h.channelFrames(w.fake, 'm').sort(), ['from a', 'from b']);
+});
+
+test('closes the connection after the last tab detached', async function(t) {
+    var w = newWorker(t),
+        a = w.newTab(),
+        b = w.newTab();
+
+    await h.waitFor(function() { return a.state() === 'connected' && b.state() === 'connected'; });
+
+    a.close();
+    await new Promise(function(resolve) { setTimeout(resolve, 20); });
+    assert.strictEqual(w.fake.transport(), 'websocket');
+
+    b.close();
+    await h.waitFor(function() { return w.fake.transport() === ''; });
+});
+
+test('passes the reconnects to all tabs', async function(t) {
+    var w = newWorker(t),
+        a = w.newTab(),
+        b = w.newTab(),
+        events = [];
+
+    a.on('reconnecting', function() { events.push('a'); });
+    b.on('reconnecting', function() { events.push('b'); });
+
+    await h.waitFor(function() { return a.state() === 'connected' && b.state() === 'connected'; });
+    w.fake.disconnect();
+
+    await h.waitFor(function() { return w.fake.connections() === 2 && a.state() === 'connected'; });
+    assert.deepStrictEqual(events.sort(), ['a', 'b']);
+});
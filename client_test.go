@@ -0,0 +1,164 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var includeDirective = regexp.MustCompile(`@@include\('([^']+)'\)`)
+
+// The header of the minified dist files with the sha256 hash of the sources.
+var minifiedHeader = regexp.MustCompile(`^/\* Built from the client sources with sha256 ([0-9a-f]{64}) \*/\n`)
+
+// bundleClient replaces the include directives of the source
+// file with the included files like the client build does.
+func bundleClient(t *testing.T, file string) []byte {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return includeDirective.ReplaceAllFunc(data, func(m []byte) []byte {
+		name := includeDirective.FindSubmatch(m)[1]
+		return bundleClient(t, filepath.Join(filepath.Dir(file), string(name)))
+	})
+}
+
+// matchesClientSources returns true if the dist file was built from the
+// current sources. Minified files are compared by the hash of the sources.
+func matchesClientSources(t *testing.T, data []byte, file string) bool {
+	bundle := bundleClient(t, file)
+
+	m := minifiedHeader.FindSubmatch(data)
+	if m == nil {
+		return bytes.Equal(data, bundle)
+	}
+
+	sum := sha256.Sum256(bundle)
+	return string(m[1]) == hex.EncodeToString(sum[:])
+}
+
+func TestEmbeddedClientUpToDate(t *testing.T) {
+	if !matchesClientSources(t, clientScript, "client/src/glue.js") {
+		t.Fatal("client/dist/glue.js does not match the client sources: run 'node build.js' in the client directory")
+	}
+}
+
+func TestClientDistUpToDate(t *testing.T) {
+	// The dist files are built from the sources with the same name.
+	files := []string{
+		"glue.umd.js",
+		"glue.esm.js",
+		"glue.node.js",
+		"glue-sharedworker.js",
+		"glue-rx.js",
+		"glue-vue.js",
+		"glue-fake.js",
+	}
+
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join("client/dist", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !matchesClientSources(t, data, filepath.Join("client/src", name)) {
+			t.Errorf("client/dist/%s does not match the client sources: run 'node build.js' in the client directory", name)
+		}
+	}
+}
+
+func TestEmbeddedClientMinified(t *testing.T) {
+	if !minifiedHeader.Match(clientScript) {
+		t.Fatal("client/dist/glue.js is not minified: run 'node build.js' in the client directory")
+	}
+}
+
+func TestEmbeddedClientVersion(t *testing.T) {
+	// The embedded client is minified.
+	if !bytes.Contains(clientScript, []byte(`var Version="`+Version+`"`)) {
+		t.Fatalf("the embedded client does not use the protocol version %s", Version)
+	}
+}
+
+func TestClientSourceMap(t *testing.T) {
+	if clientSourceMap == nil {
+		t.Fatal("client/dist/glue.js.map is not embedded: run 'node build.js' in the client directory")
+	}
+
+	server := newTestServer(t, Options{ServeClient: true})
+
+	for _, url := range []string{"/glue/glue.js", server.ClientURL()} {
+		// The client announces the source map.
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status: %d", url, w.Code)
+		}
+		if h := w.Header().Get("SourceMap"); h != url+".map" {
+			t.Fatalf("%s: unexpected source map header: %s", url, h)
+		}
+
+		// Fetch the source map.
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", url+".map", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s.map: unexpected status: %d", url, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Fatalf("%s.map: unexpected content type: %s", url, ct)
+		}
+
+		var m struct {
+			Version        int      `json:"version"`
+			File           string   `json:"file"`
+			Sources        []string `json:"sources"`
+			SourcesContent []string `json:"sourcesContent"`
+			Mappings       string   `json:"mappings"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Version != 3 || m.File != "glue.js" || len(m.Sources) == 0 || m.Sources[0] != "../src/glue.js" {
+			t.Fatalf("%s.map: unexpected source map: version=%d file=%s sources=%v", url, m.Version, m.File, m.Sources)
+		}
+		if len(m.SourcesContent) != len(m.Sources) {
+			t.Fatalf("%s.map: expected the content of %d sources, got %d", url, len(m.Sources), len(m.SourcesContent))
+		}
+
+		// Each line except the source map comment is mapped.
+		if lines := bytes.Count(clientScript, []byte("\n")) - 1; strings.Count(m.Mappings, ";")+1 != lines {
+			t.Fatalf("%s.map: expected %d mapped lines, got %d", url, lines, strings.Count(m.Mappings, ";")+1)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used for the clock synchronization.
+	clockChannelName = "_clock"
+
+	// Clock synchronization message types. Must be one character long.
+	clockSample = "s"
+	clockOffset = "o"
+)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// ClockOffset returns the estimated offset of the client's clock
+// relative to the server clock. A positive value means that the
+// client clock is ahead. Zero is returned until the client
+// synchronized its clock after connecting.
+func (s *Socket) ClockOffset() time.Duration {
+	// Lock the mutex.
+	s.clockMutex.Lock()
+	defer s.clockMutex.Unlock()
+
+	return s.clockOffset
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// handleClock handles the clock synchronization messages of the client.
+// The client sends samples with its current timestamp. The server replies
+// with the client timestamp and the server timestamp in milliseconds.
+// The client estimates the offset with the sample of the lowest round trip
+// time and sends the result back.
+func (s *Socket) handleClock(data string) error {
+	if len(data) == 0 {
+		return fmt.Errorf("invalid clock data")
+	}
+
+	switch data[:1] {
+	case clockSample:
+		// Reply with the client and the server timestamp.
+		now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		reply := clockSample + utils.MarshalValues(data[1:], now)
+		s.write(cmdChannelData + utils.MarshalValues(clockChannelName, reply))
+
+	case clockOffset:
+		// The client sends the offset of the server clock in milliseconds.
+		ms, err := strconv.ParseFloat(data[1:], 64)
+		if err != nil {
+			return fmt.Errorf("invalid clock offset: %v", err)
+		}
+
+		// Lock the mutex.
+		s.clockMutex.Lock()
+		defer s.clockMutex.Unlock()
+
+		s.clockOffset = -time.Duration(ms * float64(time.Millisecond))
+
+	default:
+		return fmt.Errorf("invalid clock message type")
+	}
+
+	return nil
+}
@@ -0,0 +1,626 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"errors"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The number of virtual nodes of each node on the hash ring.
+	// More virtual nodes distribute the keys more evenly.
+	hashRingReplicas = 64
+
+	// The maximum duration to wait for the reply of a cluster request.
+	clusterRequestTimeout = 5 * time.Second
+
+	clusterRequestIDLength = 16
+
+	// The workers and the queue size per worker of the socket tasks:
+	// the directory and topic registrations and the remote socket writes.
+	clusterWorkers   = 8
+	clusterQueueSize = 1024
+)
+
+// The cluster message types.
+const (
+	clusterTopicSubscribe   = "ts" // The sender node has subscribers of the topic.
+	clusterTopicUnsubscribe = "tu" // The sender node has no subscribers of the topic anymore.
+	clusterTopicPublish     = "tp" // Publish the data to the topic. Sent to the topic owner.
+	clusterTopicDeliver     = "td" // Deliver the published data. Sent by the topic owner.
+
+	clusterSocketRegister   = "sr" // The socket is connected to the sender node. Sent to the directory owner.
+	clusterSocketUnregister = "su" // The socket closed. Sent to the directory owner.
+	clusterSocketLookup     = "sl" // Request the node of the socket from the directory owner.
+	clusterSocketWrite      = "sw" // Write the data to the socket. Sent to the node of the socket.
+	clusterReply            = "re" // The reply to a request with the node of the socket.
+
+	clusterPresenceUpdate   = "pu" // A local presence count of the sender changed.
+	clusterPresenceSnapshot = "ps" // All local presence counts of the sender.
+	clusterPresenceRequest  = "pr" // Request the presence snapshot of the receiver.
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	ErrSocketNotFound = errors.New("the socket was not found")
+	ErrClusterTimeout = errors.New("the cluster request timed out")
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A ClusterMessage is passed between the nodes of a cluster.
+// Adapters have to deliver the messages of one sender in order.
+type ClusterMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic,omitempty"`
+	Data  string `json:"data,omitempty"`
+
+	// ID identifies a request and its reply.
+	ID string `json:"id,omitempty"`
+
+	// Socket is the socket ID of socket messages.
+	Socket string `json:"socket,omitempty"`
+
+	// Node is the node of the socket passed with replies.
+	// Empty if the socket was not found.
+	Node string `json:"node,omitempty"`
+}
+
+// A ClusterAdapter connects the glue servers of multiple nodes.
+// Each topic is owned by one node, chosen by consistent hashing of the topic
+// name. Published messages are passed to the owner, which forwards them
+// only to the nodes with subscribers of the topic. The socket IDs are
+// partitioned the same way to locate the node of a socket.
+type ClusterAdapter interface {
+	// NodeID returns the unique ID of the local node.
+	NodeID() string
+
+	// Nodes returns the IDs of all active nodes including the local node.
+	Nodes() []string
+
+	// Send passes the message to the node.
+	Send(node string, m *ClusterMessage) error
+
+	// OnMessage sets the function which is called with the messages
+	// sent to the local node.
+	OnMessage(f func(from string, m *ClusterMessage))
+
+	// OnNodesChanged sets the function which is called as
+	// soon as nodes join or leave the cluster.
+	OnNodesChanged(f func())
+}
+
+//######################//
+//### Hash Ring type ###//
+//######################//
+
+// A hashRing maps keys to nodes with consistent hashing.
+// Only the keys of a joined or left node are moved.
+type hashRing struct {
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+func newHashRing(nodes []string) *hashRing {
+	r := &hashRing{
+		nodes: make(map[uint32]string, len(nodes)*hashRingReplicas),
+	}
+
+	for _, node := range nodes {
+		for i := 0; i < hashRingReplicas; i++ {
+			// The separator keeps the keys of node names with digits unique.
+			h := crc32.ChecksumIEEE([]byte(node + "#" + strconv.Itoa(i)))
+			r.hashes = append(r.hashes, h)
+			r.nodes[h] = node
+		}
+	}
+
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+
+	return r
+}
+
+// owner returns the node responsible for the key.
+// An empty string is returned if the ring has no nodes.
+func (r *hashRing) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.nodes[r.hashes[i]]
+}
+
+//####################//
+//### Cluster type ###//
+//####################//
+
+type cluster struct {
+	server  *Server
+	adapter ClusterAdapter
+	nodeID  string
+
+	ring *hashRing
+
+	// The nodes with subscribers of the topics owned by the local node.
+	interests map[string]map[string]struct{}
+
+	// The nodes of the sockets owned by the local node.
+	directory map[string]string
+
+	// The reply channels of the pending requests.
+	pending map[string]chan *ClusterMessage
+
+	// Replicates the user and topic member presence.
+	presence *presence
+
+	// Runs the socket tasks in order per socket, so neither the
+	// adapter delivery nor the read loops of carriers are blocked.
+	workers *workerPool
+
+	mutex sync.Mutex
+}
+
+func newCluster(server *Server, adapter ClusterAdapter) *cluster {
+	c := &cluster{
+		server:    server,
+		adapter:   adapter,
+		nodeID:    adapter.NodeID(),
+		ring:      newHashRing(adapter.Nodes()),
+		interests: make(map[string]map[string]struct{}),
+		directory: make(map[string]string),
+		pending:   make(map[string]chan *ClusterMessage),
+		workers:   newWorkerPool(clusterWorkers, clusterQueueSize),
+	}
+
+	c.presence = newPresence(c)
+
+	adapter.OnMessage(c.handleMessage)
+	adapter.OnNodesChanged(c.onNodesChanged)
+
+	c.presence.start()
+
+	return c
+}
+
+// owner returns the node responsible for the key.
+func (c *cluster) owner(key string) string {
+	// Lock the mutex.
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.ring.owner(key)
+}
+
+// send passes the message to the node. Messages
+// to the local node are handled directly.
+func (c *cluster) send(node string, m *ClusterMessage) error {
+	if node == c.nodeID || node == "" {
+		c.handleMessage(c.nodeID, m)
+		return nil
+	}
+
+	err := c.adapter.Send(node, m)
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"node":  node,
+			"type":  m.Type,
+			"topic": m.Topic,
+		}).Warningf("failed to send cluster message: %v", err)
+	}
+
+	return err
+}
+
+// request sends the message to the node and waits for the reply.
+func (c *cluster) request(node string, m *ClusterMessage) (*ClusterMessage, error) {
+	replyChan := make(chan *ClusterMessage, 1)
+
+	// Register the request with a new ID.
+	func() {
+		// Lock the mutex.
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		for {
+			m.ID = utils.RandomString(clusterRequestIDLength)
+			if _, ok := c.pending[m.ID]; !ok {
+				break
+			}
+		}
+
+		c.pending[m.ID] = replyChan
+	}()
+
+	// Remove the request again.
+	defer func() {
+		// Lock the mutex.
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		delete(c.pending, m.ID)
+	}()
+
+	if err := c.send(node, m); err != nil {
+		return nil, err
+	}
+
+	timeout := time.NewTimer(clusterRequestTimeout)
+	defer timeout.Stop()
+
+	select {
+	case r := <-replyChan:
+		return r, nil
+	case <-timeout.C:
+		return nil, ErrClusterTimeout
+	}
+}
+
+// reply sends the reply to a request.
+func (c *cluster) reply(node string, m *ClusterMessage, socketNode string) {
+	c.send(node, &ClusterMessage{
+		Type: clusterReply,
+		ID:   m.ID,
+		Node: socketNode,
+	})
+}
+
+// registerSocket registers the local socket at the directory owner.
+// The message is sent by a worker without blocking the caller.
+func (c *cluster) registerSocket(id string) {
+	c.pushSocketTask(id, "register", func() {
+		c.send(c.owner(id), &ClusterMessage{
+			Type:   clusterSocketRegister,
+			Socket: id,
+		})
+	})
+}
+
+// unregisterSocket removes the local socket from the directory owner.
+// The message is sent by a worker after the registration.
+func (c *cluster) unregisterSocket(id string) {
+	c.pushSocketTask(id, "unregister", func() {
+		c.send(c.owner(id), &ClusterMessage{
+			Type:   clusterSocketUnregister,
+			Socket: id,
+		})
+	})
+}
+
+// pushSocketTask queues the task of the socket or topic key. The tasks of a
+// key run in order. The task is dropped and logged if the queue is full.
+func (c *cluster) pushSocketTask(id, task string, f func()) {
+	if !c.workers.push(id, f) {
+		log.L.WithFields(logrus.Fields{
+			"socketID": id,
+			"task":     task,
+		}).Warningf("glue: cluster socket queue is full: task dropped")
+	}
+}
+
+// findSocket returns the node of the socket.
+func (c *cluster) findSocket(id string) (string, error) {
+	r, err := c.request(c.owner(id), &ClusterMessage{
+		Type:   clusterSocketLookup,
+		Socket: id,
+	})
+	if err != nil {
+		return "", err
+	} else if r.Node == "" {
+		return "", ErrSocketNotFound
+	}
+
+	return r.Node, nil
+}
+
+// writeToSocket writes the data to the main channel of the socket on its node.
+func (c *cluster) writeToSocket(id, data string) error {
+	node, err := c.findSocket(id)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.request(node, &ClusterMessage{
+		Type:   clusterSocketWrite,
+		Socket: id,
+		Data:   data,
+	})
+	if err != nil {
+		return err
+	} else if r.Node == "" {
+		return ErrSocketNotFound
+	}
+
+	return nil
+}
+
+// subscribe registers the local subscribers of the topic at the topic owner.
+func (c *cluster) subscribe(topic string) {
+	c.send(c.owner(topic), &ClusterMessage{
+		Type:  clusterTopicSubscribe,
+		Topic: topic,
+	})
+}
+
+// unsubscribe removes the registration of the local node at the topic owner.
+func (c *cluster) unsubscribe(topic string) {
+	c.send(c.owner(topic), &ClusterMessage{
+		Type:  clusterTopicUnsubscribe,
+		Topic: topic,
+	})
+}
+
+// publish passes the data to the topic owner.
+func (c *cluster) publish(topic, data string) {
+	c.send(c.owner(topic), &ClusterMessage{
+		Type:  clusterTopicPublish,
+		Topic: topic,
+		Data:  data,
+	})
+}
+
+func (c *cluster) handleMessage(from string, m *ClusterMessage) {
+	switch m.Type {
+	case clusterTopicSubscribe:
+		// Lock the mutex.
+		c.mutex.Lock()
+		nodes, ok := c.interests[m.Topic]
+		if !ok {
+			nodes = make(map[string]struct{})
+			c.interests[m.Topic] = nodes
+		}
+		nodes[from] = struct{}{}
+		c.mutex.Unlock()
+
+	case clusterTopicUnsubscribe:
+		// Lock the mutex.
+		c.mutex.Lock()
+		delete(c.interests[m.Topic], from)
+		if len(c.interests[m.Topic]) == 0 {
+			delete(c.interests, m.Topic)
+		}
+		c.mutex.Unlock()
+
+	case clusterTopicPublish:
+		// Forward the data to all nodes with subscribers.
+		d := &ClusterMessage{
+			Type:  clusterTopicDeliver,
+			Topic: m.Topic,
+			Data:  m.Data,
+		}
+
+		for _, node := range c.interestedNodes(m.Topic) {
+			c.send(node, d)
+		}
+
+	case clusterTopicDeliver:
+		if t := c.server.getTopic(m.Topic); t != nil {
+			t.deliver(m.Data)
+		}
+
+	case clusterSocketRegister:
+		// Lock the mutex.
+		c.mutex.Lock()
+		c.directory[m.Socket] = from
+		c.mutex.Unlock()
+
+	case clusterSocketUnregister:
+		// Lock the mutex.
+		c.mutex.Lock()
+		if c.directory[m.Socket] == from {
+			delete(c.directory, m.Socket)
+		}
+		c.mutex.Unlock()
+
+	case clusterSocketLookup:
+		// Lock the mutex.
+		c.mutex.Lock()
+		node := c.directory[m.Socket]
+		c.mutex.Unlock()
+
+		c.reply(from, m, node)
+
+	case clusterSocketWrite:
+		// Don't block the message delivery with a full write buffer.
+		// The requester times out if the write is dropped.
+		c.pushSocketTask(m.Socket, "write", func() {
+			node := ""
+			if socket := c.server.GetSocket(m.Socket); socket != nil && !socket.IsClosed() {
+				socket.Write(m.Data)
+				node = c.nodeID
+			}
+
+			c.reply(from, m, node)
+		})
+
+	case clusterPresenceUpdate, clusterPresenceSnapshot, clusterPresenceRequest:
+		c.presence.handleMessage(from, m)
+
+	case clusterReply:
+		// Lock the mutex.
+		c.mutex.Lock()
+		replyChan, ok := c.pending[m.ID]
+		c.mutex.Unlock()
+
+		if ok {
+			select {
+			case replyChan <- m:
+			default:
+			}
+		}
+
+	default:
+		log.L.WithFields(logrus.Fields{
+			"node": from,
+			"type": m.Type,
+		}).Warningf("received invalid cluster message")
+	}
+}
+
+// interestedNodes returns the nodes with subscribers of the topic.
+func (c *cluster) interestedNodes(topic string) []string {
+	// Lock the mutex.
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	nodes := make([]string, 0, len(c.interests[topic]))
+	for node := range c.interests[topic] {
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+// onNodesChanged rebuilds the hash ring and moves the registrations
+// of the local subscribers and sockets to the new owners.
+func (c *cluster) onNodesChanged() {
+	nodes := c.adapter.Nodes()
+
+	active := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		active[node] = struct{}{}
+	}
+
+	var previous *hashRing
+	func() {
+		// Lock the mutex.
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		previous = c.ring
+		c.ring = newHashRing(nodes)
+
+		// Remove the interests of the left nodes.
+
+		for topic, interested := range c.interests {
+			for node := range interested {
+				if _, ok := active[node]; !ok {
+					delete(interested, node)
+				}
+			}
+
+			if len(interested) == 0 {
+				delete(c.interests, topic)
+			}
+		}
+
+		// Remove the sockets of the left nodes.
+		for id, node := range c.directory {
+			if _, ok := active[node]; !ok {
+				delete(c.directory, id)
+			}
+		}
+	}()
+
+	for _, t := range c.server.topicList() {
+		t.moveCluster(c, previous, active)
+	}
+
+	c.presence.nodesChanged(nodes)
+
+	for _, socket := range c.server.Sockets() {
+		id := socket.ID()
+		c.move(previous, active, id, &ClusterMessage{
+			Type:   clusterSocketRegister,
+			Socket: id,
+		}, &ClusterMessage{
+			Type:   clusterSocketUnregister,
+			Socket: id,
+		})
+	}
+}
+
+// move sends the register message to the new owner of the key and the
+// unregister message to the previous owner, if the owner changed. Previous
+// owners which left the cluster are skipped. The cluster mutex must not be locked.
+func (c *cluster) move(previous *hashRing, active map[string]struct{}, key string, register, unregister *ClusterMessage) {
+	owner := c.owner(key)
+	prev := previous.owner(key)
+	if owner == prev {
+		return
+	}
+
+	if _, ok := active[prev]; ok {
+		c.send(prev, unregister)
+	}
+
+	c.send(owner, register)
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// FindSocket returns the ID of the cluster node the socket is connected to.
+// ErrSocketNotFound is returned if the socket is not connected to any node.
+// Without cluster mode, only the sockets of this server are found and
+// the node ID is empty.
+func (s *Server) FindSocket(id string) (node string, err error) {
+	if s.cluster == nil {
+		if s.GetSocket(id) == nil {
+			return "", ErrSocketNotFound
+		}
+		return "", nil
+	}
+
+	return s.cluster.findSocket(id)
+}
+
+// WriteToSocket writes the data to the main channel of the socket. In cluster
+// mode, the write is forwarded to the node the socket is connected to.
+// ErrSocketNotFound is returned if the socket is not found or closed.
+func (s *Server) WriteToSocket(id, data string) error {
+	if socket := s.GetSocket(id); socket != nil && !socket.IsClosed() {
+		socket.Write(data)
+		return nil
+	}
+
+	if s.cluster == nil {
+		return ErrSocketNotFound
+	}
+
+	return s.cluster.writeToSocket(id, data)
+}
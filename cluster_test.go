@@ -0,0 +1,339 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A testClusterAdapter records the sent messages of a single node.
+// The other nodes of the cluster don't reply.
+type testClusterAdapter struct {
+	node   string
+	nodes  []string
+	onSend func(node string, m *ClusterMessage)
+
+	sent           []testClusterMessage
+	onMessage      func(from string, m *ClusterMessage)
+	onNodesChanged func()
+	mutex          sync.Mutex
+}
+
+type testClusterMessage struct {
+	node string
+	m    ClusterMessage
+}
+
+func (a *testClusterAdapter) NodeID() string {
+	return a.node
+}
+
+func (a *testClusterAdapter) Nodes() []string {
+	// Lock the mutex.
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return append([]string(nil), a.nodes...)
+}
+
+func (a *testClusterAdapter) Send(node string, m *ClusterMessage) error {
+	if a.onSend != nil {
+		a.onSend(node, m)
+	}
+
+	// Lock the mutex.
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.sent = append(a.sent, testClusterMessage{node: node, m: *m})
+	return nil
+}
+
+func (a *testClusterAdapter) OnMessage(f func(from string, m *ClusterMessage)) {
+	a.onMessage = f
+}
+
+func (a *testClusterAdapter) OnNodesChanged(f func()) {
+	a.onNodesChanged = f
+}
+
+// setNodes changes the active nodes and triggers the nodes changed function.
+func (a *testClusterAdapter) setNodes(nodes ...string) {
+	func() {
+		// Lock the mutex.
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		a.nodes = nodes
+	}()
+
+	a.onNodesChanged()
+}
+
+// messages returns the sent messages of the type.
+func (a *testClusterAdapter) messages(typ string) []testClusterMessage {
+	// Lock the mutex.
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var list []testClusterMessage
+	for _, sent := range a.sent {
+		if sent.m.Type == typ {
+			list = append(list, sent)
+		}
+	}
+
+	return list
+}
+
+func TestClusterCarrierUnregisterWithoutLock(t *testing.T) {
+	adapter := &testClusterAdapter{node: "a", nodes: []string{"a", "b", "c"}}
+	server := newTestServer(t, Options{Cluster: adapter})
+
+	// Adapters might call the server while sending.
+	adapter.onSend = func(string, *ClusterMessage) {
+		server.Sockets()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 10; i++ {
+			conn := server.ConnectMemory("127.0.0.1", "test")
+			if err := conn.Send(cmdInit + `{"version":"` + Version + `","mux":true}`); err != nil {
+				done <- err
+				return
+			}
+			if _, err := conn.Receive(5 * time.Second); err != nil {
+				done <- err
+				return
+			}
+			conn.Close()
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the cluster adapter was called with the sockets mutex locked")
+	}
+
+	if len(adapter.messages(clusterSocketUnregister)) == 0 {
+		t.Fatal("expected the carrier sockets to be unregistered")
+	}
+}
+
+func TestHashRingReplicaKeys(t *testing.T) {
+	// The keys "1" + "1x" and "11" + "x" collide without a separator.
+	r := newHashRing([]string{"x", "1x"})
+
+	if len(r.nodes) != 2*hashRingReplicas {
+		t.Fatalf("expected %d replicas, got %d", 2*hashRingReplicas, len(r.nodes))
+	}
+}
+
+func TestHashRingMovedKeys(t *testing.T) {
+	before := newHashRing([]string{"a", "b"})
+	after := newHashRing([]string{"a", "b", "c"})
+
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if owner := after.owner(key); owner != before.owner(key) {
+			if owner != "c" {
+				t.Fatalf("key %s moved to %s instead of the joined node", key, owner)
+			}
+			moved++
+		}
+	}
+
+	// About a third of the keys move to the joined node.
+	if moved < 200 || moved > 500 {
+		t.Fatalf("unexpected number of moved keys: %d", moved)
+	}
+
+	if owner := newHashRing(nil).owner("key"); owner != "" {
+		t.Fatalf("expected no owner of an empty ring, got %s", owner)
+	}
+}
+
+func TestClusterNodesChangedMovesSockets(t *testing.T) {
+	adapter := &testClusterAdapter{node: "a", nodes: []string{"a", "b"}}
+	server := newTestServer(t, Options{Cluster: adapter})
+
+	var sockets []*Socket
+	for i := 0; i < 20; i++ {
+		_, s := connectTestSocket(t, server)
+		sockets = append(sockets, s)
+	}
+
+	previous := newHashRing([]string{"a", "b"})
+	adapter.setNodes("a", "b", "c")
+	current := newHashRing([]string{"a", "b", "c"})
+
+	registered := make(map[string]string)
+	for _, sent := range adapter.messages(clusterSocketRegister) {
+		registered[sent.m.Socket] = sent.node
+	}
+	unregistered := make(map[string]string)
+	for _, sent := range adapter.messages(clusterSocketUnregister) {
+		unregistered[sent.m.Socket] = sent.node
+	}
+
+	for _, s := range sockets {
+		id := s.ID()
+		prev, owner := previous.owner(id), current.owner(id)
+
+		if prev == owner {
+			if _, ok := unregistered[id]; ok {
+				t.Fatalf("socket %s was unregistered without moving", id)
+			}
+			continue
+		}
+
+		if registered[id] != owner {
+			t.Fatalf("socket %s was not registered at the new owner %s", id, owner)
+		}
+
+		// The local directory is updated directly.
+		if prev == "b" && unregistered[id] != "b" {
+			t.Fatalf("socket %s was not unregistered at the previous owner", id)
+		}
+	}
+
+	// The sockets moved away from the local node are removed from its directory.
+	server.cluster.mutex.Lock()
+	defer server.cluster.mutex.Unlock()
+
+	for id, node := range server.cluster.directory {
+		if current.owner(id) != "a" {
+			t.Fatalf("the directory keeps socket %s of node %s", id, node)
+		}
+	}
+}
+
+func TestClusterSocketTasksBounded(t *testing.T) {
+	adapter := &testClusterAdapter{node: "a", nodes: []string{"a", "b"}}
+	server := newTestServer(t, Options{Cluster: adapter})
+
+	// Block all sends of the adapter.
+	block := make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(block) }) }
+	defer unblock()
+
+	adapter.onSend = func(string, *ClusterMessage) {
+		<-block
+	}
+
+	// The registration doesn't block the socket creation.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ConnectMemory("127.0.0.1", "test")
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the socket creation waited for the cluster adapter")
+	}
+
+	// A burst of remote writes doesn't create a goroutine per message.
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < clusterQueueSize; i++ {
+		adapter.onMessage("b", &ClusterMessage{
+			Type:   clusterSocketWrite,
+			ID:     strconv.Itoa(i),
+			Socket: strconv.Itoa(i),
+			Data:   "data",
+		})
+	}
+	if n := runtime.NumGoroutine() - goroutines; n > 10 {
+		t.Fatalf("the remote writes started %d goroutines", n)
+	}
+
+	// The queued writes are replied as soon as the adapter is unblocked.
+	unblock()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(adapter.messages(clusterReply)) > 0
+	})
+}
+
+func TestClusterTopicRegistrationWithoutLock(t *testing.T) {
+	adapter := &testClusterAdapter{node: "a", nodes: []string{"a", "b"}}
+	server := newTestServer(t, Options{Cluster: adapter})
+
+	// Choose a topic owned by the remote node.
+	ring := newHashRing([]string{"a", "b"})
+	name := "topic"
+	for i := 0; ring.owner(name) != "b"; i++ {
+		name = "topic" + strconv.Itoa(i)
+	}
+	topic := server.Topic(name)
+
+	// Block all sends of the adapter.
+	block := make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(block) }) }
+	defer unblock()
+
+	adapter.onSend = func(string, *ClusterMessage) {
+		<-block
+	}
+
+	_, s := connectTestSocket(t, server)
+
+	// The topic is not blocked by the slow adapter.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		topic.Subscribe(s)
+		topic.Subscribers()
+		topic.PublishLocal("data")
+		topic.Unsubscribe(s)
+		topic.Subscribe(s)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the topic waited for the cluster adapter")
+	}
+
+	unblock()
+
+	// The registration converges to the current state.
+	waitFor(t, 5*time.Second, func() bool {
+		topic.registerMutex.Lock()
+		defer topic.registerMutex.Unlock()
+		return topic.registered
+	})
+	if n := len(adapter.messages(clusterTopicSubscribe)); n != 1 {
+		t.Fatalf("unexpected subscribe messages: %d", n)
+	}
+}
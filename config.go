@@ -0,0 +1,321 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The default prefix of the environment variables.
+	defaultConfigEnvPrefix = "GLUE_"
+)
+
+//########################//
+//### Public Functions ###//
+//########################//
+
+// LoadConfig creates the options from the JSON configuration file and the
+// environment variables with the GLUE_ prefix, for example GLUE_LISTEN_ADDRESS.
+// Environment variables override the file values. An empty path only loads
+// the environment variables. See the LoadConfigFile function for the keys.
+func LoadConfig(path string) (Options, error) {
+	var o Options
+
+	if len(path) > 0 {
+		if err := LoadConfigFile(path, &o); err != nil {
+			return o, err
+		}
+	}
+
+	if err := LoadConfigEnv(defaultConfigEnvPrefix, &o); err != nil {
+		return o, err
+	}
+
+	return o, nil
+}
+
+// LoadConfigFile sets the options from the JSON configuration file.
+// Unset keys leave the options unchanged. Durations are strings parsed
+// with time.ParseDuration, for example "30s". The cors_origins key takes
+// a list of the allowed origins. Unknown keys are rejected. Keys:
+//
+//	socket_type ("tcp", "unix" or "none"), listen_address, handle_url,
+//	tls_cert_file, tls_key_file, h2c, cors_origins, client_version_range,
+//	serve_client, strict_client_version, max_connections, read_workers,
+//	dead_letter_queue_size, dedup_window_size, require_connect_ticket,
+//	socket_id_mode ("random" or "sortable"), socket_id_prefix,
+//	connections_high_watermark, connections_low_watermark, notify_capacity,
+//	handshake_rate_limit, handshake_rate_interval, handshake_ban_duration,
+//	ping_interval, ping_timeout, idle_timeout, max_session_duration,
+//	max_egress_bandwidth, socket_bandwidth_limit, ajax_poll_timeout,
+//	ajax_poll_delay, ajax_push_retries, ajax_max_body_size, ajax_read_timeout,
+//	routing_key, routing_name, api_token, webhook_url, webhook_secret,
+//	log_level, backend_log_level, protocol_log_level, keepalive_log_level
+func LoadConfigFile(path string, o *Options) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("glue: config: %v", err)
+	}
+
+	var values map[string]json.RawMessage
+	if err = json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("glue: config: %s: %v", path, err)
+	}
+
+	// Apply the values in a fixed order.
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := configValue(values[key])
+		if err != nil {
+			return fmt.Errorf("glue: config: %s: %s: %v", path, key, err)
+		}
+
+		if err = setConfigValue(o, key, value); err != nil {
+			return fmt.Errorf("glue: config: %s: %v", path, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadConfigEnv sets the options from the environment variables with the
+// prefix. The variable names are the upper case configuration file keys,
+// for example GLUE_LISTEN_ADDRESS and GLUE_PING_INTERVAL with the GLUE_
+// prefix. The CORS origins are separated by commas.
+func LoadConfigEnv(prefix string, o *Options) error {
+	for _, key := range configKeys() {
+		name := prefix + strings.ToUpper(key)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		if err := configSetters[key](o, value); err != nil {
+			return fmt.Errorf("glue: config: %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// A configSetter sets an option from the string value.
+type configSetter func(o *Options, value string) error
+
+// configSetters holds the setters of the configuration keys.
+var configSetters = map[string]configSetter{
+	"socket_type": func(o *Options, v string) error {
+		switch v {
+		case "tcp":
+			o.HTTPSocketType = HTTPSocketTypeTCP
+		case "unix":
+			o.HTTPSocketType = HTTPSocketTypeUnix
+		case "none":
+			o.HTTPSocketType = HTTPSocketTypeNone
+		default:
+			return fmt.Errorf("invalid socket type: %q", v)
+		}
+		return nil
+	},
+	"listen_address": setConfigString(func(o *Options) *string { return &o.HTTPListenAddress }),
+	"handle_url":     setConfigString(func(o *Options) *string { return &o.HTTPHandleURL }),
+	"tls_cert_file":  setConfigString(func(o *Options) *string { return &o.TLSCertFile }),
+	"tls_key_file":   setConfigString(func(o *Options) *string { return &o.TLSKeyFile }),
+	"h2c":            setConfigBool(func(o *Options) *bool { return &o.EnableH2C }),
+	"cors_origins": func(o *Options, v string) error {
+		var origins []string
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); len(origin) > 0 {
+				origins = append(origins, origin)
+			}
+		}
+		return WithCORS(origins...)(o)
+	},
+	"client_version_range":       setConfigString(func(o *Options) *string { return &o.ClientVersionRange }),
+	"serve_client":               setConfigBool(func(o *Options) *bool { return &o.ServeClient }),
+	"strict_client_version":      setConfigBool(func(o *Options) *bool { return &o.StrictClientVersion }),
+	"max_connections":            setConfigInt(func(o *Options) *int { return &o.MaxConnections }),
+	"read_workers":               setConfigInt(func(o *Options) *int { return &o.ReadWorkers }),
+	"dead_letter_queue_size":     setConfigInt(func(o *Options) *int { return &o.DeadLetterQueueSize }),
+	"dedup_window_size":          setConfigInt(func(o *Options) *int { return &o.DedupWindowSize }),
+	"require_connect_ticket":     setConfigBool(func(o *Options) *bool { return &o.RequireConnectTicket }),
+	"socket_id_mode":             setConfigSocketIDMode,
+	"socket_id_prefix":           setConfigString(func(o *Options) *string { return &o.SocketIDPrefix }),
+	"connections_high_watermark": setConfigInt(func(o *Options) *int { return &o.ConnectionsHighWatermark }),
+	"connections_low_watermark":  setConfigInt(func(o *Options) *int { return &o.ConnectionsLowWatermark }),
+	"notify_capacity":            setConfigBool(func(o *Options) *bool { return &o.NotifyCapacity }),
+	"handshake_rate_limit":       setConfigInt(func(o *Options) *int { return &o.HandshakeRateLimit }),
+	"handshake_rate_interval":    setConfigDuration(func(o *Options) *time.Duration { return &o.HandshakeRateInterval }),
+	"handshake_ban_duration":     setConfigDuration(func(o *Options) *time.Duration { return &o.HandshakeBanDuration }),
+	"ping_interval":              setConfigDuration(func(o *Options) *time.Duration { return &o.PingInterval }),
+	"ping_timeout":               setConfigDuration(func(o *Options) *time.Duration { return &o.PingTimeout }),
+	"idle_timeout":               setConfigDuration(func(o *Options) *time.Duration { return &o.IdleTimeout }),
+	"max_session_duration":       setConfigDuration(func(o *Options) *time.Duration { return &o.MaxSessionDuration }),
+	"max_egress_bandwidth":       setConfigInt64(func(o *Options) *int64 { return &o.MaxEgressBandwidth }),
+	"socket_bandwidth_limit":     setConfigInt64(func(o *Options) *int64 { return &o.SocketBandwidthLimit }),
+	"ajax_poll_timeout":          setConfigDuration(func(o *Options) *time.Duration { return &o.AjaxPollTimeout }),
+	"ajax_poll_delay":            setConfigDuration(func(o *Options) *time.Duration { return &o.AjaxPollDelay }),
+	"ajax_push_retries":          setConfigInt(func(o *Options) *int { return &o.AjaxPushRetries }),
+	"ajax_max_body_size":         setConfigInt64(func(o *Options) *int64 { return &o.AjaxMaxBodySize }),
+	"ajax_read_timeout":          setConfigDuration(func(o *Options) *time.Duration { return &o.AjaxReadTimeout }),
+	"routing_key":                setConfigString(func(o *Options) *string { return &o.RoutingKey }),
+	"routing_name":               setConfigString(func(o *Options) *string { return &o.RoutingName }),
+	"api_token":                  setConfigString(func(o *Options) *string { return &o.APIToken }),
+	"webhook_url":                setConfigString(func(o *Options) *string { return &o.WebhookURL }),
+	"webhook_secret":             setConfigString(func(o *Options) *string { return &o.WebhookSecret }),
+	"log_level":                  setConfigString(func(o *Options) *string { return &o.LogLevel }),
+	"backend_log_level":          setConfigString(func(o *Options) *string { return &o.BackendLogLevel }),
+	"protocol_log_level":         setConfigString(func(o *Options) *string { return &o.ProtocolLogLevel }),
+	"keepalive_log_level":        setConfigString(func(o *Options) *string { return &o.KeepaliveLogLevel }),
+}
+
+// configKeys returns the sorted configuration keys.
+func configKeys() []string {
+	keys := make([]string, 0, len(configSetters))
+	for key := range configSetters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setConfigValue sets the option of the configuration key.
+func setConfigValue(o *Options, key, value string) error {
+	set, ok := configSetters[key]
+	if !ok {
+		return fmt.Errorf("unknown key: %s", key)
+	}
+
+	if err := set(o, value); err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+
+	return nil
+}
+
+// configValue converts the JSON value to the string value of the setters.
+// Lists are joined with commas.
+func configValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	case '[':
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return "", err
+		}
+		return strings.Join(list, ","), nil
+	case '{':
+		return "", fmt.Errorf("objects are not supported")
+	default:
+		// Numbers and booleans.
+		return string(raw), nil
+	}
+}
+
+func setConfigString(field func(o *Options) *string) configSetter {
+	return func(o *Options, v string) error {
+		*field(o) = v
+		return nil
+	}
+}
+
+func setConfigBool(field func(o *Options) *bool) configSetter {
+	return func(o *Options, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean: %q", v)
+		}
+		*field(o) = b
+		return nil
+	}
+}
+
+func setConfigInt(field func(o *Options) *int) configSetter {
+	return func(o *Options, v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer: %q", v)
+		}
+		*field(o) = i
+		return nil
+	}
+}
+
+func setConfigInt64(field func(o *Options) *int64) configSetter {
+	return func(o *Options, v string) error {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer: %q", v)
+		}
+		*field(o) = i
+		return nil
+	}
+}
+
+func setConfigDuration(field func(o *Options) *time.Duration) configSetter {
+	return func(o *Options, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration: %q", v)
+		}
+		*field(o) = d
+		return nil
+	}
+}
+
+func setConfigSocketIDMode(o *Options, v string) error {
+	switch v {
+	case "random":
+		o.SocketIDMode = SocketIDRandom
+	case "sortable":
+		o.SocketIDMode = SocketIDSortable
+	default:
+		return fmt.Errorf("invalid socket ID mode: %q", v)
+	}
+	return nil
+}
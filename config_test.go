@@ -0,0 +1,150 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes the configuration file and returns its path.
+func writeConfigFile(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "glue.json")
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		err   string // A part of the expected error. Empty if valid.
+		check func(o *Options) bool
+	}{
+		{"empty", `{}`, "", func(o *Options) bool { return o.HTTPSocketType == 0 }},
+		{"string", `{"listen_address": ":8080"}`, "", func(o *Options) bool { return o.HTTPListenAddress == ":8080" }},
+		{"socket type", `{"socket_type": "unix"}`, "", func(o *Options) bool { return o.HTTPSocketType == HTTPSocketTypeUnix }},
+		{"invalid socket type", `{"socket_type": "udp"}`, "socket_type: invalid socket type", nil},
+		{"bool", `{"serve_client": true}`, "", func(o *Options) bool { return o.ServeClient }},
+		{"invalid bool", `{"serve_client": "yes"}`, "serve_client: invalid boolean", nil},
+		{"int", `{"max_connections": 100}`, "", func(o *Options) bool { return o.MaxConnections == 100 }},
+		{"invalid int", `{"max_connections": 1.5}`, "max_connections: invalid integer", nil},
+		{"int64", `{"max_egress_bandwidth": 1048576}`, "", func(o *Options) bool { return o.MaxEgressBandwidth == 1048576 }},
+		{"duration", `{"ping_interval": "30s"}`, "", func(o *Options) bool { return o.PingInterval == 30*time.Second }},
+		{"invalid duration", `{"ping_interval": 30}`, "ping_interval: invalid duration", nil},
+		{"list", `{"cors_origins": ["https://a.com", "https://b.com"]}`, "", func(o *Options) bool { return o.EnableCORS && o.CheckOrigin != nil }},
+		{"empty list", `{"cors_origins": []}`, "cors_origins", nil},
+		{"socket id mode", `{"socket_id_mode": "sortable"}`, "", func(o *Options) bool { return o.SocketIDMode == SocketIDSortable }},
+		{"invalid socket id mode", `{"socket_id_mode": "short"}`, "invalid socket ID mode", nil},
+		{"object", `{"listen_address": {"port": 80}}`, "objects are not supported", nil},
+		{"unknown key", `{"listen_adress": ":8080"}`, "unknown key: listen_adress", nil},
+		{"invalid json", `{"listen_address": ":8080"`, "unexpected end of JSON input", nil},
+	}
+
+	for _, test := range tests {
+		var o Options
+		err := LoadConfigFile(writeConfigFile(t, test.data), &o)
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q: %v", test.name, test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !test.check(&o) {
+			t.Errorf("%s: unexpected options: %+v", test.name, o)
+		}
+	}
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	var o Options
+	if err := LoadConfigFile(filepath.Join(t.TempDir(), "missing.json"), &o); err == nil || !strings.HasPrefix(err.Error(), "glue: config: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		err   string // A part of the expected error. Empty if valid.
+		check func(o *Options) bool
+	}{
+		{"string", map[string]string{"TEST_LISTEN_ADDRESS": ":8080"}, "", func(o *Options) bool { return o.HTTPListenAddress == ":8080" }},
+		{"duration", map[string]string{"TEST_IDLE_TIMEOUT": "5m"}, "", func(o *Options) bool { return o.IdleTimeout == 5*time.Minute }},
+		{"list", map[string]string{"TEST_CORS_ORIGINS": "https://a.com, https://b.com"}, "", func(o *Options) bool { return o.EnableCORS }},
+		{"other prefix", map[string]string{"GLUE_LISTEN_ADDRESS": ":8080"}, "", func(o *Options) bool { return len(o.HTTPListenAddress) == 0 }},
+		{"invalid value", map[string]string{"TEST_READ_WORKERS": "many"}, "TEST_READ_WORKERS: invalid integer", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for k, v := range test.env {
+				t.Setenv(k, v)
+			}
+
+			var o Options
+			err := LoadConfigEnv("TEST_", &o)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q: %v", test.err, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if !test.check(&o) {
+				t.Fatalf("unexpected options: %+v", o)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfigFile(t, `{"listen_address": ":8080", "ping_interval": "30s"}`)
+
+	// The environment variables override the file values.
+	t.Setenv("GLUE_LISTEN_ADDRESS", ":9090")
+
+	o, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.HTTPListenAddress != ":9090" || o.PingInterval != 30*time.Second {
+		t.Fatalf("unexpected options: %+v", o)
+	}
+
+	// An empty path only loads the environment variables.
+	if o, err = LoadConfig(""); err != nil {
+		t.Fatal(err)
+	} else if o.HTTPListenAddress != ":9090" || o.PingInterval != 0 {
+		t.Fatalf("unexpected options: %+v", o)
+	}
+
+	// The file errors are returned.
+	if _, err = LoadConfig(writeConfigFile(t, `{"unknown": 1}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The ajax transport protocol version passed with the init request.
+	ajaxProtocolVersion = "2"
+
+	// The request timeout of the ajax requests. It is longer
+	// than the default poll timeout of the glue server.
+	ajaxRequestTimeout = 45 * time.Second
+)
+
+//############################//
+//### Ajax Connection type ###//
+//############################//
+
+type ajaxConn struct {
+	url    string
+	client *http.Client
+
+	token     string // The signed session token.
+	pollToken string
+
+	sendMutex sync.Mutex
+	seq       uint64
+
+	frames    chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// DialAjax opens an ajax connection to the glue server,
+// for example "http://localhost:8080/glue/ajax".
+func DialAjax(url string) (Conn, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &ajaxConn{
+		url:    url,
+		client: &http.Client{Timeout: ajaxRequestTimeout},
+		frames: make(chan string, 100),
+		closed: make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	// The init response contains the session token, the
+	// poll token and the client options delimited by '&'.
+	data, err := c.post("i" + ajaxProtocolVersion)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("ajax init: %v", err)
+	}
+
+	values := strings.SplitN(data, "&", 3)
+	if len(values) < 2 {
+		cancel()
+		return nil, fmt.Errorf("ajax init: invalid response: '%s'", data)
+	}
+	c.token, c.pollToken = values[0], values[1]
+
+	go c.pollLoop()
+
+	return c, nil
+}
+
+// Send pushes the frame with the next sequence number.
+func (c *ajaxConn) Send(frame string) error {
+	// Lock the mutex.
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	c.seq++
+	_, err := c.post("s" + c.token + "&" + strconv.FormatUint(c.seq, 10) + "&" +
+		strconv.Itoa(len(frame)) + "&" + frame)
+	return err
+}
+
+// Receive returns the next frame. Frames received before
+// the connection closed are returned first.
+func (c *ajaxConn) Receive(timeout time.Duration) (string, error) {
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-c.closed:
+		// Return the frames received in between.
+		select {
+		case frame := <-c.frames:
+			return frame, nil
+		default:
+			return "", ErrClosed
+		}
+	case <-timer.C:
+		return "", ErrTimeout
+	}
+}
+
+// Close stops the poll requests. The server closes
+// the socket after its poll timeout.
+func (c *ajaxConn) Close() error {
+	c.cancel()
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *ajaxConn) pollLoop() {
+	defer c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	for {
+		data, err := c.post("o" + c.token + "&" + c.pollToken)
+		if err != nil {
+			return
+		}
+
+		switch data {
+		case "t":
+			// The poll timeout was reached.
+			continue
+		case "c":
+			// The socket was closed by the server.
+			return
+		}
+
+		// Split the new poll token from the frame.
+		i := strings.Index(data, "&")
+		if i < 0 {
+			return
+		}
+		c.pollToken = data[:i]
+
+		select {
+		case c.frames <- data[i+1:]:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// post sends the ajax request and returns the response body.
+func (c *ajaxConn) post(body string) (string, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.url, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	} else if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,257 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package conformance provides a protocol conformance suite for glue socket
+// implementations. The cases are defined by the JSON fixtures in the fixtures
+// directory, so implementations in other languages can use them too.
+//
+// The server cases connect to the server under test, which has to echo the
+// messages of the main channel. The client cases wait for connections of the
+// client under test, which has to echo the messages of the main channel and
+// reconnect automatically after each case.
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// DefaultTimeout is the timeout of a step if the case defines none.
+	DefaultTimeout = 5 * time.Second
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// ErrClosed is returned by the Receive method of a closed connection.
+	ErrClosed = errors.New("connection closed")
+
+	// ErrTimeout is returned by the Receive method if no frame was received in time.
+	ErrTimeout = errors.New("receive timeout")
+)
+
+//#############//
+//### Types ###//
+//#############//
+
+// A Conn is a frame based connection to the implementation under test.
+type Conn interface {
+	// Send sends a single protocol frame.
+	Send(frame string) error
+
+	// Receive returns the next protocol frame. ErrClosed is returned if the
+	// connection is closed and ErrTimeout if no frame is received in time.
+	Receive(timeout time.Duration) (string, error)
+
+	// Close closes the connection.
+	Close() error
+}
+
+// A Case is a sequence of steps performed on a new connection.
+type Case struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Ignore holds regular expressions of received frames which are skipped,
+	// for example the clock synchronization of clients.
+	Ignore []string `json:"ignore,omitempty"`
+
+	// TimeoutMS is the timeout of each step in milliseconds.
+	TimeoutMS int `json:"timeoutMS,omitempty"`
+
+	Steps []Step `json:"steps"`
+}
+
+// A Step either sends a frame, expects a frame or expects the connection to close.
+type Step struct {
+	// Send is the frame to send.
+	Send string `json:"send,omitempty"`
+
+	// Expect is a regular expression matching the next received frame.
+	Expect string `json:"expect,omitempty"`
+
+	// ExpectClosed expects the connection to be closed without further frames.
+	ExpectClosed bool `json:"expectClosed,omitempty"`
+}
+
+//##############//
+//### Public ###//
+//##############//
+
+// LoadCases loads the cases of the JSON fixture file.
+func LoadCases(path string) ([]Case, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []Case
+	if err = json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("conformance: parse fixtures '%s': %v", path, err)
+	}
+
+	return cases, nil
+}
+
+// ServerCases loads the server cases of the fixtures directory.
+func ServerCases() ([]Case, error) {
+	return LoadCases(filepath.Join(fixturesDir(), "server.json"))
+}
+
+// ClientCases loads the client cases of the fixtures directory.
+func ClientCases() ([]Case, error) {
+	return LoadCases(filepath.Join(fixturesDir(), "client.json"))
+}
+
+// RunServer runs the cases against a server implementation.
+// The dial function opens a new connection to the server for each case.
+func RunServer(t *testing.T, cases []Case, dial func() (Conn, error)) {
+	run(t, cases, "dial", dial)
+}
+
+// RunClient runs the cases against a client implementation.
+// The accept function returns the next connection of the client
+// for each case. The connection is closed after the case.
+func RunClient(t *testing.T, cases []Case, accept func() (Conn, error)) {
+	run(t, cases, "accept", accept)
+}
+
+// Run performs the steps of the case on the connection.
+// The first failed step is returned as error.
+func (c *Case) Run(conn Conn) error {
+	timeout := DefaultTimeout
+	if c.TimeoutMS > 0 {
+		timeout = time.Duration(c.TimeoutMS) * time.Millisecond
+	}
+
+	ignore := make([]*regexp.Regexp, len(c.Ignore))
+	for i, expr := range c.Ignore {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid ignore expression '%s': %v", expr, err)
+		}
+		ignore[i] = re
+	}
+
+	for i, step := range c.Steps {
+		if err := step.run(conn, ignore, timeout); err != nil {
+			return fmt.Errorf("step %d: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// run runs each case as subtest on a new connection.
+func run(t *testing.T, cases []Case, connectName string, connect func() (Conn, error)) {
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			conn, err := connect()
+			if err != nil {
+				t.Fatalf("%s: %v", connectName, err)
+			}
+			defer conn.Close()
+
+			if err = c.Run(conn); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// fixturesDir returns the fixtures directory next to the package source.
+func fixturesDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "fixtures")
+}
+
+func (s *Step) run(conn Conn, ignore []*regexp.Regexp, timeout time.Duration) error {
+	if len(s.Send) > 0 {
+		if err := conn.Send(s.Send); err != nil {
+			return fmt.Errorf("send '%s': %v", s.Send, err)
+		}
+		return nil
+	}
+
+	if len(s.Expect) > 0 {
+		re, err := regexp.Compile(s.Expect)
+		if err != nil {
+			return fmt.Errorf("invalid expect expression '%s': %v", s.Expect, err)
+		}
+
+		frame, err := receive(conn, ignore, timeout)
+		if err != nil {
+			return fmt.Errorf("expected frame matching '%s': %v", s.Expect, err)
+		} else if !re.MatchString(frame) {
+			return fmt.Errorf("expected frame matching '%s': received '%s'", s.Expect, frame)
+		}
+		return nil
+	}
+
+	if s.ExpectClosed {
+		frame, err := receive(conn, ignore, timeout)
+		if err == nil {
+			return fmt.Errorf("expected closed connection: received '%s'", frame)
+		} else if err != ErrClosed {
+			return fmt.Errorf("expected closed connection: %v", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("empty step")
+}
+
+// receive returns the next frame which is not ignored.
+func receive(conn Conn, ignore []*regexp.Regexp, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+
+Loop:
+	for {
+		frame, err := conn.Receive(deadline.Sub(time.Now()))
+		if err != nil {
+			return "", err
+		}
+
+		for _, re := range ignore {
+			if re.MatchString(frame) {
+				continue Loop
+			}
+		}
+
+		return frame, nil
+	}
+}
@@ -0,0 +1,168 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package conformance_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue"
+	"github.com/desertbit/glue/conformance"
+)
+
+// newEchoServer starts a glue server echoing the main channel.
+func newEchoServer(t *testing.T) *httptest.Server {
+	server := glue.NewServer(glue.Options{
+		HTTPSocketType: glue.HTTPSocketTypeNone,
+		EnableSockJS:   true,
+		EnableEngineIO: true,
+		EnableSocketIO: true,
+	})
+	t.Cleanup(server.Release)
+
+	server.OnNewSocket(func(s *glue.Socket) {
+		s.OnRead(func(data string) {
+			s.Write(data)
+		})
+	})
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestServerWebSocket(t *testing.T) {
+	cases, err := conformance.ServerCases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/glue/ws"
+
+	conformance.RunServer(t, cases, func() (conformance.Conn, error) {
+		return conformance.DialWebSocket(url)
+	})
+}
+
+func TestServerAjax(t *testing.T) {
+	cases, err := conformance.ServerCases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newEchoServer(t)
+	url := ts.URL + "/glue/ajax"
+
+	conformance.RunServer(t, cases, func() (conformance.Conn, error) {
+		return conformance.DialAjax(url)
+	})
+}
+
+func TestServerEngineIO(t *testing.T) {
+	cases, err := conformance.ServerCases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/glue/engine.io/"
+
+	conformance.RunServer(t, cases, func() (conformance.Conn, error) {
+		return conformance.DialEngineIO(url)
+	})
+}
+
+func TestServerSockJS(t *testing.T) {
+	cases, err := conformance.ServerCases()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/glue/sockjs"
+
+	conformance.RunServer(t, cases, func() (conformance.Conn, error) {
+		return conformance.DialSockJS(url)
+	})
+}
+
+func TestServerSocketIO(t *testing.T) {
+	ts := newEchoServer(t)
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/glue/socket.io/"
+
+	// The socket.io packets are carried like the glue frames
+	// of the engine.io endpoint.
+	conn, err := conformance.DialEngineIO(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	steps := []struct {
+		send   string
+		expect string
+	}{
+		// Unknown namespaces are rejected.
+		{"0/unknown,", `4/unknown,{"message":`},
+	}
+
+	for _, step := range steps {
+		if err = conn.Send(step.send); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := conn.Receive(time.Second)
+		if err != nil {
+			t.Fatalf("%q: %v", step.send, err)
+		} else if !strings.HasPrefix(frame, step.expect) {
+			t.Fatalf("%q: unexpected packet: %q", step.send, frame)
+		}
+	}
+
+	conn, err = conformance.DialEngineIO(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	steps = []struct {
+		send   string
+		expect string
+	}{
+		{"0", `0{"sid":"`},
+		// The main channel is echoed as event and replies acknowledgements.
+		{`2["m","hello"]`, `2["m","hello"]`},
+		{`27["m",{"a":1}]`, `37["{\"a\":1}"]`},
+	}
+
+	for _, step := range steps {
+		if err = conn.Send(step.send); err != nil {
+			t.Fatal(err)
+		}
+		frame, err := conn.Receive(time.Second)
+		if err != nil {
+			t.Fatalf("%q: %v", step.send, err)
+		} else if !strings.HasPrefix(frame, step.expect) {
+			t.Fatalf("%q: unexpected packet: %q", step.send, frame)
+		}
+	}
+}
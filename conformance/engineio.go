@@ -0,0 +1,56 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package conformance
+
+import (
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+//#################################//
+//### engine.io Connection type ###//
+//#################################//
+
+// DialEngineIO opens an engine.io websocket connection to the glue server,
+// for example "ws://localhost:8080/glue/engine.io/". The glue frames are
+// passed with engine.io message packets and ping packets are answered.
+func DialEngineIO(url string) (Conn, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?EIO=4&transport=websocket", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var c *wsConn
+	c = newWSConnWith(ws, func(frame string) string {
+		return "4" + frame
+	}, func(data string) []string {
+		switch {
+		case strings.HasPrefix(data, "4"):
+			return []string{data[1:]}
+		case data == "2":
+			c.sendRaw("3")
+		}
+		return nil
+	})
+
+	go c.readLoop()
+
+	return c, nil
+}
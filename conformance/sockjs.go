@@ -0,0 +1,59 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package conformance
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/desertbit/glue/utils"
+	"github.com/gorilla/websocket"
+)
+
+//##############################//
+//### SockJS Connection type ###//
+//##############################//
+
+// DialSockJS opens a SockJS websocket session to the glue server,
+// for example "ws://localhost:8080/glue/sockjs". The glue frames
+// are passed with SockJS message frames.
+func DialSockJS(url string) (Conn, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(url+"/000/"+utils.RandomString(16)+"/websocket", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newWSConnWith(ws, func(frame string) string {
+		data, _ := json.Marshal([]string{frame})
+		return string(data)
+	}, func(data string) []string {
+		// Skip the open, heartbeat and close frames.
+		if !strings.HasPrefix(data, "a") {
+			return nil
+		}
+
+		var frames []string
+		json.Unmarshal([]byte(data[1:]), &frames)
+		return frames
+	})
+
+	go c.readLoop()
+
+	return c, nil
+}
@@ -0,0 +1,201 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package conformance
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//#################################//
+//### WebSocket Connection type ###//
+//#################################//
+
+type wsConn struct {
+	ws         *websocket.Conn
+	writeMutex sync.Mutex
+
+	frames    chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// Wrap the glue frames for bridged protocols.
+	encode func(frame string) string
+	decode func(data string) []string
+}
+
+func newWSConn(ws *websocket.Conn) *wsConn {
+	c := newWSConnWith(ws, nil, nil)
+	go c.readLoop()
+	return c
+}
+
+// newWSConnWith creates a connection which wraps the frames with the
+// encode and decode functions. Start the read loop after setting up.
+func newWSConnWith(ws *websocket.Conn, encode func(string) string, decode func(string) []string) *wsConn {
+	c := &wsConn{
+		ws:     ws,
+		frames: make(chan string, 100),
+		closed: make(chan struct{}),
+		encode: encode,
+		decode: decode,
+	}
+
+	if c.encode == nil {
+		c.encode = func(frame string) string { return frame }
+	}
+	if c.decode == nil {
+		c.decode = func(data string) []string { return []string{data} }
+	}
+
+	return c
+}
+
+// DialWebSocket opens a websocket connection to the glue server,
+// for example "ws://localhost:8080/glue/ws".
+func DialWebSocket(url string) (Conn, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWSConn(ws), nil
+}
+
+func (c *wsConn) Send(frame string) error {
+	// Lock the mutex.
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(c.encode(frame)))
+}
+
+// sendRaw sends the data without encoding.
+func (c *wsConn) sendRaw(data string) error {
+	// Lock the mutex.
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(data))
+}
+
+// Receive returns the next frame. Frames received before
+// the connection closed are returned first.
+func (c *wsConn) Receive(timeout time.Duration) (string, error) {
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	default:
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case frame := <-c.frames:
+		return frame, nil
+	case <-c.closed:
+		// Return the frames received in between.
+		select {
+		case frame := <-c.frames:
+			return frame, nil
+		default:
+			return "", ErrClosed
+		}
+	case <-timer.C:
+		return "", ErrTimeout
+	}
+}
+
+func (c *wsConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return c.ws.Close()
+}
+
+func (c *wsConn) readLoop() {
+	defer c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		for _, frame := range c.decode(string(data)) {
+			select {
+			case c.frames <- frame:
+			case <-c.closed:
+				return
+			}
+		}
+	}
+}
+
+//###############################//
+//### WebSocket Listener type ###//
+//###############################//
+
+// A WebSocketListener accepts the websocket connections of a client under
+// test. Serve it at the glue websocket URL, for example "/glue/ws".
+type WebSocketListener struct {
+	upgrader websocket.Upgrader
+	conns    chan Conn
+}
+
+// NewWebSocketListener creates a new websocket listener.
+func NewWebSocketListener() *WebSocketListener {
+	return &WebSocketListener{
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		conns: make(chan Conn, 10),
+	}
+}
+
+// ServeHTTP implements the HTTP Handler interface of the http package.
+func (l *WebSocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	l.conns <- newWSConn(ws)
+}
+
+// Accept returns the next connection of the client. An error is
+// returned if the client doesn't connect within the timeout.
+func (l *WebSocketListener) Accept(timeout time.Duration) (Conn, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("no client connection within %v", timeout)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The maximum size of an introspection response.
+	maxIntrospectionResponseSize = 1 << 20
+)
+
+//#########################//
+//### Introspector Type ###//
+//#########################//
+
+// An Introspector validates tokens with an OAuth2 token
+// introspection endpoint of the authorization server (RFC 7662).
+type Introspector struct {
+	// URL is the introspection endpoint URL.
+	URL string
+
+	// The client credentials of the resource server
+	// used to authenticate at the introspection endpoint.
+	ClientID     string
+	ClientSecret string
+
+	// Client is the HTTP client. Default: http.DefaultClient
+	Client *http.Client
+}
+
+// Validate posts the token to the introspection endpoint.
+// It implements the Validator interface.
+func (i *Introspector) Validate(ctx context.Context, token string) (*Token, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(i.ClientID) > 0 {
+		req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	}
+
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection request: unexpected status: %s", resp.Status)
+	}
+
+	var claims map[string]interface{}
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionResponseSize))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("introspection response: %v", err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrInvalidToken
+	}
+
+	return newToken(claims)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// newToken creates a token from the JWT claims or introspection values.
+func newToken(claims map[string]interface{}) (*Token, error) {
+	t := &Token{
+		Claims: claims,
+	}
+
+	t.Subject, _ = claims["sub"].(string)
+	t.ClientID, _ = claims["client_id"].(string)
+
+	// The scopes are a space-separated string. Some
+	// providers pass a list with the scp claim instead.
+	if scope, ok := claims["scope"].(string); ok {
+		t.Scopes = strings.Fields(scope)
+	} else if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, v := range scp {
+			if s, ok := v.(string); ok {
+				t.Scopes = append(t.Scopes, s)
+			}
+		}
+	}
+
+	if exp, ok := claims["exp"]; ok {
+		sec, err := numericDate(exp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exp claim: %v", err)
+		}
+		t.Expiry = sec
+	}
+
+	if !t.Expiry.IsZero() && !time.Now().Before(t.Expiry) {
+		return nil, ErrExpiredToken
+	}
+
+	return t, nil
+}
+
+// numericDate converts a JSON numeric date to the time.
+func numericDate(v interface{}) (time.Time, error) {
+	var sec float64
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec = f
+	case float64:
+		sec = n
+	default:
+		return time.Time{}, fmt.Errorf("not a number: %v", v)
+	}
+
+	return time.Unix(0, int64(sec*float64(time.Second))), nil
+}
@@ -0,0 +1,413 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package oauth2
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // Register the SHA-256 hash.
+	_ "crypto/sha512" // Register the SHA-384 and SHA-512 hashes.
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The maximum size of a JWKS response.
+	maxJWKSResponseSize = 1 << 20
+
+	// The minimum interval between key set requests triggered by unknown key IDs.
+	defaultJWKSRefreshInterval = time.Minute
+)
+
+//#################//
+//### JWKS Type ###//
+//#################//
+
+// A JWKS validates JWT access tokens locally with the public keys of
+// the JSON Web Key Set endpoint of the authorization server. The keys
+// are fetched on demand and refetched if a token is signed with an
+// unknown key. The RS, PS and ES signature algorithms are supported.
+// The issuer and the audience are required and the tokens must expire.
+type JWKS struct {
+	// URL is the JWKS endpoint URL.
+	URL string
+
+	// Issuer is the required iss claim. Required.
+	Issuer string
+
+	// Audience is the required aud claim value. Required, so tokens
+	// issued for other clients of the authorization server are rejected.
+	Audience string
+
+	// Leeway is the allowed clock skew for the nbf claim.
+	Leeway time.Duration
+
+	// RefreshInterval is the minimum interval between requests of the
+	// key set triggered by unknown key IDs. Default: 1 minute
+	RefreshInterval time.Duration
+
+	// Client is the HTTP client. Default: http.DefaultClient
+	Client *http.Client
+
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	mutex   sync.Mutex
+}
+
+// Validate verifies the signature and the claims of the JWT.
+// It implements the Validator interface.
+func (j *JWKS) Validate(ctx context.Context, token string) (*Token, error) {
+	if err := j.checkConfig(); err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %v", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT signature encoding: %v", err)
+	}
+
+	key, err := j.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid JWT claims: %v", err)
+	}
+
+	if err = j.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return newToken(claims)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// checkConfig returns an error if the issuer or the audience is not set.
+func (j *JWKS) checkConfig() error {
+	if len(j.Issuer) == 0 {
+		return fmt.Errorf("oauth2: the JWKS issuer is required")
+	} else if len(j.Audience) == 0 {
+		return fmt.Errorf("oauth2: the JWKS audience is required")
+	}
+
+	return nil
+}
+
+// checkClaims checks the issuer, the audience and the not before claims
+// and requires the exp claim. The expiry is checked by newToken.
+func (j *JWKS) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != j.Issuer {
+		return fmt.Errorf("invalid issuer: %q", iss)
+	}
+
+	if !hasAudience(claims["aud"], j.Audience) {
+		return fmt.Errorf("invalid audience: %v", claims["aud"])
+	}
+
+	// Tokens without expiry would be valid forever.
+	if _, ok := claims["exp"]; !ok {
+		return fmt.Errorf("missing exp claim")
+	}
+
+	if nbf, ok := claims["nbf"]; ok {
+		t, err := numericDate(nbf)
+		if err != nil {
+			return fmt.Errorf("invalid nbf claim: %v", err)
+		}
+		if time.Now().Add(j.Leeway).Before(t) {
+			return fmt.Errorf("token not valid yet")
+		}
+	}
+
+	return nil
+}
+
+// hasAudience returns true if the aud claim is or contains the audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the public key with the ID. The key set is
+// fetched if the key is unknown and the refresh interval elapsed.
+// Tokens without key ID require a key set with a single key.
+func (j *JWKS) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	// Lock the mutex.
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	interval := j.RefreshInterval
+	if interval <= 0 {
+		interval = defaultJWKSRefreshInterval
+	}
+
+	key, ok := j.lookup(kid)
+	if !ok && time.Since(j.fetched) >= interval {
+		keys, err := j.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		j.keys = keys
+		j.fetched = time.Now()
+
+		key, ok = j.lookup(kid)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown JWT key ID: %q", kid)
+	}
+
+	return key, nil
+}
+
+// lookup returns the key with the ID. The mutex must be locked.
+func (j *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	if len(kid) == 0 && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// fetch requests the key set. Keys of unsupported
+// types and keys not used for signatures are skipped.
+func (j *JWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS request: unexpected status: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxJWKSResponseSize)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("JWKS response: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeBigInt(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("JWKS key %q: %v", k.Kid, err)
+			}
+			e, err := decodeBigInt(k.E)
+			if err != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("JWKS key %q: invalid exponent", k.Kid)
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+
+			x, err := decodeBigInt(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("JWKS key %q: %v", k.Kid, err)
+			}
+			y, err := decodeBigInt(k.Y)
+			if err != nil {
+				return nil, fmt.Errorf("JWKS key %q: %v", k.Kid, err)
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+
+	return keys, nil
+}
+
+// verifySignature verifies the JWT signature of the signed
+// header and payload with the key and the algorithm.
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported JWT algorithm: %q", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported JWT algorithm: %q", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"):
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWT algorithm %q does not match the key type", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return ErrInvalidToken
+		}
+
+	case strings.HasPrefix(alg, "PS"):
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWT algorithm %q does not match the key type", alg)
+		}
+		if err := rsa.VerifyPSS(k, hash, digest, sig, nil); err != nil {
+			return ErrInvalidToken
+		}
+
+	case strings.HasPrefix(alg, "ES"):
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("JWT algorithm %q does not match the key type", alg)
+		}
+
+		// The signature is the concatenation of the r and s values.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidToken
+		}
+
+	default:
+		return fmt.Errorf("unsupported JWT algorithm: %q", alg)
+	}
+
+	return nil
+}
+
+// decodeSegment decodes the base64url encoded JSON segment of a JWT.
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// decodeBigInt decodes the base64url encoded big-endian integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty integer")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
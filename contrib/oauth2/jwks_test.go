@@ -0,0 +1,173 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testKid = "test-key"
+
+// newTestJWKS serves the public key with a JWKS endpoint and
+// returns a validator for the test issuer and audience.
+func newTestJWKS(t *testing.T) (*JWKS, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": testKid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(ts.Close)
+
+	return &JWKS{
+		URL:      ts.URL,
+		Issuer:   "https://auth.example.com/",
+		Audience: "chat",
+	}, key
+}
+
+// signToken signs the claims with RS256.
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": testKid})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://auth.example.com/",
+		"aud":   "chat",
+		"sub":   "alice",
+		"scope": "chat read",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestJWKSValidate(t *testing.T) {
+	j, key := newTestJWKS(t)
+
+	token, err := j.Validate(context.Background(), signToken(t, key, validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Subject != "alice" || len(token.Scopes) != 2 || token.Expiry.IsZero() {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	// A list audience must contain the audience.
+	claims := validClaims()
+	claims["aud"] = []string{"other", "chat"}
+	if _, err = j.Validate(context.Background(), signToken(t, key, claims)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSRejectsClaims(t *testing.T) {
+	j, key := newTestJWKS(t)
+
+	tests := map[string]func(c map[string]interface{}){
+		"missing exp":  func(c map[string]interface{}) { delete(c, "exp") },
+		"expired":      func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"missing aud":  func(c map[string]interface{}) { delete(c, "aud") },
+		"wrong aud":    func(c map[string]interface{}) { c["aud"] = "other" },
+		"missing iss":  func(c map[string]interface{}) { delete(c, "iss") },
+		"wrong iss":    func(c map[string]interface{}) { c["iss"] = "https://evil.example.com/" },
+		"not yet used": func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+	}
+
+	for name, modify := range tests {
+		claims := validClaims()
+		modify(claims)
+
+		if _, err := j.Validate(context.Background(), signToken(t, key, claims)); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestJWKSRejectsSignature(t *testing.T) {
+	j, _ := newTestJWKS(t)
+
+	// Sign with another key using the same key ID.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = j.Validate(context.Background(), signToken(t, other, validClaims())); err == nil {
+		t.Fatal("token with an invalid signature accepted")
+	}
+}
+
+func TestJWKSRequiresConfig(t *testing.T) {
+	j, key := newTestJWKS(t)
+	token := signToken(t, key, validClaims())
+
+	audience := j.Audience
+	j.Audience = ""
+	if _, err := j.Validate(context.Background(), token); err == nil {
+		t.Fatal("token accepted without an audience")
+	}
+	if _, err := New(Options{Validator: j}); err == nil {
+		t.Fatal("New accepted a JWKS validator without an audience")
+	}
+
+	j.Audience = audience
+	j.Issuer = ""
+	if _, err := New(Options{Validator: j}); err == nil {
+		t.Fatal("New accepted a JWKS validator without an issuer")
+	}
+
+	j.Issuer = "https://auth.example.com/"
+	if _, err := New(Options{Validator: j}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,398 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package oauth2 authenticates glue sockets with OAuth2 bearer tokens.
+// The tokens are validated during the socket initialization with an
+// introspection endpoint (RFC 7662) or locally with the keys of a JWKS
+// endpoint. The subject and the scopes are attached to the socket metadata.
+// Sockets are closed as soon as their token expires, unless the client
+// sends a new token over the reserved refresh channel.
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue"
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// RejectCodeInvalidToken is the rejection code of invalid tokens.
+	RejectCodeInvalidToken = "invalid_token"
+
+	// RejectCodeInsufficientScope is the rejection code
+	// of tokens without the required scopes.
+	RejectCodeInsufficientScope = "insufficient_scope"
+
+	// The socket metadata keys.
+	MetaToken   = "oauth2.token"
+	MetaSubject = "oauth2.subject"
+	MetaScopes  = "oauth2.scopes"
+
+	// DefaultRefreshChannel is the name of the reserved refresh channel.
+	DefaultRefreshChannel = "_token"
+
+	// The messages of the refresh channel sent by the server.
+	RefreshRequest  = "refresh"
+	RefreshAccepted = "ok"
+	RefreshRejected = "rejected"
+
+	defaultExpiryWarning   = time.Minute
+	defaultValidateTimeout = 10 * time.Second
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// ErrInvalidToken is returned by the validators if the token is invalid.
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrExpiredToken is returned by the validators if the token expired.
+	ErrExpiredToken = errors.New("token expired")
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A Token holds the validated values of a bearer token.
+type Token struct {
+	Subject  string
+	ClientID string
+	Scopes   []string
+
+	// Expiry is the expiration time of the token.
+	// The zero time never expires.
+	Expiry time.Time
+
+	// Claims holds all claims of a JWT or all
+	// values of the introspection response.
+	Claims map[string]interface{}
+}
+
+// HasScope returns true if the token grants the scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// A Validator validates bearer tokens.
+type Validator interface {
+	// Validate returns the token values or an error if the token is invalid.
+	Validate(ctx context.Context, token string) (*Token, error)
+}
+
+// Options defines the authenticator options.
+type Options struct {
+	// Validator validates the bearer tokens. Required.
+	// Use an Introspector or a JWKS validator.
+	Validator Validator
+
+	// RequiredScopes are the scopes every token must grant.
+	RequiredScopes []string
+
+	// SetUserID sets the token subject as user ID of the socket.
+	SetUserID bool
+
+	// RefreshChannel is the name of the channel the client sends new tokens
+	// to. The server sends "refresh" to this channel ExpiryWarning before the
+	// token expires. Refreshed tokens must have the same subject. The server
+	// responds with "ok" or with "rejected" to invalid tokens.
+	// Default: "_token"
+	RefreshChannel string
+
+	// ExpiryWarning is the duration before the token expires
+	// the client is asked to refresh the token.
+	// Default: 1 minute
+	ExpiryWarning time.Duration
+
+	// ValidateTimeout is the maximum duration of a token validation.
+	// Default: 10 seconds
+	ValidateTimeout time.Duration
+}
+
+//##########################//
+//### Authenticator Type ###//
+//##########################//
+
+// An Authenticator authenticates sockets with bearer tokens.
+type Authenticator struct {
+	options Options
+}
+
+// New creates a new authenticator.
+func New(o Options) (*Authenticator, error) {
+	if o.Validator == nil {
+		return nil, fmt.Errorf("oauth2: the token validator is required")
+	}
+	if j, ok := o.Validator.(*JWKS); ok {
+		if err := j.checkConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.RefreshChannel) == 0 {
+		o.RefreshChannel = DefaultRefreshChannel
+	}
+	if o.ExpiryWarning <= 0 {
+		o.ExpiryWarning = defaultExpiryWarning
+	}
+	if o.ValidateTimeout <= 0 {
+		o.ValidateTimeout = defaultValidateTimeout
+	}
+
+	return &Authenticator{
+		options: o,
+	}, nil
+}
+
+// Authenticate validates the bearer token passed by the client auth option.
+// It implements the glue.AuthFunc type. Set it as authentication hook
+// of a namespace:
+//
+//	server.Namespace("").OnAuth(a.Authenticate)
+//
+// An optional "Bearer " prefix is removed from the auth value.
+func (a *Authenticator) Authenticate(s *glue.Socket, auth string) error {
+	t, err := a.validate(s, auth)
+	if err != nil {
+		return err
+	}
+
+	if a.options.SetUserID {
+		if err = s.SetUserID(t.Subject); err != nil {
+			return err
+		}
+	}
+
+	sess := &session{
+		a:      a,
+		s:      s,
+		closed: make(chan struct{}),
+	}
+	sess.setToken(t)
+
+	// Handle the refreshed tokens and close the socket on expiry.
+	s.Channel(a.options.RefreshChannel).OnRead(sess.refresh)
+	s.OnClose(sess.close)
+	go sess.expiryLoop()
+
+	return nil
+}
+
+// TokenOf returns the token attached to the socket or nil.
+func TokenOf(s *glue.Socket) *Token {
+	t, _ := s.Meta(MetaToken).(*Token)
+	return t
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// validate validates the token and checks the required scopes.
+func (a *Authenticator) validate(s *glue.Socket, auth string) (*Token, error) {
+	raw := strings.TrimSpace(auth)
+	if len(raw) > 7 && strings.EqualFold(raw[:7], "bearer ") {
+		raw = strings.TrimSpace(raw[7:])
+	}
+	if len(raw) == 0 {
+		return nil, &glue.RejectError{
+			Code:    RejectCodeInvalidToken,
+			Message: "missing bearer token",
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.options.ValidateTimeout)
+	defer cancel()
+
+	t, err := a.options.Validator.Validate(ctx, raw)
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"remoteAddress": s.RemoteAddr(),
+			"userAgent":     s.UserAgent(),
+		}).Warningf("oauth2: token validation failed: %v", err)
+
+		return nil, &glue.RejectError{
+			Code:    RejectCodeInvalidToken,
+			Message: "invalid or expired bearer token",
+		}
+	}
+
+	if !t.Expiry.IsZero() && !time.Now().Before(t.Expiry) {
+		return nil, &glue.RejectError{
+			Code:    RejectCodeInvalidToken,
+			Message: "expired bearer token",
+		}
+	}
+
+	for _, scope := range a.options.RequiredScopes {
+		if !t.HasScope(scope) {
+			return nil, &glue.RejectError{
+				Code:    RejectCodeInsufficientScope,
+				Message: fmt.Sprintf("the bearer token does not grant the scope '%s'", scope),
+			}
+		}
+	}
+
+	return t, nil
+}
+
+//####################//
+//### Session Type ###//
+//####################//
+
+// A session tracks the token of an authenticated socket.
+type session struct {
+	a *Authenticator
+	s *glue.Socket
+
+	token   *Token
+	changed chan struct{} // Closed as soon as the token changes.
+	mutex   sync.Mutex
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// setToken attaches the token to the socket metadata
+// and restarts the expiry loop.
+func (sess *session) setToken(t *Token) {
+	// Lock the mutex.
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+
+	sess.token = t
+	if sess.changed != nil {
+		close(sess.changed)
+	}
+	sess.changed = make(chan struct{})
+
+	sess.s.SetMeta(MetaToken, t)
+	sess.s.SetMeta(MetaSubject, t.Subject)
+	sess.s.SetMeta(MetaScopes, t.Scopes)
+}
+
+func (sess *session) current() (*Token, chan struct{}) {
+	// Lock the mutex.
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+
+	return sess.token, sess.changed
+}
+
+func (sess *session) close() {
+	sess.closeOnce.Do(func() {
+		close(sess.closed)
+	})
+}
+
+// expiryLoop asks the client to refresh the token before it expires
+// and closes the socket as soon as the token expired.
+func (sess *session) expiryLoop() {
+	for {
+		t, changed := sess.current()
+		if t.Expiry.IsZero() {
+			select {
+			case <-sess.closed:
+				return
+			case <-changed:
+				continue
+			}
+		}
+
+		warning := time.NewTimer(time.Until(t.Expiry.Add(-sess.a.options.ExpiryWarning)))
+		expired := time.NewTimer(time.Until(t.Expiry))
+
+		select {
+		case <-sess.closed:
+		case <-changed:
+		case <-warning.C:
+			sess.s.Channel(sess.a.options.RefreshChannel).Write(RefreshRequest)
+
+			select {
+			case <-sess.closed:
+			case <-changed:
+			case <-expired.C:
+				sess.expired()
+			}
+		case <-expired.C:
+			sess.expired()
+		}
+
+		warning.Stop()
+		expired.Stop()
+
+		select {
+		case <-sess.closed:
+			return
+		default:
+		}
+	}
+}
+
+func (sess *session) expired() {
+	log.L.WithFields(logrus.Fields{
+		"remoteAddress": sess.s.RemoteAddr(),
+		"userAgent":     sess.s.UserAgent(),
+	}).Debugf("oauth2: bearer token expired: closing socket")
+
+	sess.s.Close()
+	sess.close()
+}
+
+// refresh validates the new token sent by the client.
+// The subject of the new token must match.
+func (sess *session) refresh(raw string) {
+	c := sess.s.Channel(sess.a.options.RefreshChannel)
+
+	t, err := sess.a.validate(sess.s, raw)
+	if err == nil {
+		if old, _ := sess.current(); old.Subject != t.Subject {
+			err = fmt.Errorf("the subject of the refreshed token changed")
+		}
+	}
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"remoteAddress": sess.s.RemoteAddr(),
+			"userAgent":     sess.s.UserAgent(),
+		}).Warningf("oauth2: token refresh rejected: %v", err)
+
+		c.Write(RefreshRejected)
+		return
+	}
+
+	sess.setToken(t)
+	c.Write(RefreshAccepted)
+}
@@ -0,0 +1,143 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The event claim member of back-channel logout tokens.
+	backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// The maximum size of a back-channel logout request body.
+	maxLogoutRequestSize = 1 << 16
+)
+
+//###########################//
+//### Back-Channel Logout ###//
+//###########################//
+
+// BackchannelLogout returns the HTTP handler of the OpenID Connect
+// back-channel logout endpoint. Register its URL as backchannel_logout_uri
+// of the client at the OpenID provider. The provider posts a signed logout
+// token, which is verified with the LogoutTokenValidator option. All sockets
+// of the session with the sid claim are logged out. Tokens without a sid
+// claim log out all sockets of the subject. The OnLogout function is called
+// afterwards, so the application removes its web sessions as well.
+func (b *Bridge) BackchannelLogout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response must not be cached.
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if b.options.LogoutTokenValidator == nil {
+			log.L.Warning("oidc: back-channel logout request received, but no logout token validator is set")
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxLogoutRequestSize)
+
+		sid, subject, err := b.verifyLogoutToken(r.Context(), r.PostFormValue("logout_token"))
+		if err != nil {
+			log.L.WithFields(logrus.Fields{
+				"remoteAddress": r.RemoteAddr,
+			}).Warningf("oidc: invalid back-channel logout request: %v", err)
+
+			writeLogoutError(w, err)
+			return
+		}
+
+		// Log out the single session if possible.
+		if len(sid) > 0 {
+			b.LogoutSID(sid)
+		} else {
+			b.LogoutSubject(subject)
+		}
+
+		if b.options.OnLogout != nil {
+			b.options.OnLogout(sid, subject)
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// verifyLogoutToken validates the logout token as defined by the OpenID Connect
+// Back-Channel Logout specification and returns its sid and sub claims.
+func (b *Bridge) verifyLogoutToken(ctx context.Context, raw string) (sid, subject string, err error) {
+	if len(raw) == 0 {
+		return "", "", fmt.Errorf("missing logout token")
+	}
+
+	t, err := b.options.LogoutTokenValidator.Validate(ctx, raw)
+	if err != nil {
+		return "", "", err
+	}
+
+	events, _ := t.Claims["events"].(map[string]interface{})
+	if _, ok := events[backchannelLogoutEvent].(map[string]interface{}); !ok {
+		return "", "", fmt.Errorf("the logout token has no back-channel logout event")
+	}
+
+	// A nonce is forbidden to prevent ID tokens from being used as logout tokens.
+	if _, ok := t.Claims["nonce"]; ok {
+		return "", "", fmt.Errorf("the logout token must not contain a nonce")
+	}
+	if _, ok := t.Claims["iat"]; !ok {
+		return "", "", fmt.Errorf("the logout token has no iat claim")
+	}
+
+	sid, _ = t.Claims["sid"].(string)
+	if len(sid) == 0 && len(t.Subject) == 0 {
+		return "", "", fmt.Errorf("the logout token has neither a sid nor a sub claim")
+	}
+
+	return sid, t.Subject, nil
+}
+
+// writeLogoutError writes the error response of an invalid logout request.
+func writeLogoutError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             "invalid_request",
+		"error_description": err.Error(),
+	})
+}
@@ -0,0 +1,252 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/contrib/oauth2"
+)
+
+const (
+	testKid    = "test-key"
+	testIssuer = "https://auth.example.com/"
+)
+
+// newTestJWKS serves the public key with a JWKS endpoint and
+// returns a validator for the test issuer and audience.
+func newTestJWKS(t *testing.T) (*oauth2.JWKS, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": testKid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(ts.Close)
+
+	return &oauth2.JWKS{
+		URL:      ts.URL,
+		Issuer:   testIssuer,
+		Audience: "chat",
+	}, key
+}
+
+// signToken signs the claims with RS256.
+func signToken(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": testKid})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// logoutClaims returns the claims of a valid logout token.
+func logoutClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss": testIssuer,
+		"aud": "chat",
+		"sub": "alice",
+		"sid": "sid-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+		"jti": "logout-1",
+		"events": map[string]interface{}{
+			backchannelLogoutEvent: map[string]interface{}{},
+		},
+	}
+}
+
+// postLogout posts the logout token and returns the response.
+func postLogout(t *testing.T, h http.Handler, token string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	if len(token) > 0 {
+		form.Set("logout_token", token)
+	}
+
+	r := httptest.NewRequest("POST", "/logout", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// logoutRecorder records the OnLogout calls.
+type logoutRecorder struct {
+	calls []string
+	mutex sync.Mutex
+}
+
+func (l *logoutRecorder) onLogout(sid, subject string) {
+	l.mutex.Lock()
+	l.calls = append(l.calls, sid+"/"+subject)
+	l.mutex.Unlock()
+}
+
+func (l *logoutRecorder) get() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	j, key := newTestJWKS(t)
+	var logouts logoutRecorder
+
+	b, ts, sockets := newTestServer(t, Options{
+		LogoutTokenValidator: j,
+		OnLogout:             logouts.onLogout,
+	})
+	h := b.BackchannelLogout()
+
+	ws1, _ := connect(t, ts, "alice-1")
+	ws2, _ := connect(t, ts, "alice-2")
+	receiveSocket(t, sockets)
+	receiveSocket(t, sockets)
+
+	// The sid claim logs out the single session.
+	w := postLogout(t, h, signToken(t, key, logoutClaims()))
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("unexpected response: %d %v", w.Code, w.Header())
+	}
+	if r := parseReject(t, receive(t, ws1, "rj")); r.Code != RejectCodeLoggedOut {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+
+	// Tokens without sid claim log out all sessions of the subject.
+	claims := logoutClaims()
+	delete(claims, "sid")
+	if w = postLogout(t, h, signToken(t, key, claims)); w.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %d", w.Code)
+	}
+	if r := parseReject(t, receive(t, ws2, "rj")); r.Code != RejectCodeLoggedOut {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+
+	if calls := logouts.get(); len(calls) != 2 || calls[0] != "sid-1/alice" || calls[1] != "/alice" {
+		t.Fatalf("unexpected logout calls: %v", calls)
+	}
+}
+
+func TestBackchannelLogoutRejectsTokens(t *testing.T) {
+	j, key := newTestJWKS(t)
+	var logouts logoutRecorder
+
+	b, _, _ := newTestServer(t, Options{
+		LogoutTokenValidator: j,
+		OnLogout:             logouts.onLogout,
+	})
+	h := b.BackchannelLogout()
+
+	// Sign with another key using the same key ID.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c map[string]interface{})
+		key    *rsa.PrivateKey
+	}{
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com/" }, key},
+		{"missing issuer", func(c map[string]interface{}) { delete(c, "iss") }, key},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other" }, key},
+		{"missing audience", func(c map[string]interface{}) { delete(c, "aud") }, key},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, key},
+		{"missing expiry", func(c map[string]interface{}) { delete(c, "exp") }, key},
+		{"missing event", func(c map[string]interface{}) { delete(c, "events") }, key},
+		{"other event", func(c map[string]interface{}) { c["events"] = map[string]interface{}{"other": map[string]interface{}{}} }, key},
+		{"nonce", func(c map[string]interface{}) { c["nonce"] = "abc" }, key},
+		{"missing iat", func(c map[string]interface{}) { delete(c, "iat") }, key},
+		{"neither sid nor sub", func(c map[string]interface{}) { delete(c, "sid"); delete(c, "sub") }, key},
+		{"bad signature", func(c map[string]interface{}) {}, other},
+	}
+
+	for _, test := range tests {
+		claims := logoutClaims()
+		test.modify(claims)
+
+		w := postLogout(t, h, signToken(t, test.key, claims))
+
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusBadRequest || resp["error"] != "invalid_request" || len(resp["error_description"]) == 0 {
+			t.Errorf("%s: unexpected response: %d %v", test.name, w.Code, resp)
+		}
+	}
+
+	// A missing token is rejected.
+	if w := postLogout(t, h, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected response: %d", w.Code)
+	}
+
+	if calls := logouts.get(); len(calls) != 0 {
+		t.Fatalf("unexpected logout calls: %v", calls)
+	}
+}
+
+func TestBackchannelLogoutRequests(t *testing.T) {
+	j, _ := newTestJWKS(t)
+
+	b, _, _ := newTestServer(t, Options{LogoutTokenValidator: j})
+	w := httptest.NewRecorder()
+	b.BackchannelLogout().ServeHTTP(w, httptest.NewRequest("GET", "/logout", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status code: %d", w.Code)
+	}
+
+	// The handler requires the logout token validator.
+	b, _, _ = newTestServer(t, Options{})
+	if w = postLogout(t, b.BackchannelLogout(), "token"); w.Code != http.StatusNotImplemented {
+		t.Fatalf("unexpected status code: %d", w.Code)
+	}
+}
@@ -0,0 +1,368 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package oidc ties glue sockets to the existing OpenID Connect web sessions
+// of an application. The session cookie sent with the socket request is
+// looked up in the session store of the application during the socket
+// initialization. Sockets without a valid session are rejected. All sockets
+// of a session or a user are logged out as soon as the session is revoked
+// or the OpenID provider sends a back-channel logout request.
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue"
+	"github.com/desertbit/glue/contrib/oauth2"
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// RejectCodeNoSession is the rejection code of sockets
+	// without a valid web session.
+	RejectCodeNoSession = "no_session"
+
+	// RejectCodeLoggedOut is sent to the sockets of logged out sessions.
+	RejectCodeLoggedOut = "logged_out"
+
+	// RejectCodeSessionExpired is sent to the sockets
+	// as soon as their web session expires.
+	RejectCodeSessionExpired = "session_expired"
+
+	// MetaSession is the socket metadata key of the session.
+	MetaSession = "oidc.session"
+
+	defaultLookupTimeout = 10 * time.Second
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// ErrSessionNotFound is returned by the session stores
+	// if the session does not exist or was revoked.
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A Session is an authenticated web session of the application.
+type Session struct {
+	// ID is the session ID of the application.
+	ID string
+
+	// Subject is the sub claim of the ID token.
+	Subject string
+
+	// SID is the sid claim of the ID token. It identifies the session at the
+	// OpenID provider and is required for back-channel logouts of single
+	// sessions. Otherwise all sessions of the subject are logged out.
+	SID string
+
+	// Expiry is the expiration time of the session.
+	// The zero time never expires.
+	Expiry time.Time
+
+	// Value holds optional custom data of the application.
+	Value interface{}
+}
+
+// A SessionStore looks up the web sessions of the application.
+type SessionStore interface {
+	// Lookup returns the session of the session cookie value.
+	// Return ErrSessionNotFound if the session does not exist.
+	Lookup(ctx context.Context, cookie string) (*Session, error)
+}
+
+// The SessionStoreFunc type is an adapter to use
+// ordinary functions as session stores.
+type SessionStoreFunc func(ctx context.Context, cookie string) (*Session, error)
+
+// Lookup calls f(ctx, cookie).
+func (f SessionStoreFunc) Lookup(ctx context.Context, cookie string) (*Session, error) {
+	return f(ctx, cookie)
+}
+
+// Options defines the bridge options.
+type Options struct {
+	// Store looks up the web sessions. Required.
+	Store SessionStore
+
+	// CookieName is the name of the session cookie. Required.
+	CookieName string
+
+	// SetUserID sets the session subject as user ID of the socket.
+	SetUserID bool
+
+	// LookupTimeout is the maximum duration of a session lookup.
+	// Default: 10 seconds
+	LookupTimeout time.Duration
+
+	// LogoutTokenValidator verifies the signature and the claims of the
+	// back-channel logout tokens. Use a JWKS validator with the issuer
+	// of the OpenID provider and the client ID as audience.
+	// Required for the BackchannelLogout handler.
+	LogoutTokenValidator oauth2.Validator
+
+	// OnLogout is called by the BackchannelLogout handler with the sid and
+	// the subject of the logout token. Remove the web sessions of the
+	// application within this function. Either value might be empty.
+	OnLogout func(sid, subject string)
+}
+
+//###################//
+//### Bridge Type ###//
+//###################//
+
+// A Bridge authenticates sockets with the web sessions
+// and logs out the sockets of revoked sessions.
+type Bridge struct {
+	options Options
+
+	sessions map[string]map[*glue.Socket]struct{} // Sockets by the session ID.
+	sids     map[string]map[*glue.Socket]struct{} // Sockets by the sid claim.
+	subjects map[string]map[*glue.Socket]struct{} // Sockets by the subject.
+	mutex    sync.Mutex
+}
+
+// New creates a new session bridge.
+func New(o Options) (*Bridge, error) {
+	if o.Store == nil {
+		return nil, fmt.Errorf("oidc: the session store is required")
+	}
+	if len(o.CookieName) == 0 {
+		return nil, fmt.Errorf("oidc: the session cookie name is required")
+	}
+	if j, ok := o.LogoutTokenValidator.(*oauth2.JWKS); ok && (len(j.Issuer) == 0 || len(j.Audience) == 0) {
+		return nil, fmt.Errorf("oidc: the issuer and the audience of the logout token validator are required")
+	}
+
+	if o.LookupTimeout <= 0 {
+		o.LookupTimeout = defaultLookupTimeout
+	}
+
+	return &Bridge{
+		options:  o,
+		sessions: make(map[string]map[*glue.Socket]struct{}),
+		sids:     make(map[string]map[*glue.Socket]struct{}),
+		subjects: make(map[string]map[*glue.Socket]struct{}),
+	}, nil
+}
+
+// Authenticate looks up the web session of the session cookie sent with the
+// socket request. It implements the glue.AuthFunc type and ignores the auth
+// value. Set it as authentication hook of a namespace:
+//
+//	server.Namespace("").OnAuth(b.Authenticate)
+//
+// The session is attached to the socket metadata. The socket is
+// rejected with the session_expired code as soon as the session expires.
+func (b *Bridge) Authenticate(s *glue.Socket, _ string) error {
+	sess, err := b.lookup(s)
+	if err != nil {
+		return err
+	}
+
+	if b.options.SetUserID && len(sess.Subject) > 0 {
+		if err = s.SetUserID(sess.Subject); err != nil {
+			return err
+		}
+	}
+
+	s.SetMeta(MetaSession, sess)
+
+	// Track the socket until it closes.
+	b.add(s, sess)
+
+	var timer *time.Timer
+	if !sess.Expiry.IsZero() {
+		timer = time.AfterFunc(time.Until(sess.Expiry), func() {
+			s.Reject(&glue.RejectError{
+				Code:    RejectCodeSessionExpired,
+				Message: "the web session expired",
+			})
+		})
+	}
+
+	s.OnClose(func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		b.remove(s, sess)
+	})
+
+	return nil
+}
+
+// SessionOf returns the session attached to the socket or nil.
+func SessionOf(s *glue.Socket) *Session {
+	sess, _ := s.Meta(MetaSession).(*Session)
+	return sess
+}
+
+// Logout logs out all sockets of the session with the session ID of the
+// application, for example as soon as the session is revoked. The sockets
+// are rejected with the logged_out code. Returns the number of sockets.
+func (b *Bridge) Logout(sessionID string) int {
+	return b.logout(b.sessions, sessionID)
+}
+
+// LogoutSID logs out all sockets of the session with the sid claim.
+// Returns the number of sockets.
+func (b *Bridge) LogoutSID(sid string) int {
+	return b.logout(b.sids, sid)
+}
+
+// LogoutSubject logs out all sockets of all sessions of the subject.
+// Returns the number of sockets.
+func (b *Bridge) LogoutSubject(subject string) int {
+	return b.logout(b.subjects, subject)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// lookup returns the web session of the socket request.
+// Missing and expired sessions are rejected.
+func (b *Bridge) lookup(s *glue.Socket) (*Session, error) {
+	cookie, err := s.Cookie(b.options.CookieName)
+	if err != nil || len(cookie.Value) == 0 {
+		return nil, &glue.RejectError{
+			Code:    RejectCodeNoSession,
+			Message: "missing session cookie",
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.options.LookupTimeout)
+	defer cancel()
+
+	sess, err := b.options.Store.Lookup(ctx, cookie.Value)
+	if err == ErrSessionNotFound || (err == nil && sess == nil) {
+		return nil, &glue.RejectError{
+			Code:    RejectCodeNoSession,
+			Message: "invalid session",
+		}
+	} else if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"remoteAddress": s.RemoteAddr(),
+			"userAgent":     s.UserAgent(),
+		}).Warningf("oidc: session lookup failed: %v", err)
+
+		// The store might be available again later.
+		return nil, &glue.RejectError{
+			Code:    glue.RejectCodeAuth,
+			Message: "session lookup failed",
+			Retry:   true,
+		}
+	}
+
+	if !sess.Expiry.IsZero() && !time.Now().Before(sess.Expiry) {
+		return nil, &glue.RejectError{
+			Code:    RejectCodeSessionExpired,
+			Message: "the web session expired",
+		}
+	}
+
+	return sess, nil
+}
+
+// add indexes the socket by the session values.
+func (b *Bridge) add(s *glue.Socket, sess *Session) {
+	// Lock the mutex.
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	addSocket(b.sessions, sess.ID, s)
+	addSocket(b.sids, sess.SID, s)
+	addSocket(b.subjects, sess.Subject, s)
+}
+
+// remove removes the socket from the indexes.
+func (b *Bridge) remove(s *glue.Socket, sess *Session) {
+	// Lock the mutex.
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	removeSocket(b.sessions, sess.ID, s)
+	removeSocket(b.sids, sess.SID, s)
+	removeSocket(b.subjects, sess.Subject, s)
+}
+
+// logout rejects the sockets of the index key with the logged_out code.
+func (b *Bridge) logout(index map[string]map[*glue.Socket]struct{}, key string) int {
+	if len(key) == 0 {
+		return 0
+	}
+
+	// Lock the mutex.
+	b.mutex.Lock()
+	sockets := make([]*glue.Socket, 0, len(index[key]))
+	for s := range index[key] {
+		sockets = append(sockets, s)
+	}
+	b.mutex.Unlock()
+
+	// The sockets remove themself from the indexes as soon as they are closed.
+	// Reject them in parallel, because each rejection blocks.
+	for _, s := range sockets {
+		go s.Reject(&glue.RejectError{
+			Code:    RejectCodeLoggedOut,
+			Message: "the web session was logged out",
+		})
+	}
+
+	return len(sockets)
+}
+
+func addSocket(index map[string]map[*glue.Socket]struct{}, key string, s *glue.Socket) {
+	if len(key) == 0 {
+		return
+	}
+
+	m, ok := index[key]
+	if !ok {
+		m = make(map[*glue.Socket]struct{})
+		index[key] = m
+	}
+	m[s] = struct{}{}
+}
+
+func removeSocket(index map[string]map[*glue.Socket]struct{}, key string, s *glue.Socket) {
+	m, ok := index[key]
+	if !ok {
+		return
+	}
+
+	delete(m, s)
+	if len(m) == 0 {
+		delete(index, key)
+	}
+}
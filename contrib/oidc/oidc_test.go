@@ -0,0 +1,275 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue"
+	"github.com/desertbit/glue/contrib/oauth2"
+	"github.com/gorilla/websocket"
+)
+
+const testCookieName = "session"
+
+// testSessions is a session store with fixed sessions. The error
+// cookie fails the lookup with an error other than ErrSessionNotFound.
+var testSessions = SessionStoreFunc(func(ctx context.Context, cookie string) (*Session, error) {
+	switch cookie {
+	case "alice-1":
+		return &Session{ID: "1", Subject: "alice", SID: "sid-1"}, nil
+	case "alice-2":
+		return &Session{ID: "2", Subject: "alice", SID: "sid-2"}, nil
+	case "bob":
+		return &Session{ID: "3", Subject: "bob", Expiry: time.Now().Add(300 * time.Millisecond)}, nil
+	case "expired":
+		return &Session{ID: "4", Subject: "carol", Expiry: time.Now().Add(-time.Minute)}, nil
+	case "nil":
+		return nil, nil
+	case "error":
+		return nil, errors.New("store unavailable")
+	default:
+		return nil, ErrSessionNotFound
+	}
+})
+
+// newTestServer serves a glue server authenticating the sockets with the
+// bridge and returns the channel of the accepted sockets.
+func newTestServer(t *testing.T, o Options) (*Bridge, *httptest.Server, chan *glue.Socket) {
+	if o.Store == nil {
+		o.Store = testSessions
+	}
+	o.CookieName = testCookieName
+
+	b, err := New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := glue.NewServer(glue.Options{HTTPSocketType: glue.HTTPSocketTypeNone})
+	t.Cleanup(server.Release)
+
+	sockets := make(chan *glue.Socket, 10)
+	server.Namespace("").OnAuth(b.Authenticate)
+	server.OnNewSocket(func(s *glue.Socket) {
+		sockets <- s
+	})
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	return b, ts, sockets
+}
+
+// connect opens a websocket with the session cookie and sends the init
+// request. It returns the connection and the init or reject reply frame.
+func connect(t *testing.T, ts *httptest.Server, cookie string) (*websocket.Conn, string) {
+	t.Helper()
+
+	header := http.Header{}
+	if len(cookie) > 0 {
+		header.Set("Cookie", testCookieName+"="+cookie)
+	}
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/glue/ws", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	if err = ws.WriteMessage(websocket.TextMessage, []byte(`in{"version":"`+glue.Version+`","reject":true}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	return ws, receive(t, ws, "in", "rj")
+}
+
+// receive returns the next frame with one of the commands.
+func receive(t *testing.T, ws *websocket.Conn, cmds ...string) string {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, cmd := range cmds {
+			if strings.HasPrefix(string(data), cmd) {
+				return string(data)
+			}
+		}
+	}
+}
+
+// parseReject returns the rejection of the reject frame.
+func parseReject(t *testing.T, frame string) glue.RejectError {
+	t.Helper()
+
+	var r glue.RejectError
+	if !strings.HasPrefix(frame, "rj") {
+		t.Fatalf("no reject frame: %q", frame)
+	} else if err := json.Unmarshal([]byte(frame[2:]), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+// receiveSocket returns the next accepted socket.
+func receiveSocket(t *testing.T, sockets chan *glue.Socket) *glue.Socket {
+	t.Helper()
+
+	select {
+	case s := <-sockets:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no socket accepted")
+		return nil
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		err     bool
+	}{
+		{"valid", Options{Store: testSessions, CookieName: "session"}, false},
+		{"missing store", Options{CookieName: "session"}, true},
+		{"missing cookie name", Options{Store: testSessions}, true},
+		{"validator", Options{Store: testSessions, CookieName: "session", LogoutTokenValidator: &oauth2.JWKS{
+			URL: "https://auth.example.com/jwks", Issuer: "https://auth.example.com/", Audience: "chat",
+		}}, false},
+		{"validator without issuer", Options{Store: testSessions, CookieName: "session", LogoutTokenValidator: &oauth2.JWKS{
+			URL: "https://auth.example.com/jwks", Audience: "chat",
+		}}, true},
+		{"validator without audience", Options{Store: testSessions, CookieName: "session", LogoutTokenValidator: &oauth2.JWKS{
+			URL: "https://auth.example.com/jwks", Issuer: "https://auth.example.com/",
+		}}, true},
+	}
+
+	for _, test := range tests {
+		if _, err := New(test.options); (err != nil) != test.err {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	_, ts, sockets := newTestServer(t, Options{SetUserID: true})
+
+	tests := []struct {
+		name   string
+		cookie string
+		code   string
+		retry  bool
+	}{
+		{"missing cookie", "", RejectCodeNoSession, false},
+		{"unknown session", "unknown", RejectCodeNoSession, false},
+		{"nil session", "nil", RejectCodeNoSession, false},
+		{"expired session", "expired", RejectCodeSessionExpired, false},
+		{"store error", "error", glue.RejectCodeAuth, true},
+	}
+
+	for _, test := range tests {
+		_, frame := connect(t, ts, test.cookie)
+		if r := parseReject(t, frame); r.Code != test.code || r.Retry != test.retry {
+			t.Errorf("%s: unexpected rejection: %+v", test.name, r)
+		}
+	}
+
+	// Valid sessions are attached to the sockets.
+	if _, frame := connect(t, ts, "alice-1"); !strings.HasPrefix(frame, "in") {
+		t.Fatalf("unexpected reply: %q", frame)
+	}
+
+	s := receiveSocket(t, sockets)
+	if sess := SessionOf(s); sess == nil || sess.ID != "1" || sess.SID != "sid-1" {
+		t.Fatalf("unexpected session: %+v", sess)
+	}
+	if id := s.UserID(); id != "alice" {
+		t.Fatalf("unexpected user ID: %q", id)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	_, ts, sockets := newTestServer(t, Options{})
+
+	ws, _ := connect(t, ts, "bob")
+	s := receiveSocket(t, sockets)
+	if id := s.UserID(); len(id) != 0 {
+		t.Fatalf("unexpected user ID: %q", id)
+	}
+
+	// The socket is rejected as soon as the session expires.
+	if r := parseReject(t, receive(t, ws, "rj")); r.Code != RejectCodeSessionExpired {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	b, ts, sockets := newTestServer(t, Options{})
+
+	ws1, _ := connect(t, ts, "alice-1")
+	ws2, _ := connect(t, ts, "alice-2")
+	receiveSocket(t, sockets)
+	receiveSocket(t, sockets)
+
+	// Unknown and empty keys don't log out any socket.
+	if n := b.Logout("unknown"); n != 0 {
+		t.Fatalf("unexpected logged out sockets: %d", n)
+	}
+	if n := b.LogoutSID(""); n != 0 {
+		t.Fatalf("unexpected logged out sockets: %d", n)
+	}
+
+	// Log out the first session.
+	if n := b.Logout("1"); n != 1 {
+		t.Fatalf("unexpected logged out sockets: %d", n)
+	}
+	if r := parseReject(t, receive(t, ws1, "rj")); r.Code != RejectCodeLoggedOut {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+
+	// Closed sockets are removed from the indexes.
+	deadline := time.Now().Add(5 * time.Second)
+	for b.LogoutSID("sid-1") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the logged out socket is still indexed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Log out all sessions of the subject.
+	if n := b.LogoutSubject("alice"); n != 1 {
+		t.Fatalf("unexpected logged out sockets: %d", n)
+	}
+	if r := parseReject(t, receive(t, ws2, "rj")); r.Code != RejectCodeLoggedOut {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+}
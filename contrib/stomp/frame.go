@@ -0,0 +1,229 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The STOMP frame commands.
+	cmdConnect     = "CONNECT"
+	cmdConnected   = "CONNECTED"
+	cmdSend        = "SEND"
+	cmdSubscribe   = "SUBSCRIBE"
+	cmdUnsubscribe = "UNSUBSCRIBE"
+	cmdDisconnect  = "DISCONNECT"
+	cmdMessage     = "MESSAGE"
+	cmdReceipt     = "RECEIPT"
+	cmdError       = "ERROR"
+
+	// The maximum length of the command and header lines.
+	maxLineLength = 64 * 1024
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	errLineTooLong  = errors.New("stomp: frame line too long")
+	errBodyTooLarge = errors.New("stomp: frame body too large")
+
+	// Escapes the header values of STOMP 1.2 frames.
+	headerEscaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	headerUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+//##################//
+//### Frame type ###//
+//##################//
+
+// A frame is a STOMP frame. The headers are kept in order.
+type frame struct {
+	command string
+	headers []string // Key and value pairs.
+	body    []byte
+}
+
+func newFrame(command string, headers ...string) *frame {
+	return &frame{
+		command: command,
+		headers: headers,
+	}
+}
+
+// header returns the value of the first header with the key.
+func (f *frame) header(key string) string {
+	for i := 0; i+1 < len(f.headers); i += 2 {
+		if f.headers[i] == key {
+			return f.headers[i+1]
+		}
+	}
+	return ""
+}
+
+// escape returns true if the header values of the frame are escaped.
+// The headers of the CONNECT and CONNECTED frames are not escaped.
+func (f *frame) escape() bool {
+	return f.command != cmdConnect && f.command != cmdConnected
+}
+
+// writeTo writes the frame. The content-length header is
+// set for frames with a body, so the body may contain NUL bytes.
+func (f *frame) writeTo(w io.Writer) error {
+	var buf bytes.Buffer
+
+	buf.WriteString(f.command)
+	buf.WriteByte('\n')
+
+	for i := 0; i+1 < len(f.headers); i += 2 {
+		key, value := f.headers[i], f.headers[i+1]
+		if f.escape() {
+			key, value = headerEscaper.Replace(key), headerEscaper.Replace(value)
+		}
+
+		buf.WriteString(key)
+		buf.WriteByte(':')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+	}
+
+	if len(f.body) > 0 {
+		buf.WriteString("content-length:")
+		buf.WriteString(strconv.Itoa(len(f.body)))
+		buf.WriteByte('\n')
+	}
+
+	buf.WriteByte('\n')
+	buf.Write(f.body)
+	buf.WriteByte(0)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+//##############################//
+//### Private frame functions ###//
+//##############################//
+
+// readLine reads a line without the trailing EOL.
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+
+	for {
+		data, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+
+		line = append(line, data...)
+		if len(line) > maxLineLength {
+			return "", errLineTooLong
+		} else if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+// readFrame reads the next frame. The heart-beats (EOLs between
+// the frames) are skipped and the heart-beat function is called.
+func readFrame(r *bufio.Reader, maxBodySize int64, onHeartBeat func()) (*frame, error) {
+	f := &frame{}
+
+	// Skip the heart-beats.
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		} else if len(line) > 0 {
+			f.command = line
+			break
+		}
+
+		if onHeartBeat != nil {
+			onHeartBeat()
+		}
+	}
+
+	// Read the headers.
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		} else if len(line) == 0 {
+			break
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("stomp: invalid header line: %q", line)
+		}
+
+		key, value := line[:i], line[i+1:]
+		if f.escape() {
+			key, value = headerUnescaper.Replace(key), headerUnescaper.Replace(value)
+		}
+		f.headers = append(f.headers, key, value)
+	}
+
+	// Read the body with the content length or up to the NUL byte.
+	if l := f.header("content-length"); len(l) > 0 {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("stomp: invalid content-length header: %q", l)
+		} else if n > maxBodySize {
+			return nil, errBodyTooLarge
+		}
+
+		f.body = make([]byte, n+1)
+		if _, err = io.ReadFull(r, f.body); err != nil {
+			return nil, err
+		} else if f.body[n] != 0 {
+			return nil, errors.New("stomp: frame not terminated by a NUL byte")
+		}
+		f.body = f.body[:n]
+
+		return f, nil
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		} else if b == 0 {
+			return f, nil
+		}
+
+		f.body = append(f.body, b)
+		if int64(len(f.body)) > maxBodySize {
+			return nil, errBodyTooLarge
+		}
+	}
+}
@@ -0,0 +1,549 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package stomp bridges the destinations of a STOMP 1.2 message broker,
+// for example RabbitMQ or ActiveMQ, to glue topics. A destination is
+// subscribed at the broker as long as its topic has subscribers on this
+// node and its messages are delivered to these subscribers. The subscriptions
+// are restored after the connection to the broker was lost.
+package stomp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue"
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultHeartBeat      = 10 * time.Second
+	defaultReconnectDelay = time.Second
+	defaultMaxBodySize    = 10 << 20
+	defaultDialTimeout    = 10 * time.Second
+
+	// Time allowed to write a frame to the broker.
+	writeWait = 10 * time.Second
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+var (
+	// ErrNotConnected is returned if the bridge is not connected to the broker.
+	ErrNotConnected = errors.New("stomp: not connected")
+
+	errConnect = errors.New("failed to connect")
+)
+
+//####################//
+//### Options type ###//
+//####################//
+
+// Options defines the bridge options.
+type Options struct {
+	// Addr is the TCP address of the STOMP listener of the broker,
+	// for example "localhost:61613". Required if Dial is not set.
+	Addr string
+
+	// Dial opens the connection to the broker, for example with TLS.
+	// Default: a TCP connection to Addr.
+	Dial func(ctx context.Context) (net.Conn, error)
+
+	// Host is the virtual host of the broker, for example "/" for RabbitMQ.
+	// Default: the host of Addr
+	Host string
+
+	// Login and Passcode are the credentials of the broker.
+	Login    string
+	Passcode string
+
+	// Headers are additional headers of the SUBSCRIBE frames,
+	// for example "durable" or "prefetch-count".
+	Headers map[string]string
+
+	// HeartBeat is the heart-beat interval negotiated with the broker.
+	// The connection is considered lost if the broker doesn't send
+	// anything within twice the interval. Default: 10 seconds
+	HeartBeat time.Duration
+
+	// ReconnectDelay is the delay between the connection attempts.
+	// The delay doubles with each failed attempt up to 30 times.
+	// Default: 1 second
+	ReconnectDelay time.Duration
+
+	// MaxBodySize is the maximum size of a message body in bytes.
+	// Default: 10 MB
+	MaxBodySize int64
+}
+
+func (o *Options) setDefaults() {
+	if o.Dial == nil {
+		addr := o.Addr
+		o.Dial = func(ctx context.Context) (net.Conn, error) {
+			d := net.Dialer{Timeout: defaultDialTimeout}
+			return d.DialContext(ctx, "tcp", addr)
+		}
+	}
+	if len(o.Host) == 0 {
+		o.Host, _, _ = net.SplitHostPort(o.Addr)
+	}
+	if o.HeartBeat <= 0 {
+		o.HeartBeat = defaultHeartBeat
+	}
+	if o.ReconnectDelay <= 0 {
+		o.ReconnectDelay = defaultReconnectDelay
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = defaultMaxBodySize
+	}
+}
+
+//##################//
+//### Route type ###//
+//##################//
+
+// A route maps a broker destination to a topic.
+type route struct {
+	topic       *glue.Topic
+	destination string
+
+	active     bool   // Set while the topic has subscribers.
+	subscribed bool   // Set while the destination is subscribed.
+	id         string // The ID of the broker subscription.
+}
+
+//###################//
+//### Bridge type ###//
+//###################//
+
+// A Bridge connects to the broker and maintains the broker
+// subscriptions of the routed topics.
+type Bridge struct {
+	options Options
+
+	routes map[*glue.Topic]*route
+	subs   map[string]*route // The subscribed routes by the subscription ID.
+	nextID int
+	conn   *conn // Set while connected.
+	mutex  sync.Mutex
+
+	// Triggers the update of the broker subscriptions.
+	updateChan chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// New creates a new bridge and connects to the broker in the background.
+func New(o Options) (*Bridge, error) {
+	if len(o.Addr) == 0 && o.Dial == nil {
+		return nil, fmt.Errorf("stomp: the broker address is required")
+	}
+	o.setDefaults()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := &Bridge{
+		options:    o,
+		routes:     make(map[*glue.Topic]*route),
+		subs:       make(map[string]*route),
+		updateChan: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+
+	go b.run()
+
+	return b, nil
+}
+
+// Route delivers the messages of the broker destination to the topic, for
+// example "/topic/prices" or "/exchange/amq.topic/prices.*". The destination
+// is subscribed as soon as the topic has subscribers on this node and
+// unsubscribed after the last subscriber left. Route sets the OnActive
+// function of the topic.
+func (b *Bridge) Route(t *glue.Topic, destination string) {
+	r := &route{
+		topic:       t,
+		destination: destination,
+	}
+
+	// The subscription of a replaced route is removed with the next update.
+	b.mutex.Lock()
+	b.routes[t] = r
+	b.mutex.Unlock()
+
+	t.OnActive(func(active bool) {
+		b.mutex.Lock()
+		r.active = active
+		b.mutex.Unlock()
+
+		b.update()
+	})
+}
+
+// Send sends the body to the broker destination.
+func (b *Bridge) Send(destination, body string, headers ...string) error {
+	b.mutex.Lock()
+	c := b.conn
+	b.mutex.Unlock()
+
+	if c == nil {
+		return ErrNotConnected
+	}
+
+	f := newFrame(cmdSend, append([]string{"destination", destination}, headers...)...)
+	f.body = []byte(body)
+
+	return c.write(f)
+}
+
+// Close disconnects from the broker and stops the bridge.
+func (b *Bridge) Close() error {
+	b.cancel()
+	<-b.done
+	return nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// update triggers the update of the broker subscriptions.
+func (b *Bridge) update() {
+	select {
+	case b.updateChan <- struct{}{}:
+	default:
+	}
+}
+
+// run connects to the broker and reconnects after the connection was lost.
+func (b *Bridge) run() {
+	defer close(b.done)
+
+	delay := b.options.ReconnectDelay
+
+	for {
+		err := b.serve()
+		if b.ctx.Err() != nil {
+			return
+		}
+
+		log.L.WithFields(logrus.Fields{
+			"addr": b.options.Addr,
+		}).Warningf("stomp: broker connection: %v", err)
+
+		// Reset the delay after a successful connection.
+		if !errors.Is(err, errConnect) {
+			delay = b.options.ReconnectDelay
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-b.ctx.Done():
+			return
+		}
+
+		if delay < 30*b.options.ReconnectDelay {
+			delay *= 2
+		}
+	}
+}
+
+// serve connects to the broker and handles the connection until it is lost.
+func (b *Bridge) serve() error {
+	c, err := b.connect()
+	if err != nil {
+		return fmt.Errorf("%w: %v", errConnect, err)
+	}
+	defer c.close()
+
+	b.mutex.Lock()
+	b.conn = c
+	b.mutex.Unlock()
+
+	defer func() {
+		// Lock the mutex.
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		// Resubscribe after reconnecting.
+		b.conn = nil
+		b.subs = make(map[string]*route)
+		for _, r := range b.routes {
+			r.subscribed = false
+		}
+	}()
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- b.readLoop(c)
+	}()
+
+	// Subscribe the active destinations.
+	b.update()
+
+	var heartBeat <-chan time.Time
+	if c.sendInterval > 0 {
+		ticker := time.NewTicker(c.sendInterval)
+		defer ticker.Stop()
+		heartBeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-b.updateChan:
+			if err := b.subscribe(c); err != nil {
+				return err
+			}
+
+		case <-heartBeat:
+			if err := c.writeHeartBeat(); err != nil {
+				return err
+			}
+
+		case err := <-readErr:
+			return err
+
+		case <-b.ctx.Done():
+			// Disconnect gracefully. Ignore errors.
+			c.write(newFrame(cmdDisconnect))
+			return nil
+		}
+	}
+}
+
+// subscribe subscribes the active and unsubscribes the inactive routes.
+func (b *Bridge) subscribe(c *conn) error {
+	var frames []*frame
+
+	func() {
+		// Lock the mutex.
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+
+		// Unsubscribe the replaced routes.
+		for id, r := range b.subs {
+			if b.routes[r.topic] != r {
+				delete(b.subs, id)
+				frames = append(frames, newFrame(cmdUnsubscribe, "id", id))
+			}
+		}
+
+		for _, r := range b.routes {
+			if r.active == r.subscribed {
+				continue
+			}
+
+			if r.subscribed {
+				r.subscribed = false
+				delete(b.subs, r.id)
+				frames = append(frames, newFrame(cmdUnsubscribe, "id", r.id))
+				continue
+			}
+
+			b.nextID++
+			r.id = strconv.Itoa(b.nextID)
+			r.subscribed = true
+			b.subs[r.id] = r
+
+			headers := []string{"id", r.id, "destination", r.destination, "ack", "auto"}
+			for k, v := range b.options.Headers {
+				headers = append(headers, k, v)
+			}
+			frames = append(frames, newFrame(cmdSubscribe, headers...))
+		}
+	}()
+
+	for _, f := range frames {
+		if err := c.write(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLoop publishes the received messages to the topics.
+func (b *Bridge) readLoop(c *conn) error {
+	for {
+		f, err := c.read()
+		if err != nil {
+			return err
+		}
+
+		switch f.command {
+		case cmdMessage:
+			b.mutex.Lock()
+			r := b.subs[f.header("subscription")]
+			b.mutex.Unlock()
+
+			// Drop the messages of unsubscribed destinations. Each node
+			// consumes the destination itself in cluster mode.
+			if r != nil {
+				r.topic.PublishLocal(string(f.body))
+			}
+
+		case cmdError:
+			return fmt.Errorf("broker error: %s: %s", f.header("message"), strings.TrimSpace(string(f.body)))
+		}
+	}
+}
+
+//#################//
+//### Conn type ###//
+//#################//
+
+// A conn is an established connection to the broker.
+type conn struct {
+	netConn net.Conn
+	reader  *bufio.Reader
+
+	maxBodySize  int64
+	sendInterval time.Duration // The heart-beat interval of the bridge.
+	readTimeout  time.Duration // Zero if the broker sends no heart-beats.
+
+	writeMutex sync.Mutex
+}
+
+// connect opens the connection and sends the CONNECT frame.
+func (b *Bridge) connect() (*conn, error) {
+	netConn, err := b.options.Dial(b.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the handshake if the bridge is closed.
+	stop := context.AfterFunc(b.ctx, func() {
+		netConn.Close()
+	})
+	defer stop()
+
+	c := &conn{
+		netConn:     netConn,
+		reader:      bufio.NewReader(netConn),
+		maxBodySize: b.options.MaxBodySize,
+		readTimeout: defaultDialTimeout,
+	}
+
+	heartBeat := strconv.FormatInt(b.options.HeartBeat.Milliseconds(), 10)
+	headers := []string{
+		"accept-version", "1.2",
+		"host", b.options.Host,
+		"heart-beat", heartBeat + "," + heartBeat,
+	}
+	if len(b.options.Login) > 0 {
+		headers = append(headers, "login", b.options.Login, "passcode", b.options.Passcode)
+	}
+
+	if err = c.write(newFrame(cmdConnect, headers...)); err != nil {
+		c.close()
+		return nil, err
+	}
+
+	f, err := c.read()
+	if err != nil {
+		c.close()
+		return nil, err
+	} else if f.command == cmdError {
+		c.close()
+		return nil, fmt.Errorf("broker error: %s", f.header("message"))
+	} else if f.command != cmdConnected {
+		c.close()
+		return nil, fmt.Errorf("unexpected frame: %s", f.command)
+	}
+
+	// Negotiate the heart-beats.
+	c.sendInterval, c.readTimeout = 0, 0
+	var sx, sy int64
+	fmt.Sscanf(f.header("heart-beat"), "%d,%d", &sx, &sy)
+
+	if sy > 0 {
+		c.sendInterval = maxDuration(b.options.HeartBeat, time.Duration(sy)*time.Millisecond)
+	}
+	if sx > 0 {
+		// Tolerate delays of the heart-beats.
+		c.readTimeout = 2 * maxDuration(b.options.HeartBeat, time.Duration(sx)*time.Millisecond)
+	}
+
+	return c, nil
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// read reads the next frame.
+func (c *conn) read() (*frame, error) {
+	if c.readTimeout > 0 {
+		c.netConn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	} else {
+		c.netConn.SetReadDeadline(time.Time{})
+	}
+
+	return readFrame(c.reader, c.maxBodySize, func() {
+		// Each heart-beat extends the deadline.
+		if c.readTimeout > 0 {
+			c.netConn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+	})
+}
+
+// write writes the frame. This method is thread-safe.
+func (c *conn) write(f *frame) error {
+	// Lock the mutex.
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.netConn.SetWriteDeadline(time.Now().Add(writeWait))
+	return f.writeTo(c.netConn)
+}
+
+// writeHeartBeat writes a heart-beat. This method is thread-safe.
+func (c *conn) writeHeartBeat() error {
+	// Lock the mutex.
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	c.netConn.SetWriteDeadline(time.Now().Add(writeWait))
+	_, err := c.netConn.Write([]byte{'\n'})
+	return err
+}
+
+func (c *conn) close() {
+	c.netConn.Close()
+}
@@ -0,0 +1,302 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue"
+)
+
+// A testBroker accepts the bridge connections and records the received frames.
+type testBroker struct {
+	listener net.Listener
+	frames   chan *frame
+	conns    chan net.Conn
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	b := &testBroker{
+		listener: l,
+		frames:   make(chan *frame, 100),
+		conns:    make(chan net.Conn, 10),
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(c)
+		}
+	}()
+
+	return b
+}
+
+func (b *testBroker) serve(c net.Conn) {
+	defer c.Close()
+
+	r := bufio.NewReader(c)
+	for {
+		f, err := readFrame(r, defaultMaxBodySize, nil)
+		if err != nil {
+			return
+		}
+
+		if f.command == cmdConnect {
+			if f.header("login") != "guest" {
+				newFrame(cmdError, "message", "access refused").writeTo(c)
+				return
+			}
+			newFrame(cmdConnected, "version", "1.2", "heart-beat", "0,0").writeTo(c)
+			b.conns <- c
+			continue
+		}
+
+		b.frames <- f
+	}
+}
+
+// expect returns the next frame and fails if the command doesn't match.
+func (b *testBroker) expect(t *testing.T, command string) *frame {
+	t.Helper()
+
+	select {
+	case f := <-b.frames:
+		if f.command != command {
+			t.Fatalf("expected %s frame, got %s", command, f.command)
+		}
+		return f
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no %s frame received", command)
+		return nil
+	}
+}
+
+// accept returns the next connection of the bridge.
+func (b *testBroker) accept(t *testing.T) net.Conn {
+	t.Helper()
+
+	select {
+	case c := <-b.conns:
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("bridge not connected")
+		return nil
+	}
+}
+
+// newTestSocket connects an initialized in-memory socket.
+func newTestSocket(t *testing.T, server *glue.Server, sockets chan *glue.Socket) (*glue.MemoryConn, *glue.Socket) {
+	conn := server.ConnectMemory("127.0.0.1", "test")
+	t.Cleanup(func() { conn.Close() })
+
+	if err := conn.Send(`in{"version":"` + glue.Version + `"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case s := <-sockets:
+		return conn, s
+	case <-time.After(2 * time.Second):
+		t.Fatal("socket not initialized")
+		return nil, nil
+	}
+}
+
+// receive waits for a frame containing the data.
+func receive(t *testing.T, conn *glue.MemoryConn, data string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		frame, err := conn.Receive(time.Until(deadline))
+		if err != nil {
+			t.Fatalf("%q not received: %v", data, err)
+		}
+		if strings.HasPrefix(frame, "cd") && strings.HasSuffix(frame, data) {
+			return
+		}
+	}
+}
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+
+	f := newFrame(cmdSend, "destination", "/topic/a:b\n")
+	f.body = []byte("hello\x00world")
+	if err := f.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Heart-beats between the frames are skipped.
+	heartBeats := 0
+	r := bufio.NewReader(strings.NewReader("\n\r\n" + buf.String()))
+	g, err := readFrame(r, 100, func() { heartBeats++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.command != cmdSend || g.header("destination") != "/topic/a:b\n" || string(g.body) != "hello\x00world" || heartBeats != 2 {
+		t.Fatalf("unexpected frame: %+v", g)
+	}
+
+	// The body size is limited.
+	r = bufio.NewReader(strings.NewReader(buf.String()))
+	if _, err = readFrame(r, 5, nil); err != errBodyTooLarge {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Frames without content-length end with the NUL byte.
+	r = bufio.NewReader(strings.NewReader("MESSAGE\nsubscription:1\n\nbody\x00"))
+	if g, err = readFrame(r, 100, nil); err != nil || string(g.body) != "body" {
+		t.Fatalf("unexpected frame: %+v %v", g, err)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	broker := newTestBroker(t)
+
+	server := glue.NewServer(glue.Options{})
+	t.Cleanup(server.Release)
+
+	sockets := make(chan *glue.Socket, 10)
+	server.OnNewSocket(func(s *glue.Socket) {
+		sockets <- s
+	})
+
+	b, err := New(Options{
+		Addr:           broker.listener.Addr().String(),
+		Login:          "guest",
+		Passcode:       "guest",
+		ReconnectDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	c := broker.accept(t)
+
+	topic := server.Topic("prices")
+	b.Route(topic, "/topic/prices")
+
+	// The first subscriber subscribes the destination.
+	conn1, s1 := newTestSocket(t, server, sockets)
+	conn2, s2 := newTestSocket(t, server, sockets)
+	topic.Subscribe(s1)
+	topic.Subscribe(s2)
+
+	f := broker.expect(t, cmdSubscribe)
+	if f.header("destination") != "/topic/prices" || f.header("ack") != "auto" {
+		t.Fatalf("unexpected subscribe frame: %+v", f)
+	}
+	id := f.header("id")
+
+	// The messages are delivered to the topic subscribers.
+	m := newFrame(cmdMessage, "subscription", id, "destination", "/topic/prices", "message-id", "1")
+	m.body = []byte("42")
+	m.writeTo(c)
+
+	receive(t, conn1, "42")
+	receive(t, conn2, "42")
+
+	// The last subscriber unsubscribes the destination.
+	topic.Unsubscribe(s1)
+	s2.Close()
+
+	if f = broker.expect(t, cmdUnsubscribe); f.header("id") != id {
+		t.Fatalf("unexpected unsubscribe frame: %+v", f)
+	}
+
+	// Messages are sent to the broker.
+	if err = b.Send("/queue/orders", "buy"); err != nil {
+		t.Fatal(err)
+	}
+	if f = broker.expect(t, cmdSend); f.header("destination") != "/queue/orders" || string(f.body) != "buy" {
+		t.Fatalf("unexpected send frame: %+v", f)
+	}
+
+	// The active destinations are subscribed again after reconnecting.
+	topic.Subscribe(s1)
+	broker.expect(t, cmdSubscribe)
+
+	c.Close()
+	broker.accept(t)
+
+	if f = broker.expect(t, cmdSubscribe); f.header("destination") != "/topic/prices" {
+		t.Fatalf("unexpected subscribe frame: %+v", f)
+	}
+
+	// Close disconnects gracefully.
+	b.Close()
+	broker.expect(t, cmdDisconnect)
+
+	if err = b.Send("/queue/orders", "buy"); err != ErrNotConnected {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBridgeConnectError(t *testing.T) {
+	broker := newTestBroker(t)
+
+	b, err := New(Options{
+		Addr:           broker.listener.Addr().String(),
+		Login:          "invalid",
+		ReconnectDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err = b.Send("/queue/orders", "buy"); err != ErrNotConnected {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Close aborts the reconnect loop.
+	done := make(chan struct{})
+	go func() {
+		b.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked")
+	}
+
+	if _, err = New(Options{}); err == nil {
+		t.Fatal("missing address accepted")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultDeadLetterQueueSize = 1024
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A DeadLetter is an undeliverable message with its metadata.
+type DeadLetter struct {
+	Time   time.Time
+	Reason DropReason
+
+	// The socket and user the message was written to. The socket values
+	// are empty for messages written to offline users.
+	SocketID   string
+	UserID     string
+	RemoteAddr string
+
+	Channel string
+	Data    string
+}
+
+// A DeadLetterSink receives the undeliverable messages, for example
+// to retry critical notifications through another channel later.
+type DeadLetterSink interface {
+	// HandleDeadLetter is called with each undeliverable message.
+	// The calls are serialized and may block.
+	HandleDeadLetter(l DeadLetter)
+}
+
+// DeadLetterFunc is a function implementing the DeadLetterSink interface.
+type DeadLetterFunc func(l DeadLetter)
+
+// HandleDeadLetter calls the function.
+func (f DeadLetterFunc) HandleDeadLetter(l DeadLetter) {
+	f(l)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// startDeadLetters starts the dead letter queue if a sink is set.
+func (s *Server) startDeadLetters() {
+	if s.options.DeadLetters == nil {
+		return
+	}
+
+	size := s.options.DeadLetterQueueSize
+	if size <= 0 {
+		size = defaultDeadLetterQueueSize
+	}
+
+	s.deadLetters = make(chan DeadLetter, size)
+	go s.deadLetterLoop()
+}
+
+// deadLetterLoop passes the queued dead letters to the sink.
+func (s *Server) deadLetterLoop() {
+	for l := range s.deadLetters {
+		s.handleDeadLetter(l)
+	}
+}
+
+func (s *Server) handleDeadLetter(l DeadLetter) {
+	// Recover panics and log the error.
+	defer func() {
+		if e := recover(); e != nil {
+			log.L.Errorf("glue: panic while calling the dead letter sink: %v\n%s", e, debug.Stack())
+		}
+	}()
+
+	s.options.DeadLetters.HandleDeadLetter(l)
+}
+
+// pushDeadLetter queues the dead letter for the sink. The letter is
+// dropped and logged if the queue is full. This never blocks.
+func (s *Server) pushDeadLetter(l DeadLetter) {
+	if s.deadLetters == nil {
+		return
+	}
+
+	l.Time = time.Now()
+
+	select {
+	case s.deadLetters <- l:
+	default:
+		log.L.WithFields(logrus.Fields{
+			"socketID": l.SocketID,
+			"userID":   l.UserID,
+			"channel":  l.Channel,
+			"reason":   l.Reason,
+		}).Warningf("glue: dead letter queue is full: message lost")
+	}
+}
+
+// deadLetter passes the undeliverable message written
+// to the socket to the dead letter queue if enabled.
+// Only written messages are passed to the queue. The messages
+// of reliable channels are skipped, because they are redelivered.
+func (s *Socket) deadLetter(name, data string, reason DropReason) {
+	if s.server.deadLetters == nil || name == reliableChannelName ||
+		(reason != DropReasonExpired && reason != DropReasonSocketClosed) {
+		return
+	}
+
+	s.server.pushDeadLetter(DeadLetter{
+		Reason:     reason,
+		SocketID:   s.ID(),
+		UserID:     s.UserID(),
+		RemoteAddr: s.RemoteAddr(),
+		Channel:    name,
+		Data:       data,
+	})
+}
@@ -0,0 +1,129 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"sync"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultDedupWindowSize = 256
+
+	// Windows without received messages are removed after the timeout.
+	dedupWindowTimeout = time.Hour
+)
+
+//#########################//
+//### Dedup Window Type ###//
+//#########################//
+
+// A dedupWindow remembers the IDs of the last received messages.
+type dedupWindow struct {
+	ids      map[string]struct{}
+	order    []string // The IDs in the received order.
+	lastSeen time.Time
+}
+
+// add adds the message ID to the window and returns false
+// if the ID is already part of the window. The oldest
+// IDs are removed if the window exceeds the size.
+func (w *dedupWindow) add(id string, size int) bool {
+	if _, ok := w.ids[id]; ok {
+		return false
+	}
+
+	w.ids[id] = struct{}{}
+	w.order = append(w.order, id)
+
+	for len(w.order) > size {
+		delete(w.ids, w.order[0])
+		w.order = w.order[1:]
+	}
+
+	return true
+}
+
+//##########################//
+//### Dedup Windows Type ###//
+//##########################//
+
+// dedupWindows holds the dedup windows of the reliable
+// channels keyed by the user or client ID and the channel name.
+// The windows outlive the sockets to detect redeliveries
+// of messages after reconnects.
+type dedupWindows struct {
+	size int
+
+	windows     map[string]*dedupWindow
+	lastCleanup time.Time
+	mutex       sync.Mutex
+}
+
+func newDedupWindows(size int) *dedupWindows {
+	if size <= 0 {
+		size = defaultDedupWindowSize
+	}
+
+	return &dedupWindows{
+		size:        size,
+		windows:     make(map[string]*dedupWindow),
+		lastCleanup: time.Now(),
+	}
+}
+
+// add adds the message ID to the window of the key and
+// returns false if the message was received before.
+func (d *dedupWindows) add(key, id string) bool {
+	// Lock the mutex.
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now()
+	d.cleanup(now)
+
+	w, ok := d.windows[key]
+	if !ok {
+		w = &dedupWindow{ids: make(map[string]struct{})}
+		d.windows[key] = w
+	}
+	w.lastSeen = now
+
+	return w.add(id, d.size)
+}
+
+// cleanup removes the windows without received messages
+// within the timeout. The windows are checked at most
+// once per timeout. The mutex must be locked.
+func (d *dedupWindows) cleanup(now time.Time) {
+	if now.Sub(d.lastCleanup) < dedupWindowTimeout {
+		return
+	}
+	d.lastCleanup = now
+
+	for key, w := range d.windows {
+		if now.Sub(w.lastSeen) >= dedupWindowTimeout {
+			delete(d.windows, key)
+		}
+	}
+}
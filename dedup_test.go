@@ -0,0 +1,107 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+func TestDedupWindow(t *testing.T) {
+	d := newDedupWindows(2)
+
+	if !d.add("k", "1") || !d.add("k", "2") {
+		t.Fatal("expected new IDs to be added")
+	}
+	if d.add("k", "1") {
+		t.Fatal("expected a duplicate")
+	}
+	if !d.add("other", "1") {
+		t.Fatal("expected the windows to be separated by the key")
+	}
+
+	// The oldest ID is removed from the full window.
+	d.add("k", "3")
+	if !d.add("k", "1") {
+		t.Fatal("expected the oldest ID to be removed")
+	}
+}
+
+// sendReliableMessage passes a reliable message of the orders channel to the server.
+func sendReliableMessage(t *testing.T, conn *MemoryConn, id, data string) {
+	t.Helper()
+
+	ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	sendChannelData(t, conn, reliableChannelName, reliableMessage+
+		utils.MarshalValues(id, utils.MarshalValues(ts, utils.MarshalValues("orders", data))))
+}
+
+func TestDedupAnonymousReconnect(t *testing.T) {
+	server := newTestServer(t)
+
+	received := make(chan string, 10)
+	connect := func(clientID string) *MemoryConn {
+		conn, s := connectTestSocketWith(t, server, clientInitData{ClientID: clientID})
+		s.Channel("orders").OnRead(func(data string) {
+			received <- data
+		})
+		return conn
+	}
+
+	conn := connect("tab")
+	sendReliableMessage(t, conn, "x-1", "1")
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+	conn.Close()
+
+	// The redelivery after the reconnect with the same client ID is discarded.
+	conn = connect("tab")
+	sendReliableMessage(t, conn, "x-1", "1")
+	sendReliableMessage(t, conn, "x-2", "2")
+
+	// Another client is not affected.
+	conn = connect("other")
+	sendReliableMessage(t, conn, "x-1", "3")
+
+	// The read handlers are called concurrently.
+	messages := map[string]bool{"1": true}
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-received:
+			messages[data] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected all messages, got %v", messages)
+		}
+	}
+	if !messages["1"] || !messages["2"] || !messages["3"] {
+		t.Fatalf("unexpected messages: %v", messages)
+	}
+
+	select {
+	case data := <-received:
+		t.Fatalf("unexpected message %s", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
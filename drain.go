@@ -0,0 +1,66 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The maximum duration to wait for the queued outgoing messages
+	// to be flushed during a drain.
+	drainFlushTimeout = 10 * time.Second
+)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// Drain stops dispatching incoming data to the channel read handlers,
+// flushes all queued outgoing messages and closes the socket afterwards.
+// Incoming channel data is discarded, while the keepalive and receipts
+// are still handled. Writes are allowed until the socket is closed.
+// Messages which are not flushed within 10 seconds are dropped.
+// Drain blocks until the socket is closed.
+func (s *Socket) Drain() {
+	// Stop dispatching incoming data.
+	func() {
+		// Lock the mutex.
+		s.drainMutex.Lock()
+		defer s.drainMutex.Unlock()
+
+		s.draining = true
+	}()
+
+	// Deliver the queued messages and close the socket.
+	s.CloseAfterFlush(drainFlushTimeout)
+}
+
+// IsDraining returns a boolean whenever the socket is draining.
+func (s *Socket) IsDraining() bool {
+	// Lock the mutex.
+	s.drainMutex.Lock()
+	defer s.drainMutex.Unlock()
+
+	return s.draining
+}
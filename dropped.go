@@ -0,0 +1,170 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/base64"
+	"runtime/debug"
+	"strings"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A DropReason describes why a message was dropped.
+type DropReason string
+
+const (
+	// DropReasonExpired is set if a write was dropped due to an exceeded TTL.
+	DropReasonExpired DropReason = "expired"
+
+	// DropReasonSocketClosed is set if a write was dropped, because the
+	// socket closed before the message was passed to the transport.
+	DropReasonSocketClosed DropReason = "socket_closed"
+
+	// DropReasonChannelNotFound is set if received data was dropped,
+	// because the channel does not exist on the server.
+	DropReasonChannelNotFound DropReason = "channel_not_found"
+
+	// DropReasonDraining is set if received data was dropped,
+	// because the socket is draining.
+	DropReasonDraining DropReason = "draining"
+
+	// DropReasonUserOffline is set if a message was written to a user
+	// without connected sockets and without the PushFallback option.
+	// It is only passed to the dead letter sink.
+	DropReasonUserOffline DropReason = "user_offline"
+)
+
+// DroppedMessageFunc is called with the socket, the channel name
+// and the data of a dropped message.
+type DroppedMessageFunc func(s *Socket, channel, data string, reason DropReason)
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// OnDroppedMessage sets the function which is called whenever glue drops
+// channel data, sent or received, so applications can count, log or persist
+// what was lost. Binary data is passed as raw string. The function is called
+// synchronously and must not block! Don't write to the socket within it.
+func (s *Server) OnDroppedMessage(f DroppedMessageFunc) {
+	// Lock the mutex.
+	s.onDroppedMutex.Lock()
+	defer s.onDroppedMutex.Unlock()
+
+	s.onDropped = f
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// getOnDropped returns the dropped message function or nil if not set.
+func (s *Server) getOnDropped() DroppedMessageFunc {
+	// Lock the mutex.
+	s.onDroppedMutex.Lock()
+	defer s.onDroppedMutex.Unlock()
+
+	return s.onDropped
+}
+
+// dropped passes the channel and data of the dropped raw frame to the
+// dropped message function. Frames without channel data are ignored.
+func (s *Socket) dropped(rawData string, reason DropReason) {
+	// Don't parse the frame if not required.
+	if s.server.getOnDropped() == nil && s.server.deadLetters == nil {
+		return
+	}
+
+	if name, data, ok := parseChannelFrame(rawData); ok {
+		s.droppedData(name, data, reason)
+	}
+}
+
+// droppedData passes the channel and data of a dropped message
+// to the dead letter queue and the dropped message function.
+func (s *Socket) droppedData(name, data string, reason DropReason) {
+	// Pass undeliverable messages to the dead letter queue.
+	s.deadLetter(name, data, reason)
+
+	f := s.server.getOnDropped()
+	if f == nil {
+		return
+	}
+
+	// Recover panics and log the error.
+	defer func() {
+		if e := recover(); e != nil {
+			log.L.Errorf("glue: panic while calling on dropped message function: %v\n%s", e, debug.Stack())
+		}
+	}()
+
+	f(s, name, data, reason)
+}
+
+// parseChannelFrame returns the channel name and the data of the raw
+// frame written to the write channel. Binary data is decoded. False is
+// returned if the frame does not contain channel data.
+func parseChannelFrame(rawData string) (name, data string, ok bool) {
+	// Remove the expiry header if present.
+	if strings.HasPrefix(rawData, global.ExpiryFrameMarker) {
+		rest := rawData[len(global.ExpiryFrameMarker):]
+		pos := strings.Index(rest, global.ExpiryFrameMarker)
+		if pos < 0 {
+			return "", "", false
+		}
+		rawData = rest[pos+len(global.ExpiryFrameMarker):]
+	}
+
+	// Remove the binary frame marker if present.
+	isBinaryFrame := strings.HasPrefix(rawData, global.BinaryFrameMarker)
+	if isBinaryFrame {
+		rawData = rawData[len(global.BinaryFrameMarker):]
+	}
+
+	if len(rawData) < cmdLen {
+		return "", "", false
+	}
+	cmd := rawData[:cmdLen]
+	if cmd != cmdChannelData && cmd != cmdChannelBinaryData {
+		return "", "", false
+	}
+
+	name, data, err := utils.UnmarshalValues(rawData[cmdLen:])
+	if err != nil {
+		return "", "", false
+	}
+
+	// Decode base64 encoded binary data.
+	if cmd == cmdChannelBinaryData && !isBinaryFrame {
+		b, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", "", false
+		}
+		data = string(b)
+	}
+
+	return name, data, true
+}
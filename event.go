@@ -0,0 +1,202 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/desertbit/glue/log"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// An EventType defines the type of a lifecycle event.
+type EventType int
+
+const (
+	// EventSocketConnected is emitted as soon as a new socket connection is established.
+	EventSocketConnected EventType = iota
+
+	// EventSocketInitialized is emitted after the socket initialization
+	// and the OnNewSocket function call.
+	EventSocketInitialized
+
+	// EventSocketClosed is emitted as soon as the socket is closed.
+	// The event reason holds the close reason.
+	EventSocketClosed
+
+	// EventProtocolError is emitted if invalid data is received from the client.
+	// The event error holds the protocol error.
+	EventProtocolError
+
+	// EventMessageDropped is emitted if a write is dropped due to an exceeded TTL.
+	// The event data holds the raw dropped message.
+	EventMessageDropped
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventSocketConnected:
+		return "SocketConnected"
+	case EventSocketInitialized:
+		return "SocketInitialized"
+	case EventSocketClosed:
+		return "SocketClosed"
+	case EventProtocolError:
+		return "ProtocolError"
+	case EventMessageDropped:
+		return "MessageDropped"
+	default:
+		return "Unknown"
+	}
+}
+
+// A CloseReason describes why a socket was closed.
+type CloseReason string
+
+const (
+	// CloseReasonServer is set if the socket is closed by the server.
+	CloseReasonServer CloseReason = "server"
+
+	// CloseReasonClient is set if the client requested to close the socket.
+	CloseReasonClient CloseReason = "client"
+
+	// CloseReasonPingTimeout is set if the client did not respond to a ping request.
+	CloseReasonPingTimeout CloseReason = "ping_timeout"
+
+	// CloseReasonInitFailed is set if the socket initialization failed,
+	// for example due to an unsupported protocol version or failed authentication.
+	CloseReasonInitFailed CloseReason = "init_failed"
+
+	// CloseReasonConnectionLost is set if the connection closed otherwise.
+	CloseReasonConnectionLost CloseReason = "connection_lost"
+
+	// CloseReasonDuplicateUser is set if the socket was rejected,
+	// because the user is already connected.
+	CloseReasonDuplicateUser CloseReason = "duplicate_user"
+
+	// CloseReasonLoggedInElsewhere is set if the socket was closed,
+	// because the user connected with a new socket.
+	CloseReasonLoggedInElsewhere CloseReason = "logged_in_elsewhere"
+
+	// CloseReasonIdleTimeout is set if no application data
+	// was exchanged within the idle timeout.
+	CloseReasonIdleTimeout CloseReason = "idle_timeout"
+
+	// CloseReasonSessionExpired is set if the client was forced
+	// to reconnect due to the maximum session duration.
+	CloseReasonSessionExpired CloseReason = "session_expired"
+)
+
+// An Event is a typed socket lifecycle event.
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Socket *Socket
+
+	// Reason is set for SocketClosed events.
+	Reason CloseReason
+
+	// Err is set for ProtocolError events.
+	Err error
+
+	// Data is set for MessageDropped events.
+	Data string
+}
+
+// OnEventFunc is an event function.
+type OnEventFunc func(e Event)
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// OnEvent sets the function which is triggered for all socket lifecycle events.
+// Use this single hook to build logging, metrics or alerting.
+// The event function is called synchronously and must not block!
+func (s *Server) OnEvent(f OnEventFunc) {
+	// Lock the mutex.
+	s.onEventMutex.Lock()
+	defer s.onEventMutex.Unlock()
+
+	s.onEvent = f
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// emitEvent calls the event function if set.
+func (s *Server) emitEvent(e Event) {
+	// Get the event function.
+	s.onEventMutex.Lock()
+	f := s.onEvent
+	s.onEventMutex.Unlock()
+
+	if f == nil {
+		return
+	}
+
+	e.Time = time.Now()
+
+	// Recover panics and log the error.
+	defer func() {
+		if e := recover(); e != nil {
+			log.L.Errorf("glue: panic while calling on event function: %v\n%s", e, debug.Stack())
+		}
+	}()
+
+	f(e)
+}
+
+// closeWithReason closes the socket. The first reason set is kept
+// and passed to the SocketClosed event.
+func (s *Socket) closeWithReason(reason CloseReason) {
+	s.setCloseReason(reason)
+	s.bs.Close()
+}
+
+// setCloseReason sets the close reason if not already set.
+func (s *Socket) setCloseReason(reason CloseReason) {
+	// Lock the mutex.
+	s.closeReasonMutex.Lock()
+	defer s.closeReasonMutex.Unlock()
+
+	if len(s.closeReason) == 0 {
+		s.closeReason = reason
+	}
+}
+
+// getCloseReason returns the close reason. If the socket was not
+// closed with a reason, then the connection was lost.
+func (s *Socket) getCloseReason() CloseReason {
+	// Lock the mutex.
+	s.closeReasonMutex.Lock()
+	defer s.closeReasonMutex.Unlock()
+
+	if len(s.closeReason) == 0 {
+		return CloseReasonConnectionLost
+	}
+
+	return s.closeReason
+}
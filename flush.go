@@ -0,0 +1,164 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// Flush blocks until all previously written messages are passed to the
+// transport, so a following Close doesn't drop them. Websocket messages
+// are written to the connection and ajax messages are sent with poll
+// responses. Messages of logical sockets are passed to their carrier socket.
+// ErrFlushTimeout is returned if the messages are not flushed within the
+// timeout and ErrSocketClosed if the socket closes before.
+func (s *Socket) Flush(timeout time.Duration) error {
+	// The abort channel is closed after the timeout.
+	abort := make(chan struct{})
+	timer := time.AfterFunc(timeout, func() { close(abort) })
+	defer timer.Stop()
+
+	if s.scheduler == nil {
+		// Queue the flush frame after all previous messages.
+		return s.flush(abort, func(frame string) bool {
+			// Lock the mutex.
+			s.writeMutex.Lock()
+			defer s.writeMutex.Unlock()
+
+			select {
+			case s.writeChan <- frame:
+				return true
+			case <-s.isClosedChan:
+			case <-abort:
+			}
+			return false
+		})
+	}
+
+	// The queues of the fair scheduling are passed independently
+	// to the transport. Flush each queue.
+	for _, name := range s.scheduler.names() {
+		err := s.flush(abort, func(frame string) bool {
+			return s.scheduler.push(name, []string{frame}, nil, abort)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CloseAfterFlush keeps the connection up to the timeout while the remaining
+// queued messages are delivered and closes the socket afterwards.
+// The close command is sent after the flush and the client closes the
+// connection as soon as it handled all previous messages. The socket
+// is closed forcefully if this doesn't happen within the timeout.
+// CloseAfterFlush blocks until the socket is closed.
+func (s *Socket) CloseAfterFlush(timeout time.Duration) {
+	// The socket is closed by the server, even if the client closes the connection.
+	s.setCloseReason(CloseReasonServer)
+
+	s.closeAfterFlush(timeout, cmdClose)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// closeAfterFlush flushes the socket, sends the command, which tells the
+// client to close the connection, and waits until the client closes it.
+// The socket is closed forcefully after the timeout.
+func (s *Socket) closeAfterFlush(timeout time.Duration, cmd string) {
+	deadline := time.Now().Add(timeout)
+
+	if err := s.Flush(timeout); err == nil {
+		// Tell the client to close the connection.
+		s.write(cmd)
+
+		// Wait for the client to close the connection.
+		timer := time.NewTimer(deadline.Sub(time.Now()))
+		select {
+		case <-s.isClosedChan:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+
+	s.Close()
+}
+
+// flush queues a flush frame with the queue function and waits until the
+// backend socket reaches the frame. The frame is not counted as written message.
+func (s *Socket) flush(abort <-chan struct{}, queue func(frame string) bool) error {
+	// Create a new flush ID.
+	s.flushMutex.Lock()
+	s.flushID++
+	id := strconv.FormatUint(s.flushID, 10)
+	done := make(chan struct{})
+	s.flushes[id] = done
+	s.flushMutex.Unlock()
+
+	// Remove the pending flush again.
+	defer func() {
+		// Lock the mutex.
+		s.flushMutex.Lock()
+		defer s.flushMutex.Unlock()
+
+		delete(s.flushes, id)
+	}()
+
+	if !queue(global.FlushFrame(id)) {
+		if s.IsClosed() {
+			return ErrSocketClosed
+		}
+		return ErrFlushTimeout
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-s.isClosedChan:
+		return ErrSocketClosed
+	case <-abort:
+		return ErrFlushTimeout
+	}
+}
+
+// onFlushed is called by the backend socket as soon as the flush frame is reached.
+func (s *Socket) onFlushed(id string) {
+	// Lock the mutex.
+	s.flushMutex.Lock()
+	defer s.flushMutex.Unlock()
+
+	done, ok := s.flushes[id]
+	if !ok {
+		return
+	}
+
+	delete(s.flushes, id)
+	close(done)
+}
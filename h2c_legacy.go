@@ -0,0 +1,33 @@
+//go:build !go1.24
+
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"net/http"
+
+	"github.com/desertbit/glue/log"
+)
+
+// enableH2C is not supported before Go 1.24, because the
+// HTTP server protocols were added with this release.
+func enableH2C(hs *http.Server) {
+	log.L.Warningf("glue: h2c requires Go 1.24 or later: serving HTTP/1.1 only")
+}
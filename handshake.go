@@ -0,0 +1,184 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+// The rejection codes sent to the client.
+const (
+	// RejectCodeHandshake is the rejection code of errors
+	// returned by the OnHandshake function.
+	RejectCodeHandshake = "handshake_rejected"
+
+	// RejectCodeVersion is sent if the client protocol version is not supported.
+	RejectCodeVersion = "unsupported_version"
+
+	// RejectCodeNamespace is sent if the requested namespace does not exist.
+	RejectCodeNamespace = "unknown_namespace"
+
+	// RejectCodeAuth is the rejection code of errors
+	// returned by the namespace authentication function.
+	RejectCodeAuth = "auth_failed"
+
+	// RejectCodeServerFull is sent if the maximum number of connections is reached.
+	// The client keeps reconnecting.
+	RejectCodeServerFull = "server_full"
+
+	// RejectCodeMaintenance is sent during the maintenance mode with the maintenance message.
+	// The client keeps reconnecting.
+	RejectCodeMaintenance = "maintenance"
+
+	// RejectCodeDuplicateUser is sent if the user is already connected
+	// and the DuplicateUserRejectNew policy is set.
+	RejectCodeDuplicateUser = "duplicate_user"
+
+	// RejectCodeLoggedInElsewhere is sent to the existing sockets of a user if the
+	// user connects again and the DuplicateUserCloseOldest policy is set.
+	RejectCodeLoggedInElsewhere = "logged_in_elsewhere"
+
+	// RejectCodeIdleTimeout is sent if the socket is closed by the IdleTimeout option.
+	RejectCodeIdleTimeout = "idle_timeout"
+
+	// RejectCodeTicket is sent if the connect ticket is invalid, expired or
+	// already used and if the ticket is missing, but required.
+	RejectCodeTicket = "invalid_ticket"
+)
+
+const (
+	// The maximum time to wait until a rejection is passed to the
+	// transport before the socket is closed.
+	rejectFlushTimeout = time.Second
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// HandshakeFunc validates the handshake payload passed by the client handshake option.
+// A returned error rejects the connection. Return a RejectError to pass a
+// custom rejection code to the client.
+type HandshakeFunc func(s *Socket, payload string) error
+
+// HandshakeResponseFunc is called before the websocket upgrade and ajax
+// init responses are written. Set custom headers and cookies, for example a
+// session cookie or security headers, on the response writer. Don't write
+// a body or status code.
+type HandshakeResponseFunc func(w http.ResponseWriter, r *http.Request)
+
+// A RejectError rejects a connection during the socket initialization.
+// The code and message are sent to the client and the client does
+// not reconnect automatically, unless Retry is set.
+type RejectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Retry   bool   `json:"retry,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *RejectError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// rejectCodes maps the errors with dedicated rejection codes.
+var rejectCodes = map[error]string{
+	ErrDuplicateUser: RejectCodeDuplicateUser,
+}
+
+// newRejectError converts the error to a rejection with the code.
+// Rejection errors are returned as they are and
+// errors with a dedicated rejection code keep their code.
+func newRejectError(code string, err error) *RejectError {
+	if r, ok := err.(*RejectError); ok {
+		return r
+	}
+
+	if c, ok := rejectCodes[err]; ok {
+		code = c
+	}
+
+	return &RejectError{
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
+// handshake calls the OnHandshake function if set.
+func (s *Socket) handshake(payload string) error {
+	f := s.server.options.OnHandshake
+	if f == nil {
+		return nil
+	}
+
+	if err := f(s, payload); err != nil {
+		return newRejectError(RejectCodeHandshake, err)
+	}
+
+	return nil
+}
+
+// Reject sends the rejection to the client and closes the socket.
+// The client does not reconnect automatically, unless Retry is set.
+// Reject blocks until the rejection is sent.
+func (s *Socket) Reject(r *RejectError) {
+	s.rejectAndClose(r, CloseReasonServer)
+}
+
+// rejectAndClose sends the rejection to the client and closes the socket.
+// Clients without rejection support are only told to not reconnect.
+// Only the first rejection is sent.
+func (s *Socket) rejectAndClose(r *RejectError, reason CloseReason) {
+	s.rejectOnce.Do(func() {
+		if s.rejectSupported() {
+			s.reject(r)
+		} else if !r.Retry {
+			// Tell the client to not automatically reconnect.
+			s.write(cmdDontAutoReconnect)
+
+			// Be sure that the previous socket command gets send to the client.
+			s.Flush(rejectFlushTimeout)
+		}
+
+		s.closeWithReason(reason)
+	})
+}
+
+// reject sends the rejection to the client.
+func (s *Socket) reject(r *RejectError) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	s.write(cmdReject + string(data))
+
+	// Be sure that the rejection gets send to the client.
+	s.Flush(rejectFlushTimeout)
+}
@@ -0,0 +1,153 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultHandshakeRateInterval = time.Minute
+	defaultHandshakeBanDuration  = 5 * time.Minute
+)
+
+//##############################//
+//### Handshake Limiter Type ###//
+//##############################//
+
+// A handshakeLimiter counts the handshake requests of each remote address
+// within fixed intervals and bans addresses exceeding the limit.
+type handshakeLimiter struct {
+	limit       int
+	interval    time.Duration
+	banDuration time.Duration
+	onBanned    func(remoteAddr string)
+
+	entries     map[string]*handshakeEntry
+	lastCleanup time.Time
+	mutex       sync.Mutex
+}
+
+type handshakeEntry struct {
+	count       int       // The handshakes of the current interval.
+	start       time.Time // The start of the current interval.
+	bannedUntil time.Time // The end of the ban if banned.
+}
+
+func newHandshakeLimiter(o *Options) *handshakeLimiter {
+	return &handshakeLimiter{
+		limit:       o.HandshakeRateLimit,
+		interval:    o.HandshakeRateInterval,
+		banDuration: o.HandshakeBanDuration,
+		onBanned:    o.OnHandshakeBanned,
+		entries:     make(map[string]*handshakeEntry),
+		lastCleanup: time.Now(),
+	}
+}
+
+// allow counts the handshake request of the remote address and
+// returns false if the address exceeded the limit or is banned.
+func (l *handshakeLimiter) allow(remoteAddr string, r *http.Request) bool {
+	return l.allowAddr(remoteAddr, r.Header.Get("User-Agent"))
+}
+
+// allowAddr counts a handshake of the remote address. This is also
+// called for the logical sockets of carriers, which are not created
+// by an HTTP request.
+func (l *handshakeLimiter) allowAddr(remoteAddr, userAgent string) bool {
+	banned := false
+
+	allowed := func() bool {
+		// Lock the mutex.
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+
+		now := time.Now()
+		l.cleanup(now)
+
+		e, ok := l.entries[remoteAddr]
+		if !ok {
+			e = &handshakeEntry{start: now}
+			l.entries[remoteAddr] = e
+		}
+
+		// Reject the request during the ban.
+		if now.Before(e.bannedUntil) {
+			return false
+		}
+
+		// Start a new interval if the current one elapsed.
+		if now.Sub(e.start) >= l.interval {
+			e.count = 0
+			e.start = now
+		}
+
+		e.count++
+		if e.count <= l.limit {
+			return true
+		}
+
+		// Ban the remote address. A new interval starts after the ban.
+		e.bannedUntil = now.Add(l.banDuration)
+		e.start = e.bannedUntil
+		e.count = 0
+		banned = true
+
+		return false
+	}()
+
+	if banned {
+		log.L.WithFields(logrus.Fields{
+			"remoteAddress": remoteAddr,
+			"userAgent":     userAgent,
+			"duration":      l.banDuration,
+		}).Warningf("glue: handshake rate limit exceeded: banning remote address")
+
+		if l.onBanned != nil {
+			l.onBanned(remoteAddr)
+		}
+	}
+
+	return allowed
+}
+
+// cleanup removes the entries of the remote addresses which are neither
+// banned nor made a request within the last interval. The entries are
+// checked at most once per interval. The mutex must be locked.
+func (l *handshakeLimiter) cleanup(now time.Time) {
+	if now.Sub(l.lastCleanup) < l.interval {
+		return
+	}
+	l.lastCleanup = now
+
+	for addr, e := range l.entries {
+		if now.Sub(e.start) >= l.interval && !now.Before(e.bannedUntil) {
+			delete(l.entries, addr)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestHandshakeLimiter creates a limiter recording the banned addresses.
+func newTestHandshakeLimiter(limit int, interval, banDuration time.Duration) (*handshakeLimiter, func() []string) {
+	var (
+		banned []string
+		mutex  sync.Mutex
+	)
+
+	l := newHandshakeLimiter(&Options{
+		HandshakeRateLimit:    limit,
+		HandshakeRateInterval: interval,
+		HandshakeBanDuration:  banDuration,
+		OnHandshakeBanned: func(remoteAddr string) {
+			mutex.Lock()
+			banned = append(banned, remoteAddr)
+			mutex.Unlock()
+		},
+	})
+
+	return l, func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), banned...)
+	}
+}
+
+func TestHandshakeLimit(t *testing.T) {
+	l, banned := newTestHandshakeLimiter(3, time.Hour, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if !l.allowAddr("1.1.1.1", "test") {
+			t.Fatalf("handshake %d rejected", i)
+		}
+	}
+
+	// The other addresses are counted on their own.
+	if !l.allowAddr("2.2.2.2", "test") {
+		t.Fatal("other address rejected")
+	}
+
+	// Exceeding the limit bans the address once.
+	for i := 0; i < 3; i++ {
+		if l.allowAddr("1.1.1.1", "test") {
+			t.Fatal("banned address allowed")
+		}
+	}
+	if b := banned(); len(b) != 1 || b[0] != "1.1.1.1" {
+		t.Fatalf("unexpected banned addresses: %v", b)
+	}
+	if !l.allowAddr("2.2.2.2", "test") {
+		t.Fatal("other address rejected")
+	}
+}
+
+func TestHandshakeLimitWindowReset(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	l, banned := newTestHandshakeLimiter(2, interval, time.Hour)
+
+	// The count is reset with each new interval.
+	for i := 0; i < 3; i++ {
+		if !l.allowAddr("1.1.1.1", "test") || !l.allowAddr("1.1.1.1", "test") {
+			t.Fatalf("interval %d: handshake rejected", i)
+		}
+		time.Sleep(interval)
+	}
+
+	if b := banned(); len(b) != 0 {
+		t.Fatalf("unexpected banned addresses: %v", b)
+	}
+}
+
+func TestHandshakeLimitBanExpiry(t *testing.T) {
+	const banDuration = 50 * time.Millisecond
+	l, _ := newTestHandshakeLimiter(1, time.Hour, banDuration)
+
+	if !l.allowAddr("1.1.1.1", "test") {
+		t.Fatal("handshake rejected")
+	}
+	if l.allowAddr("1.1.1.1", "test") {
+		t.Fatal("handshake exceeding the limit allowed")
+	}
+
+	// A new interval starts after the ban.
+	time.Sleep(banDuration)
+	if !l.allowAddr("1.1.1.1", "test") {
+		t.Fatal("handshake rejected after the ban")
+	}
+	if l.allowAddr("1.1.1.1", "test") {
+		t.Fatal("handshake exceeding the limit allowed after the ban")
+	}
+}
+
+func TestHandshakeLimitCleanup(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	l, _ := newTestHandshakeLimiter(1, interval, time.Hour)
+
+	l.allowAddr("1.1.1.1", "test")
+	l.allowAddr("2.2.2.2", "test")
+	l.allowAddr("2.2.2.2", "test")
+
+	// The idle address is removed, the banned one is kept.
+	time.Sleep(2 * interval)
+	l.allowAddr("3.3.3.3", "test")
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, ok := l.entries["1.1.1.1"]; ok {
+		t.Fatal("idle entry not removed")
+	}
+	if _, ok := l.entries["2.2.2.2"]; !ok {
+		t.Fatal("banned entry removed")
+	}
+}
+
+func TestHandshakeLimitRequests(t *testing.T) {
+	server := newTestServer(t, Options{
+		HandshakeRateLimit:    1,
+		HandshakeRateInterval: time.Hour,
+		HandshakeBanDuration:  time.Hour,
+	})
+
+	// handshake sends a websocket handshake without the upgrade headers.
+	// Allowed handshakes fail the upgrade with status 400.
+	handshake := func(remoteAddr string, header map[string]string) int {
+		r := httptest.NewRequest("GET", "/glue/ws", nil)
+		r.RemoteAddr = remoteAddr
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     map[string]string
+		want       int
+	}{
+		{"first request", "10.0.0.1:1234", nil, http.StatusBadRequest},
+		{"other port", "10.0.0.1:4321", nil, http.StatusTooManyRequests},
+		{"other address", "10.0.0.2:1234", nil, http.StatusBadRequest},
+
+		// The proxy headers take precedence over the request address.
+		{"forwarded for", "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, http.StatusBadRequest},
+		{"forwarded for banned", "10.0.0.3:1234", map[string]string{"X-Forwarded-For": "1.1.1.1"}, http.StatusTooManyRequests},
+		{"forwarded for list", "10.0.0.3:1234", map[string]string{"X-Forwarded-For": " 2.2.2.2 , 1.1.1.1"}, http.StatusBadRequest},
+		{"forwarded for list banned", "10.0.0.3:1234", map[string]string{"X-Forwarded-For": "2.2.2.2"}, http.StatusTooManyRequests},
+		{"real ip", "10.0.0.1:1234", map[string]string{"X-Real-Ip": "3.3.3.3"}, http.StatusBadRequest},
+		{"real ip banned", "10.0.0.4:1234", map[string]string{"X-Real-Ip": " 3.3.3.3 "}, http.StatusTooManyRequests},
+		{"forwarded for before real ip", "10.0.0.4:1234", map[string]string{"X-Forwarded-For": "4.4.4.4", "X-Real-Ip": "3.3.3.3"}, http.StatusBadRequest},
+		{"empty forwarded for", "10.0.0.5:1234", map[string]string{"X-Forwarded-For": " ", "X-Real-Ip": "5.5.5.5"}, http.StatusBadRequest},
+		{"empty forwarded for banned", "10.0.0.6:1234", map[string]string{"X-Real-Ip": "5.5.5.5"}, http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		if code := handshake(test.remoteAddr, test.header); code != test.want {
+			t.Errorf("%s: unexpected status code: %d != %d", test.name, code, test.want)
+		}
+	}
+}
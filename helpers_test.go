@@ -0,0 +1,172 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+// newTestServer creates a server which is released with the end of the test.
+func newTestServer(t *testing.T, o ...Options) *Server {
+	t.Helper()
+
+	s, err := NewServerWithError(o...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Release)
+
+	return s
+}
+
+// connectTestSocket connects an initialized in-memory socket to the server.
+func connectTestSocket(t *testing.T, server *Server) (*MemoryConn, *Socket) {
+	t.Helper()
+
+	return connectTestSocketWith(t, server, clientInitData{})
+}
+
+// connectTestSocketWith connects an in-memory socket with the
+// client init data and waits for the server init reply.
+func connectTestSocketWith(t *testing.T, server *Server, data clientInitData) (*MemoryConn, *Socket) {
+	t.Helper()
+
+	if data.Version == "" {
+		data.Version = Version
+	}
+	dataJSON, err := json.Marshal(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := server.ConnectMemory("127.0.0.1", "test")
+	t.Cleanup(func() { conn.Close() })
+
+	if err = conn.Send(cmdInit + string(dataJSON)); err != nil {
+		t.Fatal(err)
+	}
+	frame := receiveFrame(t, conn, cmdInit)
+	if !strings.HasPrefix(frame, "{") {
+		t.Fatalf("unexpected init reply: %q", frame)
+	}
+
+	return conn, conn.socket
+}
+
+// receiveFrame returns the data of the next frame with the command.
+// Frames with other commands are skipped.
+func receiveFrame(t *testing.T, conn *MemoryConn, cmd string) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		frame, err := conn.Receive(time.Until(deadline))
+		if err != nil {
+			t.Fatalf("receive %q frame: %v", cmd, err)
+		}
+		if strings.HasPrefix(frame, cmd) {
+			return frame[len(cmd):]
+		}
+	}
+}
+
+// receiveChannelData returns the next channel data frame.
+func receiveChannelData(t *testing.T, conn *MemoryConn) (name, data string) {
+	t.Helper()
+
+	name, data, err := utils.UnmarshalValues(receiveFrame(t, conn, cmdChannelData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return name, data
+}
+
+// sendChannelData passes the channel data to the server.
+func sendChannelData(t *testing.T, conn *MemoryConn, name, data string) {
+	t.Helper()
+
+	if err := conn.Send(cmdChannelData + utils.MarshalValues(name, data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor polls the condition until it is true or the timeout exceeds.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within the timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// recordCloseReasons records the close reasons of the server sockets.
+// The returned function waits for the close reason of the socket.
+func recordCloseReasons(t *testing.T, server *Server) func(s *Socket) CloseReason {
+	var (
+		reasons = make(map[*Socket]CloseReason)
+		mutex   sync.Mutex
+	)
+
+	server.OnEvent(func(e Event) {
+		if e.Type == EventSocketClosed {
+			mutex.Lock()
+			reasons[e.Socket] = e.Reason
+			mutex.Unlock()
+		}
+	})
+
+	return func(s *Socket) CloseReason {
+		t.Helper()
+
+		var reason CloseReason
+		waitFor(t, 5*time.Second, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			var ok bool
+			reason, ok = reasons[s]
+			return ok
+		})
+
+		return reason
+	}
+}
+
+// receiveReject returns the rejection sent to the client.
+func receiveReject(t *testing.T, conn *MemoryConn) RejectError {
+	t.Helper()
+
+	var r RejectError
+	if err := json.Unmarshal([]byte(receiveFrame(t, conn, cmdReject)), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
@@ -0,0 +1,106 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strconv"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The default duration before the idle timeout when the warning is sent.
+	defaultIdleWarning = time.Minute
+)
+
+//###############//
+//### Private ###//
+//###############//
+
+// touch marks application data activity for the idle timeout.
+func (s *Socket) touch() {
+	if s.server.options.IdleTimeout <= 0 {
+		return
+	}
+
+	// Lock the mutex.
+	s.idleMutex.Lock()
+	defer s.idleMutex.Unlock()
+
+	s.lastActivity = time.Now()
+}
+
+// idleDuration returns the duration since the last application data activity.
+func (s *Socket) idleDuration() time.Duration {
+	// Lock the mutex.
+	s.idleMutex.Lock()
+	defer s.idleMutex.Unlock()
+
+	return time.Since(s.lastActivity)
+}
+
+// idleLoop closes the socket if no application data was exchanged
+// within the idle timeout. The client is warned before.
+func (s *Socket) idleLoop() {
+	timeout := s.server.options.IdleTimeout
+	warning := s.server.options.IdleWarning
+
+	timer := time.NewTimer(timeout - warning)
+	defer timer.Stop()
+
+	warned := false
+
+	for {
+		select {
+		case <-s.isClosedChan:
+			return
+		case <-timer.C:
+		}
+
+		idle := s.idleDuration()
+
+		// Close the socket if the timeout is reached.
+		// The client should not reconnect automatically.
+		if idle >= timeout {
+			s.rejectAndClose(&RejectError{
+				Code:    RejectCodeIdleTimeout,
+				Message: "no activity within " + timeout.String(),
+			}, CloseReasonIdleTimeout)
+			return
+		}
+
+		// Warn the client once with the milliseconds until the socket is closed.
+		if idle >= timeout-warning {
+			if !warned {
+				warned = true
+				s.write(cmdIdleWarning + strconv.FormatInt(int64((timeout-idle)/time.Millisecond), 10))
+			}
+
+			timer.Reset(timeout - idle)
+			continue
+		}
+
+		// There was activity in between.
+		warned = false
+		timer.Reset(timeout - warning - idle)
+	}
+}
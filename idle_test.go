@@ -0,0 +1,86 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	server := newTestServer(t, Options{
+		IdleTimeout: 200 * time.Millisecond,
+		IdleWarning: 100 * time.Millisecond,
+	})
+	closeReason := recordCloseReasons(t, server)
+
+	conn, s := connectTestSocketWith(t, server, clientInitData{Reject: true})
+	start := time.Now()
+
+	// The warning passes the milliseconds until the socket is closed.
+	ms, err := strconv.Atoi(receiveFrame(t, conn, cmdIdleWarning))
+	if err != nil {
+		t.Fatal(err)
+	} else if ms <= 0 || ms > 100 {
+		t.Fatalf("unexpected idle warning: %d", ms)
+	}
+
+	if r := receiveReject(t, conn); r.Code != RejectCodeIdleTimeout || r.Retry {
+		t.Fatalf("unexpected rejection: %+v", r)
+	}
+	if d := time.Since(start); d < 200*time.Millisecond {
+		t.Fatalf("socket closed too early: %v", d)
+	}
+	if reason := closeReason(s); reason != CloseReasonIdleTimeout {
+		t.Fatalf("unexpected close reason: %v", reason)
+	}
+}
+
+func TestIdleTimeoutActivity(t *testing.T) {
+	server := newTestServer(t, Options{
+		IdleTimeout: 200 * time.Millisecond,
+		IdleWarning: 100 * time.Millisecond,
+	})
+
+	conn, s := connectTestSocket(t, server)
+	s.OnRead(func(data string) {})
+
+	// The application data keeps the socket open.
+	for i := 0; i < 10; i++ {
+		sendChannelData(t, conn, mainChannelName, "ping")
+		time.Sleep(50 * time.Millisecond)
+	}
+	if s.IsClosed() {
+		t.Fatal("active socket closed")
+	}
+
+	// The socket is closed as soon as the activity stops.
+	waitFor(t, time.Second, s.IsClosed)
+}
+
+func TestIdleTimeoutDisabled(t *testing.T) {
+	server := newTestServer(t)
+	_, s := connectTestSocket(t, server)
+
+	time.Sleep(100 * time.Millisecond)
+	if s.IsClosed() {
+		t.Fatal("socket closed without the idle timeout")
+	}
+}
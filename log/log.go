@@ -19,15 +19,33 @@
 // Package log holds the log backend used by the socket library.
 // Use the logrus L value to adapt the log formatting
 // or log levels if required...
+// The subsystem loggers write with the output, the formatter and the hooks
+// of L, but have their own log levels. Their entries carry the subsystem field.
 package log
 
 import (
+	"fmt"
+
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// LevelSilent is the level name which disables logging.
+	LevelSilent = "silent"
+)
+
 var (
 	// L is the public logrus value used internally by glue.
 	L = logrus.New()
+
+	// Backend is used by the backend socket transports (websocket and ajax).
+	Backend = newLogger("backend")
+
+	// Protocol is used by the glue protocol layer.
+	Protocol = newLogger("protocol")
+
+	// Keepalive is used by the ping-pong keepalive mechanism.
+	Keepalive = newLogger("keepalive")
 )
 
 func init() {
@@ -35,3 +53,86 @@ func init() {
 	L.Formatter = new(logrus.TextFormatter)
 	L.Level = logrus.DebugLevel
 }
+
+// SetLevel sets the level of the logger by its name: "debug", "info",
+// "warning", "error" or "silent" to disable the logger.
+func SetLevel(l *logrus.Logger, level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	l.Level = lvl
+	return nil
+}
+
+// ParseLevel parses the level name accepted by SetLevel.
+func ParseLevel(level string) (logrus.Level, error) {
+	// Only panics are logged in silent mode.
+	// Glue never logs with the panic level.
+	if level == LevelSilent {
+		return logrus.PanicLevel, nil
+	}
+
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return lvl, fmt.Errorf("invalid log level: %v", err)
+	}
+
+	return lvl, nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+func newLogger(subsystem string) *logrus.Logger {
+	l := logrus.New()
+	l.Out = output{}
+	l.Formatter = formatter{}
+	l.Level = logrus.DebugLevel
+	l.AddHook(hook{subsystem: subsystem})
+	return l
+}
+
+// output forwards the subsystem logs to the output of L.
+type output struct{}
+
+func (output) Write(p []byte) (int, error) {
+	return L.Out.Write(p)
+}
+
+// formatter formats the subsystem logs with the formatter of L.
+// Entries above the level of L are dropped, so the level of L
+// limits all subsystem loggers.
+type formatter struct{}
+
+func (formatter) Format(e *logrus.Entry) ([]byte, error) {
+	if e.Level > L.Level {
+		return nil, nil
+	}
+
+	return L.Formatter.Format(e)
+}
+
+// hook sets the subsystem field of the subsystem logs and fires the hooks
+// of L. The hooks of L are looked up with each entry, so hooks added later
+// are fired too. Entries above the level of L are skipped like by formatter.
+type hook struct {
+	subsystem string
+}
+
+func (hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h hook) Fire(e *logrus.Entry) error {
+	// The entry data is a copy for each log call.
+	e.Data["subsystem"] = h.subsystem
+
+	if e.Level > L.Level {
+		return nil
+	}
+
+	return L.Hooks.Fire(e.Level, e)
+}
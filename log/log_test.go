@@ -0,0 +1,68 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package log
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testHook records the fired entries.
+type testHook struct {
+	entries []*logrus.Entry
+}
+
+func (h *testHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *testHook) Fire(e *logrus.Entry) error {
+	h.entries = append(h.entries, e)
+	return nil
+}
+
+func TestSubsystemHooks(t *testing.T) {
+	out, level, hooks := L.Out, L.Level, L.Hooks
+	defer func() {
+		L.Out, L.Level = out, level
+		L.ReplaceHooks(hooks)
+	}()
+
+	L.Out = ioutil.Discard
+	L.Level = logrus.InfoLevel
+	L.ReplaceHooks(make(logrus.LevelHooks))
+
+	// The hook is added after the subsystem loggers were created.
+	h := &testHook{}
+	L.AddHook(h)
+
+	Backend.Warning("backend warning")
+	Keepalive.Debug("dropped by the level of L")
+
+	if len(h.entries) != 1 {
+		t.Fatalf("hook fired %d times", len(h.entries))
+	}
+
+	e := h.entries[0]
+	if e.Message != "backend warning" || e.Data["subsystem"] != "backend" {
+		t.Fatalf("unexpected entry: %s %v", e.Message, e.Data)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used to notify the clients
+	// about maintenance mode changes.
+	maintenanceChannelName = "_maintenance"
+)
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// SetMaintenance enables the maintenance mode with the message.
+// New connections are rejected with the maintenance code and the message,
+// while existing sessions are kept alive. The clients keep reconnecting
+// until the maintenance mode is disabled by passing an empty message.
+// Connected clients are notified if the NotifyMaintenance option is set.
+func (s *Server) SetMaintenance(msg string) {
+	// Set the message.
+	changed := func() bool {
+		// Lock the mutex.
+		s.maintenanceMutex.Lock()
+		defer s.maintenanceMutex.Unlock()
+
+		if s.maintenance == msg {
+			return false
+		}
+
+		s.maintenance = msg
+		return true
+	}()
+
+	if !changed || !s.options.NotifyMaintenance {
+		return
+	}
+
+	// Notify all connected clients.
+	data := cmdChannelData + utils.MarshalValues(maintenanceChannelName, msg)
+	for _, socket := range s.Sockets() {
+		if socket.IsClosed() {
+			continue
+		}
+
+		socket.write(data)
+	}
+}
+
+// Maintenance returns the maintenance message.
+// An empty string is returned if the maintenance mode is disabled.
+func (s *Server) Maintenance() string {
+	// Lock the mutex.
+	s.maintenanceMutex.Lock()
+	defer s.maintenanceMutex.Unlock()
+
+	return s.maintenance
+}
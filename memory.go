@@ -0,0 +1,293 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/sockets/memsocket"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The buffer size of the incoming messages of each memory cluster node.
+	memoryClusterInboxSize = 1024
+)
+
+//#########################//
+//### Memory Connection ###//
+//#########################//
+
+// A MemoryConn is the client side of an in-memory socket connection.
+// It exchanges raw protocol frames with the server without any network
+// transport and is intended for tests and for replaying recordings.
+type MemoryConn struct {
+	ms     *memsocket.Socket
+	socket *Socket // The server socket. Nil if the server blocked the connection.
+}
+
+// ConnectMemory creates a new in-memory socket connection to the server.
+// The connection has to be initialized by sending the init command first,
+// like a regular client does. The optional network simulates the bandwidth,
+// latency and loss rate of the connection, for example memsocket.Network3G.
+func (s *Server) ConnectMemory(remoteAddr, userAgent string, network ...memsocket.Network) *MemoryConn {
+	c := &MemoryConn{
+		ms: memsocket.NewSocket(remoteAddr, userAgent, network...),
+	}
+
+	// Close the socket if incomming connections should be blocked.
+	if s.IsBlocked() {
+		c.ms.Close()
+		return c
+	}
+
+	// Create a new socket value.
+	// The goroutines are started automatically.
+	c.socket = newSocket(s, c.ms)
+
+	return c
+}
+
+// Send passes a raw protocol frame to the server.
+// ErrSocketClosed is returned if the connection is closed.
+func (c *MemoryConn) Send(frame string) error {
+	if err := c.ms.Send(frame); err != nil {
+		return ErrSocketClosed
+	}
+
+	return nil
+}
+
+// Receive returns the next raw protocol frame sent by the server.
+// ErrSocketClosed is returned if the connection is closed and
+// ErrReadTimeout if no frame is received within the timeout.
+func (c *MemoryConn) Receive(timeout time.Duration) (string, error) {
+	frame, err := c.ms.Receive(timeout)
+	if err == memsocket.ErrTimeout {
+		return "", ErrReadTimeout
+	} else if err != nil {
+		return "", ErrSocketClosed
+	}
+
+	return frame, nil
+}
+
+// Close closes the connection.
+func (c *MemoryConn) Close() error {
+	c.ms.Close()
+	return nil
+}
+
+// IsClosed returns a boolean indicating if the connection is closed.
+func (c *MemoryConn) IsClosed() bool {
+	return c.ms.IsClosed()
+}
+
+//######################//
+//### Memory Cluster ###//
+//######################//
+
+// A MemoryCluster connects the glue servers of one process.
+// It is intended for testing the cluster mode without a network.
+type MemoryCluster struct {
+	nodes map[string]*memoryNode
+	mutex sync.Mutex
+}
+
+// NewMemoryCluster creates a new in-memory cluster.
+func NewMemoryCluster() *MemoryCluster {
+	return &MemoryCluster{
+		nodes: make(map[string]*memoryNode),
+	}
+}
+
+// Join adds a new node to the cluster and returns its adapter.
+// Pass the adapter to the Cluster option of the node server.
+func (c *MemoryCluster) Join(id string) ClusterAdapter {
+	n := &memoryNode{
+		id:      id,
+		cluster: c,
+		inbox:   make(chan memoryMessage, memoryClusterInboxSize),
+		closed:  make(chan struct{}),
+	}
+
+	func() {
+		// Lock the mutex.
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		if prev, ok := c.nodes[id]; ok {
+			close(prev.closed)
+		}
+		c.nodes[id] = n
+	}()
+
+	c.nodesChanged(id)
+
+	return n
+}
+
+// Leave removes the node from the cluster, like a crashed node.
+func (c *MemoryCluster) Leave(id string) {
+	ok := func() bool {
+		// Lock the mutex.
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+
+		n, ok := c.nodes[id]
+		if ok {
+			close(n.closed)
+			delete(c.nodes, id)
+		}
+
+		return ok
+	}()
+
+	if ok {
+		c.nodesChanged(id)
+	}
+}
+
+// nodesChanged notifies all nodes except the changed node.
+func (c *MemoryCluster) nodesChanged(changed string) {
+	// Lock the mutex.
+	c.mutex.Lock()
+	nodes := make([]*memoryNode, 0, len(c.nodes))
+	for _, n := range c.nodes {
+		if n.id != changed {
+			nodes = append(nodes, n)
+		}
+	}
+	c.mutex.Unlock()
+
+	// Pass the notification in order with the messages.
+	for _, n := range nodes {
+		n.push(memoryMessage{nodesChanged: true})
+	}
+}
+
+type memoryMessage struct {
+	from         string
+	m            *ClusterMessage
+	nodesChanged bool
+}
+
+type memoryNode struct {
+	id      string
+	cluster *MemoryCluster
+	inbox   chan memoryMessage
+	closed  chan struct{}
+
+	onMessage      func(from string, m *ClusterMessage)
+	onNodesChanged func()
+	startOnce      sync.Once
+	mutex          sync.Mutex
+}
+
+func (n *memoryNode) NodeID() string {
+	return n.id
+}
+
+func (n *memoryNode) Nodes() []string {
+	// Lock the mutex.
+	n.cluster.mutex.Lock()
+	defer n.cluster.mutex.Unlock()
+
+	nodes := make([]string, 0, len(n.cluster.nodes))
+	for id := range n.cluster.nodes {
+		nodes = append(nodes, id)
+	}
+	sort.Strings(nodes)
+
+	return nodes
+}
+
+func (n *memoryNode) Send(node string, m *ClusterMessage) error {
+	// Lock the mutex.
+	n.cluster.mutex.Lock()
+	to, ok := n.cluster.nodes[node]
+	n.cluster.mutex.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown cluster node '%s'", node)
+	}
+
+	// Copy the message. The receiver must not share it.
+	cm := *m
+	to.push(memoryMessage{from: n.id, m: &cm})
+
+	return nil
+}
+
+func (n *memoryNode) OnMessage(f func(from string, m *ClusterMessage)) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.onMessage = f
+
+	// Deliver the messages in order as soon as they are handled.
+	n.startOnce.Do(func() {
+		go n.deliverLoop()
+	})
+}
+
+func (n *memoryNode) OnNodesChanged(f func()) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.onNodesChanged = f
+}
+
+func (n *memoryNode) push(m memoryMessage) {
+	select {
+	case n.inbox <- m:
+	case <-n.closed:
+	}
+}
+
+func (n *memoryNode) deliverLoop() {
+	for {
+		select {
+		case m := <-n.inbox:
+			// Get the callbacks.
+			n.mutex.Lock()
+			onMessage := n.onMessage
+			onNodesChanged := n.onNodesChanged
+			n.mutex.Unlock()
+
+			if m.nodesChanged {
+				if onNodesChanged != nil {
+					onNodesChanged()
+				}
+			} else if onMessage != nil {
+				onMessage(m.from, m.m)
+			}
+		case <-n.closed:
+			return
+		}
+	}
+}
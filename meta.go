@@ -0,0 +1,52 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// SetMeta attaches the value with the key to the socket. In contrast to the
+// Value field, multiple middlewares and handlers can attach their data
+// independently. Prefix the keys, for example with the package name.
+// Pass a nil value to remove the key.
+func (s *Socket) SetMeta(key string, value interface{}) {
+	// Lock the mutex.
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+
+	if value == nil {
+		delete(s.meta, key)
+		return
+	}
+
+	if s.meta == nil {
+		s.meta = make(map[string]interface{})
+	}
+	s.meta[key] = value
+}
+
+// Meta returns the value attached with the key or nil if not set.
+func (s *Socket) Meta(key string) interface{} {
+	// Lock the mutex.
+	s.metaMutex.Lock()
+	defer s.metaMutex.Unlock()
+
+	return s.meta[key]
+}
@@ -0,0 +1,55 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"expvar"
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+// The internal counters are published with the expvar package
+// and served as JSON by the /debug/vars handler of the default HTTP
+// multiplexer. The counters are shared by all servers of the process.
+var (
+	metricSockets         = expvar.NewInt("glue.sockets")          // Current connected sockets.
+	metricSocketsTotal    = expvar.NewInt("glue.sockets_total")    // Sockets connected since the start.
+	metricMessagesRead    = expvar.NewInt("glue.messages_read")    // Frames received from clients.
+	metricMessagesWritten = expvar.NewInt("glue.messages_written") // Frames passed to the write buffers.
+	metricBytesRead       = expvar.NewInt("glue.bytes_read")
+	metricBytesWritten    = expvar.NewInt("glue.bytes_written")
+	metricPingFailures    = expvar.NewInt("glue.ping_failures")  // Sockets closed due to a ping timeout.
+	metricDroppedWrites   = expvar.NewInt("glue.dropped_writes") // Writes dropped due to an exceeded TTL.
+)
+
+//###############//
+//### Private ###//
+//###############//
+
+func countRead(data string) {
+	metricMessagesRead.Add(1)
+	metricBytesRead.Add(int64(len(data)))
+}
+
+func countWrite(data string) {
+	metricMessagesWritten.Add(1)
+	metricBytesWritten.Add(int64(len(data)))
+}
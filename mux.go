@@ -0,0 +1,188 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+
+	"github.com/desertbit/glue/backend/sockets/muxsocket"
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used to multiplex logical sockets
+	// over one physical connection.
+	muxChannelName = "_mux"
+
+	// Mux frame types. Must be one character long.
+	muxData  = "d"
+	muxClose = "c"
+
+	defaultMaxMuxSockets = 64
+)
+
+//###############//
+//### Private ###//
+//###############//
+
+// handleMux handles the frames of the logical sockets.
+// A carrier socket transports the frames of multiple logical sockets.
+// Each logical socket is a complete glue socket with its own ID,
+// channels and lifecycle. The carrier itself is hidden from the
+// server sockets list and the OnNewSocket event. The frames are only
+// accepted if the client initialized the socket as carrier.
+func (s *Socket) handleMux(data string) error {
+	if !s.carrier() {
+		return fmt.Errorf("mux frame received by a socket without mux support")
+	} else if len(data) == 0 {
+		return fmt.Errorf("invalid mux data")
+	}
+
+	id, frame, err := utils.UnmarshalValues(data[1:])
+	if err != nil {
+		return err
+	}
+
+	switch data[:1] {
+	case muxData:
+		m, isNew, err := s.getMuxSocket(id)
+		if err != nil {
+			// Tell the client that the logical socket is closed.
+			s.writeMuxClose(id)
+			return err
+		} else if m == nil {
+			return nil
+		}
+
+		// Create the new glue socket for the logical socket.
+		if isNew {
+			s.server.handleOnNewSocketConnection(m)
+		}
+
+		// Pass the frame to the logical socket. A slow logical
+		// socket must not block the other ones of the carrier.
+		if !m.Push(frame) {
+			return fmt.Errorf("logical socket '%s': read buffer full: socket closed", id)
+		}
+
+	case muxClose:
+		// Lock the mutex.
+		s.muxMutex.Lock()
+		m := s.muxSockets[id]
+		s.muxMutex.Unlock()
+
+		if m != nil {
+			m.Close()
+		}
+
+	default:
+		return fmt.Errorf("invalid mux frame type")
+	}
+
+	return nil
+}
+
+// getMuxSocket returns the logical socket with the ID.
+// A new logical socket is created if it does not exist. New logical
+// sockets count as handshakes of the remote address and are limited
+// per carrier. Returns nil if the carrier is closed.
+// This is only called by the read loop, so logical sockets
+// are never created concurrently.
+func (s *Socket) getMuxSocket(id string) (m *muxsocket.Socket, isNew bool, err error) {
+	// Lock the mutex.
+	s.muxMutex.Lock()
+	m, ok := s.muxSockets[id]
+	count := len(s.muxSockets)
+	s.muxMutex.Unlock()
+
+	if ok {
+		return m, false, nil
+	}
+
+	if count >= s.server.options.MaxMuxSockets {
+		return nil, false, fmt.Errorf("logical socket '%s': maximum number of logical sockets reached", id)
+	}
+
+	// The handshake limiter calls the OnHandshakeBanned function.
+	// Don't hold the mutex.
+	if l := s.server.handshakeLimiter; l != nil && !l.allowAddr(s.RemoteAddr(), s.UserAgent()) {
+		return nil, false, fmt.Errorf("logical socket '%s': handshake rate limit exceeded", id)
+	}
+
+	// The frames written to the logical socket are passed to the carrier.
+	write := func(frame string) {
+		s.write(cmdChannelData + utils.MarshalValues(muxChannelName, muxData+utils.MarshalValues(id, frame)))
+	}
+
+	onClose := func() {
+		// Remove the logical socket from the carrier.
+		s.muxMutex.Lock()
+		delete(s.muxSockets, id)
+		s.muxMutex.Unlock()
+
+		// Notify the client.
+		s.writeMuxClose(id)
+	}
+
+	// Lock the mutex.
+	s.muxMutex.Lock()
+	defer s.muxMutex.Unlock()
+
+	if s.IsClosed() {
+		return nil, false, nil
+	}
+
+	m = muxsocket.NewSocket(id, s.RemoteAddr(), s.UserAgent(), s.Header(), write, onClose)
+	s.muxSockets[id] = m
+
+	return m, true, nil
+}
+
+// writeMuxClose tells the client that the logical socket is closed.
+func (s *Socket) writeMuxClose(id string) {
+	s.write(cmdChannelData + utils.MarshalValues(muxChannelName, muxClose+utils.MarshalValues(id, "")))
+}
+
+// carrier returns true if the socket is a carrier of logical sockets.
+func (s *Socket) carrier() bool {
+	// Lock the mutex.
+	s.muxMutex.Lock()
+	defer s.muxMutex.Unlock()
+
+	return s.isCarrier
+}
+
+// closeMuxSockets closes all logical sockets of the carrier.
+func (s *Socket) closeMuxSockets() {
+	// Lock the mutex.
+	s.muxMutex.Lock()
+	sockets := make([]*muxsocket.Socket, 0, len(s.muxSockets))
+	for _, m := range s.muxSockets {
+		sockets = append(sockets, m)
+	}
+	s.muxMutex.Unlock()
+
+	for _, m := range sockets {
+		m.Close()
+	}
+}
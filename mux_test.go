@@ -0,0 +1,177 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/utils"
+)
+
+// sendMux passes a frame of the logical socket over the carrier.
+func sendMux(t *testing.T, conn *MemoryConn, id, frame string) {
+	t.Helper()
+
+	sendChannelData(t, conn, muxChannelName, muxData+utils.MarshalValues(id, frame))
+}
+
+// openMux sends the init frame of a new logical socket.
+func openMux(t *testing.T, conn *MemoryConn, id string) {
+	t.Helper()
+
+	dataJSON, err := json.Marshal(&clientInitData{Version: Version})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendMux(t, conn, id, cmdInit+string(dataJSON))
+}
+
+// receiveMux returns the next mux frame received by the carrier.
+func receiveMux(t *testing.T, conn *MemoryConn) (typ, id, frame string) {
+	t.Helper()
+
+	for {
+		name, data := receiveChannelData(t, conn)
+		if name != muxChannelName {
+			continue
+		}
+
+		id, frame, err := utils.UnmarshalValues(data[1:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data[:1], id, frame
+	}
+}
+
+func TestMux(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := connectTestSocketWith(t, server, clientInitData{Mux: true})
+
+	// The carrier is hidden from the sockets list.
+	if n := len(server.Sockets()); n != 0 {
+		t.Fatalf("carrier listed: %d sockets", n)
+	}
+
+	openMux(t, conn, "a")
+
+	typ, id, frame := receiveMux(t, conn)
+	if typ != muxData || id != "a" || !strings.HasPrefix(frame, cmdInit) {
+		t.Fatalf("unexpected mux frame: %s %s %s", typ, id, frame)
+	}
+
+	waitFor(t, 5*time.Second, func() bool { return len(server.Sockets()) == 1 })
+	s := server.Sockets()[0]
+
+	// Closing the logical socket notifies the client.
+	s.Close()
+
+	if typ, id, _ = receiveMux(t, conn); typ != muxClose || id != "a" {
+		t.Fatalf("unexpected mux frame: %s %s", typ, id)
+	}
+}
+
+func TestMuxNotNegotiated(t *testing.T) {
+	server := newTestServer(t)
+	conn, _ := connectTestSocket(t, server)
+
+	openMux(t, conn, "a")
+	time.Sleep(50 * time.Millisecond)
+
+	// Only the plain socket exists.
+	if n := len(server.Sockets()); n != 1 {
+		t.Fatalf("logical socket created without mux: %d sockets", n)
+	}
+}
+
+func TestMuxLimits(t *testing.T) {
+	tests := map[string]Options{
+		"max sockets":          {MaxMuxSockets: 1},
+		"handshake rate limit": {HandshakeRateLimit: 1},
+	}
+
+	for name, o := range tests {
+		server := newTestServer(t, o)
+		conn, _ := connectTestSocketWith(t, server, clientInitData{Mux: true})
+
+		openMux(t, conn, "a")
+		if typ, id, _ := receiveMux(t, conn); typ != muxData || id != "a" {
+			t.Fatalf("%s: first logical socket rejected: %s %s", name, typ, id)
+		}
+
+		openMux(t, conn, "b")
+		if typ, id, _ := receiveMux(t, conn); typ != muxClose || id != "b" {
+			t.Fatalf("%s: second logical socket accepted: %s %s", name, typ, id)
+		}
+	}
+}
+
+func TestMuxSlowSocket(t *testing.T) {
+	// Block the handshake of the slow logical socket,
+	// so its read loop doesn't read the received data.
+	block := make(chan struct{})
+	defer close(block)
+
+	server := newTestServer(t, Options{
+		OnHandshake: func(s *Socket, payload string) error {
+			if payload == "slow" {
+				<-block
+			}
+			return nil
+		},
+	})
+
+	conn, _ := connectTestSocketWith(t, server, clientInitData{Mux: true})
+
+	dataJSON, err := json.Marshal(&clientInitData{Version: Version, Payload: "slow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendMux(t, conn, "slow", cmdInit+string(dataJSON))
+
+	// Flood the slow logical socket. The carrier keeps reading
+	// and closes the slow logical socket.
+	for i := 0; i < 2*global.ReadChanSize; i++ {
+		sendMux(t, conn, "slow", cmdPing)
+	}
+
+	for {
+		typ, id, _ := receiveMux(t, conn)
+		if id != "slow" {
+			t.Fatalf("unexpected mux frame: %s %s", typ, id)
+		} else if typ == muxClose {
+			break
+		}
+	}
+
+	// The other logical sockets of the carrier are not blocked.
+	openMux(t, conn, "fast")
+	for {
+		typ, id, frame := receiveMux(t, conn)
+		if id == "fast" && typ == muxData && strings.HasPrefix(frame, cmdInit) {
+			break
+		}
+	}
+}
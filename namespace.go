@@ -0,0 +1,212 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"sync"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// AuthFunc authenticates a new socket with the auth value passed
+// by the client. Return a non-nil error to reject the socket.
+// Return a RejectError to pass a custom rejection code to the client.
+type AuthFunc func(s *Socket, auth string) error
+
+// MiddlewareFunc is called for each new socket before the OnNewSocket
+// event function. Return a non-nil error to reject the socket.
+type MiddlewareFunc func(s *Socket) error
+
+//######################//
+//### Namespace Type ###//
+//######################//
+
+// A Namespace isolates the handler registration of distinct applications
+// served by one glue server. Clients select the namespace with the
+// namespace option during the connection handshake.
+type Namespace struct {
+	name   string
+	server *Server
+
+	onNewSocket OnNewSocketFunc
+	auth        AuthFunc
+	middlewares []MiddlewareFunc
+	mutex       sync.Mutex
+}
+
+func newNamespace(server *Server, name string) *Namespace {
+	return &Namespace{
+		name:        name,
+		server:      server,
+		onNewSocket: func(*Socket) {}, // Initialize with dummy function to remove nil check.
+	}
+}
+
+// Name returns the namespace name.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// OnNewSocket sets the event function which is triggered
+// if a new socket connection to this namespace was made.
+// The event function must not block, unless the SyncOnNewSocket option is set!
+func (n *Namespace) OnNewSocket(f OnNewSocketFunc) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.onNewSocket = f
+}
+
+// OnAuth sets the authentication hook of the namespace.
+// Rejected clients don't reconnect automatically.
+func (n *Namespace) OnAuth(f AuthFunc) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.auth = f
+}
+
+// Use adds a middleware function. Middlewares are called in the
+// order they were added after the authentication hook.
+func (n *Namespace) Use(f MiddlewareFunc) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.middlewares = append(n.middlewares, f)
+}
+
+// Sockets returns a list of all current connected sockets of the namespace.
+func (n *Namespace) Sockets() []*Socket {
+	var list []*Socket
+	for _, s := range n.server.Sockets() {
+		if s.Namespace() == n {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// Namespace returns the namespace specified by the name.
+// A new namespace is created if it does not exist.
+// The empty name and "/" address the default namespace
+// which uses the server OnNewSocket event function.
+func (s *Server) Namespace(name string) *Namespace {
+	name = normalizeNamespace(name)
+
+	// Lock the mutex.
+	s.namespacesMutex.Lock()
+	defer s.namespacesMutex.Unlock()
+
+	n, ok := s.namespaces[name]
+	if !ok {
+		n = newNamespace(s, name)
+		s.namespaces[name] = n
+	}
+
+	return n
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// Namespace returns the namespace of the socket.
+// Nil is returned if the socket is not initialized yet.
+func (s *Socket) Namespace() *Namespace {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	return s.namespace
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// setNamespace sets the namespace of the socket during the initialization.
+func (s *Socket) setNamespace(n *Namespace) {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	s.namespace = n
+}
+
+// getNamespace returns the namespace or nil if it does not exist.
+func (s *Server) getNamespace(name string) *Namespace {
+	// Lock the mutex.
+	s.namespacesMutex.Lock()
+	defer s.namespacesMutex.Unlock()
+
+	return s.namespaces[normalizeNamespace(name)]
+}
+
+// normalizeNamespace returns the namespace name with a leading slash.
+func normalizeNamespace(name string) string {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	return name
+}
+
+// authenticate calls the authentication hook and the middlewares.
+// The returned boolean is true if the client should not reconnect.
+func (n *Namespace) authenticate(s *Socket, auth string) (bool, error) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	authFunc := n.auth
+	middlewares := n.middlewares
+	n.mutex.Unlock()
+
+	if authFunc != nil {
+		if err := authFunc(s, auth); err != nil {
+			return true, err
+		}
+	}
+
+	for _, f := range middlewares {
+		if err := f(s); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// triggerOnNewSocket calls the on new socket event function of the namespace.
+func (n *Namespace) triggerOnNewSocket(s *Socket) {
+	// Lock the mutex.
+	n.mutex.Lock()
+	f := n.onNewSocket
+	n.mutex.Unlock()
+
+	f(s)
+}
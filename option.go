@@ -0,0 +1,290 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// An Option configures the server created with the New function.
+// Options validate their values and return an error if invalid.
+type Option func(o *Options) error
+
+//########################//
+//### Public Functions ###//
+//########################//
+
+// New creates a new glue server instance configured by the functional
+// options. The options are applied in order on top of the default options
+// and validated afterwards. This is an alternative to the NewServer and
+// NewServerWithError functions with an Options struct.
+func New(opts ...Option) (*Server, error) {
+	var o Options
+
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, fmt.Errorf("glue: invalid option: %v", err)
+		}
+	}
+
+	return NewServerWithError(o)
+}
+
+// WithOptions sets all options at once. Use it as
+// first option to extend an existing Options struct.
+func WithOptions(options Options) Option {
+	return func(o *Options) error {
+		*o = options
+		return nil
+	}
+}
+
+// WithoutHTTPServer doesn't configure and run a HTTP server.
+// Register the server with a custom HTTP multiplexer instead.
+func WithoutHTTPServer() Option {
+	return func(o *Options) error {
+		o.HTTPSocketType = HTTPSocketTypeNone
+		return nil
+	}
+}
+
+// WithListenAddress runs the HTTP server on the TCP address.
+func WithListenAddress(addr string) Option {
+	return func(o *Options) error {
+		if len(addr) == 0 {
+			return fmt.Errorf("empty listen address")
+		}
+		o.HTTPSocketType = HTTPSocketTypeTCP
+		o.HTTPListenAddress = addr
+		return nil
+	}
+}
+
+// WithUnixSocket runs the HTTP server on the unix socket path.
+func WithUnixSocket(path string) Option {
+	return func(o *Options) error {
+		if len(path) == 0 {
+			return fmt.Errorf("empty unix socket path")
+		}
+		o.HTTPSocketType = HTTPSocketTypeUnix
+		o.HTTPListenAddress = path
+		return nil
+	}
+}
+
+// WithTLS enables TLS with the certificate and key files.
+func WithTLS(certFile, keyFile string) Option {
+	return func(o *Options) error {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			return fmt.Errorf("TLS requires a certificate and a key file")
+		}
+		o.TLSCertFile = certFile
+		o.TLSKeyFile = keyFile
+		return nil
+	}
+}
+
+// WithHandleURL sets the base URL path of the glue HTTP handler.
+func WithHandleURL(url string) Option {
+	return func(o *Options) error {
+		if !strings.HasPrefix(url, "/") {
+			return fmt.Errorf("invalid handle URL: %q: the URL path must start with a slash", url)
+		}
+		o.HTTPHandleURL = url
+		return nil
+	}
+}
+
+// WithCheckOrigin sets the function which checks the request Origin header.
+func WithCheckOrigin(f func(r *http.Request) bool) Option {
+	return func(o *Options) error {
+		if f == nil {
+			return fmt.Errorf("nil check origin function")
+		}
+		o.CheckOrigin = f
+		return nil
+	}
+}
+
+// WithCORS enables the Cross-Origin Resource Sharing mechanism
+// and only allows requests with one of the passed origins,
+// for example "https://example.com".
+func WithCORS(origins ...string) Option {
+	return func(o *Options) error {
+		if len(origins) == 0 {
+			return fmt.Errorf("CORS requires at least one allowed origin")
+		}
+
+		o.EnableCORS = true
+		o.CheckOrigin = allowOrigins(origins)
+		return nil
+	}
+}
+
+// WithPingPeriod sets the keepalive ping interval.
+func WithPingPeriod(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid ping period: %v", d)
+		}
+		o.PingInterval = d
+		return nil
+	}
+}
+
+// WithPingTimeout sets the keepalive pong response timeout.
+func WithPingTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid ping timeout: %v", d)
+		}
+		o.PingTimeout = d
+		return nil
+	}
+}
+
+// WithMaxConnections limits the number of concurrent socket connections.
+func WithMaxConnections(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid max connections: %v", n)
+		}
+		o.MaxConnections = n
+		return nil
+	}
+}
+
+// WithReadWorkers enables the OnRead worker pool with n workers.
+func WithReadWorkers(n int) Option {
+	return func(o *Options) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid read workers: %v", n)
+		}
+		o.ReadWorkers = n
+		return nil
+	}
+}
+
+// WithHandshakeRateLimit limits the handshake requests
+// of each remote address within the interval.
+func WithHandshakeRateLimit(limit int, interval time.Duration) Option {
+	return func(o *Options) error {
+		if limit <= 0 || interval <= 0 {
+			return fmt.Errorf("invalid handshake rate limit: %v per %v", limit, interval)
+		}
+		o.HandshakeRateLimit = limit
+		o.HandshakeRateInterval = interval
+		return nil
+	}
+}
+
+// WithIdleTimeout closes sockets without application data within the timeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid idle timeout: %v", d)
+		}
+		o.IdleTimeout = d
+		return nil
+	}
+}
+
+// WithMaxSessionDuration forces the clients to reconnect after the duration.
+func WithMaxSessionDuration(d time.Duration) Option {
+	return func(o *Options) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid max session duration: %v", d)
+		}
+		o.MaxSessionDuration = d
+		return nil
+	}
+}
+
+// WithOnHandshake sets the function which validates the handshake payload.
+func WithOnHandshake(f HandshakeFunc) Option {
+	return func(o *Options) error {
+		if f == nil {
+			return fmt.Errorf("nil handshake function")
+		}
+		o.OnHandshake = f
+		return nil
+	}
+}
+
+// WithClientVersionRange sets the accepted client protocol versions.
+func WithClientVersionRange(r string) Option {
+	return func(o *Options) error {
+		o.ClientVersionRange = r
+		return nil
+	}
+}
+
+// WithServeClient serves the embedded javascript client.
+// If strict is set, mismatched client versions are rejected.
+func WithServeClient(strict bool) Option {
+	return func(o *Options) error {
+		o.ServeClient = true
+		o.StrictClientVersion = strict
+		return nil
+	}
+}
+
+// WithStore sets the store persisting the messages.
+func WithStore(st Store) Option {
+	return func(o *Options) error {
+		if st == nil {
+			return fmt.Errorf("the store must not be nil")
+		}
+		o.Store = st
+		return nil
+	}
+}
+
+// WithLogLevel sets the level of all glue loggers.
+func WithLogLevel(level string) Option {
+	return func(o *Options) error {
+		o.LogLevel = level
+		return nil
+	}
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// allowOrigins returns a check origin function which only allows requests
+// with one of the origins. Trailing slashes of the origins are ignored.
+func allowOrigins(origins []string) func(r *http.Request) bool {
+	allowed := make(map[string]struct{}, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = struct{}{}
+	}
+
+	return func(r *http.Request) bool {
+		_, ok := allowed[r.Header.Get("Origin")]
+		return ok
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	allowAll := func(r *http.Request) bool { return true }
+	accept := func(s *Socket, payload string) error { return nil }
+	store := NewMemoryStore()
+
+	tests := []struct {
+		name  string
+		opt   Option
+		err   bool
+		check func(o *Options) bool
+	}{
+		{"options", WithOptions(Options{RoutingName: "route"}), false, func(o *Options) bool { return o.RoutingName == "route" }},
+		{"without http server", WithoutHTTPServer(), false, func(o *Options) bool { return o.HTTPSocketType == HTTPSocketTypeNone }},
+		{"listen address", WithListenAddress(":8080"), false, func(o *Options) bool {
+			return o.HTTPSocketType == HTTPSocketTypeTCP && o.HTTPListenAddress == ":8080"
+		}},
+		{"empty listen address", WithListenAddress(""), true, nil},
+		{"unix socket", WithUnixSocket("/tmp/glue.sock"), false, func(o *Options) bool {
+			return o.HTTPSocketType == HTTPSocketTypeUnix && o.HTTPListenAddress == "/tmp/glue.sock"
+		}},
+		{"empty unix socket", WithUnixSocket(""), true, nil},
+		{"tls", WithTLS("cert.pem", "key.pem"), false, func(o *Options) bool { return o.TLSCertFile == "cert.pem" && o.TLSKeyFile == "key.pem" }},
+		{"tls without key", WithTLS("cert.pem", ""), true, nil},
+		{"handle url", WithHandleURL("/socket/"), false, func(o *Options) bool { return o.HTTPHandleURL == "/socket/" }},
+		{"relative handle url", WithHandleURL("socket/"), true, nil},
+		{"check origin", WithCheckOrigin(allowAll), false, func(o *Options) bool { return o.CheckOrigin != nil }},
+		{"nil check origin", WithCheckOrigin(nil), true, nil},
+		{"cors", WithCORS("https://example.com"), false, func(o *Options) bool { return o.EnableCORS && o.CheckOrigin != nil }},
+		{"cors without origins", WithCORS(), true, nil},
+		{"ping period", WithPingPeriod(time.Second), false, func(o *Options) bool { return o.PingInterval == time.Second }},
+		{"invalid ping period", WithPingPeriod(0), true, nil},
+		{"ping timeout", WithPingTimeout(time.Second), false, func(o *Options) bool { return o.PingTimeout == time.Second }},
+		{"invalid ping timeout", WithPingTimeout(-time.Second), true, nil},
+		{"max connections", WithMaxConnections(10), false, func(o *Options) bool { return o.MaxConnections == 10 }},
+		{"invalid max connections", WithMaxConnections(0), true, nil},
+		{"read workers", WithReadWorkers(4), false, func(o *Options) bool { return o.ReadWorkers == 4 }},
+		{"invalid read workers", WithReadWorkers(-1), true, nil},
+		{"handshake rate limit", WithHandshakeRateLimit(5, time.Second), false, func(o *Options) bool {
+			return o.HandshakeRateLimit == 5 && o.HandshakeRateInterval == time.Second
+		}},
+		{"invalid handshake rate limit", WithHandshakeRateLimit(5, 0), true, nil},
+		{"idle timeout", WithIdleTimeout(time.Minute), false, func(o *Options) bool { return o.IdleTimeout == time.Minute }},
+		{"invalid idle timeout", WithIdleTimeout(0), true, nil},
+		{"max session duration", WithMaxSessionDuration(time.Hour), false, func(o *Options) bool { return o.MaxSessionDuration == time.Hour }},
+		{"invalid max session duration", WithMaxSessionDuration(0), true, nil},
+		{"on handshake", WithOnHandshake(accept), false, func(o *Options) bool { return o.OnHandshake != nil }},
+		{"nil on handshake", WithOnHandshake(nil), true, nil},
+		{"client version range", WithClientVersionRange(">=2.0.0"), false, func(o *Options) bool { return o.ClientVersionRange == ">=2.0.0" }},
+		{"serve client", WithServeClient(true), false, func(o *Options) bool { return o.ServeClient && o.StrictClientVersion }},
+		{"store", WithStore(store), false, func(o *Options) bool { return o.Store == store }},
+		{"nil store", WithStore(nil), true, nil},
+		{"log level", WithLogLevel("debug"), false, func(o *Options) bool { return o.LogLevel == "debug" }},
+	}
+
+	for _, test := range tests {
+		var o Options
+		err := test.opt(&o)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !test.check(&o) {
+			t.Errorf("%s: unexpected options: %+v", test.name, o)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	server, err := New(
+		WithOptions(Options{RoutingName: "route"}),
+		WithoutHTTPServer(),
+		WithPingPeriod(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Release()
+
+	// The options are applied in order on top of the defaults.
+	if server.options.RoutingName != "route" || server.options.HTTPSocketType != HTTPSocketTypeNone ||
+		server.options.PingInterval != time.Second || server.options.PingTimeout != pingResponseTimeout {
+		t.Fatalf("unexpected options: %+v", server.options)
+	}
+
+	// Invalid options are rejected.
+	if _, err = New(WithoutHTTPServer(), WithPingPeriod(0)); err == nil || !strings.HasPrefix(err.Error(), "glue: invalid option: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The resulting options are validated.
+	if _, err = New(WithoutHTTPServer(), WithServeClient(true), WithOptions(Options{StrictClientVersion: true})); err == nil ||
+		!strings.HasPrefix(err.Error(), "glue: invalid options: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestAllowOrigins(t *testing.T) {
+	check := allowOrigins([]string{"https://example.com/", "http://localhost:8080"})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://example.com", true},
+		{"http://localhost:8080", true},
+		{"http://example.com", false},
+		{"https://example.com.evil.com", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/glue/ws", nil)
+		if len(test.origin) > 0 {
+			r.Header.Set("Origin", test.origin)
+		}
+		if ok := check(r); ok != test.want {
+			t.Errorf("%q: unexpected result: %v", test.origin, ok)
+		}
+	}
+}
@@ -19,9 +19,16 @@
 package glue
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/desertbit/glue/backend/faults"
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
 )
 
 //#################//
@@ -61,6 +68,21 @@ type Options struct {
 	// Default: "/glue/"
 	HTTPHandleURL string
 
+	// TLSCertFile and TLSKeyFile enable TLS for the HTTP server started by
+	// the Run method. The files contain the PEM encoded certificate chain
+	// and the private key. HTTP/2 is enabled for TLS connections.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// EnableH2C enables unencrypted HTTP/2 (h2c) for the HTTP server started
+	// by the Run method, so ajax clients multiplex their poll and push requests
+	// over one connection instead of opening several TCP connections.
+	// Only enable this behind a trusted reverse proxy, which terminates TLS.
+	// HTTP/2 over TLS is enabled by the Go HTTP server automatically.
+	// Requires Go 1.24 or later. Older toolchains log a warning and
+	// serve HTTP/1.1 only.
+	EnableH2C bool
+
 	// CheckOrigin returns true if the request Origin header is acceptable. If
 	// CheckOrigin is nil, the host in the Origin header must not be set or
 	// must match the host of the request.
@@ -72,6 +94,353 @@ type Options struct {
 	// A resource makes a cross-origin HTTP request when it requests a resource
 	// from a different domain than the one which served itself.
 	EnableCORS bool
+
+	// AjaxPollTimeout is the maximum duration an ajax poll request is held
+	// open. Lower it if proxies kill requests held open longer than 30 seconds.
+	// The ajax options are passed to the client with the ajax init response.
+	// Default: 35 seconds
+	AjaxPollTimeout time.Duration
+
+	// AjaxPollDelay delays the next ajax poll request of the client after
+	// a poll response with data. This limits the request rate of the client.
+	// Default: 0
+	AjaxPollDelay time.Duration
+
+	// AjaxPushRetries is the number of times the client retries a failed ajax
+	// push request before the connection is treated as lost. The server drops
+	// retried pushes with a known sequence number, so messages are not delivered twice.
+	// Default: 0
+	AjaxPushRetries int
+
+	// AjaxPushRetryDelay is the delay before a failed ajax push is retried.
+	// Default: 1 second
+	AjaxPushRetryDelay time.Duration
+
+	// AjaxMaxBodySize is the maximum size of an ajax request body in bytes.
+	// Larger requests are rejected with the status 413 Request Entity Too Large.
+	// Default: 10 MB
+	AjaxMaxBodySize int64
+
+	// AjaxReadTimeout is the maximum duration to read an ajax request body,
+	// so slow clients don't hold a handler goroutine indefinitely.
+	// Default: 30 seconds
+	AjaxReadTimeout time.Duration
+
+	// AjaxHeaders are set on all ajax responses. By default the Cache-Control,
+	// Pragma and Expires headers prevent caching and X-Accel-Buffering disables
+	// the nginx proxy buffering, which delays the long polling otherwise.
+	// The headers are merged with the default headers and an empty
+	// value removes a default header.
+	AjaxHeaders map[string]string
+
+	// EnableSockJS serves a SockJS endpoint below the HTTP handle URL
+	// (/glue/sockjs), so the SockJS client library with its fallback
+	// transports carries the glue protocol. Use the SockJSSocket type of
+	// the javascript client.
+	EnableSockJS bool
+
+	// SockJSClientURL is the URL of the SockJS client library loaded by the
+	// iframe transports. Its version must match the version of the client.
+	// Default: the SockJS 1.x client of the jsDelivr CDN
+	SockJSClientURL string
+
+	// EnableEngineIO serves an engine.io endpoint (protocol version 4) below
+	// the HTTP handle URL (/glue/engine.io/), so the engine.io client with its
+	// polling and websocket transports carries the glue protocol. Use the
+	// EngineIOSocket type of the javascript client.
+	EnableEngineIO bool
+
+	// EnableSocketIO serves a socket.io endpoint (protocol version 5) below
+	// the HTTP handle URL (/glue/socket.io/), so socket.io clients connect
+	// without the glue client. The socket.io events are passed to the glue
+	// channels with the same name. See the README for the limits.
+	EnableSocketIO bool
+
+	// ServeClient serves the embedded javascript client below the HTTP handle
+	// URL, for example /glue/glue.js and with the server protocol version in
+	// the path (/glue/glue-2.0.0.js). See the server ClientURL method.
+	// The client always matches the protocol version of the server.
+	ServeClient bool
+
+	// StrictClientVersion rejects requests for the embedded javascript client
+	// with a version not matching the server protocol version, passed with the
+	// versioned URL path or the v query parameter (/glue/glue.js?v=2.0.0).
+	// Mismatched clients are served the current client otherwise.
+	StrictClientVersion bool
+
+	// ClientVersionRange defines the accepted client socket protocol versions,
+	// for example ">=1.8.0 <1.11.0". This allows staged rollouts where the
+	// frontends are deployed before the servers. An invalid range is ignored.
+	// Default: the same major version and not newer than the server version
+	ClientVersionRange string
+
+	// Trace enables the wire-level tracing of new sockets. Each sent and
+	// received frame is logged with the protocol logger or passed to the
+	// TraceFunc. Use the socket SetTracing method to toggle it at runtime.
+	Trace bool
+
+	// TraceFunc is called with the traced frames instead of logging them.
+	TraceFunc TraceFunc
+
+	// TracePayloadLimit truncates the payload of traced frames.
+	// Default: 256 bytes
+	TracePayloadLimit int
+
+	// Recorder records the frames of new sockets with their timing.
+	// Recordings are replayed with the server Replay method.
+	Recorder *Recorder
+
+	// RecordSocket selects the sockets passed to the Recorder.
+	// Default: all sockets are recorded
+	RecordSocket func(s *Socket) bool
+
+	// Cluster connects the servers of multiple nodes. Topics are partitioned
+	// across the nodes with consistent hashing of the topic names, so
+	// published messages are only passed to nodes with subscribers.
+	Cluster ClusterAdapter
+
+	// Faults injects latency, dropped and reordered frames and random
+	// disconnects into all sockets. Only use this for testing.
+	Faults *faults.Options
+
+	// SyncOnNewSocket allows the OnNewSocket functions to block, for example
+	// to authenticate the socket with a database lookup. The function runs
+	// in its own goroutine while the keepalive continues. Received channel
+	// data is held back until the function returns, so the setup is always
+	// complete before the first OnRead function is triggered.
+	SyncOnNewSocket bool
+
+	// ReadWorkers enables the OnRead worker pool and limits the number of
+	// concurrent OnRead function calls of all sockets. Messages of a channel
+	// are passed in order and only one at a time. By default each received
+	// message is passed to the OnRead function in a new goroutine.
+	// Default: 0 (disabled)
+	ReadWorkers int
+
+	// OnHandshake validates the handshake payload passed by the client
+	// handshake option, for example to check tokens or allow-listed devices.
+	// A returned error rejects the connection before OnNewSocket is called
+	// and the client does not reconnect automatically.
+	OnHandshake HandshakeFunc
+
+	// OnHandshakeResponse sets custom headers and cookies on the websocket
+	// upgrade and ajax init responses, for example a session cookie.
+	OnHandshakeResponse HandshakeResponseFunc
+
+	// PushFallback is called by the server WriteToUser method if no socket
+	// of the user is connected. Use this to hand the message to a
+	// Web Push (VAPID) sender. The function is called in the caller's goroutine.
+	PushFallback PushFallbackFunc
+
+	// DeadLetters receives the undeliverable messages: writes dropped due
+	// to an exceeded TTL or a closed socket and messages written to offline
+	// users without the PushFallback option. The messages are queued and
+	// passed to the sink in a separate goroutine.
+	DeadLetters DeadLetterSink
+
+	// DeadLetterQueueSize is the maximum number of queued dead letters.
+	// Further dead letters are logged and dropped if the sink is too slow.
+	// Default: 1024
+	DeadLetterQueueSize int
+
+	// Store persists the messages of the persistence features like the
+	// topic histories. Set a custom store to back the messages by a
+	// durable database.
+	// Default: NewMemoryStore()
+	Store Store
+
+	// RequireConnectTicket rejects sockets without a connect ticket.
+	// See the server NewConnectTicket method.
+	RequireConnectTicket bool
+
+	// ConnectTicketMaxLifetime is the absolute lifetime of a connect ticket
+	// including all its renewals, counted from the NewConnectTicket call.
+	// No renewed ticket is passed to the client afterwards.
+	// Default: 24 hours
+	ConnectTicketMaxLifetime time.Duration
+
+	// DedupWindowSize is the number of message IDs remembered per user and
+	// reliable channel to discard messages redelivered by the clients.
+	// Sockets without a user ID are keyed by the client ID.
+	// Default: 256
+	DedupWindowSize int
+
+	// WebhookURL enables JSON webhooks of the socket lifecycle events.
+	// The connect, identify (SetUserID), disconnect and custom events
+	// (TriggerWebhook) are posted to this URL.
+	WebhookURL string
+
+	// WebhookSecret signs the webhook requests with HMAC-SHA256. The timestamp
+	// of the X-Glue-Timestamp header and the body are signed as
+	// "<timestamp>.<body>". The hex encoded signature is set in the
+	// X-Glue-Signature header.
+	WebhookSecret string
+
+	// WebhookRetries defines how often a failed webhook delivery is retried.
+	// Set to -1 to disable retries.
+	// Default: 3
+	WebhookRetries int
+
+	// WebhookWorkers is the number of workers delivering the webhooks.
+	// The webhooks of a socket are always delivered in order by the
+	// same worker.
+	// Default: 4
+	WebhookWorkers int
+
+	// WebhookQueueSize is the maximum number of queued webhooks per worker.
+	// Further webhooks are logged and dropped if the receiver is too slow.
+	// Default: 1024
+	WebhookQueueSize int
+
+	// APIToken enables the REST API to push messages to connected clients.
+	// The API is served below the HTTP handle URL (e.g. /glue/api/broadcast).
+	// Requests have to pass this token as bearer token in the Authorization header.
+	APIToken string
+
+	// IdleTimeout closes sockets which exchanged no application data for the
+	// duration. Keepalive pings are excluded. The client is warned before with
+	// the idle_warning event and is rejected with the idle_timeout code.
+	// Default: 0 (disabled)
+	IdleTimeout time.Duration
+
+	// IdleWarning defines how long before the idle timeout the warning is sent.
+	// Default: 1 minute or half of the idle timeout if shorter
+	IdleWarning time.Duration
+
+	// MaxSessionDuration forces the clients to reconnect after the duration,
+	// so long-lived connections periodically re-authenticate and re-balance
+	// across the server nodes. A random jitter of up to 10% is added.
+	// Default: 0 (unlimited)
+	MaxSessionDuration time.Duration
+
+	// DuplicateUserPolicy defines how a new socket of an already connected
+	// user is handled. See the socket SetUserID method.
+	// Default: DuplicateUserAllow
+	DuplicateUserPolicy DuplicateUserPolicy
+
+	// SocketIDMode defines how the socket IDs are generated. SocketIDSortable
+	// creates timestamp-sortable IDs, which ease log correlation and sharding.
+	// Default: SocketIDRandom
+	SocketIDMode SocketIDMode
+
+	// SocketIDPrefix is prepended to the socket IDs with a dash, for example
+	// the node name, so the node of a socket is known by its ID. Only letters,
+	// digits, dots and underscores are allowed.
+	// Default: none
+	SocketIDPrefix string
+
+	// NotifyMaintenance notifies the connected clients about maintenance
+	// mode changes. The JS client triggers the maintenance event.
+	NotifyMaintenance bool
+
+	// PingInterval is the period of the keepalive pings sent to the clients.
+	// Default: 30 seconds
+	PingInterval time.Duration
+
+	// NativeWebSocketKeepalive uses the native websocket ping and pong
+	// control frames for the keepalive of websocket connections instead of
+	// the application-level ping messages. The client relies on the browser
+	// to detect broken connections. Other transports use the application-level pings.
+	NativeWebSocketKeepalive bool
+
+	// PingTimeout closes the socket if no pong response is received within the timeout.
+	// Default: 7 seconds
+	PingTimeout time.Duration
+
+	// MaxEgressBandwidth limits the outgoing bytes per second of all sockets.
+	// The bandwidth is shared fairly across the sockets. Writes block until
+	// the limit allows to send the data.
+	// Default: 0 (unlimited)
+	MaxEgressBandwidth int64
+
+	// SocketBandwidthLimit is the default outgoing bytes per second limit of
+	// each socket. See the socket SetBandwidthLimit method.
+	// Default: 0 (unlimited)
+	SocketBandwidthLimit int64
+
+	// FairChannelScheduling queues the outgoing messages per channel and passes
+	// them round-robin to the transport, so a channel writing heavily doesn't
+	// delay the messages of the other channels on the same socket. The order of
+	// messages is only kept within each channel. Batches are not split.
+	FairChannelScheduling bool
+
+	// MaxConnections limits the number of concurrent socket connections.
+	// New connections are rejected with the server_full code and the
+	// readiness endpoint reports the server as not ready as soon as the limit is reached.
+	// Default: 0 (unlimited)
+	MaxConnections int
+
+	// ConnectionsHighWatermark and ConnectionsLowWatermark define the number of
+	// connected sockets which trigger the OnConnectionsHigh and OnConnectionsLow
+	// functions. The high function is called as soon as the high watermark is
+	// reached. The low function is called as soon as the count falls to the low
+	// watermark afterwards. Set the high watermark below the MaxConnections
+	// limit to get notified before connections are rejected.
+	// Default: 0 (disabled) and 90% of the high watermark
+	ConnectionsHighWatermark int
+	ConnectionsLowWatermark  int
+
+	// OnConnectionsHigh and OnConnectionsLow are called with the number of
+	// connected sockets if a connections watermark is crossed.
+	OnConnectionsHigh func(count int)
+	OnConnectionsLow  func(count int)
+
+	// NotifyCapacity notifies the clients if the connections high watermark
+	// is reached and if the count fell to the low watermark again. The JS client
+	// triggers the capacity event and spreads its reconnects over the maximum
+	// reconnect delay while the server is near its capacity.
+	NotifyCapacity bool
+
+	// MaxMuxSockets limits the logical sockets of each carrier socket
+	// (see the JS glue.mux function). Further logical sockets are closed.
+	// Default: 64
+	MaxMuxSockets int
+
+	// HandshakeRateLimit limits the websocket upgrade and ajax init requests
+	// of each remote address within the HandshakeRateInterval. The logical
+	// sockets of carriers count as handshakes, too. Addresses
+	// exceeding the limit are banned for the HandshakeBanDuration and their
+	// handshake requests are rejected with the status 429 Too Many Requests.
+	// Default: 0 (unlimited)
+	HandshakeRateLimit int
+
+	// HandshakeRateInterval is the interval of the HandshakeRateLimit.
+	// Default: 1 minute
+	HandshakeRateInterval time.Duration
+
+	// HandshakeBanDuration is the duration a remote address is banned
+	// after exceeding the HandshakeRateLimit.
+	// Default: 5 minutes
+	HandshakeBanDuration time.Duration
+
+	// OnHandshakeBanned is called with the remote address as soon as
+	// it is banned due to the HandshakeRateLimit. Don't block within it.
+	OnHandshakeBanned func(remoteAddr string)
+
+	// RoutingKey identifies this server node for sticky session routing,
+	// for example the node ID. The key is set as cookie on all glue HTTP
+	// responses and passed to the clients during initialization. Clients
+	// echo it as query parameter on reconnect, so L7 load balancers can
+	// route reconnecting clients to the same node. Empty disables it.
+	RoutingKey string
+
+	// RoutingName is the name of the routing cookie and query parameter.
+	// Default: "glue_route"
+	RoutingName string
+
+	// LogLevel sets the level of all glue loggers: "debug", "info",
+	// "warning", "error" or "silent" to disable logging.
+	// The loggers are shared by all servers of the process.
+	// Default: "" (unchanged, debug)
+	LogLevel string
+
+	// BackendLogLevel, ProtocolLogLevel and KeepaliveLogLevel set the levels
+	// of the backend transports, protocol layer and keepalive loggers.
+	// They can't log more than the LogLevel allows.
+	// Default: "" (unchanged, debug)
+	BackendLogLevel   string
+	ProtocolLogLevel  string
+	KeepaliveLogLevel string
 }
 
 // SetDefaults sets unset option values to its default value.
@@ -98,12 +467,236 @@ func (o *Options) SetDefaults() {
 		o.HTTPHandleURL += "/"
 	}
 
+	// Set the routing name.
+	if len(o.RoutingName) == 0 {
+		o.RoutingName = "glue_route"
+	}
+
+	// Set the keepalive intervals.
+	if o.PingInterval <= 0 {
+		o.PingInterval = pingPeriod
+	}
+	if o.PingTimeout <= 0 {
+		o.PingTimeout = pingResponseTimeout
+	}
+
+	// Set the logical sockets limit of the carriers.
+	if o.MaxMuxSockets <= 0 {
+		o.MaxMuxSockets = defaultMaxMuxSockets
+	}
+
+	// Set the handshake rate limit interval and ban duration.
+	if o.HandshakeRateInterval <= 0 {
+		o.HandshakeRateInterval = defaultHandshakeRateInterval
+	}
+	if o.HandshakeBanDuration <= 0 {
+		o.HandshakeBanDuration = defaultHandshakeBanDuration
+	}
+
+	// Set the connections low watermark.
+	if o.ConnectionsHighWatermark > 0 &&
+		(o.ConnectionsLowWatermark <= 0 || o.ConnectionsLowWatermark >= o.ConnectionsHighWatermark) {
+		o.ConnectionsLowWatermark = o.ConnectionsHighWatermark * 9 / 10
+	}
+
+	// Set the idle warning.
+	if o.IdleTimeout > 0 && (o.IdleWarning <= 0 || o.IdleWarning >= o.IdleTimeout) {
+		o.IdleWarning = defaultIdleWarning
+		if o.IdleWarning > o.IdleTimeout/2 {
+			o.IdleWarning = o.IdleTimeout / 2
+		}
+	}
+
+	// Set the trace payload limit.
+	if o.TracePayloadLimit <= 0 {
+		o.TracePayloadLimit = defaultTracePayloadLimit
+	}
+
+	// Set the connect ticket lifetime.
+	if o.ConnectTicketMaxLifetime <= 0 {
+		o.ConnectTicketMaxLifetime = defaultConnectTicketMaxLifetime
+	}
+
+	// Set the message store.
+	if o.Store == nil {
+		o.Store = NewMemoryStore()
+	}
+
+	// Set the webhook retries and workers.
+	if o.WebhookRetries == 0 {
+		o.WebhookRetries = 3
+	}
+	if o.WebhookWorkers <= 0 {
+		o.WebhookWorkers = defaultWebhookWorkers
+	}
+	if o.WebhookQueueSize <= 0 {
+		o.WebhookQueueSize = defaultWebhookQueueSize
+	}
+
 	// Set the default check origin function if not set.
 	if o.CheckOrigin == nil {
 		o.CheckOrigin = checkSameOrigin
 	}
 }
 
+// Validate returns a descriptive error if the options are misconfigured.
+// Unset values are valid and replaced by the defaults. Validate the options
+// before the defaults are set, because SetDefaults replaces invalid values
+// silently. See the NewServerWithError function.
+func (o *Options) Validate() error {
+	// Check the HTTP server options.
+	switch o.HTTPSocketType {
+	case 0, HTTPSocketTypeNone, HTTPSocketTypeTCP:
+	case HTTPSocketTypeUnix:
+		if len(o.HTTPListenAddress) == 0 {
+			return fmt.Errorf("the unix socket type requires the socket path as HTTPListenAddress")
+		}
+	default:
+		return fmt.Errorf("invalid HTTPSocketType: %v", o.HTTPSocketType)
+	}
+
+	if (len(o.TLSCertFile) > 0) != (len(o.TLSKeyFile) > 0) {
+		return fmt.Errorf("TLS requires both the TLSCertFile and the TLSKeyFile option")
+	}
+
+	if len(o.HTTPHandleURL) > 0 && !strings.HasPrefix(o.HTTPHandleURL, "/") {
+		return fmt.Errorf("invalid HTTPHandleURL: %q: the URL path must start with a slash", o.HTTPHandleURL)
+	}
+
+	// The default origin check only allows the same origin.
+	if o.EnableCORS && o.CheckOrigin == nil {
+		return fmt.Errorf("EnableCORS requires a CheckOrigin function which allows the cross origins")
+	}
+
+	if len(o.ClientVersionRange) > 0 {
+		if _, err := semver.ParseRange(o.ClientVersionRange); err != nil {
+			return fmt.Errorf("invalid ClientVersionRange: %v", err)
+		}
+	}
+
+	if o.StrictClientVersion && !o.ServeClient {
+		return fmt.Errorf("StrictClientVersion requires the ServeClient option")
+	}
+
+	// Check the durations.
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"AjaxPollTimeout", o.AjaxPollTimeout},
+		{"AjaxPollDelay", o.AjaxPollDelay},
+		{"AjaxPushRetryDelay", o.AjaxPushRetryDelay},
+		{"AjaxReadTimeout", o.AjaxReadTimeout},
+		{"HandshakeRateInterval", o.HandshakeRateInterval},
+		{"HandshakeBanDuration", o.HandshakeBanDuration},
+		{"IdleTimeout", o.IdleTimeout},
+		{"IdleWarning", o.IdleWarning},
+		{"MaxSessionDuration", o.MaxSessionDuration},
+		{"ConnectTicketMaxLifetime", o.ConnectTicketMaxLifetime},
+		{"PingInterval", o.PingInterval},
+		{"PingTimeout", o.PingTimeout},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			return fmt.Errorf("invalid %s: %v: must not be negative", d.name, d.value)
+		}
+	}
+
+	// Check the limits.
+	limits := []struct {
+		name  string
+		value int64
+	}{
+		{"AjaxPushRetries", int64(o.AjaxPushRetries)},
+		{"AjaxMaxBodySize", o.AjaxMaxBodySize},
+		{"TracePayloadLimit", int64(o.TracePayloadLimit)},
+		{"ReadWorkers", int64(o.ReadWorkers)},
+		{"DeadLetterQueueSize", int64(o.DeadLetterQueueSize)},
+		{"DedupWindowSize", int64(o.DedupWindowSize)},
+		{"WebhookWorkers", int64(o.WebhookWorkers)},
+		{"WebhookQueueSize", int64(o.WebhookQueueSize)},
+		{"MaxEgressBandwidth", o.MaxEgressBandwidth},
+		{"SocketBandwidthLimit", o.SocketBandwidthLimit},
+		{"MaxConnections", int64(o.MaxConnections)},
+		{"MaxMuxSockets", int64(o.MaxMuxSockets)},
+		{"HandshakeRateLimit", int64(o.HandshakeRateLimit)},
+		{"ConnectionsHighWatermark", int64(o.ConnectionsHighWatermark)},
+		{"ConnectionsLowWatermark", int64(o.ConnectionsLowWatermark)},
+	}
+	for _, l := range limits {
+		if l.value < 0 {
+			return fmt.Errorf("invalid %s: %v: must not be negative", l.name, l.value)
+		}
+	}
+
+	if o.ConnectionsLowWatermark > 0 && o.ConnectionsLowWatermark >= o.ConnectionsHighWatermark {
+		return fmt.Errorf("invalid ConnectionsLowWatermark: %v: must be lower than the ConnectionsHighWatermark %v", o.ConnectionsLowWatermark, o.ConnectionsHighWatermark)
+	}
+	if o.MaxConnections > 0 && o.ConnectionsHighWatermark > o.MaxConnections {
+		return fmt.Errorf("invalid ConnectionsHighWatermark: %v: must not exceed the MaxConnections %v", o.ConnectionsHighWatermark, o.MaxConnections)
+	}
+
+	if o.WebhookRetries < -1 {
+		return fmt.Errorf("invalid WebhookRetries: %v: set -1 to disable retries", o.WebhookRetries)
+	}
+
+	if o.IdleTimeout > 0 && o.IdleWarning >= o.IdleTimeout {
+		return fmt.Errorf("invalid IdleWarning: %v: must be shorter than the IdleTimeout %v", o.IdleWarning, o.IdleTimeout)
+	}
+	if o.IdleWarning > 0 && o.IdleTimeout == 0 {
+		return fmt.Errorf("IdleWarning requires the IdleTimeout option")
+	}
+
+	switch o.DuplicateUserPolicy {
+	case DuplicateUserAllow, DuplicateUserCloseOldest, DuplicateUserRejectNew:
+	default:
+		return fmt.Errorf("invalid DuplicateUserPolicy: %v", o.DuplicateUserPolicy)
+	}
+
+	switch o.SocketIDMode {
+	case SocketIDRandom, SocketIDSortable:
+	default:
+		return fmt.Errorf("invalid SocketIDMode: %v", o.SocketIDMode)
+	}
+	if err := validSocketIDPrefix(o.SocketIDPrefix); err != nil {
+		return fmt.Errorf("invalid SocketIDPrefix: %q: %v", o.SocketIDPrefix, err)
+	}
+
+	// Check the webhook options.
+	if len(o.WebhookURL) > 0 {
+		if u, err := url.Parse(o.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid WebhookURL: %q: an absolute http or https URL is required", o.WebhookURL)
+		}
+	} else if len(o.WebhookSecret) > 0 {
+		return fmt.Errorf("WebhookSecret requires the WebhookURL option")
+	}
+
+	if len(o.RoutingName) > 0 && strings.ContainsAny(o.RoutingName, " \t;,=\"") {
+		return fmt.Errorf("invalid RoutingName: %q: not a valid cookie name", o.RoutingName)
+	}
+
+	// Check the log levels.
+	levels := []struct {
+		name  string
+		level string
+	}{
+		{"LogLevel", o.LogLevel},
+		{"BackendLogLevel", o.BackendLogLevel},
+		{"ProtocolLogLevel", o.ProtocolLogLevel},
+		{"KeepaliveLogLevel", o.KeepaliveLogLevel},
+	}
+	for _, l := range levels {
+		if len(l.level) == 0 {
+			continue
+		}
+		if _, err := log.ParseLevel(l.level); err != nil {
+			return fmt.Errorf("invalid %s: %v", l.name, err)
+		}
+	}
+
+	return nil
+}
+
 //###############//
 //### Private ###//
 //###############//
@@ -121,3 +714,30 @@ func checkSameOrigin(r *http.Request) bool {
 	}
 	return u.Host == r.Host
 }
+
+// setLogLevels applies the log level options to the glue loggers.
+// Invalid levels are logged and ignored.
+func setLogLevels(o *Options) {
+	levels := []struct {
+		name   string
+		logger *logrus.Logger
+		level  string
+	}{
+		{"LogLevel", log.L, o.LogLevel},
+		{"BackendLogLevel", log.Backend, o.BackendLogLevel},
+		{"ProtocolLogLevel", log.Protocol, o.ProtocolLogLevel},
+		{"KeepaliveLogLevel", log.Keepalive, o.KeepaliveLogLevel},
+	}
+
+	for _, l := range levels {
+		if len(l.level) == 0 {
+			continue
+		}
+
+		if err := log.SetLevel(l.logger, l.level); err != nil {
+			log.L.WithFields(logrus.Fields{
+				"option": l.name,
+			}).Warningf("glue: options: %v", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	allowAll := func(r *http.Request) bool { return true }
+
+	tests := []struct {
+		name    string
+		options Options
+		err     string // A part of the expected error. Empty if valid.
+	}{
+		{"zero options", Options{}, ""},
+		{"unix socket", Options{HTTPSocketType: HTTPSocketTypeUnix, HTTPListenAddress: "/tmp/glue.sock"}, ""},
+		{"unix socket without path", Options{HTTPSocketType: HTTPSocketTypeUnix}, "requires the socket path"},
+		{"invalid socket type", Options{HTTPSocketType: 3}, "invalid HTTPSocketType"},
+		{"tls", Options{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}, ""},
+		{"tls without key", Options{TLSCertFile: "cert.pem"}, "TLS requires both"},
+		{"tls without cert", Options{TLSKeyFile: "key.pem"}, "TLS requires both"},
+		{"handle url", Options{HTTPHandleURL: "/socket/"}, ""},
+		{"relative handle url", Options{HTTPHandleURL: "socket/"}, "invalid HTTPHandleURL"},
+		{"cors", Options{EnableCORS: true, CheckOrigin: allowAll}, ""},
+		{"cors without check origin", Options{EnableCORS: true}, "EnableCORS requires"},
+		{"version range", Options{ClientVersionRange: ">=2.0.0 <3.0.0"}, ""},
+		{"invalid version range", Options{ClientVersionRange: "two"}, "invalid ClientVersionRange"},
+		{"strict client version", Options{ServeClient: true, StrictClientVersion: true}, ""},
+		{"strict client version without client", Options{StrictClientVersion: true}, "requires the ServeClient option"},
+		{"negative duration", Options{PingTimeout: -time.Second}, "invalid PingTimeout"},
+		{"negative limit", Options{MaxConnections: -1}, "invalid MaxConnections"},
+		{"watermarks", Options{MaxConnections: 100, ConnectionsHighWatermark: 90, ConnectionsLowWatermark: 80}, ""},
+		{"low watermark above high", Options{ConnectionsHighWatermark: 80, ConnectionsLowWatermark: 90}, "invalid ConnectionsLowWatermark"},
+		{"high watermark above max", Options{MaxConnections: 80, ConnectionsHighWatermark: 90}, "invalid ConnectionsHighWatermark"},
+		{"webhook retries disabled", Options{WebhookRetries: -1}, ""},
+		{"invalid webhook retries", Options{WebhookRetries: -2}, "invalid WebhookRetries"},
+		{"idle warning", Options{IdleTimeout: time.Minute, IdleWarning: time.Second}, ""},
+		{"idle warning too long", Options{IdleTimeout: time.Minute, IdleWarning: time.Minute}, "invalid IdleWarning"},
+		{"idle warning without timeout", Options{IdleWarning: time.Second}, "requires the IdleTimeout option"},
+		{"invalid duplicate user policy", Options{DuplicateUserPolicy: 3}, "invalid DuplicateUserPolicy"},
+		{"socket id mode", Options{SocketIDMode: SocketIDSortable, SocketIDPrefix: "node_1."}, ""},
+		{"invalid socket id mode", Options{SocketIDMode: 5}, "invalid SocketIDMode"},
+		{"invalid socket id prefix", Options{SocketIDPrefix: "node-1"}, "invalid SocketIDPrefix"},
+		{"webhook", Options{WebhookURL: "https://example.com/hook", WebhookSecret: "secret"}, ""},
+		{"relative webhook url", Options{WebhookURL: "/hook"}, "invalid WebhookURL"},
+		{"webhook secret without url", Options{WebhookSecret: "secret"}, "WebhookSecret requires"},
+		{"invalid routing name", Options{RoutingName: "glue route"}, "invalid RoutingName"},
+		{"log levels", Options{LogLevel: "debug", KeepaliveLogLevel: "warning"}, ""},
+		{"invalid log level", Options{BackendLogLevel: "loud"}, "invalid BackendLogLevel"},
+	}
+
+	for _, test := range tests {
+		err := test.options.Validate()
+		if len(test.err) == 0 && err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected error %q: %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestOptionsSetDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		check   func(o *Options) bool
+	}{
+		{"handle url", Options{}, func(o *Options) bool { return o.HTTPHandleURL == "/glue/" }},
+		{"handle url slash", Options{HTTPHandleURL: "/socket"}, func(o *Options) bool { return o.HTTPHandleURL == "/socket/" }},
+		{"low watermark", Options{ConnectionsHighWatermark: 100}, func(o *Options) bool { return o.ConnectionsLowWatermark == 90 }},
+		{"idle warning", Options{IdleTimeout: time.Hour}, func(o *Options) bool { return o.IdleWarning == defaultIdleWarning }},
+		{"short idle warning", Options{IdleTimeout: time.Minute}, func(o *Options) bool { return o.IdleWarning == 30*time.Second }},
+		{"webhook retries", Options{}, func(o *Options) bool { return o.WebhookRetries == 3 }},
+		{"webhook retries disabled", Options{WebhookRetries: -1}, func(o *Options) bool { return o.WebhookRetries == -1 }},
+	}
+
+	for _, test := range tests {
+		o := test.options
+		o.SetDefaults()
+		if !test.check(&o) {
+			t.Errorf("%s: unexpected options: %+v", test.name, o)
+		}
+	}
+}
+
+func TestNewServerWithError(t *testing.T) {
+	if _, err := NewServerWithError(Options{IdleWarning: time.Second}); err == nil || !strings.HasPrefix(err.Error(), "glue: invalid options: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server, err := NewServerWithError(Options{HTTPSocketType: HTTPSocketTypeNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Release()
+}
@@ -0,0 +1,478 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The prefixes of the presence keys. The topic keys
+	// hold the topic name and the user ID separated by a NUL.
+	presenceUserPrefix  = "u:"
+	presenceTopicPrefix = "t:"
+
+	// The tombstones of left nodes are kept for this duration.
+	presenceTombstoneTTL = time.Hour
+
+	presenceIncarnationLength = 16
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// Presence holds the connected sockets of a user.
+type Presence struct {
+	// Nodes maps the IDs of the nodes the user is connected to
+	// to the number of connected sockets. The local node has
+	// the empty ID without cluster mode.
+	Nodes map[string]int
+}
+
+// Online returns true if at least one socket of the user is connected.
+func (p Presence) Online() bool {
+	return len(p.Nodes) > 0
+}
+
+// Sockets returns the number of connected sockets of the user.
+func (p Presence) Sockets() int {
+	n := 0
+	for _, count := range p.Nodes {
+		n += count
+	}
+	return n
+}
+
+//#####################//
+//### Presence type ###//
+//#####################//
+
+// A presenceMessage is passed with the data of the presence cluster messages.
+type presenceMessage struct {
+	// Incarnation identifies the lifetime of the sender node.
+	// It changes if the node restarts with the same ID.
+	Incarnation string `json:"i"`
+
+	// Seq orders the updates of the sender. A snapshot
+	// holds all entries up to its sequence number.
+	Seq uint64 `json:"s"`
+
+	Key     string         `json:"k,omitempty"`
+	Count   int            `json:"c,omitempty"`
+	Entries map[string]int `json:"e,omitempty"`
+}
+
+type presenceEntry struct {
+	count int
+	seq   uint64
+}
+
+// The replicated presence entries of a remote node.
+type presenceNode struct {
+	incarnation string
+	entries     map[string]presenceEntry
+}
+
+// presence replicates the local user and topic member counts to all
+// cluster nodes. Each node sends the changes of its own entries, which
+// are applied in the order of their sequence numbers. Joined nodes get
+// a snapshot. The entries of left nodes are removed and their incarnation
+// is tombstoned, so delayed messages of crashed nodes are dropped.
+type presence struct {
+	c           *cluster
+	incarnation string
+
+	seq        uint64
+	local      map[string]int
+	nodes      map[string]*presenceNode
+	tombstones map[string]time.Time // The left incarnations with their removal time.
+	active     map[string]struct{}  // The active nodes.
+	mutex      sync.Mutex
+}
+
+func newPresence(c *cluster) *presence {
+	return &presence{
+		c:           c,
+		incarnation: utils.RandomString(presenceIncarnationLength),
+		local:       make(map[string]int),
+		nodes:       make(map[string]*presenceNode),
+		tombstones:  make(map[string]time.Time),
+		active:      make(map[string]struct{}),
+	}
+}
+
+// start requests the snapshots of all other nodes.
+func (p *presence) start() {
+	nodes := p.c.adapter.Nodes()
+
+	func() {
+		// Lock the mutex.
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		for _, node := range nodes {
+			p.active[node] = struct{}{}
+		}
+	}()
+
+	p.broadcast(&ClusterMessage{Type: clusterPresenceRequest})
+}
+
+// set sets the local count of the key and returns the update message,
+// which has to be broadcasted with the broadcast method. Call set with
+// the lock of the counted index held and broadcast after releasing it.
+func (p *presence) set(key string, count int) *ClusterMessage {
+	// Lock the mutex.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.local[key] == count {
+		return nil
+	}
+
+	if count > 0 {
+		p.local[key] = count
+	} else {
+		delete(p.local, key)
+	}
+	p.seq++
+
+	return p.message(clusterPresenceUpdate, &presenceMessage{
+		Incarnation: p.incarnation,
+		Seq:         p.seq,
+		Key:         key,
+		Count:       count,
+	})
+}
+
+// snapshot returns the snapshot message of the local entries.
+func (p *presence) snapshot() *ClusterMessage {
+	// Lock the mutex.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	entries := make(map[string]int, len(p.local))
+	for key, count := range p.local {
+		entries[key] = count
+	}
+
+	return p.message(clusterPresenceSnapshot, &presenceMessage{
+		Incarnation: p.incarnation,
+		Seq:         p.seq,
+		Entries:     entries,
+	})
+}
+
+func (p *presence) message(t string, pm *presenceMessage) *ClusterMessage {
+	data, _ := json.Marshal(pm)
+
+	return &ClusterMessage{
+		Type: t,
+		Data: string(data),
+	}
+}
+
+// broadcast sends the messages to all other nodes. Nil messages are skipped.
+func (p *presence) broadcast(msgs ...*ClusterMessage) {
+	var nodes []string
+
+	for _, m := range msgs {
+		if m == nil {
+			continue
+		}
+
+		if nodes == nil {
+			nodes = p.c.adapter.Nodes()
+		}
+
+		for _, node := range nodes {
+			if node != p.c.nodeID {
+				p.c.send(node, m)
+			}
+		}
+	}
+}
+
+// handleMessage applies the presence messages of other nodes.
+func (p *presence) handleMessage(from string, m *ClusterMessage) {
+	if m.Type == clusterPresenceRequest {
+		p.c.send(from, p.snapshot())
+		return
+	}
+
+	var pm presenceMessage
+	if err := json.Unmarshal([]byte(m.Data), &pm); err != nil {
+		log.L.WithFields(logrus.Fields{
+			"node": from,
+			"type": m.Type,
+		}).Warningf("received invalid presence cluster message: %v", err)
+		return
+	}
+
+	// Lock the mutex.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// The snapshot of a joined node is requested as soon as it is active.
+	if _, ok := p.active[from]; !ok {
+		return
+	}
+
+	// Drop the delayed updates of left nodes. A snapshot revives
+	// the incarnation of a node which rejoined after a partition.
+	if _, ok := p.tombstones[pm.Incarnation]; ok {
+		if m.Type != clusterPresenceSnapshot {
+			return
+		}
+		delete(p.tombstones, pm.Incarnation)
+	}
+
+	// Replace the entries of a previous incarnation of the node.
+	n, ok := p.nodes[from]
+	if !ok || n.incarnation != pm.Incarnation {
+		if ok {
+			p.tombstones[n.incarnation] = time.Now()
+		}
+
+		n = &presenceNode{
+			incarnation: pm.Incarnation,
+			entries:     make(map[string]presenceEntry),
+		}
+		p.nodes[from] = n
+	}
+
+	switch m.Type {
+	case clusterPresenceUpdate:
+		// Skip outdated updates. Zero counts are kept, so
+		// delayed updates don't restore removed entries.
+		if e, ok := n.entries[pm.Key]; ok && e.seq >= pm.Seq {
+			return
+		}
+		n.entries[pm.Key] = presenceEntry{count: pm.Count, seq: pm.Seq}
+
+	case clusterPresenceSnapshot:
+		// Keep the entries of newer updates only.
+		for key, e := range n.entries {
+			if e.seq <= pm.Seq {
+				delete(n.entries, key)
+			}
+		}
+
+		for key, count := range pm.Entries {
+			if _, ok := n.entries[key]; !ok {
+				n.entries[key] = presenceEntry{count: count, seq: pm.Seq}
+			}
+		}
+	}
+}
+
+// nodesChanged removes the entries of the left nodes. The snapshots
+// are exchanged with the joined nodes.
+func (p *presence) nodesChanged(nodes []string) {
+	var joined []string
+
+	func() {
+		// Lock the mutex.
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		active := make(map[string]struct{}, len(nodes))
+		for _, node := range nodes {
+			active[node] = struct{}{}
+
+			if _, ok := p.active[node]; !ok && node != p.c.nodeID {
+				joined = append(joined, node)
+			}
+		}
+		p.active = active
+
+		now := time.Now()
+
+		for node, n := range p.nodes {
+			if _, ok := active[node]; !ok {
+				p.tombstones[n.incarnation] = now
+				delete(p.nodes, node)
+			}
+		}
+
+		// Remove the expired tombstones.
+		for incarnation, t := range p.tombstones {
+			if now.Sub(t) > presenceTombstoneTTL {
+				delete(p.tombstones, incarnation)
+			}
+		}
+	}()
+
+	if len(joined) == 0 {
+		return
+	}
+
+	snapshot := p.snapshot()
+	for _, node := range joined {
+		p.c.send(node, snapshot)
+		p.c.send(node, &ClusterMessage{Type: clusterPresenceRequest})
+	}
+}
+
+// counts returns the counts of the key by the remote nodes.
+func (p *presence) counts(key string) map[string]int {
+	// Lock the mutex.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	counts := make(map[string]int)
+	for node, n := range p.nodes {
+		if e := n.entries[key]; e.count > 0 {
+			counts[node] = e.count
+		}
+	}
+
+	return counts
+}
+
+// topicMembers adds the user IDs of the topic members of the remote nodes.
+func (p *presence) topicMembers(topic string, members map[string]struct{}) {
+	prefix := presenceTopicPrefix + topic + "\x00"
+
+	// Lock the mutex.
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, n := range p.nodes {
+		for key, e := range n.entries {
+			if e.count > 0 && strings.HasPrefix(key, prefix) {
+				members[key[len(prefix):]] = struct{}{}
+			}
+		}
+	}
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+func presenceUserKey(userID string) string {
+	return presenceUserPrefix + userID
+}
+
+func presenceTopicKey(topic, userID string) string {
+	return presenceTopicPrefix + topic + "\x00" + userID
+}
+
+// setPresence sets the local count of the presence key. The returned
+// message has to be passed to broadcastPresence. Nil is returned
+// without cluster mode.
+func (s *Server) setPresence(key string, count int) *ClusterMessage {
+	if s.cluster == nil {
+		return nil
+	}
+
+	return s.cluster.presence.set(key, count)
+}
+
+// broadcastPresence passes the presence updates to the other cluster nodes.
+func (s *Server) broadcastPresence(msgs ...*ClusterMessage) {
+	if s.cluster == nil {
+		return
+	}
+
+	s.cluster.presence.broadcast(msgs...)
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// Presence returns the connected sockets of the user. In cluster mode,
+// the sockets of all nodes are included. The presence of other nodes is
+// replicated with eventual consistency and might be delayed shortly.
+func (s *Server) Presence(userID string) Presence {
+	p := Presence{
+		Nodes: make(map[string]int),
+	}
+
+	if s.cluster != nil {
+		p.Nodes = s.cluster.presence.counts(presenceUserKey(userID))
+	}
+
+	// Count the open local sockets.
+	local := 0
+	for _, socket := range s.SocketsByUserID(userID) {
+		if !socket.IsClosed() {
+			local++
+		}
+	}
+
+	if local > 0 {
+		node := ""
+		if s.cluster != nil {
+			node = s.cluster.nodeID
+		}
+		p.Nodes[node] = local
+	}
+
+	return p
+}
+
+//##############################//
+//### Public Topic methods ###//
+//##############################//
+
+// Members returns the sorted user IDs of the sockets subscribed to the topic.
+// Sockets without user ID are skipped. The user ID at the time of the
+// subscription is used. In cluster mode, the members of all nodes are
+// included with eventual consistency.
+func (t *Topic) Members() []string {
+	members := make(map[string]struct{})
+
+	func() {
+		// Lock the mutex.
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		for userID := range t.members {
+			members[userID] = struct{}{}
+		}
+	}()
+
+	if c := t.server.cluster; c != nil {
+		c.presence.topicMembers(t.name, members)
+	}
+
+	list := make([]string, 0, len(members))
+	for userID := range members {
+		list = append(list, userID)
+	}
+	sort.Strings(list)
+
+	return list
+}
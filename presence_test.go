@@ -0,0 +1,153 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newClusterTestServer creates a server joining the memory cluster.
+func newClusterTestServer(t *testing.T, mc *MemoryCluster, node string) *Server {
+	t.Helper()
+
+	return newTestServer(t, Options{Cluster: mc.Join(node)})
+}
+
+// waitForPresence waits until the presence of the user matches the node counts.
+func waitForPresence(t *testing.T, s *Server, userID string, nodes map[string]int) {
+	t.Helper()
+
+	waitFor(t, 2*time.Second, func() bool {
+		return reflect.DeepEqual(s.Presence(userID).Nodes, nodes)
+	})
+}
+
+func TestPresence(t *testing.T) {
+	server := newTestServer(t)
+	_, s := connectTestSocket(t, server)
+
+	if server.Presence("alice").Online() {
+		t.Fatal("unknown user is online")
+	}
+
+	s.SetUserID("alice")
+	if p := server.Presence("alice"); !p.Online() || p.Sockets() != 1 || p.Nodes[""] != 1 {
+		t.Fatalf("unexpected presence: %+v", p)
+	}
+
+	topic := server.Topic("room")
+	topic.Subscribe(s)
+	if m := topic.Members(); !reflect.DeepEqual(m, []string{"alice"}) {
+		t.Fatalf("unexpected members: %v", m)
+	}
+
+	s.Close()
+	waitFor(t, time.Second, func() bool {
+		return !server.Presence("alice").Online() && len(topic.Members()) == 0
+	})
+}
+
+func TestPresenceCluster(t *testing.T) {
+	mc := NewMemoryCluster()
+	a := newClusterTestServer(t, mc, "a")
+	b := newClusterTestServer(t, mc, "b")
+
+	_, sa := connectTestSocket(t, a)
+	sa.SetUserID("alice")
+	a.Topic("room").Subscribe(sa)
+
+	_, sb := connectTestSocket(t, b)
+	sb.SetUserID("alice")
+
+	waitForPresence(t, b, "alice", map[string]int{"a": 1, "b": 1})
+	waitForPresence(t, a, "alice", map[string]int{"a": 1, "b": 1})
+
+	waitFor(t, 2*time.Second, func() bool {
+		return reflect.DeepEqual(b.Topic("room").Members(), []string{"alice"})
+	})
+
+	// A late joiner receives the snapshots of the other nodes.
+	c := newClusterTestServer(t, mc, "c")
+	waitForPresence(t, c, "alice", map[string]int{"a": 1, "b": 1})
+
+	// Changes are replicated.
+	sb.SetUserID("bob")
+	waitForPresence(t, c, "alice", map[string]int{"a": 1})
+	waitForPresence(t, c, "bob", map[string]int{"b": 1})
+
+	sa.Close()
+	waitForPresence(t, c, "alice", map[string]int{})
+	waitFor(t, 2*time.Second, func() bool {
+		return len(c.Topic("room").Members()) == 0
+	})
+}
+
+func TestPresenceTombstones(t *testing.T) {
+	mc := NewMemoryCluster()
+	a := newClusterTestServer(t, mc, "a")
+	b := newClusterTestServer(t, mc, "b")
+
+	_, sa := connectTestSocket(t, a)
+	sa.SetUserID("alice")
+	waitForPresence(t, b, "alice", map[string]int{"a": 1})
+
+	// Capture an update of the first incarnation of node a.
+	delayed := a.cluster.presence.set(presenceUserKey("carol"), 1)
+
+	// The entries of crashed nodes are removed.
+	mc.Leave("a")
+	waitForPresence(t, b, "alice", map[string]int{})
+
+	// The node restarts with the same ID.
+	a2 := newClusterTestServer(t, mc, "a")
+	_, s2 := connectTestSocket(t, a2)
+	s2.SetUserID("dave")
+	waitForPresence(t, b, "dave", map[string]int{"a": 1})
+
+	// The delayed update of the crashed incarnation is dropped.
+	b.cluster.presence.handleMessage("a", delayed)
+	if p := b.Presence("carol"); p.Online() {
+		t.Fatalf("delayed update applied: %+v", p)
+	}
+	waitForPresence(t, b, "dave", map[string]int{"a": 1})
+}
+
+func TestPresenceOutOfOrder(t *testing.T) {
+	mc := NewMemoryCluster()
+	a := newClusterTestServer(t, mc, "a")
+	b := newClusterTestServer(t, mc, "b")
+
+	// Wait for the snapshot exchange.
+	_, sa := connectTestSocket(t, a)
+	sa.SetUserID("alice")
+	waitForPresence(t, b, "alice", map[string]int{"a": 1})
+
+	online := a.cluster.presence.set(presenceUserKey("carol"), 2)
+	offline := a.cluster.presence.set(presenceUserKey("carol"), 0)
+
+	// Outdated updates don't restore removed entries.
+	b.cluster.presence.handleMessage("a", offline)
+	b.cluster.presence.handleMessage("a", online)
+
+	if p := b.Presence("carol"); p.Online() {
+		t.Fatalf("outdated update applied: %+v", p)
+	}
+}
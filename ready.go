@@ -0,0 +1,122 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The URL path of the readiness endpoint appended to the HTTP handle URL.
+	httpURLReadySuffix = "ready"
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+// Readiness errors:
+var (
+	ErrServerBlocked  = errors.New("the server blocks new connections")
+	ErrMaintenance    = errors.New("the server is in maintenance mode")
+	ErrMaxConnections = errors.New("the maximum number of connections is reached")
+)
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// Ready returns nil if the server accepts new socket connections.
+// ErrServerBlocked is returned in block mode, which is also set during
+// maintenance and by the Release method. ErrMaintenance is returned if the
+// maintenance mode is enabled with SetMaintenance. ErrMaxConnections is returned
+// if the MaxConnections option is exceeded.
+func (s *Server) Ready() error {
+	if s.IsBlocked() {
+		return ErrServerBlocked
+	}
+
+	if len(s.Maintenance()) > 0 {
+		return ErrMaintenance
+	}
+
+	if s.isAtCapacity() {
+		return ErrMaxConnections
+	}
+
+	return nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// isAtCapacity returns true if the maximum number of connections is reached.
+func (s *Server) isAtCapacity() bool {
+	max := s.maxConnections()
+	if max <= 0 {
+		return false
+	}
+
+	// Lock the mutex.
+	s.socketsMutex.Lock()
+	defer s.socketsMutex.Unlock()
+
+	return len(s.sockets) >= max
+}
+
+// isReadyRequest returns true if the request targets the readiness endpoint.
+func (s *Server) isReadyRequest(r *http.Request) bool {
+	return r.URL.Path == s.options.HTTPHandleURL+httpURLReadySuffix
+}
+
+// serveReady responds with the status code 200 if the server is ready and
+// with 503 otherwise, so load balancers stop routing new clients to a draining node.
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if err := s.Ready(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, err.Error())
+		return
+	}
+
+	io.WriteString(w, "ready")
+}
+
+// isOverCapacity returns true if the maximum number of connections is exceeded.
+func (s *Server) isOverCapacity() bool {
+	max := s.maxConnections()
+	if max <= 0 {
+		return false
+	}
+
+	// Lock the mutex.
+	s.socketsMutex.Lock()
+	defer s.socketsMutex.Unlock()
+
+	return len(s.sockets) > max
+}
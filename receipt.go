@@ -0,0 +1,162 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used to transmit messages
+	// requesting a receipt and the client acknowledgements.
+	receiptChannelName = "_ack"
+
+	// The maximum number of receipts of a socket waiting
+	// for the acknowledgement of the client.
+	maxPendingReceipts = 1024
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+// ErrTooManyReceipts is returned by WriteWithReceipt if too many receipts
+// of the socket are not acknowledged yet. The client is either too slow or
+// doesn't acknowledge the receipts at all.
+var ErrTooManyReceipts = errors.New("too many pending receipts")
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A ReceiptChan receives exactly one value as soon as the delivery of a
+// message is resolved: nil if the client acknowledged the receipt and
+// ErrSocketClosed if the socket closed before. The channel is closed afterwards.
+type ReceiptChan <-chan error
+
+//###############################//
+//### Public Channel methods ###//
+//###############################//
+
+// WriteWithReceipt writes data to the channel and requests a receipt.
+// The client acknowledges the receipt after the data was passed to the
+// channel's message handlers. Wait on the returned channel with a timeout
+// to mark business-critical messages as delivered or to escalate them.
+// ErrSocketClosed is returned, if the socket connection is closed and
+// ErrTooManyReceipts if the client didn't acknowledge the previous receipts.
+func (c *Channel) WriteWithReceipt(data string) (ReceiptChan, error) {
+	return c.s.writeWithReceipt(c.name, data)
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// WriteWithReceipt writes data to the main channel and requests a receipt.
+// See the channel WriteWithReceipt method for details.
+func (s *Socket) WriteWithReceipt(data string) (ReceiptChan, error) {
+	return s.mainChannel.WriteWithReceipt(data)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+func (s *Socket) writeWithReceipt(name, data string) (ReceiptChan, error) {
+	s.touch()
+
+	// Buffered to never block the read loop.
+	receipt := make(chan error, 1)
+
+	// Register the pending receipt.
+	id, err := func() (string, error) {
+		// Lock the mutex.
+		s.receiptMutex.Lock()
+		defer s.receiptMutex.Unlock()
+
+		// The receipts are resolved on close.
+		// Don't add new ones afterwards.
+		if s.IsClosed() {
+			return "", ErrSocketClosed
+		}
+
+		// Don't grow the pending receipts unbounded if
+		// the client doesn't acknowledge them.
+		if len(s.receipts) >= maxPendingReceipts {
+			return "", ErrTooManyReceipts
+		}
+
+		s.receiptID++
+		id := strconv.FormatUint(s.receiptID, 10)
+		s.receipts[id] = receipt
+
+		return id, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// Send the receipt ID with the channel name and data.
+	s.write(cmdChannelData + utils.MarshalValues(receiptChannelName,
+		utils.MarshalValues(id, utils.MarshalValues(name, data))))
+
+	return receipt, nil
+}
+
+// handleReceipt handles the acknowledgements send by the client.
+// The data contains the ID of the acknowledged receipt.
+func (s *Socket) handleReceipt(id string) error {
+	// Lock the mutex.
+	s.receiptMutex.Lock()
+	defer s.receiptMutex.Unlock()
+
+	receipt, ok := s.receipts[id]
+	if !ok {
+		return fmt.Errorf("received acknowledgement for unknown receipt '%s'", id)
+	}
+
+	delete(s.receipts, id)
+
+	// Resolve the receipt.
+	receipt <- nil
+	close(receipt)
+
+	return nil
+}
+
+// closeReceipts resolves all pending receipts with the closed error.
+func (s *Socket) closeReceipts() {
+	// Lock the mutex.
+	s.receiptMutex.Lock()
+	defer s.receiptMutex.Unlock()
+
+	for id, receipt := range s.receipts {
+		receipt <- ErrSocketClosed
+		close(receipt)
+		delete(s.receipts, id)
+	}
+}
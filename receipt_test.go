@@ -0,0 +1,166 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+// receiveReceipt returns the ID, the channel name and the data
+// of the next message requesting a receipt.
+func receiveReceipt(t *testing.T, conn *MemoryConn) (id, name, data string) {
+	t.Helper()
+
+	reserved, values := receiveChannelData(t, conn)
+	if reserved != receiptChannelName {
+		t.Fatalf("unexpected channel: %q", reserved)
+	}
+
+	id, values, err := utils.UnmarshalValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, data, err = utils.UnmarshalValues(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id, name, data
+}
+
+// waitReceipt returns the value of the resolved receipt.
+func waitReceipt(t *testing.T, receipt ReceiptChan) error {
+	t.Helper()
+
+	select {
+	case err, ok := <-receipt:
+		if !ok {
+			t.Fatal("receipt closed without a value")
+		}
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("receipt not resolved")
+	}
+
+	return nil
+}
+
+func TestWriteWithReceipt(t *testing.T) {
+	server := newTestServer(t)
+	conn, s := connectTestSocket(t, server)
+
+	receipt, err := s.Channel("orders").WriteWithReceipt("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, name, data := receiveReceipt(t, conn)
+	if name != "orders" || data != "42" {
+		t.Fatalf("unexpected message: %q %q", name, data)
+	}
+
+	// The receipt is pending until the client acknowledges it.
+	select {
+	case err := <-receipt:
+		t.Fatalf("receipt resolved without acknowledgement: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sendChannelData(t, conn, receiptChannelName, id)
+	if err := waitReceipt(t, receipt); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The channel is closed after the value.
+	if _, ok := <-receipt; ok {
+		t.Fatal("receipt not closed")
+	}
+}
+
+func TestWriteWithReceiptClosed(t *testing.T) {
+	server := newTestServer(t)
+	conn, s := connectTestSocket(t, server)
+
+	receipt, err := s.WriteWithReceipt("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiveReceipt(t, conn)
+
+	// Pending receipts are resolved on close.
+	s.Close()
+	if err := waitReceipt(t, receipt); err != ErrSocketClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := s.WriteWithReceipt("42"); err != ErrSocketClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWriteWithReceiptLimit(t *testing.T) {
+	server := newTestServer(t)
+	conn, s := connectTestSocket(t, server)
+
+	// Receive the messages concurrently, because
+	// the writes block if the write buffer is full.
+	ids := make(chan string, maxPendingReceipts)
+	go func() {
+		for i := 0; i < maxPendingReceipts; i++ {
+			frame, err := conn.Receive(5 * time.Second)
+			if err != nil {
+				return
+			}
+			_, values, _ := utils.UnmarshalValues(frame[cmdLen:])
+			id, _, _ := utils.UnmarshalValues(values)
+			ids <- id
+		}
+	}()
+
+	receipts := make([]ReceiptChan, maxPendingReceipts)
+	for i := range receipts {
+		var err error
+		if receipts[i], err = s.WriteWithReceipt("42"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The client doesn't acknowledge the receipts.
+	if _, err := s.WriteWithReceipt("42"); err != ErrTooManyReceipts {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An acknowledgement frees a slot.
+	select {
+	case id := <-ids:
+		sendChannelData(t, conn, receiptChannelName, id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no receipt received")
+	}
+	if err := waitReceipt(t, receipts[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := s.WriteWithReceipt("42"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,470 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The maximum duration a replay waits for the server
+	// to process the frames of a socket after the last frame.
+	replayDrainTimeout = 10 * time.Second
+
+	// The interval to check if the read handlers took the replayed data.
+	replayPollInterval = 10 * time.Millisecond
+
+	// The number of frames buffered for the writer of a recorder.
+	recorderQueueSize = 4096
+)
+
+//######################//
+//### Recorded Frame ###//
+//######################//
+
+// A RecordedFrame is a single frame of a recording. Recordings are stored
+// as JSON lines. Binary channel data is stored base64 encoded, as sent
+// by the socket types without binary support.
+type RecordedFrame struct {
+	// Offset is the duration since the recorder was created.
+	Offset time.Duration `json:"offset"`
+
+	Socket    string         `json:"socket"`
+	Direction TraceDirection `json:"direction"`
+	Frame     string         `json:"frame"`
+
+	// The client details are set for the first frame of each socket.
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+	UserAgent  string `json:"userAgent,omitempty"`
+}
+
+// ReadRecording reads all frames of a recording.
+func ReadRecording(r io.Reader) ([]RecordedFrame, error) {
+	var frames []RecordedFrame
+
+	dec := json.NewDecoder(r)
+	for {
+		var f RecordedFrame
+		err := dec.Decode(&f)
+		if err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("read recording: %v", err)
+		}
+
+		frames = append(frames, f)
+	}
+}
+
+//#####################//
+//### Recorder type ###//
+//#####################//
+
+// A Recorder writes the frames of the recorded sockets with their timing
+// to a writer. Pass it to the Recorder option or start the recording of
+// single sockets with the socket StartRecording method. Recordings are
+// replayed with the server Replay method. The frames are buffered and
+// written by a single goroutine, so a slow writer doesn't block the sockets.
+// Frames are dropped and logged if the buffer is full.
+type Recorder struct {
+	w     io.Writer
+	c     io.Closer
+	start time.Time
+
+	records chan recordedLine
+	done    chan struct{} // Closed as soon as the buffered frames are written.
+
+	closed bool
+	mutex  sync.Mutex
+}
+
+// NewRecorder creates a new recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{
+		w:       w,
+		start:   time.Now(),
+		records: make(chan recordedLine, recorderQueueSize),
+		done:    make(chan struct{}),
+	}
+
+	go r.writeLoop()
+
+	return r
+}
+
+// CreateRecorder creates or truncates the file and returns a new recorder
+// writing to it. The file is closed with the recorder Close method.
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRecorder(f)
+	r.c = f
+
+	return r, nil
+}
+
+// Close stops the recording and waits until the buffered frames are
+// written. The file of the recorder is closed if present.
+func (r *Recorder) Close() error {
+	closed := func() bool {
+		// Lock the mutex.
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		if r.closed {
+			return true
+		}
+		r.closed = true
+
+		// Stop the writer after the buffered frames.
+		close(r.records)
+
+		return false
+	}()
+	if closed {
+		return nil
+	}
+
+	<-r.done
+
+	if r.c != nil {
+		return r.c.Close()
+	}
+
+	return nil
+}
+
+// A recordedLine is a marshaled frame buffered for the writer.
+type recordedLine struct {
+	socketID string
+	data     []byte
+}
+
+// write buffers the frame for the writer. This never blocks.
+func (r *Recorder) write(f RecordedFrame) {
+	// Lock the mutex to keep the offsets in order.
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	f.Offset = time.Since(r.start)
+
+	data, err := json.Marshal(&f)
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"socketID": f.Socket,
+		}).Warningf("failed to marshal recorded frame: %v", err)
+		return
+	}
+
+	select {
+	case r.records <- recordedLine{socketID: f.Socket, data: append(data, '\n')}:
+	default:
+		log.L.WithFields(logrus.Fields{
+			"socketID": f.Socket,
+		}).Warningf("recorder buffer is full: recorded frame lost")
+	}
+}
+
+// writeLoop writes the buffered frames until the recorder is closed.
+func (r *Recorder) writeLoop() {
+	defer close(r.done)
+
+	for l := range r.records {
+		if _, err := r.w.Write(l.data); err != nil {
+			log.L.WithFields(logrus.Fields{
+				"socketID": l.socketID,
+			}).Warningf("failed to write recorded frame: %v", err)
+		}
+	}
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// StartRecording records all following frames of the socket with the recorder.
+// A previous recording of the socket is stopped.
+func (s *Socket) StartRecording(r *Recorder) {
+	// Lock the mutex.
+	s.traceMutex.Lock()
+	defer s.traceMutex.Unlock()
+
+	s.recorder = r
+	s.recordClient = true
+}
+
+// StopRecording stops the recording of the socket.
+func (s *Socket) StopRecording() {
+	// Lock the mutex.
+	s.traceMutex.Lock()
+	defer s.traceMutex.Unlock()
+
+	s.recorder = nil
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// Replay feeds the received frames of a recording into the server. Each
+// recorded socket is replayed concurrently with a new in-memory connection.
+// The speed scales the recorded timing. A speed of 2 replays twice as fast
+// and a speed of zero or less sends the frames without any delay.
+// The frames sent by the server are discarded. Replay returns as soon
+// as all frames were processed by the server and the connections are closed.
+func (s *Server) Replay(rd io.Reader, speed float64) error {
+	frames, err := ReadRecording(rd)
+	if err != nil || len(frames) == 0 {
+		return err
+	}
+
+	// Group the frames by socket in the recorded order.
+	var ids []string
+	sockets := make(map[string][]RecordedFrame)
+	for _, f := range frames {
+		if _, ok := sockets[f.Socket]; !ok {
+			ids = append(ids, f.Socket)
+		}
+		sockets[f.Socket] = append(sockets[f.Socket], f)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ids))
+	r := replay{
+		start:  time.Now(),
+		offset: frames[0].Offset,
+		speed:  speed,
+	}
+
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, frames []RecordedFrame) {
+			defer wg.Done()
+			errs[i] = s.replaySocket(r, frames)
+		}(i, sockets[id])
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("replay socket %s: %v", ids[i], err)
+		}
+	}
+
+	return nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// A replay holds the timing of a running replay.
+type replay struct {
+	start  time.Time
+	offset time.Duration // The offset of the first recorded frame.
+	speed  float64
+}
+
+// wait blocks until the scaled offset of the recorded frame is reached.
+func (r replay) wait(offset time.Duration) {
+	if r.speed <= 0 {
+		return
+	}
+
+	d := time.Duration(float64(offset-r.offset)/r.speed) - time.Since(r.start)
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// record writes the raw frame to the recorder of the socket if present.
+func (s *Socket) record(direction TraceDirection, rawData string) {
+	// Lock the mutex.
+	s.traceMutex.Lock()
+	r := s.recorder
+	recordClient := s.recordClient
+	if r != nil {
+		s.recordClient = false
+	}
+	s.traceMutex.Unlock()
+
+	if r == nil {
+		return
+	}
+
+	f := RecordedFrame{
+		Socket:    s.id,
+		Direction: direction,
+		Frame:     s.recordedFrame(direction, rawData),
+	}
+
+	if recordClient {
+		f.RemoteAddr = s.RemoteAddr()
+		f.UserAgent = s.UserAgent()
+	}
+
+	r.write(f)
+}
+
+// recordedFrame returns the frame with base64 encoded binary channel data.
+func (s *Socket) recordedFrame(direction TraceDirection, rawData string) string {
+	if strings.HasPrefix(rawData, global.BinaryFrameMarker) {
+		rawData = rawData[len(global.BinaryFrameMarker):]
+	} else if direction == TraceSent || s.bs.Type() != global.TypeWebSocket {
+		// Only websockets transfer binary data without encoding.
+		return rawData
+	}
+
+	if len(rawData) < cmdLen || rawData[:cmdLen] != cmdChannelBinaryData {
+		return rawData
+	}
+
+	name, data, err := utils.UnmarshalValues(rawData[cmdLen:])
+	if err != nil {
+		return rawData
+	}
+
+	return cmdChannelBinaryData + utils.MarshalValues(name, base64.StdEncoding.EncodeToString([]byte(data)))
+}
+
+// replaySocket replays the frames of a single socket
+// with a new in-memory connection and closes it afterwards.
+func (s *Server) replaySocket(r replay, frames []RecordedFrame) error {
+	// Connect at the time of the first recorded frame.
+	r.wait(frames[0].Offset)
+
+	remoteAddr, userAgent := "replay", "replay"
+	if frames[0].RemoteAddr != "" {
+		remoteAddr, userAgent = frames[0].RemoteAddr, frames[0].UserAgent
+	}
+
+	conn := s.ConnectMemory(remoteAddr, userAgent)
+	defer conn.Close()
+
+	if conn.socket == nil {
+		return ErrServerBlocked
+	}
+
+	// Discard the frames of the server and answer its pings.
+	// The pongs of the server are counted to detect when all
+	// replayed frames were processed.
+	pongChan := make(chan struct{}, len(frames)+1)
+	go func() {
+		for {
+			frame, err := conn.Receive(time.Minute)
+			if err == ErrReadTimeout {
+				continue
+			} else if err != nil {
+				return
+			}
+
+			switch frame {
+			case cmdPing:
+				conn.Send(cmdPong)
+			case cmdPong:
+				pongChan <- struct{}{}
+			}
+		}
+	}()
+
+	// Initialize the socket if the recording started afterwards.
+	if !strings.HasPrefix(frames[0].Frame, cmdInit) || frames[0].Direction != TraceReceived {
+		data, err := json.Marshal(&clientInitData{Version: Version})
+		if err != nil {
+			return err
+		}
+
+		if err = conn.Send(cmdInit + string(data)); err != nil {
+			return err
+		}
+	}
+
+	pings := 0
+
+	for _, f := range frames {
+		if f.Direction != TraceReceived {
+			continue
+		}
+
+		// Wait for the recorded timing.
+		r.wait(f.Offset)
+
+		if f.Frame == cmdPing {
+			pings++
+		}
+
+		if err := conn.Send(f.Frame); err != nil {
+			return err
+		}
+	}
+
+	// The server replies to the final ping
+	// after all previous frames were processed.
+	if err := conn.Send(cmdPing); err != nil {
+		return err
+	}
+	pings++
+
+	timeout := time.NewTimer(replayDrainTimeout)
+	defer timeout.Stop()
+
+	for ; pings > 0; pings-- {
+		select {
+		case <-pongChan:
+		case <-timeout.C:
+			return ErrReadTimeout
+		}
+	}
+
+	// Wait until the read handlers took the received channel data.
+	// Otherwise closing the connection discards it.
+	for conn.socket.channels.pending() > 0 {
+		select {
+		case <-time.After(replayPollInterval):
+		case <-timeout.C:
+			return ErrReadTimeout
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks the writes until it is released.
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+	mutex   sync.Mutex
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+
+	// Lock the mutex.
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func TestRecorder(t *testing.T) {
+	server := newTestServer(t)
+
+	w := &blockingWriter{release: make(chan struct{})}
+	r := NewRecorder(w)
+
+	conn, s := connectTestSocket(t, server)
+	s.StartRecording(r)
+
+	// The sockets are not blocked by the writer.
+	s.Write("hello")
+	receiveChannelData(t, conn)
+	sendChannelData(t, conn, mainChannelName, "world")
+	if data, err := s.Read(5 * time.Second); err != nil || data != "world" {
+		t.Fatalf("unexpected read: %q %v", data, err)
+	}
+
+	// Close writes the buffered frames.
+	close(w.release)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := ReadRecording(&w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("unexpected frames: %+v", frames)
+	}
+	if f := frames[0]; f.Socket != s.ID() || f.Direction != TraceSent ||
+		f.Frame != channelFrame(mainChannelName, "hello") || f.RemoteAddr != "127.0.0.1" {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+	if f := frames[1]; f.Direction != TraceReceived || f.Frame != channelFrame(mainChannelName, "world") ||
+		f.Offset < frames[0].Offset {
+		t.Fatalf("unexpected frame: %+v", f)
+	}
+
+	// Frames are not recorded after the close.
+	s.Write("closed")
+	receiveChannelData(t, conn)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w.buf.Len() != 0 {
+		t.Fatalf("unexpected data: %q", w.buf.String())
+	}
+}
+
+func TestRecorderBufferFull(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	r := NewRecorder(w)
+
+	// The writer takes the first frame and blocks.
+	for i := 0; i < recorderQueueSize+10; i++ {
+		r.write(RecordedFrame{Socket: "a", Frame: strings.Repeat("x", 10)})
+	}
+
+	close(w.release)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := ReadRecording(&w.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) < recorderQueueSize || len(frames) > recorderQueueSize+1 {
+		t.Fatalf("unexpected number of frames: %d", len(frames))
+	}
+}
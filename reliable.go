@@ -0,0 +1,570 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used to transmit the messages
+	// of reliable channels and the acknowledgements.
+	reliableChannelName = "_rel"
+
+	// Reliable channel request types. Must be one character long.
+	reliableMessage = "m"
+	reliableAck     = "a"
+
+	// The prefix of the store streams keeping the unacknowledged
+	// messages of the reliable channels.
+	reliableStreamPrefix = "reliable/"
+
+	// The prefix of the store streams keeping the acknowledged
+	// sequence numbers of the devices of the reliable channels.
+	reliableAckStreamPrefix = "reliable-acks/"
+
+	// Devices without acknowledgements within the timeout are not
+	// waited for anymore. Their unacknowledged messages might be removed.
+	reliableDeviceTimeout = 7 * 24 * time.Hour
+
+	// The ack stream is compacted as soon as it holds more
+	// records than this limit in addition to one per device.
+	reliableAckCompaction = 64
+
+	// The length of the random part of the message IDs.
+	reliableNonceLength = 8
+)
+
+//###############################//
+//### Public Channel methods ###//
+//###############################//
+
+// SetReliable enables the at-least-once delivery mode of the channel.
+// Written messages are persisted in the server store until the client
+// acknowledges them. The messages are keyed by the user ID and the channel
+// name. Call SetUserID first and enable the mode in the OnNewSocket function,
+// so the unacknowledged messages are redelivered as soon as the user
+// reconnects. Without a user ID, the messages are discarded if the socket
+// closes. Each message is passed with its ID to the client handlers. The ID
+// is unique and is the idempotency key of redeliveries. The client discards
+// redelivered messages which were passed to the handlers before.
+// The acknowledgements are tracked per device, identified by the client ID.
+// A message is removed as soon as all devices of the user acknowledged it.
+// Devices without acknowledgements for seven days are not waited for.
+// The Write, WriteMany and WriteJSON methods are reliable. The write TTL is
+// not applied.
+func (c *Channel) SetReliable(reliable bool) {
+	// Lock the mutex.
+	c.reliableMutex.Lock()
+	defer c.reliableMutex.Unlock()
+
+	if reliable == (len(c.stream) > 0) {
+		return
+	} else if !reliable {
+		c.stream = ""
+		c.ackStream = ""
+		return
+	}
+
+	key := c.s.reliableKey() + "/" + c.name
+	c.stream = reliableStreamPrefix + key
+	c.ackStream = reliableAckStreamPrefix + key
+
+	// Continue after the last message acknowledged by the device.
+	acks, _, err := c.deviceAcks()
+	if err != nil {
+		c.logReliable(err, "failed to read the acknowledgements")
+	}
+	device := c.s.reliableDevice()
+	from := acks[device].seq
+
+	// Register the device, so the messages are kept until it acknowledges them.
+	if err = c.appendAck(device, reliableDeviceAck{seq: from, time: time.Now()}); err != nil {
+		c.logReliable(err, "failed to register the device")
+	}
+
+	// Redeliver the unacknowledged messages.
+	// Writes wait for the mutex to keep the message order.
+	err = c.s.server.options.Store.Range(c.stream, from+1, func(msg StoredMessage) bool {
+		nonce, data, err := utils.UnmarshalValues(msg.Data)
+		if err != nil {
+			c.logReliable(err, "failed to redeliver an invalid stored message")
+			return true
+		}
+
+		c.s.touch()
+		c.s.write(reliableMessageFrame(reliableMessageID(msg.Seq, nonce), c.name, data))
+		return !c.s.IsClosed()
+	})
+	if err != nil {
+		c.logReliable(err, "failed to redeliver the messages")
+	}
+}
+
+// IsReliable returns a boolean whether the at-least-once delivery mode is enabled.
+func (c *Channel) IsReliable() bool {
+	// Lock the mutex.
+	c.reliableMutex.Lock()
+	defer c.reliableMutex.Unlock()
+
+	return len(c.stream) > 0
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// SetReliable enables the at-least-once delivery mode of the main channel.
+// See the channel SetReliable method for details.
+func (s *Socket) SetReliable(reliable bool) {
+	s.mainChannel.SetReliable(reliable)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// reliableMessageID returns the message ID of the stored message.
+// The random nonce keeps the IDs unique if the sequence numbers of
+// a stream restart, for example after a restart with the memory store.
+func reliableMessageID(seq uint64, nonce string) string {
+	return strconv.FormatUint(seq, 10) + "-" + nonce
+}
+
+// reliableKey returns the key of the reliable channel messages of the socket.
+// The messages are keyed by the user ID. Fallback to the socket ID.
+func (s *Socket) reliableKey() string {
+	if id := s.UserID(); len(id) > 0 {
+		return "user:" + id
+	}
+
+	return "socket:" + s.ID()
+}
+
+// dedupKey returns the key of the dedup window of the received reliable
+// messages. Sockets without a user ID are keyed by the stable client ID,
+// so redeliveries after a reconnect are detected. Fallback to the socket ID.
+func (s *Socket) dedupKey() string {
+	if id := s.UserID(); len(id) > 0 {
+		return "user:" + id
+	} else if id := s.ClientID(); len(id) > 0 {
+		return "client:" + id
+	}
+
+	return "socket:" + s.ID()
+}
+
+// reliableDevice returns the ID of the device acknowledging the messages.
+// The client ID is kept across reconnects. Fallback to the socket ID.
+func (s *Socket) reliableDevice() string {
+	if id := s.ClientID(); len(id) > 0 {
+		return "client:" + id
+	}
+
+	return "socket:" + s.ID()
+}
+
+// reliableMessageFrame returns the raw frame of the reliable message.
+func reliableMessageFrame(id, name, data string) string {
+	return cmdChannelData + utils.MarshalValues(reliableChannelName,
+		reliableMessage+utils.MarshalValues(id, utils.MarshalValues(name, data)))
+}
+
+// writeReliable persists and writes the data if the channel is reliable.
+// Returns false if the channel is not reliable.
+func (c *Channel) writeReliable(data string) bool {
+	// Lock the mutex.
+	c.reliableMutex.Lock()
+	defer c.reliableMutex.Unlock()
+
+	if len(c.stream) == 0 {
+		return false
+	}
+
+	c.s.touch()
+	c.s.write(c.reliableFrame(data))
+
+	return true
+}
+
+// writeManyReliable persists and writes the messages in a row if the
+// channel is reliable. Returns false if the channel is not reliable.
+func (c *Channel) writeManyReliable(msgs []string) bool {
+	// Lock the mutex.
+	c.reliableMutex.Lock()
+	defer c.reliableMutex.Unlock()
+
+	if len(c.stream) == 0 {
+		return false
+	}
+
+	rawData := make([]string, len(msgs))
+	for i, data := range msgs {
+		rawData[i] = c.reliableFrame(data)
+	}
+
+	c.s.touch()
+	c.s.writeMany(rawData)
+
+	return true
+}
+
+// reliableFrame persists the data and returns the raw frame of the message.
+// If the store fails, the error is logged and the frame of a plain channel
+// message without the delivery guarantee is returned.
+// The reliable mutex must be locked.
+func (c *Channel) reliableFrame(data string) string {
+	nonce := utils.RandomString(reliableNonceLength)
+
+	seq, err := c.s.server.options.Store.Append(c.stream, utils.MarshalValues(nonce, data))
+	if err != nil {
+		c.logReliable(err, "failed to persist the message")
+		return channelFrame(c.name, data)
+	}
+
+	return reliableMessageFrame(reliableMessageID(seq, nonce), c.name, data)
+}
+
+// ack records the acknowledged sequence number of the device and removes
+// the messages acknowledged by all devices of the channel from the store.
+func (c *Channel) ack(seq uint64) {
+	// Lock the mutex.
+	c.reliableMutex.Lock()
+	defer c.reliableMutex.Unlock()
+
+	if len(c.stream) == 0 {
+		return
+	}
+
+	err := c.appendAck(c.s.reliableDevice(), reliableDeviceAck{seq: seq, time: time.Now()})
+	if err != nil {
+		c.logReliable(err, "failed to persist the acknowledgement")
+		return
+	}
+
+	c.trimAcknowledged()
+}
+
+// trimAcknowledged removes the messages acknowledged by all devices from
+// the store and compacts the ack stream. The reliable mutex must be locked.
+func (c *Channel) trimAcknowledged() {
+	acks, records, err := c.deviceAcks()
+	if err != nil {
+		c.logReliable(err, "failed to read the acknowledgements")
+		return
+	} else if len(acks) == 0 {
+		return
+	}
+
+	// Trim to the minimum acknowledged sequence number.
+	min := uint64(math.MaxUint64)
+	for _, a := range acks {
+		if a.seq < min {
+			min = a.seq
+		}
+	}
+
+	st := c.s.server.options.Store
+	if err = st.Trim(c.stream, min+1); err != nil {
+		c.logReliable(err, "failed to remove the acknowledged messages")
+	}
+
+	if records <= len(acks)+reliableAckCompaction {
+		return
+	}
+
+	// Compact the ack stream by appending the current state of the devices
+	// and removing the previous records. Concurrent acknowledgements between
+	// the read and the trim might get lost, which only delays the removal of
+	// the messages.
+	var first uint64
+	for device, a := range acks {
+		seq, err := st.Append(c.ackStream, marshalDeviceAck(device, a))
+		if err != nil {
+			c.logReliable(err, "failed to compact the acknowledgements")
+			return
+		} else if first == 0 {
+			first = seq
+		}
+	}
+
+	if err = st.Trim(c.ackStream, first); err != nil {
+		c.logReliable(err, "failed to compact the acknowledgements")
+	}
+}
+
+func (c *Channel) logReliable(err error, msg string) {
+	log.L.WithFields(logrus.Fields{
+		"remoteAddress": c.s.RemoteAddr(),
+		"userID":        c.s.UserID(),
+		"channel":       c.name,
+	}).Warningf("glue: reliable channel: %s: %v", msg, err)
+}
+
+// handleReliable handles the reliable messages and
+// the acknowledgements send by the client.
+func (s *Socket) handleReliable(data string) error {
+	if len(data) == 0 {
+		return fmt.Errorf("received empty reliable channel request")
+	}
+
+	switch data[:1] {
+	case reliableMessage:
+		return s.handleReliableMessage(data[1:])
+	case reliableAck:
+		return s.handleReliableAck(data[1:])
+	default:
+		return fmt.Errorf("received invalid reliable channel request '%s'", data)
+	}
+}
+
+// handleReliableMessage passes the message to the channel and acknowledges
+// it. Messages passed to the channel before are only acknowledged. The data
+// contains the message ID, the send time in milliseconds since the Unix
+// epoch, the channel name and the message.
+func (s *Socket) handleReliableMessage(data string) error {
+	id, data, err := utils.UnmarshalValues(data)
+	if err != nil {
+		return err
+	}
+
+	ts, data, err := utils.UnmarshalValues(data)
+	if err != nil {
+		return err
+	}
+
+	ms, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("received reliable message with invalid time '%s'", ts)
+	}
+
+	name, data, err := utils.UnmarshalValues(data)
+	if err != nil {
+		return err
+	}
+
+	// Discard the data of draining sockets. The message is
+	// not acknowledged and resent by the client on reconnect.
+	if s.IsDraining() {
+		s.droppedData(name, data, DropReasonDraining)
+		return nil
+	}
+
+	// Mark the activity for the idle timeout.
+	s.touch()
+
+	c := s.channels.get(name)
+	if c == nil {
+		s.droppedData(name, data, DropReasonChannelNotFound)
+		return fmt.Errorf("received reliable message for channel '%s': channel does not exists", name)
+	}
+
+	// Skip redeliveries.
+	if s.server.dedup.add(s.dedupKey()+"/"+name, id) {
+		c.triggerReadMsg(Message{
+			ID:      id,
+			Channel: name,
+			Data:    data,
+			Time:    time.UnixMilli(ms),
+		})
+	}
+
+	// Acknowledge the message.
+	s.write(cmdChannelData + utils.MarshalValues(reliableChannelName,
+		reliableAck+utils.MarshalValues(name, id)))
+
+	return nil
+}
+
+// handleReliableAck handles the acknowledgements send by the client.
+// The data contains the channel name and the acknowledged message ID.
+func (s *Socket) handleReliableAck(data string) error {
+	name, id, err := utils.UnmarshalValues(data)
+	if err != nil {
+		return err
+	}
+
+	seqStr, _, _ := strings.Cut(id, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return fmt.Errorf("received invalid reliable message acknowledgement '%s'", id)
+	}
+
+	c := s.channels.get(name)
+	if c == nil {
+		return fmt.Errorf("received reliable message acknowledgement for channel '%s': channel does not exists", name)
+	}
+
+	c.ack(seq)
+
+	return nil
+}
+
+// closeReliable releases the reliable channels of the closed socket.
+func (s *Socket) closeReliable() {
+	cs := s.channels
+
+	// Lock the mutex.
+	cs.mutex.Lock()
+	list := make([]*Channel, 0, len(cs.m))
+	for _, c := range cs.m {
+		list = append(list, c)
+	}
+	cs.mutex.Unlock()
+
+	for _, c := range list {
+		c.closeReliable()
+	}
+}
+
+// closeReliable discards the unacknowledged messages of sockets without a
+// user ID, because they are never redelivered. Sockets without a client ID
+// never reconnect as the same device, so their acknowledgements are not
+// waited for anymore.
+func (c *Channel) closeReliable() {
+	// Lock the mutex.
+	c.reliableMutex.Lock()
+	defer c.reliableMutex.Unlock()
+
+	if len(c.stream) == 0 {
+		return
+	}
+
+	st := c.s.server.options.Store
+
+	if strings.HasPrefix(c.stream, reliableStreamPrefix+"socket:") {
+		if err := st.Trim(c.stream, math.MaxUint64); err != nil {
+			c.logReliable(err, "failed to discard the messages")
+		}
+		if err := st.Trim(c.ackStream, math.MaxUint64); err != nil {
+			c.logReliable(err, "failed to discard the acknowledgements")
+		}
+		return
+	}
+
+	if device := c.s.reliableDevice(); strings.HasPrefix(device, "socket:") {
+		err := c.appendAck(device, reliableDeviceAck{seq: math.MaxUint64, time: time.Now()})
+		if err != nil {
+			c.logReliable(err, "failed to remove the device")
+			return
+		}
+
+		c.trimAcknowledged()
+	}
+}
+
+//##########################//
+//### Device Ack Records ###//
+//##########################//
+
+// A reliableDeviceAck is the last sequence number acknowledged by a device.
+// The maximum sequence number marks removed devices.
+type reliableDeviceAck struct {
+	seq  uint64
+	time time.Time
+}
+
+// marshalDeviceAck returns the ack stream record of the device.
+func marshalDeviceAck(device string, a reliableDeviceAck) string {
+	return utils.MarshalValues(device, utils.MarshalValues(
+		strconv.FormatUint(a.seq, 10), strconv.FormatInt(a.time.UnixMilli(), 10)))
+}
+
+// unmarshalDeviceAck parses an ack stream record.
+func unmarshalDeviceAck(data string) (device string, a reliableDeviceAck, err error) {
+	device, data, err = utils.UnmarshalValues(data)
+	if err != nil {
+		return
+	}
+
+	seqStr, msStr, err := utils.UnmarshalValues(data)
+	if err != nil {
+		return
+	}
+
+	if a.seq, err = strconv.ParseUint(seqStr, 10, 64); err != nil {
+		return
+	}
+
+	ms, err := strconv.ParseInt(msStr, 10, 64)
+	if err != nil {
+		return
+	}
+	a.time = time.UnixMilli(ms)
+
+	return
+}
+
+// appendAck appends the ack record of the device to the ack stream.
+// The reliable mutex must be locked.
+func (c *Channel) appendAck(device string, a reliableDeviceAck) error {
+	_, err := c.s.server.options.Store.Append(c.ackStream, marshalDeviceAck(device, a))
+	return err
+}
+
+// deviceAcks returns the last acknowledged sequence numbers of the devices
+// and the number of records of the ack stream. Removed devices and devices
+// without acknowledgements within the timeout are skipped.
+// The reliable mutex must be locked.
+func (c *Channel) deviceAcks() (map[string]reliableDeviceAck, int, error) {
+	acks := make(map[string]reliableDeviceAck)
+	records := 0
+
+	err := c.s.server.options.Store.Range(c.ackStream, 0, func(msg StoredMessage) bool {
+		records++
+
+		device, a, err := unmarshalDeviceAck(msg.Data)
+		if err != nil {
+			c.logReliable(err, "skipped an invalid stored acknowledgement")
+			return true
+		}
+
+		// The acknowledgements of a device never decrease.
+		if prev, ok := acks[device]; ok && prev.seq > a.seq {
+			a.seq = prev.seq
+		}
+		acks[device] = a
+
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	deadline := time.Now().Add(-reliableDeviceTimeout)
+	for device, a := range acks {
+		if a.seq == math.MaxUint64 || a.time.Before(deadline) {
+			delete(acks, device)
+		}
+	}
+
+	return acks, records, nil
+}
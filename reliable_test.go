@@ -0,0 +1,209 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+// connectReliable connects a socket of the user with the client ID
+// and enables the reliable mode of the orders channel.
+func connectReliable(t *testing.T, server *Server, userID, clientID string) (*MemoryConn, *Channel) {
+	t.Helper()
+
+	conn, s := connectTestSocketWith(t, server, clientInitData{ClientID: clientID})
+	if err := s.SetUserID(userID); err != nil {
+		t.Fatal(err)
+	}
+
+	c := s.Channel("orders")
+	c.SetReliable(true)
+
+	return conn, c
+}
+
+// receiveReliable returns the ID and the data of the next reliable message.
+func receiveReliable(t *testing.T, conn *MemoryConn) (id, data string) {
+	t.Helper()
+
+	name, data := receiveChannelData(t, conn)
+	if name != reliableChannelName || !strings.HasPrefix(data, reliableMessage) {
+		t.Fatalf("expected a reliable message, got %s:%s", name, data)
+	}
+
+	id, data, err := utils.UnmarshalValues(data[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, data, err = utils.UnmarshalValues(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "orders" {
+		t.Fatalf("expected the orders channel, got %s", name)
+	}
+
+	return id, data
+}
+
+// sendAck acknowledges the reliable message.
+func sendAck(t *testing.T, conn *MemoryConn, id string) {
+	t.Helper()
+
+	sendChannelData(t, conn, reliableChannelName, reliableAck+utils.MarshalValues("orders", id))
+}
+
+// storedMessages returns the number of stored messages of the stream.
+func storedMessages(t *testing.T, server *Server, stream string) int {
+	t.Helper()
+
+	n := 0
+	err := server.options.Store.Range(stream, 0, func(StoredMessage) bool {
+		n++
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestReliableAckPerDevice(t *testing.T) {
+	server := newTestServer(t)
+	stream := reliableStreamPrefix + "user:alice/orders"
+
+	phone, _ := connectReliable(t, server, "alice", "phone")
+	laptop, c := connectReliable(t, server, "alice", "laptop")
+	laptop.Close()
+
+	// The phone acknowledges a message the laptop never received.
+	phoneChannel := phone.socket.Channel("orders")
+	phoneChannel.Write("1")
+	id, data := receiveReliable(t, phone)
+	if data != "1" {
+		t.Fatalf("expected 1, got %s", data)
+	}
+	sendAck(t, phone, id)
+	waitFor(t, time.Second, func() bool {
+		c.reliableMutex.Lock()
+		defer c.reliableMutex.Unlock()
+
+		acks, _, _ := c.deviceAcks()
+		return acks["client:phone"].seq > 0
+	})
+
+	if n := storedMessages(t, server, stream); n != 1 {
+		t.Fatalf("expected the message to be kept for the laptop, got %d stored messages", n)
+	}
+
+	// The laptop reconnects and receives the message.
+	laptop, _ = connectReliable(t, server, "alice", "laptop")
+	id, data = receiveReliable(t, laptop)
+	if data != "1" {
+		t.Fatalf("expected 1, got %s", data)
+	}
+	sendAck(t, laptop, id)
+
+	waitFor(t, time.Second, func() bool {
+		return storedMessages(t, server, stream) == 0
+	})
+
+	// The phone does not receive the acknowledged message again.
+	phone.Close()
+	phone, _ = connectReliable(t, server, "alice", "phone")
+	phone.socket.Channel("orders").Write("2")
+	if _, data = receiveReliable(t, phone); data != "2" {
+		t.Fatalf("expected 2, got %s", data)
+	}
+}
+
+func TestReliableSocketDeviceRemoved(t *testing.T) {
+	server := newTestServer(t)
+	stream := reliableStreamPrefix + "user:bob/orders"
+
+	// A socket without client ID never reconnects as the same device.
+	anonymous, _ := connectReliable(t, server, "bob", "")
+	phone, c := connectReliable(t, server, "bob", "phone")
+
+	c.Write("1")
+	id, _ := receiveReliable(t, phone)
+	sendAck(t, phone, id)
+
+	anonymous.Close()
+	waitFor(t, time.Second, func() bool {
+		return storedMessages(t, server, stream) == 0
+	})
+}
+
+func TestReliableWriteMany(t *testing.T) {
+	server := newTestServer(t)
+
+	conn, c := connectReliable(t, server, "carol", "tab")
+	c.WriteMany("1", "2", "3")
+
+	for _, expected := range []string{"1", "2", "3"} {
+		if _, data := receiveReliable(t, conn); data != expected {
+			t.Fatalf("expected %s, got %s", expected, data)
+		}
+	}
+
+	if n := storedMessages(t, server, reliableStreamPrefix+"user:carol/orders"); n != 3 {
+		t.Fatalf("expected 3 stored messages, got %d", n)
+	}
+}
+
+func TestReliableAckCompaction(t *testing.T) {
+	server := newTestServer(t)
+	conn, c := connectReliable(t, server, "dave", "tab")
+
+	for i := 0; i < 3*reliableAckCompaction; i++ {
+		c.Write("x")
+		id, _ := receiveReliable(t, conn)
+		sendAck(t, conn, id)
+	}
+
+	waitFor(t, time.Second, func() bool {
+		return storedMessages(t, server, reliableStreamPrefix+"user:dave/orders") == 0
+	})
+	if n := storedMessages(t, server, c.ackStream); n > reliableAckCompaction+2 {
+		t.Fatalf("expected the ack stream to be compacted, got %d records", n)
+	}
+}
+
+func TestDeviceAckRecord(t *testing.T) {
+	a := reliableDeviceAck{seq: math.MaxUint64, time: time.UnixMilli(1700000000000)}
+
+	device, b, err := unmarshalDeviceAck(marshalDeviceAck("client:x", a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device != "client:x" || b.seq != a.seq || !b.time.Equal(a.time) {
+		t.Fatalf("unexpected record: %s %v", device, b)
+	}
+
+	if _, _, err = unmarshalDeviceAck("invalid"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
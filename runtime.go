@@ -0,0 +1,202 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/desertbit/glue/log"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// RuntimeOptions holds the server options which are changeable at runtime
+// with the server UpdateOptions method. See the Options type for details.
+type RuntimeOptions struct {
+	// The keepalive intervals. Changes apply to all connected sockets.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	// The maximum number of concurrent socket connections.
+	// Connected sockets are not closed if the limit is lowered.
+	MaxConnections int
+
+	// The outgoing bytes per second of all sockets. Zero is unlimited.
+	MaxEgressBandwidth int64
+
+	// The default outgoing bytes per second limit of new sockets.
+	SocketBandwidthLimit int64
+
+	// The log levels. Empty levels are left unchanged.
+	LogLevel          string
+	BackendLogLevel   string
+	ProtocolLogLevel  string
+	KeepaliveLogLevel string
+
+	// The maintenance message. Empty disables the maintenance mode.
+	// See the server SetMaintenance method.
+	Maintenance string
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// RuntimeOptions returns the current runtime options.
+func (s *Server) RuntimeOptions() RuntimeOptions {
+	// Lock the mutex.
+	s.optionsMutex.Lock()
+	o := RuntimeOptions{
+		PingInterval:         s.options.PingInterval,
+		PingTimeout:          s.options.PingTimeout,
+		MaxConnections:       s.options.MaxConnections,
+		MaxEgressBandwidth:   s.options.MaxEgressBandwidth,
+		SocketBandwidthLimit: s.options.SocketBandwidthLimit,
+		LogLevel:             s.options.LogLevel,
+		BackendLogLevel:      s.options.BackendLogLevel,
+		ProtocolLogLevel:     s.options.ProtocolLogLevel,
+		KeepaliveLogLevel:    s.options.KeepaliveLogLevel,
+	}
+	s.optionsMutex.Unlock()
+
+	o.Maintenance = s.Maintenance()
+
+	return o
+}
+
+// UpdateOptions changes the runtime options without a restart.
+// The function is called with the current options and modifies them.
+// Updates are serialized. The options are validated and an error
+// is returned without applying any change if they are invalid.
+// Don't call UpdateOptions within the function.
+func (s *Server) UpdateOptions(f func(o *RuntimeOptions)) error {
+	// Lock the mutex.
+	s.updateMutex.Lock()
+	defer s.updateMutex.Unlock()
+
+	// Modify the current options.
+	o := s.RuntimeOptions()
+	f(&o)
+
+	// Validate the options.
+	if o.PingInterval <= 0 {
+		return fmt.Errorf("invalid ping interval: %v", o.PingInterval)
+	}
+	if o.PingTimeout <= 0 {
+		return fmt.Errorf("invalid ping timeout: %v", o.PingTimeout)
+	}
+	if o.MaxConnections < 0 {
+		return fmt.Errorf("invalid max connections: %v", o.MaxConnections)
+	}
+	if o.MaxEgressBandwidth < 0 {
+		return fmt.Errorf("invalid max egress bandwidth: %v", o.MaxEgressBandwidth)
+	}
+	if o.SocketBandwidthLimit < 0 {
+		return fmt.Errorf("invalid socket bandwidth limit: %v", o.SocketBandwidthLimit)
+	}
+	for _, level := range []string{o.LogLevel, o.BackendLogLevel, o.ProtocolLogLevel, o.KeepaliveLogLevel} {
+		if len(level) == 0 {
+			continue
+		}
+		if _, err := log.ParseLevel(level); err != nil {
+			return err
+		}
+	}
+
+	// Apply the options.
+	pingChanged := func() bool {
+		// Lock the mutex.
+		s.optionsMutex.Lock()
+		defer s.optionsMutex.Unlock()
+
+		changed := s.options.PingInterval != o.PingInterval
+
+		if s.options.MaxEgressBandwidth != o.MaxEgressBandwidth {
+			s.egress.bucket.setRate(o.MaxEgressBandwidth)
+		}
+
+		s.options.PingInterval = o.PingInterval
+		s.options.PingTimeout = o.PingTimeout
+		s.options.MaxConnections = o.MaxConnections
+		s.options.MaxEgressBandwidth = o.MaxEgressBandwidth
+		s.options.SocketBandwidthLimit = o.SocketBandwidthLimit
+		s.options.LogLevel = o.LogLevel
+		s.options.BackendLogLevel = o.BackendLogLevel
+		s.options.ProtocolLogLevel = o.ProtocolLogLevel
+		s.options.KeepaliveLogLevel = o.KeepaliveLogLevel
+
+		setLogLevels(s.options)
+
+		return changed
+	}()
+
+	s.SetMaintenance(o.Maintenance)
+
+	// Apply a changed ping interval to the connected sockets.
+	if pingChanged {
+		for _, socket := range s.Sockets() {
+			socket.resetPingTimer()
+		}
+	}
+
+	return nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// pingInterval returns the current keepalive ping interval.
+func (s *Server) pingInterval() time.Duration {
+	// Lock the mutex.
+	s.optionsMutex.Lock()
+	defer s.optionsMutex.Unlock()
+
+	return s.options.PingInterval
+}
+
+// pingTimeout returns the current keepalive pong response timeout.
+func (s *Server) pingTimeout() time.Duration {
+	// Lock the mutex.
+	s.optionsMutex.Lock()
+	defer s.optionsMutex.Unlock()
+
+	return s.options.PingTimeout
+}
+
+// socketBandwidthLimit returns the default bandwidth limit of new sockets.
+func (s *Server) socketBandwidthLimit() int64 {
+	// Lock the mutex.
+	s.optionsMutex.Lock()
+	defer s.optionsMutex.Unlock()
+
+	return s.options.SocketBandwidthLimit
+}
+
+// maxConnections returns the current maximum number of connections.
+func (s *Server) maxConnections() int {
+	// Lock the mutex.
+	s.optionsMutex.Lock()
+	defer s.optionsMutex.Unlock()
+
+	return s.options.MaxConnections
+}
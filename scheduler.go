@@ -0,0 +1,252 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/utils"
+)
+
+//######################//
+//### Scheduler Type ###//
+//######################//
+
+// A scheduler passes the outgoing frames of the socket channels round-robin
+// to the write channel, so a busy channel can't hold back the other channels.
+// Frames without a channel are control frames and are always passed first.
+type scheduler struct {
+	writeChan  chan string
+	closedChan ClosedChan
+	wakeChan   chan struct{}
+
+	control chan []string            // The queue of the control frames.
+	queues  map[string]chan []string // The channel queues by the channel name.
+	order   []chan []string          // The channel queues in round-robin order.
+	mutex   sync.Mutex
+}
+
+func newScheduler(writeChan chan string, closedChan ClosedChan) *scheduler {
+	control := make(chan []string, global.WriteChanSize)
+
+	return &scheduler{
+		writeChan:  writeChan,
+		closedChan: closedChan,
+		wakeChan:   make(chan struct{}, 1),
+		control:    control,
+		queues:     map[string]chan []string{"": control},
+	}
+}
+
+// queue returns the queue of the channel and creates it if not present.
+// The empty name returns the queue of the control frames.
+func (sc *scheduler) queue(name string) chan []string {
+	// Lock the mutex.
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	q, ok := sc.queues[name]
+	if !ok {
+		q = make(chan []string, global.WriteChanSize)
+		sc.queues[name] = q
+		sc.order = append(sc.order, q)
+	}
+
+	return q
+}
+
+// names returns the names of all queues including the control queue.
+func (sc *scheduler) names() []string {
+	// Lock the mutex.
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	names := make([]string, 0, len(sc.queues))
+	for name := range sc.queues {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// channelQueues returns a copy of the channel queues in round-robin order.
+func (sc *scheduler) channelQueues() []chan []string {
+	// Lock the mutex.
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	return append([]chan []string(nil), sc.order...)
+}
+
+// push adds the frames to the queue of the channel. The frames are passed
+// in a row to the write channel. If the queue is full, then the onFull function
+// is called if set and push blocks until the frames are queued. Returns false
+// if the socket closed or the abort channel closed before.
+func (sc *scheduler) push(name string, frames []string, onFull func(), abort <-chan struct{}) bool {
+	q := sc.queue(name)
+
+	select {
+	case <-sc.closedChan:
+		return false
+	case q <- frames:
+	default:
+		if onFull != nil {
+			onFull()
+		}
+
+		select {
+		case <-sc.closedChan:
+			return false
+		case <-abort:
+			return false
+		case q <- frames:
+		}
+	}
+
+	// Wake up the run loop.
+	select {
+	case sc.wakeChan <- struct{}{}:
+	default:
+	}
+
+	return true
+}
+
+// run passes the queued frames to the write channel
+// until the socket closes. Start this in a new goroutine.
+func (sc *scheduler) run() {
+	for {
+		passed := false
+
+		// Pass one entry of each channel queue per round.
+		// Control frames are passed before each channel entry.
+		for _, q := range sc.channelQueues() {
+			for sc.pass(sc.control) {
+				passed = true
+			}
+
+			if sc.pass(q) {
+				passed = true
+			}
+		}
+
+		for sc.pass(sc.control) {
+			passed = true
+		}
+
+		if passed {
+			continue
+		}
+
+		// Wait for new frames.
+		select {
+		case <-sc.closedChan:
+			return
+		case <-sc.wakeChan:
+		}
+	}
+}
+
+// pass passes the next entry of the queue to the write channel.
+// Returns false if the queue is empty or the socket closed.
+func (sc *scheduler) pass(q chan []string) bool {
+	select {
+	case frames := <-q:
+		for _, frame := range frames {
+			select {
+			case <-sc.closedChan:
+				return false
+			case sc.writeChan <- frame:
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+//##############################//
+//### Private Socket methods ###//
+//##############################//
+
+// frameChannel returns the channel name of the raw frame.
+// Frames without a channel return an empty name.
+func frameChannel(rawData string) string {
+	rawData = strings.TrimPrefix(rawData, global.BinaryFrameMarker)
+	if !isChannelData(rawData) {
+		return ""
+	}
+
+	name, _, err := utils.UnmarshalValues(rawData[cmdLen:])
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
+
+// writeFair queues the raw data values in a row for the channel of the first
+// value. The write mutex is not required, because the values of one call are
+// passed together to the write channel. If the TTL is greater than zero, then
+// the values are marked with the expiry deadline and the call blocks at most
+// for the TTL. Returns false if the values were not queued.
+func (s *Socket) writeFair(rawData []string, ttl time.Duration) bool {
+	if len(rawData) == 0 {
+		return true
+	}
+
+	frames := rawData
+	var abort chan struct{}
+
+	if ttl > 0 {
+		frames = make([]string, len(rawData))
+		deadline := time.Now().Add(ttl)
+		for i, data := range rawData {
+			frames[i] = global.ExpiryFrame(deadline, data)
+		}
+
+		// Don't block longer than the TTL.
+		abort = make(chan struct{})
+		timer := time.AfterFunc(ttl, func() { close(abort) })
+		defer timer.Stop()
+	}
+
+	// Wait for the bandwidth limits. The backend socket
+	// drops expired frames if the TTL is exceeded in between.
+	if !s.throttle(rawData...) {
+		return false
+	}
+
+	// A full queue sends a ping. If no pong is received
+	// within the timeout, the socket is closed.
+	if !s.scheduler.push(frameChannel(rawData[0]), frames, s.sendPing, abort) {
+		return false
+	}
+
+	// Update the metrics.
+	for _, data := range rawData {
+		countWrite(data)
+		s.trace(TraceSent, data)
+	}
+
+	return true
+}
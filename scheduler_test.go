@@ -0,0 +1,100 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+)
+
+// receiveWrites returns the next n frames of the write channel.
+func receiveWrites(t *testing.T, writeChan chan string, n int) []string {
+	t.Helper()
+
+	frames := make([]string, 0, n)
+	for len(frames) < n {
+		select {
+		case frame := <-writeChan:
+			frames = append(frames, frame)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d frames", len(frames), n)
+		}
+	}
+
+	return frames
+}
+
+func TestSchedulerRoundRobin(t *testing.T) {
+	writeChan := make(chan string)
+	closed := make(chan struct{})
+	defer close(closed)
+
+	sc := newScheduler(writeChan, closed)
+
+	// A busy channel must not hold back the other channel
+	// and the control frames are passed first.
+	for _, f := range []string{"a1", "a2", "a3"} {
+		sc.push("a", []string{f}, nil, nil)
+	}
+	sc.push("b", []string{"b1", "b2"}, nil, nil)
+	sc.push("", []string{"ctrl"}, nil, nil)
+
+	go sc.run()
+
+	frames := receiveWrites(t, writeChan, 6)
+	expected := []string{"ctrl", "a1", "b1", "b2", "a2", "a3"}
+	for i := range expected {
+		if frames[i] != expected[i] {
+			t.Fatalf("unexpected order: %v", frames)
+		}
+	}
+}
+
+func TestSchedulerPushAborted(t *testing.T) {
+	writeChan := make(chan string)
+	closed := make(chan struct{})
+
+	sc := newScheduler(writeChan, closed)
+
+	// Fill the queue without a running scheduler.
+	for i := 0; i < global.WriteChanSize; i++ {
+		if !sc.push("a", []string{"data"}, nil, nil) {
+			t.Fatal("push failed")
+		}
+	}
+
+	// A full queue calls onFull and blocks until aborted.
+	full := false
+	abort := make(chan struct{})
+	time.AfterFunc(10*time.Millisecond, func() { close(abort) })
+
+	if sc.push("a", []string{"data"}, func() { full = true }, abort) {
+		t.Fatal("push to the full queue succeeded")
+	} else if !full {
+		t.Fatal("onFull not called")
+	}
+
+	// Pushes to the full queue fail after the socket closed.
+	close(closed)
+	if sc.push("a", []string{"data"}, nil, nil) {
+		t.Fatal("push after close succeeded")
+	}
+}
@@ -27,7 +27,20 @@ import (
 	"sync"
 	"time"
 
+	"github.com/blang/semver"
 	"github.com/desertbit/glue/backend"
+	"github.com/desertbit/glue/backend/sockets/ajaxsocket"
+	"github.com/desertbit/glue/backend/sockets/engineiosocket"
+	"github.com/desertbit/glue/backend/sockets/sockjssocket"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The maximum number of concurrent writes of the WriteTo method.
+	writeToConcurrency = 16
 )
 
 //####################//
@@ -43,15 +56,65 @@ type OnNewSocketFunc func(s *Socket)
 
 // A Server represents a glue server which handles incoming socket connections.
 type Server struct {
-	bs      *backend.Server
-	options *Options
+	bs           *backend.Server
+	options      *Options
+	optionsMutex sync.Mutex // Guards the runtime options.
+	updateMutex  sync.Mutex // Serializes option updates.
+
+	block      bool
+	blockMutex sync.Mutex
 
-	block       bool
-	blockMutex  sync.Mutex
-	onNewSocket OnNewSocketFunc
+	maintenance      string // The maintenance message if the maintenance mode is enabled.
+	maintenanceMutex sync.Mutex
+
+	namespaces       map[string]*Namespace
+	namespacesMutex  sync.Mutex
+	defaultNamespace *Namespace
 
 	sockets      map[string]*Socket // A map holding all active current sockets.
 	socketsMutex sync.Mutex
+
+	users      map[string]map[*Socket]struct{} // A map holding the sockets of each user ID.
+	usersMutex sync.Mutex
+
+	tags      map[string]map[*Socket]struct{} // A map holding the sockets of each tag.
+	tagsMutex sync.Mutex
+
+	topics      map[string]*Topic
+	topicsMutex sync.Mutex
+
+	onEvent      OnEventFunc
+	onEventMutex sync.Mutex
+
+	onDropped      DroppedMessageFunc
+	onDroppedMutex sync.Mutex
+
+	deadLetters chan DeadLetter // The dead letter queue if enabled.
+
+	webhooks       []chan webhookJob // The webhook worker queues if enabled.
+	webhooksStop   chan struct{}     // Closed on release to stop the retries.
+	webhooksClosed bool              // Set as soon as the queues are closed.
+	webhooksMutex  sync.RWMutex
+	webhooksWG     sync.WaitGroup
+
+	dedup *dedupWindows // Discards redelivered messages of reliable channels.
+
+	tickets *connectTickets // The issued connect tickets.
+
+	socketIDs *socketIDGenerator // Creates the IDs of new sockets.
+
+	readWorkers chan struct{} // Limits the concurrent OnRead calls if set.
+
+	egress *egressQueue // Limits the outgoing bytes of all sockets.
+
+	versionRange semver.Range // The supported client protocol versions if set.
+
+	cluster *cluster // Connects the nodes of the cluster if set.
+
+	handshakeLimiter *handshakeLimiter // Limits the handshakes per remote address if set.
+
+	nearCapacity  bool // Set if the connections reached the high watermark.
+	capacityMutex sync.Mutex
 }
 
 // NewServer creates a new glue server instance.
@@ -68,23 +131,109 @@ func NewServer(o ...Options) *Server {
 	// Set the default option values for unset values.
 	options.SetDefaults()
 
+	// Apply the log levels.
+	setLogLevels(options)
+
 	// Create a new backend server.
-	bs := backend.NewServer(len(options.HTTPHandleURL), options.EnableCORS, options.CheckOrigin)
+	bs := backend.NewServer(len(options.HTTPHandleURL), options.EnableCORS, options.CheckOrigin, ajaxsocket.Options{
+		PollTimeout:    options.AjaxPollTimeout,
+		PollDelay:      options.AjaxPollDelay,
+		PushRetries:    options.AjaxPushRetries,
+		PushRetryDelay: options.AjaxPushRetryDelay,
+		MaxBodySize:    options.AjaxMaxBodySize,
+		ReadTimeout:    options.AjaxReadTimeout,
+		Headers:        options.AjaxHeaders,
+	})
+
+	// Serve the SockJS endpoint if enabled.
+	if options.EnableSockJS {
+		bs.EnableSockJS(sockjssocket.Options{
+			ClientURL: options.SockJSClientURL,
+		})
+	}
+
+	// Serve the engine.io endpoint if enabled.
+	if options.EnableEngineIO {
+		bs.EnableEngineIO(engineiosocket.Options{})
+	}
+
+	// Serve the socket.io endpoint if enabled.
+	if options.EnableSocketIO {
+		bs.EnableSocketIO(engineiosocket.Options{}, Version)
+	}
 
 	// Create a new server value.
 	s := &Server{
-		bs:          bs,
-		options:     options,
-		onNewSocket: func(*Socket) {}, // Initialize with dummy function to remove nil check.
-		sockets:     make(map[string]*Socket),
+		bs:         bs,
+		options:    options,
+		namespaces: make(map[string]*Namespace),
+		sockets:    make(map[string]*Socket),
+		users:      make(map[string]map[*Socket]struct{}),
+		tags:       make(map[string]map[*Socket]struct{}),
+		topics:     make(map[string]*Topic),
+		egress:     newEgressQueue(options.MaxEgressBandwidth),
+
+		versionRange: parseVersionRange(options),
+	}
+
+	// Create the OnRead worker pool if enabled.
+	if options.ReadWorkers > 0 {
+		s.readWorkers = make(chan struct{}, options.ReadWorkers)
+	}
+
+	// Start the dead letter queue if enabled.
+	s.startDeadLetters()
+
+	// Start the webhook workers if enabled.
+	s.startWebhooks()
+
+	// Create the dedup windows of the reliable channels.
+	s.dedup = newDedupWindows(s.options.DedupWindowSize)
+
+	// Create the connect tickets.
+	s.tickets = newConnectTickets()
+
+	// Create the socket ID generator.
+	s.socketIDs = newSocketIDGenerator(s.options.SocketIDMode, s.options.SocketIDPrefix)
+
+	// Create the default namespace.
+	s.defaultNamespace = s.Namespace("/")
+
+	// Join the cluster if an adapter is set.
+	if options.Cluster != nil {
+		s.cluster = newCluster(s, options.Cluster)
 	}
 
 	// Set the backend server event function.
 	bs.OnNewSocketConnection(s.handleOnNewSocketConnection)
 
+	// Limit the handshake requests per remote address if enabled.
+	if options.HandshakeRateLimit > 0 {
+		s.handshakeLimiter = newHandshakeLimiter(options)
+		bs.OnHandshakeRequest(s.handshakeLimiter.allow)
+	}
+
+	// Set the custom handshake response headers if set.
+	if options.OnHandshakeResponse != nil {
+		bs.OnHandshakeResponse(options.OnHandshakeResponse)
+	}
+
 	return s
 }
 
+// NewServerWithError creates a new glue server instance like NewServer,
+// but validates the options first. A descriptive error is returned if
+// the options are misconfigured. See the Options Validate method.
+func NewServerWithError(o ...Options) (*Server, error) {
+	if len(o) > 0 {
+		if err := o[0].Validate(); err != nil {
+			return nil, fmt.Errorf("glue: invalid options: %v", err)
+		}
+	}
+
+	return NewServer(o...), nil
+}
+
 // Block new incomming connections.
 func (s *Server) Block(b bool) {
 	s.blockMutex.Lock()
@@ -103,14 +252,23 @@ func (s *Server) IsBlocked() bool {
 
 // OnNewSocket sets the event function which is
 // triggered if a new socket connection was made.
-// The event function must not block! As soon as the event function
-// returns, the socket is added to the active sockets map.
+// The event function must not block, unless the SyncOnNewSocket option
+// is set! As soon as the event function returns, the socket is added to
+// the active sockets map.
+// This sets the event function of the default namespace.
 func (s *Server) OnNewSocket(f OnNewSocketFunc) {
-	s.onNewSocket = f
+	s.defaultNamespace.OnNewSocket(f)
+}
+
+// RoutingKey returns the sticky session routing key of this server node.
+// An empty string is returned if not set. See the RoutingKey option.
+func (s *Server) RoutingKey() string {
+	return s.options.RoutingKey
 }
 
-// GetSocket obtains a socket by its ID.
-// Returns nil if not found.
+// GetSocket obtains a socket of this server by its ID.
+// Returns nil if not found. Use the FindSocket and WriteToSocket
+// methods for the sockets of other cluster nodes.
 func (s *Server) GetSocket(id string) *Socket {
 	// Lock the mutex.
 	s.socketsMutex.Lock()
@@ -147,8 +305,95 @@ func (s *Server) Sockets() []*Socket {
 	return list
 }
 
+// BroadcastFunc writes the data to the main channel of all current connected
+// sockets matching the filter function. The filter is evaluated for each
+// socket while the sockets list is locked. Don't call any server methods
+// within the filter. The data is written after the lock is released.
+// A nil filter matches all sockets.
+func (s *Server) BroadcastFunc(data string, filter func(*Socket) bool) {
+	// Obtain the matching sockets.
+	list := func() []*Socket {
+		// Lock the mutex.
+		s.socketsMutex.Lock()
+		defer s.socketsMutex.Unlock()
+
+		list := make([]*Socket, 0, len(s.sockets))
+		for _, socket := range s.sockets {
+			if filter == nil || filter(socket) {
+				list = append(list, socket)
+			}
+		}
+
+		return list
+	}()
+
+	// Build the frame once and write it to the sockets.
+	rawData := channelFrame(mainChannelName, data)
+	for _, socket := range list {
+		if socket.IsClosed() {
+			continue
+		}
+
+		socket.mainChannel.writeFrame(data, rawData)
+	}
+}
+
+// WriteTo writes the data to the main channel of the sockets specified by
+// their IDs. The IDs are resolved at once and the data is written concurrently
+// with a bounded parallelism, so sockets with full write buffers don't delay
+// the others. In cluster mode, the data is forwarded to the sockets of other
+// nodes. The IDs of sockets which are not found or closed are returned.
+func (s *Server) WriteTo(ids []string, data string) (missing []string) {
+	// Resolve the sockets.
+	sockets := make([]*Socket, 0, len(ids))
+	func() {
+		// Lock the mutex.
+		s.socketsMutex.Lock()
+		defer s.socketsMutex.Unlock()
+
+		for _, id := range ids {
+			socket, ok := s.sockets[id]
+			if !ok || socket.IsClosed() {
+				missing = append(missing, id)
+				continue
+			}
+
+			sockets = append(sockets, socket)
+		}
+	}()
+
+	// Build the frame once and write it concurrently.
+	rawData := channelFrame(mainChannelName, data)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, writeToConcurrency)
+
+	for _, socket := range sockets {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(socket *Socket) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			socket.mainChannel.writeFrame(data, rawData)
+		}(socket)
+	}
+
+	wg.Wait()
+
+	// Forward the data to the sockets of other cluster nodes.
+	if s.cluster != nil && len(missing) > 0 {
+		missing = s.writeToCluster(missing, data)
+	}
+
+	return missing
+}
+
 // Release this package. This will block all new incomming socket connections
-// and close all current connected sockets.
+// and close all current connected sockets. The queued webhooks are delivered
+// without further retries and the webhook workers are stopped.
 func (s *Server) Release() {
 	// Block all new incomming socket connections.
 	s.Block(true)
@@ -162,6 +407,14 @@ func (s *Server) Release() {
 	for _, s := range sockets {
 		s.Close()
 	}
+
+	// Wait for the close handlers, so the disconnect webhooks are queued.
+	for _, s := range sockets {
+		<-s.onCloseDone
+	}
+
+	// Stop the webhook workers.
+	s.stopWebhooks()
 }
 
 // Run starts the server and listens for incoming socket connections.
@@ -181,13 +434,22 @@ func (s *Server) Run() error {
 			}
 
 			// Start the http server.
-			err = http.Serve(l, nil)
+			if s.isTLS() {
+				err = s.newHTTPServer().ServeTLS(l, s.options.TLSCertFile, s.options.TLSKeyFile)
+			} else {
+				err = s.newHTTPServer().Serve(l)
+			}
 			if err != nil {
 				return fmt.Errorf("Serve: %v", err)
 			}
 		} else if s.options.HTTPSocketType == HTTPSocketTypeTCP {
 			// Start the http server.
-			err := http.ListenAndServe(s.options.HTTPListenAddress, nil)
+			var err error
+			if s.isTLS() {
+				err = s.newHTTPServer().ListenAndServeTLS(s.options.TLSCertFile, s.options.TLSKeyFile)
+			} else {
+				err = s.newHTTPServer().ListenAndServe()
+			}
 			if err != nil {
 				return fmt.Errorf("ListenAndServe: %v", err)
 			}
@@ -205,6 +467,34 @@ func (s *Server) Run() error {
 
 // ServeHTTP implements the HTTP Handler interface of the http package.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Handle REST API requests if enabled.
+	if s.isAPIRequest(r) {
+		s.serveAPI(w, r)
+		return
+	}
+
+	// Handle readiness requests of load balancers.
+	if s.isReadyRequest(r) {
+		s.serveReady(w, r)
+		return
+	}
+
+	// Serve the embedded javascript client if enabled.
+	if s.isClientRequest(r) {
+		s.serveClient(w, r)
+		return
+	}
+
+	// Set the sticky session routing cookie if enabled.
+	if len(s.options.RoutingKey) > 0 {
+		http.SetCookie(w, &http.Cookie{
+			Name:     s.options.RoutingName,
+			Value:    s.options.RoutingKey,
+			Path:     s.options.HTTPHandleURL,
+			HttpOnly: true,
+		})
+	}
+
 	s.bs.ServeHTTP(w, r)
 }
 
@@ -212,8 +502,63 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 //### Server - Private ###//
 //########################//
 
+// isTLS returns true if the HTTP server of the Run method serves TLS.
+func (s *Server) isTLS() bool {
+	return len(s.options.TLSCertFile) > 0
+}
+
+// newHTTPServer creates the HTTP server of the Run method
+// with the default HTTP handler.
+func (s *Server) newHTTPServer() *http.Server {
+	hs := &http.Server{
+		Addr: s.options.HTTPListenAddress,
+	}
+
+	// Accept unencrypted HTTP/2 connections additionally if enabled.
+	if s.options.EnableH2C {
+		enableH2C(hs)
+	}
+
+	return hs
+}
+
+// writeToCluster writes the data concurrently to the sockets
+// of other cluster nodes and returns the IDs not found.
+func (s *Server) writeToCluster(ids []string, data string) (missing []string) {
+	var (
+		wg    sync.WaitGroup
+		mutex sync.Mutex
+	)
+	sem := make(chan struct{}, writeToConcurrency)
+
+	for _, id := range ids {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(id string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := s.cluster.writeToSocket(id, data); err != nil {
+				// Lock the mutex.
+				mutex.Lock()
+				missing = append(missing, id)
+				mutex.Unlock()
+			}
+		}(id)
+	}
+
+	wg.Wait()
+
+	return missing
+}
+
 func (s *Server) handleOnNewSocketConnection(bs backend.BackendSocket) {
 	// Close the socket if incomming connections should be blocked.
+	// Sockets exceeding the maximum number of connections are
+	// rejected during the initialization.
 	if s.IsBlocked() {
 		bs.Close()
 		return
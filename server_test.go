@@ -0,0 +1,128 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// receiveNoChannelData fails if channel data is received within a short time.
+func receiveNoChannelData(t *testing.T, conn *MemoryConn) {
+	t.Helper()
+
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for {
+		frame, err := conn.Receive(time.Until(deadline))
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(frame, cmdChannelData) {
+			t.Fatalf("unexpected channel data: %q", frame)
+		}
+	}
+}
+
+func TestBroadcastFunc(t *testing.T) {
+	server := newTestServer(t)
+
+	var conns []*MemoryConn
+	for _, room := range []string{"a", "a", "b"} {
+		conn, s := connectTestSocket(t, server)
+		s.SetMeta("room", room)
+		conns = append(conns, conn)
+	}
+
+	// Only the matching sockets receive the data.
+	server.BroadcastFunc("hello a", func(s *Socket) bool {
+		return s.Meta("room") == "a"
+	})
+	for _, conn := range conns[:2] {
+		if name, data := receiveChannelData(t, conn); name != mainChannelName || data != "hello a" {
+			t.Fatalf("unexpected data: %q %q", name, data)
+		}
+	}
+	receiveNoChannelData(t, conns[2])
+
+	// A nil filter matches all sockets.
+	server.BroadcastFunc("hello all", nil)
+	for _, conn := range conns {
+		if _, data := receiveChannelData(t, conn); data != "hello all" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+	}
+
+	// Closed sockets are skipped and their writes are not dropped.
+	dropped := make(chan string, 10)
+	server.OnDroppedMessage(func(s *Socket, channel, data string, reason DropReason) {
+		dropped <- data
+	})
+
+	conns[0].socket.Close()
+	server.BroadcastFunc("hello open", nil)
+	for _, conn := range conns[1:] {
+		if _, data := receiveChannelData(t, conn); data != "hello open" {
+			t.Fatalf("unexpected data: %q", data)
+		}
+	}
+
+	select {
+	case data := <-dropped:
+		t.Fatalf("unexpected dropped message: %q", data)
+	default:
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	server := newTestServer(t)
+
+	// Connect more sockets than written concurrently.
+	var (
+		conns []*MemoryConn
+		ids   []string
+	)
+	for i := 0; i < writeToConcurrency+4; i++ {
+		conn, s := connectTestSocket(t, server)
+		conns = append(conns, conn)
+		ids = append(ids, s.ID())
+	}
+
+	// The last socket is not addressed.
+	missing := server.WriteTo(ids[:len(ids)-1], "hello")
+	if len(missing) != 0 {
+		t.Fatalf("unexpected missing IDs: %v", missing)
+	}
+	for _, conn := range conns[:len(conns)-1] {
+		if name, data := receiveChannelData(t, conn); name != mainChannelName || data != "hello" {
+			t.Fatalf("unexpected data: %q %q", name, data)
+		}
+	}
+	receiveNoChannelData(t, conns[len(conns)-1])
+
+	// Unknown and closed sockets are returned.
+	conns[0].socket.Close()
+	missing = server.WriteTo([]string{"unknown", ids[0], ids[1]}, "again")
+	if len(missing) != 2 || missing[0] != "unknown" || missing[1] != ids[0] {
+		t.Fatalf("unexpected missing IDs: %v", missing)
+	}
+	if _, data := receiveChannelData(t, conns[1]); data != "again" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+}
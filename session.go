@@ -0,0 +1,88 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"math/rand"
+	"time"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The maximum duration to wait for the client to reconnect
+	// after the session expired. The socket is closed afterwards.
+	sessionReconnectTimeout = 10 * time.Second
+)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// RemainingLifetime returns the remaining duration until the session expires
+// and the client is forced to reconnect. Zero is returned if the
+// MaxSessionDuration option is not set.
+func (s *Socket) RemainingLifetime() time.Duration {
+	if s.sessionDeadline.IsZero() {
+		return 0
+	}
+
+	d := s.sessionDeadline.Sub(time.Now())
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// newSessionDeadline returns the deadline of a new session.
+// A random jitter of up to 10% is added to spread the reconnects
+// of sockets which were connected at the same time.
+// The zero time is returned if the session duration is unlimited.
+func newSessionDeadline(max time.Duration) time.Time {
+	if max <= 0 {
+		return time.Time{}
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(max)/10 + 1))
+
+	return time.Now().Add(max + jitter)
+}
+
+// sessionLoop forces the client to reconnect as soon as the session expires.
+func (s *Socket) sessionLoop() {
+	timer := time.NewTimer(s.RemainingLifetime())
+	defer timer.Stop()
+
+	select {
+	case <-s.isClosedChan:
+		return
+	case <-timer.C:
+	}
+
+	// The client reconnects after all previous messages were delivered.
+	s.setCloseReason(CloseReasonSessionExpired)
+	s.closeAfterFlush(sessionReconnectTimeout, cmdReconnect)
+}
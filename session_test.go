@@ -0,0 +1,64 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaxSessionDuration(t *testing.T) {
+	const duration = 100 * time.Millisecond
+
+	server := newTestServer(t, Options{MaxSessionDuration: duration})
+	closeReason := recordCloseReasons(t, server)
+
+	conn, s := connectTestSocket(t, server)
+
+	// A jitter of up to 10% is added.
+	if d := s.RemainingLifetime(); d <= 0 || d > duration+duration/10 {
+		t.Fatalf("unexpected remaining lifetime: %v", d)
+	}
+
+	// The previous messages are delivered before the client reconnects.
+	s.Write("hello")
+	if _, data := receiveChannelData(t, conn); data != "hello" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+	receiveFrame(t, conn, cmdReconnect)
+
+	if d := s.RemainingLifetime(); d != 0 {
+		t.Fatalf("unexpected remaining lifetime: %v", d)
+	}
+
+	// The client closes the connection to reconnect.
+	conn.Close()
+	if reason := closeReason(s); reason != CloseReasonSessionExpired {
+		t.Fatalf("unexpected close reason: %v", reason)
+	}
+}
+
+func TestMaxSessionDurationDisabled(t *testing.T) {
+	server := newTestServer(t)
+	_, s := connectTestSocket(t, server)
+
+	if d := s.RemainingLifetime(); d != 0 {
+		t.Fatalf("unexpected remaining lifetime: %v", d)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strconv"
+	"time"
+)
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// NotifyShutdown tells all connected clients that the server is going
+// away in the given duration. The JS client triggers the going_away event,
+// so frontends are able to show a notice and save their state before
+// the connection is closed.
+func (s *Server) NotifyShutdown(d time.Duration) {
+	data := cmdGoingAway + strconv.FormatInt(int64(d/time.Millisecond), 10)
+
+	for _, socket := range s.Sockets() {
+		if socket.IsClosed() {
+			continue
+		}
+
+		socket.write(data)
+	}
+}
+
+// Shutdown blocks new incoming connections, notifies all connected
+// clients that the server is going away in the given duration,
+// waits for the duration and releases the server afterwards.
+// This is a blocking method.
+func (s *Server) Shutdown(d time.Duration) {
+	// Block all new incomming socket connections.
+	s.Block(true)
+
+	// Notify the clients and give them time to save their state.
+	s.NotifyShutdown(d)
+	time.Sleep(d)
+
+	// Close all current connected sockets.
+	s.Release()
+}
@@ -19,16 +19,23 @@
 package glue
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/blang/semver"
 	"github.com/desertbit/glue/backend"
+	"github.com/desertbit/glue/backend/faults"
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/backend/sockets/muxsocket"
 	"github.com/desertbit/glue/log"
 	"github.com/desertbit/glue/utils"
 )
@@ -42,7 +49,7 @@ import (
 const (
 	// Version holds the Glue Socket Protocol Version as string.
 	// This project follows the Semantic Versioning (http://semver.org/).
-	Version = "1.9.1"
+	Version = "2.0.0"
 )
 
 // Private
@@ -51,15 +58,22 @@ const (
 	// The constant length of the random socket ID.
 	socketIDLength = 20
 
-	// Send pings to the peer with this period.
+	// Send pings to the peer with this default period.
 	pingPeriod = 30 * time.Second
 
-	// Kill the socket after this timeout.
+	// Kill the socket after this default timeout.
 	pingResponseTimeout = 7 * time.Second
 
 	// The main channel name.
 	mainChannelName = "m"
 
+	// The maximum number of channel messages held back
+	// during a synchronous OnNewSocket function call.
+	maxHeldReads = 32
+
+	// The maximum length of the client ID.
+	maxClientIDLength = 64
+
 	// Socket commands. Must be two character long.
 	// ############################################
 	cmdLen               = 2
@@ -70,6 +84,11 @@ const (
 	cmdInvalid           = "iv"
 	cmdDontAutoReconnect = "dr"
 	cmdChannelData       = "cd"
+	cmdChannelBinaryData = "cb"
+	cmdReject            = "rj"
+	cmdGoingAway         = "ga"
+	cmdIdleWarning       = "iw"
+	cmdReconnect         = "rc"
 )
 
 //#################//
@@ -80,6 +99,7 @@ const (
 var (
 	ErrSocketClosed = errors.New("the socket connection is closed")
 	ErrReadTimeout  = errors.New("the read timeout was reached")
+	ErrFlushTimeout = errors.New("the flush timeout was reached")
 )
 
 // Private
@@ -100,16 +120,67 @@ type OnCloseFunc func()
 // OnReadFunc is an event function.
 type OnReadFunc func(data string)
 
+// OnReadMsgFunc is an event function.
+type OnReadMsgFunc func(msg Message)
+
+// A Message is a message received on a channel.
+type Message struct {
+	// ID is the message ID assigned by the client. Messages of reliable
+	// client channels carry an ID, which is the same for redeliveries.
+	// Use it to process messages idempotently and to trace them.
+	// The ID is empty for other messages.
+	ID string
+
+	Channel string
+	Data    string
+
+	// Time is the send time of the client for messages with an ID.
+	// Otherwise it is the receive time of the server.
+	Time time.Time
+}
+
 //#####################//
 //### Private Types ###//
 //#####################//
 
 type initData struct {
 	SocketID string `json:"socketID"`
+
+	// The sticky session routing name and key of this server node.
+	RoutingName string `json:"routingName,omitempty"`
+	RoutingKey  string `json:"routingKey,omitempty"`
+
+	// NativeKeepalive is set if the server sends native ping control frames.
+	NativeKeepalive bool `json:"nativeKeepalive,omitempty"`
+
+	// NearCapacity is set if the server is near its capacity.
+	NearCapacity bool `json:"nearCapacity,omitempty"`
+
+	// The renewed connect ticket for the next reconnect.
+	Ticket string `json:"ticket,omitempty"`
 }
 
 type clientInitData struct {
 	Version string `json:"version"`
+
+	// The namespace and the authentication value.
+	Namespace string `json:"namespace"`
+	Auth      string `json:"auth"`
+
+	// The payload passed to the OnHandshake function.
+	Payload string `json:"payload"`
+
+	// The single-use connect ticket.
+	Ticket string `json:"ticket"`
+
+	// The stable client ID kept across reconnects.
+	ClientID string `json:"client"`
+
+	// Mux is set by carrier sockets of logical sockets.
+	Mux bool `json:"mux"`
+
+	// Reject is set by clients which handle the reject command.
+	Reject bool `json:"reject"`
 }
 
 //###################//
@@ -129,46 +200,132 @@ type Socket struct {
 
 	id            string // Unique socket ID.
 	isInitialized bool
+	initMutex     sync.Mutex     // Guards the initialized flag and the client init values.
+	clientVersion semver.Version // The client protocol version.
+	clientID      string         // The stable client ID passed by the client.
+	canReject     bool           // Set if the client handles the reject command.
+	namespace     *Namespace     // The namespace of the socket.
 
 	channels    *channels
 	mainChannel *Channel
 
 	writeChan    chan string
+	writeMutex   sync.Mutex // Serializes the writes to the write channel.
 	readChan     chan string
 	isClosedChan ClosedChan
+	onCloseDone  chan struct{} // Closed as soon as the onClose method returned.
 
 	pingTimer         *time.Timer
 	pingTimeout       *time.Timer
 	sendPingMutex     sync.Mutex
 	pingRequestActive bool
+
+	clockOffset time.Duration
+	clockMutex  sync.Mutex
+
+	userID    string
+	userMutex sync.Mutex
+
+	tags      map[string]struct{}
+	tagsMutex sync.Mutex
+
+	meta      map[string]interface{} // The values attached with SetMeta.
+	metaMutex sync.Mutex
+
+	muxSockets map[string]*muxsocket.Socket // The logical sockets of a carrier socket.
+	muxMutex   sync.Mutex
+	isCarrier  bool // Guarded by the mux mutex.
+
+	receipts     map[string]chan error // Pending receipts by their ID.
+	receiptID    uint64
+	receiptMutex sync.Mutex
+
+	flushes    map[string]chan struct{} // Pending flushes by their ID.
+	flushID    uint64
+	flushMutex sync.Mutex
+
+	closeReason      CloseReason
+	closeReasonMutex sync.Mutex
+
+	draining   bool // Incoming channel data is discarded if set.
+	drainMutex sync.Mutex
+
+	rejectOnce sync.Once
+
+	lastActivity time.Time // The last application data activity.
+	idleMutex    sync.Mutex
+
+	sessionDeadline time.Time // The client is forced to reconnect at the deadline if set.
+
+	bandwidth *bucket // Limits the outgoing bytes of the socket.
+
+	scheduler *scheduler // Schedules the channel writes if fair scheduling is enabled.
+
+	pinger backend.Pinger // Sends native keepalive pings if enabled.
+
+	tracing      bool      // The frames are traced if set.
+	recorder     *Recorder // Records the frames if set.
+	recordClient bool      // The client details are recorded with the next frame.
+	traceMutex   sync.Mutex
+
+	// Closed as soon as a synchronous OnNewSocket function returns.
+	// Only accessed by the read loop.
+	onNewSocketDone chan struct{}
 }
 
 // newSocket creates a new socket and initializes it.
 func newSocket(server *Server, bs backend.BackendSocket) *Socket {
+	// Inject the failures into the backend socket if enabled.
+	if o := server.options.Faults; o != nil {
+		bs = faults.Wrap(bs, *o)
+	}
+
 	// Create a new socket value.
 	s := &Socket{
 		server: server,
 		bs:     bs,
 
-		id:       utils.RandomString(socketIDLength),
-		channels: newChannels(),
+		id:         server.socketIDs.next(),
+		channels:   newChannels(),
+		muxSockets: make(map[string]*muxsocket.Socket),
+		receipts:   make(map[string]chan error),
+		flushes:    make(map[string]chan struct{}),
+		tags:       make(map[string]struct{}),
 
 		writeChan:    bs.WriteChan(),
 		readChan:     bs.ReadChan(),
 		isClosedChan: bs.ClosedChan(),
+		onCloseDone:  make(chan struct{}),
 
-		pingTimer:   time.NewTimer(pingPeriod),
-		pingTimeout: time.NewTimer(pingResponseTimeout),
+		pingTimer:   time.NewTimer(server.pingInterval()),
+		pingTimeout: time.NewTimer(server.pingTimeout()),
+
+		lastActivity:    time.Now(),
+		sessionDeadline: newSessionDeadline(server.options.MaxSessionDuration),
+		bandwidth:       newBucket(server.socketBandwidthLimit()),
+		tracing:         server.options.Trace,
+	}
+
+	// Schedule the channel writes round-robin if enabled.
+	if server.options.FairChannelScheduling {
+		s.scheduler = newScheduler(s.writeChan, s.isClosedChan)
 	}
 
 	// Create the main channel.
 	s.mainChannel = s.Channel(mainChannelName)
 
-	// Call the on close method as soon as the socket closes.
-	go func() {
-		<-s.isClosedChan
-		s.onClose()
-	}()
+	// Handle frames dropped by the backend socket due to an exceeded TTL.
+	bs.OnExpired(s.onWriteExpired)
+
+	// Handle flushed write channels.
+	bs.OnFlushed(s.onFlushed)
+
+	// Use the native keepalive control frames if enabled and supported
+	// by the transport. The pong control frames reset the ping timeout.
+	if p, ok := bs.(backend.Pinger); ok && server.options.NativeWebSocketKeepalive {
+		s.pinger = p
+		p.OnPong(s.resetPingTimeout)
+	}
 
 	// Stop the timeout again. It will be started by the ping timer.
 	s.pingTimeout.Stop()
@@ -186,18 +343,51 @@ func newSocket(server *Server, bs backend.BackendSocket) *Socket {
 				break
 			}
 
-			s.id = utils.RandomString(socketIDLength)
+			s.id = s.server.socketIDs.next()
 		}
 
 		// Add the socket to the map.
 		s.server.sockets[s.id] = s
 	}()
 
+	// Register the socket at the cluster directory.
+	if c := server.cluster; c != nil {
+		c.registerSocket(s.id)
+	}
+
+	// Check the connections watermarks.
+	server.checkWatermarks()
+
+	// Record the socket if selected. The ID is final now.
+	if r := server.options.Recorder; r != nil &&
+		(server.options.RecordSocket == nil || server.options.RecordSocket(s)) {
+		s.StartRecording(r)
+	}
+
+	// Update the metrics. The socket is counted down again on close.
+	metricSockets.Add(1)
+	metricSocketsTotal.Add(1)
+
+	// Emit the connected event.
+	server.emitEvent(Event{Type: EventSocketConnected, Socket: s})
+
+	// Call the on close method as soon as the socket closes.
+	// Start this after the socket was added to the active sockets map.
+	go func() {
+		<-s.isClosedChan
+		s.onClose()
+		close(s.onCloseDone)
+	}()
+
 	// Start the loops and handlers in new goroutines.
 	go s.pingTimeoutHandler()
 	go s.readLoop()
 	go s.pingLoop()
 
+	if s.scheduler != nil {
+		go s.scheduler.run()
+	}
+
 	return s
 }
 
@@ -207,10 +397,28 @@ func (s *Socket) ID() string {
 	return s.id
 }
 
+// ClientID returns the stable ID of the client instance. The client
+// generates it once and passes it with each reconnect, while the socket
+// ID changes. Browser clients keep it in the session storage, so it
+// survives page reloads of the same tab. Returns an empty string if the
+// client did not pass an ID. The ID is set by the client and must not be
+// trusted for authentication.
+func (s *Socket) ClientID() string {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	return s.clientID
+}
+
 // IsInitialized returns a boolean indicating if a socket is initialized
 // and ready to be used. This flag is set to true after the OnNewSocket function
 // has returned for this socket.
 func (s *Socket) IsInitialized() bool {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
 	return s.isInitialized
 }
 
@@ -224,9 +432,28 @@ func (s *Socket) UserAgent() string {
 	return s.bs.UserAgent()
 }
 
+// Header returns the headers of the HTTP request which created the socket.
+// Use it to read the cookies of an existing web session. Sockets which
+// were not created by an HTTP request return an empty header.
+// Don't modify the returned header.
+func (s *Socket) Header() http.Header {
+	if h, ok := s.bs.(backend.HeaderSocket); ok && h.Header() != nil {
+		return h.Header()
+	}
+
+	return http.Header{}
+}
+
+// Cookie returns the named cookie of the HTTP request which created the socket.
+// http.ErrNoCookie is returned if the cookie is not found.
+func (s *Socket) Cookie(name string) (*http.Cookie, error) {
+	r := http.Request{Header: s.Header()}
+	return r.Cookie(name)
+}
+
 // Close the socket connection.
 func (s *Socket) Close() {
-	s.bs.Close()
+	s.closeWithReason(CloseReasonServer)
 }
 
 // IsClosed returns a boolean whenever the connection is closed.
@@ -262,15 +489,57 @@ func (s *Socket) Write(data string) {
 	s.mainChannel.Write(data)
 }
 
+// WriteBinary writes binary data to the client.
+// The client receives the data as ArrayBuffer or Blob.
+func (s *Socket) WriteBinary(data []byte) {
+	// Write to the main channel.
+	s.mainChannel.WriteBinary(data)
+}
+
+// WriteMany writes the messages to the client in a row without
+// interleaving them with concurrent writes.
+func (s *Socket) WriteMany(msgs ...string) {
+	s.mainChannel.WriteMany(msgs...)
+}
+
+// WriteJSON writes the JSON encoding of v to the client.
+func (s *Socket) WriteJSON(v interface{}) error {
+	// Write to the main channel.
+	return s.mainChannel.WriteJSON(v)
+}
+
+// SetDefaultTimeout sets the default read timeout of the main channel.
+// It is used by all Read and ReadJSON calls without a timeout argument.
+// Pass zero to block forever (default).
+func (s *Socket) SetDefaultTimeout(timeout time.Duration) {
+	s.mainChannel.SetDefaultTimeout(timeout)
+}
+
 // Read the next message from the socket. This method is blocking.
 // One variadic argument sets a timeout duration.
-// If no timeout is specified, this method will block forever.
+// If no timeout is specified, the default timeout of the main channel is used.
+// If no default timeout is set, this method will block forever.
 // ErrSocketClosed is returned, if the socket connection is closed.
 // ErrReadTimeout is returned, if the timeout is reached.
 func (s *Socket) Read(timeout ...time.Duration) (string, error) {
 	return s.mainChannel.Read(timeout...)
 }
 
+// ReadContext reads the next message from the socket. This method is blocking
+// until a message is received or the context is done.
+// ErrSocketClosed is returned, if the socket connection is closed
+// and the context error, if the context is done.
+func (s *Socket) ReadContext(ctx context.Context) (string, error) {
+	return s.mainChannel.ReadContext(ctx)
+}
+
+// ReadJSON reads the next message from the socket and stores
+// the decoded JSON value in the value pointed to by v.
+// This method is blocking. The timeout and errors equal the Read method.
+func (s *Socket) ReadJSON(v interface{}, timeout ...time.Duration) error {
+	return s.mainChannel.ReadJSON(v, timeout...)
+}
+
 // OnRead sets the function which is triggered if new data is received.
 // If this event function based method of reading data from the socket is used,
 // then don't use the socket Read method.
@@ -279,6 +548,12 @@ func (s *Socket) OnRead(f OnReadFunc) {
 	s.mainChannel.OnRead(f)
 }
 
+// OnReadMsg sets the function which is triggered if a new message
+// is received. See the channel OnReadMsg method for details.
+func (s *Socket) OnReadMsg(f OnReadMsgFunc) {
+	s.mainChannel.OnReadMsg(f)
+}
+
 // DiscardRead ignores and discars the data received from the client.
 // Call this method during initialization, if you don't read any data from
 // the socket. If received data is not discarded, then the read buffer will block as soon
@@ -292,11 +567,141 @@ func (s *Socket) DiscardRead() {
 //### Private Socket methods ###//
 //##############################//
 
+// setClientInit sets the values passed with the client init data.
+func (s *Socket) setClientInit(cData clientInitData, clientVersion semver.Version) {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	s.canReject = cData.Reject
+	s.clientVersion = clientVersion
+	s.clientID = cData.ClientID
+}
+
+// rejectSupported returns true if the client supports structured rejections.
+func (s *Socket) rejectSupported() bool {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	return s.canReject
+}
+
+// setInitialized sets the initialized flag.
+func (s *Socket) setInitialized() {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	s.isInitialized = true
+}
+
 func (s *Socket) write(rawData string) {
+	if s.scheduler != nil {
+		if !s.writeFair([]string{rawData}, 0) {
+			s.dropped(rawData, DropReasonSocketClosed)
+		}
+		return
+	}
+
+	// Wait for the bandwidth limits before locking the mutex,
+	// so the other writers are not blocked by the wait.
+	// False is returned if the socket closed in between.
+	if !s.throttle(rawData) {
+		s.dropped(rawData, DropReasonSocketClosed)
+		return
+	}
+
+	// Lock the mutex to not interleave with batch writes.
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.writeLocked(rawData)
+}
+
+// writeMany writes the raw data values in a row. Concurrent writes
+// are not interleaved. Keepalive pings might be sent in between.
+func (s *Socket) writeMany(rawData []string) {
+	if s.scheduler != nil {
+		if !s.writeFair(rawData, 0) {
+			for _, data := range rawData {
+				s.dropped(data, DropReasonSocketClosed)
+			}
+		}
+		return
+	}
+
+	// Wait for the bandwidth limits before locking the mutex.
+	if !s.throttle(rawData...) {
+		for _, data := range rawData {
+			s.dropped(data, DropReasonSocketClosed)
+		}
+		return
+	}
+
+	// Lock the mutex.
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	for _, data := range rawData {
+		s.writeLocked(data)
+	}
+}
+
+// tryWrite writes the raw data to the stream without blocking. The data is
+// not written if the buffer is full or another write holds the write mutex.
+// The data is not throttled, so use this only for control frames.
+// Returns false if the data was not written.
+func (s *Socket) tryWrite(rawData string) bool {
+	if s.IsClosed() {
+		return false
+	}
+
+	if s.scheduler != nil {
+		// Abort right away if the queue is full.
+		abort := make(chan struct{})
+		close(abort)
+
+		if !s.scheduler.push(frameChannel(rawData), []string{rawData}, nil, abort) {
+			return false
+		}
+	} else {
+		// Don't wait for a blocked write.
+		if !s.writeMutex.TryLock() {
+			return false
+		}
+		defer s.writeMutex.Unlock()
+
+		select {
+		case s.writeChan <- rawData:
+		default:
+			return false
+		}
+	}
+
+	// Update the metrics.
+	countWrite(rawData)
+	s.trace(TraceSent, rawData)
+
+	return true
+}
+
+// writeLocked writes the raw data to the stream.
+// Hint: the write mutex has to be locked and the
+// bandwidth limits must be waited for before.
+func (s *Socket) writeLocked(rawData string) {
+	// Don't pass the data to the write channel of a closed socket.
+	// The select below might choose the write channel otherwise.
+	if s.IsClosed() {
+		s.dropped(rawData, DropReasonSocketClosed)
+		return
+	}
+
 	// Write to the stream and check if the buffer is full.
 	select {
 	case <-s.isClosedChan:
 		// Just return because the socket is closed.
+		s.dropped(rawData, DropReasonSocketClosed)
 		return
 	case s.writeChan <- rawData:
 	default:
@@ -309,9 +714,34 @@ func (s *Socket) write(rawData string) {
 		// This will block if the buffer is still full.
 		s.writeChan <- rawData
 	}
+
+	// Update the metrics.
+	countWrite(rawData)
+	s.trace(TraceSent, rawData)
+}
+
+// writeBinary sends binary data for the channel specified by name.
+// Websockets transmit the data within binary frames. All other socket
+// types can't handle binary data and the data is base64 encoded instead.
+// A TTL greater than zero drops the data if it can't be sent in time.
+func (s *Socket) writeBinary(name string, data []byte, ttl time.Duration) {
+	s.touch()
+
+	if s.bs.Type() == global.TypeWebSocket {
+		s.writeTTL(global.BinaryFrameMarker+cmdChannelBinaryData+utils.MarshalValues(name, string(data)), ttl)
+		return
+	}
+
+	s.writeTTL(cmdChannelBinaryData+utils.MarshalValues(name, base64.StdEncoding.EncodeToString(data)), ttl)
 }
 
 func (s *Socket) onClose() {
+	// Update the metrics.
+	metricSockets.Add(-1)
+
+	// Emit the closed event.
+	s.server.emitEvent(Event{Type: EventSocketClosed, Socket: s, Reason: s.getCloseReason()})
+
 	// Remove the socket again from the active sockets map.
 	func() {
 		// Lock the mutex.
@@ -321,11 +751,39 @@ func (s *Socket) onClose() {
 		delete(s.server.sockets, s.id)
 	}()
 
+	// Remove the socket from the cluster directory.
+	if c := s.server.cluster; c != nil {
+		c.unregisterSocket(s.id)
+	}
+
+	// Check the connections watermarks.
+	s.server.checkWatermarks()
+
+	// Remove the socket from the users and tags index.
+	s.server.removeClosedUserSocket(s)
+	s.server.removeClosedTagSocket(s)
+
+	// Close the logical sockets of a carrier socket.
+	s.closeMuxSockets()
+
+	// Resolve the pending receipts.
+	s.closeReceipts()
+
+	// Discard the messages of reliable channels which are never redelivered.
+	s.closeReliable()
+
+	// Post the disconnect webhook for initialized sockets.
+	if s.IsInitialized() && !s.carrier() {
+		s.triggerWebhook(WebhookEventDisconnect, nil)
+	}
+
 	// Clear the write channel to release blocked goroutines.
 	// The pingLoop might be blocked...
+	// The buffered messages are dropped.
 	for i := 0; i < len(s.writeChan); i++ {
 		select {
-		case <-s.writeChan:
+		case data := <-s.writeChan:
+			s.dropped(data, DropReasonSocketClosed)
 		default:
 			break
 		}
@@ -345,7 +803,21 @@ func (s *Socket) resetPingTimeout() {
 
 	// Reset the ping timer again to request
 	// a pong repsonse during the next timeout.
-	s.pingTimer.Reset(pingPeriod)
+	s.pingTimer.Reset(s.server.pingInterval())
+}
+
+// resetPingTimer applies a changed ping interval
+// if no ping request is active.
+func (s *Socket) resetPingTimer() {
+	// Lock the mutex.
+	s.sendPingMutex.Lock()
+	defer s.sendPingMutex.Unlock()
+
+	if s.pingRequestActive {
+		return
+	}
+
+	s.pingTimer.Reset(s.server.pingInterval())
 }
 
 // SendPing sends a ping to the client. If no pong response is
@@ -372,10 +844,25 @@ func (s *Socket) sendPing() {
 	// within the timeout.
 	// Do this before the write. The write channel might block
 	// if the buffers are full.
-	s.pingTimeout.Reset(pingResponseTimeout)
+	s.pingTimeout.Reset(s.server.pingTimeout())
+
+	// Send a native ping control frame if enabled.
+	// It is not queued behind the buffered messages.
+	if s.pinger != nil {
+		if err := s.pinger.Ping(); err != nil {
+			log.Keepalive.WithFields(logrus.Fields{
+				"remoteAddress": s.RemoteAddr(),
+				"userAgent":     s.UserAgent(),
+			}).Debugf("glue: failed to send native ping: %v", err)
+
+			s.closeWithReason(CloseReasonConnectionLost)
+		}
+		return
+	}
 
 	// Send a ping request by writing to the stream.
 	s.writeChan <- cmdPing
+	s.trace(TraceSent, cmdPing)
 }
 
 // Close the socket during a ping response timeout.
@@ -387,7 +874,13 @@ func (s *Socket) pingTimeoutHandler() {
 	select {
 	case <-s.pingTimeout.C:
 		// Close the socket due to the timeout.
-		s.bs.Close()
+		log.Keepalive.WithFields(logrus.Fields{
+			"remoteAddress": s.RemoteAddr(),
+			"userAgent":     s.UserAgent(),
+		}).Debug("glue: ping response timeout: closing socket")
+
+		metricPingFailures.Add(1)
+		s.closeWithReason(CloseReasonPingTimeout)
 	case <-s.isClosedChan:
 		// Just release this goroutine.
 	}
@@ -417,6 +910,10 @@ func (s *Socket) pingLoop() {
 }
 
 func (s *Socket) readLoop() {
+	// Channel data received while a synchronous OnNewSocket
+	// function is running is held back until it returns.
+	var held []string
+
 	// Wait for data received from the read channel.
 	for {
 		select {
@@ -424,18 +921,36 @@ func (s *Socket) readLoop() {
 			// Reset the ping timeout.
 			s.resetPingTimeout()
 
-			// Get the command. The command is always prepended to the data message.
-			cmd := data[:cmdLen]
-			data = data[cmdLen:]
-
-			// Handle the received data and log error messages.
-			if err := s.handleRead(cmd, data); err != nil {
-				log.L.WithFields(logrus.Fields{
-					"remoteAddress": s.RemoteAddr(),
-					"userAgent":     s.UserAgent(),
-					"cmd":           cmd,
-				}).Warningf("glue: handle received data: %v", err)
+			// Update the metrics.
+			countRead(data)
+			s.trace(TraceReceived, data)
+
+			// Handle the data if nothing is held back.
+			if s.onNewSocketDone == nil || !isChannelData(data) {
+				s.handleReadData(data)
+				continue
 			}
+
+			// Hold back the channel data.
+			held = append(held, data)
+			if len(held) < maxHeldReads {
+				continue
+			}
+
+			// Wait if too much data is held back. This pauses
+			// the keepalive, but only for misbehaving clients.
+			select {
+			case <-s.onNewSocketDone:
+			case <-s.isClosedChan:
+				return
+			}
+
+			held = s.handleHeldReads(held)
+
+		case <-s.onNewSocketDone:
+			// The synchronous OnNewSocket function returned.
+			held = s.handleHeldReads(held)
+
 		case <-s.isClosedChan:
 			// Just exit the loop
 			return
@@ -443,6 +958,58 @@ func (s *Socket) readLoop() {
 	}
 }
 
+// handleHeldReads handles the data held back during the synchronous
+// OnNewSocket function call. Returns the emptied held back list.
+func (s *Socket) handleHeldReads(held []string) []string {
+	s.onNewSocketDone = nil
+
+	for _, data := range held {
+		s.handleReadData(data)
+	}
+
+	return nil
+}
+
+// isChannelData returns true if the received raw data is channel data.
+func isChannelData(data string) bool {
+	return strings.HasPrefix(data, cmdChannelData) ||
+		strings.HasPrefix(data, cmdChannelBinaryData)
+}
+
+// validClientID returns true if the client ID only contains
+// letters, digits, '-', '.' and '_' and does not exceed the maximum length.
+func validClientID(id string) bool {
+	if len(id) > maxClientIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '.' && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// handleReadData handles the received raw data and logs error messages.
+func (s *Socket) handleReadData(data string) {
+	// Get the command. The command is always prepended to the data message.
+	cmd := data[:cmdLen]
+	data = data[cmdLen:]
+
+	// Handle the received data and log error messages.
+	if err := s.handleRead(cmd, data); err != nil {
+		log.Protocol.WithFields(logrus.Fields{
+			"remoteAddress": s.RemoteAddr(),
+			"userAgent":     s.UserAgent(),
+			"cmd":           cmd,
+		}).Warningf("glue: handle received data: %v", err)
+
+		s.server.emitEvent(Event{Type: EventProtocolError, Socket: s, Err: err})
+	}
+}
+
 func (s *Socket) handleRead(cmd, data string) error {
 	// Perform the command request.
 	switch cmd {
@@ -455,7 +1022,7 @@ func (s *Socket) handleRead(cmd, data string) error {
 
 	case cmdClose:
 		// Close the socket.
-		s.bs.Close()
+		s.closeWithReason(CloseReasonClient)
 
 	case cmdInit:
 		// Handle the initialization.
@@ -468,10 +1035,65 @@ func (s *Socket) handleRead(cmd, data string) error {
 			return err
 		}
 
+		// Handle the reserved clock synchronization, mux, topic, receipt and reliable channels.
+		if name == clockChannelName {
+			return s.handleClock(data)
+		} else if name == muxChannelName {
+			return s.handleMux(data)
+		} else if name == topicChannelName {
+			return s.handleTopic(data)
+		} else if name == receiptChannelName {
+			return s.handleReceipt(data)
+		} else if name == reliableChannelName {
+			return s.handleReliable(data)
+		}
+
+		// Discard the data of draining sockets.
+		if s.IsDraining() {
+			s.droppedData(name, data, DropReasonDraining)
+			return nil
+		}
+
+		// Mark the activity for the idle timeout.
+		s.touch()
+
 		// Push the data to the corresponding channel.
 		if err = s.channels.triggerReadForChannel(name, data); err != nil {
+			s.droppedData(name, data, DropReasonChannelNotFound)
+			return err
+		}
+
+	case cmdChannelBinaryData:
+		// Unmarshal the channel name and binary data.
+		name, data, err := utils.UnmarshalValues(data)
+		if err != nil {
+			return err
+		}
+
+		// Socket types without binary support send the data base64 encoded.
+		if s.bs.Type() != global.TypeWebSocket {
+			b, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return fmt.Errorf("decode binary channel data: %v", err)
+			}
+			data = string(b)
+		}
+
+		// Discard the data of draining sockets.
+		if s.IsDraining() {
+			s.droppedData(name, data, DropReasonDraining)
+			return nil
+		}
+
+		// Mark the activity for the idle timeout.
+		s.touch()
+
+		// Push the raw data to the corresponding channel.
+		if err = s.channels.triggerReadForChannel(name, data); err != nil {
+			s.droppedData(name, data, DropReasonChannelNotFound)
 			return err
 		}
+
 	default:
 		// Send an invalid command response.
 		s.write(cmdInvalid)
@@ -498,6 +1120,12 @@ func init() {
 }
 
 func initSocket(s *Socket, dataJSON string) {
+	// The received initialization data.
+	var cData clientInitData
+
+	// The renewed connect ticket.
+	var ticket string
+
 	// Handle the socket initialization in an anonymous function
 	// to handle the error in a clean and simple way.
 	dontAutoReconnect, err := func() (bool, error) {
@@ -505,7 +1133,6 @@ func initSocket(s *Socket, dataJSON string) {
 		// ####################################
 
 		// Unmarshal the data JSON.
-		var cData clientInitData
 		err := json.Unmarshal([]byte(dataJSON), &cData)
 		if err != nil {
 			return false, fmt.Errorf("json unmarshal init data: %v", err)
@@ -517,12 +1144,81 @@ func initSocket(s *Socket, dataJSON string) {
 			return false, fmt.Errorf("invalid client protocol version: %v", err)
 		}
 
+		// Validate the stable client ID.
+		if len(cData.ClientID) > 0 && !validClientID(cData.ClientID) {
+			return false, fmt.Errorf("invalid client ID '%s'", cData.ClientID)
+		}
+
+		// Set the client values. They are read by other goroutines.
+		s.setClientInit(cData, clientVersion)
+
 		// Check if the client protocol version is supported.
-		if clientVersion.Major != serverVersion.Major ||
-			clientVersion.Minor > serverVersion.Minor ||
-			(clientVersion.Minor == serverVersion.Minor && clientVersion.Patch > serverVersion.Patch) {
+		if !s.server.isVersionSupported(clientVersion) {
 			// The client should not automatically reconnect. Return true...
-			return true, fmt.Errorf("client socket protocol version is not supported: %s", cData.Version)
+			return true, &RejectError{
+				Code:    RejectCodeVersion,
+				Message: fmt.Sprintf("client socket protocol version is not supported: %s", cData.Version),
+			}
+		}
+
+		// Obtain the namespace and authenticate the socket.
+		// Carrier sockets use the default namespace and authenticate
+		// each logical socket separately.
+		if !cData.Mux {
+			// Reject new sockets during the maintenance mode.
+			if msg := s.server.Maintenance(); len(msg) > 0 {
+				return false, &RejectError{
+					Code:    RejectCodeMaintenance,
+					Message: msg,
+					Retry:   true,
+				}
+			}
+
+			// Reject the socket if the maximum number of connections is exceeded.
+			// This socket is already part of the sockets map.
+			if s.server.isOverCapacity() {
+				return false, &RejectError{
+					Code:    RejectCodeServerFull,
+					Message: "maximum number of connections reached",
+					Retry:   true,
+				}
+			}
+
+			// Check the connect ticket. It is redeemed after the authentication.
+			if err := s.checkTicket(cData.Ticket); err != nil {
+				return true, err
+			}
+
+			// Validate the handshake payload first.
+			if err := s.handshake(cData.Payload); err != nil {
+				return true, err
+			}
+
+			n := s.server.getNamespace(cData.Namespace)
+			if n == nil {
+				return true, &RejectError{
+					Code:    RejectCodeNamespace,
+					Message: fmt.Sprintf("namespace does not exist: %s", cData.Namespace),
+				}
+			}
+			s.setNamespace(n)
+
+			dontAutoReconnect, err := n.authenticate(s, cData.Auth)
+			if err != nil {
+				// Only authentication failures are rejected.
+				// Failed middlewares just close the socket.
+				if dontAutoReconnect {
+					return true, newRejectError(RejectCodeAuth, err)
+				}
+				return false, fmt.Errorf("namespace '%s': %v", n.Name(), err)
+			}
+
+			// Redeem the connect ticket and set the user ID
+			// as soon as the socket is accepted.
+			ticket, err = s.redeemTicket(cData.Ticket)
+			if err != nil {
+				return true, newRejectError(RejectCodeTicket, err)
+			}
 		}
 
 		// Send initialization data:
@@ -533,6 +1229,22 @@ func initSocket(s *Socket, dataJSON string) {
 			SocketID: s.ID(),
 		}
 
+		// The client doesn't need to check the connection
+		// if the native keepalive is used.
+		data.NativeKeepalive = s.pinger != nil
+
+		// Tell the client if the server is near its capacity.
+		data.NearCapacity = s.server.options.NotifyCapacity && s.server.NearCapacity()
+
+		// Pass the renewed connect ticket.
+		data.Ticket = ticket
+
+		// Pass the routing key to the client if set.
+		if len(s.server.options.RoutingKey) > 0 {
+			data.RoutingName = s.server.options.RoutingName
+			data.RoutingKey = s.server.options.RoutingKey
+		}
+
 		// Marshal the data to a JSON string.
 		dataJSON, err := json.Marshal(&data)
 		if err != nil {
@@ -542,24 +1254,50 @@ func initSocket(s *Socket, dataJSON string) {
 		// Send the init data to the client.
 		s.write(cmdInit + string(dataJSON))
 
+		// Hide carrier sockets from the active sockets map.
+		if cData.Mux {
+			s.muxMutex.Lock()
+			s.isCarrier = true
+			s.muxMutex.Unlock()
+
+			func() {
+				// Lock the mutex.
+				s.server.socketsMutex.Lock()
+				defer s.server.socketsMutex.Unlock()
+
+				delete(s.server.sockets, s.id)
+			}()
+
+			// Remove the carrier socket from the cluster directory.
+			// The cluster adapter is called without the sockets mutex.
+			if c := s.server.cluster; c != nil {
+				c.unregisterSocket(s.id)
+			}
+		}
+
 		return false, nil
 	}()
 
 	// Handle the error.
 	if err != nil {
-		if dontAutoReconnect {
-			// Tell the client to not automatically reconnect.
-			s.write(cmdDontAutoReconnect)
+		if r, ok := err.(*RejectError); ok {
+			// Send the structured rejection to the client and close the socket.
+			s.rejectAndClose(r, CloseReasonInitFailed)
+		} else {
+			if dontAutoReconnect {
+				// Tell the client to not automatically reconnect.
+				s.write(cmdDontAutoReconnect)
+
+				// Be sure that the previous socket command gets send to the client.
+				s.Flush(rejectFlushTimeout)
+			}
 
-			// Pause to be sure that the previous socket command gets send to the client.
-			time.Sleep(time.Second)
+			// Close the socket.
+			s.closeWithReason(CloseReasonInitFailed)
 		}
 
-		// Close the socket.
-		s.Close()
-
 		// Log the error.
-		log.L.WithFields(logrus.Fields{
+		log.Protocol.WithFields(logrus.Fields{
 			"remoteAddress": s.RemoteAddr(),
 			"userAgent":     s.UserAgent(),
 		}).Warningf("glue: init socket: %v", err)
@@ -567,6 +1305,33 @@ func initSocket(s *Socket, dataJSON string) {
 		return
 	}
 
+	// Carrier sockets only transport logical sockets.
+	// Don't trigger the on new socket event.
+	if s.carrier() {
+		s.setInitialized()
+		return
+	}
+
+	// Run a synchronous OnNewSocket function in a new goroutine.
+	// The read loop holds back channel data until it returns,
+	// but keeps handling the keepalive.
+	if s.server.options.SyncOnNewSocket {
+		done := make(chan struct{})
+		s.onNewSocketDone = done
+
+		go func() {
+			defer close(done)
+			initNewSocket(s)
+		}()
+		return
+	}
+
+	initNewSocket(s)
+}
+
+// initNewSocket triggers the on new socket event function
+// and finishes the socket initialization.
+func initNewSocket(s *Socket) {
 	// Trigger the on new socket event function.
 	func() {
 		// Recover panics and log the error.
@@ -579,9 +1344,25 @@ func initSocket(s *Socket, dataJSON string) {
 		}()
 
 		// Trigger the event function.
-		s.server.onNewSocket(s)
+		s.Namespace().triggerOnNewSocket(s)
 	}()
 
 	// Update the initialized flag.
-	s.isInitialized = true
+	s.setInitialized()
+
+	// Close the socket if idle.
+	if s.server.options.IdleTimeout > 0 {
+		go s.idleLoop()
+	}
+
+	// Force a reconnect as soon as the session expires.
+	if !s.sessionDeadline.IsZero() {
+		go s.sessionLoop()
+	}
+
+	// Emit the initialized event.
+	s.server.emitEvent(Event{Type: EventSocketInitialized, Socket: s})
+
+	// Post the connect webhook.
+	s.triggerWebhook(WebhookEventConnect, nil)
 }
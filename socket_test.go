@@ -0,0 +1,285 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSocketClientID(t *testing.T) {
+	server := newTestServer(t)
+
+	_, s := connectTestSocketWith(t, server, clientInitData{ClientID: "tab-1.a_b"})
+	if s.ClientID() != "tab-1.a_b" {
+		t.Fatalf("unexpected client ID: %s", s.ClientID())
+	}
+
+	_, s = connectTestSocket(t, server)
+	if s.ClientID() != "" {
+		t.Fatalf("expected an empty client ID, got %s", s.ClientID())
+	}
+}
+
+func TestSocketInvalidClientID(t *testing.T) {
+	server := newTestServer(t)
+
+	for _, id := range []string{"a/b", "a b", strings.Repeat("a", maxClientIDLength+1)} {
+		conn := server.ConnectMemory("127.0.0.1", "test")
+		if err := conn.Send(cmdInit + `{"version":"` + Version + `","client":"` + id + `"}`); err != nil {
+			t.Fatal(err)
+		}
+
+		waitFor(t, 5*time.Second, conn.IsClosed)
+		if conn.socket.ClientID() != "" {
+			t.Fatalf("expected the client ID %q to be rejected", id)
+		}
+	}
+}
+
+func TestSocketReject(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := map[string]struct {
+		canReject bool
+		cmd       string
+	}{
+		"reject": {true, cmdReject},
+		"legacy": {false, cmdDontAutoReconnect},
+	}
+
+	for name, test := range tests {
+		conn, s := connectTestSocketWith(t, server, clientInitData{Reject: test.canReject})
+
+		// The socket is closed as soon as the rejection is sent.
+		start := time.Now()
+		s.Reject(&RejectError{Code: RejectCodeAuth})
+		if d := time.Since(start); d >= rejectFlushTimeout/2 {
+			t.Errorf("%s: reject blocked for %v", name, d)
+		}
+
+		data := receiveFrame(t, conn, test.cmd)
+		if test.canReject && !strings.Contains(data, RejectCodeAuth) {
+			t.Errorf("%s: unexpected rejection: %s", name, data)
+		}
+		if !s.IsClosed() {
+			t.Errorf("%s: socket not closed", name)
+		}
+	}
+}
+
+func TestSocketInitRace(t *testing.T) {
+	server := newTestServer(t)
+	n := server.Namespace("/chat")
+
+	// Read the init values of the listed sockets while they initialize.
+	done := make(chan struct{})
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			n.Sockets()
+			for _, s := range server.Sockets() {
+				s.Namespace()
+				s.ClientID()
+				s.ProtocolVersion()
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		_, s := connectTestSocketWith(t, server, clientInitData{
+			Namespace: "/chat",
+			ClientID:  "client",
+		})
+		if s.Namespace() != n || s.ClientID() != "client" {
+			t.Fatal("init values not set")
+		}
+	}
+
+	close(done)
+	<-readerDone
+
+	if len(n.Sockets()) != 20 {
+		t.Fatalf("unexpected namespace sockets: %d", len(n.Sockets()))
+	}
+}
+
+// dialTestWebSocket opens a websocket to the server and initializes the
+// socket. The ping handler is set before the read loop starts, which
+// passes the text frames to the returned channel.
+func dialTestWebSocket(t *testing.T, server *Server, pingHandler func(ws *websocket.Conn) func(string) error) (*initData, chan string) {
+	t.Helper()
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/glue/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	ws.SetPingHandler(pingHandler(ws))
+
+	frames := make(chan string, 100)
+	go func() {
+		defer close(frames)
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			frames <- string(data)
+		}
+	}()
+
+	if err = ws.WriteMessage(websocket.TextMessage, []byte(cmdInit+`{"version":"`+Version+`"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case frame := <-frames:
+		var data initData
+		if !strings.HasPrefix(frame, cmdInit) {
+			t.Fatalf("unexpected init reply: %q", frame)
+		} else if err = json.Unmarshal([]byte(frame[len(cmdInit):]), &data); err != nil {
+			t.Fatal(err)
+		}
+		return &data, frames
+	case <-time.After(5 * time.Second):
+		t.Fatal("no init reply")
+		return nil, nil
+	}
+}
+
+func TestNativeKeepalive(t *testing.T) {
+	server := newTestServer(t, Options{
+		NativeWebSocketKeepalive: true,
+		PingInterval:             50 * time.Millisecond,
+		PingTimeout:              100 * time.Millisecond,
+	})
+
+	// Answer the ping control frames with pongs.
+	var pings int32
+	data, frames := dialTestWebSocket(t, server, func(ws *websocket.Conn) func(string) error {
+		return func(appData string) error {
+			atomic.AddInt32(&pings, 1)
+			return ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		}
+	})
+	if !data.NativeKeepalive {
+		t.Fatal("native keepalive not announced")
+	}
+
+	// No ping frames are sent with the stream and the socket stays open.
+	timeout := time.After(400 * time.Millisecond)
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				t.Fatal("socket closed")
+			} else if strings.HasPrefix(frame, cmdPing) {
+				t.Fatalf("unexpected ping frame: %q", frame)
+			}
+			continue
+		case <-timeout:
+		}
+		break
+	}
+
+	if n := atomic.LoadInt32(&pings); n < 3 {
+		t.Fatalf("unexpected ping control frames: %d", n)
+	}
+}
+
+func TestNativeKeepaliveTimeout(t *testing.T) {
+	server := newTestServer(t, Options{
+		NativeWebSocketKeepalive: true,
+		PingInterval:             50 * time.Millisecond,
+		PingTimeout:              100 * time.Millisecond,
+	})
+	closeReason := recordCloseReasons(t, server)
+
+	sockets := make(chan *Socket, 1)
+	server.OnNewSocket(func(s *Socket) {
+		sockets <- s
+	})
+
+	// Don't answer the ping control frames.
+	dialTestWebSocket(t, server, func(ws *websocket.Conn) func(string) error {
+		return func(string) error { return nil }
+	})
+
+	s := <-sockets
+	if reason := closeReason(s); reason != CloseReasonPingTimeout {
+		t.Fatalf("unexpected close reason: %v", reason)
+	}
+}
+
+func TestNativeKeepaliveFallback(t *testing.T) {
+	server := newTestServer(t, Options{
+		NativeWebSocketKeepalive: true,
+		PingInterval:             50 * time.Millisecond,
+		PingTimeout:              100 * time.Millisecond,
+	})
+	closeReason := recordCloseReasons(t, server)
+
+	// Memory sockets don't support native pings. The
+	// pings are sent with the stream and answered by the client.
+	conn := server.ConnectMemory("127.0.0.1", "test")
+	t.Cleanup(func() { conn.Close() })
+
+	if err := conn.Send(cmdInit + `{"version":"` + Version + `"}`); err != nil {
+		t.Fatal(err)
+	}
+	var data initData
+	if err := json.Unmarshal([]byte(receiveFrame(t, conn, cmdInit)), &data); err != nil {
+		t.Fatal(err)
+	} else if data.NativeKeepalive {
+		t.Fatal("native keepalive announced without support")
+	}
+
+	for i := 0; i < 3; i++ {
+		receiveFrame(t, conn, cmdPing)
+		if err := conn.Send(cmdPong); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if conn.socket.IsClosed() {
+		t.Fatal("socket closed")
+	}
+
+	// The socket is closed if the pings are not answered.
+	if reason := closeReason(conn.socket); reason != CloseReasonPingTimeout {
+		t.Fatalf("unexpected close reason: %v", reason)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+// A SocketIDMode defines how the socket IDs are generated.
+type SocketIDMode int
+
+const (
+	// SocketIDRandom generates random IDs with 20 characters.
+	SocketIDRandom SocketIDMode = iota
+
+	// SocketIDSortable generates ULID-style IDs with 26 characters:
+	// the millisecond timestamp followed by 80 random bits, encoded
+	// with Crockford's base32. The IDs sort lexically by their creation
+	// time. IDs created within the same millisecond increase monotonically.
+	SocketIDSortable
+)
+
+const (
+	// The characters of Crockford's base32 encoding.
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+	// The length of an encoded ULID.
+	ulidLength = 26
+)
+
+//###########################//
+//### Socket ID Generator ###//
+//###########################//
+
+// socketIDGenerator creates the IDs of new sockets.
+type socketIDGenerator struct {
+	mode   SocketIDMode
+	prefix string
+
+	lastTime int64    // The timestamp of the last sortable ID.
+	lastRand [10]byte // The random bits of the last sortable ID.
+	mutex    sync.Mutex
+}
+
+func newSocketIDGenerator(mode SocketIDMode, prefix string) *socketIDGenerator {
+	if len(prefix) > 0 {
+		prefix += "-"
+	}
+
+	return &socketIDGenerator{
+		mode:   mode,
+		prefix: prefix,
+	}
+}
+
+// next returns a new socket ID.
+func (g *socketIDGenerator) next() string {
+	if g.mode == SocketIDSortable {
+		return g.prefix + g.nextSortable(time.Now())
+	}
+
+	return g.prefix + utils.RandomString(socketIDLength)
+}
+
+// nextSortable returns a new ULID with the timestamp. The random bits of the
+// previous ID are incremented within the same millisecond, so the IDs of
+// one server keep their creation order.
+func (g *socketIDGenerator) nextSortable(now time.Time) string {
+	// Lock the mutex.
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	ms := now.UnixNano() / int64(time.Millisecond)
+
+	if ms <= g.lastTime && incrementBytes(g.lastRand[:]) {
+		// Same millisecond or the clock went backwards.
+		// Keep the order of the IDs of this server.
+		ms = g.lastTime
+	} else {
+		rand.Read(g.lastRand[:])
+		if ms < g.lastTime {
+			ms = g.lastTime
+		}
+	}
+	g.lastTime = ms
+
+	var b [16]byte
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> uint(40-8*i))
+	}
+	copy(b[6:], g.lastRand[:])
+
+	return encodeULID(b)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// incrementBytes increments the big-endian number by one.
+// Returns false on an overflow.
+func incrementBytes(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeULID encodes the 128 bits with Crockford's base32. The 26
+// characters hold 130 bits, so the first character has two zero bits.
+func encodeULID(b [16]byte) string {
+	var out [ulidLength]byte
+	for i := range out {
+		v := 0
+		for j := 0; j < 5; j++ {
+			p := i*5 + j - 2
+			if p >= 0 && b[p/8]&(0x80>>uint(p%8)) != 0 {
+				v |= 1 << uint(4-j)
+			}
+		}
+		out[i] = crockfordAlphabet[v]
+	}
+
+	return string(out[:])
+}
+
+// validSocketIDPrefix returns an error if the prefix contains
+// other characters than letters, digits, dots and underscores.
+func validSocketIDPrefix(prefix string) error {
+	for _, c := range prefix {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '.' && c != '_' {
+			return fmt.Errorf("invalid character %q", c)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// isCrockford returns true if the string only contains
+// characters of Crockford's base32 alphabet.
+func isCrockford(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune(crockfordAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSocketIDFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   SocketIDMode
+		prefix string
+		length int
+	}{
+		{"random", SocketIDRandom, "", socketIDLength},
+		{"random prefix", SocketIDRandom, "node_1", len("node_1-") + socketIDLength},
+		{"sortable", SocketIDSortable, "", ulidLength},
+		{"sortable prefix", SocketIDSortable, "eu.node1", len("eu.node1-") + ulidLength},
+	}
+
+	for _, test := range tests {
+		g := newSocketIDGenerator(test.mode, test.prefix)
+		ids := make(map[string]struct{})
+
+		for i := 0; i < 10000; i++ {
+			id := g.next()
+			if len(id) != test.length {
+				t.Fatalf("%s: unexpected ID length: %q", test.name, id)
+			}
+			if len(test.prefix) > 0 && !strings.HasPrefix(id, test.prefix+"-") {
+				t.Fatalf("%s: unexpected ID prefix: %q", test.name, id)
+			}
+			if test.mode == SocketIDSortable && !isCrockford(id[len(id)-ulidLength:]) {
+				t.Fatalf("%s: invalid ULID: %q", test.name, id)
+			}
+
+			if _, ok := ids[id]; ok {
+				t.Fatalf("%s: duplicate ID: %q", test.name, id)
+			}
+			ids[id] = struct{}{}
+		}
+	}
+}
+
+func TestSocketIDSortable(t *testing.T) {
+	g := newSocketIDGenerator(SocketIDSortable, "")
+
+	// The IDs of one generator keep their creation order.
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = g.next()
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatal("IDs not sorted by their creation time")
+	}
+
+	// IDs of the same millisecond increase monotonically
+	// and the order is kept if the clock goes backwards.
+	now := time.Now()
+	first := g.nextSortable(now)
+	second := g.nextSortable(now)
+	third := g.nextSortable(now.Add(-time.Second))
+	if !(first < second && second < third) {
+		t.Fatalf("IDs not monotonic: %s %s %s", first, second, third)
+	}
+	if first[:10] != third[:10] {
+		t.Fatalf("timestamp of the earlier clock used: %s %s", first, third)
+	}
+
+	// A later millisecond starts with a later timestamp.
+	if later := g.nextSortable(now.Add(time.Second)); later[:10] <= first[:10] {
+		t.Fatalf("unexpected timestamp: %s %s", first, later)
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	var b [16]byte
+	if s := encodeULID(b); s != "00000000000000000000000000" {
+		t.Fatalf("unexpected ULID: %s", s)
+	}
+
+	for i := range b {
+		b[i] = 0xff
+	}
+	if s := encodeULID(b); s != "7ZZZZZZZZZZZZZZZZZZZZZZZZZ" {
+		t.Fatalf("unexpected ULID: %s", s)
+	}
+
+	// The timestamp of the ULID specification example.
+	g := newSocketIDGenerator(SocketIDSortable, "")
+	if s := g.nextSortable(time.Unix(0, 1469918176385*int64(time.Millisecond))); s[:10] != "01ARYZ6S41" {
+		t.Fatalf("unexpected ULID timestamp: %s", s)
+	}
+}
+
+func TestIncrementBytes(t *testing.T) {
+	b := []byte{0x00, 0xff}
+	if !incrementBytes(b) || b[0] != 0x01 || b[1] != 0x00 {
+		t.Fatalf("unexpected increment: %v", b)
+	}
+
+	b = []byte{0xff, 0xff}
+	if incrementBytes(b) || b[0] != 0 || b[1] != 0 {
+		t.Fatalf("unexpected overflow: %v", b)
+	}
+}
+
+func TestValidSocketIDPrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		valid  bool
+	}{
+		{"", true},
+		{"node1", true},
+		{"eu.node_1", true},
+		{"node-1", false},
+		{"node 1", false},
+		{"nöde", false},
+	}
+
+	for _, test := range tests {
+		if err := validSocketIDPrefix(test.prefix); (err == nil) != test.valid {
+			t.Errorf("%q: unexpected result: %v", test.prefix, err)
+		}
+	}
+}
+
+func TestServerSocketIDs(t *testing.T) {
+	server := newTestServer(t, Options{SocketIDMode: SocketIDSortable, SocketIDPrefix: "node1"})
+
+	ids := make(map[string]struct{})
+	for i := 0; i < 20; i++ {
+		_, s := connectTestSocket(t, server)
+
+		id := s.ID()
+		if !strings.HasPrefix(id, "node1-") || len(id) != len("node1-")+ulidLength {
+			t.Fatalf("unexpected socket ID: %q", id)
+		}
+		if _, ok := ids[id]; ok {
+			t.Fatalf("duplicate socket ID: %q", id)
+		}
+		ids[id] = struct{}{}
+
+		if server.GetSocket(id) != s {
+			t.Fatalf("socket not found by its ID: %q", id)
+		}
+	}
+}
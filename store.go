@@ -0,0 +1,156 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// A StoredMessage is a message persisted in a stream of a store.
+type StoredMessage struct {
+	// Seq is the sequence number of the message within the stream.
+	// The sequence numbers start at 1 and increase monotonically.
+	Seq  uint64
+	Time time.Time
+	Data string
+}
+
+// A Store persists the messages of the persistence features in streams.
+// Implement this interface to back the messages by a durable database
+// like Redis or Postgres. The methods are called concurrently.
+type Store interface {
+	// Append persists the data at the end of the stream and
+	// returns the sequence number of the message.
+	Append(stream, data string) (uint64, error)
+
+	// Range calls f in order for the messages of the stream with a sequence
+	// number greater than or equal to from, until f returns false. Unknown
+	// streams are empty.
+	Range(stream string, from uint64, f func(msg StoredMessage) bool) error
+
+	// Trim removes the messages of the stream with a sequence number less
+	// than before. The sequence numbers of the stream are never reused.
+	Trim(stream string, before uint64) error
+}
+
+//####################//
+//### Memory Store ###//
+//####################//
+
+// A MemoryStore is a store keeping the messages in memory.
+// The messages are lost if the process exits.
+type MemoryStore struct {
+	streams map[string]*memoryStream
+	mutex   sync.Mutex
+}
+
+type memoryStream struct {
+	seq      uint64
+	messages []StoredMessage
+}
+
+// NewMemoryStore creates a new in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		streams: make(map[string]*memoryStream),
+	}
+}
+
+// Append persists the data at the end of the stream.
+// See the Store interface.
+func (m *MemoryStore) Append(stream, data string) (uint64, error) {
+	// Lock the mutex.
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	st, ok := m.streams[stream]
+	if !ok {
+		st = &memoryStream{}
+		m.streams[stream] = st
+	}
+
+	st.seq++
+	st.messages = append(st.messages, StoredMessage{
+		Seq:  st.seq,
+		Time: time.Now(),
+		Data: data,
+	})
+
+	return st.seq, nil
+}
+
+// Range iterates over the messages of the stream.
+// See the Store interface.
+func (m *MemoryStore) Range(stream string, from uint64, f func(msg StoredMessage) bool) error {
+	// Copy the messages, so f may call the store.
+	messages := func() []StoredMessage {
+		// Lock the mutex.
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		st, ok := m.streams[stream]
+		if !ok {
+			return nil
+		}
+
+		i := st.index(from)
+		return append([]StoredMessage(nil), st.messages[i:]...)
+	}()
+
+	for _, msg := range messages {
+		if !f(msg) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Trim removes the messages of the stream before the sequence number.
+// See the Store interface.
+func (m *MemoryStore) Trim(stream string, before uint64) error {
+	// Lock the mutex.
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	st, ok := m.streams[stream]
+	if !ok {
+		return nil
+	}
+
+	// Release the memory of the removed messages.
+	i := st.index(before)
+	st.messages = append([]StoredMessage(nil), st.messages[i:]...)
+
+	return nil
+}
+
+// index returns the index of the first message
+// with a sequence number greater than or equal to seq.
+func (st *memoryStream) index(seq uint64) int {
+	return sort.Search(len(st.messages), func(i int) bool {
+		return st.messages[i].Seq >= seq
+	})
+}
@@ -0,0 +1,154 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// AddTag labels the socket with the tag, for example "admin", "beta"
+// or a region code. Tags are a lightweight alternative to topics to
+// select sockets. Use the server SocketsByTag and BroadcastTag methods.
+func (s *Socket) AddTag(tag string) {
+	// Lock the server tags mutex first to update the index.
+	s.server.tagsMutex.Lock()
+	defer s.server.tagsMutex.Unlock()
+
+	// Lock the mutex.
+	s.tagsMutex.Lock()
+	defer s.tagsMutex.Unlock()
+
+	// Closed sockets are not added to the index again.
+	if s.IsClosed() {
+		return
+	}
+
+	s.tags[tag] = struct{}{}
+
+	sockets, ok := s.server.tags[tag]
+	if !ok {
+		sockets = make(map[*Socket]struct{})
+		s.server.tags[tag] = sockets
+	}
+	sockets[s] = struct{}{}
+}
+
+// RemoveTag removes the tag from the socket.
+func (s *Socket) RemoveTag(tag string) {
+	// Lock the server tags mutex first to update the index.
+	s.server.tagsMutex.Lock()
+	defer s.server.tagsMutex.Unlock()
+
+	// Lock the mutex.
+	s.tagsMutex.Lock()
+	defer s.tagsMutex.Unlock()
+
+	delete(s.tags, tag)
+	s.server.removeTagSocket(tag, s)
+}
+
+// HasTag returns true if the socket is labeled with the tag.
+func (s *Socket) HasTag(tag string) bool {
+	// Lock the mutex.
+	s.tagsMutex.Lock()
+	defer s.tagsMutex.Unlock()
+
+	_, ok := s.tags[tag]
+	return ok
+}
+
+// Tags returns all tags of the socket.
+func (s *Socket) Tags() []string {
+	// Lock the mutex.
+	s.tagsMutex.Lock()
+	defer s.tagsMutex.Unlock()
+
+	tags := make([]string, 0, len(s.tags))
+	for tag := range s.tags {
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// SocketsByTag returns all current connected sockets labeled with the tag.
+// Sockets are removed automatically as soon as they are closed.
+func (s *Server) SocketsByTag(tag string) []*Socket {
+	// Lock the mutex.
+	s.tagsMutex.Lock()
+	defer s.tagsMutex.Unlock()
+
+	sockets := s.tags[tag]
+
+	// Create the slice.
+	list := make([]*Socket, 0, len(sockets))
+	for socket := range sockets {
+		list = append(list, socket)
+	}
+
+	return list
+}
+
+// BroadcastTag writes the data to the main channel of all
+// current connected sockets labeled with the tag.
+func (s *Server) BroadcastTag(tag, data string) {
+	// Build the frame once for all sockets.
+	rawData := channelFrame(mainChannelName, data)
+
+	for _, socket := range s.SocketsByTag(tag) {
+		if socket.IsClosed() {
+			continue
+		}
+
+		socket.mainChannel.writeFrame(data, rawData)
+	}
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// removeTagSocket removes the socket from the tags index.
+// Hint: the tags mutex has to be locked.
+func (s *Server) removeTagSocket(tag string, socket *Socket) {
+	sockets, ok := s.tags[tag]
+	if !ok {
+		return
+	}
+
+	delete(sockets, socket)
+	if len(sockets) == 0 {
+		delete(s.tags, tag)
+	}
+}
+
+// removeClosedTagSocket removes the closed socket from the tags index.
+func (s *Server) removeClosedTagSocket(socket *Socket) {
+	// Lock the mutex.
+	s.tagsMutex.Lock()
+	defer s.tagsMutex.Unlock()
+
+	for _, tag := range socket.Tags() {
+		s.removeTagSocket(tag, socket)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/utils"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The length of the connect ticket tokens.
+	connectTicketLength = 32
+
+	// The expired tickets are removed at most once per interval.
+	connectTicketCleanupInterval = time.Minute
+
+	// The default absolute lifetime of the renewed ticket chains.
+	defaultConnectTicketMaxLifetime = 24 * time.Hour
+)
+
+//####################//
+//### Ticket Types ###//
+//####################//
+
+type connectTicket struct {
+	userID  string
+	ttl     time.Duration
+	expires time.Time
+
+	// The absolute deadline of the ticket and all its renewals.
+	deadline time.Time
+}
+
+// connectTickets holds the issued single-use connect tickets by their token.
+type connectTickets struct {
+	tickets     map[string]connectTicket
+	lastCleanup time.Time
+	mutex       sync.Mutex
+}
+
+func newConnectTickets() *connectTickets {
+	return &connectTickets{
+		tickets:     make(map[string]connectTicket),
+		lastCleanup: time.Now(),
+	}
+}
+
+// add issues a new ticket for the user and returns its token.
+// The ticket expires after the TTL, but never after the deadline.
+// An empty token is returned if the deadline passed.
+func (t *connectTickets) add(userID string, ttl time.Duration, deadline time.Time) string {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.cleanup(now)
+
+	if !now.Before(deadline) {
+		return ""
+	}
+
+	expires := now.Add(ttl)
+	if expires.After(deadline) {
+		expires = deadline
+	}
+
+	token := utils.RandomString(connectTicketLength)
+	t.tickets[token] = connectTicket{
+		userID:   userID,
+		ttl:      ttl,
+		expires:  expires,
+		deadline: deadline,
+	}
+
+	return token
+}
+
+// valid returns true if the ticket of the token exists and is not expired.
+// The ticket is not consumed.
+func (t *connectTickets) valid(token string) bool {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	ticket, ok := t.tickets[token]
+	return ok && time.Now().Before(ticket.expires)
+}
+
+// consume removes the ticket of the token and returns it.
+// Returns false if the ticket does not exist or expired.
+func (t *connectTickets) consume(token string) (connectTicket, bool) {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	t.cleanup(now)
+
+	ticket, ok := t.tickets[token]
+	if !ok {
+		return connectTicket{}, false
+	}
+	delete(t.tickets, token)
+
+	if !now.Before(ticket.expires) {
+		return connectTicket{}, false
+	}
+
+	return ticket, true
+}
+
+// cleanup removes the expired tickets. The tickets are checked
+// at most once per cleanup interval. The mutex must be locked.
+func (t *connectTickets) cleanup(now time.Time) {
+	if now.Sub(t.lastCleanup) < connectTicketCleanupInterval {
+		return
+	}
+	t.lastCleanup = now
+
+	for token, ticket := range t.tickets {
+		if !now.Before(ticket.expires) {
+			delete(t.tickets, token)
+		}
+	}
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// NewConnectTicket issues a short-lived single-use ticket for the user and
+// returns its token. Pass the token with the ticket option to the client.
+// The ticket is validated as soon as the client connects and consumed
+// after the socket was accepted. The user ID is set on the socket then. The server passes a renewed ticket
+// with the same TTL to the client for the next reconnect, so no long-lived
+// credentials are required. The renewals end after the absolute
+// ConnectTicketMaxLifetime option, counted from this call. The client has
+// to fetch a new ticket afterwards. The tickets are kept in memory and are
+// only valid on this server node.
+func (s *Server) NewConnectTicket(userID string, ttl time.Duration) (string, error) {
+	if len(userID) == 0 {
+		return "", fmt.Errorf("glue: connect ticket: empty user ID")
+	} else if ttl <= 0 {
+		return "", fmt.Errorf("glue: connect ticket: invalid TTL: %v", ttl)
+	}
+
+	deadline := time.Now().Add(s.options.ConnectTicketMaxLifetime)
+
+	return s.tickets.add(userID, ttl, deadline), nil
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// checkTicket rejects sockets without a valid connect ticket before the
+// handshake. Sockets without a ticket are rejected if tickets are required.
+// The ticket is not consumed, so a rejected socket doesn't burn it.
+func (s *Socket) checkTicket(token string) error {
+	if len(token) == 0 {
+		if s.server.options.RequireConnectTicket {
+			return &RejectError{
+				Code:    RejectCodeTicket,
+				Message: "connect ticket required",
+			}
+		}
+		return nil
+	}
+
+	if !s.server.tickets.valid(token) {
+		return &RejectError{
+			Code:    RejectCodeTicket,
+			Message: "invalid or expired connect ticket",
+		}
+	}
+
+	return nil
+}
+
+// redeemTicket consumes the connect ticket of the client and sets the
+// user ID of the socket. Call this only after the socket was accepted by
+// the handshake and the authentication. A renewed ticket is returned,
+// which is empty if the absolute lifetime of the ticket passed.
+func (s *Socket) redeemTicket(token string) (string, error) {
+	if len(token) == 0 {
+		return "", nil
+	}
+
+	// The ticket might be consumed by a concurrent socket in between.
+	ticket, ok := s.server.tickets.consume(token)
+	if !ok {
+		return "", &RejectError{
+			Code:    RejectCodeTicket,
+			Message: "invalid or expired connect ticket",
+		}
+	}
+
+	if err := s.SetUserID(ticket.userID); err != nil {
+		return "", err
+	}
+
+	return s.server.tickets.add(ticket.userID, ticket.ttl, ticket.deadline), nil
+}
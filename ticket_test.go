@@ -0,0 +1,207 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// connectWithTicket connects with the ticket and returns the init or reject reply.
+func connectWithTicket(t *testing.T, server *Server, ticket string) (cmd, data string) {
+	t.Helper()
+
+	dataJSON, err := json.Marshal(&clientInitData{
+		Version: Version,
+		Ticket:  ticket,
+		Reject:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn := server.ConnectMemory("127.0.0.1", "test")
+	t.Cleanup(func() { conn.Close() })
+
+	if err = conn.Send(cmdInit + string(dataJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		frame, err := conn.Receive(5 * time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.HasPrefix(frame, cmdInit) || strings.HasPrefix(frame, cmdReject) {
+			return frame[:cmdLen], frame[cmdLen:]
+		}
+	}
+}
+
+func TestConnectTicket(t *testing.T) {
+	server := newTestServer(t, Options{RequireConnectTicket: true})
+
+	ticket, err := server.NewConnectTicket("alice", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, data := connectWithTicket(t, server, ticket)
+	if cmd != cmdInit {
+		t.Fatalf("ticket rejected: %s", data)
+	}
+
+	var init initData
+	if err = json.Unmarshal([]byte(data), &init); err != nil {
+		t.Fatal(err)
+	}
+	if len(init.Ticket) == 0 || init.Ticket == ticket {
+		t.Fatalf("no renewed ticket: %q", init.Ticket)
+	}
+
+	s := server.GetSocket(init.SocketID)
+	if s == nil || s.UserID() != "alice" {
+		t.Fatal("user ID of the ticket not set")
+	}
+
+	// The ticket is single-use.
+	if cmd, _ = connectWithTicket(t, server, ticket); cmd != cmdReject {
+		t.Fatal("consumed ticket accepted")
+	}
+
+	// The renewed ticket is valid for the same user.
+	if cmd, data = connectWithTicket(t, server, init.Ticket); cmd != cmdInit {
+		t.Fatalf("renewed ticket rejected: %s", data)
+	}
+}
+
+func TestConnectTicketHandshakeRejected(t *testing.T) {
+	var reject atomic.Bool
+	reject.Store(true)
+
+	server := newTestServer(t, Options{
+		RequireConnectTicket: true,
+		OnHandshake: func(s *Socket, payload string) error {
+			// The ticket is redeemed after the handshake.
+			if s.UserID() != "" {
+				t.Errorf("user ID set before the handshake: %q", s.UserID())
+			}
+			if reject.Load() {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+	})
+
+	ticket, err := server.NewConnectTicket("alice", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rejected socket doesn't consume the ticket.
+	if cmd, data := connectWithTicket(t, server, ticket); cmd != cmdReject || !strings.Contains(data, RejectCodeHandshake) {
+		t.Fatalf("unexpected reply: %s%s", cmd, data)
+	}
+
+	reject.Store(false)
+	cmd, data := connectWithTicket(t, server, ticket)
+	if cmd != cmdInit {
+		t.Fatalf("ticket rejected: %s", data)
+	}
+
+	var init initData
+	if err = json.Unmarshal([]byte(data), &init); err != nil {
+		t.Fatal(err)
+	}
+	if s := server.GetSocket(init.SocketID); s == nil || s.UserID() != "alice" {
+		t.Fatal("user ID of the ticket not set")
+	}
+}
+
+func TestConnectTicketRejected(t *testing.T) {
+	server := newTestServer(t, Options{RequireConnectTicket: true})
+
+	if _, err := server.NewConnectTicket("", time.Minute); err == nil {
+		t.Fatal("ticket without user ID issued")
+	}
+	if _, err := server.NewConnectTicket("alice", 0); err == nil {
+		t.Fatal("ticket without TTL issued")
+	}
+
+	ticket, err := server.NewConnectTicket("alice", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	tests := map[string]string{
+		"missing": "",
+		"unknown": "unknown",
+		"expired": ticket,
+	}
+
+	for name, ticket := range tests {
+		cmd, data := connectWithTicket(t, server, ticket)
+		if cmd != cmdReject || !strings.Contains(data, RejectCodeTicket) {
+			t.Errorf("%s ticket: unexpected reply: %s%s", name, cmd, data)
+		}
+	}
+}
+
+func TestConnectTicketMaxLifetime(t *testing.T) {
+	server := newTestServer(t, Options{
+		RequireConnectTicket:     true,
+		ConnectTicketMaxLifetime: 200 * time.Millisecond,
+	})
+
+	ticket, err := server.NewConnectTicket("alice", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, data := connectWithTicket(t, server, ticket)
+	if cmd != cmdInit {
+		t.Fatalf("ticket rejected: %s", data)
+	}
+
+	var init initData
+	if err = json.Unmarshal([]byte(data), &init); err != nil {
+		t.Fatal(err)
+	}
+	if len(init.Ticket) == 0 {
+		t.Fatal("no renewed ticket")
+	}
+
+	// The renewed ticket expires with the absolute lifetime, not the TTL.
+	time.Sleep(250 * time.Millisecond)
+
+	if cmd, _ = connectWithTicket(t, server, init.Ticket); cmd != cmdReject {
+		t.Fatal("renewed ticket accepted after the max lifetime")
+	}
+
+	// No tickets are renewed after the deadline.
+	if token := server.tickets.add("alice", time.Minute, time.Now()); len(token) > 0 {
+		t.Fatal("ticket renewed after the deadline")
+	}
+}
@@ -0,0 +1,688 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	// The reserved channel name used by clients to subscribe to topics.
+	topicChannelName = "_topic"
+
+	// The prefix of the store streams keeping the topic histories.
+	topicStreamPrefix = "topic/"
+
+	// The maximum number of messages queued for a subscriber.
+	topicQueueSize = 1024
+
+	// Topic request types. Must be one character long.
+	topicSubscribe   = "s"
+	topicUnsubscribe = "u"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// TopicOptions holds the options of a topic.
+type TopicOptions struct {
+	// HistorySize defines how many published messages are kept
+	// in the server store and replayed to new subscribers.
+	// Default: 0 (disabled)
+	HistorySize int
+
+	// Retain keeps the latest published message and replays it
+	// to new subscribers (MQTT-style retained message).
+	// This is ignored if a history size is set.
+	Retain bool
+
+	// AllowClientSubscribe allows clients to subscribe to the topic
+	// with the client socket topic method.
+	AllowClientSubscribe bool
+
+	// MaxRate limits the messages delivered to the subscribers per second.
+	// Messages exceeding the rate are conflated: only the latest message
+	// is delivered as soon as the rate allows it. The history only keeps
+	// the delivered messages. In cluster mode, each node limits the
+	// delivery to its subscribers. Default: 0 (unlimited)
+	MaxRate float64
+
+	// Merge combines the pending conflated message with a newer message
+	// if the MaxRate is exceeded, for example to merge partial updates.
+	// Default: keep the latest message.
+	Merge func(pending, data string) string
+}
+
+//##################//
+//### Topic Type ###//
+//##################//
+
+// A topicSubscriber is a socket subscribed to a topic. The messages
+// are queued and written by a separate goroutine, so a slow subscriber
+// never blocks the topic or the other subscribers.
+type topicSubscriber struct {
+	socket       *Socket
+	name         string        // The topic name.
+	userID       string        // The user ID at the time of the subscription.
+	unsubscribed chan struct{} // Closed as soon as the socket unsubscribes.
+
+	queue   []topicMessage // The messages waiting to be written.
+	writing bool           // Set as long as the write goroutine runs.
+	mutex   sync.Mutex
+}
+
+type topicMessage struct {
+	data    string
+	rawData string
+}
+
+// push queues the messages for the subscribed socket. This never blocks.
+// The socket is closed if it can't keep up with the queued messages.
+// The client receives the history again after the reconnect.
+func (sub *topicSubscriber) push(msgs ...topicMessage) {
+	// Lock the mutex.
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	if len(sub.queue)+len(msgs) > topicQueueSize {
+		sub.queue = nil
+
+		log.L.WithFields(logrus.Fields{
+			"topic":         sub.name,
+			"socketID":      sub.socket.ID(),
+			"remoteAddress": sub.socket.RemoteAddr(),
+		}).Warningf("glue: topic subscriber is too slow: closing socket")
+
+		go sub.socket.Close()
+		return
+	}
+
+	sub.queue = append(sub.queue, msgs...)
+
+	// Start the write goroutine if not running.
+	if !sub.writing && len(sub.queue) > 0 {
+		sub.writing = true
+		go sub.writeLoop()
+	}
+}
+
+// writeLoop writes the queued messages until the queue is empty.
+func (sub *topicSubscriber) writeLoop() {
+	c := sub.socket.Channel(sub.name)
+
+	for {
+		msg, ok := sub.next()
+		if !ok {
+			return
+		}
+
+		c.writeFrame(msg.data, msg.rawData)
+	}
+}
+
+// next removes and returns the next queued message. Returns false and
+// stops the write goroutine if the queue is empty or the socket closed.
+func (sub *topicSubscriber) next() (topicMessage, bool) {
+	// Lock the mutex.
+	sub.mutex.Lock()
+	defer sub.mutex.Unlock()
+
+	if len(sub.queue) == 0 || sub.socket.IsClosed() {
+		sub.queue = nil
+		sub.writing = false
+		return topicMessage{}, false
+	}
+
+	msg := sub.queue[0]
+	sub.queue = sub.queue[1:]
+
+	return msg, true
+}
+
+// A Topic is a server maintained channel. Published messages are written
+// to the channel with the topic name of all subscribed sockets.
+// Closed sockets are unsubscribed automatically.
+type Topic struct {
+	server  *Server
+	name    string
+	options TopicOptions
+
+	stream      string // The store stream of the history.
+	subscribers map[*Socket]*topicSubscriber
+	members     map[string]int // The subscribed sockets by the user ID.
+	onActive    func(active bool)
+	mutex       sync.Mutex
+
+	// Set if this node is registered at the topic owner. The register
+	// mutex serializes the registration changes without the topic mutex,
+	// so a slow cluster adapter doesn't block the topic.
+	registered    bool
+	registerMutex sync.Mutex
+
+	// Serializes the deliveries and the history updates to keep the
+	// message order. The store is accessed without the topic mutex and
+	// the messages are queued for the subscribers without blocking.
+	deliverMutex sync.Mutex
+
+	interval     time.Duration // The minimum interval between deliveries.
+	lastDelivery time.Time
+	pending      *string     // The conflated message waiting for delivery.
+	pendingTimer *time.Timer // Delivers the pending message.
+}
+
+func newTopic(server *Server, name string, options TopicOptions) *Topic {
+	// The retained message is a history with one entry.
+	if options.HistorySize <= 0 && options.Retain {
+		options.HistorySize = 1
+	}
+
+	t := &Topic{
+		server:      server,
+		name:        name,
+		options:     options,
+		stream:      topicStreamPrefix + name,
+		subscribers: make(map[*Socket]*topicSubscriber),
+		members:     make(map[string]int),
+	}
+
+	if options.MaxRate > 0 {
+		t.interval = time.Duration(float64(time.Second) / options.MaxRate)
+	}
+
+	return t
+}
+
+// Name returns the topic name. This is also the channel name on the client side.
+func (t *Topic) Name() string {
+	return t.name
+}
+
+// Subscribe adds the socket to the topic. The message history
+// or the retained message is replayed to the socket first.
+func (t *Topic) Subscribe(s *Socket) {
+	var presence *ClusterMessage
+
+	sub := func() *topicSubscriber {
+		// Lock the deliver mutex. No message is delivered between
+		// the history replay and the subscription.
+		t.deliverMutex.Lock()
+		defer t.deliverMutex.Unlock()
+
+		// Read the history without the topic mutex.
+		history := t.history()
+
+		// Lock the mutex.
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		if _, ok := t.subscribers[s]; ok {
+			return nil
+		}
+
+		sub := &topicSubscriber{
+			socket:       s,
+			name:         t.name,
+			userID:       s.UserID(),
+			unsubscribed: make(chan struct{}),
+		}
+		t.subscribers[s] = sub
+
+		// Queue the history replay before the following deliveries.
+		msgs := make([]topicMessage, len(history))
+		for i, data := range history {
+			msgs[i] = topicMessage{data: data, rawData: channelFrame(t.name, data)}
+		}
+		sub.push(msgs...)
+
+		// Count the member.
+		if len(sub.userID) > 0 {
+			t.members[sub.userID]++
+			presence = t.server.setPresence(presenceTopicKey(t.name, sub.userID), t.members[sub.userID])
+		}
+
+		// Register the first subscriber of this node at the topic owner.
+		if len(t.subscribers) == 1 {
+			t.syncClusterLater()
+			if t.onActive != nil {
+				t.onActive(true)
+			}
+		}
+
+		return sub
+	}()
+	if sub == nil {
+		return
+	}
+
+	t.server.broadcastPresence(presence)
+
+	// Unsubscribe the socket as soon as it closes. The goroutine
+	// exits as soon as the socket unsubscribes.
+	go func() {
+		select {
+		case <-s.ClosedChan():
+			t.Unsubscribe(s)
+		case <-sub.unsubscribed:
+		}
+	}()
+}
+
+// Unsubscribe removes the socket from the topic.
+func (t *Topic) Unsubscribe(s *Socket) {
+	t.server.broadcastPresence(t.unsubscribe(s))
+}
+
+// unsubscribe removes the socket from the topic and returns
+// the presence update of the member count.
+func (t *Topic) unsubscribe(s *Socket) (presence *ClusterMessage) {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	sub, ok := t.subscribers[s]
+	if !ok {
+		return nil
+	}
+	delete(t.subscribers, s)
+	close(sub.unsubscribed)
+
+	// Count the member.
+	if len(sub.userID) > 0 {
+		t.members[sub.userID]--
+		count := t.members[sub.userID]
+		if count <= 0 {
+			delete(t.members, sub.userID)
+		}
+		presence = t.server.setPresence(presenceTopicKey(t.name, sub.userID), count)
+	}
+
+	// Remove the registration at the topic owner with the last subscriber.
+	if len(t.subscribers) == 0 {
+		t.syncClusterLater()
+		if t.onActive != nil {
+			t.onActive(false)
+		}
+	}
+
+	return presence
+}
+
+// OnActive sets the function which is called with true as soon as the first
+// socket of this node subscribes to the topic and with false after the last
+// socket unsubscribed, for example to consume an external message source
+// only while needed. The function is called with true right away if the
+// topic has subscribers already. It is called with the topic lock held and
+// must not block or call the topic methods.
+func (t *Topic) OnActive(f func(active bool)) {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.onActive = f
+
+	if f != nil && len(t.subscribers) > 0 {
+		f(true)
+	}
+}
+
+// Publish writes the data to all subscribers and adds it to the history.
+// If the MaxRate option is exceeded, the data is conflated with the
+// pending message and delivered as soon as the rate allows it.
+// In cluster mode, the data is passed to the topic owner node, which
+// forwards it to all nodes with subscribers of the topic.
+func (t *Topic) Publish(data string) {
+	if c := t.server.cluster; c != nil {
+		c.publish(t.name, data)
+		return
+	}
+
+	t.deliver(data)
+}
+
+// PublishLocal writes the data to the subscribers of this node only and adds
+// it to the history of this node, also in cluster mode. Use it for messages of
+// an external source which each node with subscribers consumes itself.
+func (t *Topic) PublishLocal(data string) {
+	t.deliver(data)
+}
+
+// History returns a copy of the message history.
+// In cluster mode, only nodes with subscribers keep the history.
+func (t *Topic) History() []string {
+	// Lock the deliver mutex.
+	t.deliverMutex.Lock()
+	defer t.deliverMutex.Unlock()
+
+	return t.history()
+}
+
+// Subscribers returns a list of all subscribed sockets.
+func (t *Topic) Subscribers() []*Socket {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	list := make([]*Socket, 0, len(t.subscribers))
+	for s := range t.subscribers {
+		list = append(list, s)
+	}
+
+	return list
+}
+
+// deliver writes the data to the subscribers of this node and adds it to the history.
+// The data is conflated with the pending message if the maximum rate is exceeded.
+func (t *Topic) deliver(data string) {
+	// Lock the deliver mutex.
+	t.deliverMutex.Lock()
+	defer t.deliverMutex.Unlock()
+
+	subscribers, ok := t.prepare(data)
+	if !ok {
+		return
+	}
+
+	t.write(subscribers, data)
+}
+
+// prepare adds the data to the history and returns the current subscribers.
+// Returns false if the data was conflated with the pending message.
+// The deliver mutex must be locked.
+func (t *Topic) prepare(data string) ([]*topicSubscriber, bool) {
+	if !t.conflate(&data) {
+		return nil, false
+	}
+
+	// Update the history without the topic mutex.
+	t.appendHistory(data)
+
+	return t.snapshot(), true
+}
+
+// conflate checks the maximum rate. Returns false if the data was
+// conflated with the pending message. The data is replaced with
+// the merged message.
+func (t *Topic) conflate(data *string) bool {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.interval > 0 {
+		now := time.Now()
+		wait := t.lastDelivery.Add(t.interval).Sub(now)
+
+		// Conflate the data with the pending message.
+		if wait > 0 || t.pending != nil {
+			merged := *data
+			if t.pending != nil && t.options.Merge != nil {
+				merged = t.options.Merge(*t.pending, merged)
+			}
+			t.pending = &merged
+
+			if t.pendingTimer == nil {
+				t.pendingTimer = time.AfterFunc(wait, t.deliverPending)
+			}
+			return false
+		}
+
+		t.lastDelivery = now
+	}
+
+	return true
+}
+
+// deliverPending delivers the pending conflated message.
+func (t *Topic) deliverPending() {
+	// Lock the deliver mutex.
+	t.deliverMutex.Lock()
+	defer t.deliverMutex.Unlock()
+
+	data, ok := func() (string, bool) {
+		// Lock the mutex.
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+
+		t.pendingTimer = nil
+		if t.pending == nil {
+			return "", false
+		}
+
+		data := *t.pending
+		t.pending = nil
+		t.lastDelivery = time.Now()
+
+		return data, true
+	}()
+	if !ok {
+		return
+	}
+
+	// Update the history without the topic mutex.
+	t.appendHistory(data)
+
+	t.write(t.snapshot(), data)
+}
+
+// snapshot returns a copy of the subscribers. The deliver mutex must be
+// locked, so sockets subscribing afterwards receive the data with the
+// history replay.
+func (t *Topic) snapshot() []*topicSubscriber {
+	// Lock the mutex.
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	list := make([]*topicSubscriber, 0, len(t.subscribers))
+	for _, sub := range t.subscribers {
+		list = append(list, sub)
+	}
+
+	return list
+}
+
+// write queues the data for the subscribers. This never blocks.
+func (t *Topic) write(subscribers []*topicSubscriber, data string) {
+	// Build the frame once for all subscribers.
+	msg := topicMessage{data: data, rawData: channelFrame(t.name, data)}
+	for _, sub := range subscribers {
+		sub.push(msg)
+	}
+}
+
+// history returns the messages of the history.
+// The deliver mutex must be locked.
+func (t *Topic) history() []string {
+	if t.options.HistorySize <= 0 {
+		return nil
+	}
+
+	var list []string
+	err := t.server.options.Store.Range(t.stream, 0, func(msg StoredMessage) bool {
+		list = append(list, msg.Data)
+		return true
+	})
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"topic": t.name,
+		}).Warningf("glue: failed to read the topic history: %v", err)
+	}
+
+	return list
+}
+
+// appendHistory adds the data to the history and removes the
+// messages exceeding the history size. The deliver mutex must be locked.
+func (t *Topic) appendHistory(data string) {
+	if t.options.HistorySize <= 0 {
+		return
+	}
+
+	st := t.server.options.Store
+
+	seq, err := st.Append(t.stream, data)
+	if err == nil && seq > uint64(t.options.HistorySize) {
+		err = st.Trim(t.stream, seq-uint64(t.options.HistorySize)+1)
+	}
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"topic": t.name,
+		}).Warningf("glue: failed to update the topic history: %v", err)
+	}
+}
+
+// syncClusterLater queues the registration change at the topic owner.
+// The adapter is called by a cluster worker without any topic lock.
+func (t *Topic) syncClusterLater() {
+	if c := t.server.cluster; c != nil {
+		c.pushSocketTask(topicStreamPrefix+t.name, "topic registration", t.syncCluster)
+	}
+}
+
+// syncCluster registers this node at the topic owner if the topic
+// has subscribers and removes the registration otherwise.
+func (t *Topic) syncCluster() {
+	c := t.server.cluster
+
+	// Lock the register mutex.
+	t.registerMutex.Lock()
+	defer t.registerMutex.Unlock()
+
+	// Copy the state. The topic mutex is not locked while sending.
+	t.mutex.Lock()
+	active := len(t.subscribers) > 0
+	t.mutex.Unlock()
+
+	if active == t.registered {
+		return
+	}
+	t.registered = active
+
+	if active {
+		c.subscribe(t.name)
+	} else {
+		c.unsubscribe(t.name)
+	}
+}
+
+// moveCluster moves the registration of the subscribers of this node
+// to the new topic owner after the cluster nodes changed.
+func (t *Topic) moveCluster(c *cluster, previous *hashRing, active map[string]struct{}) {
+	// Lock the register mutex. The topic mutex is not locked while sending.
+	t.registerMutex.Lock()
+	defer t.registerMutex.Unlock()
+
+	if !t.registered {
+		return
+	}
+
+	c.move(previous, active, t.name, &ClusterMessage{
+		Type:  clusterTopicSubscribe,
+		Topic: t.name,
+	}, &ClusterMessage{
+		Type:  clusterTopicUnsubscribe,
+		Topic: t.name,
+	})
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// Topic returns the topic specified by the name.
+// A new topic is created if it does not exist.
+// One variadic argument sets the topic options.
+// The options are only applied if the topic is created.
+func (s *Server) Topic(name string, o ...TopicOptions) *Topic {
+	// Lock the mutex.
+	s.topicsMutex.Lock()
+	defer s.topicsMutex.Unlock()
+
+	t, ok := s.topics[name]
+	if !ok {
+		var options TopicOptions
+		if len(o) > 0 {
+			options = o[0]
+		}
+
+		t = newTopic(s, name, options)
+		s.topics[name] = t
+	}
+
+	return t
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// getTopic returns the topic or nil if it does not exist.
+func (s *Server) getTopic(name string) *Topic {
+	// Lock the mutex.
+	s.topicsMutex.Lock()
+	defer s.topicsMutex.Unlock()
+
+	return s.topics[name]
+}
+
+// topicList returns a list of all topics.
+func (s *Server) topicList() []*Topic {
+	// Lock the mutex.
+	s.topicsMutex.Lock()
+	defer s.topicsMutex.Unlock()
+
+	list := make([]*Topic, 0, len(s.topics))
+	for _, t := range s.topics {
+		list = append(list, t)
+	}
+
+	return list
+}
+
+// handleTopic handles the topic subscription requests of the client.
+func (s *Socket) handleTopic(data string) error {
+	if len(data) == 0 {
+		return fmt.Errorf("invalid topic request")
+	}
+
+	name := data[1:]
+	t := s.server.getTopic(name)
+	if t == nil || !t.options.AllowClientSubscribe {
+		return fmt.Errorf("client subscription to topic '%s' is not allowed", name)
+	}
+
+	switch data[:1] {
+	case topicSubscribe:
+		t.Subscribe(s)
+	case topicUnsubscribe:
+		t.Unsubscribe(s)
+	default:
+		return fmt.Errorf("invalid topic request type")
+	}
+
+	return nil
+}
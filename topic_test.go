@@ -0,0 +1,275 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTopicHistoryReplay(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("news", TopicOptions{HistorySize: 2})
+
+	topic.Publish("1")
+	topic.Publish("2")
+	topic.Publish("3")
+
+	conn, s := connectTestSocket(t, server)
+	topic.Subscribe(s)
+	topic.Publish("4")
+
+	for _, expected := range []string{"2", "3", "4"} {
+		name, data := receiveChannelData(t, conn)
+		if name != "news" || data != expected {
+			t.Fatalf("expected news:%s, got %s:%s", expected, name, data)
+		}
+	}
+}
+
+func TestTopicCloseHookGoroutines(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("news")
+	_, s := connectTestSocket(t, server)
+
+	// Warm up the goroutines started once per socket and topic.
+	topic.Subscribe(s)
+	topic.Unsubscribe(s)
+	time.Sleep(50 * time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 100; i++ {
+		topic.Subscribe(s)
+		topic.Subscribe(s)
+		topic.Unsubscribe(s)
+	}
+
+	waitFor(t, time.Second, func() bool {
+		return runtime.NumGoroutine() <= before+2
+	})
+}
+
+func TestTopicUnsubscribeOnClose(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("news")
+	_, s := connectTestSocket(t, server)
+
+	topic.Subscribe(s)
+	s.Close()
+
+	waitFor(t, time.Second, func() bool {
+		return len(topic.Subscribers()) == 0
+	})
+}
+
+func TestTopicOnActive(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("news")
+	_, s1 := connectTestSocket(t, server)
+	_, s2 := connectTestSocket(t, server)
+
+	var changes []bool
+	var mutex sync.Mutex
+	topic.OnActive(func(active bool) {
+		mutex.Lock()
+		changes = append(changes, active)
+		mutex.Unlock()
+	})
+
+	topic.Subscribe(s1)
+	topic.Subscribe(s2)
+	topic.Unsubscribe(s1)
+	s2.Close()
+
+	waitFor(t, time.Second, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(changes) == 2
+	})
+	if !changes[0] || changes[1] {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	// A function set later is activated right away.
+	topic.Subscribe(s1)
+	active := false
+	topic.OnActive(func(a bool) { active = a })
+	if !active {
+		t.Fatal("topic not active")
+	}
+}
+
+func TestTopicSlowSubscriber(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("news", TopicOptions{HistorySize: 5})
+
+	// The slow socket never reads, so its write buffers fill up.
+	_, slow := connectTestSocket(t, server)
+	topic.Subscribe(slow)
+
+	conn, s := connectTestSocket(t, server)
+	topic.Subscribe(s)
+
+	// The delivery never blocks on the slow subscriber.
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < 100; i++ {
+			topic.Publish(strconv.Itoa(i))
+		}
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a slow subscriber blocked the delivery")
+	}
+
+	// The other subscriber receives all messages.
+	for i := 0; i < 100; i++ {
+		if name, data := receiveChannelData(t, conn); name != "news" || data != strconv.Itoa(i) {
+			t.Fatalf("unexpected data: %s", data)
+		}
+	}
+
+	// Subscriptions aren't blocked either.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		conn, s := connectTestSocket(t, server)
+		topic.Subscribe(s)
+		topic.History()
+		topic.Subscribers()
+		topic.Unsubscribe(s)
+		conn.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a slow subscriber blocked the topic")
+	}
+
+	// The slow socket is closed as soon as its queue overflows.
+	for i := 0; i < topicQueueSize; i++ {
+		topic.Publish(strconv.Itoa(i))
+	}
+
+	select {
+	case <-slow.ClosedChan():
+	case <-time.After(2 * time.Second):
+		t.Fatal("the slow subscriber was not closed")
+	}
+
+	if s.IsClosed() {
+		t.Fatal("the reading subscriber was closed")
+	}
+}
+
+func TestTopicSubscribeSlowSocket(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("news", TopicOptions{HistorySize: 500})
+
+	for i := 0; i < 500; i++ {
+		topic.Publish(strconv.Itoa(i))
+	}
+
+	// The history replay exceeds the write buffer of the socket
+	// never reading, but the subscription returns right away.
+	_, slow := connectTestSocket(t, server)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		topic.Subscribe(slow)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the history replay blocked the subscription")
+	}
+
+	// A reading socket receives the history in order,
+	// followed by the new messages.
+	conn, s := connectTestSocket(t, server)
+	topic.Subscribe(s)
+	topic.Publish("new")
+
+	for i := 0; i < 500; i++ {
+		if name, data := receiveChannelData(t, conn); name != "news" || data != strconv.Itoa(i) {
+			t.Fatalf("unexpected data: %s", data)
+		}
+	}
+	if name, data := receiveChannelData(t, conn); name != "news" || data != "new" {
+		t.Fatalf("unexpected data: %s", data)
+	}
+}
+
+func TestTopicMaxRate(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("ticker", TopicOptions{HistorySize: 100, MaxRate: 10})
+
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		topic.Publish(strconv.Itoa(i))
+		time.Sleep(500 * time.Microsecond)
+	}
+	elapsed := time.Since(start)
+
+	// Wait for the pending message.
+	time.Sleep(200 * time.Millisecond)
+
+	history := topic.History()
+	max := int(elapsed.Seconds()*10) + 2
+	if len(history) < 2 || len(history) > max {
+		t.Fatalf("expected at most %d deliveries, got %d", max, len(history))
+	}
+	if history[len(history)-1] != "999" {
+		t.Fatalf("expected the latest message to be delivered, got %s", history[len(history)-1])
+	}
+}
+
+func TestTopicMerge(t *testing.T) {
+	server := newTestServer(t)
+	topic := server.Topic("ticker", TopicOptions{
+		HistorySize: 10,
+		MaxRate:     5,
+		Merge: func(pending, data string) string {
+			return pending + data
+		},
+	})
+
+	topic.Publish("1")
+	topic.Publish("2")
+	topic.Publish("3")
+
+	waitFor(t, time.Second, func() bool {
+		return len(topic.History()) == 2
+	})
+
+	history := topic.History()
+	if history[0] != "1" || history[1] != "23" {
+		t.Fatalf("unexpected history: %v", history)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/log"
+	"github.com/desertbit/glue/utils"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+const (
+	defaultTracePayloadLimit = 256
+)
+
+// The directions of traced frames.
+const (
+	// TraceReceived marks frames received from the client.
+	TraceReceived TraceDirection = "received"
+
+	// TraceSent marks frames sent to the client.
+	TraceSent TraceDirection = "sent"
+)
+
+//#############//
+//### Types ###//
+//#############//
+
+// A TraceDirection defines if a traced frame was sent or received.
+type TraceDirection string
+
+// A Trace describes a single protocol frame of a traced socket.
+type Trace struct {
+	Time      time.Time
+	Socket    *Socket
+	Direction TraceDirection
+
+	// Command is the protocol command of the frame.
+	Command string
+
+	// Channel is the channel name of channel data frames.
+	Channel string
+
+	// Payload is the frame data without the command and channel name.
+	// It is truncated to the TracePayloadLimit option.
+	Payload   string
+	Truncated bool
+
+	// Binary is set for binary websocket frames.
+	Binary bool
+
+	// Size is the size of the complete frame in bytes.
+	Size int
+}
+
+// TraceFunc is called with each frame of traced sockets.
+type TraceFunc func(t Trace)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// SetTracing enables or disables the wire-level tracing of the socket.
+// Each sent and received frame is passed to the TraceFunc option or logged
+// with the protocol logger. The Trace option defines the default of new sockets.
+func (s *Socket) SetTracing(enabled bool) {
+	// Lock the mutex.
+	s.traceMutex.Lock()
+	defer s.traceMutex.Unlock()
+
+	s.tracing = enabled
+}
+
+// IsTracing returns a boolean indicating if the socket is traced.
+func (s *Socket) IsTracing() bool {
+	// Lock the mutex.
+	s.traceMutex.Lock()
+	defer s.traceMutex.Unlock()
+
+	return s.tracing
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// trace passes the raw frame to the trace function if the socket is traced
+// and to the recorder if the socket is recorded.
+func (s *Socket) trace(direction TraceDirection, rawData string) {
+	s.record(direction, rawData)
+
+	if !s.IsTracing() {
+		return
+	}
+
+	t := Trace{
+		Time:      time.Now(),
+		Socket:    s,
+		Direction: direction,
+		Size:      len(rawData),
+	}
+
+	// Remove the binary frame marker if present.
+	if strings.HasPrefix(rawData, global.BinaryFrameMarker) {
+		rawData = rawData[len(global.BinaryFrameMarker):]
+		t.Binary = true
+		t.Size = len(rawData)
+	}
+
+	// Split the command and the channel name from the payload.
+	if len(rawData) >= cmdLen {
+		t.Command = rawData[:cmdLen]
+		t.Payload = rawData[cmdLen:]
+	} else {
+		t.Payload = rawData
+	}
+
+	if isChannelData(rawData) {
+		if name, payload, err := utils.UnmarshalValues(t.Payload); err == nil {
+			t.Channel = name
+			t.Payload = payload
+		}
+	}
+
+	// Truncate the payload without splitting multi-byte characters.
+	if limit := s.server.options.TracePayloadLimit; len(t.Payload) > limit {
+		t.Payload = t.Payload[:limit]
+		for len(t.Payload) > 0 && !t.Binary && !utf8.ValidString(t.Payload) {
+			t.Payload = t.Payload[:len(t.Payload)-1]
+		}
+		t.Truncated = true
+	}
+
+	if f := s.server.options.TraceFunc; f != nil {
+		f(t)
+		return
+	}
+
+	log.Protocol.WithFields(logrus.Fields{
+		"remoteAddress": s.RemoteAddr(),
+		"socketID":      s.ID(),
+		"direction":     t.Direction,
+		"command":       t.Command,
+		"channel":       t.Channel,
+		"size":          t.Size,
+		"binary":        t.Binary,
+		"truncated":     t.Truncated,
+	}).Infof("glue: trace: %q", t.Payload)
+}
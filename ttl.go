@@ -0,0 +1,220 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"runtime/debug"
+	"time"
+
+	"github.com/desertbit/glue/backend/global"
+	"github.com/desertbit/glue/log"
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// WriteExpiredFunc is called with the data of a write which was
+// dropped, because it could not be sent within its TTL.
+type WriteExpiredFunc func(data string)
+
+//###############################//
+//### Public Channel methods ###//
+//###############################//
+
+// SetWriteTTL sets the default time to live for all writes to the channel.
+// Data still sitting in the write buffer after the TTL is dropped.
+// Pass zero to disable the TTL (default).
+func (c *Channel) SetWriteTTL(ttl time.Duration) {
+	// Lock the mutex.
+	c.ttlMutex.Lock()
+	defer c.ttlMutex.Unlock()
+
+	c.writeTTL = ttl
+}
+
+// WriteTTL writes data to the channel with the given time to live.
+// The data is dropped if it can't be sent within the TTL and the
+// OnWriteExpired function is called. A zero TTL never expires.
+// Use this for real-time data which is useless if delivered stale.
+func (c *Channel) WriteTTL(data string, ttl time.Duration) {
+	c.s.touch()
+	c.s.writeTTL(channelFrame(c.name, data), ttl)
+}
+
+// OnWriteExpired sets the function which is triggered if data written
+// to the channel is dropped due to an exceeded TTL.
+func (c *Channel) OnWriteExpired(f WriteExpiredFunc) {
+	// Lock the mutex.
+	c.ttlMutex.Lock()
+	defer c.ttlMutex.Unlock()
+
+	c.onWriteExpired = f
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// SetWriteTTL sets the default time to live for all writes to the main channel.
+// Pass zero to disable the TTL (default).
+func (s *Socket) SetWriteTTL(ttl time.Duration) {
+	s.mainChannel.SetWriteTTL(ttl)
+}
+
+// WriteTTL writes data to the main channel with the given time to live.
+// See the channel WriteTTL method for details.
+func (s *Socket) WriteTTL(data string, ttl time.Duration) {
+	s.mainChannel.WriteTTL(data, ttl)
+}
+
+// OnWriteExpired sets the function which is triggered if data written
+// to the main channel is dropped due to an exceeded TTL.
+func (s *Socket) OnWriteExpired(f WriteExpiredFunc) {
+	s.mainChannel.OnWriteExpired(f)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+func (c *Channel) getWriteTTL() time.Duration {
+	// Lock the mutex.
+	c.ttlMutex.Lock()
+	defer c.ttlMutex.Unlock()
+
+	return c.writeTTL
+}
+
+// writeTTL writes the raw data to the stream. The data is marked with
+// the expiry deadline and dropped by the backend socket if it is still
+// buffered after the deadline. A TTL of zero never expires.
+func (s *Socket) writeTTL(rawData string, ttl time.Duration) {
+	if ttl <= 0 {
+		s.write(rawData)
+		return
+	}
+
+	if s.scheduler != nil {
+		if s.writeFair([]string{rawData}, ttl) {
+			return
+		} else if s.IsClosed() {
+			s.dropped(rawData, DropReasonSocketClosed)
+		} else {
+			s.onWriteExpired(rawData)
+		}
+		return
+	}
+
+	frame := global.ExpiryFrame(time.Now().Add(ttl), rawData)
+
+	// Wait for the bandwidth limits before locking the mutex. The
+	// backend socket drops the frame if the TTL is exceeded in between.
+	if !s.throttle(rawData) {
+		s.dropped(rawData, DropReasonSocketClosed)
+		return
+	}
+
+	expired := func() bool {
+		// Lock the mutex to not interleave with batch writes.
+		s.writeMutex.Lock()
+		defer s.writeMutex.Unlock()
+
+		// Write to the stream and check if the buffer is full.
+		select {
+		case <-s.isClosedChan:
+			// Just return because the socket is closed.
+			s.dropped(rawData, DropReasonSocketClosed)
+			return false
+		case s.writeChan <- frame:
+			countWrite(rawData)
+			s.trace(TraceSent, rawData)
+			return false
+		default:
+		}
+
+		// The buffer if full. Send a ping. If no pong is received
+		// within the timeout, the socket is closed.
+		s.sendPing()
+
+		// Don't block longer than the TTL.
+		timeout := time.NewTimer(ttl)
+		defer timeout.Stop()
+
+		select {
+		case <-s.isClosedChan:
+			s.dropped(rawData, DropReasonSocketClosed)
+		case s.writeChan <- frame:
+			countWrite(rawData)
+			s.trace(TraceSent, rawData)
+		case <-timeout.C:
+			return true
+		}
+
+		return false
+	}()
+
+	// Call the callbacks after the mutex is unlocked.
+	if expired {
+		s.onWriteExpired(rawData)
+	}
+}
+
+// onWriteExpired is called with the raw data of dropped writes
+// and triggers the OnWriteExpired function of the channel.
+func (s *Socket) onWriteExpired(rawData string) {
+	// Update the metrics and emit the dropped event.
+	metricDroppedWrites.Add(1)
+	s.server.emitEvent(Event{Type: EventMessageDropped, Socket: s, Data: rawData})
+
+	// Only channel data is written with a TTL.
+	name, data, ok := parseChannelFrame(rawData)
+	if !ok {
+		return
+	}
+
+	// Pass the data to the dropped message function.
+	s.droppedData(name, data, DropReasonExpired)
+
+	// Get the channel and the callback.
+	c := s.channels.get(name)
+	if c == nil {
+		return
+	}
+
+	c.ttlMutex.Lock()
+	f := c.onWriteExpired
+	c.ttlMutex.Unlock()
+
+	if f == nil {
+		return
+	}
+
+	// Call the callback in a new goroutine.
+	go func() {
+		// Recover panics and log the error.
+		defer func() {
+			if e := recover(); e != nil {
+				log.L.Errorf("glue: panic while calling onWriteExpired function: %v\n%s", e, debug.Stack())
+			}
+		}()
+
+		f(data)
+	}()
+}
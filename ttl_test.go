@@ -0,0 +1,132 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// staleData waits about 100 milliseconds for the bandwidth of a drained socket.
+var staleData = strings.Repeat("s", 100)
+
+// newTTLTestSocket connects a socket with a bandwidth limit of 1000 bytes per
+// second and returns the channel of the expired data of the main channel.
+// The bandwidth is drained, so the following writes wait for their size.
+func newTTLTestSocket(t *testing.T) (*MemoryConn, *Socket, chan string) {
+	server := newTestServer(t, Options{SocketBandwidthLimit: 1000})
+	conn, s := connectTestSocket(t, server)
+
+	expired := make(chan string, 10)
+	s.OnWriteExpired(func(data string) {
+		expired <- data
+	})
+
+	s.Write(strings.Repeat("x", 1000))
+	if _, data := receiveChannelData(t, conn); len(data) != 1000 {
+		t.Fatalf("unexpected data length: %d", len(data))
+	}
+
+	return conn, s, expired
+}
+
+func TestWriteTTLExpired(t *testing.T) {
+	conn, s, expired := newTTLTestSocket(t)
+
+	// The data waits longer for the bandwidth than its TTL.
+	s.WriteTTL(staleData, 20*time.Millisecond)
+	s.Write("fresh")
+
+	if _, data := receiveChannelData(t, conn); data != "fresh" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+
+	select {
+	case data := <-expired:
+		if data != staleData {
+			t.Fatalf("unexpected expired data: %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expired function not called")
+	}
+}
+
+func TestWriteTTLDelivered(t *testing.T) {
+	conn, s, expired := newTTLTestSocket(t)
+
+	// A zero TTL never expires and a longer TTL covers the delay.
+	s.WriteTTL(staleData, 0)
+	s.WriteTTL(staleData, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if _, data := receiveChannelData(t, conn); data != staleData {
+			t.Fatalf("unexpected data: %q", data)
+		}
+	}
+
+	select {
+	case data := <-expired:
+		t.Fatalf("unexpected expired data: %q", data)
+	default:
+	}
+}
+
+func TestSetWriteTTL(t *testing.T) {
+	conn, s, expired := newTTLTestSocket(t)
+
+	// The default TTL applies to the channel writes.
+	s.SetWriteTTL(20 * time.Millisecond)
+	s.Write(staleData)
+	s.SetWriteTTL(0)
+	s.Write("fresh")
+
+	if _, data := receiveChannelData(t, conn); data != "fresh" {
+		t.Fatalf("unexpected data: %q", data)
+	}
+	if data := <-expired; data != staleData {
+		t.Fatalf("unexpected expired data: %q", data)
+	}
+}
+
+func TestWriteTTLDroppedEvent(t *testing.T) {
+	conn, s, _ := newTTLTestSocket(t)
+
+	dropped := make(chan Event, 10)
+	s.server.OnEvent(func(e Event) {
+		if e.Type == EventMessageDropped {
+			dropped <- e
+		}
+	})
+
+	// Other channels are expired as well.
+	c := s.Channel("prices")
+	c.WriteTTL(staleData, 20*time.Millisecond)
+	s.Write("fresh")
+	receiveChannelData(t, conn)
+
+	select {
+	case e := <-dropped:
+		if e.Socket != s || e.Data != channelFrame("prices", staleData) {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no dropped event")
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"errors"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+// A DuplicateUserPolicy defines how a new socket of an already connected user is handled.
+type DuplicateUserPolicy int
+
+const (
+	// DuplicateUserAllow allows multiple sockets per user.
+	DuplicateUserAllow DuplicateUserPolicy = iota
+
+	// DuplicateUserCloseOldest closes the existing sockets of the user.
+	// The clients are rejected with the logged_in_elsewhere code.
+	DuplicateUserCloseOldest
+
+	// DuplicateUserRejectNew rejects the new socket with the duplicate_user code.
+	DuplicateUserRejectNew
+)
+
+//#################//
+//### Variables ###//
+//#################//
+
+// ErrDuplicateUser is returned by SetUserID if the user is already
+// connected and the DuplicateUserRejectNew policy is set.
+var ErrDuplicateUser = errors.New("the user is already connected")
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// PushFallbackFunc is called with the user ID and the message data
+// if a message is written to a user without any connected sockets.
+type PushFallbackFunc func(userID, data string)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// SetUserID associates the socket with an application user.
+// Multiple sockets can share the same user ID, unless restricted
+// by the DuplicateUserPolicy option. Pass an empty string to remove
+// the association. The identify webhook is posted if a new user ID is set.
+// ErrDuplicateUser is returned and the socket is rejected and closed
+// if the user is already connected and the DuplicateUserRejectNew policy is set.
+func (s *Socket) SetUserID(id string) error {
+	var presence []*ClusterMessage
+
+	changed, duplicate, others := func() (bool, bool, []*Socket) {
+		// Lock the server users mutex first to update the index.
+		s.server.usersMutex.Lock()
+		defer s.server.usersMutex.Unlock()
+
+		// Lock the mutex.
+		s.userMutex.Lock()
+		defer s.userMutex.Unlock()
+
+		if s.userID == id {
+			return false, false, nil
+		}
+
+		// Obtain the other connected sockets of the user.
+		var others []*Socket
+		policy := s.server.options.DuplicateUserPolicy
+		if len(id) > 0 && policy != DuplicateUserAllow {
+			for socket := range s.server.users[id] {
+				if socket != s && !socket.IsClosed() {
+					others = append(others, socket)
+				}
+			}
+
+			if len(others) > 0 && policy == DuplicateUserRejectNew {
+				return false, true, nil
+			}
+
+			// Remove the sockets, which are closed below, from the index.
+			for _, socket := range others {
+				s.server.removeUserSocket(id, socket)
+			}
+		}
+
+		// Update the server users index.
+		// Closed sockets are not added again.
+		s.server.removeUserSocket(s.userID, s)
+		if len(id) > 0 && !s.IsClosed() {
+			sockets, ok := s.server.users[id]
+			if !ok {
+				sockets = make(map[*Socket]struct{})
+				s.server.users[id] = sockets
+			}
+			sockets[s] = struct{}{}
+		}
+
+		// Update the presence of both users.
+		for _, userID := range []string{s.userID, id} {
+			if len(userID) > 0 {
+				presence = append(presence, s.server.setPresence(presenceUserKey(userID), len(s.server.users[userID])))
+			}
+		}
+
+		s.userID = id
+		return true, false, others
+	}()
+
+	s.server.broadcastPresence(presence...)
+
+	// Reject the new socket.
+	if duplicate {
+		go s.rejectAndClose(newRejectError(RejectCodeDuplicateUser, ErrDuplicateUser), CloseReasonDuplicateUser)
+
+		return ErrDuplicateUser
+	}
+
+	// Close the previous sockets of the user.
+	for _, socket := range others {
+		go socket.rejectAndClose(&RejectError{
+			Code:    RejectCodeLoggedInElsewhere,
+			Message: "the user logged in elsewhere",
+		}, CloseReasonLoggedInElsewhere)
+	}
+
+	// Post the identify webhook.
+	if changed && len(id) > 0 {
+		s.triggerWebhook(WebhookEventIdentify, nil)
+	}
+
+	return nil
+}
+
+// UserID returns the user ID associated with the socket.
+// An empty string is returned if not set.
+func (s *Socket) UserID() string {
+	// Lock the mutex.
+	s.userMutex.Lock()
+	defer s.userMutex.Unlock()
+
+	return s.userID
+}
+
+//##############################//
+//### Public Server methods ###//
+//##############################//
+
+// SocketsByUserID returns all current connected sockets of the user.
+// Sockets are removed automatically as soon as they are closed.
+func (s *Server) SocketsByUserID(id string) []*Socket {
+	// Lock the mutex.
+	s.usersMutex.Lock()
+	defer s.usersMutex.Unlock()
+
+	sockets := s.users[id]
+
+	// Create the slice.
+	list := make([]*Socket, 0, len(sockets))
+	for socket := range sockets {
+		list = append(list, socket)
+	}
+
+	return list
+}
+
+// WriteToUser writes the data to the main channel of all connected sockets
+// of the user. If no socket of the user is connected, the data is passed
+// to the PushFallback function of the server options if set.
+// This allows to deliver messages live if connected and to notify the
+// user otherwise, for example with a Web Push (VAPID) sender.
+// Returns true if the data was written to at least one socket.
+func (s *Server) WriteToUser(userID, data string) bool {
+	written := false
+
+	// Build the frame once for all sockets of the user.
+	rawData := channelFrame(mainChannelName, data)
+
+	for _, socket := range s.SocketsByUserID(userID) {
+		if socket.IsClosed() {
+			continue
+		}
+
+		socket.mainChannel.writeFrame(data, rawData)
+		written = true
+	}
+
+	// Hand the data to the push fallback or the dead letter queue.
+	if !written {
+		if s.options.PushFallback != nil {
+			s.options.PushFallback(userID, data)
+		} else {
+			s.pushDeadLetter(DeadLetter{
+				Reason:  DropReasonUserOffline,
+				UserID:  userID,
+				Channel: mainChannelName,
+				Data:    data,
+			})
+		}
+	}
+
+	return written
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// removeUserSocket removes the socket from the users index.
+// Hint: the users mutex has to be locked.
+func (s *Server) removeUserSocket(id string, socket *Socket) {
+	sockets, ok := s.users[id]
+	if !ok {
+		return
+	}
+
+	delete(sockets, socket)
+	if len(sockets) == 0 {
+		delete(s.users, id)
+	}
+}
+
+// removeClosedUserSocket removes the closed socket from the users index.
+func (s *Server) removeClosedUserSocket(socket *Socket) {
+	s.broadcastPresence(func() *ClusterMessage {
+		// Lock the mutex.
+		s.usersMutex.Lock()
+		defer s.usersMutex.Unlock()
+
+		id := socket.UserID()
+		if len(id) == 0 {
+			return nil
+		}
+
+		s.removeUserSocket(id, socket)
+		return s.setPresence(presenceUserKey(id), len(s.users[id]))
+	}())
+}
@@ -0,0 +1,135 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDuplicateUserPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy DuplicateUserPolicy
+
+		err          error  // The error of the second SetUserID call.
+		closedFirst  bool   // The first socket is closed.
+		closedSecond bool   // The second socket is closed.
+		code         string // The rejection code of the closed socket.
+		reason       CloseReason
+	}{
+		{name: "allow", policy: DuplicateUserAllow},
+		{
+			name:        "close oldest",
+			policy:      DuplicateUserCloseOldest,
+			closedFirst: true,
+			code:        RejectCodeLoggedInElsewhere,
+			reason:      CloseReasonLoggedInElsewhere,
+		},
+		{
+			name:         "reject new",
+			policy:       DuplicateUserRejectNew,
+			err:          ErrDuplicateUser,
+			closedSecond: true,
+			code:         RejectCodeDuplicateUser,
+			reason:       CloseReasonDuplicateUser,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, Options{DuplicateUserPolicy: test.policy})
+			closeReason := recordCloseReasons(t, server)
+
+			conn1, s1 := connectTestSocketWith(t, server, clientInitData{Reject: true})
+			conn2, s2 := connectTestSocketWith(t, server, clientInitData{Reject: true})
+
+			if err := s1.SetUserID("user"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s2.SetUserID("user"); err != test.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Check the rejection of the closed socket.
+			conn, closed, open := conn1, s1, s2
+			if test.closedSecond {
+				conn, closed, open = conn2, s2, s1
+			}
+			if test.closedFirst || test.closedSecond {
+				if r := receiveReject(t, conn); r.Code != test.code || r.Retry {
+					t.Fatalf("unexpected rejection: %+v", r)
+				}
+				if reason := closeReason(closed); reason != test.reason {
+					t.Fatalf("unexpected close reason: %v", reason)
+				}
+
+				// Only the open socket is associated with the user.
+				sockets := server.SocketsByUserID("user")
+				if len(sockets) != 1 || sockets[0] != open || open.IsClosed() {
+					t.Fatalf("unexpected user sockets: %v", sockets)
+				}
+				return
+			}
+
+			if sockets := server.SocketsByUserID("user"); len(sockets) != 2 || s1.IsClosed() || s2.IsClosed() {
+				t.Fatalf("unexpected user sockets: %v", sockets)
+			}
+		})
+	}
+}
+
+func TestDuplicateUserPolicyClosedSocket(t *testing.T) {
+	server := newTestServer(t, Options{DuplicateUserPolicy: DuplicateUserRejectNew})
+
+	_, s1 := connectTestSocket(t, server)
+	_, s2 := connectTestSocket(t, server)
+
+	if err := s1.SetUserID("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Setting the same user ID again is no duplicate.
+	if err := s1.SetUserID("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Closed sockets don't count as connected.
+	s1.Close()
+	waitFor(t, time.Second, func() bool {
+		return len(server.SocketsByUserID("user")) == 0
+	})
+	if err := s2.SetUserID("user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the user ID allows the other sockets.
+	_, s3 := connectTestSocket(t, server)
+	if err := s3.SetUserID("user"); err != ErrDuplicateUser {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s2.SetUserID(""); err != nil {
+		t.Fatal(err)
+	}
+
+	_, s4 := connectTestSocket(t, server)
+	if err := s4.SetUserID("user"); err != nil {
+		t.Fatal(err)
+	}
+}
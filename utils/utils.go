@@ -20,6 +20,7 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/rand"
 	"fmt"
 	"net/http"
@@ -33,6 +34,10 @@ import (
 
 const (
 	delimiter = "&"
+
+	// The maximum number of digits of a value length.
+	// Longer lengths would overflow the integer.
+	maxLengthDigits = 18
 )
 
 //########################//
@@ -52,17 +57,18 @@ func RandomString(n int) string {
 
 // UnmarshalValues splits two values from a single string.
 // This function is chainable to extract multiple values.
+// The values are substrings of the data and no memory is allocated.
 func UnmarshalValues(data string) (first, second string, err error) {
 	// Find the delimiter.
-	pos := strings.Index(data, delimiter)
+	pos := strings.IndexByte(data, delimiter[0])
 	if pos < 0 {
 		err = fmt.Errorf("unmarshal values: no delimiter found: '%s'", data)
 		return
 	}
 
 	// Extract the value length integer of the first value.
-	l, err := strconv.Atoi(data[:pos])
-	if err != nil {
+	l, ok := parseLength(data[:pos])
+	if !ok {
 		err = fmt.Errorf("invalid value length: '%s'", data[:pos])
 		return
 	}
@@ -71,7 +77,7 @@ func UnmarshalValues(data string) (first, second string, err error) {
 	data = data[pos+1:]
 
 	// Validate the value length.
-	if l < 0 || l > len(data) {
+	if l > len(data) {
 		err = fmt.Errorf("invalid value length: out of bounds: '%v'", l)
 		return
 	}
@@ -83,10 +89,64 @@ func UnmarshalValues(data string) (first, second string, err error) {
 	return
 }
 
+// UnmarshalValuesBytes splits two values from a single byte slice like
+// UnmarshalValues. The values share the memory of the data slice.
+func UnmarshalValuesBytes(data []byte) (first, second []byte, err error) {
+	// Find the delimiter.
+	pos := bytes.IndexByte(data, delimiter[0])
+	if pos < 0 {
+		err = fmt.Errorf("unmarshal values: no delimiter found: '%s'", data)
+		return
+	}
+
+	// Extract the value length integer of the first value.
+	l, ok := parseLengthBytes(data[:pos])
+	if !ok {
+		err = fmt.Errorf("invalid value length: '%s'", data[:pos])
+		return
+	}
+
+	// Remove the value length from the data slice.
+	data = data[pos+1:]
+
+	// Validate the value length.
+	if l > len(data) {
+		err = fmt.Errorf("invalid value length: out of bounds: '%v'", l)
+		return
+	}
+
+	// Split the first value from the second.
+	first = data[:l:l]
+	second = data[l:]
+
+	return
+}
+
 // MarshalValues joins two values into a single string.
 // They can be decoded by the UnmarshalValues function.
+// Only the returned string is allocated.
 func MarshalValues(first, second string) string {
-	return strconv.Itoa(len(first)) + delimiter + first + second
+	var buf [20]byte
+	length := strconv.AppendInt(buf[:0], int64(len(first)), 10)
+
+	var b strings.Builder
+	b.Grow(len(length) + len(delimiter) + len(first) + len(second))
+	b.Write(length)
+	b.WriteString(delimiter)
+	b.WriteString(first)
+	b.WriteString(second)
+
+	return b.String()
+}
+
+// AppendValues appends the joined values to the byte slice
+// and returns the extended slice. It equals MarshalValues, but
+// reuses the capacity of the slice.
+func AppendValues(dst []byte, first, second string) []byte {
+	dst = strconv.AppendInt(dst, int64(len(first)), 10)
+	dst = append(dst, delimiter...)
+	dst = append(dst, first...)
+	return append(dst, second...)
 }
 
 // RemoteAddress returns the IP address of the request.
@@ -130,3 +190,43 @@ func RemovePortFromRemoteAddr(remoteAddr string) string {
 
 	return remoteAddr[:pos]
 }
+
+//###############//
+//### Private ###//
+//###############//
+
+// parseLength parses the decimal value length without allocations.
+// Signs and other non-digit characters are invalid.
+func parseLength(s string) (int, bool) {
+	if len(s) == 0 || len(s) > maxLengthDigits {
+		return 0, false
+	}
+
+	n := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	return n, true
+}
+
+// parseLengthBytes is the byte slice variant of parseLength.
+func parseLengthBytes(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > maxLengthDigits {
+		return 0, false
+	}
+
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	return n, true
+}
@@ -49,3 +49,43 @@ func TestUnmarshalValues(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestUnmarshalValuesBytes(t *testing.T) {
+	first, second, err := UnmarshalValuesBytes(AppendValues(nil, "1s"+delimiter+"jsd", "efsf2"))
+	if err != nil {
+		t.Error(err.Error())
+	} else if string(first) != "1s"+delimiter+"jsd" || string(second) != "efsf2" {
+		t.Fail()
+	}
+
+	for _, data := range []string{"", "12" + delimiter + "firstsecond", "-1" + delimiter + "a", "+1" + delimiter + "a", "1a" + delimiter + "a"} {
+		if _, _, err = UnmarshalValuesBytes([]byte(data)); err == nil {
+			t.Errorf("invalid data accepted: '%s'", data)
+		}
+		if _, _, err = UnmarshalValues(data); err == nil {
+			t.Errorf("invalid data accepted: '%s'", data)
+		}
+	}
+}
+
+func TestAppendValues(t *testing.T) {
+	b := AppendValues([]byte("cmd"), "first", "second")
+	if string(b) != "cmd"+MarshalValues("first", "second") {
+		t.Fail()
+	}
+}
+
+func TestValuesAllocs(t *testing.T) {
+	data := MarshalValues("channel", "data")
+	buf := make([]byte, 0, 64)
+
+	if n := testing.AllocsPerRun(100, func() { UnmarshalValues(data) }); n != 0 {
+		t.Errorf("UnmarshalValues allocates: %v", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { AppendValues(buf[:0], "channel", "data") }); n != 0 {
+		t.Errorf("AppendValues allocates: %v", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { MarshalValues("channel", "data") }); n != 1 {
+		t.Errorf("MarshalValues allocates: %v", n)
+	}
+}
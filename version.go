@@ -0,0 +1,75 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"github.com/blang/semver"
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// ProtocolVersion returns the negotiated socket protocol version,
+// which is the lower version of the client and server protocol versions.
+// The version is set during the socket initialization.
+func (s *Socket) ProtocolVersion() string {
+	// Lock the mutex.
+	s.initMutex.Lock()
+	defer s.initMutex.Unlock()
+
+	if s.clientVersion.LT(serverVersion) {
+		return s.clientVersion.String()
+	}
+	return serverVersion.String()
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+// parseVersionRange parses the client version range option.
+// An invalid range is logged and the default range is used.
+func parseVersionRange(o *Options) semver.Range {
+	if len(o.ClientVersionRange) == 0 {
+		return nil
+	}
+
+	r, err := semver.ParseRange(o.ClientVersionRange)
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"range": o.ClientVersionRange,
+		}).Errorf("glue: invalid ClientVersionRange option: %v", err)
+		return nil
+	}
+
+	return r
+}
+
+// isVersionSupported returns true if the client protocol version is supported.
+// By default clients with the same major and a lower or equal version are accepted.
+func (s *Server) isVersionSupported(v semver.Version) bool {
+	if s.versionRange != nil {
+		return s.versionRange(v)
+	}
+
+	return v.Major == serverVersion.Major && v.LTE(serverVersion)
+}
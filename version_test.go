@@ -0,0 +1,121 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// initVersion initializes a socket with the client protocol version and
+// returns the socket and the rejection code. The code is empty if accepted.
+func initVersion(t *testing.T, server *Server, version string) (*Socket, string) {
+	t.Helper()
+
+	conn := server.ConnectMemory("127.0.0.1", "test")
+	t.Cleanup(func() { conn.Close() })
+
+	if err := conn.Send(cmdInit + `{"version":"` + version + `","reject":true}`); err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		frame := receiveFrame(t, conn, "")
+		if strings.HasPrefix(frame, cmdInit) {
+			return conn.socket, ""
+		} else if strings.HasPrefix(frame, cmdReject) {
+			var r RejectError
+			if err := json.Unmarshal([]byte(frame[len(cmdReject):]), &r); err != nil {
+				t.Fatal(err)
+			}
+			return conn.socket, r.Code
+		}
+	}
+}
+
+func TestClientVersionRange(t *testing.T) {
+	tests := []struct {
+		versionRange string
+		version      string
+		accepted     bool
+	}{
+		// The default range accepts the same major and older versions.
+		{"", Version, true},
+		{"", "2.0.0-rc.1", true},
+		{"", "2.0.1", false},
+		{"", "1.9.9", false},
+		{"", "3.0.0", false},
+
+		// The boundaries of a custom range.
+		{">=1.8.0 <2.1.0", "1.7.9", false},
+		{">=1.8.0 <2.1.0", "1.8.0", true},
+		{">=1.8.0 <2.1.0", "2.0.9", true},
+		{">=1.8.0 <2.1.0", "2.1.0", false},
+		{">1.8.0 <=2.1.0", "1.8.0", false},
+		{">1.8.0 <=2.1.0", "2.1.0", true},
+		{">=1.0.0 <2.0.0 || >=3.0.0", "2.0.0", false},
+		{">=1.0.0 <2.0.0 || >=3.0.0", "3.1.0", true},
+
+		// An invalid range is ignored.
+		{"two", Version, true},
+		{"two", "1.9.9", false},
+	}
+
+	// NewServer doesn't validate the options.
+	servers := make(map[string]*Server)
+	for _, test := range tests {
+		server, ok := servers[test.versionRange]
+		if !ok {
+			server = NewServer(Options{HTTPSocketType: HTTPSocketTypeNone, ClientVersionRange: test.versionRange})
+			defer server.Release()
+			servers[test.versionRange] = server
+		}
+
+		_, code := initVersion(t, server, test.version)
+		if test.accepted && len(code) > 0 {
+			t.Errorf("%q %s: rejected with %s", test.versionRange, test.version, code)
+		} else if !test.accepted && code != RejectCodeVersion {
+			t.Errorf("%q %s: unexpected rejection: %q", test.versionRange, test.version, code)
+		}
+	}
+}
+
+func TestProtocolVersion(t *testing.T) {
+	server := newTestServer(t, Options{ClientVersionRange: ">=1.8.0"})
+
+	// The lower version of the client and the server is negotiated.
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"1.9.0", "1.9.0"},
+		{Version, Version},
+		{"2.5.0", Version},
+	}
+
+	for _, test := range tests {
+		s, code := initVersion(t, server, test.version)
+		if len(code) > 0 {
+			t.Fatalf("%s: rejected with %s", test.version, code)
+		} else if v := s.ProtocolVersion(); v != test.want {
+			t.Errorf("%s: unexpected protocol version: %s", test.version, v)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/desertbit/glue/log"
+	"github.com/sirupsen/logrus"
+)
+
+//#################//
+//### Constants ###//
+//#################//
+
+// Webhook lifecycle events.
+const (
+	WebhookEventConnect    = "connect"
+	WebhookEventIdentify   = "identify"
+	WebhookEventDisconnect = "disconnect"
+)
+
+const (
+	// WebhookSignatureHeader is the HTTP header holding the hex encoded
+	// HMAC-SHA256 signature of the timestamp and the webhook request body
+	// joined by a dot: "<timestamp>.<body>".
+	WebhookSignatureHeader = "X-Glue-Signature"
+
+	// WebhookTimestampHeader is the HTTP header holding the Unix time in
+	// seconds of the webhook request. Reject old timestamps to prevent
+	// replayed requests.
+	WebhookTimestampHeader = "X-Glue-Timestamp"
+
+	// The timeout of a single webhook request.
+	webhookTimeout = 10 * time.Second
+
+	// The delay before the first retry. It is doubled for each retry.
+	webhookRetryDelay = time.Second
+
+	defaultWebhookWorkers   = 4
+	defaultWebhookQueueSize = 1024
+)
+
+//####################//
+//### Public Types ###//
+//####################//
+
+// WebhookPayload is the JSON body posted to the webhook URL.
+type WebhookPayload struct {
+	Event      string      `json:"event"`
+	Time       time.Time   `json:"time"`
+	SocketID   string      `json:"socketID"`
+	UserID     string      `json:"userID,omitempty"`
+	RemoteAddr string      `json:"remoteAddr"`
+	UserAgent  string      `json:"userAgent"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+//##############################//
+//### Public Socket methods ###//
+//##############################//
+
+// TriggerWebhook posts a custom event with the optional JSON
+// encodable data to the webhook URL of the server options.
+// This is a no-op if no webhook URL is set.
+func (s *Socket) TriggerWebhook(event string, data interface{}) {
+	s.triggerWebhook(event, data)
+}
+
+//###############//
+//### Private ###//
+//###############//
+
+type webhookJob struct {
+	event    string
+	socketID string
+	body     []byte
+}
+
+// startWebhooks starts the webhook workers if a webhook URL is set.
+// Each worker has its own bounded queue.
+func (s *Server) startWebhooks() {
+	o := s.options
+
+	// Skip if webhooks are disabled.
+	if len(o.WebhookURL) == 0 {
+		return
+	}
+
+	s.webhooksStop = make(chan struct{})
+	s.webhooks = make([]chan webhookJob, o.WebhookWorkers)
+	for i := range s.webhooks {
+		s.webhooks[i] = make(chan webhookJob, o.WebhookQueueSize)
+		s.webhooksWG.Add(1)
+		go s.webhookLoop(s.webhooks[i])
+	}
+}
+
+// stopWebhooks closes the queues and waits until the workers delivered
+// the queued webhooks. Failed deliveries are not retried anymore.
+func (s *Server) stopWebhooks() {
+	func() {
+		// Lock the mutex.
+		s.webhooksMutex.Lock()
+		defer s.webhooksMutex.Unlock()
+
+		if s.webhooksClosed || len(s.webhooks) == 0 {
+			return
+		}
+		s.webhooksClosed = true
+
+		close(s.webhooksStop)
+		for _, jobs := range s.webhooks {
+			close(jobs)
+		}
+	}()
+
+	s.webhooksWG.Wait()
+}
+
+// webhookLoop delivers the queued webhooks one at a time
+// until the queue is closed.
+func (s *Server) webhookLoop(jobs chan webhookJob) {
+	defer s.webhooksWG.Done()
+
+	for j := range jobs {
+		deliverWebhook(s.options, j.event, j.body, s.webhooksStop)
+	}
+}
+
+// pushWebhook queues the webhook. All webhooks of a socket are queued to
+// the same worker, so they are delivered in order. The webhook is dropped
+// and logged if the queue is full. This never blocks. Webhooks are
+// dropped silently after the server was released.
+func (s *Server) pushWebhook(j webhookJob) {
+	h := fnv.New32a()
+	h.Write([]byte(j.socketID))
+	jobs := s.webhooks[h.Sum32()%uint32(len(s.webhooks))]
+
+	// Lock the mutex to not send on a closed queue.
+	s.webhooksMutex.RLock()
+	defer s.webhooksMutex.RUnlock()
+
+	if s.webhooksClosed {
+		return
+	}
+
+	select {
+	case jobs <- j:
+	default:
+		log.L.WithFields(logrus.Fields{
+			"event":    j.event,
+			"socketID": j.socketID,
+		}).Warningf("glue: webhook queue is full: webhook lost")
+	}
+}
+
+func (s *Socket) triggerWebhook(event string, data interface{}) {
+	// Skip if webhooks are disabled.
+	if len(s.server.webhooks) == 0 {
+		return
+	}
+
+	payload := WebhookPayload{
+		Event:      event,
+		Time:       time.Now(),
+		SocketID:   s.ID(),
+		UserID:     s.UserID(),
+		RemoteAddr: s.RemoteAddr(),
+		UserAgent:  s.UserAgent(),
+		Data:       data,
+	}
+
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		log.L.WithFields(logrus.Fields{
+			"event":    event,
+			"socketID": payload.SocketID,
+		}).Warningf("glue: webhook: json marshal payload: %v", err)
+		return
+	}
+
+	// Queue the webhook to not block the socket.
+	s.server.pushWebhook(webhookJob{
+		event:    event,
+		socketID: payload.SocketID,
+		body:     body,
+	})
+}
+
+// deliverWebhook posts the body to the webhook URL and retries
+// failed deliveries with an exponential backoff until stop is closed.
+func deliverWebhook(o *Options, event string, body []byte, stop <-chan struct{}) {
+	var err error
+	delay := webhookRetryDelay
+
+	retries := o.WebhookRetries
+	if retries < 0 {
+		retries = 0
+	}
+
+	for i := 0; i <= retries; i++ {
+		if i > 0 {
+			// Don't retry after the server was released.
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				log.L.WithFields(logrus.Fields{
+					"event": event,
+					"url":   o.WebhookURL,
+				}).Warningf("glue: webhook delivery failed: server released: %v", err)
+				return
+			}
+			delay *= 2
+		}
+
+		if err = postWebhook(o, body); err == nil {
+			return
+		}
+	}
+
+	log.L.WithFields(logrus.Fields{
+		"event": event,
+		"url":   o.WebhookURL,
+	}).Warningf("glue: webhook delivery failed: %v", err)
+}
+
+// signWebhook returns the hex encoded HMAC-SHA256 signature
+// of the timestamp and the body joined by a dot.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(o *Options, body []byte) error {
+	req, err := http.NewRequest("POST", o.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Set the timestamp of this attempt, so receivers can reject replays.
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+
+	// Sign the timestamp and the body if a secret is set.
+	if len(o.WebhookSecret) > 0 {
+		req.Header.Set(WebhookSignatureHeader, signWebhook(o.WebhookSecret, timestamp, body))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,208 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the webhooks posted to the test server.
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+	block  chan struct{}
+
+	events []string
+	mutex  sync.Mutex
+}
+
+func newWebhookReceiver(t *testing.T, secret string) (*webhookReceiver, string) {
+	r := &webhookReceiver{t: t, secret: secret}
+
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	return r, ts.URL
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+		return
+	}
+
+	timestamp := req.Header.Get(WebhookTimestampHeader)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sec, 0)) > time.Minute {
+		r.t.Errorf("invalid webhook timestamp: %q", timestamp)
+	}
+	if len(r.secret) > 0 {
+		if sig := req.Header.Get(WebhookSignatureHeader); sig != signWebhook(r.secret, timestamp, body) {
+			r.t.Errorf("invalid webhook signature: %q", sig)
+		}
+	}
+
+	var p WebhookPayload
+	if err = json.Unmarshal(body, &p); err != nil {
+		r.t.Error(err)
+		return
+	}
+
+	// Slow down the connect events to provoke reordering.
+	if p.Event == WebhookEventConnect {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if r.block != nil {
+		<-r.block
+	}
+
+	r.mutex.Lock()
+	r.events = append(r.events, p.Event)
+	r.mutex.Unlock()
+}
+
+func (r *webhookReceiver) received() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.events...)
+}
+
+func TestWebhook(t *testing.T) {
+	receiver, url := newWebhookReceiver(t, "secret")
+
+	server := newTestServer(t, Options{
+		WebhookURL:    url,
+		WebhookSecret: "secret",
+	})
+
+	conn, s := connectTestSocket(t, server)
+	s.TriggerWebhook("custom", nil)
+	conn.Close()
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(receiver.received()) == 3
+	})
+
+	// The webhooks of a socket are delivered in order.
+	events := receiver.received()
+	if events[0] != WebhookEventConnect || events[1] != "custom" || events[2] != WebhookEventDisconnect {
+		t.Fatalf("unexpected webhook order: %v", events)
+	}
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	receiver, url := newWebhookReceiver(t, "")
+	receiver.block = make(chan struct{})
+
+	server := newTestServer(t, Options{
+		WebhookURL:       url,
+		WebhookRetries:   -1,
+		WebhookWorkers:   1,
+		WebhookQueueSize: 1,
+	})
+
+	// The connect webhook blocks the worker and one further webhook is
+	// queued. The others are dropped.
+	_, s := connectTestSocket(t, server)
+	time.Sleep(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		s.TriggerWebhook("custom", nil)
+	}
+	close(receiver.block)
+
+	waitFor(t, 5*time.Second, func() bool {
+		return len(receiver.received()) == 2
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	if events := receiver.received(); len(events) != 2 {
+		t.Fatalf("unexpected webhooks: %v", events)
+	}
+}
+
+func TestWebhookRelease(t *testing.T) {
+	receiver, url := newWebhookReceiver(t, "")
+
+	server := NewServer(Options{
+		WebhookURL: url,
+	})
+
+	_, s := connectTestSocket(t, server)
+	s.TriggerWebhook("custom", nil)
+
+	// Release delivers the queued webhooks including the disconnect webhooks.
+	server.Release()
+
+	events := receiver.received()
+	if len(events) != 3 || events[0] != WebhookEventConnect || events[1] != "custom" || events[2] != WebhookEventDisconnect {
+		t.Fatalf("unexpected webhooks: %v", events)
+	}
+
+	// Webhooks are dropped after the release.
+	s.TriggerWebhook("custom", nil)
+	server.Release()
+
+	if events := receiver.received(); len(events) != 3 {
+		t.Fatalf("unexpected webhooks: %v", events)
+	}
+}
+
+func TestWebhookReleaseRetries(t *testing.T) {
+	var (
+		attempts int
+		mutex    sync.Mutex
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		attempts++
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(ts.Close)
+
+	server := NewServer(Options{
+		WebhookURL:     ts.URL,
+		WebhookRetries: 5,
+	})
+	connectTestSocket(t, server)
+
+	// The failed deliveries are not retried after the release.
+	start := time.Now()
+	server.Release()
+	if d := time.Since(start); d >= webhookRetryDelay {
+		t.Fatalf("release blocked by the retries: %v", d)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if attempts != 2 {
+		t.Fatalf("unexpected number of attempts: %d", attempts)
+	}
+}
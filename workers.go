@@ -0,0 +1,105 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+//########################//
+//### Worker Pool Type ###//
+//########################//
+
+// A workerPool runs tasks with a fixed number of goroutines. Each worker
+// has its own bounded queue. The tasks of one key are always passed to
+// the same worker, so they run in order.
+type workerPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+
+	closed bool
+	mutex  sync.RWMutex
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	p := &workerPool{
+		queues: make([]chan func(), workers),
+	}
+
+	p.wg.Add(workers)
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), queueSize)
+		go p.run(p.queues[i])
+	}
+
+	return p
+}
+
+// push queues the task for the worker of the key. This never blocks.
+// Returns false if the queue of the worker is full. Tasks pushed
+// after the pool is closed are discarded.
+func (p *workerPool) push(key string, f func()) bool {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	// Lock the mutex. The queues are not closed in between.
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.closed {
+		return true
+	}
+
+	select {
+	case p.queues[h.Sum32()%uint32(len(p.queues))] <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops the workers as soon as the queued tasks are done
+// and waits for them.
+func (p *workerPool) close() {
+	func() {
+		// Lock the mutex.
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		if p.closed {
+			return
+		}
+		p.closed = true
+
+		for _, q := range p.queues {
+			close(q)
+		}
+	}()
+
+	p.wg.Wait()
+}
+
+func (p *workerPool) run(tasks chan func()) {
+	defer p.wg.Done()
+
+	for f := range tasks {
+		f()
+	}
+}
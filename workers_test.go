@@ -0,0 +1,89 @@
+/*
+ *  Glue - Robust Go and Javascript Socket Library
+ *  Copyright (C) 2015  Roland Singer <roland.singer[at]desertbit.com>
+ *
+ *  This program is free software: you can redistribute it and/or modify
+ *  it under the terms of the GNU General Public License as published by
+ *  the Free Software Foundation, either version 3 of the License, or
+ *  (at your option) any later version.
+ *
+ *  This program is distributed in the hope that it will be useful,
+ *  but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *  GNU General Public License for more details.
+ *
+ *  You should have received a copy of the GNU General Public License
+ *  along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package glue
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPool(t *testing.T) {
+	p := newWorkerPool(4, 100)
+
+	// The tasks of a key run in order.
+	var (
+		results = make(map[string][]int)
+		mutex   sync.Mutex
+	)
+
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i % 10)
+		i := i
+		if !p.push(key, func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			results[key] = append(results[key], i)
+		}) {
+			t.Fatal("task dropped")
+		}
+	}
+
+	// The queued tasks are done before close returns.
+	p.close()
+
+	for key, list := range results {
+		if len(list) != 10 {
+			t.Fatalf("key %s: unexpected tasks: %v", key, list)
+		}
+		for i := 1; i < len(list); i++ {
+			if list[i] < list[i-1] {
+				t.Fatalf("key %s: tasks out of order: %v", key, list)
+			}
+		}
+	}
+
+	// Tasks are discarded after the close.
+	if !p.push("key", func() { t.Error("task run after close") }) {
+		t.Fatal("task of a closed pool reported as dropped")
+	}
+}
+
+func TestWorkerPoolFull(t *testing.T) {
+	p := newWorkerPool(1, 1)
+	defer p.close()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	p.push("key", func() {
+		close(started)
+		<-block
+	})
+	<-started
+
+	// One task is queued while the worker is blocked.
+	if !p.push("key", func() {}) {
+		t.Fatal("queued task dropped")
+	}
+	if p.push("key", func() {}) {
+		t.Fatal("task pushed to a full queue")
+	}
+
+	close(block)
+}